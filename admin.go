@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// requireAdmin authenticates the request and checks that the user is an
+// admin, either flagged in the database or listed in ADMIN_EMAILS. It writes
+// an error response and returns false otherwise.
+func (cfg *apiConfig) requireAdmin(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return uuid.Nil, false
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return uuid.Nil, false
+	}
+	if user == nil {
+		respondWithError(w, http.StatusForbidden, "Admin access required", nil)
+		return uuid.Nil, false
+	}
+	if cfg.adminEmails[user.Email] {
+		return userID, true
+	}
+	isAdmin, err := cfg.db.IsUserAdmin(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return uuid.Nil, false
+	}
+	if !isAdmin {
+		respondWithError(w, http.StatusForbidden, "Admin access required", nil)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// audit records an admin action. Failures are logged rather than failing the
+// action, which has already been applied.
+func (cfg *apiConfig) audit(ctx context.Context, actorID uuid.UUID, action, targetType, targetID string, details any) {
+	var detailsJSON string
+	if details != nil {
+		dat, err := json.Marshal(details)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't marshal audit details", "action", action, "error", err)
+		}
+		detailsJSON = string(dat)
+	}
+	err := cfg.db.CreateAuditLogEntry(ctx, database.CreateAuditLogEntryParams{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    detailsJSON,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't write audit log entry", "action", action, "error", err)
+	}
+}
+
+// rejectBanned writes a 403 and returns true when the user is banned.
+func (cfg *apiConfig) rejectBanned(ctx context.Context, w http.ResponseWriter, userID uuid.UUID) bool {
+	banned, err := cfg.db.IsUserBanned(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return true
+	}
+	if banned {
+		respondWithErrorCode(w, http.StatusForbidden, errCodeAccountBanned, "Your account has been banned", nil, nil)
+		return true
+	}
+	return false
+}
+
+// rejectSuspended writes a 403 and returns true when the user is suspended.
+func (cfg *apiConfig) rejectSuspended(ctx context.Context, w http.ResponseWriter, userID uuid.UUID) bool {
+	suspended, err := cfg.db.IsUserSuspended(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return true
+	}
+	if suspended {
+		respondWithErrorCode(w, http.StatusForbidden, errCodeAccountSuspended, "Your account has been suspended", nil, nil)
+		return true
+	}
+	return false
+}
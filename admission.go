@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/metrics"
+)
+
+// uploadAdmission caps how many video uploads the server accepts at once
+// and how many bytes they may bring between them, so a burst of uploads
+// can't fill the disk. Uploads over the limit wait up to queueTimeout for
+// room, then are turned away with a 503.
+type uploadAdmission struct {
+	maxUploads   int
+	maxBytes     int64
+	queueTimeout time.Duration
+	// unknownSize is charged for an upload that doesn't declare its length.
+	unknownSize int64
+	inFlight    *metrics.Gauge
+	rejected    *metrics.Counter
+
+	mu      sync.Mutex
+	uploads int
+	bytes   int64
+	// released is closed, and replaced, whenever an upload finishes.
+	released chan struct{}
+}
+
+func newUploadAdmission(maxUploads int, maxBytes int64, queueTimeout time.Duration, unknownSize int64, m *serverMetrics) *uploadAdmission {
+	return &uploadAdmission{
+		maxUploads:   maxUploads,
+		maxBytes:     maxBytes,
+		queueTimeout: queueTimeout,
+		unknownSize:  unknownSize,
+		inFlight:     m.uploadsInFlight,
+		rejected:     m.uploadsRejected,
+		released:     make(chan struct{}),
+	}
+}
+
+// fits reports whether another upload of n bytes is within the limits.
+// It must be called with mu held.
+func (a *uploadAdmission) fits(n int64) bool {
+	if a.maxUploads > 0 && a.uploads >= a.maxUploads {
+		return false
+	}
+	// A lone upload is always admitted, even if it's bigger than maxBytes.
+	if a.maxBytes > 0 && a.uploads > 0 && a.bytes+n > a.maxBytes {
+		return false
+	}
+	return true
+}
+
+// acquire waits for room for an upload of n bytes. It reports false if
+// there was none within the queue timeout or ctx ended first.
+func (a *uploadAdmission) acquire(ctx context.Context, n int64) bool {
+	var timeout <-chan time.Time
+	if a.queueTimeout > 0 {
+		timer := time.NewTimer(a.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		a.mu.Lock()
+		if a.fits(n) {
+			a.uploads++
+			a.bytes += n
+			a.mu.Unlock()
+			a.inFlight.Add(1)
+			return true
+		}
+		released := a.released
+		a.mu.Unlock()
+
+		if timeout == nil {
+			return false
+		}
+		select {
+		case <-released:
+		case <-timeout:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (a *uploadAdmission) release(n int64) {
+	a.mu.Lock()
+	a.uploads--
+	a.bytes -= n
+	close(a.released)
+	a.released = make(chan struct{})
+	a.mu.Unlock()
+	a.inFlight.Add(-1)
+}
+
+// middleware admits a request to next only when there's room for it.
+func (a *uploadAdmission) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := r.ContentLength
+		if n < 0 {
+			n = a.unknownSize
+		}
+		if !a.acquire(r.Context(), n) {
+			a.rejected.Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(max(a.queueTimeout, 5*time.Second).Seconds())))
+			respondWithErrorCode(w, http.StatusServiceUnavailable, errCodeUploadsBusy, "The server is busy with other uploads, try again shortly", nil, nil)
+			return
+		}
+		defer a.release(n)
+		next(w, r)
+	}
+}
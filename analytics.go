@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// analyticsLookback is how far back each rollup recomputes from the raw
+// events, so beacons that arrive late are still counted. Raw events have
+// to be kept at least this long.
+const analyticsLookback = 24 * time.Hour
+
+// maxHourlyAnalyticsDays bounds hourly reports.
+const maxHourlyAnalyticsDays = 7
+
+// runAnalyticsRollup rolls raw views and beacon events up into hourly and
+// daily analytics and heatmaps, then prunes the raw events and old hourly
+// rollups, until ctx is cancelled.
+func (cfg *apiConfig) runAnalyticsRollup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := cfg.rollUpAnalytics(ctx, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "Couldn't roll up analytics", "error", err)
+		}
+		err := cfg.db.DeletePlaybackEventsBefore(ctx, time.Now().Add(-cfg.beacon.retention))
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't prune old playback events", "error", err)
+		}
+		err = cfg.db.DeleteHourlyAnalyticsBefore(ctx, time.Now().Add(-cfg.analyticsHourlyRetention))
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't prune old hourly analytics", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rollUpAnalytics recomputes every rollup from the start of the day
+// analyticsLookback before now. Each run replaces what the last one wrote,
+// so instances can run it concurrently without counting anything twice.
+func (cfg *apiConfig) rollUpAnalytics(ctx context.Context, now time.Time) error {
+	since := now.UTC().Add(-analyticsLookback).Truncate(24 * time.Hour)
+
+	views, err := cfg.db.GetHourlyViews(ctx, since)
+	if err != nil {
+		return err
+	}
+	events, err := cfg.db.GetPlaybackEventsSince(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	type key struct {
+		videoID uuid.UUID
+		hour    string
+	}
+	hourly := map[key]*database.VideoAnalytics{}
+	bucket := func(videoID uuid.UUID, hour string) *database.VideoAnalytics {
+		k := key{videoID, hour}
+		if hourly[k] == nil {
+			hourly[k] = &database.VideoAnalytics{VideoID: videoID, AnalyticsBucket: database.AnalyticsBucket{Bucket: hour}}
+		}
+		return hourly[k]
+	}
+	for _, v := range views {
+		bucket(v.VideoID, v.Hour).Views += v.Views
+	}
+
+	var heatmaps []database.VideoHeatmap
+	for start := 0; start < len(events); {
+		end := start + 1
+		for end < len(events) && events[end].VideoID == events[start].VideoID {
+			end++
+		}
+		videoEvents := events[start:end]
+		start = end
+
+		// Sessions count towards the hour and day they started in.
+		days := map[string][]database.PlaybackEvent{}
+		var dayOrder []string
+		for s := 0; s < len(videoEvents); {
+			e := s + 1
+			for e < len(videoEvents) && videoEvents[e].SessionID == videoEvents[s].SessionID {
+				e++
+			}
+			session := videoEvents[s:e]
+			s = e
+
+			started := session[0].OccurredAt.UTC()
+			a := bucket(session[0].VideoID, formatAnalyticsHour(started))
+			spans := sessionSpans(session)
+			if len(spans) > 0 {
+				a.Sessions++
+			}
+			for _, span := range spans {
+				a.WatchSeconds += span.to - span.from
+			}
+			for _, e := range session {
+				if e.Type == database.PlaybackEventBuffer && e.DurationMS != nil {
+					a.BufferEvents++
+					a.BufferMS += int64(*e.DurationMS)
+				}
+			}
+
+			day := started.Format(time.DateOnly)
+			if days[day] == nil {
+				dayOrder = append(dayOrder, day)
+			}
+			days[day] = append(days[day], session...)
+		}
+		for _, day := range dayOrder {
+			heatmap := buildWatchHeatmap(days[day])
+			if heatmap.Sessions == 0 {
+				continue
+			}
+			heatmaps = append(heatmaps, database.VideoHeatmap{
+				VideoID:  videoEvents[0].VideoID,
+				Day:      day,
+				Sessions: heatmap.Sessions,
+				Viewers:  heatmap.Viewers,
+				Plays:    heatmap.Plays,
+			})
+		}
+	}
+
+	rows := make([]database.VideoAnalytics, 0, len(hourly))
+	for _, a := range hourly {
+		rows = append(rows, *a)
+	}
+	return cfg.db.ReplaceAnalytics(ctx, since, rows, heatmaps)
+}
+
+// formatAnalyticsHour formats the start of t's hour as hourly buckets are
+// stored.
+func formatAnalyticsHour(t time.Time) string {
+	return t.UTC().Truncate(time.Hour).Format("2006-01-02 15:04:05")
+}
+
+type analyticsReport struct {
+	Period  database.AnalyticsPeriod   `json:"period"`
+	Days    int                        `json:"days"`
+	Buckets []database.AnalyticsBucket `json:"buckets"`
+}
+
+// parseAnalyticsRange reads the period and days query parameters.
+func parseAnalyticsRange(r *http.Request) (database.AnalyticsPeriod, int, error) {
+	days, err := parseStatsDays(r)
+	if err != nil {
+		return "", 0, err
+	}
+	period, err := checkAnalyticsRange(database.AnalyticsPeriod(r.URL.Query().Get("period")), days)
+	if err != nil {
+		return "", 0, err
+	}
+	return period, days, nil
+}
+
+// checkAnalyticsRange defaults period to day and checks that a report can
+// cover days days broken down by it.
+func checkAnalyticsRange(period database.AnalyticsPeriod, days int) (database.AnalyticsPeriod, error) {
+	if period == "" {
+		period = database.AnalyticsDay
+	}
+	if period != database.AnalyticsHour && period != database.AnalyticsDay {
+		return "", errors.New("period must be hour or day")
+	}
+	if days < 1 || days > maxStatsDays {
+		return "", errors.New("days must be between 1 and 365")
+	}
+	if period == database.AnalyticsHour && days > maxHourlyAnalyticsDays {
+		return "", errors.New("hourly reports cover at most 7 days")
+	}
+	return period, nil
+}
+
+// newAnalyticsReport returns one bucket per period from since to now, with
+// zeros for periods without activity, so charts don't have to fill gaps.
+func newAnalyticsReport(buckets []database.AnalyticsBucket, period database.AnalyticsPeriod, since time.Time, days int) analyticsReport {
+	byBucket := make(map[string]database.AnalyticsBucket, len(buckets))
+	for _, b := range buckets {
+		byBucket[b.Bucket] = b
+	}
+	step, format := 24*time.Hour, time.DateOnly
+	if period == database.AnalyticsHour {
+		step, format = time.Hour, "2006-01-02 15:04:05"
+	}
+	now := time.Now()
+	filled := []database.AnalyticsBucket{}
+	for t := since; !t.After(now); t = t.Add(step) {
+		name := t.Format(format)
+		b, ok := byBucket[name]
+		if !ok {
+			b = database.AnalyticsBucket{Bucket: name}
+		}
+		filled = append(filled, b)
+	}
+	return analyticsReport{Period: period, Days: days, Buckets: filled}
+}
+
+// analyticsBucketStart is the first bucket name a report asks for.
+func analyticsBucketStart(period database.AnalyticsPeriod, since time.Time) string {
+	if period == database.AnalyticsHour {
+		return formatAnalyticsHour(since)
+	}
+	return since.Format(time.DateOnly)
+}
+
+// handlerVideoAnalytics reports a video's views, sessions, watch time, and
+// buffering per hour or day.
+func (cfg *apiConfig) handlerVideoAnalytics(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	period, days, err := parseAnalyticsRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	since := statsSince(days)
+
+	buckets, err := cfg.db.GetVideoAnalytics(r.Context(), video.ID, period, analyticsBucketStart(period, since))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get analytics", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newAnalyticsReport(buckets, period, since, days))
+}
+
+// handlerChannelAnalytics reports the same totals for all of a channel's
+// videos. Any member of the channel can see them.
+func (cfg *apiConfig) handlerChannelAnalytics(w http.ResponseWriter, r *http.Request) {
+	channel, _, ok := cfg.getChannelWithRole(w, r, database.ChannelRoleViewer)
+	if !ok {
+		return
+	}
+	period, days, err := parseAnalyticsRange(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	since := statsSince(days)
+
+	buckets, err := cfg.db.GetChannelAnalytics(r.Context(), channel.ID, period, analyticsBucketStart(period, since))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get analytics", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newAnalyticsReport(buckets, period, since, days))
+}
@@ -24,15 +24,16 @@ document.getElementById('login-form').addEventListener('submit', async (event) =
 async function createVideoDraft() {
   const title = document.getElementById('video-title').value;
   const description = document.getElementById('video-description').value;
+  const visibility = document.getElementById('video-visibility').value;
 
   try {
-    const res = await fetch('/api/videos', {
+    const res = await fetch('/api/v1/videos', {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
         Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
-      body: JSON.stringify({ title, description }),
+      body: JSON.stringify({ title, description, visibility }),
     });
     const data = await res.json();
     if (!res.ok) {
@@ -54,7 +55,7 @@ async function login() {
   const password = document.getElementById('password').value;
 
   try {
-    const res = await fetch('/api/login', {
+    const res = await fetch('/api/v1/login', {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -84,7 +85,7 @@ async function signup() {
   const password = document.getElementById('password').value;
 
   try {
-    const res = await fetch('/api/users', {
+    const res = await fetch('/api/v1/users', {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -130,7 +131,7 @@ async function uploadThumbnail(videoID) {
   setUploadButtonState(true, uploadBtnSelector);
 
   try {
-    const res = await fetch(`/api/thumbnail_upload/${videoID}`, {
+    const res = await fetch(`/api/v1/thumbnail_upload/${videoID}`, {
       method: 'POST',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -163,7 +164,7 @@ async function uploadVideoFile(videoID) {
   setUploadButtonState(true, uploadBtnSelector);
 
   try {
-    const res = await fetch(`/api/video_upload/${videoID}`, {
+    const res = await fetch(`/api/v1/video_upload/${videoID}`, {
       method: 'POST',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -186,27 +187,50 @@ async function uploadVideoFile(videoID) {
 
 const videoStateHandler = createVideoStateHandler();
 
-async function getVideos() {
-  try {
-    const res = await fetch('/api/videos', {
-      method: 'GET',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
-    });
-    if (!res.ok) {
-      const data = await res.json();
-      throw new Error(`Failed to get videos. Error: ${data.error}`);
+// nextPageURL returns the URL in a response's Link header with rel="next",
+// or null on the last page.
+function nextPageURL(res) {
+  const header = res.headers.get('Link');
+  if (!header) {
+    return null;
+  }
+  for (const link of header.split(',')) {
+    const match = link.match(/<([^>]*)>\s*;\s*rel="next"/);
+    if (match) {
+      return match[1];
     }
+  }
+  return null;
+}
 
-    const videos = await res.json();
+async function getVideos() {
+  try {
     const videoList = document.getElementById('video-list');
     videoList.innerHTML = '';
-    for (const video of videos) {
-      const listItem = document.createElement('li');
-      listItem.textContent = video.title;
-      listItem.onclick = () => videoStateHandler(video.id);
-      videoList.appendChild(listItem);
+
+    // Follow the next links until the last page, so users with more
+    // videos than fit on one page see all of them.
+    let url = '/api/v1/videos?limit=100';
+    while (url) {
+      const res = await fetch(url, {
+        method: 'GET',
+        headers: {
+          Authorization: `Bearer ${localStorage.getItem('token')}`,
+        },
+      });
+      if (!res.ok) {
+        const data = await res.json();
+        throw new Error(`Failed to get videos. Error: ${data.error}`);
+      }
+
+      const videos = await res.json();
+      for (const video of videos) {
+        const listItem = document.createElement('li');
+        listItem.textContent = video.title;
+        listItem.onclick = () => videoStateHandler(video.id);
+        videoList.appendChild(listItem);
+      }
+      url = nextPageURL(res);
     }
   } catch (error) {
     alert(`Error: ${error.message}`);
@@ -231,7 +255,7 @@ function createVideoStateHandler() {
 
 async function getVideo(videoID) {
   try {
-    const res = await fetch(`/api/videos/${videoID}`, {
+    const res = await fetch(`/api/v1/videos/${videoID}`, {
       method: 'GET',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -283,7 +307,7 @@ async function deleteVideo() {
   }
 
   try {
-    const res = await fetch(`/api/videos/${currentVideo.id}`, {
+    const res = await fetch(`/api/v1/videos/${currentVideo.id}`, {
       method: 'DELETE',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+)
+
+const (
+	// audioMediaType is the type audio renditions are stored and served as.
+	// Podcast apps know M4A files by this one.
+	audioMediaType = "audio/x-m4a"
+	audioBitrate   = "128k"
+)
+
+// extractAudio encodes a video's audio as AAC in an M4A file beside it.
+func extractAudio(ctx context.Context, ffmpegPath, filePath string) (string, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg audio", tracing.KindInternal)
+	defer span.End()
+	outputPath := filePath + ".audio.m4a"
+	cmd := exec.CommandContext(ctx,
+		ffmpegPath, "-i", filePath,
+		"-vn", "-c:a", "aac", "-b:a", audioBitrate,
+		"-movflags", "faststart",
+		"-y", outputPath,
+	)
+	if err := runCommand(cmd); err != nil {
+		span.RecordError(err)
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// packageVideoAudio extracts a video's audio, for listening without the
+// picture and for podcast feeds, and stores it in S3.
+func (cfg *apiConfig) packageVideoAudio(ctx context.Context, processedPath string, probe videoProbe) (database.Rendition, error) {
+	var audioPath string
+	err := cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		audioPath, err = extractAudio(ctx, cfg.ffmpegPath, processedPath)
+		return err
+	})
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't extract audio: %w", err)
+	}
+	defer os.Remove(audioPath)
+
+	key, size, err := cfg.uploadEncodedFile(ctx, audioPath, "audio", audioMediaType)
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't write audio to s3: %w", err)
+	}
+	var bitrate int64
+	if probe.DurationSeconds > 0 {
+		bitrate = int64(float64(size*8) / probe.DurationSeconds)
+	}
+	return database.Rendition{
+		Quality:   database.RenditionQualityAudio,
+		Codec:     "aac",
+		S3Key:     key,
+		SizeBytes: size,
+		Bitrate:   bitrate,
+	}, nil
+}
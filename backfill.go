@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type reprocessVideoPayload struct {
+	// BackfillID is the backfill the job is part of, or uuid.Nil when the
+	// video's owner asked for it to be reprocessed.
+	BackfillID uuid.UUID `json:"backfill_id"`
+}
+
+// runBackfiller keeps the active backfill's videos flowing into the job
+// queue. It returns when ctx is cancelled.
+func (cfg *apiConfig) runBackfiller(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cfg.advanceBackfill(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// advanceBackfill queues the running backfill's next videos, keeping at
+// most backfillMaxQueued reprocessing jobs unfinished so uploads aren't
+// stuck behind the whole library. It completes the backfill once every
+// video has been queued and processed.
+func (cfg *apiConfig) advanceBackfill(ctx context.Context) {
+	backfill, err := cfg.db.GetActiveBackfill(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get active backfill", "error", err)
+		return
+	}
+	if backfill == nil || backfill.Status != database.BackfillRunning {
+		return
+	}
+
+	unfinished, err := cfg.db.CountUnfinishedJobs(ctx, jobTypeReprocessVideo)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't count reprocessing jobs", "error", err)
+		return
+	}
+	room := cfg.backfillMaxQueued - unfinished
+	if room <= 0 {
+		return
+	}
+	videoIDs, err := cfg.db.GetBackfillVideos(ctx, backfill.LastVideoID, room)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get videos to backfill", "backfill_id", backfill.ID, "error", err)
+		return
+	}
+	if len(videoIDs) == 0 {
+		if unfinished > 0 {
+			return
+		}
+		completed, err := cfg.db.SetBackfillStatus(ctx, backfill.ID, database.BackfillRunning, database.BackfillCompleted)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't complete backfill", "backfill_id", backfill.ID, "error", err)
+			return
+		}
+		if completed {
+			slog.InfoContext(ctx, "Backfill completed", "backfill_id", backfill.ID, "succeeded", backfill.Succeeded, "failed", backfill.Failed, "skipped", backfill.Skipped)
+		}
+		return
+	}
+
+	for _, videoID := range videoIDs {
+		_, err := cfg.db.CreateJob(ctx, database.CreateJobParams{
+			Type:        jobTypeReprocessVideo,
+			VideoID:     &videoID,
+			Payload:     reprocessVideoPayload{BackfillID: backfill.ID},
+			MaxAttempts: cfg.jobMaxAttempts,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't queue backfill job", "backfill_id", backfill.ID, "video_id", videoID, "error", err)
+			return
+		}
+		if err := cfg.db.AdvanceBackfill(ctx, backfill.ID, videoID); err != nil {
+			slog.ErrorContext(ctx, "Couldn't record backfill progress", "backfill_id", backfill.ID, "error", err)
+			return
+		}
+		backfill.Queued++
+	}
+	slog.InfoContext(ctx, "Backfill progress", "backfill_id", backfill.ID, "queued", backfill.Queued, "total", backfill.Total)
+}
+
+// runReprocessVideoJob runs a video back through processing. For a
+// backfill the owner isn't notified; nothing about the video changed from
+// their point of view. A reprocess the owner asked for ends like an upload.
+func (cfg *apiConfig) runReprocessVideoJob(ctx context.Context, job database.Job) error {
+	var payload reprocessVideoPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if job.VideoID == nil {
+		return errors.New("job has no video")
+	}
+
+	result, err := cfg.reprocessVideo(ctx, payload.BackfillID, *job.VideoID)
+	if err != nil {
+		err = &jobInputError{err: err, input: map[string]any{
+			"video_id":    *job.VideoID,
+			"backfill_id": payload.BackfillID,
+		}}
+		var openErr *circuitOpenError
+		final := job.Attempts >= job.MaxAttempts && !errors.Is(context.Cause(ctx), errShuttingDown) && !errors.As(err, &openErr)
+		if !final {
+			return err
+		}
+		result = database.BackfillResultFailed
+	}
+	if payload.BackfillID == uuid.Nil {
+		cfg.finishRequestedReprocess(context.WithoutCancel(ctx), *job.VideoID, result)
+		return err
+	}
+	if rerr := cfg.db.RecordBackfillResult(context.WithoutCancel(ctx), payload.BackfillID, result); rerr != nil {
+		slog.ErrorContext(ctx, "Couldn't record backfill result", "backfill_id", payload.BackfillID, "error", rerr)
+	}
+	return err
+}
+
+// reprocessVideo downloads a video's stored file, processes it again with
+// the current pipeline, and deletes the objects the new ones replaced.
+// Videos without a usable file, or whose backfill was cancelled, are
+// skipped.
+func (cfg *apiConfig) reprocessVideo(ctx context.Context, backfillID, videoID uuid.UUID) (database.BackfillResult, error) {
+	if backfillID != uuid.Nil {
+		backfill, err := cfg.db.GetBackfill(ctx, backfillID)
+		if err != nil {
+			return "", fmt.Errorf("couldn't get backfill: %w", err)
+		}
+		if backfill == nil || backfill.Status == database.BackfillCancelled {
+			return database.BackfillResultSkipped, nil
+		}
+	}
+	video, err := cfg.db.GetVideo(ctx, videoID)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil || video.VideoURL == nil || video.DeletedAt != nil {
+		return database.BackfillResultSkipped, nil
+	}
+	// A quarantined file isn't at the serving path; it's reviewed as it is.
+	quarantined, err := cfg.db.GetQuarantinedObject(ctx, videoID)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get quarantined file: %w", err)
+	}
+	if quarantined != nil && quarantined.Status == database.QuarantinePending {
+		return database.BackfillResultSkipped, nil
+	}
+
+	oldRenditions, err := cfg.db.GetRenditions(ctx, videoID)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get renditions: %w", err)
+	}
+	oldKeys := map[string]bool{}
+	for _, rendition := range oldRenditions {
+		oldKeys[rendition.S3Key] = true
+	}
+	sourceKey, ok := cfg.s3KeyFromURL(*video.VideoURL)
+	if !ok {
+		return database.BackfillResultSkipped, nil
+	}
+	oldKeys[sourceKey] = true
+	// The video keeps the container profile it was uploaded with, unless
+	// that's since been turned off.
+	containerProfile := cfg.defaultContainerProfile
+	for _, rendition := range oldRenditions {
+		if rendition.Quality == database.RenditionQualitySource {
+			sourceKey = rendition.S3Key
+			containerProfile = cfg.containerProfileOrDefault(rendition.ContainerProfile)
+		}
+	}
+
+	sourcePath, err := cfg.downloadVideoSource(ctx, sourceKey)
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		slog.WarnContext(ctx, "Skipped backfill of video with missing file", "video_id", videoID, "key", sourceKey)
+		return database.BackfillResultSkipped, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("couldn't download video: %w", err)
+	}
+	defer os.Remove(sourcePath)
+
+	if err := cfg.processVideo(ctx, videoID, sourcePath, containerProfile); err != nil {
+		return "", err
+	}
+
+	newRenditions, err := cfg.db.GetRenditions(ctx, videoID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get new renditions", "video_id", videoID, "error", err)
+		return database.BackfillResultSucceeded, nil
+	}
+	for _, rendition := range newRenditions {
+		delete(oldKeys, rendition.S3Key)
+	}
+	for key := range oldKeys {
+		if err := cfg.deleteVideoObject(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "Couldn't delete replaced video object", "video_id", videoID, "key", key, "error", err)
+		}
+	}
+	return database.BackfillResultSucceeded, nil
+}
+
+// downloadVideoSource copies a stored video file into the uploads
+// directory for processing. The caller removes it; it's named like a
+// spooled upload so removeStaleSources catches it after a crash.
+func (cfg *apiConfig) downloadVideoSource(ctx context.Context, key string) (string, error) {
+	out, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+
+	file, err := os.CreateTemp(cfg.uploadsRoot, "upload-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, out.Body)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// backupPrefix is where database backups are kept in the bucket. Backup keys
+// embed their creation time so they sort oldest first.
+const backupPrefix = "backups/"
+
+// encryptedBackupSuffix marks backups written with BACKUP_ENCRYPTION_KEY.
+const encryptedBackupSuffix = ".enc"
+
+// errBackupKeyMissing is returned when a backup is asked for without
+// BACKUP_ENCRYPTION_KEY. The bucket is served by the CDN, so backups are
+// never written to it unencrypted.
+var errBackupKeyMissing = errors.New("BACKUP_ENCRYPTION_KEY is not set")
+
+// backupMu keeps a scheduled backup and one triggered by an admin from
+// running at the same time.
+var backupMu sync.Mutex
+
+type backupInfo struct {
+	Key          string    `json:"key"`
+	SizeBytes    int64     `json:"size_bytes"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// runBackupScheduler backs the database up to S3 every interval. It returns
+// when ctx is cancelled.
+func (cfg *apiConfig) runBackupScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		backup, err := cfg.backupDatabase(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't back up database", "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Backed up database", "key", backup.Key)
+	}
+}
+
+// backupDatabase snapshots the database, encrypts it, uploads it, and then
+// deletes backups beyond the retention count.
+func (cfg *apiConfig) backupDatabase(ctx context.Context) (backupInfo, error) {
+	if cfg.backupKey == nil {
+		return backupInfo{}, errBackupKeyMissing
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	dir, err := os.MkdirTemp("", "tubely-backup-")
+	if err != nil {
+		return backupInfo{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshotPath := filepath.Join(dir, "snapshot")
+	if err := cfg.db.Backup(ctx, snapshotPath); err != nil {
+		return backupInfo{}, fmt.Errorf("couldn't snapshot database: %w", err)
+	}
+
+	now := time.Now().UTC()
+	key := backupPrefix + now.Format("20060102T150405Z") + ".backup" + encryptedBackupSuffix
+	uploadPath := snapshotPath + encryptedBackupSuffix
+	if err := encryptBackupFile(uploadPath, snapshotPath, cfg.backupKey); err != nil {
+		return backupInfo{}, fmt.Errorf("couldn't encrypt backup: %w", err)
+	}
+
+	file, err := os.Open(uploadPath)
+	if err != nil {
+		return backupInfo{}, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return backupInfo{}, err
+	}
+
+	contentType := "application/octet-stream"
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               &cfg.s3Bucket,
+		Key:                  &key,
+		Body:                 file,
+		ContentType:          &contentType,
+		ServerSideEncryption: types.ServerSideEncryptionAes256,
+	})
+	if err != nil {
+		return backupInfo{}, fmt.Errorf("couldn't upload backup: %w", err)
+	}
+
+	if err := cfg.rotateBackups(ctx); err != nil {
+		slog.ErrorContext(ctx, "Couldn't rotate backups", "error", err)
+	}
+	return backupInfo{Key: key, SizeBytes: stat.Size(), LastModified: now}, nil
+}
+
+// rotateBackups deletes all but the newest cfg.backupRetention backups.
+func (cfg *apiConfig) rotateBackups(ctx context.Context) error {
+	if cfg.backupRetention <= 0 {
+		return nil
+	}
+	backups, err := listBackups(ctx, cfg.s3Client, cfg.s3Bucket)
+	if err != nil {
+		return err
+	}
+	for len(backups) > cfg.backupRetention {
+		if err := cfg.deleteS3Object(ctx, backups[0].Key); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// listBackups returns the backups in the bucket, oldest first.
+func listBackups(ctx context.Context, client s3API, bucket string) ([]backupInfo, error) {
+	prefix := backupPrefix
+	backups := []backupInfo{}
+	var token *string
+	for {
+		out, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            &bucket,
+			Prefix:            &prefix,
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range out.Contents {
+			backup := backupInfo{Key: *obj.Key}
+			if obj.Size != nil {
+				backup.SizeBytes = *obj.Size
+			}
+			if obj.LastModified != nil {
+				backup.LastModified = *obj.LastModified
+			}
+			backups = append(backups, backup)
+		}
+		if out.IsTruncated == nil || !*out.IsTruncated {
+			break
+		}
+		token = out.NextContinuationToken
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Key < backups[j].Key })
+	return backups, nil
+}
+
+// runRestore implements the restore subcommand:
+//
+//	tubely restore        list the backups in the bucket
+//	tubely restore KEY    replace the database with the backup at KEY
+//
+// The server must not be running while a backup is restored.
+func runRestore(dsn string, args []string) {
+	ctx := context.Background()
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		log.Fatal("S3_BUCKET environment variable is not set")
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, config.WithRegion(os.Getenv("S3_REGION")))
+	if err != nil {
+		log.Fatal("Unable to load aws config")
+	}
+	client := s3.NewFromConfig(awsConfig)
+
+	if len(args) == 0 {
+		backups, err := listBackups(ctx, client, bucket)
+		if err != nil {
+			log.Fatalf("Couldn't list backups: %v", err)
+		}
+		for _, backup := range backups {
+			fmt.Printf("%-50s %12d  %s\n", backup.Key, backup.SizeBytes, backup.LastModified.Format("2006-01-02 15:04:05"))
+		}
+		return
+	}
+	key := args[0]
+
+	dir, err := os.MkdirTemp("", "tubely-restore-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		log.Fatalf("Couldn't download backup: %v", err)
+	}
+	downloadPath := filepath.Join(dir, "download")
+	err = writeFile(downloadPath, out.Body)
+	out.Body.Close()
+	if err != nil {
+		log.Fatalf("Couldn't download backup: %v", err)
+	}
+
+	snapshotPath := downloadPath
+	if strings.HasSuffix(key, encryptedBackupSuffix) {
+		backupKey, err := loadBackupKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if backupKey == nil {
+			log.Fatal("BACKUP_ENCRYPTION_KEY must be set to restore an encrypted backup")
+		}
+		snapshotPath = filepath.Join(dir, "snapshot")
+		if err := decryptBackupFile(snapshotPath, downloadPath, backupKey); err != nil {
+			log.Fatalf("Couldn't decrypt backup: %v", err)
+		}
+	}
+
+	if err := database.Restore(ctx, dsn, snapshotPath); err != nil {
+		log.Fatalf("Couldn't restore backup: %v", err)
+	}
+	fmt.Printf("Restored %s\n", key)
+}
+
+func writeFile(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadBackupKey reads the AES-256 key for backup encryption. It returns nil
+// when BACKUP_ENCRYPTION_KEY isn't set.
+func loadBackupKey() ([]byte, error) {
+	return parseBackupKey(os.Getenv("BACKUP_ENCRYPTION_KEY"))
+}
+
+func parseBackupKey(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("BACKUP_ENCRYPTION_KEY must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// Encrypted backups are AES-256-GCM in independently sealed chunks so they
+// can be streamed. The file starts with backupMagic and a random nonce
+// prefix; each chunk is a flag byte marking the last chunk, the sealed
+// length, and the sealed data. The flag is authenticated so a truncated
+// backup fails to decrypt.
+const backupChunkSize = 1 << 20
+
+var backupMagic = []byte("TUBELYBK1")
+
+func encryptBackupFile(dstPath, srcPath string, key []byte) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(dst)
+	if err := encryptBackup(w, src, key); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func decryptBackupFile(dstPath, srcPath string, key []byte) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(dst)
+	if err := decryptBackup(w, bufio.NewReader(src), key); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func newBackupAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptBackup(dst io.Writer, src io.Reader, key []byte) error {
+	aead, err := newBackupAEAD(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	prefix := nonce[:len(nonce)-4]
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	if _, err := dst.Write(backupMagic); err != nil {
+		return err
+	}
+	if _, err := dst.Write(prefix); err != nil {
+		return err
+	}
+
+	buf := make([]byte, backupChunkSize)
+	var header [5]byte
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(src, buf)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return err
+		}
+		header[0] = 0
+		if final {
+			header[0] = 1
+		}
+		binary.BigEndian.PutUint32(nonce[len(prefix):], counter)
+		sealed := aead.Seal(nil, nonce, buf[:n], header[:1])
+		binary.BigEndian.PutUint32(header[1:], uint32(len(sealed)))
+		if _, err := dst.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+func decryptBackup(dst io.Writer, src io.Reader, key []byte) error {
+	aead, err := newBackupAEAD(key)
+	if err != nil {
+		return err
+	}
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(src, magic); err != nil || string(magic) != string(backupMagic) {
+		return errors.New("not an encrypted backup")
+	}
+	nonce := make([]byte, aead.NonceSize())
+	prefix := nonce[:len(nonce)-4]
+	if _, err := io.ReadFull(src, prefix); err != nil {
+		return errors.New("not an encrypted backup")
+	}
+
+	var header [5]byte
+	for counter := uint32(0); ; counter++ {
+		if _, err := io.ReadFull(src, header[:]); err != nil {
+			return errors.New("backup is truncated")
+		}
+		size := binary.BigEndian.Uint32(header[1:])
+		if size > backupChunkSize+uint32(aead.Overhead()) {
+			return errors.New("backup is corrupt")
+		}
+		sealed := make([]byte, size)
+		if _, err := io.ReadFull(src, sealed); err != nil {
+			return errors.New("backup is truncated")
+		}
+		binary.BigEndian.PutUint32(nonce[len(prefix):], counter)
+		plain, err := aead.Open(sealed[:0], nonce, sealed, header[:1])
+		if err != nil {
+			return errors.New("backup is corrupt or the key is wrong")
+		}
+		if _, err := dst.Write(plain); err != nil {
+			return err
+		}
+		if header[0] == 1 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// beaconMaxBytes and beaconMaxEvents bound one batch.
+	beaconMaxBytes  = 64 << 10
+	beaconMaxEvents = 100
+	// beaconClockSkew is how far an event's timestamp may be from the
+	// server's clock before the time it was received is used instead.
+	beaconClockSkew = 24 * time.Hour
+)
+
+// beaconConfig controls how much playback is recorded.
+type beaconConfig struct {
+	// sampleRate is the fraction of playback sessions recorded. 0 turns
+	// the beacon off.
+	sampleRate float64
+	retention  time.Duration
+}
+
+// sampled picks sessions by hashing their ID, so a session's events are
+// either all recorded or all dropped.
+func (b beaconConfig) sampled(sessionID string) bool {
+	if b.sampleRate >= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	return float64(h.Sum32())/(1<<32) < b.sampleRate
+}
+
+type beaconEvent struct {
+	Type            database.PlaybackEventType `json:"type"`
+	PositionSeconds float64                    `json:"position_seconds"`
+	// Timestamp is when the event happened, in Unix milliseconds.
+	Timestamp   int64    `json:"timestamp"`
+	FromSeconds *float64 `json:"from_seconds"`
+	Quality     *string  `json:"quality"`
+	DurationMS  *int     `json:"duration_ms"`
+}
+
+type beaconResponse struct {
+	Accepted   int     `json:"accepted"`
+	SampleRate float64 `json:"sample_rate"`
+}
+
+// handlerBeacon records a batch of events from one playback session. It
+// takes any content type, since navigator.sendBeacon can't send JSON as
+// application/json, and doesn't need a token, though events are only
+// accepted for videos the caller could watch. Sessions that aren't
+// sampled are accepted and dropped, so players needn't know the rate.
+func (cfg *apiConfig) handlerBeacon(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID   uuid.UUID     `json:"video_id"`
+		SessionID string        `json:"session_id"`
+		Events    []beaconEvent `json:"events"`
+		// ThumbnailVariantID is the thumbnail variant the session was
+		// started from, if the listing showed one.
+		ThumbnailVariantID *uuid.UUID `json:"thumbnail_variant_id"`
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, beaconMaxBytes)
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.SessionID == "" || len(params.SessionID) > 64 {
+		respondWithError(w, http.StatusBadRequest, "session_id must be 1 to 64 characters", nil)
+		return
+	}
+	if len(params.Events) > beaconMaxEvents {
+		respondWithError(w, http.StatusBadRequest, "Too many events in one batch", nil)
+		return
+	}
+	for _, e := range params.Events {
+		if !validPlaybackEvent(e) {
+			respondWithError(w, http.StatusBadRequest, "Invalid event", nil)
+			return
+		}
+	}
+
+	// Thumbnail clicks are counted for every session, since impressions
+	// aren't sampled either.
+	resp := beaconResponse{SampleRate: cfg.beacon.sampleRate}
+	sampled := len(params.Events) > 0 && cfg.beacon.sampled(params.SessionID)
+	if !sampled && params.ThumbnailVariantID == nil {
+		respondWithJSON(w, http.StatusAccepted, resp)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(r.Context(), video, cfg.optionalUserID(r)) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if params.ThumbnailVariantID != nil {
+		if err := cfg.recordThumbnailClick(r.Context(), video.ID, *params.ThumbnailVariantID, params.SessionID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't record thumbnail click", err)
+			return
+		}
+	}
+	if !sampled {
+		respondWithJSON(w, http.StatusAccepted, resp)
+		return
+	}
+
+	now := time.Now().UTC()
+	events := make([]database.PlaybackEvent, len(params.Events))
+	for i, e := range params.Events {
+		occurredAt := time.UnixMilli(e.Timestamp).UTC()
+		if e.Timestamp == 0 || occurredAt.Before(now.Add(-beaconClockSkew)) || occurredAt.After(now.Add(beaconClockSkew)) {
+			occurredAt = now
+		}
+		events[i] = database.PlaybackEvent{
+			VideoID:         video.ID,
+			SessionID:       params.SessionID,
+			Type:            e.Type,
+			PositionSeconds: e.PositionSeconds,
+			FromSeconds:     e.FromSeconds,
+			Quality:         e.Quality,
+			DurationMS:      e.DurationMS,
+			OccurredAt:      occurredAt,
+		}
+	}
+	if err := cfg.db.RecordPlaybackEvents(r.Context(), events); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record events", err)
+		return
+	}
+	resp.Accepted = len(events)
+	respondWithJSON(w, http.StatusAccepted, resp)
+}
+
+// validPlaybackEvent checks an event has the fields its type needs.
+func validPlaybackEvent(e beaconEvent) bool {
+	if e.PositionSeconds < 0 {
+		return false
+	}
+	switch e.Type {
+	case database.PlaybackEventPlay, database.PlaybackEventPause:
+		return true
+	case database.PlaybackEventSeek:
+		return e.FromSeconds != nil && *e.FromSeconds >= 0
+	case database.PlaybackEventQualitySwitch:
+		return e.Quality != nil && *e.Quality != "" && len(*e.Quality) <= 32
+	case database.PlaybackEventBuffer:
+		return e.DurationMS != nil && *e.DurationMS >= 0
+	}
+	return false
+}
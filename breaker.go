@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/metrics"
+)
+
+type circuitState int
+
+// A breaker is closed while its dependency works. After threshold
+// consecutive failures it opens and fails calls immediately. Once cooldown
+// has passed it's half-open: one call is let through as a probe, which
+// closes the breaker if it succeeds and reopens it if it fails.
+const (
+	circuitClosed circuitState = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+// callOutcome is how a breaker counts a call's result.
+type callOutcome int
+
+const (
+	callSucceeded callOutcome = iota
+	callFailed
+	// callIgnored results say nothing about the dependency, such as the
+	// caller giving up.
+	callIgnored
+)
+
+// circuitOpenError is returned instead of calling a dependency whose
+// breaker is open.
+type circuitOpenError struct {
+	service    string
+	retryAfter time.Duration
+}
+
+func (e *circuitOpenError) Error() string {
+	return e.service + " temporarily unavailable"
+}
+
+type circuitBreaker struct {
+	// name labels the breaker's metric; service describes the dependency to
+	// users.
+	name      string
+	service   string
+	threshold int
+	cooldown  time.Duration
+	classify  func(ctx context.Context, err error) callOutcome
+	gauge     *metrics.Gauge
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(name, service string, threshold int, cooldown time.Duration, classify func(context.Context, error) callOutcome, gauge *metrics.Gauge) *circuitBreaker {
+	b := &circuitBreaker{
+		name:      name,
+		service:   service,
+		threshold: threshold,
+		cooldown:  cooldown,
+		classify:  classify,
+		gauge:     gauge,
+	}
+	gauge.Set(float64(circuitClosed), name)
+	return b
+}
+
+// do calls fn unless the breaker is open, and counts its result.
+func (b *circuitBreaker) do(ctx context.Context, fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(b.classify(ctx, err))
+	return err
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		wait := b.cooldown - time.Since(b.openedAt)
+		if wait > 0 {
+			return &circuitOpenError{service: b.service, retryAfter: wait}
+		}
+		b.setState(circuitHalfOpen)
+		fallthrough
+	case circuitHalfOpen:
+		if b.probing {
+			return &circuitOpenError{service: b.service, retryAfter: time.Second}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *circuitBreaker) record(outcome callOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	probe := b.probing
+	b.probing = false
+	switch outcome {
+	case callSucceeded:
+		b.failures = 0
+		b.setState(circuitClosed)
+	case callFailed:
+		b.failures++
+		if probe || b.failures >= b.threshold {
+			b.openedAt = time.Now()
+			b.setState(circuitOpen)
+		}
+	}
+}
+
+// setState must be called with mu held.
+func (b *circuitBreaker) setState(state circuitState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	b.gauge.Set(float64(state), b.name)
+}
+
+// classifyS3 counts 5xx responses, throttling, and network errors as
+// failures. Client errors such as a missing key show S3 is up.
+func classifyS3(ctx context.Context, err error) callOutcome {
+	if err == nil {
+		return callSucceeded
+	}
+	if ctx.Err() != nil {
+		return callIgnored
+	}
+	var resp interface{ HTTPStatusCode() int }
+	if errors.As(err, &resp) && resp.HTTPStatusCode() < 500 && resp.HTTPStatusCode() != 429 {
+		return callSucceeded
+	}
+	return callFailed
+}
+
+// classifyFFmpeg only counts ffmpeg or ffprobe failing to start or being
+// killed as failures. Exiting with an error usually means a bad input.
+func classifyFFmpeg(ctx context.Context, err error) callOutcome {
+	if err == nil {
+		return callSucceeded
+	}
+	if ctx.Err() != nil {
+		return callIgnored
+	}
+	var cmdErr *commandError
+	if !errors.As(err, &cmdErr) {
+		return callSucceeded
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return callSucceeded
+	}
+	return callFailed
+}
+
+// breakerS3 fails S3 calls fast while S3 is failing.
+type breakerS3 struct {
+	s3API
+	breaker *circuitBreaker
+}
+
+func (s breakerS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (out *s3.PutObjectOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.PutObject(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (out *s3.GetObjectOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.GetObject(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (out *s3.DeleteObjectOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.DeleteObject(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (out *s3.CopyObjectOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.CopyObject(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) PutObjectLegalHold(ctx context.Context, params *s3.PutObjectLegalHoldInput, optFns ...func(*s3.Options)) (out *s3.PutObjectLegalHoldOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.PutObjectLegalHold(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) PutObjectRetention(ctx context.Context, params *s3.PutObjectRetentionInput, optFns ...func(*s3.Options)) (out *s3.PutObjectRetentionOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.PutObjectRetention(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (out *s3.ListObjectsV2Output, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.ListObjectsV2(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (out *s3.HeadBucketOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.HeadBucket(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (out *s3.CreateMultipartUploadOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.CreateMultipartUpload(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (out *s3.UploadPartOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.UploadPart(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (out *s3.CompleteMultipartUploadOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.CompleteMultipartUpload(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (out *s3.AbortMultipartUploadOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.AbortMultipartUpload(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (s breakerS3) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (out *s3.ListMultipartUploadsOutput, err error) {
+	err = s.breaker.do(ctx, func() error {
+		out, err = s.s3API.ListMultipartUploads(ctx, params, optFns...)
+		return err
+	})
+	return out, err
+}
+
+// retryAfterSeconds formats a wait for a Retry-After header, rounding up.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
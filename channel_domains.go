@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// channelDomainCacheTTL is how long a host's channel is remembered, and
+	// so how long another instance takes to notice a domain was changed.
+	channelDomainCacheTTL = time.Minute
+	// channelDomainCacheMax bounds the cache, which also remembers hosts
+	// that aren't channel domains.
+	channelDomainCacheMax = 10000
+	// channelDomainSyncInterval is how often certificates for channel
+	// domains are loaded, renewed, and retried.
+	channelDomainSyncInterval = 10 * time.Minute
+	// channelDomainIssueTimeout bounds getting a certificate for a domain
+	// that was just added. A domain still pending after it is fair game for
+	// other instances' syncs.
+	channelDomainIssueTimeout = 10 * time.Minute
+	// channelDomainRetryInterval spaces out retries of failed domains, to
+	// stay inside the CA's limit on failed validations.
+	channelDomainRetryInterval = time.Hour
+)
+
+// channelHost is the channel domain a request came in on.
+type channelHost struct {
+	ChannelID uuid.UUID
+	Domain    string
+}
+
+type channelHostKey struct{}
+
+func channelHostFromContext(ctx context.Context) (channelHost, bool) {
+	host, ok := ctx.Value(channelHostKey{}).(channelHost)
+	return host, ok
+}
+
+type channelDomainEntry struct {
+	channelID uuid.UUID
+	expires   time.Time
+}
+
+// channelDomainCache maps request hosts to the channel serving them, with
+// uuid.Nil for hosts no active channel domain matches.
+type channelDomainCache struct {
+	// skip holds the server's own hosts, which are never looked up.
+	skip map[string]bool
+
+	mu      sync.Mutex
+	entries map[string]channelDomainEntry
+}
+
+func newChannelDomainCache(baseURL string, tlsDomains []string) *channelDomainCache {
+	c := &channelDomainCache{skip: map[string]bool{"localhost": true}, entries: map[string]channelDomainEntry{}}
+	if u, err := url.Parse(baseURL); err == nil {
+		c.skip[strings.ToLower(u.Hostname())] = true
+	}
+	for _, domain := range tlsDomains {
+		c.skip[domain] = true
+	}
+	return c
+}
+
+func (c *channelDomainCache) get(host string, now time.Time) (uuid.UUID, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[host]
+	if !ok || now.After(entry.expires) {
+		return uuid.Nil, false
+	}
+	return entry.channelID, true
+}
+
+func (c *channelDomainCache) put(host string, channelID uuid.UUID, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= channelDomainCacheMax {
+		c.entries = map[string]channelDomainEntry{}
+	}
+	c.entries[host] = channelDomainEntry{channelID: channelID, expires: now.Add(channelDomainCacheTTL)}
+}
+
+func (c *channelDomainCache) invalidate(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, host)
+}
+
+// requestHost is the request's Host without its port, lowercased.
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// channelForHost returns the channel whose active custom domain is host,
+// or uuid.Nil if there's none.
+func (cfg *apiConfig) channelForHost(ctx context.Context, host string) (uuid.UUID, error) {
+	if host == "" || cfg.channelDomains.skip[host] || net.ParseIP(host) != nil {
+		return uuid.Nil, nil
+	}
+	now := time.Now()
+	if channelID, ok := cfg.channelDomains.get(host, now); ok {
+		return channelID, nil
+	}
+	d, err := cfg.db.GetChannelDomainByName(ctx, host)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	channelID := uuid.Nil
+	if d != nil && d.Status == database.ChannelDomainActive {
+		channelID = d.ChannelID
+	}
+	cfg.channelDomains.put(host, channelID, now)
+	return channelID, nil
+}
+
+// channelDomainMiddleware serves a channel's public pages on its custom
+// domain: the channel page at /, its feeds at /feed.rss and /podcast.rss,
+// and embeds and oEmbed for its videos. Nothing else is served there, so the API and the
+// app are only reachable on the server's own domain.
+func (cfg *apiConfig) channelDomainMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := requestHost(r)
+		channelID, err := cfg.channelForHost(r.Context(), host)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't look up channel domain", "host", host, "error", err)
+			http.Error(w, "Couldn't look up domain", http.StatusInternalServerError)
+			return
+		}
+		if channelID == uuid.Nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), channelHostKey{}, channelHost{ChannelID: channelID, Domain: host})
+		r = r.WithContext(ctx)
+		path := r.URL.Path
+		switch {
+		case path == "/":
+			path = apiVersionPrefix + "/channels/" + channelID.String() + "/page"
+		case path == "/feed.rss":
+			path = apiVersionPrefix + "/channels/" + channelID.String() + "/feed.rss"
+		case path == "/podcast.rss":
+			path = apiVersionPrefix + "/channels/" + channelID.String() + "/podcast.rss"
+		case strings.HasPrefix(path, "/embed/"), path == "/oembed":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		u := *r.URL
+		u.Path, u.RawPath = path, ""
+		r.URL = &u
+		next.ServeHTTP(w, r)
+	})
+}
+
+// publicBaseURL is the base URL for links in public pages: the channel
+// domain the request came in on, or the server's own.
+func (cfg *apiConfig) publicBaseURL(r *http.Request) string {
+	if host, ok := channelHostFromContext(r.Context()); ok {
+		return "https://" + host.Domain
+	}
+	return cfg.baseURL
+}
+
+// onOtherChannelHost reports whether the request came in on a channel
+// domain that video doesn't belong to.
+func onOtherChannelHost(ctx context.Context, video database.Video) bool {
+	host, ok := channelHostFromContext(ctx)
+	return ok && (video.ChannelID == nil || *video.ChannelID != host.ChannelID)
+}
+
+// validChannelDomain reports whether domain is a host name a channel could
+// be served on: one that isn't the server's own.
+func (cfg *apiConfig) validChannelDomain(domain string) bool {
+	return validHostname(domain) && !cfg.channelDomains.skip[domain]
+}
+
+// validHostname reports whether name is a lower-case DNS name with at least
+// two labels.
+func validHostname(name string) bool {
+	if len(name) > 253 || !strings.Contains(name, ".") || net.ParseIP(name) != nil {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// channelDomainVerificationRecord is the name of the TXT record that holds a
+// domain's verification token.
+func channelDomainVerificationRecord(domain string) string {
+	return "_tubely-verification." + domain
+}
+
+// lookupChannelDomainToken reports whether any TXT record at record holds
+// token.
+func lookupChannelDomainToken(ctx context.Context, record, token string) bool {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	values, err := net.DefaultResolver.LookupTXT(ctx, record)
+	if err != nil {
+		slog.InfoContext(ctx, "Couldn't look up channel domain verification record", "record", record, "error", err)
+		return false
+	}
+	return slices.Contains(values, token)
+}
+
+// issueChannelDomainCert gets a certificate for a newly added domain and
+// records whether it worked. The domain is only served once it has one.
+func (cfg *apiConfig) issueChannelDomainCert(ctx context.Context, domain string) {
+	ctx, cancel := context.WithTimeout(ctx, channelDomainIssueTimeout)
+	defer cancel()
+
+	status, errMsg := database.ChannelDomainActive, ""
+	if err := cfg.certs.ensureDomain(ctx, domain); err != nil {
+		slog.WarnContext(ctx, "Couldn't get certificate for channel domain", "domain", domain, "error", err)
+		status, errMsg = database.ChannelDomainFailed, err.Error()
+	}
+	// The domain may have been removed or replaced while the certificate
+	// was being issued.
+	d, err := cfg.db.GetChannelDomainByName(ctx, domain)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get channel domain", "domain", domain, "error", err)
+		return
+	}
+	if d == nil {
+		cfg.certs.forgetDomain(domain)
+		return
+	}
+	if err := cfg.db.SetChannelDomainStatus(ctx, domain, status, errMsg); err != nil {
+		slog.ErrorContext(ctx, "Couldn't record channel domain status", "domain", domain, "error", err)
+	}
+	cfg.channelDomains.invalidate(domain)
+}
+
+// runChannelDomainCerts keeps certificates for channel domains in step with
+// the database every interval: loading ones other instances issued,
+// renewing those close to expiry, retrying failed domains, and dropping
+// removed ones. It returns when ctx is cancelled.
+func (cfg *apiConfig) runChannelDomainCerts(ctx context.Context, interval time.Duration) {
+	cfg.syncChannelDomainCerts(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cfg.syncChannelDomainCerts(ctx)
+	}
+}
+
+func (cfg *apiConfig) syncChannelDomainCerts(ctx context.Context) {
+	domains, err := cfg.db.ListChannelDomains(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't list channel domains", "error", err)
+		return
+	}
+
+	current := map[string]bool{}
+	for _, d := range domains {
+		current[d.Domain] = true
+		// Certificates are only requested for domains the channel has
+		// proved it controls.
+		if d.DNSVerifiedAt == nil {
+			continue
+		}
+		// A domain just added is being issued by the instance that took
+		// the request.
+		if d.Status == database.ChannelDomainPending && time.Since(d.UpdatedAt) < channelDomainIssueTimeout {
+			continue
+		}
+		if d.Status == database.ChannelDomainFailed && time.Since(d.UpdatedAt) < channelDomainRetryInterval {
+			continue
+		}
+		certCtx, cancel := context.WithTimeout(ctx, channelDomainIssueTimeout)
+		err := cfg.certs.ensureDomain(certCtx, d.Domain)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		status, errMsg := database.ChannelDomainActive, ""
+		if err != nil {
+			slog.WarnContext(ctx, "Couldn't get certificate for channel domain", "domain", d.Domain, "error", err)
+			// A renewal failing doesn't stop the current certificate being
+			// served until it expires.
+			if cfg.certs.hasDomain(d.Domain) {
+				continue
+			}
+			status, errMsg = database.ChannelDomainFailed, err.Error()
+		}
+		// Failures are always recorded, so the retry interval counts from
+		// the latest one.
+		if status == database.ChannelDomainActive && d.Status == status {
+			continue
+		}
+		if err := cfg.db.SetChannelDomainStatus(ctx, d.Domain, status, errMsg); err != nil {
+			slog.ErrorContext(ctx, "Couldn't record channel domain status", "domain", d.Domain, "error", err)
+		}
+		cfg.channelDomains.invalidate(d.Domain)
+	}
+
+	for _, domain := range cfg.certs.customDomains() {
+		if !current[domain] {
+			cfg.certs.forgetDomain(domain)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const jobTypeSuggestChapters = "suggest_chapters"
+
+// chapterSuggestionConfig selects the model that splits transcripts into
+// chapters. Suggestions are off when provider is empty.
+type chapterSuggestionConfig struct {
+	// provider is "http" to post transcripts to url, or "command" to pipe
+	// them to a local model.
+	provider string
+	url      string
+	token    string
+	command  string
+}
+
+// chapterSuggestionRequest is what both suggesters are sent, e.g.
+// {"title": "...", "duration_seconds": 600, "cues": [{"start_seconds": 0,
+// "end_seconds": 2.5, "text": "..."}]}.
+type chapterSuggestionRequest struct {
+	Title           string                   `json:"title"`
+	DurationSeconds *float64                 `json:"duration_seconds,omitempty"`
+	Cues            []database.TranscriptCue `json:"cues"`
+}
+
+// chapterSuggestionResponse is what both suggesters return, e.g.
+// {"chapters": [{"start_seconds": 0, "title": "Intro"}]}.
+type chapterSuggestionResponse struct {
+	Chapters []database.Chapter `json:"chapters"`
+}
+
+// chapterSuggester segments a transcript into topical chapters and titles
+// them.
+type chapterSuggester interface {
+	Suggest(ctx context.Context, req chapterSuggestionRequest) ([]database.Chapter, error)
+}
+
+// httpChapterSuggester posts transcripts to an LLM service.
+type httpChapterSuggester struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (s httpChapterSuggester) Suggest(ctx context.Context, body chapterSuggestionRequest) ([]database.Chapter, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("chapter suggester returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	var result chapterSuggestionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("couldn't decode chapter suggester response: %w", err)
+	}
+	return result.Chapters, nil
+}
+
+// commandChapterSuggester runs a local model, writing the request to its
+// stdin and reading the chapters from its stdout.
+type commandChapterSuggester struct {
+	path string
+}
+
+func (s commandChapterSuggester) Suggest(ctx context.Context, req chapterSuggestionRequest) ([]database.Chapter, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, s.path)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := runCommand(cmd); err != nil {
+		return nil, err
+	}
+	var result chapterSuggestionResponse
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("couldn't decode chapter suggester output: %w", err)
+	}
+	return result.Chapters, nil
+}
+
+// newChapterSuggester returns nil when suggestions are off.
+func newChapterSuggester(conf chapterSuggestionConfig) chapterSuggester {
+	switch conf.provider {
+	case "http":
+		return httpChapterSuggester{url: conf.url, token: conf.token, client: &http.Client{Timeout: 5 * time.Minute}}
+	case "command":
+		return commandChapterSuggester{path: conf.command}
+	}
+	return nil
+}
+
+// queueChapterSuggestions queues a job to suggest chapters for a video from
+// its transcript.
+func (cfg *apiConfig) queueChapterSuggestions(ctx context.Context, video database.Video) error {
+	_, err := cfg.db.CreateJob(ctx, database.CreateJobParams{
+		Type:        jobTypeSuggestChapters,
+		VideoID:     &video.ID,
+		Payload:     struct{}{},
+		MaxAttempts: cfg.jobMaxAttempts,
+	})
+	return err
+}
+
+// runSuggestChaptersJob asks the suggester for chapters from a video's
+// transcript and stores them for the owner to review. They aren't shown
+// to viewers until the owner publishes them.
+func (cfg *apiConfig) runSuggestChaptersJob(ctx context.Context, job database.Job) error {
+	if job.VideoID == nil {
+		return errors.New("job has no video")
+	}
+	if cfg.chapterSuggester == nil {
+		return errors.New("chapter suggestions are off")
+	}
+	video, err := cfg.db.GetVideo(ctx, *job.VideoID)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil {
+		return nil
+	}
+	cues, err := cfg.db.GetTranscript(ctx, video.ID)
+	if err != nil {
+		return err
+	}
+	if len(cues) == 0 {
+		return nil
+	}
+
+	suggested, err := cfg.chapterSuggester.Suggest(ctx, chapterSuggestionRequest{
+		Title:           video.Title,
+		DurationSeconds: video.DurationSeconds,
+		Cues:            cues,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't suggest chapters: %w", err)
+	}
+	chapters, msg := normalizeChapters(suggested, video.DurationSeconds)
+	if msg != "" {
+		return fmt.Errorf("suggested chapters are invalid: %s", msg)
+	}
+	return cfg.db.SetChapterSuggestions(ctx, video.ID, chapters)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+	"github.com/google/uuid"
+)
+
+// clamdChunkSize is how much of a file is sent to clamd per INSTREAM chunk.
+const clamdChunkSize = 64 << 10
+
+// clamdScanner scans files with a clamd daemon over its INSTREAM command.
+type clamdScanner struct {
+	network string
+	addr    string
+	timeout time.Duration
+}
+
+// newClamdScanner returns a scanner for address, either host:port or
+// unix:/path/to/clamd.sock, or nil if address is empty.
+func newClamdScanner(address string, timeout time.Duration) *clamdScanner {
+	if address == "" {
+		return nil
+	}
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return &clamdScanner{network: "unix", addr: path, timeout: timeout}
+	}
+	return &clamdScanner{network: "tcp", addr: strings.TrimPrefix(address, "tcp://"), timeout: timeout}
+}
+
+// Scan streams r to clamd. It returns the name of the signature found, or
+// "" if the file is clean.
+func (s *clamdScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	ctx, span := tracing.Start(ctx, "clamd scan", tracing.KindClient)
+	defer span.End()
+	signature, err := s.scan(ctx, r)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return signature, err
+}
+
+func (s *clamdScanner) scan(ctx context.Context, r io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return "", fmt.Errorf("couldn't send file to clamd: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("couldn't read clamd reply: %w", err)
+	}
+	reply = strings.TrimRight(reply, "\x00\n")
+	// Replies look like "stream: OK", "stream: Eicar-Signature FOUND", or
+	// "INSTREAM size limit exceeded. ERROR".
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	}
+	return "", fmt.Errorf("clamd: %s", reply)
+}
+
+// scanUpload virus scans an uploaded file for a video, if scanning is on,
+// and records the result on the video. It writes an error response and
+// returns false if the file is infected or couldn't be scanned.
+func (cfg *apiConfig) scanUpload(w http.ResponseWriter, r *http.Request, videoID uuid.UUID, file io.Reader) bool {
+	if cfg.virusScanner == nil {
+		return true
+	}
+	signature, err := cfg.virusScanner.Scan(r.Context(), file)
+	if err != nil {
+		respondWithError(w, http.StatusServiceUnavailable, "Couldn't scan file for viruses", err)
+		return false
+	}
+
+	if err := cfg.recordVirusScan(r.Context(), videoID, signature); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record virus scan", err)
+		return false
+	}
+	if signature != "" {
+		slog.WarnContext(r.Context(), "Rejected infected upload", "video_id", videoID, "signature", signature)
+		respondWithErrorCode(w, http.StatusUnprocessableEntity, errCodeInfectedFile, "File is infected", nil, map[string]any{"signature": signature})
+		return false
+	}
+	return true
+}
+
+// recordVirusScan records the result of a scan on the video: infected with
+// signature, or clean if signature is empty.
+func (cfg *apiConfig) recordVirusScan(ctx context.Context, videoID uuid.UUID, signature string) error {
+	scan := database.VirusScan{Status: database.VirusScanClean, ScannedAt: time.Now().UTC()}
+	if signature != "" {
+		scan.Status = database.VirusScanInfected
+		scan.Signature = signature
+	}
+	return cfg.db.SetVideoVirusScan(ctx, videoID, scan)
+}
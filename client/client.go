@@ -0,0 +1,326 @@
+// Package client is a Go client for the Tubely API.
+//
+//	c := client.New("https://tubely.example.com", client.Credentials{})
+//	if err := c.Login(ctx, "me@example.com", password); err != nil {
+//		return err
+//	}
+//	video, err := c.CreateVideo(ctx, client.CreateVideoParams{Title: "Boot camp"})
+//	if err != nil {
+//		return err
+//	}
+//	video, err = c.UploadVideo(ctx, video.ID, "bootcamp.mp4", f)
+//
+// Requests are made to the /api/v1 paths. An access token that has expired
+// is refreshed with the refresh token, when there is one.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials authenticate requests. AccessToken is a JWT from logging in;
+// RefreshToken is used to get a new one when it expires.
+type Credentials struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Client calls the API. It's safe for concurrent use.
+type Client struct {
+	baseURL   string
+	http      *http.Client
+	onRefresh func(Credentials)
+
+	mu    sync.Mutex
+	creds Credentials
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with. Uploads can
+// run for a long time, so its Timeout should allow for them.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithRefreshHook calls fn with the new credentials whenever the client
+// logs in or refreshes its access token, so they can be saved.
+func WithRefreshHook(fn func(Credentials)) Option {
+	return func(c *Client) { c.onRefresh = fn }
+}
+
+// New returns a client for the server at baseURL, such as
+// "https://tubely.example.com".
+func New(baseURL string, creds Credentials, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    http.DefaultClient,
+		creds:   creds,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Credentials returns the client's current credentials.
+func (c *Client) Credentials() Credentials {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.creds
+}
+
+func (c *Client) setCredentials(creds Credentials) {
+	c.mu.Lock()
+	c.creds = creds
+	c.mu.Unlock()
+	if c.onRefresh != nil {
+		c.onRefresh(creds)
+	}
+}
+
+// Error is an error response from the API.
+type Error struct {
+	StatusCode int
+	Message    string         `json:"error"`
+	Code       string         `json:"code"`
+	Details    map[string]any `json:"details"`
+	RequestID  string         `json:"request_id"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("tubely: %s (HTTP %d)", e.Message, e.StatusCode)
+	if e.RequestID != "" {
+		msg += ", request " + e.RequestID
+	}
+	return msg
+}
+
+// IsStatus reports whether err is an API error with the status code.
+func IsStatus(err error, status int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// Login exchanges an email and password for credentials, which the client
+// then uses.
+func (c *Client) Login(ctx context.Context, email, password string) error {
+	params := map[string]string{"email": email, "password": password}
+	var creds Credentials
+	if err := c.send(ctx, http.MethodPost, "/login", jsonBody(params), "", &creds); err != nil {
+		return err
+	}
+	c.setCredentials(creds)
+	return nil
+}
+
+// Logout revokes the refresh token.
+func (c *Client) Logout(ctx context.Context) error {
+	creds := c.Credentials()
+	req, err := c.newRequest(ctx, http.MethodPost, "/revoke", nil, "")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+creds.RefreshToken)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := decodeResponse(resp, nil); err != nil {
+		return err
+	}
+	c.setCredentials(Credentials{})
+	return nil
+}
+
+// refresh gets a new access token with the refresh token.
+func (c *Client) refresh(ctx context.Context) error {
+	creds := c.Credentials()
+	if creds.RefreshToken == "" {
+		return errors.New("tubely: access token expired and there's no refresh token")
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, "/refresh", nil, "")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+creds.RefreshToken)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := decodeResponse(resp, &out); err != nil {
+		return err
+	}
+	creds.AccessToken = out.Token
+	c.setCredentials(creds)
+	return nil
+}
+
+// tokenExpiring reports whether a JWT expires within the next minute. The
+// token isn't verified; the server does that.
+func tokenExpiring(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.ExpiresAt == 0 {
+		return false
+	}
+	return time.Until(time.Unix(claims.ExpiresAt, 0)) < time.Minute
+}
+
+// body is a request body. A body with bytes can be sent again after a
+// refresh; a streamed one can't.
+type body struct {
+	data   []byte
+	stream io.Reader
+}
+
+func jsonBody(v any) body {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return body{stream: errReader{err}}
+	}
+	return body{data: data}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func (c *Client) newRequest(ctx context.Context, method, path string, b *body, contentType string) (*http.Request, error) {
+	var r io.Reader
+	if b != nil {
+		r = b.stream
+		if b.data != nil {
+			r = bytes.NewReader(b.data)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api/v1"+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// send makes an unauthenticated request.
+func (c *Client) send(ctx context.Context, method, path string, b body, contentType string, out any) error {
+	if contentType == "" && b.data != nil {
+		contentType = "application/json"
+	}
+	req, err := c.newRequest(ctx, method, path, &b, contentType)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, out)
+}
+
+// do makes an authenticated request and decodes a JSON response into out,
+// if it's set. JSON bodies are retried once after refreshing a token the
+// server rejected.
+func (c *Client) do(ctx context.Context, method, path string, b *body, contentType string, out any) error {
+	resp, err := c.doResponse(ctx, method, path, b, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, out)
+}
+
+func (c *Client) doResponse(ctx context.Context, method, path string, b *body, contentType string) (*http.Response, error) {
+	if contentType == "" && b != nil && b.data != nil {
+		contentType = "application/json"
+	}
+	if tokenExpiring(c.Credentials().AccessToken) {
+		if err := c.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := c.newRequest(ctx, method, path, b, contentType)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.Credentials().AccessToken)
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		replayable := b == nil || b.stream == nil
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 || !replayable || c.Credentials().RefreshToken == "" {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if err := c.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func decodeResponse(resp *http.Response, out any) error {
+	if resp.StatusCode >= 400 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+			if apiErr.Message == "" {
+				apiErr.Message = http.StatusText(resp.StatusCode)
+			}
+		}
+		return apiErr
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// nextCursor reads the cursor of the next page from a Link header.
+func nextCursor(header http.Header) string {
+	for _, link := range header.Values("Link") {
+		for _, part := range strings.Split(link, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(part), ";")
+			if !ok || !strings.Contains(params, `rel="next"`) {
+				continue
+			}
+			u, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+			if err != nil {
+				continue
+			}
+			return u.Query().Get("after")
+		}
+	}
+	return ""
+}
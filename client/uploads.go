@@ -0,0 +1,218 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadVideo uploads a video's file in one request, streaming it from r.
+// The video is returned with status processing; the file is processed in
+// the background.
+func (c *Client) UploadVideo(ctx context.Context, id uuid.UUID, filename string, r io.Reader) (*Video, error) {
+	return c.uploadForm(ctx, "/video_upload/"+id.String(), "video", filename, "video/mp4", r)
+}
+
+// UploadThumbnail uploads an image as a video's thumbnail, streaming it
+// from r. contentType is the image's media type, such as "image/png".
+func (c *Client) UploadThumbnail(ctx context.Context, id uuid.UUID, filename, contentType string, r io.Reader) (*Video, error) {
+	return c.uploadForm(ctx, "/thumbnail_upload/"+id.String(), "thumbnail", filename, contentType, r)
+}
+
+// uploadForm sends r as a multipart form file without buffering it.
+func (c *Client) uploadForm(ctx context.Context, path, field, filename, contentType string, r io.Reader) (*Video, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, field, filepath.Base(filename)))
+		header.Set("Content-Type", contentType)
+		part, err := form.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	var video Video
+	err := c.do(ctx, http.MethodPost, path, &body{stream: pr}, form.FormDataContentType(), &video)
+	// Stop the writer if the request ended before reading everything.
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+// Upload is a resumable upload of a video's file. Every part but the last
+// is PartSize bytes.
+type Upload struct {
+	ID            uuid.UUID `json:"id"`
+	VideoID       uuid.UUID `json:"video_id"`
+	SizeBytes     int64     `json:"size_bytes"`
+	PartSize      int64     `json:"part_size"`
+	PartCount     int       `json:"part_count"`
+	ReceivedParts []int     `json:"received_parts"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// partRange is the offset and length of part n.
+func (u *Upload) partRange(n int) (int64, int64) {
+	offset := int64(n-1) * u.PartSize
+	return offset, min(u.PartSize, u.SizeBytes-offset)
+}
+
+// StartUpload starts a resumable upload of a size byte MP4 file.
+func (c *Client) StartUpload(ctx context.Context, videoID uuid.UUID, size int64) (*Upload, error) {
+	var upload Upload
+	b := jsonBody(map[string]any{"size_bytes": size, "content_type": "video/mp4"})
+	if err := c.do(ctx, http.MethodPost, "/videos/"+videoID.String()+"/uploads", &b, "", &upload); err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// GetUpload gets an upload and the parts it has received.
+func (c *Client) GetUpload(ctx context.Context, videoID, uploadID uuid.UUID) (*Upload, error) {
+	var upload Upload
+	if err := c.do(ctx, http.MethodGet, uploadPath(videoID, uploadID), nil, "", &upload); err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// UploadPart sends part n, numbered from 1.
+func (c *Client) UploadPart(ctx context.Context, videoID, uploadID uuid.UUID, n int, data []byte) error {
+	path := uploadPath(videoID, uploadID) + "/parts/" + strconv.Itoa(n)
+	return c.do(ctx, http.MethodPut, path, &body{data: data}, "application/octet-stream", nil)
+}
+
+// CompleteUpload assembles the parts and queues the file for processing.
+func (c *Client) CompleteUpload(ctx context.Context, videoID, uploadID uuid.UUID) (*Video, error) {
+	var video Video
+	if err := c.do(ctx, http.MethodPost, uploadPath(videoID, uploadID)+"/complete", nil, "", &video); err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+// AbortUpload abandons an upload and discards its parts.
+func (c *Client) AbortUpload(ctx context.Context, videoID, uploadID uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, uploadPath(videoID, uploadID), nil, "", nil)
+}
+
+func uploadPath(videoID, uploadID uuid.UUID) string {
+	return "/videos/" + videoID.String() + "/uploads/" + uploadID.String()
+}
+
+// ResumableOptions configures UploadVideoResumable.
+type ResumableOptions struct {
+	// UploadID resumes an earlier upload of the same file. If the server
+	// no longer has it, a new upload is started.
+	UploadID uuid.UUID
+	// OnStart is called with the upload before any parts are sent, so its
+	// ID can be saved to resume it later.
+	OnStart func(*Upload)
+	// OnProgress is called as parts are sent, with the bytes the server
+	// has and the size of the file.
+	OnProgress func(sent, total int64)
+	// PartAttempts is how many times a part is sent before giving up. It
+	// defaults to 3.
+	PartAttempts int
+}
+
+// UploadVideoResumable uploads a video's file in parts, sending only the
+// parts the server doesn't have. If it fails, calling it again with the
+// same UploadID carries on where it stopped.
+func (c *Client) UploadVideoResumable(ctx context.Context, videoID uuid.UUID, r io.ReaderAt, size int64, opts ResumableOptions) (*Video, error) {
+	var upload *Upload
+	if opts.UploadID != uuid.Nil {
+		var err error
+		upload, err = c.GetUpload(ctx, videoID, opts.UploadID)
+		if err != nil && !IsStatus(err, http.StatusNotFound) {
+			return nil, err
+		}
+		if upload != nil && upload.SizeBytes != size {
+			upload = nil
+		}
+	}
+	if upload == nil {
+		var err error
+		upload, err = c.StartUpload(ctx, videoID, size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.OnStart != nil {
+		opts.OnStart(upload)
+	}
+	attempts := opts.PartAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+
+	received := map[int]bool{}
+	var sent int64
+	for _, n := range upload.ReceivedParts {
+		received[n] = true
+		_, length := upload.partRange(n)
+		sent += length
+	}
+	progress := func() {
+		if opts.OnProgress != nil {
+			opts.OnProgress(sent, size)
+		}
+	}
+	progress()
+
+	for n := 1; n <= upload.PartCount; n++ {
+		if received[n] {
+			continue
+		}
+		offset, length := upload.partRange(n)
+		data := make([]byte, length)
+		if n, err := r.ReadAt(data, offset); n < len(data) {
+			return nil, err
+		}
+		if err := c.uploadPartWithRetry(ctx, upload, n, data, attempts); err != nil {
+			return nil, err
+		}
+		sent += length
+		progress()
+	}
+	return c.CompleteUpload(ctx, videoID, upload.ID)
+}
+
+// uploadPartWithRetry retries server errors and rate limits, backing off
+// between attempts.
+func (c *Client) uploadPartWithRetry(ctx context.Context, upload *Upload, n int, data []byte, attempts int) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = c.UploadPart(ctx, upload.VideoID, upload.ID, n, data)
+		var apiErr *Error
+		if err == nil || (errors.As(err, &apiErr) && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests) {
+			return err
+		}
+		if attempt == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * 2 * time.Second):
+		}
+	}
+	return err
+}
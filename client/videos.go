@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Visibility controls who can see a video.
+type Visibility string
+
+const (
+	VisibilityPublic   Visibility = "public"
+	VisibilityUnlisted Visibility = "unlisted"
+	VisibilityPrivate  Visibility = "private"
+)
+
+// Video is a video's metadata. Fields about the file are nil until it has
+// been processed.
+type Video struct {
+	ID           uuid.UUID   `json:"id"`
+	UserID       uuid.UUID   `json:"user_id"`
+	ChannelID    *uuid.UUID  `json:"channel_id"`
+	Slug         *string     `json:"slug"`
+	Title        string      `json:"title"`
+	Description  string      `json:"description"`
+	Visibility   Visibility  `json:"visibility"`
+	Tags         []string    `json:"tags,omitempty"`
+	Status       string      `json:"status"`
+	ThumbnailURL *string     `json:"thumbnail_url"`
+	VideoURL     *string     `json:"video_url"`
+	Renditions   []Rendition `json:"renditions,omitempty"`
+	Version      int         `json:"version"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	DeletedAt    *time.Time  `json:"deleted_at,omitempty"`
+
+	DurationSeconds *float64 `json:"duration_seconds"`
+	Width           *int     `json:"width"`
+	Height          *int     `json:"height"`
+	FrameRate       *float64 `json:"frame_rate"`
+	SizeBytes       *int64   `json:"size_bytes"`
+	// Projection is set for 360° videos, e.g. "equirectangular".
+	Projection *string `json:"projection"`
+	// HDR is "hdr10" or "hlg" for HDR videos.
+	HDR *string `json:"hdr"`
+}
+
+// Rendition is one of the encodings a video can be played in.
+type Rendition struct {
+	Quality   string `json:"quality"`
+	Codec     string `json:"codec"`
+	URL       string `json:"url"`
+	SizeBytes int64  `json:"size_bytes"`
+	Bitrate   int64  `json:"bitrate"`
+}
+
+type CreateVideoParams struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	ChannelID   *uuid.UUID `json:"channel_id,omitempty"`
+	Visibility  Visibility `json:"visibility,omitempty"`
+}
+
+// CreateVideo creates a draft for a video file to be uploaded to.
+func (c *Client) CreateVideo(ctx context.Context, params CreateVideoParams) (*Video, error) {
+	var video Video
+	b := jsonBody(params)
+	if err := c.do(ctx, http.MethodPost, "/videos", &b, "", &video); err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+// GetVideo gets a video by ID.
+func (c *Client) GetVideo(ctx context.Context, id uuid.UUID) (*Video, error) {
+	var video Video
+	if err := c.do(ctx, http.MethodGet, "/videos/"+id.String(), nil, "", &video); err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+// ListVideosParams selects a page of videos. After is the Next cursor of
+// the previous page.
+type ListVideosParams struct {
+	Limit     int
+	After     string
+	ChannelID *uuid.UUID
+}
+
+// VideoPage is a page of videos. Next is empty on the last page.
+type VideoPage struct {
+	Videos []Video
+	Next   string
+}
+
+// ListVideos lists the user's videos, newest first.
+func (c *Client) ListVideos(ctx context.Context, params ListVideosParams) (*VideoPage, error) {
+	query := url.Values{}
+	if params.Limit > 0 {
+		query.Set("limit", strconv.Itoa(params.Limit))
+	}
+	if params.After != "" {
+		query.Set("after", params.After)
+	}
+	if params.ChannelID != nil {
+		query.Set("channel", params.ChannelID.String())
+	}
+	resp, err := c.doResponse(ctx, http.MethodGet, "/videos?"+query.Encode(), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	page := &VideoPage{}
+	if err := decodeResponse(resp, &page.Videos); err != nil {
+		return nil, err
+	}
+	page.Next = nextCursor(resp.Header)
+	return page, nil
+}
+
+// UpdateVideoParams changes the fields that are set and leaves the rest.
+type UpdateVideoParams struct {
+	Title       *string     `json:"title,omitempty"`
+	Description *string     `json:"description,omitempty"`
+	Tags        *[]string   `json:"tags,omitempty"`
+	Visibility  *Visibility `json:"visibility,omitempty"`
+	Slug        *string     `json:"slug,omitempty"`
+}
+
+// UpdateVideo changes a video's metadata.
+func (c *Client) UpdateVideo(ctx context.Context, id uuid.UUID, params UpdateVideoParams) (*Video, error) {
+	var video Video
+	b := jsonBody(params)
+	if err := c.do(ctx, http.MethodPatch, "/videos/"+id.String(), &b, "", &video); err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+// DeleteVideo moves a video to the trash.
+func (c *Client) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, "/videos/"+id.String(), nil, "", nil)
+}
+
+// RestoreVideo takes a video out of the trash.
+func (c *Client) RestoreVideo(ctx context.Context, id uuid.UUID) (*Video, error) {
+	var video Video
+	if err := c.do(ctx, http.MethodPost, "/videos/"+id.String()+"/restore", nil, "", &video); err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
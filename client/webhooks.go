@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook event types.
+const (
+	EventVideoCreated           = "video.created"
+	EventVideoUploaded          = "video.uploaded"
+	EventVideoThumbnailUploaded = "video.thumbnail_uploaded"
+	EventVideoDeleted           = "video.deleted"
+	EventVideoRestored          = "video.restored"
+	EventSubscriptionUpload     = "subscription.new_upload"
+)
+
+// Webhook is a subscription to events, delivered to URL. Secret is only
+// returned when the webhook is created.
+type Webhook struct {
+	ID         uuid.UUID `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is one attempt to deliver an event.
+type WebhookDelivery struct {
+	ID             uuid.UUID `json:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	EventType      string    `json:"event_type"`
+	Payload        string    `json:"payload"`
+	Attempt        int       `json:"attempt"`
+	StatusCode     *int      `json:"status_code"`
+	Error          *string   `json:"error"`
+	Success        bool      `json:"success"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// CreateWebhookParams describes a webhook. An empty Secret has the server
+// generate one.
+type CreateWebhookParams struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret,omitempty"`
+}
+
+type UpdateWebhookParams struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+func (c *Client) CreateWebhook(ctx context.Context, params CreateWebhookParams) (*Webhook, error) {
+	var webhook Webhook
+	b := jsonBody(params)
+	if err := c.do(ctx, http.MethodPost, "/webhooks", &b, "", &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	var webhooks []Webhook
+	if err := c.do(ctx, http.MethodGet, "/webhooks", nil, "", &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (c *Client) GetWebhook(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.do(ctx, http.MethodGet, "/webhooks/"+id.String(), nil, "", &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (c *Client) UpdateWebhook(ctx context.Context, id uuid.UUID, params UpdateWebhookParams) (*Webhook, error) {
+	var webhook Webhook
+	b := jsonBody(params)
+	if err := c.do(ctx, http.MethodPut, "/webhooks/"+id.String(), &b, "", &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, "/webhooks/"+id.String(), nil, "", nil)
+}
+
+// ListWebhookDeliveries lists a webhook's recent deliveries, newest first.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, id uuid.UUID, limit, offset int) ([]WebhookDelivery, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	var deliveries []WebhookDelivery
+	path := "/webhooks/" + id.String() + "/deliveries?" + query.Encode()
+	if err := c.do(ctx, http.MethodGet, path, nil, "", &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// WebhookEvent is a delivery received from Tubely.
+type WebhookEvent struct {
+	Type       string
+	DeliveryID string
+	Payload    []byte
+}
+
+// ErrInvalidSignature is returned by VerifyWebhook for a delivery that
+// wasn't signed with the secret, or was sent too long ago.
+var ErrInvalidSignature = errors.New("tubely: invalid webhook signature")
+
+// VerifyWebhook reads a delivery from a webhook request and checks its
+// signature against the webhook's secret. Deliveries timestamped more than
+// tolerance ago are rejected, so they can't be replayed.
+func VerifyWebhook(r *http.Request, secret string, tolerance time.Duration) (*WebhookEvent, error) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := r.Header.Get("X-Tubely-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return nil, ErrInvalidSignature
+	}
+	signature, ok := strings.CutPrefix(r.Header.Get("X-Tubely-Signature"), "sha256=")
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
+	}
+	return &WebhookEvent{
+		Type:       r.Header.Get("X-Tubely-Event"),
+		DeliveryID: r.Header.Get("X-Tubely-Delivery"),
+		Payload:    payload,
+	}, nil
+}
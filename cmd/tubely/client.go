@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/client"
+)
+
+// credentials is what login saves, so later commands are authenticated.
+type credentials struct {
+	Server string `json:"server"`
+	client.Credentials
+}
+
+// configDir is where the CLI keeps its credentials and upload state.
+func configDir() (string, error) {
+	if dir := os.Getenv("TUBELY_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tubely"), nil
+}
+
+func credentialsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "credentials.json"), nil
+}
+
+func loadCredentials() (credentials, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return credentials{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return credentials{}, errors.New("not logged in, run tubely login first")
+	}
+	if err != nil {
+		return credentials{}, err
+	}
+	var creds credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return credentials{}, fmt.Errorf("couldn't read %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// saveCredentials writes the credentials readable only by the user.
+func saveCredentials(creds credentials) error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// newClient returns a client for the server at url that saves its
+// credentials, under server, whenever they change.
+func newClient(url, server string, creds client.Credentials) *client.Client {
+	return client.New(url, creds,
+		client.WithHTTPClient(&http.Client{Timeout: 10 * time.Minute}),
+		client.WithRefreshHook(func(creds client.Credentials) {
+			if err := saveCredentials(credentials{Server: server, Credentials: creds}); err != nil {
+				fmt.Fprintln(os.Stderr, "tubely: couldn't save credentials:", err)
+			}
+		}),
+	)
+}
+
+// loggedInClient returns a client with the saved credentials.
+// TUBELY_SERVER overrides the server they were saved for.
+func loggedInClient() (*client.Client, error) {
+	creds, err := loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	url := creds.Server
+	if env := os.Getenv("TUBELY_SERVER"); env != "" {
+		url = env
+	}
+	return newClient(url, creds.Server, creds.Credentials), nil
+}
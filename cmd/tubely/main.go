@@ -0,0 +1,377 @@
+// Command tubely is a command line client for a Tubely server, built on
+// the client package, so creators can script uploads and manage their
+// videos:
+//
+//	tubely login -server https://tubely.example.com -email me@example.com
+//	tubely upload -title "Boot camp" -visibility public bootcamp.mp4
+//	tubely set -description "Day one" <video id>
+//	tubely thumbnail <video id> cover.jpg
+//	tubely list
+//	tubely delete <video id>
+//
+// Credentials and unfinished uploads are kept in the user's config
+// directory, or TUBELY_CONFIG_DIR. TUBELY_SERVER overrides the server that
+// was logged in to.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/client"
+	"github.com/google/uuid"
+)
+
+// usages lists the commands in the order they're shown.
+var usages = []struct{ name, usage string }{
+	{"login", "login [-server url] [-email email]"},
+	{"logout", "logout"},
+	{"upload", "upload [-video id] [-title title] [-description text] [-visibility v] file.mp4"},
+	{"set", "set [-title title] [-description text] [-tags a,b] [-visibility v] [-slug slug] video-id"},
+	{"thumbnail", "thumbnail video-id image"},
+	{"list", "list [-limit n] [-json]"},
+	{"delete", "delete video-id..."},
+}
+
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"login":     runLogin,
+	"logout":    runLogout,
+	"upload":    runUpload,
+	"set":       runSet,
+	"thumbnail": runThumbnail,
+	"list":      runList,
+	"delete":    runDelete,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "tubely:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	for _, u := range usages {
+		fmt.Fprintln(os.Stderr, "  tubely", u.usage)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		for _, u := range usages {
+			if u.name == name {
+				fmt.Fprintln(os.Stderr, "Usage: tubely", u.usage)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// runLogin logs in with an email and password and saves the tokens. The
+// password is read from TUBELY_PASSWORD, or standard input.
+func runLogin(ctx context.Context, args []string) error {
+	fs := newFlagSet("login")
+	server := fs.String("server", os.Getenv("TUBELY_SERVER"), "server URL")
+	email := fs.String("email", "", "account email")
+	fs.Parse(args)
+
+	if *server == "" {
+		if creds, err := loadCredentials(); err == nil {
+			*server = creds.Server
+		}
+	}
+	if *server == "" {
+		return errors.New("-server is required")
+	}
+	in := bufio.NewReader(os.Stdin)
+	if *email == "" {
+		*email = prompt(in, "Email: ")
+	}
+	password := os.Getenv("TUBELY_PASSWORD")
+	if password == "" {
+		password = prompt(in, "Password: ")
+	}
+
+	// The client saves the credentials once it has them.
+	if err := newClient(*server, *server, client.Credentials{}).Login(ctx, *email, password); err != nil {
+		return err
+	}
+	fmt.Println("Logged in as", *email)
+	return nil
+}
+
+func prompt(in *bufio.Reader, label string) string {
+	fmt.Fprint(os.Stderr, label)
+	line, _ := in.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// runLogout revokes the refresh token and forgets the credentials.
+func runLogout(ctx context.Context, args []string) error {
+	newFlagSet("logout").Parse(args)
+	c, err := loggedInClient()
+	if err != nil {
+		return err
+	}
+	if err := c.Logout(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "tubely: couldn't revoke refresh token:", err)
+	}
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// runUpload uploads a file to a new draft, or replaces the file of an
+// existing video. An interrupted upload resumes when it's run again.
+func runUpload(ctx context.Context, args []string) error {
+	fs := newFlagSet("upload")
+	videoFlag := fs.String("video", "", "replace the file of this video instead of creating one")
+	title := fs.String("title", "", "title of the new video (default the file name)")
+	description := fs.String("description", "", "description of the new video")
+	visibility := fs.String("visibility", "", "visibility of the new video: private, unlisted or public")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	c, err := loggedInClient()
+	if err != nil {
+		return err
+	}
+
+	var videoID uuid.UUID
+	if *videoFlag != "" {
+		if videoID, err = parseVideoID(*videoFlag); err != nil {
+			return err
+		}
+	} else {
+		// Running the same upload again resumes it rather than creating
+		// another draft.
+		if videoID, err = savedUploadVideo(path); err != nil {
+			return err
+		}
+		if videoID != uuid.Nil {
+			fmt.Fprintln(os.Stderr, "Resuming upload to video", videoID)
+		}
+	}
+	if videoID == uuid.Nil {
+		if *title == "" {
+			*title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		draft, err := c.CreateVideo(ctx, client.CreateVideoParams{
+			Title:       *title,
+			Description: *description,
+			Visibility:  client.Visibility(*visibility),
+		})
+		if err != nil {
+			return err
+		}
+		videoID = draft.ID
+		fmt.Fprintln(os.Stderr, "Created video", draft.ID)
+	}
+
+	video, err := uploadVideo(ctx, c, videoID, path, os.Stderr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is %s\n", video.ID, video.Status)
+	return nil
+}
+
+// runSet changes the metadata given on the command line and leaves the
+// rest.
+func runSet(ctx context.Context, args []string) error {
+	fs := newFlagSet("set")
+	fs.String("title", "", "title")
+	fs.String("description", "", "description")
+	fs.String("tags", "", "comma-separated tags, replacing the current ones")
+	fs.String("visibility", "", "private, unlisted or public")
+	fs.String("slug", "", "URL slug")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	videoID, err := parseVideoID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var params client.UpdateVideoParams
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		set = true
+		switch f.Name {
+		case "title":
+			params.Title = &value
+		case "description":
+			params.Description = &value
+		case "slug":
+			params.Slug = &value
+		case "visibility":
+			visibility := client.Visibility(value)
+			params.Visibility = &visibility
+		case "tags":
+			tags := []string{}
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+			params.Tags = &tags
+		}
+	})
+	if !set {
+		return errors.New("nothing to set")
+	}
+	c, err := loggedInClient()
+	if err != nil {
+		return err
+	}
+	video, err := c.UpdateVideo(ctx, videoID, params)
+	if err != nil {
+		return err
+	}
+	return printJSON(video)
+}
+
+// runThumbnail uploads an image as a video's thumbnail.
+func runThumbnail(ctx context.Context, args []string) error {
+	fs := newFlagSet("thumbnail")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	videoID, err := parseVideoID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	path := fs.Arg(1)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ext := strings.ToLower(filepath.Ext(path))
+	mediaType := mime.TypeByExtension(ext)
+	// Go's built-in table doesn't know HEIC, and sniffing can't spot it.
+	if mediaType == "" && (ext == ".heic" || ext == ".heif") {
+		mediaType = "image/" + ext[1:]
+	}
+	if mediaType == "" {
+		head := make([]byte, 512)
+		n, _ := f.Read(head)
+		mediaType = http.DetectContentType(head[:n])
+		if _, err := f.Seek(0, 0); err != nil {
+			return err
+		}
+	}
+
+	c, err := loggedInClient()
+	if err != nil {
+		return err
+	}
+	video, err := c.UploadThumbnail(ctx, videoID, path, mediaType, f)
+	if err != nil {
+		return err
+	}
+	if video.ThumbnailURL != nil {
+		fmt.Println(*video.ThumbnailURL)
+	}
+	return nil
+}
+
+// runList lists the user's videos, newest first.
+func runList(ctx context.Context, args []string) error {
+	fs := newFlagSet("list")
+	limit := fs.Int("limit", 50, "how many videos to list")
+	asJSON := fs.Bool("json", false, "print the videos as JSON")
+	fs.Parse(args)
+	c, err := loggedInClient()
+	if err != nil {
+		return err
+	}
+	page, err := c.ListVideos(ctx, client.ListVideosParams{Limit: *limit})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(page.Videos)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tVISIBILITY\tCREATED\tTITLE")
+	for _, v := range page.Videos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", v.ID, v.Status, v.Visibility, v.CreatedAt.Local().Format("2006-01-02 15:04"), v.Title)
+	}
+	return tw.Flush()
+}
+
+// runDelete moves videos to the trash, where they can be restored for a
+// while.
+func runDelete(ctx context.Context, args []string) error {
+	fs := newFlagSet("delete")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	c, err := loggedInClient()
+	if err != nil {
+		return err
+	}
+	for _, arg := range fs.Args() {
+		videoID, err := parseVideoID(arg)
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteVideo(ctx, videoID); err != nil {
+			return fmt.Errorf("couldn't delete %s: %w", videoID, err)
+		}
+		fmt.Println("Deleted", videoID)
+	}
+	return nil
+}
+
+func parseVideoID(s string) (uuid.UUID, error) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%q isn't a video ID", s)
+	}
+	return id, nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/client"
+	"github.com/google/uuid"
+)
+
+// uploadState remembers unfinished uploads by file, so running the same
+// upload again picks up where it stopped.
+type uploadState map[string]savedUpload
+
+type savedUpload struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	UploadID uuid.UUID `json:"upload_id"`
+}
+
+func uploadStatePath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "uploads.json"), nil
+}
+
+func loadUploadState() (uploadState, error) {
+	path, err := uploadStatePath()
+	if err != nil {
+		return nil, err
+	}
+	state := uploadState{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %w", path, err)
+	}
+	return state, nil
+}
+
+func (s uploadState) save() error {
+	path, err := uploadStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// uploadStateKey identifies a file. A file that's changed since the upload
+// started is uploaded from scratch.
+func uploadStateKey(path string, info os.FileInfo) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s|%d|%d", abs, info.Size(), info.ModTime().UnixNano()), nil
+}
+
+// savedUploadVideo returns the video an unfinished upload of the file was
+// going to, if there is one.
+func savedUploadVideo(path string) (uuid.UUID, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	key, err := uploadStateKey(path, info)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	state, err := loadUploadState()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return state[key].VideoID, nil
+}
+
+// uploadVideo sends a file to a video with a resumable upload, printing
+// progress to w, and returns the video once it's queued for processing.
+func uploadVideo(ctx context.Context, c *client.Client, videoID uuid.UUID, path string, w io.Writer) (*client.Video, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	key, err := uploadStateKey(path, info)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadUploadState()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := client.ResumableOptions{
+		OnStart: func(upload *client.Upload) {
+			state[key] = savedUpload{VideoID: videoID, UploadID: upload.ID}
+			if err := state.save(); err != nil {
+				fmt.Fprintln(os.Stderr, "tubely: couldn't save upload state:", err)
+			}
+		},
+		OnProgress: func(sent, total int64) {
+			percent := 100
+			if total > 0 {
+				percent = int(sent * 100 / total)
+			}
+			fmt.Fprintf(w, "\rUploading %s: %3d%% (%s of %s)", filepath.Base(path), percent, formatBytes(sent), formatBytes(total))
+		},
+	}
+	if saved := state[key]; saved.VideoID == videoID {
+		opts.UploadID = saved.UploadID
+	}
+	video, err := c.UploadVideoResumable(ctx, videoID, f, info.Size(), opts)
+	fmt.Fprintln(w)
+	if err != nil {
+		return nil, fmt.Errorf("upload stopped, run the command again to resume: %w", err)
+	}
+	delete(state, key)
+	return video, state.save()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressMinSize is the smallest response worth compressing when its
+// length is known up front.
+const compressMinSize = 1024
+
+// compressibleTypes are the text formats served by the API: JSON, HLS and
+// DASH manifests, and captions. Video, images, and other formats that are
+// already compressed are passed through.
+var compressibleTypes = map[string]bool{
+	"application/json":              true,
+	"application/problem+json":      true,
+	"application/vnd.apple.mpegurl": true,
+	"application/x-mpegurl":         true,
+	"audio/mpegurl":                 true,
+	"application/dash+xml":          true,
+	"application/xml":               true,
+	"application/rss+xml":           true,
+	"application/javascript":        true,
+	"text/vtt":                      true,
+	"text/plain":                    true,
+	"text/html":                     true,
+	"text/css":                      true,
+	"text/xml":                      true,
+}
+
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+// compressMiddleware gzips text responses for clients that accept it.
+//
+// ETags are left as they are rather than weakened, so that clients can keep
+// sending them back in If-Match.
+func compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.TrimSpace(coding)
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter decides whether to compress when the handler writes its
+// header, since that's when the content type and length are known.
+type compressWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.wroteHeader {
+		c.ResponseWriter.WriteHeader(code)
+		return
+	}
+	c.wroteHeader = true
+
+	h := c.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if !compressibleTypes[strings.ToLower(mediaType)] {
+		c.ResponseWriter.WriteHeader(code)
+		return
+	}
+	h.Add("Vary", "Accept-Encoding")
+
+	skip := code < http.StatusOK ||
+		code == http.StatusNoContent ||
+		code == http.StatusNotModified ||
+		code == http.StatusPartialContent ||
+		h.Get("Content-Encoding") != "" ||
+		h.Get("Content-Range") != ""
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < compressMinSize {
+		skip = true
+	}
+	if !skip {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		c.gz = gzipWriters.Get().(*gzip.Writer)
+		c.gz.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.gz != nil {
+		return c.gz.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Flush sends what's been compressed so far, for streamed responses.
+func (c *compressWriter) Flush() {
+	if c.gz != nil {
+		c.gz.Flush()
+	}
+	http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *compressWriter) close() {
+	if c.gz == nil {
+		return
+	}
+	c.gz.Close()
+	c.gz.Reset(io.Discard)
+	gzipWriters.Put(c.gz)
+	c.gz = nil
+}
@@ -0,0 +1,890 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/acme"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// defaultConfigFile is loaded when CONFIG_FILE isn't set and it exists.
+const defaultConfigFile = "tubely.toml"
+
+// serverConfig is every setting the server reads at startup.
+type serverConfig struct {
+	dsn                      string
+	replicaDSN               string
+	pool                     database.PoolConfig
+	queryTimeout             time.Duration
+	jwtSecret                string
+	platform                 string
+	filepathRoot             string
+	assetsRoot               string
+	uploadsRoot              string
+	s3Bucket                 string
+	s3Region                 string
+	s3CfDistribution         string
+	port                     string
+	baseURL                  string
+	adminEmails              map[string]bool
+	trashRetention           time.Duration
+	backupInterval           time.Duration
+	backupRetention          int
+	backupKey                []byte
+	storageReconcileInterval time.Duration
+	storageAutoRepair        bool
+	drainTimeout             time.Duration
+	requestTimeout           time.Duration
+	uploadMinThroughput      int64
+	uploadTimeout            time.Duration
+	legacyAPISunset          time.Time
+	rateLimit                int
+	rateLimitWindow          time.Duration
+	metricsToken             string
+	logFormat                string
+	logLevel                 string
+	otlpEndpoint             string
+	serviceName              string
+	ffmpegPath               string
+	ffprobePath              string
+	qualityMetrics           []string
+	maxVideoUploadBytes      int64
+	maxThumbnailUploadBytes  int64
+	heicThumbnailFormat      string
+	containerProfiles        []string
+	defaultContainerProfile  string
+	jobMaxAttempts           int
+	backfillMaxQueued        int
+	quotas                   quotaLimits
+	quotaWarningPercent      int
+	mailProvider             string
+	mailFrom                 string
+	smtpAddr                 string
+	smtpUsername             string
+	smtpPassword             string
+	sesRegion                string
+	maxUploads               int
+	maxUploadBytes           int64
+	uploadQueueTimeout       time.Duration
+	uploadBandwidth          int64
+	uploadConnBandwidth      int64
+	circuitThreshold         int
+	circuitCooldown          time.Duration
+	moderation               moderationConfig
+	verticalCrop             verticalCropConfig
+	chapterSuggestion        chapterSuggestionConfig
+	clamdAddress             string
+	clamdTimeout             time.Duration
+	quarantineBucket         string
+	quarantinePrefix         string
+	stagingBucket            string
+	stagingPrefix            string
+	objectLockMode           string
+	playbackTokenSecret      string
+	playbackTokenTTL         time.Duration
+	hlsEncryption            bool
+	preserveHDR              bool
+	normalizeFrameRate       bool
+	geo                      geoConfig
+	deliveryLogs             deliveryLogConfig
+	beacon                   beaconConfig
+	analyticsHourlyRetention time.Duration
+	live                     liveConfig
+	grpcAddress              string
+	featureFlags             map[string]bool
+	errorReporter            errorReporter
+	cors                     corsPolicy
+	tlsDomains               []string
+	acmeEmail                string
+	acmeDirectoryURL         string
+	acmeCache                string
+	acmeS3Bucket             string
+	httpPort                 string
+	http2                    bool
+	http3                    bool
+}
+
+// Settings are read from the environment, falling back to a config file.
+// The file is a small subset of TOML: key = value pairs, optionally under
+// [section] headers, with string, number, boolean, and string array values.
+// Each key names an environment variable, prefixed with its section:
+//
+//	port = 8091
+//
+//	[s3]
+//	bucket = "tubely-123456789"
+//	cf_distro = "https://d111111abcdef8.cloudfront.net"
+//
+// sets PORT, S3_BUCKET, and S3_CF_DISTRO. Variables already set in the
+// environment or .env take precedence, so the file can hold the defaults
+// for a deployment and the environment the overrides.
+
+// configFilePath returns the config file to load, or "" if there isn't one.
+func configFilePath() string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	if _, err := os.Stat(defaultConfigFile); err == nil {
+		return defaultConfigFile
+	}
+	return ""
+}
+
+// applyConfigFile sets the environment variables named in the config file
+// that aren't already set, and returns every name the file contained.
+func applyConfigFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseConfigFile(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	names := make([]string, 0, len(values))
+	for name, value := range values {
+		names = append(names, name)
+		if _, ok := os.LookupEnv(name); !ok {
+			os.Setenv(name, value)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func parseConfigFile(data string) (map[string]string, error) {
+	values := map[string]string{}
+	section := ""
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(stripConfigComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section header", i+1)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		key = strings.TrimSpace(key)
+		if section != "" {
+			key = section + "_" + key
+		}
+		value, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		name := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+		if _, dup := values[name]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", i+1, name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// stripConfigComment drops a # comment that isn't inside a quoted string.
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigValue converts a value to the form its environment variable
+// takes. Arrays become comma-separated lists; bare values such as numbers,
+// booleans, and durations are used as written.
+func parseConfigValue(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", errors.New("missing value")
+	case strings.HasPrefix(raw, `"`):
+		return strconv.Unquote(raw)
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", errors.New("unterminated string")
+		}
+		return raw[1 : len(raw)-1], nil
+	case strings.HasPrefix(raw, "["):
+		if !strings.HasSuffix(raw, "]") {
+			return "", errors.New("unterminated array")
+		}
+		inner := strings.TrimSpace(raw[1 : len(raw)-1])
+		if inner == "" {
+			return "", nil
+		}
+		var items []string
+		for _, item := range strings.Split(inner, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			v, err := parseConfigValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, v)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return raw, nil
+}
+
+// configSource reads settings from the environment, collecting every
+// problem instead of stopping at the first, and remembering which names it
+// looked up so unknown names in the config file can be reported.
+type configSource struct {
+	known map[string]bool
+	errs  []error
+}
+
+func (s *configSource) get(name string) string {
+	s.known[name] = true
+	return os.Getenv(name)
+}
+
+func (s *configSource) fail(format string, args ...any) {
+	s.errs = append(s.errs, fmt.Errorf(format, args...))
+}
+
+func (s *configSource) required(name string) string {
+	v := s.get(name)
+	if v == "" {
+		s.fail("%s is not set", name)
+	}
+	return v
+}
+
+func (s *configSource) stringOr(name, fallback string) string {
+	if v := s.get(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// listOr splits a comma-separated setting, dropping empty entries.
+func (s *configSource) listOr(name string, fallback []string) []string {
+	v := s.get(name)
+	if v == "" {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (s *configSource) boolOr(name string, fallback bool) bool {
+	v := s.get(name)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		s.fail("%s must be true or false", name)
+		return fallback
+	}
+	return b
+}
+
+func (s *configSource) intOr(name string, fallback int) int {
+	v := s.get(name)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		s.fail("%s must be a non-negative integer", name)
+		return fallback
+	}
+	return n
+}
+
+func (s *configSource) int64Or(name string, fallback int64) int64 {
+	v := s.get(name)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		s.fail("%s must be a non-negative integer", name)
+		return fallback
+	}
+	return n
+}
+
+func (s *configSource) floatOr(name string, fallback float64) float64 {
+	v := s.get(name)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		s.fail("%s must be a non-negative number", name)
+		return fallback
+	}
+	return f
+}
+
+func (s *configSource) durationOr(name string, fallback time.Duration) time.Duration {
+	v := s.get(name)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		s.fail("%s must be a non-negative duration", name)
+		return fallback
+	}
+	return d
+}
+
+// loadConfig reads and validates the server's settings. fileNames are the
+// names set by the config file; any the server doesn't use are reported,
+// since they're most likely typos. The error lists every problem found.
+func loadConfig(fileNames []string) (serverConfig, error) {
+	src := &configSource{known: map[string]bool{}}
+	conf := serverConfig{}
+
+	// DB_URL takes a postgres:// URL; DB_PATH is a SQLite file path.
+	conf.dsn = src.get("DB_URL")
+	dbPath := src.get("DB_PATH")
+	if conf.dsn == "" {
+		conf.dsn = dbPath
+	}
+	if conf.dsn == "" {
+		src.fail("DB_URL or DB_PATH must be set")
+	}
+	conf.replicaDSN = src.get("DB_REPLICA_URL")
+	conf.pool = loadPoolConfig(src)
+	conf.queryTimeout = src.durationOr("DB_QUERY_TIMEOUT", 5*time.Second)
+
+	conf.jwtSecret = src.required("JWT_SECRET")
+	conf.platform = src.required("PLATFORM")
+	// The frontend is built into the binary; FILEPATH_ROOT serves it from
+	// disk instead, for working on it without rebuilding.
+	conf.filepathRoot = src.get("FILEPATH_ROOT")
+	conf.assetsRoot = src.required("ASSETS_ROOT")
+	// Uploads are spooled here until their processing job finishes, so this
+	// should survive restarts.
+	conf.uploadsRoot = src.stringOr("UPLOADS_ROOT", "./uploads")
+
+	conf.s3Bucket = src.required("S3_BUCKET")
+	conf.s3Region = src.required("S3_REGION")
+	conf.s3CfDistribution = src.required("S3_CF_DISTRO")
+
+	conf.port = src.required("PORT")
+
+	// Setting TLS_DOMAINS serves HTTPS on PORT with certificates from
+	// ACME_DIRECTORY_URL, and answers challenges and redirects on HTTP_PORT.
+	// ACME_CACHE is a directory, or "s3" to share certificates through
+	// ACME_S3_BUCKET. That has to be a private bucket: the cache holds the
+	// certificates' private keys, so it can't be S3_BUCKET, which the CDN
+	// serves.
+	conf.tlsDomains = src.listOr("TLS_DOMAINS", nil)
+	for i, domain := range conf.tlsDomains {
+		conf.tlsDomains[i] = strings.ToLower(domain)
+	}
+	conf.acmeEmail = src.get("ACME_EMAIL")
+	conf.acmeDirectoryURL = src.stringOr("ACME_DIRECTORY_URL", acme.LetsEncryptURL)
+	conf.acmeCache = src.stringOr("ACME_CACHE", "./certs")
+	if conf.acmeCache == "s3" && len(conf.tlsDomains) > 0 {
+		conf.acmeS3Bucket = src.required("ACME_S3_BUCKET")
+		if conf.acmeS3Bucket == conf.s3Bucket {
+			src.fail("ACME_S3_BUCKET must be a private bucket, not S3_BUCKET")
+		}
+	}
+	conf.httpPort = src.stringOr("HTTP_PORT", "80")
+	// HTTP/2 is negotiated over TLS; HTTP2=false forces HTTP/1.1, e.g. to
+	// rule it out when debugging a client.
+	conf.http2 = src.boolOr("HTTP2", true)
+	// HTTP/3 is experimental: it needs UDP on PORT to be reachable, and
+	// is only offered to clients through the Alt-Svc header.
+	conf.http3 = src.boolOr("HTTP3", false)
+
+	conf.baseURL = strings.TrimSuffix(src.get("BASE_URL"), "/")
+	switch {
+	case conf.baseURL != "":
+	case len(conf.tlsDomains) > 0 && conf.port == "443":
+		conf.baseURL = "https://" + conf.tlsDomains[0]
+	case len(conf.tlsDomains) > 0:
+		conf.baseURL = "https://" + conf.tlsDomains[0] + ":" + conf.port
+	default:
+		conf.baseURL = "http://localhost:" + conf.port
+	}
+
+	conf.adminEmails = map[string]bool{}
+	for _, email := range strings.Split(src.get("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			conf.adminEmails[email] = true
+		}
+	}
+
+	conf.trashRetention = time.Duration(src.intOr("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+
+	// Backups run daily by default; BACKUP_INTERVAL=0 turns them off.
+	// They're kept in the CDN-served bucket, so they need
+	// BACKUP_ENCRYPTION_KEY while they're on.
+	conf.backupInterval = src.durationOr("BACKUP_INTERVAL", 24*time.Hour)
+	conf.backupRetention = src.intOr("BACKUP_RETENTION", 7)
+	key, err := parseBackupKey(src.get("BACKUP_ENCRYPTION_KEY"))
+	if err != nil {
+		src.errs = append(src.errs, err)
+	}
+	conf.backupKey = key
+	if conf.backupInterval > 0 && err == nil && key == nil {
+		src.fail("BACKUP_ENCRYPTION_KEY must be set unless BACKUP_INTERVAL=0")
+	}
+
+	// The bucket is cross-checked against the database weekly by default;
+	// STORAGE_RECONCILE_INTERVAL=0 turns it off. Discrepancies are only
+	// reported unless STORAGE_AUTO_REPAIR is set.
+	conf.storageReconcileInterval = src.durationOr("STORAGE_RECONCILE_INTERVAL", 7*24*time.Hour)
+	conf.storageAutoRepair = src.boolOr("STORAGE_AUTO_REPAIR", false)
+
+	// SHUTDOWN_DRAIN_TIMEOUT should be shorter than the orchestrator's
+	// termination grace period, or the process is killed mid-drain.
+	conf.drainTimeout = src.durationOr("SHUTDOWN_DRAIN_TIMEOUT", 2*time.Minute)
+
+	// Handlers are cut off after REQUEST_TIMEOUT, or UPLOAD_TIMEOUT for
+	// uploads and backups. Zero disables the limit.
+	conf.requestTimeout = src.durationOr("REQUEST_TIMEOUT", 30*time.Second)
+	conf.uploadTimeout = src.durationOr("UPLOAD_TIMEOUT", time.Hour)
+
+	// The unversioned /api/ paths are deprecated in favour of /api/v1/.
+	// LEGACY_API_SUNSET, a date such as 2027-04-01, tells their clients when
+	// they'll be removed.
+	if v := src.get("LEGACY_API_SUNSET"); v != "" {
+		sunset, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			src.fail("LEGACY_API_SUNSET must be a date like 2027-04-01")
+		}
+		conf.legacyAPISunset = sunset
+	}
+
+	// Each user may make RATE_LIMIT_REQUESTS authenticated requests per
+	// RATE_LIMIT_WINDOW. Zero is unlimited.
+	conf.rateLimit = src.intOr("RATE_LIMIT_REQUESTS", 600)
+	conf.rateLimitWindow = src.durationOr("RATE_LIMIT_WINDOW", time.Minute)
+
+	// CORS is off unless CORS_ALLOWED_ORIGINS lists the origins of
+	// frontends hosted elsewhere.
+	conf.cors = corsPolicy{
+		allowedOrigins:   src.listOr("CORS_ALLOWED_ORIGINS", nil),
+		allowedMethods:   src.listOr("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"}),
+		allowedHeaders:   src.listOr("CORS_ALLOWED_HEADERS", []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", requestIDHeader}),
+		exposedHeaders:   src.listOr("CORS_EXPOSED_HEADERS", defaultCORSExposedHeaders),
+		allowCredentials: src.boolOr("CORS_ALLOW_CREDENTIALS", false),
+		maxAge:           src.durationOr("CORS_MAX_AGE", 10*time.Minute),
+	}
+	if conf.cors.allowCredentials && slices.Contains(conf.cors.allowedOrigins, "*") {
+		src.fail("CORS_ALLOW_CREDENTIALS can't be used with CORS_ALLOWED_ORIGINS=*")
+	}
+
+	conf.metricsToken = src.get("METRICS_TOKEN")
+	conf.logFormat = src.get("LOG_FORMAT")
+	conf.logLevel = src.get("LOG_LEVEL")
+	if _, err := newLogger(io.Discard, conf.logFormat, conf.logLevel); err != nil {
+		src.errs = append(src.errs, err)
+	}
+	conf.otlpEndpoint = src.get("OTEL_EXPORTER_OTLP_ENDPOINT")
+	conf.serviceName = src.stringOr("OTEL_SERVICE_NAME", "tubely")
+
+	if dsn := src.get("SENTRY_DSN"); dsn != "" {
+		reporter, err := newSentryReporter(dsn, src.get("PLATFORM"))
+		if err != nil {
+			src.errs = append(src.errs, err)
+		} else {
+			conf.errorReporter = reporter
+		}
+	}
+
+	conf.ffmpegPath = src.stringOr("FFMPEG_PATH", "ffmpeg")
+	conf.ffprobePath = src.stringOr("FFPROBE_PATH", "ffprobe")
+	// QUALITY_METRICS scores each rendition against the upload with vmaf,
+	// which needs an ffmpeg built with libvmaf, and/or ssim. It adds a full
+	// decode of both files to processing, so it's off by default.
+	conf.qualityMetrics = src.listOr("QUALITY_METRICS", nil)
+	for _, metric := range conf.qualityMetrics {
+		if metric != qualityMetricVMAF && metric != qualityMetricSSIM {
+			src.fail("QUALITY_METRICS can only contain vmaf and ssim")
+		}
+	}
+	// HLS_ENCRYPTION AES-128 encrypts the segments of videos packaged for
+	// HLS, with a key per video served by the API.
+	conf.hlsEncryption = src.boolOr("HLS_ENCRYPTION", false)
+	// HDR uploads always get a tone-mapped SDR rendition. PRESERVE_HDR
+	// keeps the video's own file HDR; turned off, the file is the SDR one.
+	conf.preserveHDR = src.boolOr("PRESERVE_HDR", true)
+	// NORMALIZE_FRAME_RATE re-encodes variable frame rate uploads at the
+	// nearest standard constant rate, which fixes audio drift and seeking
+	// in players that assume a constant one.
+	conf.normalizeFrameRate = src.boolOr("NORMALIZE_FRAME_RATE", false)
+	conf.maxVideoUploadBytes = src.int64Or("MAX_VIDEO_UPLOAD_BYTES", 10<<30)
+	if conf.maxVideoUploadBytes == 0 {
+		src.fail("MAX_VIDEO_UPLOAD_BYTES must be positive")
+	}
+	conf.maxThumbnailUploadBytes = src.int64Or("MAX_THUMBNAIL_UPLOAD_BYTES", 10<<20)
+	if conf.maxThumbnailUploadBytes <= 0 {
+		src.fail("MAX_THUMBNAIL_UPLOAD_BYTES must be positive")
+	}
+	// HEIC_THUMBNAIL_FORMAT is what HEIC thumbnails, which most browsers
+	// can't show, are converted to. webp needs an ffmpeg built with libwebp.
+	conf.heicThumbnailFormat = src.stringOr("HEIC_THUMBNAIL_FORMAT", thumbnailFormatJPEG)
+	if conf.heicThumbnailFormat != thumbnailFormatJPEG && conf.heicThumbnailFormat != thumbnailFormatWebP {
+		src.fail("HEIC_THUMBNAIL_FORMAT must be jpeg or webp")
+	}
+	// CONTAINER_PROFILES are the MP4 container profiles uploads may pick
+	// with ?container_profile=: progressive, fmp4, and cmaf.
+	// DEFAULT_CONTAINER_PROFILE is used when they don't.
+	conf.containerProfiles = src.listOr("CONTAINER_PROFILES", []string{containerProfileProgressive, containerProfileFMP4, containerProfileCMAF})
+	for _, profile := range conf.containerProfiles {
+		if _, ok := containerMovFlags[profile]; !ok {
+			src.fail("CONTAINER_PROFILES can only contain progressive, fmp4, and cmaf")
+		}
+	}
+	conf.defaultContainerProfile = src.stringOr("DEFAULT_CONTAINER_PROFILE", containerProfileProgressive)
+	if !slices.Contains(conf.containerProfiles, conf.defaultContainerProfile) {
+		src.fail("DEFAULT_CONTAINER_PROFILE must be one of CONTAINER_PROFILES")
+	}
+	// Per-user upload limits; admins can override them for a user. Zero is
+	// unlimited.
+	conf.quotas = quotaLimits{
+		StorageBytes: src.int64Or("QUOTA_STORAGE_BYTES", 0),
+		VideosPerDay: src.intOr("QUOTA_VIDEOS_PER_DAY", 0),
+	}
+	if conf.quotas.StorageBytes < 0 || conf.quotas.VideosPerDay < 0 {
+		src.fail("QUOTA_STORAGE_BYTES and QUOTA_VIDEOS_PER_DAY can't be negative")
+	}
+
+	// Users are emailed once their storage passes QUOTA_WARNING_PERCENT of
+	// their quota.
+	conf.quotaWarningPercent = src.intOr("QUOTA_WARNING_PERCENT", 90)
+	if conf.quotaWarningPercent < 1 || conf.quotaWarningPercent > 100 {
+		src.fail("QUOTA_WARNING_PERCENT must be between 1 and 100")
+	}
+
+	// Notification emails are sent from MAIL_FROM through MAIL_PROVIDER:
+	// "smtp", "ses", or "log" to log them in development. They're off if
+	// it's unset.
+	conf.mailProvider = src.get("MAIL_PROVIDER")
+	switch conf.mailProvider {
+	case "", "log":
+	case "smtp":
+		conf.smtpAddr = net.JoinHostPort(src.required("SMTP_HOST"), src.stringOr("SMTP_PORT", "587"))
+		conf.smtpUsername = src.get("SMTP_USERNAME")
+		conf.smtpPassword = src.get("SMTP_PASSWORD")
+	case "ses":
+		conf.sesRegion = src.stringOr("SES_REGION", conf.s3Region)
+	default:
+		src.fail("MAIL_PROVIDER must be smtp, ses, or log")
+	}
+	if conf.mailProvider == "smtp" || conf.mailProvider == "ses" {
+		conf.mailFrom = src.required("MAIL_FROM")
+	}
+
+	// At most MAX_CONCURRENT_UPLOADS video uploads, declaring at most
+	// MAX_IN_FLIGHT_UPLOAD_BYTES between them, are received at once. Others
+	// wait up to UPLOAD_QUEUE_TIMEOUT and are then rejected. Zero limits are
+	// unlimited.
+	conf.maxUploads = src.intOr("MAX_CONCURRENT_UPLOADS", 16)
+	conf.maxUploadBytes = src.int64Or("MAX_IN_FLIGHT_UPLOAD_BYTES", 0)
+	conf.uploadQueueTimeout = src.durationOr("UPLOAD_QUEUE_TIMEOUT", 10*time.Second)
+
+	// Uploads are read no faster than UPLOAD_BANDWIDTH bytes per second in
+	// total, and UPLOAD_CONNECTION_BANDWIDTH each. Zero is unlimited.
+	conf.uploadBandwidth = src.int64Or("UPLOAD_BANDWIDTH", 0)
+	conf.uploadConnBandwidth = src.int64Or("UPLOAD_CONNECTION_BANDWIDTH", 0)
+
+	// Uploads that declare their size get REQUEST_TIMEOUT plus the time to
+	// read them at UPLOAD_MIN_THROUGHPUT bytes per second, instead of
+	// UPLOAD_TIMEOUT. Zero gives every upload UPLOAD_TIMEOUT. Uploads
+	// throttled below it would never make the deadline, so it's capped at
+	// UPLOAD_CONNECTION_BANDWIDTH.
+	conf.uploadMinThroughput = src.int64Or("UPLOAD_MIN_THROUGHPUT", 1<<20)
+	if conf.uploadMinThroughput < 0 {
+		src.fail("UPLOAD_MIN_THROUGHPUT can't be negative")
+	}
+	if conf.uploadConnBandwidth > 0 && conf.uploadMinThroughput > conf.uploadConnBandwidth {
+		conf.uploadMinThroughput = conf.uploadConnBandwidth
+	}
+
+	// After CIRCUIT_FAILURE_THRESHOLD consecutive failures, S3 and ffmpeg
+	// calls fail fast for CIRCUIT_COOLDOWN before one is let through to see
+	// whether the dependency has recovered.
+	conf.circuitThreshold = src.intOr("CIRCUIT_FAILURE_THRESHOLD", 5)
+	if conf.circuitThreshold < 1 {
+		src.fail("CIRCUIT_FAILURE_THRESHOLD must be at least 1")
+	}
+	conf.circuitCooldown = src.durationOr("CIRCUIT_COOLDOWN", 30*time.Second)
+
+	// Processed videos are scanned by MODERATION_PROVIDER: "http" posts
+	// sampled frames to MODERATION_URL, "command" runs MODERATION_COMMAND on
+	// them. Videos scoring MODERATION_FLAG_THRESHOLD on any of
+	// MODERATION_LABELS are flagged for review, and those scoring
+	// MODERATION_QUARANTINE_THRESHOLD are taken down. Scanning is off if the
+	// provider is unset.
+	conf.moderation.provider = src.get("MODERATION_PROVIDER")
+	switch conf.moderation.provider {
+	case "":
+	case "http":
+		conf.moderation.url = src.required("MODERATION_URL")
+		conf.moderation.token = src.get("MODERATION_TOKEN")
+	case "command":
+		conf.moderation.command = src.required("MODERATION_COMMAND")
+	default:
+		src.fail("MODERATION_PROVIDER must be http or command")
+	}
+	conf.moderation.frames = src.intOr("MODERATION_FRAMES", 8)
+	if conf.moderation.frames < 1 {
+		src.fail("MODERATION_FRAMES must be at least 1")
+	}
+	conf.moderation.labels = src.listOr("MODERATION_LABELS", []string{"nsfw"})
+	conf.moderation.flagThreshold = src.floatOr("MODERATION_FLAG_THRESHOLD", 0.6)
+	conf.moderation.quarantineThreshold = src.floatOr("MODERATION_QUARANTINE_THRESHOLD", 0.9)
+	if conf.moderation.flagThreshold > conf.moderation.quarantineThreshold || conf.moderation.quarantineThreshold > 1 {
+		src.fail("MODERATION_FLAG_THRESHOLD and MODERATION_QUARANTINE_THRESHOLD must be between 0 and 1, flagging at or below quarantine")
+	}
+
+	// Landscape videos of owners with the vertical_rendition flag get a
+	// 9:16 rendition. VERTICAL_CROP_PROVIDER "cropdetect" centres it on the
+	// picture inside any black bars; "command" pans it to follow the
+	// subject VERTICAL_CROP_COMMAND finds in VERTICAL_CROP_FRAMES sampled
+	// frames.
+	conf.verticalCrop.provider = src.stringOr("VERTICAL_CROP_PROVIDER", "cropdetect")
+	switch conf.verticalCrop.provider {
+	case "cropdetect":
+	case "command":
+		conf.verticalCrop.command = src.required("VERTICAL_CROP_COMMAND")
+	default:
+		src.fail("VERTICAL_CROP_PROVIDER must be cropdetect or command")
+	}
+	conf.verticalCrop.frames = src.intOr("VERTICAL_CROP_FRAMES", 30)
+	if conf.verticalCrop.frames < 2 {
+		src.fail("VERTICAL_CROP_FRAMES must be at least 2")
+	}
+
+	// When a transcript is uploaded, CHAPTER_SUGGESTION_PROVIDER splits it
+	// into titled chapters for the owner to review: "http" posts it to
+	// CHAPTER_SUGGESTION_URL, "command" pipes it to
+	// CHAPTER_SUGGESTION_COMMAND. Suggestions are off if the provider is
+	// unset.
+	conf.chapterSuggestion.provider = src.get("CHAPTER_SUGGESTION_PROVIDER")
+	switch conf.chapterSuggestion.provider {
+	case "":
+	case "http":
+		conf.chapterSuggestion.url = src.required("CHAPTER_SUGGESTION_URL")
+		conf.chapterSuggestion.token = src.get("CHAPTER_SUGGESTION_TOKEN")
+	case "command":
+		conf.chapterSuggestion.command = src.required("CHAPTER_SUGGESTION_COMMAND")
+	default:
+		src.fail("CHAPTER_SUGGESTION_PROVIDER must be http or command")
+	}
+
+	// Uploaded videos and thumbnails are virus scanned by the clamd at
+	// CLAMD_ADDRESS, host:port or unix:/path/to/socket, before they're
+	// stored. Scanning is off if it's unset.
+	conf.clamdAddress = src.get("CLAMD_ADDRESS")
+	conf.clamdTimeout = src.durationOr("CLAMD_TIMEOUT", 2*time.Minute)
+	if conf.clamdTimeout == 0 {
+		src.fail("CLAMD_TIMEOUT must be positive")
+	}
+
+	// Files of quarantined videos are moved under QUARANTINE_PREFIX in
+	// QUARANTINE_BUCKET until an admin reviews them. Neither should be
+	// reachable through S3_CF_DISTRO.
+	conf.quarantineBucket = src.stringOr("QUARANTINE_BUCKET", conf.s3Bucket)
+	conf.quarantinePrefix = src.stringOr("QUARANTINE_PREFIX", "quarantine/")
+	if conf.quarantinePrefix == "" && conf.quarantineBucket == conf.s3Bucket {
+		src.fail("QUARANTINE_PREFIX can only be empty with a separate QUARANTINE_BUCKET")
+	}
+
+	// Files posted straight to S3 by form uploads wait under
+	// UPLOAD_STAGING_PREFIX in UPLOAD_STAGING_BUCKET until they're queued
+	// for processing. They haven't been scanned, so neither should be
+	// reachable through S3_CF_DISTRO.
+	conf.stagingBucket = src.stringOr("UPLOAD_STAGING_BUCKET", conf.s3Bucket)
+	conf.stagingPrefix = src.stringOr("UPLOAD_STAGING_PREFIX", "staging/")
+	if conf.stagingPrefix == "" && conf.stagingBucket == conf.s3Bucket {
+		src.fail("UPLOAD_STAGING_PREFIX can only be empty with a separate UPLOAD_STAGING_BUCKET")
+	}
+
+	// Originals of users in compliance mode are stored under S3 Object Lock
+	// in OBJECT_LOCK_MODE. S3_BUCKET must have Object Lock enabled before
+	// any user is put in compliance mode.
+	conf.objectLockMode = strings.ToUpper(src.stringOr("OBJECT_LOCK_MODE", "COMPLIANCE"))
+	if conf.objectLockMode != "COMPLIANCE" && conf.objectLockMode != "GOVERNANCE" {
+		src.fail("OBJECT_LOCK_MODE must be COMPLIANCE or GOVERNANCE")
+	}
+
+	// Setting PLAYBACK_TOKEN_SECRET signs every playback URL handed out with
+	// a token the CDN checks, valid for between PLAYBACK_TOKEN_TTL and twice
+	// that. The secret is shared with the CDN, so it's separate from
+	// JWT_SECRET.
+	conf.playbackTokenSecret = src.get("PLAYBACK_TOKEN_SECRET")
+	if conf.playbackTokenSecret != "" && conf.playbackTokenSecret == conf.jwtSecret {
+		src.fail("PLAYBACK_TOKEN_SECRET must differ from JWT_SECRET")
+	}
+	conf.playbackTokenTTL = src.durationOr("PLAYBACK_TOKEN_TTL", time.Hour)
+	if conf.playbackTokenTTL == 0 {
+		src.fail("PLAYBACK_TOKEN_TTL must be positive")
+	}
+
+	// Per-video geo-restrictions are enforced when GEOIP_PROVIDER is set:
+	// "header" trusts the country the CDN puts in GEOIP_HEADER, "http" looks
+	// the client's address up at GEOIP_URL. Behind a proxy, GEOIP_IP_HEADER
+	// names the header carrying that address.
+	conf.geo.provider = src.get("GEOIP_PROVIDER")
+	switch conf.geo.provider {
+	case "":
+	case "header":
+		conf.geo.header = src.stringOr("GEOIP_HEADER", "CloudFront-Viewer-Country")
+	case "http":
+		conf.geo.url = src.required("GEOIP_URL")
+		conf.geo.ipHeader = src.get("GEOIP_IP_HEADER")
+		conf.geo.timeout = src.durationOr("GEOIP_TIMEOUT", 2*time.Second)
+	default:
+		src.fail("GEOIP_PROVIDER must be header or http")
+	}
+
+	// Bandwidth is metered from the CDN's access logs, delivered under
+	// DELIVERY_LOG_PREFIX in DELIVERY_LOG_BUCKET. DELIVERY_LOG_FORMAT is
+	// cloudfront for CloudFront standard logs or s3 for S3 server access
+	// logs. Metering is off if the prefix is unset.
+	conf.deliveryLogs.prefix = src.get("DELIVERY_LOG_PREFIX")
+	conf.deliveryLogs.bucket = src.stringOr("DELIVERY_LOG_BUCKET", conf.s3Bucket)
+	conf.deliveryLogs.format = src.stringOr("DELIVERY_LOG_FORMAT", deliveryLogFormatCloudFront)
+	if conf.deliveryLogs.format != deliveryLogFormatCloudFront && conf.deliveryLogs.format != deliveryLogFormatS3 {
+		src.fail("DELIVERY_LOG_FORMAT must be cloudfront or s3")
+	}
+
+	// Players report playback events to the beacon endpoint. A fraction
+	// BEACON_SAMPLE_RATE of playback sessions is recorded, 0 turning the
+	// beacon off. Events are rolled up into analytics and kept for
+	// PLAYBACK_EVENT_RETENTION_DAYS; each rollup rereads the last day, so
+	// they're kept at least two. Hourly rollups are kept for
+	// ANALYTICS_HOURLY_RETENTION_DAYS and daily ones indefinitely.
+	conf.beacon.sampleRate = src.floatOr("BEACON_SAMPLE_RATE", 1)
+	if conf.beacon.sampleRate > 1 {
+		src.fail("BEACON_SAMPLE_RATE must be between 0 and 1")
+	}
+	conf.beacon.retention = time.Duration(src.intOr("PLAYBACK_EVENT_RETENTION_DAYS", 7)) * 24 * time.Hour
+	if conf.beacon.retention < 2*24*time.Hour {
+		src.fail("PLAYBACK_EVENT_RETENTION_DAYS must be at least 2")
+	}
+	conf.analyticsHourlyRetention = time.Duration(src.intOr("ANALYTICS_HOURLY_RETENTION_DAYS", 90)) * 24 * time.Hour
+	if conf.analyticsHourlyRetention < 7*24*time.Hour {
+		src.fail("ANALYTICS_HOURLY_RETENTION_DAYS must be at least 7")
+	}
+
+	// Live streams are published over RTMP to RTMP_ADDRESS, with a user's
+	// stream key as the stream name. RTMP_INGEST_URL is the URL encoders
+	// are given; it defaults to BASE_URL's host on the RTMP port. Live
+	// streaming is off if the address is unset.
+	conf.live.address = src.get("RTMP_ADDRESS")
+	if conf.live.address != "" {
+		_, rtmpPort, err := net.SplitHostPort(conf.live.address)
+		if err != nil {
+			src.fail("RTMP_ADDRESS must be a host:port")
+		}
+		defaultIngestURL := ""
+		if u, err := url.Parse(conf.baseURL); err == nil {
+			defaultIngestURL = "rtmp://" + net.JoinHostPort(u.Hostname(), rtmpPort) + "/" + liveApp
+		}
+		conf.live.ingestURL = src.stringOr("RTMP_INGEST_URL", defaultIngestURL)
+	}
+	// Browsers go live over WHIP through the WebRTC gateway at
+	// WHIP_GATEWAY_URL, which republishes each session to the RTMP ingest.
+	conf.live.whipGatewayURL = src.get("WHIP_GATEWAY_URL")
+	if conf.live.whipGatewayURL != "" {
+		if conf.live.address == "" {
+			src.fail("WHIP_GATEWAY_URL needs RTMP_ADDRESS to be set")
+		}
+		if u, err := url.Parse(conf.live.whipGatewayURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			src.fail("WHIP_GATEWAY_URL must be an http or https URL")
+		}
+	}
+
+	// Backend services can manage videos over gRPC on GRPC_ADDRESS. It's
+	// off if the address is unset.
+	conf.grpcAddress = src.get("GRPC_ADDRESS")
+	if conf.grpcAddress != "" {
+		if _, _, err := net.SplitHostPort(conf.grpcAddress); err != nil {
+			src.fail("GRPC_ADDRESS must be a host:port")
+		}
+	}
+
+	// A processing job that fails JOB_MAX_ATTEMPTS times is dead-lettered.
+	conf.jobMaxAttempts = src.intOr("JOB_MAX_ATTEMPTS", 3)
+	if conf.jobMaxAttempts < 1 {
+		src.fail("JOB_MAX_ATTEMPTS must be at least 1")
+	}
+	// A backfill keeps at most BACKFILL_MAX_QUEUED videos in the job queue
+	// at a time, so uploads don't wait behind it.
+	conf.backfillMaxQueued = src.intOr("BACKFILL_MAX_QUEUED", 2)
+	if conf.backfillMaxQueued < 1 {
+		src.fail("BACKFILL_MAX_QUEUED must be at least 1")
+	}
+
+	conf.featureFlags = map[string]bool{}
+	for _, name := range strings.Split(src.get("FEATURE_FLAGS"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !validFeatureFlag(name) {
+			src.fail("FEATURE_FLAGS: unknown flag %q", name)
+			continue
+		}
+		conf.featureFlags[name] = true
+	}
+
+	src.known["CONFIG_FILE"] = true
+	for _, name := range fileNames {
+		if !src.known[name] {
+			src.fail("unknown setting %s in config file", name)
+		}
+	}
+	return conf, errors.Join(src.errs...)
+}
+
+// loadPoolConfig reads the database connection pool settings. The defaults
+// leave headroom for upload bursts without exhausting Postgres connections.
+func loadPoolConfig(src *configSource) database.PoolConfig {
+	return database.PoolConfig{
+		MaxOpenConns:    src.intOr("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    src.intOr("DB_MAX_IDLE_CONNS", 10),
+		ConnMaxLifetime: src.durationOr("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		ConnMaxIdleTime: src.durationOr("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		BusyTimeout:     src.durationOr("DB_BUSY_TIMEOUT", 5*time.Second),
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// moderationConfig selects and tunes automated content scanning. Scanning
+// is off when provider is empty.
+type moderationConfig struct {
+	// provider is "http" to post frames to url, or "command" to run a local
+	// model as command.
+	provider string
+	url      string
+	token    string
+	command  string
+	// frames is how many frames are sampled from each video.
+	frames int
+	// labels are the classifier labels the thresholds apply to. Others are
+	// recorded but ignored.
+	labels              []string
+	flagThreshold       float64
+	quarantineThreshold float64
+}
+
+// frameClassifier scores sampled frames. It returns one map of label to
+// score, from 0 to 1, per frame.
+type frameClassifier interface {
+	Classify(ctx context.Context, frames []string) ([]map[string]float64, error)
+}
+
+// classifierResponse is what both classifiers return: scores for each
+// frame, in the order they were given, e.g.
+// {"results": [{"nsfw": 0.02}, {"nsfw": 0.91}]}.
+type classifierResponse struct {
+	Results []map[string]float64 `json:"results"`
+}
+
+// httpClassifier posts the frames as base64 JPEGs, {"images": [...]}, to a
+// classification service.
+type httpClassifier struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (c httpClassifier) Classify(ctx context.Context, frames []string) ([]map[string]float64, error) {
+	var body struct {
+		Images []string `json:"images"`
+	}
+	for _, frame := range frames {
+		dat, err := os.ReadFile(frame)
+		if err != nil {
+			return nil, err
+		}
+		body.Images = append(body.Images, base64.StdEncoding.EncodeToString(dat))
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("classifier returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	var result classifierResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("couldn't decode classifier response: %w", err)
+	}
+	return result.Results, nil
+}
+
+// commandClassifier runs a local model, passing the frame paths as
+// arguments and reading the scores from its stdout.
+type commandClassifier struct {
+	path string
+}
+
+func (c commandClassifier) Classify(ctx context.Context, frames []string) ([]map[string]float64, error) {
+	cmd := exec.CommandContext(ctx, c.path, frames...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := runCommand(cmd); err != nil {
+		return nil, err
+	}
+	var result classifierResponse
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("couldn't decode classifier output: %w", err)
+	}
+	return result.Results, nil
+}
+
+// contentModerator scans videos as they're processed and applies the
+// moderation policy to the result.
+type contentModerator struct {
+	classifier          frameClassifier
+	frames              int
+	labels              []string
+	flagThreshold       float64
+	quarantineThreshold float64
+}
+
+// newContentModerator returns nil when scanning is off.
+func newContentModerator(conf moderationConfig) *contentModerator {
+	m := &contentModerator{
+		frames:              conf.frames,
+		labels:              conf.labels,
+		flagThreshold:       conf.flagThreshold,
+		quarantineThreshold: conf.quarantineThreshold,
+	}
+	switch conf.provider {
+	case "http":
+		m.classifier = httpClassifier{url: conf.url, token: conf.token, client: &http.Client{Timeout: time.Minute}}
+	case "command":
+		m.classifier = commandClassifier{path: conf.command}
+	default:
+		return nil
+	}
+	return m
+}
+
+// judge keeps the highest score each label got on any frame and picks a
+// verdict from the highest scoring label the policy covers.
+func (m *contentModerator) judge(videoID uuid.UUID, results []map[string]float64) database.ModerationScan {
+	scan := database.ModerationScan{
+		VideoID:   videoID,
+		Verdict:   database.ModerationVerdictClean,
+		Scores:    map[string]float64{},
+		ScannedAt: time.Now().UTC(),
+	}
+	for _, frame := range results {
+		for label, score := range frame {
+			scan.Scores[label] = max(scan.Scores[label], score)
+		}
+	}
+	for _, label := range m.labels {
+		if score, ok := scan.Scores[label]; ok && score > scan.Score {
+			scan.Label, scan.Score = label, score
+		}
+	}
+	switch {
+	case scan.Score >= m.quarantineThreshold:
+		scan.Verdict = database.ModerationVerdictQuarantined
+	case scan.Score >= m.flagThreshold:
+		scan.Verdict = database.ModerationVerdictFlagged
+	}
+	return scan
+}
+
+// moderateVideo scans a video's source file, if scanning is on, and records
+// the verdict. A video to be quarantined is taken down before it's
+// published, and its file has to be stored in quarantine.
+func (cfg *apiConfig) moderateVideo(ctx context.Context, videoID uuid.UUID, sourcePath string, durationSeconds float64) (quarantine bool, err error) {
+	m := cfg.moderator
+	if m == nil {
+		return false, nil
+	}
+
+	var dir string
+	var frames []string
+	err = cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		dir, frames, err = sampleFrames(ctx, cfg.ffmpegPath, sourcePath, durationSeconds, m.frames)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("couldn't sample frames: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	results, err := m.classifier.Classify(ctx, frames)
+	if err != nil {
+		return false, fmt.Errorf("couldn't classify frames: %w", err)
+	}
+	scan := m.judge(videoID, results)
+	if err := cfg.db.SaveModerationScan(ctx, scan); err != nil {
+		return false, fmt.Errorf("couldn't record scan: %w", err)
+	}
+	cfg.metrics.moderationScans.Inc(string(scan.Verdict))
+	if scan.Verdict == database.ModerationVerdictClean {
+		return false, nil
+	}
+
+	slog.InfoContext(ctx, "Video flagged by content scan", "video_id", videoID, "verdict", scan.Verdict, "label", scan.Label, "score", scan.Score)
+	if scan.Verdict != database.ModerationVerdictQuarantined {
+		return false, nil
+	}
+	if err := cfg.db.TakeDownVideo(ctx, videoID); err != nil {
+		return false, fmt.Errorf("couldn't quarantine video: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy lets browsers on other origins call the server. Origins are
+// matched exactly, except that "*" allows any origin and an entry such as
+// "https://*.example.com" allows that domain's subdomains.
+type corsPolicy struct {
+	allowedOrigins   []string
+	allowedMethods   []string
+	allowedHeaders   []string
+	exposedHeaders   []string
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+// defaultCORSExposedHeaders are the response headers scripts on other
+// origins may read unless CORS_EXPOSED_HEADERS says otherwise.
+var defaultCORSExposedHeaders = []string{
+	"ETag", "Location", "Retry-After", requestIDHeader,
+	"Deprecation", "Sunset", "Link",
+	"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+	"X-Quota-Storage-Used", "X-Quota-Storage-Limit", "X-Quota-Videos-Used", "X-Quota-Videos-Limit", "X-Quota-Reset",
+}
+
+func (p corsPolicy) allowsOrigin(origin string) bool {
+	for _, allowed := range p.allowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if ok && strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// middleware adds CORS headers for allowed origins and answers preflight
+// requests itself, since ServeMux would reject OPTIONS on routes registered
+// for other methods.
+func (p corsPolicy) middleware(next http.Handler) http.Handler {
+	if len(p.allowedOrigins) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !p.allowsOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Credentialed requests need the origin echoed back; browsers
+		// reject "*" for them.
+		if len(p.allowedOrigins) == 1 && p.allowedOrigins[0] == "*" && !p.allowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.allowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", strings.Join(p.allowedMethods, ", "))
+			h.Set("Access-Control-Allow-Headers", strings.Join(p.allowedHeaders, ", "))
+			if p.maxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if len(p.exposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(p.exposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
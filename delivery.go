@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	deliveryLogFormatCloudFront = "cloudfront"
+	deliveryLogFormatS3         = "s3"
+)
+
+// deliveryLogConfig is where the CDN's access logs are delivered. Metering
+// is off when prefix is empty.
+type deliveryLogConfig struct {
+	bucket string
+	prefix string
+	// format is "cloudfront" for CloudFront standard logs or "s3" for S3
+	// server access logs.
+	format string
+}
+
+// deliveryRequest is one logged request for an object.
+type deliveryRequest struct {
+	day   string
+	key   string
+	bytes int64
+}
+
+// runDeliveryMeter ingests new access logs until ctx is cancelled.
+func (cfg *apiConfig) runDeliveryMeter(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cfg.ingestDeliveryLogs(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ingestDeliveryLogs counts every log file delivered since the last one
+// ingested. Log names sort by time, so files are listed after that one.
+func (cfg *apiConfig) ingestDeliveryLogs(ctx context.Context) {
+	last, err := cfg.db.GetLastDeliveryLog(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get last delivery log", "error", err)
+		return
+	}
+	params := &s3.ListObjectsV2Input{
+		Bucket: &cfg.deliveryLogs.bucket,
+		Prefix: &cfg.deliveryLogs.prefix,
+	}
+	if last != "" {
+		params.StartAfter = &last
+	}
+	for {
+		out, err := cfg.s3Client.ListObjectsV2(ctx, params)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't list delivery logs", "error", err)
+			return
+		}
+		for _, obj := range out.Contents {
+			if err := cfg.ingestDeliveryLog(ctx, *obj.Key); err != nil {
+				// Later files are left for the next run so none is skipped.
+				slog.ErrorContext(ctx, "Couldn't ingest delivery log", "key", *obj.Key, "error", err)
+				return
+			}
+		}
+		if out.IsTruncated == nil || !*out.IsTruncated {
+			return
+		}
+		params.ContinuationToken = out.NextContinuationToken
+	}
+}
+
+// ingestDeliveryLog attributes the requests in one log file to videos and
+// records the totals. Requests for objects no video uses are ignored.
+func (cfg *apiConfig) ingestDeliveryLog(ctx context.Context, key string) error {
+	out, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &cfg.deliveryLogs.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	var body io.Reader = out.Body
+	if strings.HasSuffix(key, ".gz") {
+		gz, err := gzip.NewReader(out.Body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	var requests []deliveryRequest
+	if cfg.deliveryLogs.format == deliveryLogFormatS3 {
+		requests, err = parseS3AccessLog(body)
+	} else {
+		requests, err = parseCloudFrontLog(body)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't parse log: %w", err)
+	}
+
+	type owner struct{ videoID, userID uuid.UUID }
+	owners := map[string]owner{}
+	totals := map[[2]string]*database.DeliveryUsage{}
+	for _, req := range requests {
+		objectKey := deliveryObjectKey(req.key)
+		o, ok := owners[objectKey]
+		if !ok {
+			o.videoID, o.userID, err = cfg.db.FindVideoByS3Key(ctx, objectKey)
+			if err != nil {
+				return err
+			}
+			owners[objectKey] = o
+		}
+		if o.videoID == uuid.Nil {
+			continue
+		}
+		id := [2]string{o.videoID.String(), req.day}
+		usage, ok := totals[id]
+		if !ok {
+			usage = &database.DeliveryUsage{VideoID: o.videoID, UserID: o.userID, Day: req.day}
+			totals[id] = usage
+		}
+		usage.Bytes += req.bytes
+		usage.Requests++
+	}
+
+	usage := make([]database.DeliveryUsage, 0, len(totals))
+	for _, u := range totals {
+		usage = append(usage, *u)
+	}
+	recorded, err := cfg.db.RecordDeliveryLog(ctx, key, usage)
+	if err != nil {
+		return err
+	}
+	if recorded {
+		slog.InfoContext(ctx, "Ingested delivery log", "key", key, "requests", len(requests), "videos", len(usage))
+	}
+	return nil
+}
+
+// deliveryObjectKey maps a requested object to the key its rendition is
+// stored under: HLS segments, live or not, count towards their playlist.
+func deliveryObjectKey(key string) string {
+	if (strings.HasPrefix(key, "hls/") || strings.HasPrefix(key, "live/")) && path.Base(key) != hlsPlaylistName {
+		return path.Dir(key) + "/" + hlsPlaylistName
+	}
+	return key
+}
+
+// parseCloudFrontLog reads a CloudFront standard log: tab-separated fields
+// named by a #Fields header.
+func parseCloudFrontLog(r io.Reader) ([]deliveryRequest, error) {
+	columns := map[string]int{"date": 0, "sc-bytes": 3, "cs-uri-stem": 7}
+	requests := []deliveryRequest{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields, ok := strings.CutPrefix(line, "#Fields:"); ok {
+			columns = map[string]int{}
+			for i, name := range strings.Fields(fields) {
+				columns[name] = i
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		values := strings.Split(line, "\t")
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(values) {
+				return ""
+			}
+			return values[i]
+		}
+		stem, err := url.PathUnescape(field("cs-uri-stem"))
+		if err != nil {
+			continue
+		}
+		bytes, _ := strconv.ParseInt(field("sc-bytes"), 10, 64)
+		requests = append(requests, deliveryRequest{
+			day:   field("date"),
+			key:   strings.TrimPrefix(stem, "/"),
+			bytes: bytes,
+		})
+	}
+	return requests, scanner.Err()
+}
+
+// parseS3AccessLog reads S3 server access logs, counting object GETs.
+// Fields are space-separated; the time is in brackets and some fields are
+// quoted.
+func parseS3AccessLog(r io.Reader) ([]deliveryRequest, error) {
+	const (
+		timeField      = 2
+		operationField = 6
+		keyField       = 7
+		bytesField     = 11
+	)
+	requests := []deliveryRequest{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		fields := splitS3LogLine(scanner.Text())
+		if len(fields) <= bytesField || fields[operationField] != "REST.GET.OBJECT" {
+			continue
+		}
+		at, err := time.Parse("02/Jan/2006:15:04:05 -0700", fields[timeField])
+		if err != nil {
+			continue
+		}
+		key, err := url.PathUnescape(fields[keyField])
+		if err != nil {
+			continue
+		}
+		bytes, _ := strconv.ParseInt(fields[bytesField], 10, 64)
+		requests = append(requests, deliveryRequest{
+			day:   at.UTC().Format(time.DateOnly),
+			key:   key,
+			bytes: bytes,
+		})
+	}
+	return requests, scanner.Err()
+}
+
+// splitS3LogLine splits a line on spaces, keeping [bracketed] and "quoted"
+// fields whole, without their delimiters.
+func splitS3LogLine(line string) []string {
+	var fields []string
+	for line != "" {
+		var field string
+		switch line[0] {
+		case '[':
+			field, line, _ = strings.Cut(line[1:], "]")
+		case '"':
+			field, line, _ = strings.Cut(line[1:], "\"")
+		default:
+			field, line, _ = strings.Cut(line, " ")
+		}
+		fields = append(fields, field)
+		line = strings.TrimLeft(line, " ")
+	}
+	return fields
+}
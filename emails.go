@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"text/template"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// emailData is what notification templates are rendered with.
+type emailData struct {
+	User    database.User
+	Video   database.Video
+	Quota   quotaStatus
+	BaseURL string
+}
+
+// WatchURL links to the video's player page.
+func (d emailData) WatchURL() string {
+	return d.BaseURL + "/embed/" + d.Video.ID.String()
+}
+
+// QuotaPercent is how much of their storage quota the user has used.
+func (d emailData) QuotaPercent() int64 {
+	if d.Quota.Limits.StorageBytes == 0 {
+		return 0
+	}
+	return d.Quota.Usage.StorageBytes * 100 / d.Quota.Limits.StorageBytes
+}
+
+// emailTemplates define a "subject" and a "body" template for each kind of
+// notification.
+var emailTemplates = map[database.EmailKind]*template.Template{
+	database.EmailProcessingComplete: template.Must(template.New("").Parse(`
+{{- define "subject"}}"{{.Video.Title}}" is ready to watch{{end}}
+{{- define "body"}}Hi,
+
+Your video "{{.Video.Title}}" has finished processing and is ready to watch:
+
+{{.WatchURL}}
+{{end}}`)),
+	database.EmailProcessingFailed: template.Must(template.New("").Parse(`
+{{- define "subject"}}We couldn't process "{{.Video.Title}}"{{end}}
+{{- define "body"}}Hi,
+
+Something went wrong processing your video "{{.Video.Title}}", and we've
+stopped retrying. Please check the file plays correctly and upload it again.
+{{end}}`)),
+	database.EmailQuotaWarning: template.Must(template.New("").Parse(`
+{{- define "subject"}}You've used {{.QuotaPercent}}% of your storage{{end}}
+{{- define "body"}}Hi,
+
+Your videos now take up {{.QuotaPercent}}% of your storage quota. Once it's
+full you won't be able to upload more until you delete some videos.
+{{end}}`)),
+}
+
+// sendEmail emails a user a notification, unless mail isn't configured or
+// they've turned that kind of email off. Failures are logged; callers
+// shouldn't wait on it.
+func (cfg *apiConfig) sendEmail(ctx context.Context, userID uuid.UUID, kind database.EmailKind, data emailData) {
+	if cfg.mailer == nil {
+		return
+	}
+	prefs, err := cfg.db.GetEmailPreferences(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get email preferences", "user_id", userID, "error", err)
+		return
+	}
+	if !prefs[kind] {
+		return
+	}
+	user, err := cfg.db.GetUser(ctx, userID)
+	if err != nil || user == nil {
+		slog.ErrorContext(ctx, "Couldn't get user to email", "user_id", userID, "error", err)
+		return
+	}
+	data.User = *user
+	data.BaseURL = cfg.baseURL
+
+	var subject, body strings.Builder
+	tmpl := emailTemplates[kind]
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		slog.ErrorContext(ctx, "Couldn't render email", "kind", kind, "error", err)
+		return
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		slog.ErrorContext(ctx, "Couldn't render email", "kind", kind, "error", err)
+		return
+	}
+	msg := mailMessage{To: user.Email, Subject: subject.String(), Text: body.String()}
+	if err := cfg.mailer.Send(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Couldn't send email", "kind", kind, "user_id", userID, "error", err)
+	}
+}
+
+// checkQuotaWarning warns a user whose upload of added bytes took their
+// storage past quotaWarningPercent of its limit. Uploads that were already
+// over it don't warn again.
+func (cfg *apiConfig) checkQuotaWarning(ctx context.Context, userID uuid.UUID, added int64) {
+	if cfg.mailer == nil {
+		return
+	}
+	quota, err := cfg.quotaStatus(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get quota", "user_id", userID, "error", err)
+		return
+	}
+	limit := quota.Limits.StorageBytes
+	if limit == 0 {
+		return
+	}
+	threshold := limit * int64(cfg.quotaWarningPercent) / 100
+	used := quota.Usage.StorageBytes
+	if used >= threshold && used-added < threshold {
+		cfg.sendEmail(ctx, userID, database.EmailQuotaWarning, emailData{Quota: quota})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// sentryReporter sends errors to Sentry, or any service that accepts
+// Sentry's store API such as GlitchTip, using a standard Sentry DSN:
+// https://<public key>@<host>/<project id>.
+type sentryReporter struct {
+	storeURL    string
+	auth        string
+	environment string
+	client      *http.Client
+}
+
+func newSentryReporter(dsn, environment string) (*sentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("SENTRY_DSN must look like https://key@host/project")
+	}
+	project := strings.Trim(u.Path, "/")
+	if project == "" {
+		return nil, errors.New("SENTRY_DSN is missing a project ID")
+	}
+	// A project path may have a prefix when Sentry is served under one.
+	prefix := ""
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+	return &sentryReporter{
+		storeURL:    fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=tubely/1.0, sentry_key=%s", u.User.Username()),
+		environment: environment,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Report sends the event in the background so the failing request isn't
+// held up by the error tracker.
+func (s *sentryReporter) Report(ctx context.Context, err error, stack []byte, r *http.Request) {
+	eventID := make([]byte, 16)
+	rand.Read(eventID)
+	event := map[string]any{
+		"event_id":    hex.EncodeToString(eventID),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"level":       "fatal",
+		"platform":    "go",
+		"logger":      "tubely",
+		"environment": s.environment,
+		"message":     err.Error(),
+		"exception": map[string]any{
+			"values": []map[string]any{{"type": "panic", "value": err.Error()}},
+		},
+		"tags":  map[string]string{"request_id": requestIDFromContext(ctx)},
+		"extra": map[string]string{"stack": string(stack)},
+	}
+	if r != nil {
+		event["transaction"] = r.Pattern
+		event["request"] = map[string]any{
+			"method": r.Method,
+			"url":    r.URL.Path,
+		}
+	}
+	body, merr := json.Marshal(event)
+	if merr != nil {
+		slog.ErrorContext(ctx, "Couldn't encode error report", "error", merr)
+		return
+	}
+
+	go func() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.storeURL, bytes.NewReader(body))
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't send error report", "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", s.auth)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't send error report", "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.ErrorContext(ctx, "Error tracker rejected report", "status", resp.StatusCode)
+		}
+	}()
+}
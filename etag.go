@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// computeETag returns a strong ETag for the JSON representation of a
+// resource, so any change to a returned field changes the tag.
+func computeETag(payload any) (string, error) {
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(dat)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value
+// matches the ETag. weak allows W/ tags to match, as If-None-Match does.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions enforces If-Match against the current representation of
+// a resource before it is modified. It writes a 412 and returns false when
+// the client's copy is stale.
+func checkPreconditions(w http.ResponseWriter, r *http.Request, current any) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+	etag, err := computeETag(current)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't compute ETag", err)
+		return false
+	}
+	if !etagMatches(ifMatch, etag, false) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video was modified by another request", nil)
+		return false
+	}
+	return true
+}
+
+// respondWithETaggedJSON writes payload with an ETag, answering 304 Not
+// Modified when the client already has the current representation. It
+// reports whether it sent the payload.
+func respondWithETaggedJSON(w http.ResponseWriter, r *http.Request, code int, payload any) bool {
+	etag, err := computeETag(payload)
+	if err != nil {
+		respondWithJSON(w, code, payload)
+		return true
+	}
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	respondWithJSON(w, code, payload)
+	return true
+}
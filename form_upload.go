@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// formUploadPolicyTTL is how long a browser has to start posting the
+	// file once the policy is signed.
+	formUploadPolicyTTL = time.Hour
+	// formUploadTTL is how long the server waits for S3 to send the
+	// browser back before the file is thrown away. It leaves a large file
+	// started just before the policy expired time to finish.
+	formUploadTTL = 24 * time.Hour
+	// formUploadPrefix is where browsers post files under the staging
+	// prefix before they're processed.
+	formUploadPrefix = "form-uploads/"
+)
+
+type formUploadResponse struct {
+	ID uuid.UUID `json:"id"`
+	// URL is where the form posts, and Fields are the form's fields, which
+	// have to come before the file.
+	URL       string            `json:"url"`
+	Fields    map[string]string `json:"fields"`
+	MaxBytes  int64             `json:"max_bytes"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// handlerFormUploadCreate signs a POST policy that lets a plain HTML form
+// upload a video's file straight to the staging bucket. The policy only
+// accepts an MP4 under the upload's key prefix, within the size and quota
+// limits. S3 then redirects the browser to the upload's callback, which
+// queues the file for processing like a regular upload.
+func (cfg *apiConfig) handlerFormUploadCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		// RedirectURL is where the browser goes once the file is queued.
+		// It has to be on this server's origin.
+		RedirectURL string `json:"redirect_url"`
+	}
+
+	video, userID, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if !cfg.featureEnabled(flagDirectUploads, video.UserID) {
+		respondWithError(w, http.StatusForbidden, "Direct uploads aren't enabled", nil)
+		return
+	}
+	if cfg.rejectBanned(r.Context(), w, userID) || cfg.rejectSuspended(r.Context(), w, userID) {
+		return
+	}
+	if rejectLive(w, video) {
+		return
+	}
+	containerProfile, ok := cfg.requestedContainerProfile(w, r)
+	if !ok {
+		return
+	}
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.RedirectURL != "" && !cfg.sameOrigin(params.RedirectURL) {
+		respondWithError(w, http.StatusBadRequest, "redirect_url must be on this server", nil)
+		return
+	}
+
+	// S3 can't check the quota itself, so the policy's size limit is
+	// whichever is smaller.
+	quota, err := cfg.quotaStatus(r.Context(), video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to get quota", err)
+		return
+	}
+	setQuotaHeaders(w, quota)
+	maxBytes := cfg.maxVideoUploadBytes
+	storageRemaining := quota.storageRemaining()
+	if storageRemaining >= 0 && video.SizeBytes != nil {
+		storageRemaining += *video.SizeBytes
+	}
+	if storageRemaining >= 0 && storageRemaining < maxBytes {
+		maxBytes = storageRemaining
+	}
+	if maxBytes <= 0 {
+		respondWithErrorCode(w, http.StatusForbidden, errCodeQuotaExceeded, "storage quota exceeded", nil, quotaDetails(quota))
+		return
+	}
+
+	now := time.Now().UTC()
+	upload := database.FormUpload{
+		ID:               uuid.New(),
+		VideoID:          video.ID,
+		UserID:           userID,
+		Bucket:           cfg.stagingBucket,
+		ContainerProfile: containerProfile,
+		RedirectURL:      params.RedirectURL,
+		ExpiresAt:        now.Add(formUploadTTL),
+		CreatedAt:        now,
+	}
+	upload.KeyPrefix = cfg.stagingPrefix + formUploadPrefix + upload.ID.String() + "/"
+	callbackURL := fmt.Sprintf("%s%s/form-uploads/%s/callback", cfg.baseURL, apiVersionPrefix, upload.ID)
+	key := upload.KeyPrefix + "${filename}"
+	contentType := "video/mp4"
+	req, err := cfg.s3Presigner.PresignPostObject(r.Context(), &s3.PutObjectInput{
+		Bucket: &upload.Bucket,
+		Key:    &key,
+	}, func(o *s3.PresignPostOptions) {
+		o.Expires = formUploadPolicyTTL
+		o.Conditions = []interface{}{
+			[]interface{}{"starts-with", "$key", upload.KeyPrefix},
+			[]interface{}{"content-length-range", 1, maxBytes},
+			map[string]string{"Content-Type": contentType},
+			map[string]string{"success_action_redirect": callbackURL},
+		}
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign upload policy", err)
+		return
+	}
+	if err := cfg.db.CreateFormUpload(r.Context(), upload); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start upload", err)
+		return
+	}
+
+	fields := req.Values
+	fields["Content-Type"] = contentType
+	fields["success_action_redirect"] = callbackURL
+	respondWithJSON(w, http.StatusCreated, formUploadResponse{
+		ID:        upload.ID,
+		URL:       req.URL,
+		Fields:    fields,
+		MaxBytes:  maxBytes,
+		ExpiresAt: now.Add(formUploadPolicyTTL),
+	})
+}
+
+// handlerFormUploadCallback is where S3 sends the browser after it stores
+// a form upload, with the object's bucket and key in the query. There's no
+// auth header on a redirect, so the upload's ID stands in for it; the file
+// is only ever taken from under the upload's own key prefix.
+func (cfg *apiConfig) handlerFormUploadCallback(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload ID", err)
+		return
+	}
+	upload, err := cfg.db.GetFormUpload(r.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return
+	}
+	if upload == nil || time.Now().After(upload.ExpiresAt) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find upload", nil)
+		return
+	}
+	bucket := cfg.formUploadBucket(*upload)
+	key := r.URL.Query().Get("key")
+	if r.URL.Query().Get("bucket") != bucket || !strings.HasPrefix(key, upload.KeyPrefix) || len(key) == len(upload.KeyPrefix) {
+		respondWithError(w, http.StatusBadRequest, "Callback doesn't match the upload", nil)
+		return
+	}
+	if cfg.rejectBanned(r.Context(), w, upload.UserID) || cfg.rejectSuspended(r.Context(), w, upload.UserID) {
+		return
+	}
+
+	claimed, err := cfg.db.ClaimFormUpload(r.Context(), upload.ID, resumableUploadStaleBefore())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't claim upload", err)
+		return
+	}
+	if !claimed {
+		respondWithError(w, http.StatusConflict, "Upload is already being processed", nil)
+		return
+	}
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := cfg.db.ReleaseFormUpload(context.WithoutCancel(r.Context()), upload.ID); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't release upload", "upload_id", upload.ID, "error", err)
+		}
+	}()
+
+	video, err := cfg.db.GetVideo(r.Context(), upload.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to get video", err)
+		return
+	}
+	if rejectLive(w, video) {
+		return
+	}
+	size, exists, err := cfg.s3ObjectSize(r.Context(), bucket, key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find uploaded file", err)
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Uploaded file not found", nil)
+		return
+	}
+	// Each policy was limited to the quota left when it was signed, so
+	// several signed together can add up to more than that.
+	quota, err := cfg.quotaStatus(r.Context(), video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to get quota", err)
+		return
+	}
+	setQuotaHeaders(w, quota)
+	storageRemaining := quota.storageRemaining()
+	if storageRemaining >= 0 && video.SizeBytes != nil {
+		storageRemaining += *video.SizeBytes
+	}
+
+	// From here the file is taken, so the upload is over whatever happens.
+	completed = true
+	defer func() {
+		ctx := context.WithoutCancel(r.Context())
+		if err := cfg.discardFormUpload(ctx, *upload); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't delete form upload", "upload_id", upload.ID, "error", err)
+		}
+	}()
+
+	if storageRemaining >= 0 && size > storageRemaining {
+		respondWithErrorCode(w, http.StatusForbidden, errCodeQuotaExceeded, "upload would exceed storage quota", nil, quotaDetails(quota))
+		return
+	}
+	if !cfg.queueStagedUpload(w, r, video, bucket, key, cfg.containerProfileOrDefault(upload.ContainerProfile)) {
+		return
+	}
+	slog.InfoContext(r.Context(), "Queued form upload", "upload_id", upload.ID, "video_id", video.ID, "user_id", upload.UserID)
+
+	if upload.RedirectURL != "" {
+		http.Redirect(w, r, upload.RedirectURL, http.StatusSeeOther)
+		return
+	}
+	video, err = cfg.db.GetVideo(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, video)
+}
+
+// sameOrigin reports whether rawURL is on this server, so redirecting to it
+// can't send a browser somewhere else.
+func (cfg *apiConfig) sameOrigin(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	base, err := url.Parse(cfg.baseURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == base.Scheme && u.Host == base.Host
+}
+
+// formUploadBucket is the bucket a browser posts an upload's file to.
+func (cfg *apiConfig) formUploadBucket(upload database.FormUpload) string {
+	if upload.Bucket == "" {
+		return cfg.s3Bucket
+	}
+	return upload.Bucket
+}
+
+// discardFormUpload deletes whatever a browser posted under the upload's
+// key prefix and forgets the upload.
+func (cfg *apiConfig) discardFormUpload(ctx context.Context, upload database.FormUpload) error {
+	bucket := cfg.formUploadBucket(upload)
+	var token *string
+	for {
+		out, err := cfg.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            &bucket,
+			Prefix:            &upload.KeyPrefix,
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return err
+		}
+		for _, obj := range out.Contents {
+			_, err := cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: &bucket,
+				Key:    obj.Key,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if out.IsTruncated == nil || !*out.IsTruncated {
+			break
+		}
+		token = out.NextContinuationToken
+	}
+	return cfg.db.DeleteFormUpload(ctx, upload.ID)
+}
+
+// discardExpiredFormUploads throws away files posted by browsers that never
+// came back to the callback, and the uploads that were never used.
+func (cfg *apiConfig) discardExpiredFormUploads(ctx context.Context) {
+	uploads, err := cfg.db.GetFormUploadsExpiredBefore(ctx, time.Now().UTC(), resumableUploadStaleBefore())
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't list expired form uploads", "error", err)
+		return
+	}
+	for _, upload := range uploads {
+		if err := cfg.discardFormUpload(ctx, upload); err != nil {
+			slog.ErrorContext(ctx, "Couldn't discard expired form upload", "upload_id", upload.ID, "video_id", upload.VideoID, "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Discarded expired form upload", "upload_id", upload.ID, "video_id", upload.VideoID)
+	}
+}
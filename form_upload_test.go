@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerFormUploadCallback(t *testing.T) {
+	const stagingBucket = "tubely-staging"
+	userID := uuid.New()
+	body := []byte("not really an mp4")
+
+	tests := []struct {
+		name string
+		// quota is the owner's storage limit, of which they've already
+		// used 5 bytes. Zero is unlimited.
+		quota    int64
+		bucket   string
+		wantCode int
+		wantErr  errorCode
+		wantJob  bool
+		// wantKept is whether the posted file is left for a retry.
+		wantKept bool
+	}{
+		{"queued", 0, stagingBucket, http.StatusAccepted, "", true, false},
+		{"quota used up since signing", int64(len(body)) + 4, stagingBucket, http.StatusForbidden, errCodeQuotaExceeded, false, false},
+		{"serving bucket", 0, "tubely-test", http.StatusBadRequest, "", false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, store, s3Client := newTestConfig(t)
+			cfg.stagingBucket, cfg.stagingPrefix = stagingBucket, "staging/"
+			video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: userID}, Status: database.VideoStatusDraft}
+			stubVideo(store, video)
+
+			upload := database.FormUpload{
+				ID:        uuid.New(),
+				VideoID:   video.ID,
+				UserID:    userID,
+				Bucket:    stagingBucket,
+				ExpiresAt: time.Now().Add(time.Hour),
+			}
+			upload.KeyPrefix = "staging/form-uploads/" + upload.ID.String() + "/"
+			key := upload.KeyPrefix + "clip.mp4"
+			s3Client.Objects[key] = body
+			deleted := false
+			store.GetFormUploadFunc = func(ctx context.Context, id uuid.UUID) (*database.FormUpload, error) {
+				if id != upload.ID || deleted {
+					return nil, nil
+				}
+				return &upload, nil
+			}
+			store.ClaimFormUploadFunc = func(ctx context.Context, id uuid.UUID, staleBefore time.Time) (bool, error) {
+				return true, nil
+			}
+			store.DeleteFormUploadFunc = func(ctx context.Context, id uuid.UUID) error {
+				deleted = true
+				return nil
+			}
+			store.GetUserQuotaFunc = func(ctx context.Context, id uuid.UUID) (*database.UserQuota, error) {
+				return &database.UserQuota{UserID: id, StorageBytes: &tc.quota}, nil
+			}
+			store.GetUserUsageFunc = func(ctx context.Context, id uuid.UUID, dayStart time.Time) (database.UserUsage, error) {
+				return database.UserUsage{StorageBytes: 5}, nil
+			}
+			queued := false
+			store.CreateJobFunc = func(ctx context.Context, params database.CreateJobParams) (database.Job, error) {
+				queued = true
+				return database.Job{ID: uuid.New()}, nil
+			}
+
+			query := url.Values{"bucket": {tc.bucket}, "key": {key}}
+			req := httptest.NewRequest(http.MethodGet, "/api/form-uploads/"+upload.ID.String()+"/callback?"+query.Encode(), nil)
+			req.SetPathValue("uploadID", upload.ID.String())
+			rec := httptest.NewRecorder()
+			cfg.handlerFormUploadCallback(rec, req)
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.wantCode, rec.Body)
+			}
+			if tc.wantErr != "" {
+				if code := errorCodeOf(t, rec); code != tc.wantErr {
+					t.Errorf("error code = %q, want %q", code, tc.wantErr)
+				}
+			}
+			if queued != tc.wantJob {
+				t.Errorf("queued = %v, want %v", queued, tc.wantJob)
+			}
+			_, kept := s3Client.Objects[key]
+			if kept != tc.wantKept || deleted == tc.wantKept {
+				t.Errorf("file kept = %v and upload deleted = %v, want the file kept = %v", kept, deleted, tc.wantKept)
+			}
+		})
+	}
+}
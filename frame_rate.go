@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"os/exec"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+)
+
+// standardFrameRates are the constant frame rates variable frame rate
+// videos are normalized to, as ffmpeg rationals.
+var standardFrameRates = []struct {
+	rational string
+	fps      float64
+}{
+	{"24000/1001", 24000.0 / 1001},
+	{"24", 24},
+	{"25", 25},
+	{"30000/1001", 30000.0 / 1001},
+	{"30", 30},
+	{"50", 50},
+	{"60000/1001", 60000.0 / 1001},
+	{"60", 60},
+}
+
+// isVariableFrameRate reports whether a stream's frame rate varies, judged
+// by its average rate differing from the base rate its timestamps could
+// represent. Phones and screen recorders drop and repeat frames as load
+// changes, which leaves the two apart.
+func isVariableFrameRate(baseRate, avgRate float64) bool {
+	if baseRate <= 0 || avgRate <= 0 {
+		return false
+	}
+	return math.Abs(baseRate-avgRate)/baseRate > 0.01
+}
+
+// standardFrameRate is the standard frame rate nearest fps.
+func standardFrameRate(fps float64) string {
+	best := standardFrameRates[0]
+	for _, rate := range standardFrameRates[1:] {
+		if math.Abs(rate.fps-fps) < math.Abs(best.fps-fps) {
+			best = rate
+		}
+	}
+	return best.rational
+}
+
+// normalizeFrameRate re-encodes a video at a constant frame rate beside it,
+// duplicating and dropping frames as needed. Audio is resampled to keep it
+// in step with the new timestamps, which is what fixes drift.
+func normalizeFrameRate(ctx context.Context, ffmpegPath, filePath, rate string) (string, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg cfr", tracing.KindInternal)
+	defer span.End()
+	outputPath := filePath + ".cfr.mp4"
+	cmd := exec.CommandContext(ctx,
+		ffmpegPath, "-i", filePath,
+		"-map", "0:v:0", "-map", "0:a?",
+		"-fps_mode", "cfr", "-r", rate,
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "18",
+		"-af", "aresample=async=1",
+		"-c:a", "aac", "-b:a", "192k",
+		"-movflags", "faststart",
+		"-y", outputPath,
+	)
+	if err := runCommand(cmd); err != nil {
+		span.RecordError(err)
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// embeddedFrontend is the web app, built into the binary so it can be
+// served without a copy on disk.
+//
+//go:embed app
+var embeddedFrontend embed.FS
+
+// frontendHandler serves the web app under /app/. Paths that don't name a
+// file and don't look like one get index.html, so routes the app handles
+// in the browser survive a reload.
+type frontendHandler struct {
+	fsys fs.FS
+	// etags holds a hash of each embedded file. Files served from disk can
+	// change while the server runs, so they get none.
+	etags map[string]string
+}
+
+// newFrontendHandler serves the web app from dir, or from the embedded
+// copy when dir is empty.
+func newFrontendHandler(dir string) (*frontendHandler, error) {
+	if dir != "" {
+		return &frontendHandler{fsys: os.DirFS(dir)}, nil
+	}
+	fsys, err := fs.Sub(embeddedFrontend, "app")
+	if err != nil {
+		return nil, err
+	}
+	h := &frontendHandler{fsys: fsys, etags: map[string]string{}}
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		h.etags[name] = `"` + hex.EncodeToString(sum[:16]) + `"`
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *frontendHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, "/app")), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	info, err := fs.Stat(h.fsys, name)
+	if err == nil && info.IsDir() {
+		name = path.Join(name, "index.html")
+		info, err = fs.Stat(h.fsys, name)
+	}
+	if errors.Is(err, fs.ErrNotExist) && path.Ext(name) == "" {
+		name = "index.html"
+		info, err = fs.Stat(h.fsys, name)
+	}
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	// index.html names the other files, so it's always revalidated; the
+	// rest can be reused for a while without asking.
+	if path.Base(name) == "index.html" || h.etags == nil {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	if etag, ok := h.etags[name]; ok {
+		w.Header().Set("ETag", etag)
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "Couldn't read file", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
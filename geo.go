@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// geoConfig selects how a viewer's country is found. Geo-restrictions
+// aren't enforced when provider is empty.
+type geoConfig struct {
+	// provider is "header" to trust a country header set by the CDN or load
+	// balancer, or "http" to look the client's IP address up at url.
+	provider string
+	header   string
+	url      string
+	// ipHeader is the header a trusted proxy puts the client's address in,
+	// e.g. X-Forwarded-For. Without it the connection's address is used.
+	ipHeader string
+	timeout  time.Duration
+}
+
+// geoLocator finds the country a request comes from, as an upper-case ISO
+// 3166-1 alpha-2 code, or "" if it can't tell.
+type geoLocator interface {
+	Country(ctx context.Context, r *http.Request) (string, error)
+}
+
+func newGeoLocator(conf geoConfig) geoLocator {
+	switch conf.provider {
+	case "header":
+		return headerGeoLocator{header: conf.header}
+	case "http":
+		return &httpGeoLocator{
+			url:      conf.url,
+			ipHeader: conf.ipHeader,
+			client:   &http.Client{Timeout: conf.timeout},
+			cache:    map[string]geoCacheEntry{},
+		}
+	}
+	return nil
+}
+
+// headerGeoLocator reads the country from a header such as CloudFront's
+// CloudFront-Viewer-Country or Cloudflare's CF-IPCountry.
+type headerGeoLocator struct {
+	header string
+}
+
+func (l headerGeoLocator) Country(ctx context.Context, r *http.Request) (string, error) {
+	return normalizeCountry(r.Header.Get(l.header)), nil
+}
+
+const (
+	geoCacheTTL  = time.Hour
+	geoCacheSize = 10000
+)
+
+type geoCacheEntry struct {
+	country   string
+	expiresAt time.Time
+}
+
+// httpGeoLocator looks addresses up with GET url?ip=<address>, which returns
+// {"country": "US"}. Results are cached for an hour.
+type httpGeoLocator struct {
+	url      string
+	ipHeader string
+	client   *http.Client
+
+	mu    sync.Mutex
+	cache map[string]geoCacheEntry
+}
+
+func (l *httpGeoLocator) Country(ctx context.Context, r *http.Request) (string, error) {
+	ip := l.clientIP(r)
+	if ip == "" {
+		return "", nil
+	}
+	now := time.Now()
+	l.mu.Lock()
+	entry, ok := l.cache[ip]
+	l.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.country, nil
+	}
+
+	country, err := l.lookup(ctx, ip)
+	if err != nil {
+		return "", err
+	}
+	l.mu.Lock()
+	if len(l.cache) >= geoCacheSize {
+		clear(l.cache)
+	}
+	l.cache[ip] = geoCacheEntry{country: country, expiresAt: now.Add(geoCacheTTL)}
+	l.mu.Unlock()
+	return country, nil
+}
+
+func (l *httpGeoLocator) clientIP(r *http.Request) string {
+	if l.ipHeader != "" {
+		first, _, _ := strings.Cut(r.Header.Get(l.ipHeader), ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (l *httpGeoLocator) lookup(ctx context.Context, ip string) (string, error) {
+	lookupURL := l.url + "?ip=" + url.QueryEscape(ip)
+	if strings.Contains(l.url, "?") {
+		lookupURL = l.url + "&ip=" + url.QueryEscape(ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, lookupURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("geoip service returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	var result struct {
+		Country string `json:"country"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("couldn't decode geoip response: %w", err)
+	}
+	return normalizeCountry(result.Country), nil
+}
+
+// normalizeCountry upper-cases a country code, returning "" for anything
+// that isn't two letters.
+func normalizeCountry(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return ""
+	}
+	return code
+}
+
+// checkGeoRestriction reports whether the request may play the video,
+// writing a GEO_RESTRICTED error if not. Anyone who can edit the video may
+// always play it.
+func (cfg *apiConfig) checkGeoRestriction(w http.ResponseWriter, r *http.Request, video database.Video, viewerID uuid.UUID) bool {
+	country, allowed, err := cfg.geoAllowed(r, video, viewerID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check region", err)
+		return false
+	}
+	if !allowed {
+		respondWithErrorCode(w, http.StatusUnavailableForLegalReasons, errCodeGeoRestricted, "Video isn't available in your region", nil, map[string]any{"country": country})
+		return false
+	}
+	return true
+}
+
+// geoAllowed looks up the request's country and checks it against the
+// video's restriction, if it has one.
+func (cfg *apiConfig) geoAllowed(r *http.Request, video database.Video, viewerID uuid.UUID) (country string, allowed bool, err error) {
+	if cfg.geoLocator == nil {
+		return "", true, nil
+	}
+	restriction, err := cfg.db.GetGeoRestriction(r.Context(), video.ID)
+	if err != nil {
+		return "", false, err
+	}
+	if restriction == nil || cfg.canEditVideo(r.Context(), video, viewerID) {
+		return "", true, nil
+	}
+	country, err = cfg.geoLocator.Country(r.Context(), r)
+	if err != nil {
+		// The viewer is treated as being nowhere, which only an allow list
+		// refuses.
+		slog.WarnContext(r.Context(), "Couldn't locate viewer", "video_id", video.ID, "error", err)
+		country = ""
+	}
+	return country, restriction.Allows(country), nil
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	tubelyv1 "github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/rpc/tubelyv1"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcMaxChunkBytes caps the messages UploadVideo accepts. Clients should
+// send chunks well under it; 64 KiB to 1 MiB works well.
+const grpcMaxChunkBytes = 4 << 20
+
+type grpcUserKey struct{}
+
+// grpcUserID returns the user an authenticated call was made by.
+func grpcUserID(ctx context.Context) uuid.UUID {
+	id, _ := ctx.Value(grpcUserKey{}).(uuid.UUID)
+	return id
+}
+
+// newGRPCServer serves VideoService. Every call must carry an access token
+// in its "authorization" metadata, as "Bearer <token>".
+func (cfg *apiConfig) newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(grpcMaxChunkBytes+1024),
+		grpc.ChainUnaryInterceptor(cfg.grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(cfg.grpcStreamAuth),
+	)
+	tubelyv1.RegisterVideoServiceServer(srv, &grpcVideoService{cfg: cfg})
+	return srv
+}
+
+func (cfg *apiConfig) grpcAuthenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return context.WithValue(ctx, grpcUserKey{}, userID), nil
+}
+
+func (cfg *apiConfig) grpcUnaryAuth(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := cfg.grpcAuthenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (cfg *apiConfig) grpcStreamAuth(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := cfg.grpcAuthenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// stopGRPCServer lets in-flight calls finish for up to drain, then closes
+// the connections that are left.
+func stopGRPCServer(srv *grpc.Server, drain time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(drain):
+		slog.Warn("Drain window ended with gRPC calls in flight, closing them")
+		srv.Stop()
+	}
+}
+
+// grpcVideoService implements VideoService with the same checks as the
+// HTTP video endpoints.
+type grpcVideoService struct {
+	tubelyv1.UnimplementedVideoServiceServer
+	cfg *apiConfig
+}
+
+// checkAccount refuses writes from banned and suspended users.
+func (s *grpcVideoService) checkAccount(ctx context.Context, userID uuid.UUID) error {
+	banned, err := s.cfg.db.IsUserBanned(ctx, userID)
+	if err != nil {
+		return grpcInternal(ctx, "Couldn't get user", err)
+	}
+	if banned {
+		return status.Error(codes.PermissionDenied, "Your account has been banned")
+	}
+	suspended, err := s.cfg.db.IsUserSuspended(ctx, userID)
+	if err != nil {
+		return grpcInternal(ctx, "Couldn't get user", err)
+	}
+	if suspended {
+		return status.Error(codes.PermissionDenied, "Your account has been suspended")
+	}
+	return nil
+}
+
+// editableVideo gets a video the caller may edit, or the error to return.
+func (s *grpcVideoService) editableVideo(ctx context.Context, id string) (database.Video, error) {
+	videoID, err := uuid.Parse(id)
+	if err != nil {
+		return database.Video{}, status.Error(codes.InvalidArgument, "Invalid video ID")
+	}
+	video, err := s.cfg.db.GetVideo(ctx, videoID)
+	if err != nil {
+		return database.Video{}, grpcInternal(ctx, "Couldn't get video", err)
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil {
+		return database.Video{}, status.Error(codes.NotFound, "Video not found")
+	}
+	if !s.cfg.canEditVideo(ctx, video, grpcUserID(ctx)) {
+		return database.Video{}, status.Error(codes.PermissionDenied, "You can't edit this video")
+	}
+	return video, nil
+}
+
+func (s *grpcVideoService) CreateVideo(ctx context.Context, req *tubelyv1.CreateVideoRequest) (*tubelyv1.Video, error) {
+	userID := grpcUserID(ctx)
+	if err := s.checkAccount(ctx, userID); err != nil {
+		return nil, err
+	}
+	quota, err := s.cfg.quotaStatus(ctx, userID)
+	if err != nil {
+		return nil, grpcInternal(ctx, "Couldn't get quota", err)
+	}
+	if quota.dailyVideosExhausted() {
+		return nil, status.Error(codes.ResourceExhausted, "You've reached your daily video limit")
+	}
+	visibility, err := visibilityFromProto(req.Visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	video, err := s.cfg.db.CreateVideo(ctx, database.CreateVideoParams{
+		Title:       req.Title,
+		Description: req.Description,
+		UserID:      userID,
+		Visibility:  visibility,
+	})
+	if err != nil {
+		return nil, grpcInternal(ctx, "Couldn't create video", err)
+	}
+	s.cfg.publishEvent(ctx, userID, eventVideoCreated, video)
+	return videoToProto(video), nil
+}
+
+func (s *grpcVideoService) GetVideo(ctx context.Context, req *tubelyv1.GetVideoRequest) (*tubelyv1.Video, error) {
+	videoID, err := uuid.Parse(req.Id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid video ID")
+	}
+	video, err := s.cfg.db.GetVideo(ctx, videoID)
+	if err != nil {
+		return nil, grpcInternal(ctx, "Couldn't get video", err)
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !s.cfg.canViewVideo(ctx, video, grpcUserID(ctx)) {
+		return nil, status.Error(codes.NotFound, "Video not found")
+	}
+	return videoToProto(video), nil
+}
+
+// ListVideos lists the caller's videos, newest first. Page tokens are the
+// same cursors the HTTP API puts in its Link header.
+func (s *grpcVideoService) ListVideos(ctx context.Context, req *tubelyv1.ListVideosRequest) (*tubelyv1.ListVideosResponse, error) {
+	params := database.ListVideosParams{
+		UserID: grpcUserID(ctx),
+		Limit:  defaultPageLimit,
+	}
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+	if req.PageSize > 0 {
+		params.Limit = min(int(req.PageSize), maxPageLimit)
+	}
+	if req.PageToken != "" {
+		cursor, err := decodeCursor(req.PageToken)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Invalid page token")
+		}
+		params.After = &cursor
+	}
+
+	videos, more, err := s.cfg.db.ListVideos(ctx, params)
+	if err != nil {
+		return nil, grpcInternal(ctx, "Couldn't retrieve videos", err)
+	}
+	resp := &tubelyv1.ListVideosResponse{Videos: make([]*tubelyv1.Video, 0, len(videos))}
+	for _, video := range videos {
+		resp.Videos = append(resp.Videos, videoToProto(video))
+	}
+	if more && len(videos) > 0 {
+		resp.NextPageToken = encodeCursor(videos[len(videos)-1].Cursor())
+	}
+	return resp, nil
+}
+
+func (s *grpcVideoService) UpdateVideo(ctx context.Context, req *tubelyv1.UpdateVideoRequest) (*tubelyv1.Video, error) {
+	params := database.UpdateVideoMetadataParams{
+		Title:       req.Title,
+		Description: req.Description,
+	}
+	if params.Title != nil && (*params.Title == "" || len(*params.Title) > maxTitleLength) {
+		return nil, status.Error(codes.InvalidArgument, "title must be 1 to 200 characters")
+	}
+	if params.Description != nil && len(*params.Description) > maxDescriptionLength {
+		return nil, status.Error(codes.InvalidArgument, "description is too long")
+	}
+	if req.Visibility != tubelyv1.Visibility_VISIBILITY_UNSPECIFIED {
+		visibility, err := visibilityFromProto(req.Visibility)
+		if err != nil {
+			return nil, err
+		}
+		params.Visibility = &visibility
+	}
+	if req.ReplaceTags {
+		if len(req.Tags) > maxTagsPerVideo {
+			return nil, status.Error(codes.InvalidArgument, "tags has too many entries")
+		}
+		tags := make([]string, 0, len(req.Tags))
+		for _, tag := range req.Tags {
+			normalized, err := normalizeTag(tag)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			tags = append(tags, normalized)
+		}
+		params.Tags = &tags
+	}
+
+	video, err := s.editableVideo(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if params.Visibility != nil && video.TakenDownAt != nil {
+		return nil, status.Error(codes.FailedPrecondition, "Visibility can't be changed on a video that was taken down")
+	}
+	params.Version = &video.Version
+
+	err = s.cfg.db.UpdateVideoMetadata(ctx, video.ID, params)
+	if errors.Is(err, database.ErrVideoConflict) {
+		return nil, status.Error(codes.Aborted, "Video was modified by another request")
+	}
+	if err != nil {
+		return nil, grpcInternal(ctx, "Couldn't update video", err)
+	}
+	video, err = s.cfg.db.GetVideo(ctx, video.ID)
+	if err != nil {
+		return nil, grpcInternal(ctx, "Couldn't get video", err)
+	}
+	go s.cfg.notifySubscribers(context.WithoutCancel(ctx), video)
+	return videoToProto(video), nil
+}
+
+func (s *grpcVideoService) DeleteVideo(ctx context.Context, req *tubelyv1.DeleteVideoRequest) (*tubelyv1.DeleteVideoResponse, error) {
+	video, err := s.editableVideo(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if underRetention(video) {
+		return nil, status.Error(codes.FailedPrecondition, "Video can't be deleted until its retention ends")
+	}
+	if err := s.cfg.db.SoftDeleteVideo(ctx, video.ID); err != nil {
+		return nil, grpcInternal(ctx, "Couldn't delete video", err)
+	}
+	s.cfg.sitemap.invalidate()
+	s.cfg.publishEvent(ctx, video.UserID, eventVideoDeleted, video)
+	return &tubelyv1.DeleteVideoResponse{}, nil
+}
+
+// UploadVideo spools a streamed MP4 to the uploads directory and queues it
+// for processing, as POST /api/video_upload does with a multipart upload.
+func (s *grpcVideoService) UploadVideo(stream grpc.ClientStreamingServer[tubelyv1.UploadVideoRequest, tubelyv1.Video]) error {
+	ctx := stream.Context()
+	cfg := s.cfg
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	header := first.GetHeader()
+	if header == nil {
+		return status.Error(codes.InvalidArgument, "the first message must carry the header")
+	}
+	if header.ContentType != "video/mp4" {
+		return status.Error(codes.InvalidArgument, "only video/mp4 mimetype accepted")
+	}
+	if header.SizeBytes > cfg.maxVideoUploadBytes {
+		return status.Errorf(codes.ResourceExhausted, "Video is larger than the %d byte limit", cfg.maxVideoUploadBytes)
+	}
+
+	video, err := s.editableVideo(ctx, header.VideoId)
+	if err != nil {
+		return err
+	}
+	userID := grpcUserID(ctx)
+	if err := s.checkAccount(ctx, userID); err != nil {
+		return err
+	}
+	if video.Status == database.VideoStatusLive {
+		return status.Error(codes.FailedPrecondition, videoLiveMessage)
+	}
+
+	// Uploads count against the video owner's storage. A re-upload replaces
+	// the current file, so its size is available again.
+	quota, err := cfg.quotaStatus(ctx, video.UserID)
+	if err != nil {
+		return grpcInternal(ctx, "unable to get quota", err)
+	}
+	storageRemaining := quota.storageRemaining()
+	if storageRemaining >= 0 && video.SizeBytes != nil {
+		storageRemaining += *video.SizeBytes
+	}
+	if storageRemaining == 0 {
+		return status.Error(codes.ResourceExhausted, "storage quota exceeded")
+	}
+	limit := cfg.maxVideoUploadBytes
+	if storageRemaining >= 0 && storageRemaining < limit {
+		limit = storageRemaining
+	}
+
+	if err := cfg.db.SetVideoStatus(ctx, video.ID, database.VideoStatusProcessing); err != nil {
+		return grpcInternal(ctx, "unable to update video status", err)
+	}
+	queued := false
+	hadVideo := video.VideoURL != nil
+	defer func() {
+		if queued {
+			return
+		}
+		// A failed re-upload leaves the previous file in place.
+		videoStatus := database.VideoStatusFailed
+		if hadVideo {
+			videoStatus = database.VideoStatusReady
+		}
+		if err := cfg.db.SetVideoStatus(context.WithoutCancel(ctx), video.ID, videoStatus); err != nil {
+			slog.ErrorContext(ctx, "Couldn't reset video status", "video_id", video.ID, "error", err)
+		}
+	}()
+
+	sourceFile, err := os.CreateTemp(cfg.uploadsRoot, "upload-*.mp4")
+	if err != nil {
+		return grpcInternal(ctx, "unable to create temp file", err)
+	}
+	defer sourceFile.Close()
+	defer func() {
+		if !queued {
+			os.Remove(sourceFile.Name())
+		}
+	}()
+
+	var size int64
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		chunk := msg.GetChunk()
+		if msg.GetHeader() != nil {
+			return status.Error(codes.InvalidArgument, "only the first message may carry the header")
+		}
+		size += int64(len(chunk))
+		if size > limit {
+			if limit < cfg.maxVideoUploadBytes {
+				return status.Error(codes.ResourceExhausted, "upload would exceed storage quota")
+			}
+			return status.Errorf(codes.ResourceExhausted, "Video is larger than the %d byte limit", cfg.maxVideoUploadBytes)
+		}
+		if _, err := sourceFile.Write(chunk); err != nil {
+			return grpcInternal(ctx, "unable to copy file", err)
+		}
+	}
+	if size == 0 {
+		return status.Error(codes.InvalidArgument, "the upload has no file bytes")
+	}
+	cfg.metrics.uploadSize.Observe(float64(size), "video")
+	if err := sourceFile.Close(); err != nil {
+		return grpcInternal(ctx, "unable to copy file", err)
+	}
+
+	if cfg.virusScanner != nil {
+		spooled, err := os.Open(sourceFile.Name())
+		if err != nil {
+			return grpcInternal(ctx, "unable to read file", err)
+		}
+		signature, err := cfg.virusScanner.Scan(ctx, spooled)
+		spooled.Close()
+		if err != nil {
+			return grpcError(ctx, codes.Unavailable, "Couldn't scan file for viruses", err)
+		}
+		if err := cfg.recordVirusScan(ctx, video.ID, signature); err != nil {
+			return grpcInternal(ctx, "Couldn't record virus scan", err)
+		}
+		if signature != "" {
+			slog.WarnContext(ctx, "Rejected infected upload", "video_id", video.ID, "signature", signature)
+			return status.Errorf(codes.InvalidArgument, "File is infected: %s", signature)
+		}
+	}
+
+	_, err = cfg.db.CreateJob(ctx, database.CreateJobParams{
+		Type:        jobTypeProcessVideo,
+		VideoID:     &video.ID,
+		Payload:     processVideoPayload{SourcePath: sourceFile.Name(), HadVideo: hadVideo, ContainerProfile: cfg.defaultContainerProfile},
+		MaxAttempts: cfg.jobMaxAttempts,
+	})
+	if err != nil {
+		return grpcInternal(ctx, "unable to queue processing", err)
+	}
+	queued = true
+
+	video, err = cfg.db.GetVideo(ctx, video.ID)
+	if err != nil {
+		return grpcInternal(ctx, "unable to get video", err)
+	}
+	return stream.SendAndClose(videoToProto(video))
+}
+
+// grpcInternal logs err and hides it from the caller, as respondWithError
+// does for 5xx responses.
+func grpcInternal(ctx context.Context, msg string, err error) error {
+	return grpcError(ctx, codes.Internal, msg, err)
+}
+
+func grpcError(ctx context.Context, code codes.Code, msg string, err error) error {
+	slog.ErrorContext(ctx, msg, "error", err)
+	return status.Error(code, msg)
+}
+
+func visibilityFromProto(v tubelyv1.Visibility) (database.Visibility, error) {
+	switch v {
+	case tubelyv1.Visibility_VISIBILITY_UNSPECIFIED:
+		return "", nil
+	case tubelyv1.Visibility_VISIBILITY_PUBLIC:
+		return database.VisibilityPublic, nil
+	case tubelyv1.Visibility_VISIBILITY_UNLISTED:
+		return database.VisibilityUnlisted, nil
+	case tubelyv1.Visibility_VISIBILITY_PRIVATE:
+		return database.VisibilityPrivate, nil
+	}
+	return "", status.Error(codes.InvalidArgument, "Visibility must be public, unlisted, or private")
+}
+
+func visibilityToProto(v database.Visibility) tubelyv1.Visibility {
+	switch v {
+	case database.VisibilityPublic:
+		return tubelyv1.Visibility_VISIBILITY_PUBLIC
+	case database.VisibilityUnlisted:
+		return tubelyv1.Visibility_VISIBILITY_UNLISTED
+	case database.VisibilityPrivate:
+		return tubelyv1.Visibility_VISIBILITY_PRIVATE
+	}
+	return tubelyv1.Visibility_VISIBILITY_UNSPECIFIED
+}
+
+func videoToProto(video database.Video) *tubelyv1.Video {
+	v := &tubelyv1.Video{
+		Id:              video.ID.String(),
+		UserId:          video.UserID.String(),
+		Title:           video.Title,
+		Description:     video.Description,
+		Visibility:      visibilityToProto(video.Visibility),
+		Tags:            video.Tags,
+		ThumbnailUrl:    video.ThumbnailURL,
+		VideoUrl:        video.VideoURL,
+		DurationSeconds: video.DurationSeconds,
+		FrameRate:       video.FrameRate,
+		SizeBytes:       video.SizeBytes,
+		CreatedAt:       timestamppb.New(video.CreatedAt),
+		UpdatedAt:       timestamppb.New(video.UpdatedAt),
+	}
+	if video.Width != nil {
+		width := int32(*video.Width)
+		v.Width = &width
+	}
+	if video.Height != nil {
+		height := int32(*video.Height)
+		v.Height = &height
+	}
+	return v
+}
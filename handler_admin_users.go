@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// handlerAdminUsersList lists users with their storage and video counts.
+// ?q= searches by email.
+func (cfg *apiConfig) handlerAdminUsersList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	users, err := cfg.db.ListUsers(r.Context(), r.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list users", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+func (cfg *apiConfig) handlerAdminUserGet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	user, err := cfg.db.GetAdminUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+func (cfg *apiConfig) handlerAdminUserSuspend(w http.ResponseWriter, r *http.Request) {
+	cfg.adminUserAction(w, r, "user.suspend", cfg.db.SuspendUser)
+}
+
+func (cfg *apiConfig) handlerAdminUserUnsuspend(w http.ResponseWriter, r *http.Request) {
+	cfg.adminUserAction(w, r, "user.unsuspend", cfg.db.UnsuspendUser)
+}
+
+// handlerAdminUserPasswordReset makes the user choose a new password at
+// their next sign-in and ends their sessions.
+func (cfg *apiConfig) handlerAdminUserPasswordReset(w http.ResponseWriter, r *http.Request) {
+	cfg.adminUserAction(w, r, "user.password_reset", cfg.db.RequirePasswordReset)
+}
+
+// adminUserAction applies an account change to the user in the path, audits
+// it, and responds with the updated user.
+func (cfg *apiConfig) adminUserAction(w http.ResponseWriter, r *http.Request, action string, apply func(context.Context, uuid.UUID) error) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	user, err := cfg.db.GetAdminUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", nil)
+		return
+	}
+
+	if err := apply(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, action, "user", userID.String(), nil)
+
+	user, err = cfg.db.GetAdminUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user)
+}
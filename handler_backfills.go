@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerBackfillCreate starts reprocessing every video with the current
+// pipeline. Only one backfill can be active at a time.
+func (cfg *apiConfig) handlerBackfillCreate(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	active, err := cfg.db.GetActiveBackfill(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get active backfill", err)
+		return
+	}
+	if active != nil {
+		respondWithError(w, http.StatusConflict, "A backfill is already "+string(active.Status), nil)
+		return
+	}
+
+	backfill, err := cfg.db.CreateBackfill(r.Context(), adminID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start backfill", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "backfill.start", "backfill", backfill.ID.String(), map[string]any{"total": backfill.Total})
+	respondWithJSON(w, http.StatusCreated, backfill)
+}
+
+func (cfg *apiConfig) handlerBackfillsList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	backfills, err := cfg.db.ListBackfills(r.Context(), limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list backfills", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, backfills)
+}
+
+// handlerBackfillGet reports a backfill's progress.
+func (cfg *apiConfig) handlerBackfillGet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	backfill, ok := cfg.adminBackfill(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, backfill)
+}
+
+// handlerBackfillPause stops a backfill queueing more videos. Those already
+// queued still run.
+func (cfg *apiConfig) handlerBackfillPause(w http.ResponseWriter, r *http.Request) {
+	cfg.backfillTransition(w, r, "backfill.pause", []database.BackfillStatus{database.BackfillRunning}, database.BackfillPaused)
+}
+
+// handlerBackfillResume continues a paused backfill from the last video it
+// queued.
+func (cfg *apiConfig) handlerBackfillResume(w http.ResponseWriter, r *http.Request) {
+	cfg.backfillTransition(w, r, "backfill.resume", []database.BackfillStatus{database.BackfillPaused}, database.BackfillRunning)
+}
+
+// handlerBackfillCancel ends a backfill. Its queued videos are skipped.
+func (cfg *apiConfig) handlerBackfillCancel(w http.ResponseWriter, r *http.Request) {
+	cfg.backfillTransition(w, r, "backfill.cancel", []database.BackfillStatus{database.BackfillRunning, database.BackfillPaused}, database.BackfillCancelled)
+}
+
+// backfillTransition moves the backfill in the path from any of the from
+// statuses to to, audits it, and responds with the backfill.
+func (cfg *apiConfig) backfillTransition(w http.ResponseWriter, r *http.Request, action string, from []database.BackfillStatus, to database.BackfillStatus) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	backfill, ok := cfg.adminBackfill(w, r)
+	if !ok {
+		return
+	}
+
+	moved := false
+	for _, status := range from {
+		var err error
+		moved, err = cfg.db.SetBackfillStatus(r.Context(), backfill.ID, status, to)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update backfill", err)
+			return
+		}
+		if moved {
+			break
+		}
+	}
+	if !moved {
+		respondWithError(w, http.StatusConflict, "Backfill is "+string(backfill.Status), nil)
+		return
+	}
+	cfg.audit(r.Context(), adminID, action, "backfill", backfill.ID.String(), nil)
+
+	updated, err := cfg.db.GetBackfill(r.Context(), backfill.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get backfill", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// adminBackfill loads the backfill named in the path, writing an error
+// response if it can't.
+func (cfg *apiConfig) adminBackfill(w http.ResponseWriter, r *http.Request) (database.Backfill, bool) {
+	backfillID, err := uuid.Parse(r.PathValue("backfillID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Backfill{}, false
+	}
+	backfill, err := cfg.db.GetBackfill(r.Context(), backfillID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get backfill", err)
+		return database.Backfill{}, false
+	}
+	if backfill == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get backfill", nil)
+		return database.Backfill{}, false
+	}
+	return *backfill, true
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+func (cfg *apiConfig) handlerBackupCreate(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	backup, err := cfg.backupDatabase(r.Context())
+	if errors.Is(err, errBackupKeyMissing) {
+		respondWithError(w, http.StatusNotImplemented, "Backups need BACKUP_ENCRYPTION_KEY", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't back up database", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "backup.create", "backup", backup.Key, nil)
+	respondWithJSON(w, http.StatusCreated, backup)
+}
+
+func (cfg *apiConfig) handlerBackupsList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	backups, err := listBackups(r.Context(), cfg.s3Client, cfg.s3Bucket)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list backups", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, backups)
+}
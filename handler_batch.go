@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxBatchSize = 100
+
+type batchOperation string
+
+const (
+	batchOperationDelete        batchOperation = "delete"
+	batchOperationSetVisibility batchOperation = "set_visibility"
+	batchOperationAddTag        batchOperation = "add_tag"
+)
+
+type batchResult struct {
+	VideoID uuid.UUID `json:"video_id"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+func (cfg *apiConfig) handlerVideosBatch(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoIDs   []uuid.UUID         `json:"video_ids"`
+		Operation  batchOperation      `json:"operation"`
+		Visibility database.Visibility `json:"visibility"`
+		Tag        string              `json:"tag"`
+	}
+	type response struct {
+		Results []batchResult `json:"results"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if len(params.VideoIDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "video_ids is required", nil)
+		return
+	}
+	if len(params.VideoIDs) > maxBatchSize {
+		respondWithError(w, http.StatusBadRequest, "Too many videos in one batch", nil)
+		return
+	}
+
+	var change database.BatchVideoChange
+	switch params.Operation {
+	case batchOperationDelete:
+		change.Delete = true
+	case batchOperationSetVisibility:
+		if !params.Visibility.Valid() {
+			respondWithError(w, http.StatusBadRequest, "Visibility must be public, unlisted, or private", nil)
+			return
+		}
+		change.Visibility = &params.Visibility
+	case batchOperationAddTag:
+		tag, err := normalizeTag(params.Tag)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		change.Tag = &tag
+	default:
+		respondWithError(w, http.StatusBadRequest, "Unknown batch operation", nil)
+		return
+	}
+
+	results := make([]batchResult, 0, len(params.VideoIDs))
+	for _, videoID := range params.VideoIDs {
+		result := batchResult{VideoID: videoID}
+
+		video, err := cfg.db.GetVideo(r.Context(), videoID)
+		switch {
+		case err != nil:
+			result.Error = "couldn't get video"
+		case video.ID == uuid.Nil || video.DeletedAt != nil:
+			result.Error = "video not found"
+		case !cfg.canEditVideo(r.Context(), video, userID):
+			result.Error = "you can't edit this video"
+		default:
+			// The takedown and retention checks happen inside the item's
+			// transaction, so they see the video as it is when written.
+			err := cfg.db.ApplyBatchVideoChange(r.Context(), videoID, change)
+			switch {
+			case errors.Is(err, database.ErrVideoNotFound):
+				result.Error = "video not found"
+			case errors.Is(err, database.ErrVideoTakenDown):
+				result.Error = "video was taken down"
+			case errors.Is(err, database.ErrVideoRetained):
+				result.Error = "video is under retention"
+			case errors.Is(err, database.ErrVideoConflict):
+				result.Error = "video was modified by another request"
+			case err != nil:
+				slog.ErrorContext(r.Context(), "Batch operation failed", "operation", params.Operation, "video_id", videoID, "error", err)
+				result.Error = "operation failed"
+			default:
+				result.Success = true
+				if params.Operation == batchOperationSetVisibility {
+					video.Visibility = params.Visibility
+					go cfg.notifySubscribers(context.WithoutCancel(r.Context()), video)
+				}
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	respondWithJSON(w, http.StatusOK, response{Results: results})
+}
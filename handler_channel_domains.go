@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerChannelDomainGet(w http.ResponseWriter, r *http.Request) {
+	channel, _, ok := cfg.getChannelWithRole(w, r, database.ChannelRoleViewer)
+	if !ok {
+		return
+	}
+	d, err := cfg.db.GetChannelDomain(r.Context(), channel.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel domain", err)
+		return
+	}
+	if d == nil {
+		respondWithError(w, http.StatusNotFound, "Channel has no custom domain", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, d)
+}
+
+// handlerChannelDomainSet points a custom domain at a channel. The domain
+// stays pending until the channel proves it controls it with a TXT record
+// holding the returned verification token; see handlerChannelDomainVerify.
+func (cfg *apiConfig) handlerChannelDomainSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Domain string `json:"domain"`
+	}
+
+	channel, _, ok := cfg.getChannelWithRole(w, r, database.ChannelRoleAdmin)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(params.Domain), "."))
+	if !cfg.validChannelDomain(domain) {
+		respondWithError(w, http.StatusBadRequest, "domain must be a host name such as videos.example.com", nil)
+		return
+	}
+
+	previous, err := cfg.db.GetChannelDomain(r.Context(), channel.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel domain", err)
+		return
+	}
+	// Domains pending from before verification existed have no token, and
+	// get one by being set again.
+	if previous != nil && previous.Domain == domain && (previous.VerificationToken != "" || previous.DNSVerifiedAt != nil) {
+		respondWithJSON(w, http.StatusOK, previous)
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate verification token", err)
+		return
+	}
+	d, err := cfg.db.SetChannelDomain(r.Context(), channel.ID, domain, "tubely-verification="+hex.EncodeToString(buf))
+	if errors.Is(err, database.ErrChannelDomainTaken) {
+		respondWithError(w, http.StatusConflict, "Domain is used by another channel", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set channel domain", err)
+		return
+	}
+	if previous != nil {
+		cfg.channelDomains.invalidate(previous.Domain)
+		if cfg.certs != nil {
+			cfg.certs.forgetDomain(previous.Domain)
+		}
+	}
+	cfg.channelDomains.invalidate(domain)
+
+	respondWithJSON(w, http.StatusOK, d)
+}
+
+// handlerChannelDomainVerify looks for the domain's verification token in a
+// TXT record at _tubely-verification.<domain>. Once it's found the domain is
+// served straight away, or when the server gets its own certificates, once
+// one is issued for it, which needs its DNS to point at the server already.
+func (cfg *apiConfig) handlerChannelDomainVerify(w http.ResponseWriter, r *http.Request) {
+	channel, _, ok := cfg.getChannelWithRole(w, r, database.ChannelRoleAdmin)
+	if !ok {
+		return
+	}
+	d, err := cfg.db.GetChannelDomain(r.Context(), channel.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel domain", err)
+		return
+	}
+	if d == nil {
+		respondWithError(w, http.StatusNotFound, "Channel has no custom domain", nil)
+		return
+	}
+	if d.DNSVerifiedAt != nil {
+		respondWithJSON(w, http.StatusOK, d)
+		return
+	}
+
+	record := channelDomainVerificationRecord(d.Domain)
+	if d.VerificationToken == "" || !lookupChannelDomainToken(r.Context(), record, d.VerificationToken) {
+		respondWithErrorCode(w, http.StatusConflict, errCodeDomainNotVerified, "Couldn't find the verification TXT record", nil, map[string]any{
+			"record": record,
+			"value":  d.VerificationToken,
+		})
+		return
+	}
+	if err := cfg.db.MarkChannelDomainDNSVerified(r.Context(), d.Domain); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify channel domain", err)
+		return
+	}
+	if cfg.certs != nil {
+		go cfg.issueChannelDomainCert(context.WithoutCancel(r.Context()), d.Domain)
+	} else if err := cfg.db.SetChannelDomainStatus(r.Context(), d.Domain, database.ChannelDomainActive, ""); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't activate channel domain", err)
+		return
+	}
+	cfg.channelDomains.invalidate(d.Domain)
+
+	d, err = cfg.db.GetChannelDomain(r.Context(), channel.ID)
+	if err != nil || d == nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel domain", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, d)
+}
+
+func (cfg *apiConfig) handlerChannelDomainDelete(w http.ResponseWriter, r *http.Request) {
+	channel, _, ok := cfg.getChannelWithRole(w, r, database.ChannelRoleAdmin)
+	if !ok {
+		return
+	}
+	d, err := cfg.db.GetChannelDomain(r.Context(), channel.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel domain", err)
+		return
+	}
+	if d == nil {
+		respondWithError(w, http.StatusNotFound, "Channel has no custom domain", nil)
+		return
+	}
+	if err := cfg.db.DeleteChannelDomain(r.Context(), channel.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove channel domain", err)
+		return
+	}
+	cfg.channelDomains.invalidate(d.Domain)
+	if cfg.certs != nil {
+		cfg.certs.forgetDomain(d.Domain)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// channelPageTemplate is a channel's public page, served at the root of its
+// custom domain.
+var channelPageTemplate = template.Must(template.New("channel").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<link rel="alternate" type="application/rss+xml" title="{{.Name}}" href="{{.FeedURL}}">
+<style>
+body { margin: 0 auto; max-width: 1100px; padding: 1.5rem; font-family: system-ui, sans-serif; }
+ul { list-style: none; padding: 0; display: grid; grid-template-columns: repeat(auto-fill, minmax(240px, 1fr)); gap: 1.5rem; }
+img { width: 100%; aspect-ratio: 16 / 9; object-fit: cover; background: #ddd; }
+a { color: inherit; text-decoration: none; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<ul>
+{{range .Videos}}<li><a href="{{.EmbedURL}}">{{if .ThumbnailURL}}<img src="{{.ThumbnailURL}}" alt="">{{end}}<h2>{{.Title}}</h2></a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+type channelPageData struct {
+	Name        string
+	Description string
+	FeedURL     string
+	Videos      []channelPageVideo
+}
+
+type channelPageVideo struct {
+	Title        string
+	EmbedURL     string
+	ThumbnailURL string
+}
+
+// handlerChannelPage renders a channel's latest public videos as HTML,
+// linking to their embed players.
+func (cfg *apiConfig) handlerChannelPage(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(r.PathValue("channelID"))
+	if err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+	channel, err := cfg.db.GetChannel(r.Context(), channelID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't get channel", "channel_id", channelID, "error", err)
+		http.Error(w, "Couldn't get channel", http.StatusInternalServerError)
+		return
+	}
+	if channel.ID == uuid.Nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	videos, _, err := cfg.db.ListVideos(r.Context(), database.ListVideosParams{
+		ChannelID:  channel.ID,
+		PublicOnly: true,
+		Status:     database.VideoStatusReady,
+		Limit:      feedItemLimit,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't list channel videos", "channel_id", channelID, "error", err)
+		http.Error(w, "Couldn't get videos", http.StatusInternalServerError)
+		return
+	}
+
+	baseURL := cfg.publicBaseURL(r)
+	data := channelPageData{
+		Name:        channel.Name,
+		Description: channel.Description,
+		FeedURL:     baseURL + apiVersionPrefix + "/channels/" + channel.ID.String() + "/feed.rss",
+		Videos:      []channelPageVideo{},
+	}
+	if _, ok := channelHostFromContext(r.Context()); ok {
+		data.FeedURL = baseURL + "/feed.rss"
+	}
+	for _, video := range videos {
+		v := channelPageVideo{Title: video.Title, EmbedURL: baseURL + "/embed/" + video.ID.String()}
+		if video.ThumbnailURL != nil {
+			v.ThumbnailURL = *video.ThumbnailURL
+		}
+		data.Videos = append(data.Videos, v)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := channelPageTemplate.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't render channel page", "channel_id", channelID, "error", err)
+	}
+}
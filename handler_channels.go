@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// getChannelWithRole loads the channel named in the path and checks that the
+// authenticated user has at least the given role in it, writing an error
+// response if not.
+func (cfg *apiConfig) getChannelWithRole(w http.ResponseWriter, r *http.Request, min database.ChannelRole) (database.Channel, uuid.UUID, bool) {
+	channelID, err := uuid.Parse(r.PathValue("channelID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID", err)
+		return database.Channel{}, uuid.Nil, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Channel{}, uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Channel{}, uuid.Nil, false
+	}
+
+	role, err := cfg.db.GetChannelRole(r.Context(), channelID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel membership", err)
+		return database.Channel{}, uuid.Nil, false
+	}
+	if role == "" {
+		respondWithError(w, http.StatusNotFound, "Channel not found", nil)
+		return database.Channel{}, uuid.Nil, false
+	}
+	if !role.AtLeast(min) {
+		respondWithError(w, http.StatusForbidden, "Your channel role doesn't allow this", nil)
+		return database.Channel{}, uuid.Nil, false
+	}
+
+	channel, err := cfg.db.GetChannel(r.Context(), channelID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel", err)
+		return database.Channel{}, uuid.Nil, false
+	}
+	return channel, userID, true
+}
+
+func (cfg *apiConfig) handlerChannelCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required", nil)
+		return
+	}
+
+	channel, err := cfg.db.CreateChannel(r.Context(), database.CreateChannelParams{
+		Name:        params.Name,
+		Description: params.Description,
+		OwnerID:     userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create channel", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, channel)
+}
+
+func (cfg *apiConfig) handlerChannelsList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	channels, err := cfg.db.GetChannelsForUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve channels", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, channels)
+}
+
+func (cfg *apiConfig) handlerChannelGet(w http.ResponseWriter, r *http.Request) {
+	channel, _, ok := cfg.getChannelWithRole(w, r, database.ChannelRoleViewer)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, channel)
+}
+
+func (cfg *apiConfig) handlerChannelMembersList(w http.ResponseWriter, r *http.Request) {
+	channel, _, ok := cfg.getChannelWithRole(w, r, database.ChannelRoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := cfg.db.GetChannelMembers(r.Context(), channel.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve members", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, members)
+}
+
+func (cfg *apiConfig) handlerChannelMemberSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string               `json:"email"`
+		Role  database.ChannelRole `json:"role"`
+	}
+
+	channel, userID, ok := cfg.getChannelWithRole(w, r, database.ChannelRoleAdmin)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !params.Role.Valid() || params.Role == database.ChannelRoleOwner {
+		respondWithError(w, http.StatusBadRequest, "Role must be admin, editor, or viewer", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "No user with that email", nil)
+		return
+	}
+	if user.ID == userID {
+		respondWithError(w, http.StatusBadRequest, "You can't change your own role", nil)
+		return
+	}
+
+	currentRole, err := cfg.db.GetChannelRole(r.Context(), channel.ID, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel membership", err)
+		return
+	}
+	if currentRole == database.ChannelRoleOwner {
+		respondWithError(w, http.StatusForbidden, "The channel owner's role can't be changed", nil)
+		return
+	}
+
+	err = cfg.db.SetChannelMember(r.Context(), channel.ID, user.ID, params.Role)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update channel member", err)
+		return
+	}
+
+	members, err := cfg.db.GetChannelMembers(r.Context(), channel.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve members", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, members)
+}
+
+func (cfg *apiConfig) handlerChannelMemberRemove(w http.ResponseWriter, r *http.Request) {
+	channel, _, ok := cfg.getChannelWithRole(w, r, database.ChannelRoleAdmin)
+	if !ok {
+		return
+	}
+
+	memberID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	role, err := cfg.db.GetChannelRole(r.Context(), channel.ID, memberID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel membership", err)
+		return
+	}
+	if role == database.ChannelRoleOwner {
+		respondWithError(w, http.StatusForbidden, "The channel owner can't be removed", nil)
+		return
+	}
+
+	err = cfg.db.RemoveChannelMember(r.Context(), channel.ID, memberID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove channel member", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
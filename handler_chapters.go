@@ -0,0 +1,429 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxChapters           = 100
+	maxChapterTitleLength = 100
+	// hlsChaptersDataID is the session data ID Apple's players read chapters
+	// from.
+	hlsChaptersDataID = "com.apple.hls.chapters"
+)
+
+func (cfg *apiConfig) handlerChaptersGet(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getPlayableVideo(w, r)
+	if !ok {
+		return
+	}
+	chapters, err := cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chapters", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chapters)
+}
+
+// handlerChaptersSet replaces a video's chapters. They're sorted by start
+// time, which must be unique and inside the video.
+func (cfg *apiConfig) handlerChaptersSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Chapters []database.Chapter `json:"chapters"`
+	}
+
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	chapters, msg := normalizeChapters(params.Chapters, video.DurationSeconds)
+	if msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	if err := cfg.db.SetChapters(r.Context(), video.ID, chapters); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set chapters", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chapters)
+}
+
+func (cfg *apiConfig) handlerChaptersDelete(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.db.SetChapters(r.Context(), video.ID, nil); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove chapters", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerChapterSuggestionsGet lists the chapters suggested from a video's
+// transcript, which only the owner sees until they're published.
+func (cfg *apiConfig) handlerChapterSuggestionsGet(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	chapters, err := cfg.db.GetChapterSuggestions(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chapter suggestions", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chapters)
+}
+
+// handlerChapterSuggestionsCreate queues new chapter suggestions from a
+// video's transcript, replacing any waiting for review when they're ready.
+func (cfg *apiConfig) handlerChapterSuggestionsCreate(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if cfg.chapterSuggester == nil {
+		respondWithError(w, http.StatusNotImplemented, "Chapter suggestions are off", nil)
+		return
+	}
+	cues, err := cfg.db.GetTranscript(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get transcript", err)
+		return
+	}
+	if len(cues) == 0 {
+		respondWithError(w, http.StatusConflict, "Video has no transcript", nil)
+		return
+	}
+	if err := cfg.queueChapterSuggestions(r.Context(), video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue chapter suggestions", err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handlerChapterSuggestionsPublish replaces a video's chapters with the
+// suggested ones. Owners can edit suggestions first by publishing them
+// with PUT .../chapters instead.
+func (cfg *apiConfig) handlerChapterSuggestionsPublish(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	suggested, err := cfg.db.GetChapterSuggestions(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chapter suggestions", err)
+		return
+	}
+	if len(suggested) == 0 {
+		respondWithError(w, http.StatusNotFound, "Video has no chapter suggestions", nil)
+		return
+	}
+	if err := cfg.db.PublishChapterSuggestions(r.Context(), video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't publish chapter suggestions", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, suggested)
+}
+
+func (cfg *apiConfig) handlerChapterSuggestionsDelete(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.db.SetChapterSuggestions(r.Context(), video.ID, nil); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't discard chapter suggestions", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeChapters trims and sorts chapters, returning a message saying
+// what's wrong if they aren't valid for a video of the given duration.
+func normalizeChapters(chapters []database.Chapter, durationSeconds *float64) ([]database.Chapter, string) {
+	if len(chapters) > maxChapters {
+		return nil, fmt.Sprintf("A video can have at most %d chapters", maxChapters)
+	}
+	normalized := make([]database.Chapter, len(chapters))
+	for i, ch := range chapters {
+		ch.Title = strings.TrimSpace(ch.Title)
+		if ch.Title == "" || utf8.RuneCountInString(ch.Title) > maxChapterTitleLength || strings.ContainsAny(ch.Title, "\r\n") {
+			return nil, fmt.Sprintf("Chapter titles must be one line of 1 to %d characters", maxChapterTitleLength)
+		}
+		if ch.StartSeconds < 0 || (durationSeconds != nil && ch.StartSeconds >= *durationSeconds) {
+			return nil, "Chapters must start inside the video"
+		}
+		normalized[i] = ch
+	}
+	slices.SortFunc(normalized, func(a, b database.Chapter) int {
+		switch {
+		case a.StartSeconds < b.StartSeconds:
+			return -1
+		case a.StartSeconds > b.StartSeconds:
+			return 1
+		}
+		return 0
+	})
+	for i := 1; i < len(normalized); i++ {
+		if normalized[i].StartSeconds == normalized[i-1].StartSeconds {
+			return nil, "Chapters must start at different times"
+		}
+	}
+	return normalized, ""
+}
+
+// chapterEnd is when the i'th chapter ends: the next one's start, the end
+// of the video, or nil for the last chapter of a video whose duration isn't
+// known.
+func chapterEnd(chapters []database.Chapter, i int, durationSeconds *float64) *float64 {
+	if i+1 < len(chapters) {
+		return &chapters[i+1].StartSeconds
+	}
+	return durationSeconds
+}
+
+// getPlayableVideo gets the video in the request's path if the viewer may
+// play it in their region, writing an error response if not.
+func (cfg *apiConfig) getPlayableVideo(w http.ResponseWriter, r *http.Request) (database.Video, uuid.UUID, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, uuid.Nil, false
+	}
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, uuid.Nil, false
+	}
+	viewerID := cfg.optionalUserID(r)
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(r.Context(), video, viewerID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return database.Video{}, uuid.Nil, false
+	}
+	if !cfg.checkGeoRestriction(w, r, video, viewerID) {
+		return database.Video{}, uuid.Nil, false
+	}
+	return video, viewerID, true
+}
+
+// handlerHLSMasterPlaylist serves a multivariant playlist for a video's HLS
+// rendition, which carries its chapters as session data for players that
+// read them and offers its audio tracks as alternatives. The playlists it
+// points to are signed for the viewer.
+func (cfg *apiConfig) handlerHLSMasterPlaylist(w http.ResponseWriter, r *http.Request) {
+	video, viewerID, ok := cfg.getPlayableVideo(w, r)
+	if !ok {
+		return
+	}
+	renditions, err := cfg.db.GetRenditions(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get renditions", err)
+		return
+	}
+	i := slices.IndexFunc(renditions, func(rendition database.Rendition) bool {
+		return rendition.Quality == database.RenditionQualityHLS
+	})
+	if i < 0 {
+		respondWithError(w, http.StatusNotFound, "Video has no HLS rendition", nil)
+		return
+	}
+	hls := renditions[i]
+	chapters, err := cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chapters", err)
+		return
+	}
+	audioTracks, err := cfg.db.GetAudioTracks(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get audio tracks", err)
+		return
+	}
+
+	expiresAt := cfg.playbackTokenExpiry(time.Now())
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	if len(chapters) > 0 {
+		chaptersURL := fmt.Sprintf("%s%s/videos/%s/hls/chapters.json", cfg.baseURL, apiVersionPrefix, video.ID)
+		fmt.Fprintf(&b, "#EXT-X-SESSION-DATA:DATA-ID=%q,URI=%q\n", hlsChaptersDataID, chaptersURL)
+	}
+	// A single track is just the video's sound; there's nothing to choose.
+	audioGroup := ""
+	if len(audioTracks) > 1 {
+		audioGroup = ",AUDIO=\"audio\""
+		writeHLSAudioTracks(&b, audioTracks, func(i int) string {
+			key := path.Dir(hls.S3Key) + "/" + hlsAudioPlaylistName(i)
+			return cfg.playbackURL(r.Context(), fmt.Sprintf("%s/%s", cfg.s3CfDistribution, key), video.ID, viewerID, expiresAt)
+		})
+	}
+	// BANDWIDTH is required, and a probe that couldn't tell the bitrate
+	// leaves it at zero.
+	fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d%s\n", max(hls.Bitrate, 1), audioGroup)
+	b.WriteString(cfg.playbackURL(r.Context(), fmt.Sprintf("%s/%s", cfg.s3CfDistribution, hls.S3Key), video.ID, viewerID, expiresAt) + "\n")
+
+	w.Header().Set("Content-Type", hlsContentTypes[".m3u8"])
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Write([]byte(b.String()))
+}
+
+// writeHLSAudioTracks lists audio tracks as renditions in the "audio"
+// group. The first track is muxed into the main playlist, so it has no URI
+// of its own; the others are at playlistURL(i).
+func writeHLSAudioTracks(b *strings.Builder, tracks []database.AudioTrack, playlistURL func(i int) string) {
+	names := map[string]bool{}
+	for _, t := range tracks {
+		// Names must be unique within the group.
+		name := cmp.Or(t.Label, t.Language, fmt.Sprintf("Track %d", t.Index+1))
+		if names[name] {
+			name = fmt.Sprintf("%s (%d)", name, t.Index+1)
+		}
+		names[name] = true
+
+		fmt.Fprintf(b, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=%q", name)
+		if t.Language != "" {
+			fmt.Fprintf(b, ",LANGUAGE=%q", t.Language)
+		}
+		if t.Default {
+			b.WriteString(",DEFAULT=YES")
+		}
+		b.WriteString(",AUTOSELECT=YES")
+		if t.Channels > 0 {
+			fmt.Fprintf(b, ",CHANNELS=\"%d\"", t.Channels)
+		}
+		if t.Index > 0 {
+			fmt.Fprintf(b, ",URI=%q", playlistURL(t.Index))
+		}
+		b.WriteString("\n")
+	}
+}
+
+type hlsChapter struct {
+	Chapter   int               `json:"chapter"`
+	StartTime float64           `json:"start-time"`
+	Duration  *float64          `json:"duration,omitempty"`
+	Titles    []hlsChapterTitle `json:"titles"`
+}
+
+type hlsChapterTitle struct {
+	Language string `json:"language"`
+	Title    string `json:"title"`
+}
+
+// handlerHLSChapters serves a video's chapters in the format Apple's
+// players expect from the master playlist's session data.
+func (cfg *apiConfig) handlerHLSChapters(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getPlayableVideo(w, r)
+	if !ok {
+		return
+	}
+	chapters, err := cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chapters", err)
+		return
+	}
+	resp := make([]hlsChapter, len(chapters))
+	for i, ch := range chapters {
+		resp[i] = hlsChapter{
+			Chapter:   i + 1,
+			StartTime: ch.StartSeconds,
+			// Titles aren't tagged with a language, so they're marked
+			// undetermined.
+			Titles: []hlsChapterTitle{{Language: "und", Title: ch.Title}},
+		}
+		if end := chapterEnd(chapters, i, video.DurationSeconds); end != nil {
+			duration := *end - ch.StartSeconds
+			resp[i].Duration = &duration
+		}
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerEmbedChapters serves a video's chapters as a WebVTT chapters track
+// for the embed player. It's under /embed so it's reachable on channel
+// domains, and takes the player's embed token.
+func (cfg *apiConfig) handlerEmbedChapters(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		http.Error(w, "Invalid video ID", http.StatusBadRequest)
+		return
+	}
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't get video", "video_id", videoID, "error", err)
+		http.Error(w, "Couldn't get video", http.StatusInternalServerError)
+		return
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil || onOtherChannelHost(r.Context(), video) {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+	if _, status, msg, err := cfg.embedAccess(r, video); status != 0 {
+		if status > 499 {
+			slog.ErrorContext(r.Context(), msg, "video_id", videoID, "error", err)
+		}
+		http.Error(w, msg, status)
+		return
+	}
+	chapters, err := cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't get chapters", "video_id", videoID, "error", err)
+		http.Error(w, "Couldn't get chapters", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Write([]byte(chaptersVTT(chapters, video.DurationSeconds)))
+}
+
+// vttMaxTimestamp ends the last chapter of a video whose duration isn't
+// known.
+const vttMaxTimestamp = 99*time.Hour + 59*time.Minute + 59*time.Second
+
+// chaptersVTT renders chapters as a WebVTT file with one cue per chapter.
+func chaptersVTT(chapters []database.Chapter, durationSeconds *float64) string {
+	escaper := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, ch := range chapters {
+		end := vttMaxTimestamp
+		if e := chapterEnd(chapters, i, durationSeconds); e != nil {
+			end = time.Duration(*e * float64(time.Second))
+		}
+		start := time.Duration(ch.StartSeconds * float64(time.Second))
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n", i+1, vttTimestamp(start), vttTimestamp(end), escaper.Replace(ch.Title))
+	}
+	return b.String()
+}
+
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// embedChaptersURL is where the embed player loads its chapters track,
+// passing on the token the player was loaded with.
+func embedChaptersURL(r *http.Request, baseURL string, videoID uuid.UUID) string {
+	u := baseURL + "/embed/" + videoID.String() + "/chapters.vtt"
+	if token := r.URL.Query().Get("token"); token != "" {
+		u += "?token=" + url.QueryEscape(token)
+	}
+	return u
+}
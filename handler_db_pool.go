@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+)
+
+func (cfg *apiConfig) handlerDBPoolStats(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		MaxOpenConnections int     `json:"max_open_connections"`
+		OpenConnections    int     `json:"open_connections"`
+		InUse              int     `json:"in_use"`
+		Idle               int     `json:"idle"`
+		WaitCount          int64   `json:"wait_count"`
+		WaitSeconds        float64 `json:"wait_seconds"`
+		MaxIdleClosed      int64   `json:"max_idle_closed"`
+		MaxIdleTimeClosed  int64   `json:"max_idle_time_closed"`
+		MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+	}
+
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	stats := cfg.db.PoolStats()
+	respondWithJSON(w, http.StatusOK, response{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitSeconds:        stats.WaitDuration.Seconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+)
+
+// registerDebugRoutes serves pprof, expvar, and a full dump under /debug/.
+// They expose stacks and memory contents, so every route needs an admin.
+// It must only be called once, since expvar names are global.
+func (cfg *apiConfig) registerDebugRoutes(mux *http.ServeMux) {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+
+	mux.Handle("GET /debug/pprof/", cfg.adminOnly(http.HandlerFunc(pprof.Index)))
+	mux.Handle("GET /debug/pprof/cmdline", cfg.adminOnly(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("GET /debug/pprof/profile", cfg.adminOnly(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("GET /debug/pprof/symbol", cfg.adminOnly(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("POST /debug/pprof/symbol", cfg.adminOnly(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("GET /debug/pprof/trace", cfg.adminOnly(http.HandlerFunc(pprof.Trace)))
+	mux.Handle("GET /debug/vars", cfg.adminOnly(expvar.Handler()))
+	mux.Handle("GET /debug/dump", cfg.adminOnly(http.HandlerFunc(handlerDebugDump)))
+}
+
+// adminOnly guards a handler that doesn't check credentials itself.
+func (cfg *apiConfig) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := cfg.requireAdmin(w, r); !ok {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlerDebugDump writes memory stats, the heap profile, and every
+// goroutine's stack as one text document, so a single request captures the
+// state of a process that's growing.
+func handlerDebugDump(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tubely-dump-%s.txt"`, time.Now().UTC().Format("20060102T150405Z")))
+	fmt.Fprintf(w, "# time: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "# goroutines: %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "# heap alloc: %d bytes in %d objects\n", mem.HeapAlloc, mem.HeapObjects)
+	fmt.Fprintf(w, "# heap in use: %d, idle: %d, released: %d\n", mem.HeapInuse, mem.HeapIdle, mem.HeapReleased)
+	fmt.Fprintf(w, "# sys: %d, gc cycles: %d, last gc pause: %s\n\n", mem.Sys, mem.NumGC, time.Duration(mem.PauseNs[(mem.NumGC+255)%256]))
+
+	fmt.Fprintln(w, "## heap")
+	rpprof.Lookup("heap").WriteTo(w, 1)
+	fmt.Fprintln(w, "\n## goroutines")
+	rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
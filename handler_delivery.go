@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// deliveryTopVideos is how many videos a user's delivery report breaks out.
+const deliveryTopVideos = 10
+
+type deliveryReport struct {
+	Bytes     int64                    `json:"bytes"`
+	Requests  int64                    `json:"requests"`
+	Days      []database.DailyDelivery `json:"days"`
+	TopVideos []database.VideoDelivery `json:"top_videos,omitempty"`
+}
+
+// newDeliveryReport totals daily delivery and fills in the days without
+// any.
+func newDeliveryReport(delivery []database.DailyDelivery, since time.Time, days int) deliveryReport {
+	report := deliveryReport{Days: make([]database.DailyDelivery, 0, days)}
+	byDay := make(map[string]database.DailyDelivery, len(delivery))
+	for _, d := range delivery {
+		byDay[d.Day] = d
+		report.Bytes += d.Bytes
+		report.Requests += d.Requests
+	}
+	for i := 0; i < days; i++ {
+		day := since.AddDate(0, 0, i).Format(time.DateOnly)
+		d, ok := byDay[day]
+		if !ok {
+			d = database.DailyDelivery{Day: day}
+		}
+		report.Days = append(report.Days, d)
+	}
+	return report
+}
+
+// handlerVideoDelivery reports the bandwidth a video used, per day.
+func (cfg *apiConfig) handlerVideoDelivery(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	days, err := parseStatsDays(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	since := statsSince(days)
+	delivery, err := cfg.db.GetVideoDailyDelivery(r.Context(), video.ID, since)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get delivery", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newDeliveryReport(delivery, since, days))
+}
+
+// handlerUserDelivery reports the bandwidth the user's videos used, per day
+// and for the videos that used the most.
+func (cfg *apiConfig) handlerUserDelivery(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	days, err := parseStatsDays(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	since := statsSince(days)
+	delivery, err := cfg.db.GetUserDailyDelivery(r.Context(), userID, since)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get delivery", err)
+		return
+	}
+	report := newDeliveryReport(delivery, since, days)
+	report.TopVideos, err = cfg.db.GetUserDeliveryByVideo(r.Context(), userID, since, deliveryTopVideos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get delivery", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// handlerAdminDelivery ranks owners by the bandwidth their videos used.
+func (cfg *apiConfig) handlerAdminDelivery(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	days, err := parseStatsDays(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	owners, err := cfg.db.GetDeliveryByOwner(r.Context(), statsSince(days), limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get delivery", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, owners)
+}
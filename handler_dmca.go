@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerDMCATakedownCreate unpublishes a video in response to a DMCA notice.
+// Unlike a delete, the stored video object is placed under legal hold so it
+// survives until the claim is resolved, and the trash purger skips the video.
+func (cfg *apiConfig) handlerDMCATakedownCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID         uuid.UUID `json:"video_id"`
+		ClaimantName    string    `json:"claimant_name"`
+		ClaimantEmail   string    `json:"claimant_email"`
+		WorkDescription string    `json:"work_description"`
+	}
+
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.ClaimantName = strings.TrimSpace(params.ClaimantName)
+	params.ClaimantEmail = strings.TrimSpace(params.ClaimantEmail)
+	params.WorkDescription = strings.TrimSpace(params.WorkDescription)
+	if params.ClaimantName == "" || params.ClaimantEmail == "" || params.WorkDescription == "" {
+		respondWithError(w, http.StatusBadRequest, "claimant_name, claimant_email, and work_description are required", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	open, err := cfg.db.GetOpenDMCATakedownForVideo(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get takedowns", err)
+		return
+	}
+	if open.ID != uuid.Nil {
+		respondWithError(w, http.StatusConflict, "Video already has an open takedown", nil)
+		return
+	}
+
+	takedown, err := cfg.db.CreateDMCATakedown(r.Context(), database.CreateDMCATakedownParams{
+		VideoID:         video.ID,
+		ClaimantName:    params.ClaimantName,
+		ClaimantEmail:   params.ClaimantEmail,
+		WorkDescription: params.WorkDescription,
+		CreatedBy:       adminID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create takedown", err)
+		return
+	}
+
+	// The video is already unpublished at this point, so a failed legal hold
+	// is recorded rather than undoing the takedown.
+	details := map[string]string{"takedown_id": takedown.ID.String()}
+	if video.VideoURL != nil {
+		if key, ok := cfg.s3KeyFromURL(*video.VideoURL); ok {
+			if err := cfg.setS3LegalHold(r.Context(), key, true); err != nil {
+				slog.ErrorContext(r.Context(), "Couldn't place legal hold", "key", key, "error", err)
+				details["legal_hold_error"] = err.Error()
+			}
+		}
+	}
+	cfg.audit(r.Context(), adminID, "dmca.take_down", "video", video.ID.String(), details)
+
+	respondWithJSON(w, http.StatusCreated, takedown)
+}
+
+func (cfg *apiConfig) handlerDMCATakedownsList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	status := database.DMCATakedownStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", database.DMCATakedownActive, database.DMCATakedownCounterNoticed, database.DMCATakedownRestored:
+	default:
+		respondWithError(w, http.StatusBadRequest, "status must be active, counter_noticed, or restored", nil)
+		return
+	}
+
+	takedowns, err := cfg.db.GetDMCATakedowns(r.Context(), status, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve takedowns", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, takedowns)
+}
+
+// handlerDMCACounterNotice lets the video's owner or a channel editor dispute
+// an active takedown. The video stays down until an admin restores it.
+func (cfg *apiConfig) handlerDMCACounterNotice(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Statement string `json:"statement"`
+	}
+
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.Statement = strings.TrimSpace(params.Statement)
+	if params.Statement == "" {
+		respondWithError(w, http.StatusBadRequest, "statement is required", nil)
+		return
+	}
+
+	takedown, err := cfg.db.GetOpenDMCATakedownForVideo(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get takedown", err)
+		return
+	}
+	if takedown.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video has no open takedown", nil)
+		return
+	}
+	if takedown.Status != database.DMCATakedownActive {
+		respondWithError(w, http.StatusConflict, "A counter-notice has already been filed", nil)
+		return
+	}
+
+	err = cfg.db.SubmitDMCACounterNotice(r.Context(), takedown.ID, params.Statement)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't file counter-notice", err)
+		return
+	}
+
+	takedown, err = cfg.db.GetDMCATakedown(r.Context(), takedown.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get takedown", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, takedown)
+}
+
+// handlerDMCATakedownRestore releases the legal hold and republishes the video
+// with the visibility it had before the takedown.
+func (cfg *apiConfig) handlerDMCATakedownRestore(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	takedownID, err := uuid.Parse(r.PathValue("takedownID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+	takedown, err := cfg.db.GetDMCATakedown(r.Context(), takedownID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get takedown", err)
+		return
+	}
+	if takedown.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get takedown", nil)
+		return
+	}
+	if takedown.ResolvedAt != nil {
+		respondWithError(w, http.StatusConflict, "Takedown has already been resolved", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), takedown.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.VideoURL != nil {
+		if key, ok := cfg.s3KeyFromURL(*video.VideoURL); ok {
+			if err := cfg.setS3LegalHold(r.Context(), key, false); err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't release legal hold", err)
+				return
+			}
+		}
+	}
+
+	err = cfg.db.RestoreDMCATakedown(r.Context(), takedown.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "dmca.restore", "video", video.ID.String(), map[string]string{"takedown_id": takedown.ID.String()})
+
+	video, err = cfg.db.GetVideo(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.Visibility == database.VisibilityPublic {
+		go cfg.notifySubscribers(context.WithoutCancel(r.Context()), video)
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const downloadURLExpiry = 15 * time.Minute
+
+func (cfg *apiConfig) handlerVideoDownload(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(r.Context(), video, userID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if !cfg.checkGeoRestriction(w, r, video, userID) {
+		return
+	}
+	if rejectLive(w, video) {
+		return
+	}
+	if video.VideoURL == nil {
+		switch video.Status {
+		case database.VideoStatusProcessing:
+			respondWithErrorCode(w, http.StatusNotFound, errCodeVideoNotReady, "Video is still processing", nil, map[string]any{"status": video.Status})
+		case database.VideoStatusFailed:
+			respondWithErrorCode(w, http.StatusNotFound, errCodeProcessingFailed, "Video couldn't be processed, upload it again", nil, map[string]any{"status": video.Status})
+		default:
+			respondWithError(w, http.StatusNotFound, "Video has not been uploaded yet", nil)
+		}
+		return
+	}
+	key, ok := cfg.s3KeyFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Video file isn't available for download", nil)
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{
+		"filename": downloadFilename(video.Title, ".mp4"),
+	})
+	req, err := cfg.s3Presigner.PresignGetObject(r.Context(), &s3.GetObjectInput{
+		Bucket:                     &cfg.s3Bucket,
+		Key:                        &key,
+		ResponseContentDisposition: &disposition,
+	}, s3.WithPresignExpires(downloadURLExpiry))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign download URL", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, req.URL, http.StatusFound)
+}
+
+// downloadFilename turns a video title into a filename that is safe on
+// common filesystems.
+func downloadFilename(title, ext string) string {
+	var sb strings.Builder
+	lastDash := false
+	for _, c := range strings.TrimSpace(title) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_':
+			sb.WriteRune(c)
+			lastDash = false
+		case !lastDash && sb.Len() > 0:
+			sb.WriteRune('-')
+			lastDash = true
+		}
+	}
+	name := strings.TrimSuffix(sb.String(), "-")
+	if len(name) > 100 {
+		name = strings.TrimSuffix(name[:100], "-")
+	}
+	if name == "" {
+		name = "video"
+	}
+	return name + ext
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (cfg *apiConfig) handlerEmailPreferencesGet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	prefs, err := cfg.db.GetEmailPreferences(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get email preferences", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, prefs)
+}
+
+// handlerEmailPreferencesSet turns the kinds of email in the body on or off,
+// e.g. {"quota_warning": false}. Kinds left out are unchanged.
+func (cfg *apiConfig) handlerEmailPreferencesSet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	var params map[database.EmailKind]bool
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	for kind := range params {
+		if !kind.Valid() {
+			respondWithError(w, http.StatusBadRequest, "Unknown email kind: "+string(kind), nil)
+			return
+		}
+	}
+	for kind, enabled := range params {
+		if err := cfg.db.SetEmailPreference(r.Context(), userID, kind, enabled); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't save email preferences", err)
+			return
+		}
+	}
+
+	prefs, err := cfg.db.GetEmailPreferences(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get email preferences", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, prefs)
+}
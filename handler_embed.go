@@ -0,0 +1,229 @@
+package main
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// embedPlayerTemplate is the page served inside third-party iframes. It
+// reports player state to the embedding page with postMessage as
+// {"type": "tubely:<event>", "videoId", "currentTime", "duration"} and accepts
+// {"type": "tubely:play" | "tubely:pause" | "tubely:seek", "time"} commands.
+// Entering a chapter posts "tubely:chapter" with the chapter, or null
+// before the first one.
+// Plays, pauses, seeks, and buffering are also batched to the beacon.
+var embedPlayerTemplate = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+html, body { margin: 0; height: 100%; background: #000; overflow: hidden; }
+video { width: 100%; height: 100%; object-fit: contain; }
+</style>
+</head>
+<body>
+<video id="player" controls playsinline preload="metadata"{{if .PosterURL}} poster="{{.PosterURL}}"{{end}}>
+<source src="{{.VideoURL}}" type="{{.MediaType}}">
+{{if .Chapters}}<track kind="chapters" src="{{.ChaptersURL}}" default>
+{{end}}</video>
+<script>
+(function () {
+  var videoId = {{.VideoID}};
+  var player = document.getElementById("player");
+  function post(event, extra) {
+    if (window.parent === window) {
+      return;
+    }
+    var msg = {
+      type: "tubely:" + event,
+      videoId: videoId,
+      currentTime: player.currentTime,
+      duration: isNaN(player.duration) ? null : player.duration
+    };
+    for (var k in extra) {
+      msg[k] = extra[k];
+    }
+    window.parent.postMessage(msg, "*");
+  }
+  ["loadedmetadata", "play", "pause", "ended", "seeked", "error"].forEach(function (event) {
+    player.addEventListener(event, function () { post(event); });
+  });
+  var chapters = {{.Chapters}}, chapter = -1;
+  function updateChapter() {
+    var i = chapters.length - 1;
+    while (i >= 0 && chapters[i].start_seconds > player.currentTime) {
+      i--;
+    }
+    if (i !== chapter) {
+      chapter = i;
+      post("chapter", {chapter: i < 0 ? null : chapters[i]});
+    }
+  }
+  if (chapters.length > 0) {
+    player.addEventListener("timeupdate", updateChapter);
+    player.addEventListener("seeked", updateChapter);
+  }
+  var lastProgress = 0;
+  player.addEventListener("timeupdate", function () {
+    var now = Date.now();
+    if (now - lastProgress >= 1000) {
+      lastProgress = now;
+      post("timeupdate");
+    }
+  });
+
+  var beaconURL = {{.BeaconURL}};
+  var sessionId = Date.now().toString(36) + Math.random().toString(36).slice(2);
+  var queue = [];
+  function track(type, extra) {
+    var e = {type: type, position_seconds: player.currentTime, timestamp: Date.now()};
+    for (var k in extra) {
+      e[k] = extra[k];
+    }
+    queue.push(e);
+    if (queue.length >= 50) {
+      flush();
+    }
+  }
+  function flush() {
+    if (queue.length === 0) {
+      return;
+    }
+    var body = JSON.stringify({video_id: videoId, session_id: sessionId, events: queue.splice(0, queue.length)});
+    if (!navigator.sendBeacon || !navigator.sendBeacon(beaconURL, body)) {
+      fetch(beaconURL, {method: "POST", body: body, keepalive: true}).catch(function () {});
+    }
+  }
+  setInterval(flush, 10000);
+  document.addEventListener("visibilitychange", function () {
+    if (document.visibilityState === "hidden") {
+      flush();
+    }
+  });
+  var lastTime = 0, seekFrom = null, waitingSince = 0;
+  player.addEventListener("play", function () { track("play"); });
+  player.addEventListener("pause", function () { track("pause"); });
+  player.addEventListener("timeupdate", function () {
+    if (!player.seeking) {
+      lastTime = player.currentTime;
+    }
+  });
+  player.addEventListener("seeking", function () {
+    if (seekFrom === null) {
+      seekFrom = lastTime;
+    }
+  });
+  player.addEventListener("seeked", function () {
+    track("seek", {from_seconds: seekFrom === null ? lastTime : seekFrom});
+    seekFrom = null;
+    lastTime = player.currentTime;
+  });
+  player.addEventListener("waiting", function () { waitingSince = Date.now(); });
+  player.addEventListener("playing", function () {
+    if (waitingSince) {
+      track("buffer", {duration_ms: Date.now() - waitingSince});
+      waitingSince = 0;
+    }
+  });
+
+  window.addEventListener("message", function (e) {
+    var msg = e.data || {};
+    if (msg.type === "tubely:play") {
+      player.play();
+    } else if (msg.type === "tubely:pause") {
+      player.pause();
+    } else if (msg.type === "tubely:seek" && typeof msg.time === "number") {
+      player.currentTime = msg.time;
+    }
+  });
+  post("ready");
+})();
+</script>
+</body>
+</html>
+`))
+
+type embedPlayerData struct {
+	VideoID   string
+	Title     string
+	VideoURL  string
+	MediaType string
+	PosterURL string
+	BeaconURL string
+	// Chapters is never nil, so the player script gets a list.
+	Chapters    []database.Chapter
+	ChaptersURL string
+}
+
+func (cfg *apiConfig) handlerEmbedPlayer(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		http.Error(w, "Invalid video ID", http.StatusBadRequest)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't get video", "video_id", videoID, "error", err)
+		http.Error(w, "Couldn't get video", http.StatusInternalServerError)
+		return
+	}
+	// A channel's custom domain only embeds the channel's own videos.
+	if video.ID == uuid.Nil || video.DeletedAt != nil || onOtherChannelHost(r.Context(), video) {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+	ancestors, status, msg, err := cfg.embedAccess(r, video)
+	if status != 0 {
+		if status > 499 {
+			slog.ErrorContext(r.Context(), msg, "video_id", videoID, "error", err)
+		}
+		http.Error(w, msg, status)
+		return
+	}
+	_, allowed, err := cfg.geoAllowed(r, video, uuid.Nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't check region", "video_id", videoID, "error", err)
+		http.Error(w, "Couldn't get video", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Video isn't available in your region", http.StatusUnavailableForLegalReasons)
+		return
+	}
+	if video.VideoURL == nil {
+		http.Error(w, "Video has not been uploaded yet", http.StatusNotFound)
+		return
+	}
+
+	data := embedPlayerData{
+		VideoID:   video.ID.String(),
+		Title:     video.Title,
+		VideoURL:  cfg.playbackURL(r.Context(), *video.VideoURL, video.ID, uuid.Nil, cfg.playbackTokenExpiry(time.Now())),
+		MediaType: "video/mp4",
+		BeaconURL: cfg.baseURL + apiVersionPrefix + "/beacon",
+	}
+	if video.ThumbnailURL != nil {
+		data.PosterURL = *video.ThumbnailURL
+	}
+	data.Chapters, err = cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't get chapters", "video_id", videoID, "error", err)
+		http.Error(w, "Couldn't get video", http.StatusInternalServerError)
+		return
+	}
+	data.ChaptersURL = embedChaptersURL(r, cfg.publicBaseURL(r), video.ID)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors "+ancestors)
+	if err := embedPlayerTemplate.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't render embed player", "video_id", videoID, "error", err)
+	}
+}
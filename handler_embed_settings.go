@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultEmbedTokenTTL = 30 * 24 * time.Hour
+	maxEmbedTokenTTL     = 365 * 24 * time.Hour
+)
+
+func (cfg *apiConfig) handlerEmbedSettingsGet(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	settings, err := cfg.db.GetEmbedSettings(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get embed settings", err)
+		return
+	}
+	if settings == nil {
+		respondWithError(w, http.StatusNotFound, "Video's embeds aren't restricted", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// handlerEmbedSettingsSet replaces the domains a video may be embedded on
+// and whether embeds need a token.
+func (cfg *apiConfig) handlerEmbedSettingsSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		AllowedDomains []string `json:"allowed_domains"`
+		RequireToken   bool     `json:"require_token"`
+	}
+
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	domains, ok := normalizeEmbedDomains(params.AllowedDomains)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "allowed_domains must be host names such as example.com or *.example.com", nil)
+		return
+	}
+
+	settings, err := cfg.db.SetEmbedSettings(r.Context(), video.ID, domains, params.RequireToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set embed settings", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+func (cfg *apiConfig) handlerEmbedSettingsDelete(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.db.DeleteEmbedSettings(r.Context(), video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove embed settings", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type embedTokenResponse struct {
+	Token     string    `json:"token"`
+	EmbedURL  string    `json:"embed_url"`
+	Domain    string    `json:"domain,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handlerEmbedTokenCreate signs a token that lets the video be embedded,
+// even if it's private, by pages on domain, or on any page the video's
+// settings allow if no domain is given.
+func (cfg *apiConfig) handlerEmbedTokenCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Domain           string `json:"domain"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}
+
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	ttl := defaultEmbedTokenTTL
+	if params.ExpiresInSeconds != 0 {
+		ttl = time.Duration(params.ExpiresInSeconds) * time.Second
+	}
+	if ttl <= 0 || ttl > maxEmbedTokenTTL {
+		respondWithError(w, http.StatusBadRequest, "expires_in_seconds must be between 1 and 31536000", nil)
+		return
+	}
+
+	var domain string
+	if params.Domain != "" {
+		domains, ok := normalizeEmbedDomains([]string{params.Domain})
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, "domain must be a host name such as example.com or *.example.com", nil)
+			return
+		}
+		domain = domains[0]
+		settings, err := cfg.db.GetEmbedSettings(r.Context(), video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get embed settings", err)
+			return
+		}
+		if settings != nil && len(settings.AllowedDomains) > 0 && !embedDomainAllowed(settings.AllowedDomains, domain) {
+			respondWithError(w, http.StatusBadRequest, "domain isn't one of the video's allowed domains", nil)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(ttl)
+	token, err := auth.MakeEmbedToken(auth.EmbedClaims{VideoID: video.ID, Domain: domain, IssuedAt: now}, cfg.jwtSecret, expiresAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't make embed token", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, embedTokenResponse{
+		Token:     token,
+		EmbedURL:  cfg.baseURL + "/embed/" + video.ID.String() + "?token=" + url.QueryEscape(token),
+		Domain:    domain,
+		ExpiresAt: expiresAt.Truncate(time.Second),
+	})
+}
+
+// handlerEmbedTokensRevoke invalidates every embed token issued for the
+// video so far.
+func (cfg *apiConfig) handlerEmbedTokensRevoke(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	settings, err := cfg.db.RevokeEmbedTokens(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke embed tokens", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// embedAccess decides whether video's embed player may be served for r. It
+// returns the frame-ancestors the page may be framed by, or the status and
+// message to refuse it with.
+func (cfg *apiConfig) embedAccess(r *http.Request, video database.Video) (ancestors string, status int, msg string, err error) {
+	settings, err := cfg.db.GetEmbedSettings(r.Context(), video.ID)
+	if err != nil {
+		return "", http.StatusInternalServerError, "Couldn't get embed settings", err
+	}
+	var allowed []string
+	if settings != nil {
+		allowed = settings.AllowedDomains
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		if settings != nil && settings.RequireToken {
+			return "", http.StatusForbidden, "Video can only be embedded with an embed token", nil
+		}
+		// The player is loaded by anonymous visitors of other sites, so
+		// private videos are never embeddable without a token.
+		if !cfg.canViewVideo(r.Context(), video, uuid.Nil) {
+			return "", http.StatusNotFound, "Video not found", nil
+		}
+		return frameAncestors(allowed), 0, "", nil
+	}
+
+	claims, err := auth.ValidateEmbedToken(token, cfg.jwtSecret)
+	if err != nil || claims.VideoID != video.ID {
+		return "", http.StatusForbidden, "Invalid embed token", err
+	}
+	if settings != nil && settings.TokensValidAfter != nil && claims.IssuedAt.Before(*settings.TokensValidAfter) {
+		return "", http.StatusForbidden, "Embed token has been revoked", nil
+	}
+	if claims.Domain != "" {
+		if len(allowed) > 0 && !embedDomainAllowed(allowed, claims.Domain) {
+			return "", http.StatusForbidden, "Embed token's domain is no longer allowed", nil
+		}
+		allowed = []string{claims.Domain}
+	}
+	// A token stands in for the owner's say-so, so it opens up private
+	// videos, but not ones taken down or whose owner is suspended.
+	if !cfg.videoAvailable(r.Context(), video, uuid.Nil) {
+		return "", http.StatusNotFound, "Video not found", nil
+	}
+	return frameAncestors(allowed), 0, "", nil
+}
+
+// frameAncestors is the Content-Security-Policy frame-ancestors source list
+// for domains, which allows any site when there are none.
+func frameAncestors(domains []string) string {
+	if len(domains) == 0 {
+		return "*"
+	}
+	return strings.Join(domains, " ")
+}
+
+// embedDomainAllowed reports whether domain is covered by allowed, where
+// "*.example.com" covers example.com's subdomains.
+func embedDomainAllowed(allowed []string, domain string) bool {
+	for _, a := range allowed {
+		if a == domain {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(a, "*"); ok && strings.HasSuffix(domain, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEmbedDomains lower-cases and de-duplicates host names, each of
+// which may start with "*." for its subdomains. It reports false if any
+// isn't a host name.
+func normalizeEmbedDomains(domains []string) ([]string, bool) {
+	normalized := []string{}
+	for _, d := range domains {
+		domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d), "."))
+		if !validHostname(strings.TrimPrefix(domain, "*.")) {
+			return nil, false
+		}
+		if !slices.Contains(normalized, domain) {
+			normalized = append(normalized, domain)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized, true
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func newEmbedRequest(t *testing.T, video database.Video, withToken bool) *http.Request {
+	t.Helper()
+	target := "/embed/" + video.ID.String()
+	if withToken {
+		token, err := auth.MakeEmbedToken(auth.EmbedClaims{VideoID: video.ID, IssuedAt: time.Now()}, testJWTSecret, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		target += "?token=" + url.QueryEscape(token)
+	}
+	return httptest.NewRequest(http.MethodGet, target, nil)
+}
+
+func TestEmbedAccess(t *testing.T) {
+	takenDownAt := time.Now()
+	tests := []struct {
+		name       string
+		visibility database.Visibility
+		takenDown  bool
+		suspended  bool
+		withToken  bool
+		wantStatus int
+	}{
+		{"public", database.VisibilityPublic, false, false, false, 0},
+		{"private", database.VisibilityPrivate, false, false, false, http.StatusNotFound},
+		{"private with token", database.VisibilityPrivate, false, false, true, 0},
+		{"owner suspended", database.VisibilityPublic, false, true, false, http.StatusNotFound},
+		{"owner suspended with token", database.VisibilityPrivate, false, true, true, http.StatusNotFound},
+		{"taken down with token", database.VisibilityPrivate, true, false, true, http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, store, _ := newTestConfig(t)
+			store.IsUserSuspendedFunc = func(ctx context.Context, id uuid.UUID) (bool, error) {
+				return tc.suspended, nil
+			}
+			video := database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New(), Visibility: tc.visibility}}
+			if tc.takenDown {
+				video.TakenDownAt = &takenDownAt
+			}
+
+			_, status, msg, _ := cfg.embedAccess(newEmbedRequest(t, video, tc.withToken), video)
+			if status != tc.wantStatus {
+				t.Errorf("status = %d (%s), want %d", status, msg, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestEmbedAccessSettings(t *testing.T) {
+	video := database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New(), Visibility: database.VisibilityPrivate}}
+	revokedAt := time.Now()
+	tests := []struct {
+		name          string
+		settings      database.EmbedSettings
+		claims        *auth.EmbedClaims
+		wantStatus    int
+		wantAncestors string
+	}{
+		{
+			name:          "token for any allowed domain",
+			settings:      database.EmbedSettings{AllowedDomains: []string{"*.example.com", "example.org"}},
+			claims:        &auth.EmbedClaims{VideoID: video.ID, IssuedAt: time.Now()},
+			wantAncestors: "*.example.com example.org",
+		},
+		{
+			name:          "token for one domain",
+			settings:      database.EmbedSettings{AllowedDomains: []string{"*.example.com"}},
+			claims:        &auth.EmbedClaims{VideoID: video.ID, Domain: "blog.example.com", IssuedAt: time.Now()},
+			wantAncestors: "blog.example.com",
+		},
+		{
+			name:       "token's domain no longer allowed",
+			settings:   database.EmbedSettings{AllowedDomains: []string{"example.org"}},
+			claims:     &auth.EmbedClaims{VideoID: video.ID, Domain: "blog.example.com", IssuedAt: time.Now()},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "token required",
+			settings:   database.EmbedSettings{RequireToken: true},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "token for another video",
+			claims:     &auth.EmbedClaims{VideoID: uuid.New(), IssuedAt: time.Now()},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "revoked token",
+			settings:   database.EmbedSettings{TokensValidAfter: &revokedAt},
+			claims:     &auth.EmbedClaims{VideoID: video.ID, IssuedAt: revokedAt.Add(-time.Minute)},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, store, _ := newTestConfig(t)
+			store.GetEmbedSettingsFunc = func(ctx context.Context, videoID uuid.UUID) (*database.EmbedSettings, error) {
+				return &tc.settings, nil
+			}
+			target := "/embed/" + video.ID.String()
+			if tc.claims != nil {
+				token, err := auth.MakeEmbedToken(*tc.claims, testJWTSecret, time.Now().Add(time.Hour))
+				if err != nil {
+					t.Fatal(err)
+				}
+				target += "?token=" + url.QueryEscape(token)
+			}
+
+			ancestors, status, msg, _ := cfg.embedAccess(httptest.NewRequest(http.MethodGet, target, nil), video)
+			if status != tc.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", status, msg, tc.wantStatus)
+			}
+			if ancestors != tc.wantAncestors {
+				t.Errorf("frame-ancestors = %q, want %q", ancestors, tc.wantAncestors)
+			}
+		})
+	}
+}
+
+func TestHandlerEmbedTokenCreate(t *testing.T) {
+	ownerID := uuid.New()
+	video := database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: ownerID, Visibility: database.VisibilityPrivate}}
+	tests := []struct {
+		name       string
+		userID     uuid.UUID
+		body       string
+		wantStatus int
+		wantDomain string
+	}{
+		{"any domain", ownerID, `{}`, http.StatusCreated, ""},
+		{"allowed domain", ownerID, `{"domain": "Blog.Example.com."}`, http.StatusCreated, "blog.example.com"},
+		{"domain not allowed", ownerID, `{"domain": "example.net"}`, http.StatusBadRequest, ""},
+		{"too long", ownerID, `{"expires_in_seconds": 31536001}`, http.StatusBadRequest, ""},
+		{"not the owner", uuid.New(), `{}`, http.StatusForbidden, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, store, _ := newTestConfig(t)
+			stubVideo(store, &video)
+			store.GetEmbedSettingsFunc = func(ctx context.Context, videoID uuid.UUID) (*database.EmbedSettings, error) {
+				return &database.EmbedSettings{VideoID: videoID, AllowedDomains: []string{"*.example.com"}}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/embed-tokens", strings.NewReader(tc.body))
+			req.SetPathValue("videoID", video.ID.String())
+			authorize(t, req, tc.userID)
+			rec := httptest.NewRecorder()
+			cfg.handlerEmbedTokenCreate(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusCreated {
+				return
+			}
+			var resp embedTokenResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			claims, err := auth.ValidateEmbedToken(resp.Token, testJWTSecret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.VideoID != video.ID || claims.Domain != tc.wantDomain || resp.Domain != tc.wantDomain {
+				t.Errorf("token for %s on %q, response domain %q, want %q", claims.VideoID, claims.Domain, resp.Domain, tc.wantDomain)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+var exportCSVHeader = []string{
+	"id", "title", "description", "visibility", "status", "tags", "slug", "channel_id",
+	"created_at", "updated_at", "deleted_at",
+	"duration_seconds", "width", "height", "size_bytes",
+	"video_url", "thumbnail_url",
+	"views", "delivered_bytes", "delivery_requests",
+}
+
+// handlerVideosExport downloads the user's whole catalog, including videos
+// in the trash, as JSON or CSV. from and to are dates (inclusive) or
+// RFC 3339 times limiting it to videos created in that range.
+func (cfg *apiConfig) handlerVideosExport(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		respondWithError(w, http.StatusBadRequest, `format must be "json" or "csv"`, nil)
+		return
+	}
+	from, err := parseExportTime(query.Get("from"), false)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "from must be a date or RFC 3339 time", err)
+		return
+	}
+	to, err := parseExportTime(query.Get("to"), true)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "to must be a date or RFC 3339 time", err)
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		respondWithError(w, http.StatusBadRequest, "from must be before to", nil)
+		return
+	}
+
+	videos, err := cfg.db.ExportVideos(r.Context(), userID, from, to)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export videos", err)
+		return
+	}
+
+	filename := fmt.Sprintf("tubely-videos-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if format == "json" {
+		respondWithJSON(w, http.StatusOK, videos)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Write(exportCSVHeader)
+	for _, v := range videos {
+		cw.Write(exportCSVRow(v))
+	}
+	cw.Flush()
+}
+
+// parseExportTime reads a date or RFC 3339 time. A date used as the end
+// of the range includes the whole day.
+func parseExportTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time")
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func exportCSVRow(v database.ExportedVideo) []string {
+	optional := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	optionalTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	optionalFloat := func(f *float64) string {
+		if f == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*f, 'f', -1, 64)
+	}
+	optionalInt := func(n *int) string {
+		if n == nil {
+			return ""
+		}
+		return strconv.Itoa(*n)
+	}
+	channelID := ""
+	if v.ChannelID != nil {
+		channelID = v.ChannelID.String()
+	}
+	sizeBytes := ""
+	if v.SizeBytes != nil {
+		sizeBytes = strconv.FormatInt(*v.SizeBytes, 10)
+	}
+	return []string{
+		v.ID.String(), v.Title, v.Description, string(v.Visibility), string(v.Status),
+		strings.Join(v.Tags, ";"), optional(v.Slug), channelID,
+		v.CreatedAt.UTC().Format(time.RFC3339), v.UpdatedAt.UTC().Format(time.RFC3339), optionalTime(v.DeletedAt),
+		optionalFloat(v.DurationSeconds), optionalInt(v.Width), optionalInt(v.Height), sizeBytes,
+		optional(v.VideoURL), optional(v.ThumbnailURL),
+		strconv.Itoa(v.Views), strconv.FormatInt(v.DeliveredBytes, 10), strconv.FormatInt(v.DeliveryRequests, 10),
+	}
+}
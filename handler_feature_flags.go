@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+type featureFlagResponse struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+	// Override is the admin-set state that replaces Default, if any.
+	Override *database.FeatureFlag `json:"override"`
+}
+
+func (cfg *apiConfig) handlerFeatureFlagsList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	if err := cfg.features.refresh(r.Context(), cfg.db); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve feature flags", err)
+		return
+	}
+	flags := make([]featureFlagResponse, 0, len(knownFeatureFlags))
+	for _, name := range knownFeatureFlags {
+		flags = append(flags, cfg.features.state(name))
+	}
+	respondWithJSON(w, http.StatusOK, flags)
+}
+
+func (cfg *apiConfig) handlerFeatureFlagSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Enabled        bool `json:"enabled"`
+		RolloutPercent *int `json:"rollout_percent"`
+	}
+
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if !validFeatureFlag(name) {
+		respondWithError(w, http.StatusNotFound, "Unknown feature flag", nil)
+		return
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	flag := database.FeatureFlag{Name: name, Enabled: params.Enabled, RolloutPercent: 100}
+	if params.RolloutPercent != nil {
+		flag.RolloutPercent = *params.RolloutPercent
+	}
+	if flag.RolloutPercent < 0 || flag.RolloutPercent > 100 {
+		respondWithError(w, http.StatusBadRequest, "rollout_percent must be between 0 and 100", nil)
+		return
+	}
+
+	flag, err := cfg.db.SetFeatureFlag(r.Context(), flag)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update feature flag", err)
+		return
+	}
+	if err := cfg.features.refresh(r.Context(), cfg.db); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve feature flags", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "feature_flag.set", "feature_flag", name, flag)
+	respondWithJSON(w, http.StatusOK, cfg.features.state(name))
+}
+
+func (cfg *apiConfig) handlerFeatureFlagReset(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	if !validFeatureFlag(name) {
+		respondWithError(w, http.StatusNotFound, "Unknown feature flag", nil)
+		return
+	}
+	if err := cfg.db.DeleteFeatureFlag(r.Context(), name); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset feature flag", err)
+		return
+	}
+	if err := cfg.features.refresh(r.Context(), cfg.db); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve feature flags", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "feature_flag.reset", "feature_flag", name, nil)
+	respondWithJSON(w, http.StatusOK, cfg.features.state(name))
+}
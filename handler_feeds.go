@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const feedItemLimit = 50
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	MediaNS string     `xml:"xmlns:media,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title          string          `xml:"title"`
+	Link           string          `xml:"link"`
+	Description    string          `xml:"description"`
+	GUID           rssGUID         `xml:"guid"`
+	PubDate        string          `xml:"pubDate"`
+	Enclosure      *rssEnclosure   `xml:"enclosure,omitempty"`
+	MediaContent   *mediaContent   `xml:"media:content,omitempty"`
+	MediaThumbnail *mediaThumbnail `xml:"media:thumbnail,omitempty"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type mediaContent struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Medium   string `xml:"medium,attr"`
+	FileSize int64  `xml:"fileSize,attr,omitempty"`
+	Duration int    `xml:"duration,attr,omitempty"`
+	Width    int    `xml:"width,attr,omitempty"`
+	Height   int    `xml:"height,attr,omitempty"`
+}
+
+type mediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+func (cfg *apiConfig) handlerChannelFeed(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(r.PathValue("channelID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID", err)
+		return
+	}
+
+	channel, err := cfg.db.GetChannel(r.Context(), channelID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel", err)
+		return
+	}
+	if channel.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Channel not found", nil)
+		return
+	}
+
+	cfg.respondWithFeed(w, r, channel.Name, channel.Description, database.ListVideosParams{ChannelID: channel.ID})
+}
+
+func (cfg *apiConfig) handlerUserFeed(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+
+	// Feeds are public, so they're titled by ID rather than exposing emails.
+	title := fmt.Sprintf("Tubely uploads from %s", user.ID)
+	cfg.respondWithFeed(w, r, title, "", database.ListVideosParams{UserID: user.ID})
+}
+
+// respondWithFeed renders an RSS 2.0 feed of the latest public, processed
+// videos matching params.
+func (cfg *apiConfig) respondWithFeed(w http.ResponseWriter, r *http.Request, title, description string, params database.ListVideosParams) {
+	params.PublicOnly = true
+	params.Status = database.VideoStatusReady
+	params.Limit = feedItemLimit
+	videos, _, err := cfg.db.ListVideos(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	if description == "" {
+		description = title
+	}
+	// On a channel's custom domain, links stay on it.
+	baseURL := cfg.publicBaseURL(r)
+	link, self := baseURL+"/app/", baseURL+r.URL.Path
+	_, onChannelHost := channelHostFromContext(r.Context())
+	if onChannelHost {
+		link, self = baseURL+"/", baseURL+"/feed.rss"
+	}
+	feed := rssFeed{
+		Version: "2.0",
+		MediaNS: "http://search.yahoo.com/mrss/",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        link,
+			Description: description,
+			AtomLink: atomLink{
+				Href: self,
+				Rel:  "self",
+				Type: "application/rss+xml",
+			},
+			Items: []rssItem{},
+		},
+	}
+	if len(videos) > 0 {
+		feed.Channel.LastBuildDate = videos[0].CreatedAt.UTC().Format(time.RFC1123Z)
+	}
+
+	expiresAt := cfg.playbackTokenExpiry(time.Now())
+	for _, video := range videos {
+		if video.VideoURL == nil {
+			continue
+		}
+		videoURL := cfg.playbackURL(r.Context(), *video.VideoURL, video.ID, uuid.Nil, expiresAt)
+		link := fmt.Sprintf("%s%s/videos/%s", baseURL, apiVersionPrefix, video.ID)
+		if onChannelHost {
+			link = fmt.Sprintf("%s/embed/%s", baseURL, video.ID)
+		}
+		item := rssItem{
+			Title:       video.Title,
+			Link:        link,
+			Description: video.Description,
+			GUID:        rssGUID{Value: video.ID.String()},
+			PubDate:     video.CreatedAt.UTC().Format(time.RFC1123Z),
+			Enclosure: &rssEnclosure{
+				URL:  videoURL,
+				Type: "video/mp4",
+			},
+			MediaContent: &mediaContent{
+				URL:    videoURL,
+				Type:   "video/mp4",
+				Medium: "video",
+			},
+		}
+		if video.SizeBytes != nil {
+			item.Enclosure.Length = *video.SizeBytes
+			item.MediaContent.FileSize = *video.SizeBytes
+		}
+		if video.DurationSeconds != nil {
+			item.MediaContent.Duration = int(*video.DurationSeconds)
+		}
+		if video.Width != nil && video.Height != nil {
+			item.MediaContent.Width = *video.Width
+			item.MediaContent.Height = *video.Height
+		}
+		if video.ThumbnailURL != nil {
+			item.MediaThumbnail = &mediaThumbnail{URL: *video.ThumbnailURL}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	dat, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't render feed", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(dat)
+}
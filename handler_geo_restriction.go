@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+)
+
+func (cfg *apiConfig) handlerGeoRestrictionGet(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	restriction, err := cfg.db.GetGeoRestriction(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get geo-restriction", err)
+		return
+	}
+	if restriction == nil {
+		respondWithError(w, http.StatusNotFound, "Video isn't geo-restricted", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, restriction)
+}
+
+// handlerGeoRestrictionSet replaces a video's allowed and blocked country
+// lists. Sending both empty lifts the restriction.
+func (cfg *apiConfig) handlerGeoRestrictionSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Allowed []string `json:"allowed"`
+		Blocked []string `json:"blocked"`
+	}
+
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if cfg.geoLocator == nil {
+		respondWithError(w, http.StatusNotImplemented, "Geo-restriction isn't enabled on this server", nil)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	allowed, ok := normalizeCountries(params.Allowed)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "allowed must be ISO 3166-1 alpha-2 country codes", nil)
+		return
+	}
+	blocked, ok := normalizeCountries(params.Blocked)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "blocked must be ISO 3166-1 alpha-2 country codes", nil)
+		return
+	}
+
+	if len(allowed) == 0 && len(blocked) == 0 {
+		if err := cfg.db.DeleteGeoRestriction(r.Context(), video.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't remove geo-restriction", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	restriction, err := cfg.db.SetGeoRestriction(r.Context(), video.ID, allowed, blocked)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set geo-restriction", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, restriction)
+}
+
+func (cfg *apiConfig) handlerGeoRestrictionDelete(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.db.DeleteGeoRestriction(r.Context(), video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove geo-restriction", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeCountries upper-cases and de-duplicates country codes. It
+// reports false if any isn't a two-letter code.
+func normalizeCountries(codes []string) ([]string, bool) {
+	normalized := []string{}
+	for _, code := range codes {
+		country := normalizeCountry(code)
+		if country == "" {
+			return nil, false
+		}
+		if !slices.Contains(normalized, country) {
+			normalized = append(normalized, country)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized, true
+}
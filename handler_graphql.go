@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/graphql"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerGraphQL(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+
+	params := parameters{}
+	if r.Method == http.MethodGet {
+		params.Query = r.URL.Query().Get("query")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			err := json.Unmarshal([]byte(v), &params.Variables)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Couldn't decode variables", err)
+				return
+			}
+		}
+	} else {
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+	}
+
+	fields, err := graphql.Parse(params.Query, params.Variables)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, graphql.Response{
+			Errors: []graphql.Error{{Message: err.Error()}},
+		})
+		return
+	}
+
+	viewerID := cfg.optionalUserID(r)
+	respondWithJSON(w, http.StatusOK, graphql.Execute(cfg.graphQLRoot(r.Context(), viewerID), fields))
+}
+
+func (cfg *apiConfig) graphQLRoot(ctx context.Context, viewerID uuid.UUID) graphql.Object {
+	return graphql.Object{
+		"me": func(args map[string]any) (any, error) {
+			if viewerID == uuid.Nil {
+				return nil, errors.New("authentication required")
+			}
+			user, err := cfg.db.GetUser(ctx, viewerID)
+			if err != nil {
+				return nil, err
+			}
+			if user == nil {
+				return nil, nil
+			}
+			return cfg.graphQLUser(ctx, *user, viewerID), nil
+		},
+		"video": func(args map[string]any) (any, error) {
+			idString, err := graphql.StringArg(args, "id")
+			if err != nil {
+				return nil, err
+			}
+			id, err := uuid.Parse(idString)
+			if err != nil {
+				return nil, errors.New("invalid video id")
+			}
+			video, err := cfg.db.GetVideo(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(ctx, video, viewerID) {
+				return nil, nil
+			}
+			return cfg.graphQLVideo(ctx, video, viewerID), nil
+		},
+		"channelAnalytics": func(args map[string]any) (any, error) {
+			if viewerID == uuid.Nil {
+				return nil, errors.New("authentication required")
+			}
+			idString, err := graphql.StringArg(args, "channelId")
+			if err != nil {
+				return nil, err
+			}
+			channelID, err := uuid.Parse(idString)
+			if err != nil {
+				return nil, errors.New("invalid channel id")
+			}
+			role, err := cfg.db.GetChannelRole(ctx, channelID, viewerID)
+			if err != nil {
+				return nil, err
+			}
+			if role == "" {
+				return nil, nil
+			}
+			return graphQLAnalytics(args, func(period database.AnalyticsPeriod, start string) ([]database.AnalyticsBucket, error) {
+				return cfg.db.GetChannelAnalytics(ctx, channelID, period, start)
+			})
+		},
+		"videos": func(args map[string]any) (any, error) {
+			first, after, err := graphQLPageArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			videos, more, err := cfg.db.ListVideos(ctx, database.ListVideosParams{
+				PublicOnly: true,
+				Limit:      first,
+				After:      after,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return cfg.graphQLVideoConnection(ctx, videos, more, viewerID), nil
+		},
+	}
+}
+
+func (cfg *apiConfig) graphQLUser(ctx context.Context, user database.User, viewerID uuid.UUID) graphql.Object {
+	return graphql.Object{
+		"__typename": scalarField("User"),
+		"id":         scalarField(user.ID.String()),
+		"email":      scalarField(user.Email),
+		"createdAt":  scalarField(user.CreatedAt),
+		"videos": func(args map[string]any) (any, error) {
+			first, after, err := graphQLPageArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			videos, more, err := cfg.db.ListVideos(ctx, database.ListVideosParams{
+				UserID: user.ID,
+				Limit:  first,
+				After:  after,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return cfg.graphQLVideoConnection(ctx, videos, more, viewerID), nil
+		},
+	}
+}
+
+func (cfg *apiConfig) graphQLVideo(ctx context.Context, video database.Video, viewerID uuid.UUID) graphql.Object {
+	return graphql.Object{
+		"__typename":      scalarField("Video"),
+		"id":              scalarField(video.ID.String()),
+		"title":           scalarField(video.Title),
+		"description":     scalarField(video.Description),
+		"visibility":      scalarField(string(video.Visibility)),
+		"createdAt":       scalarField(video.CreatedAt),
+		"updatedAt":       scalarField(video.UpdatedAt),
+		"thumbnailUrl":    scalarField(video.ThumbnailURL),
+		"videoUrl":        scalarField(video.VideoURL),
+		"durationSeconds": scalarField(video.DurationSeconds),
+		"width":           scalarField(video.Width),
+		"height":          scalarField(video.Height),
+		"frameRate":       scalarField(video.FrameRate),
+		"sizeBytes":       scalarField(video.SizeBytes),
+		"projection":      scalarField(video.Projection),
+		"hdr":             scalarField(video.HDR),
+		"tags": func(args map[string]any) (any, error) {
+			return cfg.db.GetVideoTags(ctx, video.ID)
+		},
+		"owner": func(args map[string]any) (any, error) {
+			return graphql.Object{
+				"__typename": scalarField("Owner"),
+				"id":         scalarField(video.UserID.String()),
+			}, nil
+		},
+		"analytics": func(args map[string]any) (any, error) {
+			if !cfg.canEditVideo(ctx, video, viewerID) {
+				return nil, errors.New("only the video's owner and channel editors can see its analytics")
+			}
+			return graphQLAnalytics(args, func(period database.AnalyticsPeriod, start string) ([]database.AnalyticsBucket, error) {
+				return cfg.db.GetVideoAnalytics(ctx, video.ID, period, start)
+			})
+		},
+	}
+}
+
+// graphQLAnalytics builds an analytics report for the period and days
+// arguments, as the REST analytics endpoints do for their query parameters.
+func graphQLAnalytics(args map[string]any, getBuckets func(period database.AnalyticsPeriod, start string) ([]database.AnalyticsBucket, error)) (any, error) {
+	periodArg, err := graphql.StringArg(args, "period")
+	if err != nil {
+		return nil, err
+	}
+	days, err := graphql.IntArg(args, "days", defaultStatsDays)
+	if err != nil {
+		return nil, err
+	}
+	period, err := checkAnalyticsRange(database.AnalyticsPeriod(strings.ToLower(periodArg)), days)
+	if err != nil {
+		return nil, err
+	}
+	since := statsSince(days)
+	buckets, err := getBuckets(period, analyticsBucketStart(period, since))
+	if err != nil {
+		return nil, err
+	}
+
+	report := newAnalyticsReport(buckets, period, since, days)
+	objects := make([]graphql.Object, len(report.Buckets))
+	for i, b := range report.Buckets {
+		objects[i] = graphql.Object{
+			"__typename":   scalarField("AnalyticsBucket"),
+			"bucket":       scalarField(b.Bucket),
+			"views":        scalarField(b.Views),
+			"sessions":     scalarField(b.Sessions),
+			"watchSeconds": scalarField(b.WatchSeconds),
+			"bufferEvents": scalarField(b.BufferEvents),
+			"bufferMs":     scalarField(b.BufferMS),
+		}
+	}
+	return graphql.Object{
+		"__typename": scalarField("AnalyticsReport"),
+		"period":     scalarField(string(report.Period)),
+		"days":       scalarField(report.Days),
+		"buckets":    scalarField(objects),
+	}, nil
+}
+
+// graphQLVideoConnection builds a Relay-style connection from a page of
+// videos.
+func (cfg *apiConfig) graphQLVideoConnection(ctx context.Context, videos []database.Video, hasNextPage bool, viewerID uuid.UUID) graphql.Object {
+	edges := make([]graphql.Object, len(videos))
+	var endCursor any
+	for i, video := range videos {
+		cursor := encodeCursor(video.Cursor())
+		edges[i] = graphql.Object{
+			"cursor": scalarField(cursor),
+			"node":   scalarField(cfg.graphQLVideo(ctx, video, viewerID)),
+		}
+		endCursor = cursor
+	}
+
+	return graphql.Object{
+		"edges": scalarField(edges),
+		"pageInfo": scalarField(graphql.Object{
+			"hasNextPage": scalarField(hasNextPage),
+			"endCursor":   scalarField(endCursor),
+		}),
+	}
+}
+
+func scalarField(value any) graphql.FieldFunc {
+	return func(args map[string]any) (any, error) {
+		return value, nil
+	}
+}
+
+func graphQLPageArgs(args map[string]any) (first int, after *database.PageCursor, err error) {
+	first, err = graphql.IntArg(args, "first", defaultPageLimit)
+	if err != nil {
+		return 0, nil, err
+	}
+	if first < 1 || first > maxPageLimit {
+		return 0, nil, fmt.Errorf("first must be between 1 and %d", maxPageLimit)
+	}
+	cursor, err := graphql.StringArg(args, "after")
+	if err != nil {
+		return 0, nil, err
+	}
+	if cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return 0, nil, err
+		}
+		after = &c
+	}
+	return first, after, nil
+}
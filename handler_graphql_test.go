@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/graphql"
+	"github.com/google/uuid"
+)
+
+// queryGraphQL posts query to the GraphQL handler, signed in as viewerID
+// unless it's uuid.Nil.
+func queryGraphQL(t *testing.T, cfg *apiConfig, viewerID uuid.UUID, query string, variables map[string]any) graphql.Response {
+	t.Helper()
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	if viewerID != uuid.Nil {
+		authorize(t, req, viewerID)
+	}
+	rec := httptest.NewRecorder()
+	cfg.handlerGraphQL(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp graphql.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestGraphQLVideoAnalytics(t *testing.T) {
+	const query = `query($id: String, $days: Int) {
+		video(id: $id) {
+			...Report
+		}
+	}
+	fragment Report on Video {
+		title
+		analytics(period: HOUR, days: $days) { period days buckets { bucket views } }
+	}`
+	ownerID := uuid.New()
+	video := database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: ownerID, Title: "clip", Visibility: database.VisibilityPublic}}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	t.Run("owner", func(t *testing.T) {
+		cfg, store, _ := newTestConfig(t)
+		stubVideo(store, &video)
+		store.GetVideoAnalyticsFunc = func(ctx context.Context, videoID uuid.UUID, period database.AnalyticsPeriod, since string) ([]database.AnalyticsBucket, error) {
+			if videoID != video.ID || period != database.AnalyticsHour || since != formatAnalyticsHour(today) {
+				t.Errorf("GetVideoAnalytics(%s, %s, %s)", videoID, period, since)
+			}
+			return []database.AnalyticsBucket{{Bucket: since, Views: 4}}, nil
+		}
+
+		resp := queryGraphQL(t, cfg, ownerID, query, map[string]any{"id": video.ID.String(), "days": 1})
+		if len(resp.Errors) != 0 {
+			t.Fatalf("errors = %+v", resp.Errors)
+		}
+		got := resp.Data["video"].(map[string]any)
+		report := got["analytics"].(map[string]any)
+		if got["title"] != "clip" || report["period"] != "hour" || report["days"] != float64(1) {
+			t.Errorf("video = %v", got)
+		}
+		buckets := report["buckets"].([]any)
+		if len(buckets) == 0 || len(buckets) > 24 {
+			t.Fatalf("%d hourly buckets for today", len(buckets))
+		}
+		first := buckets[0].(map[string]any)
+		if first["bucket"] != formatAnalyticsHour(today) || first["views"] != float64(4) {
+			t.Errorf("first bucket = %v", first)
+		}
+	})
+
+	t.Run("viewer", func(t *testing.T) {
+		cfg, store, _ := newTestConfig(t)
+		stubVideo(store, &video)
+
+		// The video is public, but its analytics are for editors only.
+		resp := queryGraphQL(t, cfg, uuid.New(), query, map[string]any{"id": video.ID.String(), "days": 1})
+		got := resp.Data["video"].(map[string]any)
+		if got["title"] != "clip" || got["analytics"] != nil {
+			t.Errorf("video = %v, want the title without analytics", got)
+		}
+		if len(resp.Errors) != 1 || !equalPath(resp.Errors[0].Path, "video", "analytics") {
+			t.Errorf("errors = %+v, want one for video.analytics", resp.Errors)
+		}
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		cfg, store, _ := newTestConfig(t)
+		stubVideo(store, &video)
+
+		resp := queryGraphQL(t, cfg, ownerID, query, map[string]any{"id": video.ID.String(), "days": 30})
+		if len(resp.Errors) != 1 || resp.Errors[0].Message != "hourly reports cover at most 7 days" {
+			t.Errorf("errors = %+v", resp.Errors)
+		}
+	})
+}
+
+func TestGraphQLChannelAnalytics(t *testing.T) {
+	const query = `query($id: String) { channelAnalytics(channelId: $id, days: 2) { period buckets { views } } }`
+	channelID := uuid.New()
+	memberID := uuid.New()
+	setUp := func(t *testing.T) *apiConfig {
+		cfg, store, _ := newTestConfig(t)
+		store.GetChannelRoleFunc = func(ctx context.Context, cID, userID uuid.UUID) (database.ChannelRole, error) {
+			if cID == channelID && userID == memberID {
+				return database.ChannelRoleViewer, nil
+			}
+			return "", nil
+		}
+		store.GetChannelAnalyticsFunc = func(ctx context.Context, cID uuid.UUID, period database.AnalyticsPeriod, since string) ([]database.AnalyticsBucket, error) {
+			if cID != channelID || period != database.AnalyticsDay {
+				t.Errorf("GetChannelAnalytics(%s, %s, %s)", cID, period, since)
+			}
+			return nil, nil
+		}
+		return cfg
+	}
+
+	resp := queryGraphQL(t, setUp(t), memberID, query, map[string]any{"id": channelID.String()})
+	report, _ := resp.Data["channelAnalytics"].(map[string]any)
+	if len(resp.Errors) != 0 || report["period"] != "day" || len(report["buckets"].([]any)) != 2 {
+		t.Errorf("member got %+v, errors %+v", resp.Data, resp.Errors)
+	}
+
+	resp = queryGraphQL(t, setUp(t), uuid.New(), query, map[string]any{"id": channelID.String()})
+	if resp.Data["channelAnalytics"] != nil || len(resp.Errors) != 0 {
+		t.Errorf("non-member got %+v, errors %+v, want null", resp.Data, resp.Errors)
+	}
+
+	resp = queryGraphQL(t, setUp(t), uuid.Nil, query, map[string]any{"id": channelID.String()})
+	if resp.Data["channelAnalytics"] != nil || len(resp.Errors) != 1 {
+		t.Errorf("anonymous viewer got %+v, errors %+v, want an error", resp.Data, resp.Errors)
+	}
+}
+
+func equalPath(path []any, want ...any) bool {
+	if len(path) != len(want) {
+		return false
+	}
+	for i := range path {
+		if path[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
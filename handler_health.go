@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// readinessTimeout bounds each readiness check so a hung dependency fails
+// the probe instead of stalling it.
+const readinessTimeout = 3 * time.Second
+
+// handlerHealthz reports that the process is up and serving. It checks
+// nothing else, so a slow dependency never gets the instance restarted.
+func handlerHealthz(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handlerReadyz checks the instance's dependencies and answers 503 if any
+// of them fails, so load balancers stop sending it traffic.
+func (cfg *apiConfig) handlerReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]func(ctx context.Context) error{
+		"database": cfg.db.Ping,
+		"s3": func(ctx context.Context) error {
+			_, err := cfg.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(cfg.s3Bucket)})
+			return err
+		},
+		"ffmpeg": func(ctx context.Context) error {
+			_, err := exec.LookPath(cfg.ffmpegPath)
+			return err
+		},
+		"ffprobe": func(ctx context.Context) error {
+			_, err := exec.LookPath(cfg.ffprobePath)
+			return err
+		},
+		"uploads_dir": func(ctx context.Context) error {
+			f, err := os.CreateTemp(cfg.uploadsRoot, ".readyz-*")
+			if err != nil {
+				return err
+			}
+			f.Close()
+			return os.Remove(f.Name())
+		},
+	}
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(checks))
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+			defer cancel()
+			results <- result{name, check(ctx)}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	status := http.StatusOK
+	resp := struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}{Status: "ok", Checks: map[string]string{}}
+	for res := range results {
+		if res.err != nil {
+			status = http.StatusServiceUnavailable
+			resp.Status = "unavailable"
+			resp.Checks[res.name] = res.err.Error()
+			continue
+		}
+		resp.Checks[res.name] = "ok"
+	}
+	respondWithJSON(w, status, resp)
+}
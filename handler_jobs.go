@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerJobsList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	status := database.JobStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.Valid() {
+		respondWithError(w, http.StatusBadRequest, "status must be pending, running, succeeded, dead, or cancelled", nil)
+		return
+	}
+
+	jobs, err := cfg.db.ListJobs(r.Context(), status, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve jobs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, jobs)
+}
+
+func (cfg *apiConfig) handlerJobGet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	job, ok := cfg.adminJob(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// errJobNotRetryable and errJobSourceGone explain why retryJob refused.
+var (
+	errJobNotRetryable = errors.New("only dead or cancelled jobs can be retried")
+	errJobSourceGone   = errors.New("the job's upload is no longer available; upload the video again")
+)
+
+// retryJob puts a dead or cancelled job back in the queue with a fresh set
+// of attempts. A processing job needs its spooled upload to still exist.
+func (cfg *apiConfig) retryJob(ctx context.Context, job database.Job) error {
+	if job.Type == jobTypeProcessVideo {
+		var payload processVideoPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("couldn't read job payload: %w", err)
+		}
+		if _, err := os.Stat(payload.SourcePath); err != nil {
+			return errJobSourceGone
+		}
+	}
+
+	retried, err := cfg.db.RetryJob(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+	if !retried {
+		return errJobNotRetryable
+	}
+	if (job.Type == jobTypeProcessVideo || requestedReprocess(job)) && job.VideoID != nil {
+		if err := cfg.db.SetVideoStatus(ctx, *job.VideoID, database.VideoStatusProcessing); err != nil {
+			slog.ErrorContext(ctx, "Couldn't set video status", "video_id", *job.VideoID, "error", err)
+		}
+	}
+	return nil
+}
+
+// handlerJobRetry retries a single dead or cancelled job.
+func (cfg *apiConfig) handlerJobRetry(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	job, ok := cfg.adminJob(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.retryJob(r.Context(), job)
+	if errors.Is(err, errJobNotRetryable) || errors.Is(err, errJobSourceGone) {
+		respondWithError(w, http.StatusConflict, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retry job", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "job.retry", "job", job.ID.String(), map[string]any{"type": job.Type, "previous_status": job.Status})
+
+	cfg.respondWithJob(w, r, job.ID)
+}
+
+// handlerDeadJobsRequeue retries every dead-lettered job, optionally only
+// those of one type, typically after deploying a fix for what killed them.
+// Jobs that can't be retried are reported rather than failing the batch.
+func (cfg *apiConfig) handlerDeadJobsRequeue(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Type string `json:"type"`
+	}
+	type skipped struct {
+		ID     uuid.UUID `json:"id"`
+		Reason string    `json:"reason"`
+	}
+	type response struct {
+		Requeued []uuid.UUID `json:"requeued"`
+		Skipped  []skipped   `json:"skipped"`
+	}
+
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	params := parameters{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+	}
+
+	// Requeued jobs leave the dead state, so the first page is re-read
+	// until only skipped jobs remain on it.
+	resp := response{Requeued: []uuid.UUID{}, Skipped: []skipped{}}
+	seen := map[uuid.UUID]bool{}
+	for offset := 0; ; {
+		jobs, err := cfg.db.ListJobs(r.Context(), database.JobStatusDead, maxPageLimit, offset)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve jobs", err)
+			return
+		}
+		for _, job := range jobs {
+			if seen[job.ID] {
+				continue
+			}
+			seen[job.ID] = true
+			if params.Type != "" && job.Type != params.Type {
+				offset++
+				continue
+			}
+			if err := cfg.retryJob(r.Context(), job); err != nil {
+				resp.Skipped = append(resp.Skipped, skipped{ID: job.ID, Reason: err.Error()})
+				offset++
+				continue
+			}
+			resp.Requeued = append(resp.Requeued, job.ID)
+		}
+		if len(jobs) < maxPageLimit {
+			break
+		}
+	}
+	cfg.audit(r.Context(), adminID, "job.requeue_dead", "job", "", map[string]any{"type": params.Type, "requeued": len(resp.Requeued), "skipped": len(resp.Skipped)})
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerJobCancel cancels a pending or running job. A running job is
+// stopped by its worker within jobCancelCheckInterval, killing any ffmpeg
+// process it started.
+func (cfg *apiConfig) handlerJobCancel(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	job, ok := cfg.adminJob(w, r)
+	if !ok {
+		return
+	}
+
+	cancelled, err := cfg.db.CancelJob(r.Context(), job.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't cancel job", err)
+		return
+	}
+	if !cancelled {
+		respondWithError(w, http.StatusConflict, "Only pending or running jobs can be cancelled", nil)
+		return
+	}
+	if job.Type == jobTypeProcessVideo && job.VideoID != nil {
+		var payload processVideoPayload
+		if err := json.Unmarshal(job.Payload, &payload); err == nil {
+			cfg.restoreVideoStatus(r.Context(), *job.VideoID, payload)
+		}
+	}
+	if requestedReprocess(job) {
+		if err := cfg.db.SetVideoStatus(r.Context(), *job.VideoID, database.VideoStatusFailed); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't reset video status", "video_id", *job.VideoID, "error", err)
+		}
+	}
+	cfg.audit(r.Context(), adminID, "job.cancel", "job", job.ID.String(), map[string]any{"type": job.Type, "previous_status": job.Status})
+
+	cfg.respondWithJob(w, r, job.ID)
+}
+
+// adminJob loads the job named in the path, writing an error response if
+// it can't.
+func (cfg *apiConfig) adminJob(w http.ResponseWriter, r *http.Request) (database.Job, bool) {
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Job{}, false
+	}
+	job, err := cfg.db.GetJob(r.Context(), jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+		return database.Job{}, false
+	}
+	if job.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get job", nil)
+		return database.Job{}, false
+	}
+	return job, true
+}
+
+func (cfg *apiConfig) respondWithJob(w http.ResponseWriter, r *http.Request, jobID uuid.UUID) {
+	job, err := cfg.db.GetJob(r.Context(), jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get job", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mocks"
+	"github.com/google/uuid"
+)
+
+// jobAdminTest is an admin acting on one job through the admin API.
+type jobAdminTest struct {
+	cfg      *apiConfig
+	store    *mocks.Store
+	adminID  uuid.UUID
+	job      database.Job
+	statuses *[]database.VideoStatus
+	audited  []string
+}
+
+func newJobAdminTest(t *testing.T, status database.JobStatus, payload processVideoPayload) *jobAdminTest {
+	t.Helper()
+	cfg, store, _ := newTestConfig(t)
+	videoID := uuid.New()
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jt := &jobAdminTest{
+		cfg:     cfg,
+		store:   store,
+		adminID: uuid.New(),
+		job:     database.Job{ID: uuid.New(), Type: jobTypeProcessVideo, VideoID: &videoID, Payload: rawPayload, Status: status},
+	}
+	jt.statuses = stubVideo(store, &database.Video{ID: videoID})
+	store.GetUserFunc = func(ctx context.Context, id uuid.UUID) (*database.User, error) {
+		return &database.User{ID: id}, nil
+	}
+	store.IsUserAdminFunc = func(ctx context.Context, id uuid.UUID) (bool, error) {
+		return id == jt.adminID, nil
+	}
+	store.GetJobFunc = func(ctx context.Context, id uuid.UUID) (database.Job, error) {
+		if id != jt.job.ID {
+			return database.Job{}, nil
+		}
+		return jt.job, nil
+	}
+	store.CreateAuditLogEntryFunc = func(ctx context.Context, params database.CreateAuditLogEntryParams) error {
+		jt.audited = append(jt.audited, params.Action)
+		return nil
+	}
+	return jt
+}
+
+// do calls handler for the job as userID.
+func (jt *jobAdminTest) do(t *testing.T, handler http.HandlerFunc, userID uuid.UUID) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/admin/jobs/"+jt.job.ID.String(), nil)
+	req.SetPathValue("jobID", jt.job.ID.String())
+	authorize(t, req, userID)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestHandlerJobRetry(t *testing.T) {
+	spooled := filepath.Join(t.TempDir(), "upload.mp4")
+	if err := os.WriteFile(spooled, []byte("mp4"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		sourcePath string
+		asAdmin    bool
+		retryable  bool
+		wantStatus int
+	}{
+		{"dead job", spooled, true, true, http.StatusOK},
+		{"not dead or cancelled", spooled, true, false, http.StatusConflict},
+		{"upload gone", filepath.Join(t.TempDir(), "gone.mp4"), true, true, http.StatusConflict},
+		{"not an admin", spooled, false, true, http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			jt := newJobAdminTest(t, database.JobStatusDead, processVideoPayload{SourcePath: tc.sourcePath})
+			retried := false
+			jt.store.RetryJobFunc = func(ctx context.Context, id uuid.UUID) (bool, error) {
+				if !tc.retryable {
+					return false, nil
+				}
+				retried = true
+				jt.job.Status = database.JobStatusPending
+				return true, nil
+			}
+			userID := jt.adminID
+			if !tc.asAdmin {
+				userID = uuid.New()
+			}
+
+			rec := jt.do(t, jt.cfg.handlerJobRetry, userID)
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				if retried || len(*jt.statuses) != 0 || len(jt.audited) != 0 {
+					t.Errorf("refused retry still retried = %v, set statuses %v, audited %v", retried, *jt.statuses, jt.audited)
+				}
+				return
+			}
+			var job database.Job
+			if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != database.JobStatusPending {
+				t.Errorf("job status = %s, want pending", job.Status)
+			}
+			if len(*jt.statuses) != 1 || (*jt.statuses)[0] != database.VideoStatusProcessing {
+				t.Errorf("video statuses = %v, want [processing]", *jt.statuses)
+			}
+			if len(jt.audited) != 1 || jt.audited[0] != "job.retry" {
+				t.Errorf("audited %v, want [job.retry]", jt.audited)
+			}
+		})
+	}
+}
+
+func TestHandlerJobCancel(t *testing.T) {
+	tests := []struct {
+		name       string
+		hadVideo   bool
+		cancelable bool
+		wantStatus int
+		wantVideo  []database.VideoStatus
+	}{
+		{"first upload", false, true, http.StatusOK, []database.VideoStatus{database.VideoStatusFailed}},
+		{"replacement upload", true, true, http.StatusOK, []database.VideoStatus{database.VideoStatusReady}},
+		{"already finished", false, false, http.StatusConflict, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			jt := newJobAdminTest(t, database.JobStatusRunning, processVideoPayload{SourcePath: "/tmp/upload.mp4", HadVideo: tc.hadVideo})
+			jt.store.CancelJobFunc = func(ctx context.Context, id uuid.UUID) (bool, error) {
+				if !tc.cancelable {
+					return false, nil
+				}
+				jt.job.Status = database.JobStatusCancelled
+				return true, nil
+			}
+
+			rec := jt.do(t, jt.cfg.handlerJobCancel, jt.adminID)
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body)
+			}
+			if len(*jt.statuses) != len(tc.wantVideo) || (len(tc.wantVideo) > 0 && (*jt.statuses)[0] != tc.wantVideo[0]) {
+				t.Errorf("video statuses = %v, want %v", *jt.statuses, tc.wantVideo)
+			}
+			wantAudit := 0
+			if tc.cancelable {
+				wantAudit = 1
+			}
+			if len(jt.audited) != wantAudit {
+				t.Errorf("audited %v", jt.audited)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// handlerStreamKeyCreate gives the user a new stream key, replacing the one
+// they had. The key is only shown here; streams already live keep going.
+func (cfg *apiConfig) handlerStreamKeyCreate(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		StreamKey string `json:"stream_key"`
+		IngestURL string `json:"ingest_url"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	if cfg.live.address == "" {
+		respondWithError(w, http.StatusNotImplemented, "Live streaming isn't enabled on this server", nil)
+		return
+	}
+	if cfg.rejectBanned(r.Context(), w, userID) || cfg.rejectSuspended(r.Context(), w, userID) {
+		return
+	}
+
+	key, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create stream key", err)
+		return
+	}
+	if err := cfg.db.SetStreamKey(r.Context(), userID, hashStreamKey(key)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save stream key", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{
+		StreamKey: key,
+		IngestURL: cfg.live.ingestURL,
+	})
+}
+
+// handlerStreamKeyUpdate changes the settings of the user's stream key. They
+// apply to the next stream published with it.
+func (cfg *apiConfig) handlerStreamKeyUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		LowLatency *bool `json:"low_latency"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	streamKey, err := cfg.db.GetStreamKey(r.Context(), userID)
+	if params.LowLatency != nil && err == nil {
+		streamKey, err = cfg.db.SetStreamKeyLowLatency(r.Context(), userID, *params.LowLatency)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update stream key", err)
+		return
+	}
+	if streamKey == nil {
+		respondWithError(w, http.StatusNotFound, "You don't have a stream key", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, streamKey)
+}
+
+// handlerLiveStreamsList lists the user's live streams, newest first.
+func (cfg *apiConfig) handlerLiveStreamsList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	streams, err := cfg.db.ListLiveStreams(r.Context(), userID, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get live streams", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, streams)
+}
@@ -13,6 +13,9 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
+		// NewPassword replaces the password when an admin has required a
+		// reset.
+		NewPassword string `json:"new_password"`
 	}
 	type response struct {
 		database.User
@@ -28,7 +31,7 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByEmail(params.Email)
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
@@ -39,6 +42,34 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
+	if cfg.rejectBanned(r.Context(), w, user.ID) {
+		return
+	}
+	resetRequired, err := cfg.db.IsPasswordResetRequired(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if resetRequired {
+		if params.NewPassword == "" {
+			respondWithErrorCode(w, http.StatusForbidden, errCodePasswordResetNeeded, "You must choose a new password", nil, nil)
+			return
+		}
+		if params.NewPassword == params.Password {
+			respondWithError(w, http.StatusBadRequest, "New password must be different", nil)
+			return
+		}
+		hashedPassword, err := auth.HashPassword(params.NewPassword)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			return
+		}
+		if err := cfg.db.SetUserPassword(r.Context(), user.ID, hashedPassword); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update password", err)
+			return
+		}
+		user.Password = hashedPassword
+	}
 
 	accessToken, err := auth.MakeJWT(
 		user.ID,
@@ -56,7 +87,7 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{
+	_, err = cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
 		UserID:    user.ID,
 		Token:     refreshToken,
 		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
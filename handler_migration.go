@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// handlerMigrationExport streams every user and video, with their files,
+// as an archive another instance can import.
+func (cfg *apiConfig) handlerMigrationExport(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	cfg.audit(r.Context(), adminID, "migration.export", "instance", "", nil)
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tubely-migration-%s.tar.gz"`, time.Now().UTC().Format("20060102T150405Z")))
+	// Once the archive has started there's no way to report an error but to
+	// cut it short, which the importer sees as a broken archive.
+	if err := cfg.writeMigrationArchive(r.Context(), w); err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't write migration archive", "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// handlerMigrationImport imports users and videos from another instance.
+// The body is either the archive itself, or JSON naming the instance to
+// pull it from with an admin's access token there.
+func (cfg *apiConfig) handlerMigrationImport(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		SourceURL   string `json:"source_url"`
+		SourceToken string `json:"source_token"`
+	}
+
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var archive io.Reader = r.Body
+	source := "archive"
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		params := parameters{}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+		if params.SourceURL == "" || params.SourceToken == "" {
+			respondWithError(w, http.StatusBadRequest, "source_url and source_token are required", nil)
+			return
+		}
+		body, err := fetchMigrationArchive(r.Context(), params.SourceURL, params.SourceToken)
+		if err != nil {
+			respondWithError(w, http.StatusBadGateway, "Couldn't download archive from source", err)
+			return
+		}
+		defer body.Close()
+		archive = body
+		source = params.SourceURL
+	}
+
+	result, err := cfg.importMigrationArchive(r.Context(), archive)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't import archive", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "migration.import", "instance", "", map[string]any{
+		"source":          source,
+		"users_imported":  result.UsersImported,
+		"videos_imported": result.VideosImported,
+	})
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type moderationAction string
+
+const (
+	moderationActionDismiss  moderationAction = "dismiss"
+	moderationActionUnlist   moderationAction = "unlist"
+	moderationActionTakeDown moderationAction = "take_down"
+	moderationActionBanUser  moderationAction = "ban_user"
+)
+
+func (cfg *apiConfig) handlerModerationQueue(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	queue, err := cfg.db.GetModerationQueue(r.Context(), limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve moderation queue", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, queue)
+}
+
+// handlerModerationScans lists videos automated scanning flagged, or with
+// ?verdict= those it quarantined or passed.
+func (cfg *apiConfig) handlerModerationScans(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	verdict := database.ModerationVerdictFlagged
+	if v := r.URL.Query().Get("verdict"); v != "" {
+		verdict = database.ModerationVerdict(v)
+		if !verdict.Valid() {
+			respondWithError(w, http.StatusBadRequest, "verdict must be clean, flagged, or quarantined", nil)
+			return
+		}
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	scans, err := cfg.db.GetModerationScans(r.Context(), verdict, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve moderation scans", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, scans)
+}
+
+func (cfg *apiConfig) handlerModerationAction(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Action moderationAction `json:"action"`
+		Note   string           `json:"note"`
+	}
+
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	switch params.Action {
+	case moderationActionDismiss:
+	case moderationActionUnlist:
+		if video.Visibility == database.VisibilityPublic {
+			err = cfg.db.SetVideoVisibility(r.Context(), video.ID, database.VisibilityUnlisted)
+		}
+	case moderationActionTakeDown:
+		err = cfg.db.TakeDownVideo(r.Context(), video.ID)
+	case moderationActionBanUser:
+		err = cfg.db.BanUser(r.Context(), video.UserID)
+		if err == nil {
+			err = cfg.db.TakeDownUserVideos(r.Context(), video.UserID)
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, "action must be dismiss, unlist, take_down, or ban_user", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't apply moderation action", err)
+		return
+	}
+
+	err = cfg.db.ResolveVideoReports(r.Context(), video.ID, string(params.Action))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resolve reports", err)
+		return
+	}
+
+	details := map[string]string{"note": params.Note}
+	if params.Action == moderationActionBanUser {
+		details["user_id"] = video.UserID.String()
+	}
+	cfg.audit(r.Context(), adminID, "moderation."+string(params.Action), "video", video.ID.String(), details)
+
+	video, err = cfg.db.GetVideo(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+func (cfg *apiConfig) handlerAuditLog(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	entries, err := cfg.db.GetAuditLog(r.Context(), limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve audit log", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultEmbedWidth  = 640
+	defaultEmbedHeight = 360
+)
+
+// oEmbedResponse is a "video" type response as described by
+// https://oembed.com/#section2.3.
+type oEmbedResponse struct {
+	Type            string `json:"type"`
+	Version         string `json:"version"`
+	Title           string `json:"title"`
+	ProviderName    string `json:"provider_name"`
+	ProviderURL     string `json:"provider_url"`
+	HTML            string `json:"html"`
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+}
+
+func (cfg *apiConfig) handlerOEmbed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		respondWithError(w, http.StatusNotImplemented, "Only the json format is supported", nil)
+		return
+	}
+
+	videoID, err := cfg.videoIDFromURL(r, query.Get("url"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "url is not a tubely video link", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	// Embeds are rendered for anonymous visitors, so private videos are never
+	// embeddable even when the request is authenticated.
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(r.Context(), video, uuid.Nil) || onOtherChannelHost(r.Context(), video) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	// The iframe oEmbed hands out has no token, so it wouldn't load.
+	settings, err := cfg.db.GetEmbedSettings(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get embed settings", err)
+		return
+	}
+	if settings != nil && settings.RequireToken {
+		respondWithError(w, http.StatusForbidden, "Video can only be embedded with an embed token", nil)
+		return
+	}
+
+	maxWidth, err := optionalPositiveInt(query.Get("maxwidth"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "maxwidth must be a positive integer", err)
+		return
+	}
+	maxHeight, err := optionalPositiveInt(query.Get("maxheight"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "maxheight must be a positive integer", err)
+		return
+	}
+	width, height := embedSize(video, maxWidth, maxHeight)
+
+	baseURL := cfg.publicBaseURL(r)
+	embedURL := fmt.Sprintf("%s/embed/%s", baseURL, video.ID)
+	resp := oEmbedResponse{
+		Type:         "video",
+		Version:      "1.0",
+		Title:        video.Title,
+		ProviderName: "Tubely",
+		ProviderURL:  baseURL,
+		HTML: fmt.Sprintf(
+			`<iframe src="%s" width="%d" height="%d" title="%s" frameborder="0" allow="autoplay; fullscreen; picture-in-picture" allowfullscreen></iframe>`,
+			html.EscapeString(embedURL), width, height, html.EscapeString(video.Title),
+		),
+		Width:  width,
+		Height: height,
+	}
+	if video.ThumbnailURL != nil {
+		resp.ThumbnailURL = *video.ThumbnailURL
+		resp.ThumbnailWidth = width
+		resp.ThumbnailHeight = height
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// videoIDFromURL extracts the video ID from a link to one of our video pages:
+// /api/v1/videos/{id}, /api/videos/{id}, or /embed/{id} on this server, or
+// on the channel domain the request came in on.
+func (cfg *apiConfig) videoIDFromURL(r *http.Request, rawURL string) (uuid.UUID, error) {
+	if rawURL == "" {
+		return uuid.Nil, fmt.Errorf("missing url")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	base, err := url.Parse(cfg.baseURL)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	host, onChannelHost := channelHostFromContext(r.Context())
+	if !strings.EqualFold(u.Host, base.Host) && !(onChannelHost && strings.EqualFold(u.Host, host.Domain)) {
+		return uuid.Nil, fmt.Errorf("unknown host %q", u.Host)
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	for _, prefix := range []string{apiVersionPrefix + "/videos/", "/api/videos/", "/embed/"} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			return uuid.Parse(rest)
+		}
+	}
+	return uuid.Nil, fmt.Errorf("unrecognized path %q", u.Path)
+}
+
+// embedSize picks player dimensions matching the video's aspect ratio that
+// fit within the consumer's maxwidth and maxheight (0 means no limit).
+func embedSize(video database.Video, maxWidth, maxHeight int) (int, int) {
+	width, height := defaultEmbedWidth, defaultEmbedHeight
+	if video.Width != nil && video.Height != nil && *video.Width > 0 && *video.Height > 0 {
+		height = width * *video.Height / *video.Width
+	}
+	if maxWidth > 0 && width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if maxHeight > 0 && height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+	return width, height
+}
+
+func optionalPositiveInt(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%d is not positive", n)
+	}
+	return n, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerPlaybackPositionSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		PositionSeconds *float64 `json:"position_seconds"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.PositionSeconds == nil || *params.PositionSeconds < 0 || math.IsNaN(*params.PositionSeconds) || math.IsInf(*params.PositionSeconds, 0) {
+		respondWithError(w, http.StatusBadRequest, "position_seconds must be a non-negative number", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(r.Context(), video, userID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	positionSeconds := *params.PositionSeconds
+	if video.DurationSeconds != nil && positionSeconds > *video.DurationSeconds {
+		positionSeconds = *video.DurationSeconds
+	}
+
+	position, err := cfg.db.SetPlaybackPosition(r.Context(), userID, video.ID, positionSeconds)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save playback position", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, position)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type podcastFeed struct {
+	XMLName  xml.Name       `xml:"rss"`
+	Version  string         `xml:"version,attr"`
+	ITunesNS string         `xml:"xmlns:itunes,attr"`
+	AtomNS   string         `xml:"xmlns:atom,attr"`
+	Channel  podcastChannel `xml:"channel"`
+}
+
+type podcastChannel struct {
+	Title         string        `xml:"title"`
+	Link          string        `xml:"link"`
+	Description   string        `xml:"description"`
+	AtomLink      atomLink      `xml:"atom:link"`
+	LastBuildDate string        `xml:"lastBuildDate,omitempty"`
+	Author        string        `xml:"itunes:author"`
+	Summary       string        `xml:"itunes:summary"`
+	Image         *itunesImage  `xml:"itunes:image,omitempty"`
+	Explicit      string        `xml:"itunes:explicit"`
+	Type          string        `xml:"itunes:type"`
+	Items         []podcastItem `xml:"item"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type podcastItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Description string       `xml:"description"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	Duration    int          `xml:"itunes:duration,omitempty"`
+	Summary     string       `xml:"itunes:summary,omitempty"`
+	Image       *itunesImage `xml:"itunes:image,omitempty"`
+	Explicit    string       `xml:"itunes:explicit"`
+}
+
+// handlerChannelPodcast renders a podcast feed of a channel's latest public
+// videos that have an audio rendition, with the audio as each episode's
+// enclosure and the newest thumbnail as the show's artwork.
+func (cfg *apiConfig) handlerChannelPodcast(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(r.PathValue("channelID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID", err)
+		return
+	}
+
+	channel, err := cfg.db.GetChannel(r.Context(), channelID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get channel", err)
+		return
+	}
+	if channel.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Channel not found", nil)
+		return
+	}
+
+	videos, _, err := cfg.db.ListVideos(r.Context(), database.ListVideosParams{
+		ChannelID:  channel.ID,
+		PublicOnly: true,
+		Status:     database.VideoStatusReady,
+		Limit:      feedItemLimit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	description := channel.Description
+	if description == "" {
+		description = channel.Name
+	}
+	// On a channel's custom domain, links stay on it.
+	baseURL := cfg.publicBaseURL(r)
+	link, self := baseURL+"/app/", baseURL+r.URL.Path
+	_, onChannelHost := channelHostFromContext(r.Context())
+	if onChannelHost {
+		link, self = baseURL+"/", baseURL+"/podcast.rss"
+	}
+	feed := podcastFeed{
+		Version:  "2.0",
+		ITunesNS: "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		AtomNS:   "http://www.w3.org/2005/Atom",
+		Channel: podcastChannel{
+			Title:       channel.Name,
+			Link:        link,
+			Description: description,
+			AtomLink: atomLink{
+				Href: self,
+				Rel:  "self",
+				Type: "application/rss+xml",
+			},
+			Author:   channel.Name,
+			Summary:  description,
+			Explicit: "false",
+			Type:     "episodic",
+			Items:    []podcastItem{},
+		},
+	}
+
+	expiresAt := cfg.playbackTokenExpiry(time.Now())
+	for _, video := range videos {
+		renditions, err := cfg.db.GetRenditions(r.Context(), video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get renditions", err)
+			return
+		}
+		var audio *database.Rendition
+		for i := range renditions {
+			if renditions[i].Quality == database.RenditionQualityAudio {
+				audio = &renditions[i]
+				break
+			}
+		}
+		if audio == nil {
+			continue
+		}
+
+		audioURL := cfg.playbackURL(r.Context(), fmt.Sprintf("%s/%s", cfg.s3CfDistribution, audio.S3Key), video.ID, uuid.Nil, expiresAt)
+		link := fmt.Sprintf("%s%s/videos/%s", baseURL, apiVersionPrefix, video.ID)
+		if onChannelHost {
+			link = fmt.Sprintf("%s/embed/%s", baseURL, video.ID)
+		}
+		item := podcastItem{
+			Title:       video.Title,
+			Link:        link,
+			Description: video.Description,
+			GUID:        rssGUID{Value: video.ID.String()},
+			PubDate:     video.CreatedAt.UTC().Format(time.RFC1123Z),
+			Enclosure: rssEnclosure{
+				URL:    audioURL,
+				Length: audio.SizeBytes,
+				Type:   audioMediaType,
+			},
+			Summary:  video.Description,
+			Explicit: "false",
+		}
+		if video.DurationSeconds != nil {
+			item.Duration = int(*video.DurationSeconds)
+		}
+		if video.ThumbnailURL != nil {
+			item.Image = &itunesImage{Href: *video.ThumbnailURL}
+			if feed.Channel.Image == nil {
+				feed.Channel.Image = &itunesImage{Href: *video.ThumbnailURL}
+			}
+		}
+		if feed.Channel.LastBuildDate == "" {
+			feed.Channel.LastBuildDate = item.PubDate
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	dat, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't render feed", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(dat)
+}
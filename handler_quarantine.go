@@ -0,0 +1,202 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// quarantinePreviewExpiry is how long a reviewer's link to a quarantined
+// file works.
+const quarantinePreviewExpiry = 5 * time.Minute
+
+// handlerQuarantineList lists quarantined files awaiting review, oldest
+// first, or with ?status= those already released or rejected.
+func (cfg *apiConfig) handlerQuarantineList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	status := database.QuarantinePending
+	if s := r.URL.Query().Get("status"); s != "" {
+		status = database.QuarantineStatus(s)
+		if !status.Valid() {
+			respondWithError(w, http.StatusBadRequest, "status must be pending, released, or rejected", nil)
+			return
+		}
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	objects, err := cfg.db.ListQuarantinedObjects(r.Context(), status, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list quarantined files", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, objects)
+}
+
+// handlerQuarantinePreview returns a short-lived signed link to a
+// quarantined file so a reviewer can watch it.
+func (cfg *apiConfig) handlerQuarantinePreview(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	q, ok := cfg.pendingQuarantinedObject(w, r)
+	if !ok {
+		return
+	}
+
+	req, err := cfg.s3Presigner.PresignGetObject(r.Context(), &s3.GetObjectInput{
+		Bucket: &q.Bucket,
+		Key:    &q.Key,
+	}, s3.WithPresignExpires(quarantinePreviewExpiry))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign preview URL", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"url":        req.URL,
+		"expires_at": time.Now().UTC().Add(quarantinePreviewExpiry),
+	})
+}
+
+// handlerQuarantineRelease moves a quarantined file back to where it was
+// served from and lifts the video's takedown.
+func (cfg *apiConfig) handlerQuarantineRelease(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	q, ok := cfg.pendingQuarantinedObject(w, r)
+	if !ok {
+		return
+	}
+
+	// Releasing a file the video no longer uses would only leave an orphan
+	// in the bucket.
+	renditions, err := cfg.db.GetRenditions(r.Context(), q.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get renditions", err)
+		return
+	}
+	inUse := slices.ContainsFunc(renditions, func(rendition database.Rendition) bool {
+		return rendition.S3Key == q.OriginalKey
+	})
+	if !inUse {
+		respondWithError(w, http.StatusConflict, "Video has a newer file, reject this one instead", nil)
+		return
+	}
+
+	if err := cfg.copyS3Object(r.Context(), q.Bucket, q.Key, cfg.s3Bucket, q.OriginalKey); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video file", err)
+		return
+	}
+	if !cfg.lockReleasedFile(w, r, q) {
+		return
+	}
+	if err := cfg.db.ReleaseQuarantinedObject(r.Context(), q.VideoID, adminID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't release video", err)
+		return
+	}
+	if err := cfg.deleteQuarantinedFile(r.Context(), q); err != nil {
+		slog.ErrorContext(r.Context(), "Couldn't delete released quarantine file", "video_id", q.VideoID, "key", q.Key, "error", err)
+	}
+	cfg.audit(r.Context(), adminID, "quarantine.release", "video", q.VideoID.String(), nil)
+	cfg.respondQuarantinedVideo(w, r, q.VideoID)
+}
+
+// lockReleasedFile puts a released file under Object Lock if its owner is in
+// compliance mode, as it would have been if it hadn't been quarantined.
+func (cfg *apiConfig) lockReleasedFile(w http.ResponseWriter, r *http.Request, q database.QuarantinedObject) bool {
+	video, err := cfg.db.GetVideo(r.Context(), q.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return false
+	}
+	retainUntil, err := cfg.uploadRetainUntil(r.Context(), video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get retention", err)
+		return false
+	}
+	if retainUntil == nil {
+		return true
+	}
+	if err := cfg.setS3Retention(r.Context(), q.OriginalKey, *retainUntil); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't lock video file", err)
+		return false
+	}
+	if err := cfg.db.ExtendVideoRetention(r.Context(), video.ID, *retainUntil); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record retention", err)
+		return false
+	}
+	return true
+}
+
+// handlerQuarantineReject deletes a quarantined file. The video stays taken
+// down without a file.
+func (cfg *apiConfig) handlerQuarantineReject(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	q, ok := cfg.pendingQuarantinedObject(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.deleteQuarantinedFile(r.Context(), q); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete quarantined file", err)
+		return
+	}
+	if err := cfg.db.RejectQuarantinedObject(r.Context(), q.VideoID, adminID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reject video", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "quarantine.reject", "video", q.VideoID.String(), nil)
+	cfg.respondQuarantinedVideo(w, r, q.VideoID)
+}
+
+// pendingQuarantinedObject loads the quarantined file of the video in the
+// path. It writes an error response and returns false unless the file is
+// still waiting for review.
+func (cfg *apiConfig) pendingQuarantinedObject(w http.ResponseWriter, r *http.Request) (database.QuarantinedObject, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.QuarantinedObject{}, false
+	}
+	q, err := cfg.db.GetQuarantinedObject(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get quarantined file", err)
+		return database.QuarantinedObject{}, false
+	}
+	if q == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no quarantined file", nil)
+		return database.QuarantinedObject{}, false
+	}
+	if q.Status != database.QuarantinePending {
+		respondWithError(w, http.StatusConflict, "Quarantined file has already been reviewed", nil)
+		return database.QuarantinedObject{}, false
+	}
+	return *q, true
+}
+
+func (cfg *apiConfig) respondQuarantinedVideo(w http.ResponseWriter, r *http.Request, videoID uuid.UUID) {
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerQuotaGet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	status, err := cfg.quotaStatus(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get quota", err)
+		return
+	}
+	setQuotaHeaders(w, status)
+	respondWithJSON(w, http.StatusOK, status)
+}
+
+func (cfg *apiConfig) handlerAdminQuotaGet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	status, err := cfg.quotaStatus(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get quota", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, status)
+}
+
+// handlerAdminQuotaSet overrides a user's limits. Omitted limits keep the
+// configured default; zero lifts the limit.
+func (cfg *apiConfig) handlerAdminQuotaSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		StorageBytes *int64 `json:"storage_bytes"`
+		VideosPerDay *int   `json:"videos_per_day"`
+	}
+
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if (params.StorageBytes != nil && *params.StorageBytes < 0) || (params.VideosPerDay != nil && *params.VideosPerDay < 0) {
+		respondWithError(w, http.StatusBadRequest, "Limits can't be negative", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", nil)
+		return
+	}
+
+	quota, err := cfg.db.SetUserQuota(r.Context(), database.UserQuota{
+		UserID:       userID,
+		StorageBytes: params.StorageBytes,
+		VideosPerDay: params.VideosPerDay,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set quota", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "quota.set", "user", userID.String(), quota)
+
+	status, err := cfg.quotaStatus(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get quota", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, status)
+}
+
+func (cfg *apiConfig) handlerAdminQuotaReset(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	if err := cfg.db.DeleteUserQuota(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset quota", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "quota.reset", "user", userID.String(), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
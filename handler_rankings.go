@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// rankingWindows are the time windows accepted by the trending and top
+// endpoints.
+var rankingWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+var trendingWindows = []string{"day", "week"}
+
+// viewRetention is how long individual views are kept for windowed rankings.
+// All-time totals live on the video row.
+const viewRetention = 30 * 24 * time.Hour
+
+// runTrendingAggregator periodically recomputes the trending scores for
+// every trending window. It returns when ctx is cancelled.
+func (cfg *apiConfig) runTrendingAggregator(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, window := range trendingWindows {
+			err := cfg.db.RefreshTrendingScores(ctx, window, rankingWindows[window])
+			if err != nil {
+				slog.ErrorContext(ctx, "Couldn't refresh trending scores", "window", window, "error", err)
+			}
+		}
+		err := cfg.db.DeleteViewsBefore(ctx, time.Now().Add(-viewRetention))
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't prune old views", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerVideosTrending(w http.ResponseWriter, r *http.Request) {
+	limit, _, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "day"
+	}
+	if !slices.Contains(trendingWindows, window) {
+		respondWithError(w, http.StatusBadRequest, "window must be day or week", nil)
+		return
+	}
+
+	videos, err := cfg.db.GetTrendingVideos(r.Context(), window, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve trending videos", err)
+		return
+	}
+	cfg.rotateRankedThumbnails(r.Context(), videos)
+	respondWithJSON(w, http.StatusOK, videos)
+}
+
+func (cfg *apiConfig) handlerVideosTop(w http.ResponseWriter, r *http.Request) {
+	limit, _, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	var since time.Time
+	switch window := r.URL.Query().Get("window"); window {
+	case "", "all":
+	default:
+		length, ok := rankingWindows[window]
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, "window must be day, week, month, or all", nil)
+			return
+		}
+		since = time.Now().Add(-length)
+	}
+
+	videos, err := cfg.db.GetTopVideos(r.Context(), since, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve top videos", err)
+		return
+	}
+	cfg.rotateRankedThumbnails(r.Context(), videos)
+	respondWithJSON(w, http.StatusOK, videos)
+}
+
+// rotateRankedThumbnails is rotateThumbnails for ranked listings.
+func (cfg *apiConfig) rotateRankedThumbnails(ctx context.Context, ranked []database.RankedVideo) {
+	videos := make([]database.Video, len(ranked))
+	for i := range ranked {
+		videos[i] = ranked[i].Video
+	}
+	cfg.rotateThumbnails(ctx, videos)
+	for i := range ranked {
+		ranked[i].Video = videos[i]
+	}
+}
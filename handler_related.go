@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxRelatedCandidates = 200
+	maxRelatedTitleWords = 5
+
+	relatedTagWeight   = 3.0
+	relatedOwnerWeight = 1.0
+	relatedTitleWeight = 2.0
+)
+
+func (cfg *apiConfig) handlerVideoRelated(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	limit, _, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(r.Context(), video, cfg.optionalUserID(r)) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	words := titleWords(video.Title)
+	searchWords := words
+	if len(searchWords) > maxRelatedTitleWords {
+		searchWords = searchWords[:maxRelatedTitleWords]
+	}
+	candidates, err := cfg.db.GetRelatedVideoCandidates(r.Context(), video, searchWords, maxRelatedCandidates)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve related videos", err)
+		return
+	}
+
+	ids := make([]uuid.UUID, len(candidates))
+	for i, candidate := range candidates {
+		ids[i] = candidate.ID
+	}
+	candidateTags, err := cfg.db.GetTagsForVideos(r.Context(), ids)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve related videos", err)
+		return
+	}
+
+	type scored struct {
+		video database.Video
+		score float64
+	}
+	results := make([]scored, 0, len(candidates))
+	for _, candidate := range candidates {
+		candidate.Tags = candidateTags[candidate.ID]
+		score := relatedTagWeight * float64(countShared(video.Tags, candidate.Tags))
+		if candidate.UserID == video.UserID {
+			score += relatedOwnerWeight
+		}
+		score += relatedTitleWeight * jaccard(words, titleWords(candidate.Title))
+		results = append(results, scored{video: candidate, score: score})
+	}
+	// Candidates arrive newest first, so a stable sort keeps recency as the
+	// tie-breaker.
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	related := []database.Video{}
+	for i := 0; i < len(results) && i < limit; i++ {
+		related = append(related, results[i].video)
+	}
+
+	respondWithJSON(w, http.StatusOK, related)
+}
+
+var titleStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "this": true,
+	"that": true, "from": true, "you": true, "your": true, "how": true,
+}
+
+// titleWords splits a title into distinct lowercase words, skipping short
+// and common ones that say little about the topic.
+func titleWords(title string) []string {
+	seen := map[string]bool{}
+	words := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) < 3 || titleStopWords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	return words
+}
+
+func countShared(a, b []string) int {
+	set := map[string]bool{}
+	for _, s := range a {
+		set[s] = true
+	}
+	n := 0
+	for _, s := range b {
+		if set[s] {
+			n++
+		}
+	}
+	return n
+}
+
+func jaccard(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := countShared(a, b)
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
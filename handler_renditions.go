@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// handlerAdminVideoRenditions lists a video's renditions with their storage
+// keys and quality scores.
+func (cfg *apiConfig) handlerAdminVideoRenditions(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	renditions, err := cfg.db.GetRenditions(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get renditions", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, renditions)
+}
+
+// handlerRenditionQuality summarizes quality scores by rendition quality
+// and codec, to compare encoding presets.
+func (cfg *apiConfig) handlerRenditionQuality(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	stats, err := cfg.db.GetRenditionQualityStats(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get rendition quality", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, stats)
+}
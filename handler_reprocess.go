@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerVideoReprocess runs a video whose processing failed through the
+// pipeline again, so a transient ffmpeg error doesn't mean uploading the
+// file again. The failed job is retried while its spooled upload is still
+// kept; after that a failed video is reprocessed from its stored file, if
+// it has one.
+func (cfg *apiConfig) handlerVideoReprocess(w http.ResponseWriter, r *http.Request) {
+	video, userID, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectBanned(r.Context(), w, userID) || cfg.rejectSuspended(r.Context(), w, userID) {
+		return
+	}
+	switch video.Status {
+	case database.VideoStatusProcessing:
+		respondWithError(w, http.StatusConflict, "Video is already processing", nil)
+		return
+	case database.VideoStatusLive:
+		respondWithError(w, http.StatusConflict, "Video is being streamed live", nil)
+		return
+	}
+
+	job, err := cfg.db.GetLatestVideoJob(r.Context(), video.ID, jobTypeProcessVideo)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get processing job", err)
+		return
+	}
+	jobFailed := job.Status == database.JobStatusDead || job.Status == database.JobStatusCancelled
+	if !jobFailed && video.Status != database.VideoStatusFailed {
+		respondWithError(w, http.StatusConflict, "Only videos whose processing failed can be reprocessed", nil)
+		return
+	}
+	if jobFailed {
+		err := cfg.retryJob(r.Context(), job)
+		if err == nil {
+			slog.InfoContext(r.Context(), "Retrying processing", "video_id", video.ID, "job_id", job.ID, "user_id", userID)
+			cfg.respondWithReprocessedVideo(w, r, video.ID)
+			return
+		}
+		if errors.Is(err, errJobNotRetryable) {
+			respondWithError(w, http.StatusConflict, "Video is already processing", nil)
+			return
+		}
+		if !errors.Is(err, errJobSourceGone) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retry processing", err)
+			return
+		}
+	}
+
+	// The upload has been cleaned up. A video that still has a file from
+	// before can only be reprocessed from it once it's failed; otherwise
+	// it would replace the file it's serving with the same one.
+	if video.VideoURL == nil || video.Status != database.VideoStatusFailed {
+		respondWithError(w, http.StatusConflict, errJobSourceGone.Error(), nil)
+		return
+	}
+	if err := cfg.db.SetVideoStatus(r.Context(), video.ID, database.VideoStatusProcessing); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to update video status", err)
+		return
+	}
+	_, err = cfg.db.CreateJob(r.Context(), database.CreateJobParams{
+		Type:        jobTypeReprocessVideo,
+		VideoID:     &video.ID,
+		Payload:     reprocessVideoPayload{},
+		MaxAttempts: cfg.jobMaxAttempts,
+	})
+	if err != nil {
+		if serr := cfg.db.SetVideoStatus(context.WithoutCancel(r.Context()), video.ID, video.Status); serr != nil {
+			slog.ErrorContext(r.Context(), "Couldn't reset video status", "video_id", video.ID, "error", serr)
+		}
+		respondWithError(w, http.StatusInternalServerError, "unable to queue processing", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Reprocessing stored video", "video_id", video.ID, "user_id", userID)
+	cfg.respondWithReprocessedVideo(w, r, video.ID)
+}
+
+func (cfg *apiConfig) respondWithReprocessedVideo(w http.ResponseWriter, r *http.Request, videoID uuid.UUID) {
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, video)
+}
+
+// requestedReprocess reports whether job reprocesses a video because its
+// owner asked, rather than for a backfill.
+func requestedReprocess(job database.Job) bool {
+	if job.Type != jobTypeReprocessVideo || job.VideoID == nil {
+		return false
+	}
+	var payload reprocessVideoPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return false
+	}
+	return payload.BackfillID == uuid.Nil
+}
+
+// finishRequestedReprocess tells the owner how a reprocess they asked for
+// went, as it would for an upload. A video that couldn't be reprocessed is
+// left failed.
+func (cfg *apiConfig) finishRequestedReprocess(ctx context.Context, videoID uuid.UUID, result database.BackfillResult) {
+	if result == database.BackfillResultSucceeded {
+		cfg.announceProcessedVideo(ctx, videoID)
+		return
+	}
+	if err := cfg.db.SetVideoStatus(ctx, videoID, database.VideoStatusFailed); err != nil {
+		slog.ErrorContext(ctx, "Couldn't reset video status", "video_id", videoID, "error", err)
+	}
+	go cfg.notifyProcessingFailed(ctx, videoID)
+}
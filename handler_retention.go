@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerAdminRetentionGet(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	retention, err := cfg.db.GetUserRetention(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get retention", err)
+		return
+	}
+	if retention == nil {
+		respondWithError(w, http.StatusNotFound, "User isn't in compliance mode", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, retention)
+}
+
+// handlerAdminRetentionSet puts a user in compliance mode, or changes their
+// retention. It applies to files they upload from then on.
+func (cfg *apiConfig) handlerAdminRetentionSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		RetentionDays int `json:"retention_days"`
+	}
+
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.RetentionDays < 1 || params.RetentionDays > maxRetentionDays {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("retention_days must be between 1 and %d", maxRetentionDays), nil)
+		return
+	}
+
+	user, err := cfg.db.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user", nil)
+		return
+	}
+
+	retention, err := cfg.db.SetUserRetention(r.Context(), database.UserRetention{
+		UserID:        userID,
+		RetentionDays: params.RetentionDays,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set retention", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "retention.set", "user", userID.String(), retention)
+	respondWithJSON(w, http.StatusOK, retention)
+}
+
+// handlerAdminRetentionReset takes a user out of compliance mode. Files
+// already locked stay locked.
+func (cfg *apiConfig) handlerAdminRetentionReset(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	if err := cfg.db.DeleteUserRetention(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset retention", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "retention.reset", "user", userID.String(), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
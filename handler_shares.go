@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultShareTTL = 7 * 24 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+)
+
+type shareResponse struct {
+	database.VideoShare
+	URL string `json:"url"`
+}
+
+func (cfg *apiConfig) newShareResponse(share database.VideoShare) shareResponse {
+	return shareResponse{
+		VideoShare: share,
+		URL:        fmt.Sprintf("%s%s/shares/%s", cfg.baseURL, apiVersionPrefix, share.Token),
+	}
+}
+
+// getEditableVideo loads a video from the path and checks that the
+// authenticated user may edit it, writing an error response if not.
+func (cfg *apiConfig) getEditableVideo(w http.ResponseWriter, r *http.Request) (database.Video, uuid.UUID, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, uuid.Nil, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, uuid.Nil, false
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, uuid.Nil, false
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return database.Video{}, uuid.Nil, false
+	}
+	if !cfg.canEditVideo(r.Context(), video, userID) {
+		respondWithError(w, http.StatusForbidden, "You can't modify this video", nil)
+		return database.Video{}, uuid.Nil, false
+	}
+	return video, userID, true
+}
+
+func (cfg *apiConfig) handlerVideoShareCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ExpiresInSeconds int  `json:"expires_in_seconds"`
+		MaxViews         *int `json:"max_views"`
+	}
+
+	video, userID, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+	}
+
+	ttl := defaultShareTTL
+	if params.ExpiresInSeconds != 0 {
+		ttl = time.Duration(params.ExpiresInSeconds) * time.Second
+	}
+	if ttl <= 0 || ttl > maxShareTTL {
+		respondWithError(w, http.StatusBadRequest, "expires_in_seconds must be between 1 and 2592000", nil)
+		return
+	}
+	if params.MaxViews != nil && *params.MaxViews <= 0 {
+		respondWithError(w, http.StatusBadRequest, "max_views must be positive", nil)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share token", err)
+		return
+	}
+
+	share, err := cfg.db.CreateVideoShare(r.Context(), database.CreateVideoShareParams{
+		Token:     token,
+		VideoID:   video.ID,
+		CreatedBy: userID,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+		MaxViews:  params.MaxViews,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share link", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, cfg.newShareResponse(share))
+}
+
+func (cfg *apiConfig) handlerVideoSharesList(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := cfg.db.GetVideoShares(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve share links", err)
+		return
+	}
+
+	resp := make([]shareResponse, 0, len(shares))
+	for _, share := range shares {
+		resp = append(resp, cfg.newShareResponse(share))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerVideoShareRevoke(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+
+	shareID, err := uuid.Parse(r.PathValue("shareID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid share ID", err)
+		return
+	}
+
+	shares, err := cfg.db.GetVideoShares(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve share links", err)
+		return
+	}
+	found := false
+	for _, share := range shares {
+		if share.ID == shareID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Share link not found", nil)
+		return
+	}
+
+	if err := cfg.db.DeleteVideoShare(r.Context(), shareID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke share link", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type sharedVideoResponse struct {
+	database.Video
+	// HLSKeyURL is where a player of an encrypted HLS rendition fetches
+	// the key with the share link's token, since the video may be private.
+	HLSKeyURL string `json:"hls_key_url,omitempty"`
+}
+
+// handlerSharedVideoGet returns the video behind a share link regardless of
+// its visibility, counting the request as one view of the link.
+func (cfg *apiConfig) handlerSharedVideoGet(w http.ResponseWriter, r *http.Request) {
+	share, err := cfg.db.RedeemVideoShare(r.Context(), r.PathValue("token"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't validate share link", err)
+		return
+	}
+	if share.ID == uuid.Nil {
+		respondWithError(w, http.StatusGone, "Share link is invalid or has expired", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), share.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	// Takedowns revoke a video's share links, but one redeemed as the
+	// takedown commits mustn't serve it either, and neither may one for a
+	// suspended user's video.
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.videoAvailable(r.Context(), video, uuid.Nil) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if !cfg.checkGeoRestriction(w, r, video, uuid.Nil) {
+		return
+	}
+	resp := sharedVideoResponse{Video: video}
+	if video.VideoURL != nil {
+		videoURL := cfg.playbackURL(r.Context(), *video.VideoURL, video.ID, uuid.Nil, cfg.playbackTokenExpiry(time.Now()))
+		resp.VideoURL = &videoURL
+	}
+	key, err := cfg.db.GetHLSKey(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get HLS key", err)
+		return
+	}
+	if key != nil {
+		resp.HLSKeyURL = cfg.hlsKeyURL(video.ID) + "?share=" + url.QueryEscape(share.Token)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, resp)
+}
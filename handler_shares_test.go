@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mocks"
+	"github.com/google/uuid"
+)
+
+// stubShare makes share's token redeemable for video.
+func stubShare(store *mocks.Store, video *database.Video) database.VideoShare {
+	share := database.VideoShare{ID: uuid.New(), Token: "share-token", VideoID: video.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	store.RedeemVideoShareFunc = func(ctx context.Context, token string) (database.VideoShare, error) {
+		if token != share.Token {
+			return database.VideoShare{}, nil
+		}
+		return share, nil
+	}
+	return share
+}
+
+func newSharedVideoRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/shares/"+token, nil)
+	req.SetPathValue("token", token)
+	return req
+}
+
+func TestHandlerSharedVideoGetServesPrivateVideo(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New(), Visibility: database.VisibilityPrivate}}
+	stubVideo(store, video)
+	share := stubShare(store, video)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerSharedVideoGet(rec, newSharedVideoRequest(share.Token))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+func TestHandlerSharedVideoGetRejectsUnknownToken(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New()}}
+	stubVideo(store, video)
+	stubShare(store, video)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerSharedVideoGet(rec, newSharedVideoRequest("other-token"))
+
+	if rec.Code != http.StatusGone {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusGone, rec.Body)
+	}
+}
+
+func TestHandlerSharedVideoGetRejectsTakenDownVideo(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	takenDownAt := time.Now()
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New()}, TakenDownAt: &takenDownAt}
+	stubVideo(store, video)
+	share := stubShare(store, video)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerSharedVideoGet(rec, newSharedVideoRequest(share.Token))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body)
+	}
+}
+
+func TestHandlerSharedVideoGetRejectsSuspendedOwner(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New()}}
+	stubVideo(store, video)
+	share := stubShare(store, video)
+	store.IsUserSuspendedFunc = func(ctx context.Context, id uuid.UUID) (bool, error) {
+		return id == video.UserID, nil
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.handlerSharedVideoGet(rec, newSharedVideoRequest(share.Token))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body)
+	}
+}
+
+func TestHandlerSharedVideoGetLinksHLSKey(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New(), Visibility: database.VisibilityPrivate}}
+	stubVideo(store, video)
+	share := stubShare(store, video)
+	store.GetHLSKeyFunc = func(ctx context.Context, videoID uuid.UUID) ([]byte, error) {
+		return []byte("0123456789abcdef"), nil
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.handlerSharedVideoGet(rec, newSharedVideoRequest(share.Token))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp sharedVideoResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := cfg.hlsKeyURL(video.ID) + "?share=" + share.Token; resp.HLSKeyURL != want {
+		t.Errorf("hls_key_url = %q, want %q", resp.HLSKeyURL, want)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+	// statsRecentFailures is how many dead-lettered jobs the stats include.
+	statsRecentFailures = 10
+)
+
+// handlerAdminStats reports totals, the processing backlog, recent failures,
+// and daily upload volume, for an operations dashboard.
+func (cfg *apiConfig) handlerAdminStats(w http.ResponseWriter, r *http.Request) {
+	type backlog struct {
+		Pending int `json:"pending"`
+		Running int `json:"running"`
+		Dead    int `json:"dead"`
+	}
+	type response struct {
+		Totals         database.SystemTotals   `json:"totals"`
+		Backlog        backlog                 `json:"backlog"`
+		RecentFailures []database.Job          `json:"recent_failures"`
+		DailyUploads   []database.DailyUploads `json:"daily_uploads"`
+	}
+
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	days, err := parseStatsDays(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	totals, err := cfg.db.GetSystemTotals(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get totals", err)
+		return
+	}
+	jobCounts, err := cfg.db.CountJobsByStatus(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count jobs", err)
+		return
+	}
+	failures, err := cfg.db.ListJobs(r.Context(), database.JobStatusDead, statsRecentFailures, 0)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve jobs", err)
+		return
+	}
+
+	since := statsSince(days)
+	uploads, err := cfg.db.ListDailyUploads(r.Context(), since)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload volume", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Totals: totals,
+		Backlog: backlog{
+			Pending: jobCounts[database.JobStatusPending],
+			Running: jobCounts[database.JobStatusRunning],
+			Dead:    jobCounts[database.JobStatusDead],
+		},
+		RecentFailures: failures,
+		DailyUploads:   fillUploadDays(uploads, since, days),
+	})
+}
+
+// parseStatsDays reads how many days a report covers from the days query
+// parameter.
+func parseStatsDays(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("days")
+	if s == "" {
+		return defaultStatsDays, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxStatsDays {
+		return 0, errors.New("days must be between 1 and 365")
+	}
+	return n, nil
+}
+
+// statsSince is the first day of a report covering days days up to today.
+func statsSince(days int) time.Time {
+	return time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+}
+
+// fillUploadDays returns one entry per day starting at since, with zeros
+// for days that had no uploads, so charts don't have to fill gaps.
+func fillUploadDays(uploads []database.DailyUploads, since time.Time, days int) []database.DailyUploads {
+	byDay := make(map[string]database.DailyUploads, len(uploads))
+	for _, u := range uploads {
+		byDay[u.Day] = u
+	}
+	filled := make([]database.DailyUploads, 0, days)
+	for i := 0; i < days; i++ {
+		day := since.AddDate(0, 0, i).Format(time.DateOnly)
+		u, ok := byDay[day]
+		if !ok {
+			u = database.DailyUploads{Day: day}
+		}
+		filled = append(filled, u)
+	}
+	return filled
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerStorageReconcile cross-checks the database against the bucket now
+// rather than waiting for the schedule. With ?repair=true every open
+// discrepancy is repaired afterwards.
+func (cfg *apiConfig) handlerStorageReconcile(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	repair := r.URL.Query().Get("repair") == "true"
+
+	result, err := cfg.reconcileStorage(r.Context(), repair)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reconcile storage", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "storage.reconcile", "storage", "", result)
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// handlerStorageDiscrepancies lists open discrepancies, oldest first, or
+// with ?resolved=true those already resolved. ?kind= narrows it to missing
+// or orphaned objects.
+func (cfg *apiConfig) handlerStorageDiscrepancies(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	kind := database.StorageDiscrepancyKind(r.URL.Query().Get("kind"))
+	if kind != "" && !kind.Valid() {
+		respondWithError(w, http.StatusBadRequest, "kind must be missing_object or orphaned_object", nil)
+		return
+	}
+	resolved := r.URL.Query().Get("resolved") == "true"
+
+	discrepancies, err := cfg.db.ListStorageDiscrepancies(r.Context(), kind, resolved, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list storage discrepancies", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, discrepancies)
+}
+
+// handlerStorageDiscrepancyRepair repairs one open discrepancy, after
+// checking against the current database and bucket that it still holds.
+func (cfg *apiConfig) handlerStorageDiscrepancyRepair(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := cfg.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("discrepancyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+	d, err := cfg.db.GetStorageDiscrepancy(r.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage discrepancy", err)
+		return
+	}
+	if d == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get storage discrepancy", nil)
+		return
+	}
+	if d.ResolvedAt != nil {
+		respondWithError(w, http.StatusConflict, "Discrepancy is already resolved", nil)
+		return
+	}
+
+	refs, err := cfg.db.GetStorageReferences(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage references", err)
+		return
+	}
+	resolution, err := cfg.repairStorageDiscrepancy(r.Context(), *d, cfg.newStorageRefIndex(refs))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't repair storage discrepancy", err)
+		return
+	}
+	if err := cfg.db.ResolveStorageDiscrepancy(r.Context(), d.ID, resolution, &adminID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resolve storage discrepancy", err)
+		return
+	}
+	cfg.audit(r.Context(), adminID, "storage.repair", "storage_discrepancy", d.ID.String(), map[string]any{"kind": d.Kind, "key": d.Key, "resolution": resolution})
+
+	d, err = cfg.db.GetStorageDiscrepancy(r.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage discrepancy", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, d)
+}
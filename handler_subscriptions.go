@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerSubscriptionCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CreatorID *uuid.UUID `json:"creator_id"`
+		ChannelID *uuid.UUID `json:"channel_id"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if (params.CreatorID == nil) == (params.ChannelID == nil) {
+		respondWithError(w, http.StatusBadRequest, "Exactly one of creator_id and channel_id is required", nil)
+		return
+	}
+
+	if params.CreatorID != nil {
+		if *params.CreatorID == userID {
+			respondWithError(w, http.StatusBadRequest, "You can't subscribe to yourself", nil)
+			return
+		}
+		creator, err := cfg.db.GetUser(r.Context(), *params.CreatorID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+		if creator == nil {
+			respondWithError(w, http.StatusNotFound, "User not found", nil)
+			return
+		}
+	} else {
+		channel, err := cfg.db.GetChannel(r.Context(), *params.ChannelID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get channel", err)
+			return
+		}
+		if channel.ID == uuid.Nil {
+			respondWithError(w, http.StatusNotFound, "Channel not found", nil)
+			return
+		}
+	}
+
+	sub, created, err := cfg.db.CreateSubscription(r.Context(), userID, params.CreatorID, params.ChannelID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create subscription", err)
+		return
+	}
+	if created {
+		go cfg.notifyNewSubscriber(context.WithoutCancel(r.Context()), sub)
+	}
+	respondWithJSON(w, http.StatusCreated, sub)
+}
+
+func (cfg *apiConfig) handlerSubscriptionsList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	subs, err := cfg.db.GetSubscriptions(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve subscriptions", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, subs)
+}
+
+func (cfg *apiConfig) handlerSubscriptionDelete(w http.ResponseWriter, r *http.Request) {
+	subscriptionID, err := uuid.Parse(r.PathValue("subscriptionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	sub, err := cfg.db.GetSubscription(r.Context(), subscriptionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription", err)
+		return
+	}
+	if sub.ID == uuid.Nil || sub.SubscriberID != userID {
+		respondWithError(w, http.StatusNotFound, "Subscription not found", nil)
+		return
+	}
+
+	if err := cfg.db.DeleteSubscription(r.Context(), sub.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete subscription", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerSubscriptionFeed(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	videos, err := cfg.db.GetSubscriptionFeed(r.Context(), userID, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve subscription feed", err)
+		return
+	}
+	cfg.rotateThumbnails(r.Context(), videos)
+	respondWithJSON(w, http.StatusOK, videos)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerThumbnailVariantsList(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	variants, err := cfg.db.GetThumbnailVariants(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thumbnail variants", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, variants)
+}
+
+// handlerThumbnailVariantCreate adds a candidate thumbnail to a video,
+// uploaded like its thumbnail. While a video has candidates, public
+// listings show them in rotation instead of its thumbnail.
+func (cfg *apiConfig) handlerThumbnailVariantCreate(w http.ResponseWriter, r *http.Request) {
+	bodyLimit := cfg.maxThumbnailUploadBytes + thumbnailFormOverhead
+	if r.ContentLength > bodyLimit {
+		cfg.respondThumbnailTooLarge(w, nil)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+
+	video, userID, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectBanned(r.Context(), w, userID) || cfg.rejectSuspended(r.Context(), w, userID) {
+		return
+	}
+	variants, err := cfg.db.GetThumbnailVariants(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thumbnail variants", err)
+		return
+	}
+	if len(variants) >= maxThumbnailVariants {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("A video can have at most %d thumbnail variants", maxThumbnailVariants), nil)
+		return
+	}
+
+	filename, ok := cfg.receiveThumbnail(w, r, video.ID)
+	if !ok {
+		return
+	}
+	variant, err := cfg.db.CreateThumbnailVariant(r.Context(), video.ID, fmt.Sprintf("%s/assets/%s", cfg.baseURL, filename))
+	if err != nil {
+		os.Remove(filepath.Join(cfg.assetsRoot, filename))
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create thumbnail variant", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, variant)
+}
+
+// handlerThumbnailVariantDelete removes a candidate thumbnail and its
+// image. Its impressions and clicks go with it.
+func (cfg *apiConfig) handlerThumbnailVariantDelete(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	variantID, err := uuid.Parse(r.PathValue("variantID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid variant ID", err)
+		return
+	}
+	variant, err := cfg.db.GetThumbnailVariant(r.Context(), variantID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thumbnail variant", err)
+		return
+	}
+	if variant.VideoID != video.ID {
+		respondWithError(w, http.StatusNotFound, "Thumbnail variant not found", nil)
+		return
+	}
+	if err := cfg.db.DeleteThumbnailVariant(r.Context(), variant.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete thumbnail variant", err)
+		return
+	}
+	if err := cfg.deleteAsset(variant.URL); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete thumbnail image", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerThumbnailAnalytics reports each candidate thumbnail's impressions,
+// clicks, and click-through rate, and the winner once there is one.
+func (cfg *apiConfig) handlerThumbnailAnalytics(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	variants, err := cfg.db.GetThumbnailVariants(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thumbnail variants", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newThumbnailTestReport(variants))
+}
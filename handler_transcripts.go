@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	maxCaptionsBytes           = 2 << 20
+	maxTranscriptCues          = 10000
+	maxTranscriptQueryLength   = 100
+	maxTranscriptMatches       = 100
+	transcriptSnippetsPerVideo = 3
+)
+
+func (cfg *apiConfig) handlerTranscriptGet(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getPlayableVideo(w, r)
+	if !ok {
+		return
+	}
+	cues, err := cfg.db.GetTranscript(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get transcript", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cues)
+}
+
+// handlerTranscriptSet replaces a video's transcript with the cues of a
+// WebVTT or SRT captions file sent as the request body, and queues chapter
+// suggestions from it if they're on.
+func (cfg *apiConfig) handlerTranscriptSet(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCaptionsBytes))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Captions file is too large", err)
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Couldn't read captions", err)
+		return
+	}
+	cues, err := parseCaptions(string(body))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if len(cues) > maxTranscriptCues {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Captions can have at most %d cues", maxTranscriptCues), nil)
+		return
+	}
+
+	if err := cfg.db.SetTranscript(r.Context(), video.ID, cues); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't set transcript", err)
+		return
+	}
+	if cfg.chapterSuggester != nil {
+		if err := cfg.queueChapterSuggestions(r.Context(), video); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't queue chapter suggestions", "video_id", video.ID, "error", err)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, cues)
+}
+
+func (cfg *apiConfig) handlerTranscriptDelete(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.db.SetTranscript(r.Context(), video.ID, nil); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove transcript", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerTranscriptSearch finds where in a video something is said,
+// returning the matching cues in order.
+func (cfg *apiConfig) handlerTranscriptSearch(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getPlayableVideo(w, r)
+	if !ok {
+		return
+	}
+	query, ok := transcriptQuery(w, r)
+	if !ok {
+		return
+	}
+	cues, err := cfg.db.SearchTranscript(r.Context(), video.ID, query, maxTranscriptMatches)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search transcript", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cues)
+}
+
+type transcriptSearchResult struct {
+	Video    database.Video           `json:"video"`
+	Snippets []database.TranscriptCue `json:"snippets"`
+}
+
+// handlerTranscriptsSearch finds public videos that say something, newest
+// first, with the first few cues that say it in each.
+func (cfg *apiConfig) handlerTranscriptsSearch(w http.ResponseWriter, r *http.Request) {
+	query, ok := transcriptQuery(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	matches, err := cfg.db.SearchTranscripts(r.Context(), query, transcriptSnippetsPerVideo, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search transcripts", err)
+		return
+	}
+
+	results := make([]transcriptSearchResult, len(matches))
+	for i, match := range matches {
+		results[i] = transcriptSearchResult{Video: match.Video, Snippets: match.Snippets}
+	}
+	respondWithJSON(w, http.StatusOK, results)
+}
+
+// transcriptQuery reads the q parameter, writing an error response if it's
+// missing or too long.
+func transcriptQuery(w http.ResponseWriter, r *http.Request) (string, bool) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" || utf8.RuneCountInString(query) > maxTranscriptQueryLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("q must be 1 to %d characters", maxTranscriptQueryLength), nil)
+		return "", false
+	}
+	return query, true
+}
+
+// captionTagPattern matches WebVTT and SRT markup, such as <i> and <v Name>,
+// which is dropped from the transcript.
+var captionTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// parseCaptions reads the cues of a WebVTT or SRT file. Cue settings,
+// identifiers, markup, and WebVTT's NOTE, STYLE, and REGION blocks are
+// ignored; a cue's lines are joined with spaces.
+func parseCaptions(s string) ([]database.TranscriptCue, error) {
+	s = strings.TrimPrefix(s, "\uFEFF")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	cues := []database.TranscriptCue{}
+	for _, block := range strings.Split(s, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		timing := slices.IndexFunc(lines, func(line string) bool { return strings.Contains(line, "-->") })
+		if timing < 0 {
+			continue
+		}
+		start, rest, _ := strings.Cut(lines[timing], "-->")
+		end := strings.Fields(rest)
+		if len(end) == 0 {
+			return nil, fmt.Errorf("Invalid cue timing %q", lines[timing])
+		}
+		startSeconds, err := parseCaptionTimestamp(strings.TrimSpace(start))
+		if err != nil {
+			return nil, err
+		}
+		endSeconds, err := parseCaptionTimestamp(end[0])
+		if err != nil {
+			return nil, err
+		}
+		if endSeconds < startSeconds {
+			return nil, fmt.Errorf("Cue at %s ends before it starts", strings.TrimSpace(start))
+		}
+		text := captionTagPattern.ReplaceAllString(strings.Join(lines[timing+1:], " "), "")
+		text = strings.Join(strings.Fields(text), " ")
+		if text == "" {
+			continue
+		}
+		cues = append(cues, database.TranscriptCue{StartSeconds: startSeconds, EndSeconds: endSeconds, Text: text})
+	}
+	if len(cues) == 0 {
+		return nil, errors.New("Captions have no cues")
+	}
+	return cues, nil
+}
+
+// parseCaptionTimestamp parses [hh:]mm:ss.ttt, or SRT's hh:mm:ss,ttt, into
+// seconds.
+func parseCaptionTimestamp(s string) (float64, error) {
+	invalid := fmt.Errorf("Invalid cue timestamp %q", s)
+	parts := strings.Split(strings.Replace(s, ",", ".", 1), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, invalid
+	}
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || seconds < 0 || seconds >= 60 {
+		return 0, invalid
+	}
+	multiplier := 60.0
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0, invalid
+		}
+		seconds += float64(n) * multiplier
+		multiplier *= 60
+	}
+	return seconds, nil
+}
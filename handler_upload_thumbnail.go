@@ -3,19 +3,43 @@ package main
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
+var thumbnailMediaTypeDetails = map[string]any{"accepted": []string{"image/jpeg", "image/png", "image/heic", "image/heif"}}
+
+// heicMediaTypes are thumbnail types browsers can't show, which are
+// converted to cfg.heicThumbnailFormat before they're stored.
+var heicMediaTypes = map[string]bool{"image/heic": true, "image/heif": true}
+
+// thumbnailFormOverhead is what the body of a thumbnail upload may hold
+// beyond the image itself: part headers, boundaries, and any other fields.
+const thumbnailFormOverhead = 64 << 10
+
 func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
+	// As with videos, a declared length over the limit is turned away
+	// before reading any of it.
+	bodyLimit := cfg.maxThumbnailUploadBytes + thumbnailFormOverhead
+	if r.ContentLength > bodyLimit {
+		cfg.respondThumbnailTooLarge(w, nil)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
@@ -35,39 +59,78 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
+	slog.InfoContext(r.Context(), "Uploading thumbnail", "video_id", videoID, "user_id", userID)
 
-	maxMemory := 10 * 1024 * 1024
-	err = r.ParseMultipartForm(int64(maxMemory))
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not parse formdata", err)
+		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		return
+	}
+	if !cfg.canEditVideo(r.Context(), video, userID) {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
+		return
+	}
+	if cfg.rejectBanned(r.Context(), w, userID) || cfg.rejectSuspended(r.Context(), w, userID) {
 		return
 	}
 
-	file, header, err := r.FormFile("thumbnail")
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to read file", err)
+	filename, ok := cfg.receiveThumbnail(w, r, videoID)
+	if !ok {
 		return
 	}
+	stored := false
+	defer func() {
+		if !stored {
+			os.Remove(filepath.Join(cfg.assetsRoot, filename))
+		}
+	}()
+
+	thumbnailUrl := fmt.Sprintf("%s/assets/%s", cfg.baseURL, filename)
+	video.ThumbnailURL = &thumbnailUrl
 
-	video, err := cfg.db.GetVideo(videoID)
+	err = cfg.db.UpdateVideo(r.Context(), video)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		if errors.Is(err, database.ErrVideoConflict) {
+			respondWithError(w, http.StatusConflict, "Video was modified by another request", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not update video metadata", err)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized", err)
-		return
+	stored = true
+	video.Version++
+
+	cfg.publishEvent(r.Context(), video.UserID, eventVideoThumbnailUploaded, video)
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// receiveThumbnail streams the thumbnail field of a multipart upload into
+// the assets directory, scanning it and converting HEIC images on the way,
+// and returns the stored file's name. When it fails it has already
+// responded and removed anything it wrote.
+func (cfg *apiConfig) receiveThumbnail(w http.ResponseWriter, r *http.Request, videoID uuid.UUID) (string, bool) {
+	// The form is read as a stream, so the image goes straight to the
+	// scanner and the assets directory instead of being buffered first.
+	part, err := thumbnailPart(r)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			cfg.respondThumbnailTooLarge(w, err)
+			return "", false
+		}
+		respondWithError(w, http.StatusBadRequest, "Unable to read file", err)
+		return "", false
 	}
+	defer part.Close()
 
-	mediaType, _, err := mime.ParseMediaType(header.Header.Get("content-type"))
+	mediaType, _, err := mime.ParseMediaType(part.Header.Get("content-type"))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "could not parse media type", err)
-		return
+		respondWithErrorCode(w, http.StatusBadRequest, errCodeUnsupportedMediaType, "could not parse media type", err, thumbnailMediaTypeDetails)
+		return "", false
 	}
-	if mediaType != "image/jpeg" && mediaType != "image/png" {
-		respondWithError(w, http.StatusBadRequest, "invalid media type", err)
-		return
+	if mediaType != "image/jpeg" && mediaType != "image/png" && !heicMediaTypes[mediaType] {
+		respondWithErrorCode(w, http.StatusBadRequest, errCodeUnsupportedMediaType, "invalid media type", err, thumbnailMediaTypeDetails)
+		return "", false
 	}
 
 	extension := strings.Split(mediaType, "/")[1]
@@ -75,30 +138,101 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	_, err = rand.Read(randBuf)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error creating random buffer", err)
-		return
+		return "", false
 	}
 	randBufBase64 := base64.RawURLEncoding.EncodeToString(randBuf)
 	filename := randBufBase64 + "." + extension
-	filepath := filepath.Join(cfg.assetsRoot, filename)
-	newFile, err := os.Create(filepath)
+	assetPath := filepath.Join(cfg.assetsRoot, filename)
+	newFile, err := os.Create(assetPath)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "could not create new file", err)
-		return
+		return "", false
 	}
-	_, err = io.Copy(newFile, file)
+	stored := false
+	defer func() {
+		newFile.Close()
+		if !stored {
+			os.Remove(assetPath)
+		}
+	}()
+
+	// The scanner reads the image as it's written to disk; whatever it
+	// leaves unread is copied after it. Reading stops a byte past the
+	// limit, so an oversized image never lands on disk in full.
+	image := io.LimitReader(part, cfg.maxThumbnailUploadBytes+1)
+	if !cfg.scanUpload(w, r, videoID, io.TeeReader(image, newFile)) {
+		return "", false
+	}
+	if _, err := io.Copy(newFile, image); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			cfg.respondThumbnailTooLarge(w, err)
+			return "", false
+		}
+		respondWithError(w, http.StatusInternalServerError, "could not copy file", err)
+		return "", false
+	}
+	info, err := newFile.Stat()
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "could not copy file", err)
-		return
+		return "", false
 	}
+	if info.Size() > cfg.maxThumbnailUploadBytes {
+		cfg.respondThumbnailTooLarge(w, nil)
+		return "", false
+	}
+	if err := newFile.Close(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not copy file", err)
+		return "", false
+	}
+	size := info.Size()
+	cfg.metrics.uploadSize.Observe(float64(size), "thumbnail")
 
-	thumbnailUrl := fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, filename)
-	video.ThumbnailURL = &thumbnailUrl
+	if heicMediaTypes[mediaType] {
+		var convertedPath string
+		err := cfg.ffmpegBreaker.do(r.Context(), func() (err error) {
+			convertedPath, err = convertImage(r.Context(), cfg.ffmpegPath, assetPath, cfg.heicThumbnailFormat)
+			return err
+		})
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				respondWithErrorCode(w, http.StatusBadRequest, errCodeUnsupportedMediaType, "could not convert image", err, thumbnailMediaTypeDetails)
+				return "", false
+			}
+			respondWithError(w, http.StatusInternalServerError, "could not convert image", err)
+			return "", false
+		}
+		os.Remove(assetPath)
+		filename = filepath.Base(convertedPath)
+	}
+	stored = true
+	return filename, true
+}
 
-	err = cfg.db.UpdateVideo(video)
+// thumbnailPart returns the thumbnail field of a multipart form, skipping
+// any fields before it.
+func thumbnailPart(r *http.Request) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "could not update video metadata", err)
-		return
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("no thumbnail field in form")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "thumbnail" {
+			return part, nil
+		}
+		part.Close()
 	}
+}
 
-	respondWithJSON(w, http.StatusOK, video)
+func (cfg *apiConfig) respondThumbnailTooLarge(w http.ResponseWriter, err error) {
+	msg := fmt.Sprintf("Thumbnail is larger than the %d byte limit", cfg.maxThumbnailUploadBytes)
+	respondWithErrorCode(w, http.StatusRequestEntityTooLarge, errCodeThumbnailTooLarge, msg, err, map[string]any{"limit_bytes": cfg.maxThumbnailUploadBytes})
 }
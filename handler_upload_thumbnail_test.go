@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerUploadThumbnailStoresImage(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	userID := uuid.New()
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: userID}}
+	stubVideo(store, video)
+	var updated database.Video
+	store.UpdateVideoFunc = func(ctx context.Context, v database.Video) error {
+		updated = v
+		return nil
+	}
+
+	image := []byte("\x89PNG\r\n\x1a\nnot really a png")
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadThumbnail(rec, newUploadRequest(t, video.ID, userID, "thumbnail", "thumb.png", "image/png", image))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if updated.ThumbnailURL == nil {
+		t.Fatal("thumbnail URL wasn't saved")
+	}
+	filename, ok := strings.CutPrefix(*updated.ThumbnailURL, cfg.baseURL+"/assets/")
+	if !ok || !strings.HasSuffix(filename, ".png") {
+		t.Fatalf("thumbnail URL = %q, want a png under %s/assets/", *updated.ThumbnailURL, cfg.baseURL)
+	}
+	stored, err := os.ReadFile(filepath.Join(cfg.assetsRoot, filename))
+	if err != nil {
+		t.Fatalf("stored thumbnail: %v", err)
+	}
+	if !bytes.Equal(stored, image) {
+		t.Errorf("stored thumbnail = %q, want %q", stored, image)
+	}
+	var resp database.Video
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ThumbnailURL == nil || *resp.ThumbnailURL != *updated.ThumbnailURL {
+		t.Errorf("response thumbnail URL = %v, want %q", resp.ThumbnailURL, *updated.ThumbnailURL)
+	}
+}
+
+func TestHandlerUploadThumbnailRejectsOtherMediaTypes(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	userID := uuid.New()
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: userID}}
+	stubVideo(store, video)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadThumbnail(rec, newUploadRequest(t, video.ID, userID, "thumbnail", "thumb.gif", "image/gif", []byte("GIF89a")))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if code := errorCodeOf(t, rec); code != errCodeUnsupportedMediaType {
+		t.Errorf("code = %s, want %s", code, errCodeUnsupportedMediaType)
+	}
+	if entries, _ := os.ReadDir(cfg.assetsRoot); len(entries) != 0 {
+		t.Errorf("assets written for a rejected upload: %v", entries)
+	}
+}
+
+func TestHandlerUploadThumbnailTooLarge(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	userID := uuid.New()
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: userID}}
+	stubVideo(store, video)
+
+	image := bytes.Repeat([]byte{0xff}, int(cfg.maxThumbnailUploadBytes)+1)
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadThumbnail(rec, newUploadRequest(t, video.ID, userID, "thumbnail", "thumb.jpg", "image/jpeg", image))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body)
+	}
+	if code := errorCodeOf(t, rec); code != errCodeThumbnailTooLarge {
+		t.Errorf("code = %s, want %s", code, errCodeThumbnailTooLarge)
+	}
+	if entries, _ := os.ReadDir(cfg.assetsRoot); len(entries) != 0 {
+		t.Errorf("oversized thumbnail left on disk: %v", entries)
+	}
+}
+
+func TestHandlerUploadThumbnailConflict(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	userID := uuid.New()
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: userID}}
+	stubVideo(store, video)
+	store.UpdateVideoFunc = func(ctx context.Context, v database.Video) error {
+		return database.ErrVideoConflict
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadThumbnail(rec, newUploadRequest(t, video.ID, userID, "thumbnail", "thumb.jpg", "image/jpeg", []byte("jpeg")))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+	if entries, _ := os.ReadDir(cfg.assetsRoot); len(entries) != 0 {
+		t.Errorf("thumbnail kept after a conflicting update: %v", entries)
+	}
+}
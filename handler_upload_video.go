@@ -1,26 +1,38 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"os/exec"
-	"strings"
+	"slices"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
+var videoMediaTypeDetails = map[string]any{"accepted": []string{"video/mp4"}}
+
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, int64(10<<30))
+	// A declared length over the limit can be turned away before reading
+	// any of it; the reader catches bodies that don't declare one.
+	if r.ContentLength > cfg.maxVideoUploadBytes {
+		cfg.respondVideoTooLarge(w, nil)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.maxVideoUploadBytes)
 
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -40,156 +52,547 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	videoMetadata, err := cfg.db.GetVideo(videoID)
+	videoMetadata, err := cfg.db.GetVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "not found", err)
 		return
 	}
-	if videoMetadata.UserID != userID {
+	if !cfg.canEditVideo(r.Context(), videoMetadata, userID) {
 		respondWithError(w, http.StatusUnauthorized, "unauthorized", err)
 		return
 	}
+	if cfg.rejectBanned(r.Context(), w, userID) || cfg.rejectSuspended(r.Context(), w, userID) {
+		return
+	}
+	if rejectLive(w, videoMetadata) {
+		return
+	}
+	containerProfile, ok := cfg.requestedContainerProfile(w, r)
+	if !ok {
+		return
+	}
+
+	// Uploads count against the video owner's storage. A re-upload replaces
+	// the current file, so its size is available again.
+	quota, err := cfg.quotaStatus(r.Context(), videoMetadata.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to get quota", err)
+		return
+	}
+	setQuotaHeaders(w, quota)
+	storageRemaining := quota.storageRemaining()
+	if storageRemaining >= 0 && videoMetadata.SizeBytes != nil {
+		storageRemaining += *videoMetadata.SizeBytes
+	}
+	if storageRemaining == 0 {
+		respondWithErrorCode(w, http.StatusForbidden, errCodeQuotaExceeded, "storage quota exceeded", nil, quotaDetails(quota))
+		return
+	}
 
 	file, header, err := r.FormFile("video")
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not get video file", err)
+		cfg.respondUploadReadError(w, "Could not get video file", err)
 		return
 	}
 	defer file.Close()
 
 	mediaType, _, err := mime.ParseMediaType(header.Header.Get("content-type"))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to parse mimetype", err)
+		respondWithErrorCode(w, http.StatusBadRequest, errCodeUnsupportedMediaType, "Unable to parse mimetype", err, videoMediaTypeDetails)
 		return
 	}
 	if mediaType != "video/mp4" {
-		respondWithError(w, http.StatusBadRequest, "only video/mp4 mimetype accepted", err)
+		respondWithErrorCode(w, http.StatusBadRequest, errCodeUnsupportedMediaType, "only video/mp4 mimetype accepted", err, videoMediaTypeDetails)
 		return
 	}
 
-	tmpFile, err := os.CreateTemp("", "video-upload.mp4")
+	err = cfg.db.SetVideoStatus(r.Context(), videoID, database.VideoStatusProcessing)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to update video status", err)
+		return
+	}
+	queued := false
+	hadVideo := videoMetadata.VideoURL != nil
+	defer func() {
+		if queued {
+			return
+		}
+		// A failed re-upload leaves the previous file in place.
+		status := database.VideoStatusFailed
+		if hadVideo {
+			status = database.VideoStatusReady
+		}
+		if err := cfg.db.SetVideoStatus(context.WithoutCancel(r.Context()), videoID, status); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't reset video status", "video_id", videoID, "error", err)
+		}
+	}()
+
+	// The upload is spooled to disk and processed by a job, so it survives a
+	// restart and a failed ffmpeg run can be retried without re-uploading.
+	sourceFile, err := os.CreateTemp(cfg.uploadsRoot, "upload-*.mp4")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "unable to create temp file", err)
 		return
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
+	defer sourceFile.Close()
+	defer func() {
+		if !queued {
+			os.Remove(sourceFile.Name())
+		}
+	}()
 
-	_, err = io.Copy(tmpFile, file)
+	var src io.Reader = file
+	if storageRemaining >= 0 {
+		src = io.LimitReader(file, storageRemaining+1)
+	}
+	size, err := io.Copy(sourceFile, src)
 	if err != nil {
+		cfg.respondUploadReadError(w, "unable to copy file", err)
+		return
+	}
+	if storageRemaining >= 0 && size > storageRemaining {
+		respondWithErrorCode(w, http.StatusForbidden, errCodeQuotaExceeded, "upload would exceed storage quota", nil, quotaDetails(quota))
+		return
+	}
+	cfg.metrics.uploadSize.Observe(float64(size), "video")
+	if err := sourceFile.Close(); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "unable to copy file", err)
 		return
 	}
+	if cfg.virusScanner != nil {
+		spooled, err := os.Open(sourceFile.Name())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "unable to read file", err)
+			return
+		}
+		clean := cfg.scanUpload(w, r, videoID, spooled)
+		spooled.Close()
+		if !clean {
+			return
+		}
+	}
 
-	_, err = tmpFile.Seek(0, io.SeekStart)
+	_, err = cfg.db.CreateJob(r.Context(), database.CreateJobParams{
+		Type:        jobTypeProcessVideo,
+		VideoID:     &videoID,
+		Payload:     processVideoPayload{SourcePath: sourceFile.Name(), HadVideo: hadVideo, ContainerProfile: containerProfile},
+		MaxAttempts: cfg.jobMaxAttempts,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "unable to find file start", err)
+		respondWithError(w, http.StatusInternalServerError, "unable to queue processing", err)
 		return
 	}
+	queued = true
 
-	aspectRatio, err := getVideoAspectRatio(tmpFile.Name())
+	videoMetadata, err = cfg.db.GetVideo(r.Context(), videoID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "cannot get video aspect ratio", err)
+		respondWithError(w, http.StatusInternalServerError, "unable to get video", err)
 		return
 	}
-	var prefix string
-	switch aspectRatio {
-	case "16:9":
-		prefix = "landscape"
-	case "9:16":
-		prefix = "portrait"
-	case "other":
-		prefix = "other"
+	respondWithJSON(w, http.StatusAccepted, videoMetadata)
+}
+
+type processVideoPayload struct {
+	SourcePath string `json:"source_path"`
+	// HadVideo records whether the video already had a file when this one
+	// was uploaded, so a failure can restore it to ready.
+	HadVideo bool `json:"had_video"`
+	// ContainerProfile is the profile the upload asked for. Jobs queued
+	// before profiles existed have none and get the default.
+	ContainerProfile string `json:"container_profile,omitempty"`
+}
+
+// runProcessVideoJob processes a spooled upload. The spooled file is kept
+// until the job succeeds or runs out of attempts.
+func (cfg *apiConfig) runProcessVideoJob(ctx context.Context, job database.Job) error {
+	var payload processVideoPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if job.VideoID == nil {
+		return errors.New("job has no video")
+	}
+
+	err := cfg.processVideo(ctx, *job.VideoID, payload.SourcePath, cfg.containerProfileOrDefault(payload.ContainerProfile))
+	if err == nil {
+		os.Remove(payload.SourcePath)
+		cfg.announceProcessedVideo(ctx, *job.VideoID)
+		return nil
+	}
+	input := map[string]any{
+		"video_id":    *job.VideoID,
+		"source_path": payload.SourcePath,
+		"had_video":   payload.HadVideo,
+	}
+	if info, statErr := os.Stat(payload.SourcePath); statErr == nil {
+		input["size_bytes"] = info.Size()
+	}
+	err = &jobInputError{err: err, input: input}
+	// A job that fails for good keeps its file, so an admin can retry it
+	// until the upload reconciler removes it. One interrupted by shutdown or
+	// an open circuit breaker is requeued. Cancellation resets the video in
+	// handlerJobCancel.
+	var openErr *circuitOpenError
+	final := job.Attempts >= job.MaxAttempts && !errors.Is(context.Cause(ctx), errShuttingDown) && !errors.As(err, &openErr)
+	if final {
+		cfg.restoreVideoStatus(context.WithoutCancel(ctx), *job.VideoID, payload)
+		go cfg.notifyProcessingFailed(context.WithoutCancel(ctx), *job.VideoID)
+	}
+	return err
+}
+
+// restoreVideoStatus takes a video out of processing once its job has
+// stopped without producing a file: back to ready if it already had one,
+// otherwise failed.
+func (cfg *apiConfig) restoreVideoStatus(ctx context.Context, videoID uuid.UUID, payload processVideoPayload) {
+	status := database.VideoStatusFailed
+	if payload.HadVideo {
+		status = database.VideoStatusReady
+	}
+	if err := cfg.db.SetVideoStatus(ctx, videoID, status); err != nil {
+		slog.ErrorContext(ctx, "Couldn't reset video status", "video_id", videoID, "error", err)
+	}
+}
+
+// requestedContainerProfile reads the container profile an upload asks for
+// with ?container_profile=, writing a 400 if it isn't one of the enabled
+// profiles. Uploads that don't ask get the default.
+func (cfg *apiConfig) requestedContainerProfile(w http.ResponseWriter, r *http.Request) (string, bool) {
+	profile := r.URL.Query().Get("container_profile")
+	if profile == "" {
+		return cfg.defaultContainerProfile, true
+	}
+	if !slices.Contains(cfg.containerProfiles, profile) {
+		respondWithErrorCode(w, http.StatusBadRequest, errCodeBadRequest, "Unknown container profile", nil, map[string]any{"accepted": cfg.containerProfiles})
+		return "", false
+	}
+	return profile, true
+}
+
+// containerProfileOrDefault returns profile if it's still enabled, and the
+// default profile otherwise.
+func (cfg *apiConfig) containerProfileOrDefault(profile string) string {
+	if slices.Contains(cfg.containerProfiles, profile) {
+		return profile
+	}
+	return cfg.defaultContainerProfile
+}
+
+// respondUploadReadError reports a failure reading a video upload, with a
+// 413 if the body went over a size limit.
+func (cfg *apiConfig) respondUploadReadError(w http.ResponseWriter, msg string, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		cfg.respondVideoTooLarge(w, err)
+	case errors.Is(err, multipart.ErrMessageTooLarge):
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Upload form has too many parts or headers", err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+	}
+}
+
+func (cfg *apiConfig) respondVideoTooLarge(w http.ResponseWriter, err error) {
+	msg := fmt.Sprintf("Video is larger than the %d byte limit", cfg.maxVideoUploadBytes)
+	respondWithErrorCode(w, http.StatusRequestEntityTooLarge, errCodeVideoTooLarge, msg, err, map[string]any{"limit_bytes": cfg.maxVideoUploadBytes})
+}
+
+// processVideo probes and remuxes an uploaded file with the given container
+// profile, tagging it with the video's metadata, stores it in S3, and
+// points the video at it.
+func (cfg *apiConfig) processVideo(ctx context.Context, videoID uuid.UUID, sourcePath, containerProfile string) error {
+	video, err := cfg.db.GetVideo(ctx, videoID)
+	if err != nil {
+		return fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		return errors.New("video no longer exists")
+	}
+
+	var probe videoProbe
+	err = cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		probe, err = probeVideo(ctx, cfg.ffprobePath, sourcePath)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't probe video: %w", err)
+	}
+	aspect := probe.aspect()
+	prefix := string(aspect)
+
+	// Taking the video down for quarantine changes its visibility, so keep
+	// the one to restore if the file is released.
+	previousVisibility := video.Visibility
+	quarantine, err := cfg.moderateVideo(ctx, videoID, sourcePath, probe.DurationSeconds)
+	if err != nil {
+		return err
 	}
 
-    processedPath, err := processVideoForFastStart(tmpFile.Name())
-    if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "unable to process video", err)
-        return
-    }
-    processedFile, err := os.Open(processedPath)
-    if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "error reading processed file", err)
-        return
-    }
+	// Without PRESERVE_HDR, an HDR upload is tone-mapped first, and the SDR
+	// copy is processed in its place.
+	if probe.HDR != "" && !cfg.preserveHDR {
+		var sdrPath string
+		err = cfg.ffmpegBreaker.do(ctx, func() (err error) {
+			sdrPath, err = toneMapSDR(ctx, cfg.ffmpegPath, sourcePath)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't tone-map video: %w", err)
+		}
+		defer os.Remove(sdrPath)
+		sourcePath = sdrPath
+		err = cfg.ffmpegBreaker.do(ctx, func() (err error) {
+			probe, err = probeVideo(ctx, cfg.ffprobePath, sourcePath)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't probe tone-mapped video: %w", err)
+		}
+	}
+
+	// Re-encoding would lose HDR and 360° metadata, so those videos keep
+	// their variable frame rate.
+	if probe.VariableFrameRate && cfg.normalizeFrameRate && probe.HDR == "" && probe.Projection == "" {
+		var cfrPath string
+		err = cfg.ffmpegBreaker.do(ctx, func() (err error) {
+			cfrPath, err = normalizeFrameRate(ctx, cfg.ffmpegPath, sourcePath, standardFrameRate(probe.FrameRate))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't normalize frame rate: %w", err)
+		}
+		defer os.Remove(cfrPath)
+		sourcePath = cfrPath
+		err = cfg.ffmpegBreaker.do(ctx, func() (err error) {
+			probe, err = probeVideo(ctx, cfg.ffprobePath, sourcePath)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't probe normalized video: %w", err)
+		}
+	}
 
-	extension := strings.Split(mediaType, "/")[1]
+	metadata, err := cfg.videoFileMetadata(ctx, video)
+	if err != nil {
+		return err
+	}
+	var processedPath string
+	err = cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		processedPath, err = remuxVideo(ctx, cfg.ffmpegPath, sourcePath, containerProfile, metadata)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't process video: %w", err)
+	}
+	defer os.Remove(processedPath)
+	processedFile, err := os.Open(processedPath)
+	if err != nil {
+		return fmt.Errorf("couldn't read processed file: %w", err)
+	}
+	defer processedFile.Close()
+	processedInfo, err := processedFile.Stat()
+	if err != nil {
+		return fmt.Errorf("couldn't read processed file: %w", err)
+	}
+
+	mediaType := "video/mp4"
 	randBuf := make([]byte, 32)
 	_, err = rand.Read(randBuf)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "cannot create random buf", err)
-		return
+		return err
+	}
+	filename := prefix + "/" + base64.RawURLEncoding.EncodeToString(randBuf) + ".mp4"
+
+	// Files of users in compliance mode are locked as they're stored. A
+	// quarantined file is locked when it's released instead.
+	var retainUntil *time.Time
+	if !quarantine {
+		retainUntil, err = cfg.uploadRetainUntil(ctx, video.UserID)
+		if err != nil {
+			return fmt.Errorf("couldn't get retention: %w", err)
+		}
+	}
+
+	// Record the object before writing it so that if the upload or the
+	// metadata update fails and cleanup doesn't finish, the reconciler can
+	// still find and remove it.
+	pending, err := cfg.db.CreatePendingUpload(ctx, videoID, filename)
+	if err != nil {
+		return fmt.Errorf("couldn't record upload: %w", err)
+	}
+
+	// A quarantined file never reaches the serving path. The video still
+	// points at filename, where the file goes if it's released.
+	bucket, key := cfg.s3Bucket, filename
+	if quarantine {
+		bucket, key = cfg.quarantineBucket, cfg.quarantinePrefix+filename
 	}
-	randBufBase64 := base64.RawURLEncoding.EncodeToString(randBuf)
-	filename := prefix + "/" + randBufBase64 + "." + extension
 
+	// From here a failure abandons the upload along with the renditions
+	// packaged from it so far.
+	var packaged []database.Rendition
+	abandon := func(err error) error {
+		cleanupCtx := context.WithoutCancel(ctx)
+		cfg.abandonUpload(cleanupCtx, pending)
+		cfg.abandonQuarantinedFile(cleanupCtx, quarantine, bucket, key)
+		cfg.deleteRenditions(cleanupCtx, packaged)
+		return err
+	}
 	params := s3.PutObjectInput{
-		Bucket:      &cfg.s3Bucket,
-		Key:         &filename,
+		Bucket:      &bucket,
+		Key:         &key,
 		Body:        processedFile,
 		ContentType: &mediaType,
 	}
-	_, err = cfg.s3Client.PutObject(r.Context(), &params)
+	if retainUntil != nil {
+		params.ObjectLockMode = types.ObjectLockMode(cfg.objectLockMode)
+		params.ObjectLockRetainUntilDate = retainUntil
+		if video.RetainUntil == nil || retainUntil.After(*video.RetainUntil) {
+			video.RetainUntil = retainUntil
+		}
+	}
+	_, err = cfg.s3Client.PutObject(ctx, &params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "unable to write to s3", err)
-		return
+		return abandon(fmt.Errorf("couldn't write to s3: %w", err))
 	}
 
 	url := fmt.Sprintf("%s/%s", cfg.s3CfDistribution, filename)
-	videoMetadata.VideoURL = &url
-	err = cfg.db.UpdateVideo(videoMetadata)
+	video.VideoURL = &url
+	sizeBytes := processedInfo.Size()
+	video.MediaInfo = database.MediaInfo{
+		DurationSeconds: &probe.DurationSeconds,
+		Width:           &probe.Width,
+		Height:          &probe.Height,
+		FrameRate:       &probe.FrameRate,
+		SizeBytes:       &sizeBytes,
+	}
+	if probe.Projection != "" {
+		video.Projection = &probe.Projection
+	}
+	if probe.HDR != "" {
+		video.HDR = &probe.HDR
+	}
+	video.Aspect = &aspect
+	video.Status = database.VideoStatusReady
+	source := database.Rendition{
+		Quality:          database.RenditionQualitySource,
+		Codec:            probe.Codec,
+		S3Key:            filename,
+		SizeBytes:        sizeBytes,
+		Bitrate:          probe.Bitrate,
+		ContainerProfile: containerProfile,
+	}
+	cfg.scoreRendition(ctx, videoID, &source, processedPath, sourcePath, probe)
+	// A quarantined video only gets its MP4; a backfill adds the other
+	// renditions after it's released.
+	if !quarantine && cfg.featureEnabled(flagHLSOutput, video.UserID) {
+		hls, err := cfg.packageVideoHLS(ctx, videoID, processedPath, probe)
+		if err != nil {
+			return abandon(err)
+		}
+		packaged = append(packaged, hls)
+	}
+	if !quarantine && probe.HDR != "" {
+		sdr, err := cfg.packageVideoSDR(ctx, processedPath, probe)
+		if err != nil {
+			return abandon(err)
+		}
+		packaged = append(packaged, sdr)
+	}
+	// Cropping and re-encoding drop a 360° video's projection, so it gets
+	// neither a vertical rendition nor a trailer.
+	spherical := probe.Projection != ""
+	if !quarantine && !spherical && probe.Width > probe.Height && cfg.featureEnabled(flagVerticalRendition, video.UserID) {
+		vertical, err := cfg.packageVideoVertical(ctx, processedPath, probe)
+		if err != nil {
+			return abandon(err)
+		}
+		packaged = append(packaged, vertical)
+	}
+	if !quarantine && !spherical && probe.DurationSeconds >= trailerMinSourceSeconds && cfg.featureEnabled(flagTrailerOutput, video.UserID) {
+		trailer, err := cfg.packageVideoTrailer(ctx, processedPath, probe)
+		if err != nil {
+			return abandon(err)
+		}
+		packaged = append(packaged, trailer)
+	}
+	if !quarantine && probe.HasAudio && cfg.featureEnabled(flagAudioOutput, video.UserID) {
+		audio, err := cfg.packageVideoAudio(ctx, processedPath, probe)
+		if err != nil {
+			return abandon(err)
+		}
+		packaged = append(packaged, audio)
+	}
+	renditions := append([]database.Rendition{source}, packaged...)
+	err = cfg.db.FinalizeVideoUpload(ctx, video, pending.ID, renditions, probe.AudioTracks)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "unable to update video metadata", err)
-		return
+		return abandon(fmt.Errorf("couldn't update video: %w", err))
+	}
+	if quarantine {
+		err := cfg.recordQuarantinedFile(ctx, database.QuarantineObjectParams{
+			VideoID:            videoID,
+			Bucket:             bucket,
+			Key:                key,
+			OriginalKey:        filename,
+			Reason:             quarantineReasonContentScan,
+			PreviousVisibility: previousVisibility,
+		})
+		if err != nil {
+			cfg.abandonQuarantinedFile(context.WithoutCancel(ctx), quarantine, bucket, key)
+			return err
+		}
 	}
+	return nil
+}
 
-	respondWithJSON(w, http.StatusOK, videoMetadata)
+// deleteRenditions deletes the files of renditions that were packaged for
+// an upload that then failed.
+func (cfg *apiConfig) deleteRenditions(ctx context.Context, renditions []database.Rendition) {
+	for _, rendition := range renditions {
+		if err := cfg.deleteVideoObject(ctx, rendition.S3Key); err != nil {
+			slog.ErrorContext(ctx, "Couldn't delete abandoned rendition", "key", rendition.S3Key, "error", err)
+		}
+	}
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
-	buf := bytes.Buffer{}
-	cmd.Stdout = &buf
-	err := cmd.Run()
-	if err != nil {
-		return "", err
-	}
-
-	data := struct {
-		Streams []struct {
-			Height float64 `json:"height"`
-			Width  float64 `json:"width"`
-        } `json:"streams"`
-	}{}
-	err = json.Unmarshal(buf.Bytes(), &data)
-	// height / width > 1 < 2 then 16:9 else < 1 then 9:16 else > 2 then other
-	// This is not the ideal way to determine aspect ration, but for this demo it is sufficient
-    if len(data.Streams) < 1 {
-        return "", errors.New("Missing video stream data")
-    }
-	result := data.Streams[0].Width / data.Streams[0].Height
-	switch {
-	case result < 1.0:
-		return "9:16", nil
-	case result > 1.0 && result < 2.0:
-		return "16:9", nil
-	default:
-		return "other", nil
+// videoFileMetadata is what processVideo tags a video's MP4 with: its
+// title, its channel as the artist, its embed URL as the comment, and when
+// it was created. Uploaders' email addresses are private, so videos
+// outside a channel have no artist.
+func (cfg *apiConfig) videoFileMetadata(ctx context.Context, video database.Video) (fileMetadata, error) {
+	metadata := fileMetadata{
+		Title:     video.Title,
+		Comment:   cfg.baseURL + "/embed/" + video.ID.String(),
+		CreatedAt: video.CreatedAt,
+	}
+	if video.ChannelID != nil {
+		channel, err := cfg.db.GetChannel(ctx, *video.ChannelID)
+		if err != nil {
+			return fileMetadata{}, fmt.Errorf("couldn't get channel: %w", err)
+		}
+		metadata.Artist = channel.Name
 	}
+	return metadata, nil
 }
 
-func processVideoForFastStart(filePath string) (string, error) {
-    outputPath := filePath + ".processing"
-    cmd := exec.Command(
-        "ffmpeg", "-i", filePath,
-        "-c", "copy", "-movflags",
-        "faststart", "-f", "mp4",
-        outputPath,
-    )
-    err := cmd.Run()
-    if err != nil {
-        return "", err
-    }
-
-    return outputPath, nil
+// announceProcessedVideo tells the owner and subscribers that an upload has
+// finished processing.
+func (cfg *apiConfig) announceProcessedVideo(ctx context.Context, videoID uuid.UUID) {
+	// Pick up any metadata edits made while the file was processing.
+	video, err := cfg.db.GetVideo(ctx, videoID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get processed video", "video_id", videoID, "error", err)
+		return
+	}
+	cfg.publishEvent(ctx, video.UserID, eventVideoUploaded, video)
+	go cfg.notifySubscribers(context.WithoutCancel(ctx), video)
+	cfg.notify(ctx, database.CreateNotificationParams{
+		UserID:  video.UserID,
+		Type:    database.NotificationProcessingFinished,
+		VideoID: &video.ID,
+	})
+	go cfg.sendEmail(context.WithoutCancel(ctx), video.UserID, database.EmailProcessingComplete, emailData{Video: video})
+	if video.SizeBytes != nil {
+		go cfg.checkQuotaWarning(context.WithoutCancel(ctx), video.UserID, *video.SizeBytes)
+	}
 }
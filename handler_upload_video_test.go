@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerUploadVideoQueuesProcessing(t *testing.T) {
+	cfg, store, s3Client := newTestConfig(t)
+	userID := uuid.New()
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: userID}, Status: database.VideoStatusDraft}
+	statuses := stubVideo(store, video)
+	var job database.CreateJobParams
+	store.CreateJobFunc = func(ctx context.Context, params database.CreateJobParams) (database.Job, error) {
+		job = params
+		return database.Job{ID: uuid.New()}, nil
+	}
+
+	body := []byte("not really an mp4")
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, userID, "video", "clip.mp4", "video/mp4", body))
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+	if len(*statuses) != 1 || (*statuses)[0] != database.VideoStatusProcessing {
+		t.Errorf("statuses = %v, want [processing]", *statuses)
+	}
+	if job.Type != jobTypeProcessVideo || job.VideoID == nil || *job.VideoID != video.ID {
+		t.Fatalf("queued job = %+v, want process_video for %s", job, video.ID)
+	}
+	payload := job.Payload.(processVideoPayload)
+	if payload.HadVideo || payload.ContainerProfile != containerProfileProgressive {
+		t.Errorf("payload = %+v", payload)
+	}
+	spooled, err := os.ReadFile(payload.SourcePath)
+	if err != nil {
+		t.Fatalf("spooled upload: %v", err)
+	}
+	if !bytes.Equal(spooled, body) {
+		t.Errorf("spooled upload = %q, want %q", spooled, body)
+	}
+	// Nothing is stored until the job runs.
+	if len(s3Client.Objects) != 0 {
+		t.Errorf("objects stored before processing: %v", s3Client.Objects)
+	}
+}
+
+func TestHandlerUploadVideoRejectsOtherUsersVideo(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New()}}
+	stubVideo(store, video)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, uuid.New(), "video", "clip.mp4", "video/mp4", []byte("data")))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+}
+
+func TestHandlerUploadVideoRejectsOtherMediaTypes(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	userID := uuid.New()
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: userID}}
+	statuses := stubVideo(store, video)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, userID, "video", "clip.mov", "video/quicktime", []byte("data")))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if code := errorCodeOf(t, rec); code != errCodeUnsupportedMediaType {
+		t.Errorf("code = %s, want %s", code, errCodeUnsupportedMediaType)
+	}
+	if len(*statuses) != 0 {
+		t.Errorf("statuses = %v, want none", *statuses)
+	}
+}
+
+func TestHandlerUploadVideoOverQuota(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	cfg.quotas.StorageBytes = 8
+	userID := uuid.New()
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: userID}}
+	statuses := stubVideo(store, video)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, userID, "video", "clip.mp4", "video/mp4", []byte("more than eight bytes")))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+	if code := errorCodeOf(t, rec); code != errCodeQuotaExceeded {
+		t.Errorf("code = %s, want %s", code, errCodeQuotaExceeded)
+	}
+	want := []database.VideoStatus{database.VideoStatusProcessing, database.VideoStatusFailed}
+	if len(*statuses) != 2 || (*statuses)[0] != want[0] || (*statuses)[1] != want[1] {
+		t.Errorf("statuses = %v, want %v", *statuses, want)
+	}
+	if entries, _ := os.ReadDir(cfg.uploadsRoot); len(entries) != 0 {
+		t.Errorf("spooled upload wasn't removed: %v", entries)
+	}
+}
+
+func TestHandlerUploadVideoKeepsPreviousFileWhenQueueFails(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	userID := uuid.New()
+	videoURL := "https://cdn.example.com/landscape/old.mp4"
+	video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: userID}, VideoURL: &videoURL, Status: database.VideoStatusReady}
+	statuses := stubVideo(store, video)
+	store.CreateJobFunc = func(ctx context.Context, params database.CreateJobParams) (database.Job, error) {
+		return database.Job{}, errors.New("queue unavailable")
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, userID, "video", "clip.mp4", "video/mp4", []byte("data")))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusInternalServerError, rec.Body)
+	}
+	if video.Status != database.VideoStatusReady {
+		t.Errorf("status = %s after %v, want ready", video.Status, *statuses)
+	}
+	if entries, _ := os.ReadDir(cfg.uploadsRoot); len(entries) != 0 {
+		t.Errorf("spooled upload wasn't removed: %v", entries)
+	}
+}
+
+func TestDeleteRenditions(t *testing.T) {
+	cfg, _, s3Client := newTestConfig(t)
+	for _, key := range []string{
+		"landscape/abc/hls/" + hlsPlaylistName,
+		"landscape/abc/hls/720p/segment0.m4s",
+		"landscape/abc-trailer.mp4",
+		"landscape/abc-vertical.mp4",
+		"landscape/keep.mp4",
+	} {
+		s3Client.Objects[key] = []byte("data")
+	}
+	// A failed delete is logged and doesn't stop the rest.
+	s3Client.Holds["landscape/abc-trailer.mp4"] = true
+
+	cfg.deleteRenditions(context.Background(), []database.Rendition{
+		{S3Key: "landscape/abc/hls/" + hlsPlaylistName},
+		{S3Key: "landscape/abc-trailer.mp4"},
+		{S3Key: "landscape/abc-vertical.mp4"},
+	})
+
+	want := map[string]bool{"landscape/abc-trailer.mp4": true, "landscape/keep.mp4": true}
+	if len(s3Client.Objects) != len(want) {
+		t.Errorf("objects left = %v, want %v", s3Client.Objects, want)
+	}
+	for key := range s3Client.Objects {
+		if !want[key] {
+			t.Errorf("%s wasn't deleted", key)
+		}
+	}
+}
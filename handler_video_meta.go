@@ -2,7 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -33,13 +36,43 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	params.UserID = userID
+	if cfg.rejectBanned(r.Context(), w, userID) || cfg.rejectSuspended(r.Context(), w, userID) {
+		return
+	}
+	quota, err := cfg.quotaStatus(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get quota", err)
+		return
+	}
+	setQuotaHeaders(w, quota)
+	if quota.dailyVideosExhausted() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(quota.ResetsAt).Seconds())+1))
+		respondWithErrorCode(w, http.StatusTooManyRequests, errCodeDailyLimitReached, "You've reached your daily video limit", nil, quotaDetails(quota))
+		return
+	}
+	if params.Visibility != "" && !params.Visibility.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Visibility must be public, unlisted, or private", nil)
+		return
+	}
+	if params.ChannelID != nil {
+		role, err := cfg.db.GetChannelRole(r.Context(), *params.ChannelID, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get channel membership", err)
+			return
+		}
+		if !role.AtLeast(database.ChannelRoleEditor) {
+			respondWithError(w, http.StatusForbidden, "You can't upload to this channel", nil)
+			return
+		}
+	}
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	video, err := cfg.db.CreateVideo(r.Context(), params.CreateVideoParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
 	}
 
+	cfg.publishEvent(r.Context(), userID, eventVideoCreated, video)
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
@@ -62,40 +95,81 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
-	if video.UserID != userID {
+	if !cfg.canEditVideo(r.Context(), video, userID) {
 		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
 		return
 	}
+	current, err := cfg.newVideoResponse(r.Context(), video, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if !checkPreconditions(w, r, current) {
+		return
+	}
+	if underRetention(video) {
+		respondWithErrorCode(w, http.StatusConflict, errCodeUnderRetention, "Video can't be deleted until its retention ends", nil, map[string]any{"retain_until": video.RetainUntil})
+		return
+	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	err = cfg.db.SoftDeleteVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
+	cfg.sitemap.invalidate()
+	cfg.publishEvent(r.Context(), video.UserID, eventVideoDeleted, video)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handlerVideoGet looks a video up by ID, or by slug when the path value isn't
+// a UUID. Slugs share this route instead of /api/videos/by-slug/{slug}, which
+// ServeMux rejects as conflicting with the /api/videos/{videoID}/... routes.
 func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+	var video database.Video
+	if videoID, err := uuid.Parse(videoIDString); err == nil {
+		video, err = cfg.db.GetVideo(r.Context(), videoID)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+			return
+		}
+	} else {
+		if !database.ValidSlug(videoIDString) {
+			respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+			return
+		}
+		video, err = cfg.db.GetVideoBySlug(r.Context(), videoIDString)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+			return
+		}
+	}
+
+	userID := cfg.optionalUserID(r)
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(r.Context(), video, userID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if !cfg.checkGeoRestriction(w, r, video, userID) {
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	resp, err := cfg.newVideoResponse(r.Context(), video, userID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
 		return
 	}
-
-	respondWithJSON(w, http.StatusOK, video)
+	// A 304 means the player already has the URLs from an earlier view.
+	if respondWithETaggedJSON(w, r, http.StatusOK, resp) {
+		cfg.recordPlayback(r.Context(), video, userID)
+	}
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
@@ -110,11 +184,89 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	params, err := parseVideoListParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if channel := r.URL.Query().Get("channel"); channel != "" {
+		channelID, err := uuid.Parse(channel)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "channel must be a channel ID", err)
+			return
+		}
+		role, err := cfg.db.GetChannelRole(r.Context(), channelID, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get channel membership", err)
+			return
+		}
+		if role == "" {
+			respondWithError(w, http.StatusNotFound, "Channel not found", nil)
+			return
+		}
+		params.ChannelID = channelID
+		if owner := r.URL.Query().Get("owner"); owner == "" {
+			cfg.respondWithVideoPage(w, r, params)
+			return
+		}
+	}
+
+	// Listing another user's videos only shows what they've made public.
+	switch owner := r.URL.Query().Get("owner"); owner {
+	case "", "me":
+		params.UserID = userID
+	default:
+		ownerID, err := uuid.Parse(owner)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "owner must be \"me\" or a user ID", err)
+			return
+		}
+		params.UserID = ownerID
+		params.PublicOnly = ownerID != userID
+	}
+
+	cfg.respondWithVideoPage(w, r, params)
+}
+
+func (cfg *apiConfig) handlerVideosPublic(w http.ResponseWriter, r *http.Request) {
+	params, err := parseVideoListParams(r)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
+	params.PublicOnly = true
+
+	if owner := r.URL.Query().Get("owner"); owner != "" {
+		params.UserID, err = uuid.Parse(owner)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "owner must be a user ID", err)
+			return
+		}
+	}
+
+	cfg.respondWithVideoPage(w, r, params)
+}
 
-	respondWithJSON(w, http.StatusOK, videos)
+// parseVideoListParams reads the pagination and filter query parameters
+// shared by the video listing endpoints.
+func parseVideoListParams(r *http.Request) (database.ListVideosParams, error) {
+	limit, after, before, err := parseCursorPagination(r)
+	if err != nil {
+		return database.ListVideosParams{}, err
+	}
+	params := database.ListVideosParams{
+		Limit:  limit,
+		After:  after,
+		Before: before,
+		Status: database.VideoStatus(r.URL.Query().Get("status")),
+		Aspect: database.Aspect(r.URL.Query().Get("aspect")),
+	}
+	if params.Status != "" && !params.Status.Valid() {
+		return database.ListVideosParams{}, errors.New("status must be draft, processing, ready, failed, or live")
+	}
+	if params.Aspect != "" && !params.Aspect.Valid() {
+		return database.ListVideosParams{}, errors.New("aspect must be landscape, portrait, or other")
+	}
+	return params, nil
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideoGetRecordsPlayback(t *testing.T) {
+	ownerID := uuid.New()
+	viewerID := uuid.New()
+	videoURL := "https://cdn.example.com/landscape/clip.mp4"
+	ready := database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: ownerID, Visibility: database.VisibilityPublic}, VideoURL: &videoURL, Status: database.VideoStatusReady}
+	draft := ready
+	draft.VideoURL = nil
+	draft.Status = database.VideoStatusDraft
+
+	tests := []struct {
+		name         string
+		video        database.Video
+		viewerID     uuid.UUID
+		revalidate   bool
+		wantViews    int
+		wantWatches  int
+		wantStatusOK bool
+	}{
+		{"signed-in viewer", ready, viewerID, false, 1, 1, true},
+		{"anonymous viewer", ready, uuid.Nil, false, 1, 0, true},
+		{"owner", ready, ownerID, false, 0, 0, true},
+		{"not modified", ready, viewerID, true, 0, 0, false},
+		{"nothing to play", draft, viewerID, false, 0, 0, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, store, _ := newTestConfig(t)
+			store.Store = videoDetailsStore{store.Store}
+			video := tc.video
+			stubVideo(store, &video)
+			views, watches := 0, 0
+			store.RecordViewFunc = func(ctx context.Context, videoID uuid.UUID) error {
+				views++
+				return nil
+			}
+			store.RecordWatchFunc = func(ctx context.Context, userID, videoID uuid.UUID) (database.WatchHistoryEntry, error) {
+				if userID != tc.viewerID {
+					t.Errorf("watch recorded for %s, want %s", userID, tc.viewerID)
+				}
+				watches++
+				return database.WatchHistoryEntry{}, nil
+			}
+
+			get := func(etag string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/api/videos/"+video.ID.String(), nil)
+				req.SetPathValue("videoID", video.ID.String())
+				if tc.viewerID != uuid.Nil {
+					authorize(t, req, tc.viewerID)
+				}
+				if etag != "" {
+					req.Header.Set("If-None-Match", etag)
+				}
+				rec := httptest.NewRecorder()
+				cfg.handlerVideoGet(rec, req)
+				return rec
+			}
+			rec := get("")
+			if tc.revalidate {
+				views, watches = 0, 0
+				rec = get(rec.Header().Get("ETag"))
+			}
+
+			if gotOK := rec.Code == http.StatusOK; gotOK != tc.wantStatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			if views != tc.wantViews || watches != tc.wantWatches {
+				t.Errorf("recorded %d views and %d watches, want %d and %d", views, watches, tc.wantViews, tc.wantWatches)
+			}
+		})
+	}
+}
+
+// videoDetailsStore has no renditions, chapters, audio tracks or saved
+// state for any video, which is all the video response reads besides the
+// video itself.
+type videoDetailsStore struct {
+	database.Store
+}
+
+func (videoDetailsStore) GetRenditions(ctx context.Context, videoID uuid.UUID) ([]database.Rendition, error) {
+	return nil, nil
+}
+
+func (videoDetailsStore) GetChapters(ctx context.Context, videoID uuid.UUID) ([]database.Chapter, error) {
+	return nil, nil
+}
+
+func (videoDetailsStore) GetAudioTracks(ctx context.Context, videoID uuid.UUID) ([]database.AudioTrack, error) {
+	return nil, nil
+}
+
+func (videoDetailsStore) GetPlaybackPosition(ctx context.Context, userID, videoID uuid.UUID) (*database.PlaybackPosition, error) {
+	return nil, nil
+}
+
+func (videoDetailsStore) IsInWatchLater(ctx context.Context, userID, videoID uuid.UUID) (bool, error) {
+	return false, nil
+}
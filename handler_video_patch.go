@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 5000
+	maxTagsPerVideo      = 20
+)
+
+func (cfg *apiConfig) handlerVideoPatch(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string              `json:"title"`
+		Description *string              `json:"description"`
+		Tags        *[]string            `json:"tags"`
+		Visibility  *database.Visibility `json:"visibility"`
+		Slug        *string              `json:"slug"`
+	}
+	type validationErrorResponse struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	fieldErrors := map[string]string{}
+	if params.Title != nil {
+		switch {
+		case *params.Title == "":
+			fieldErrors["title"] = "must not be empty"
+		case len(*params.Title) > maxTitleLength:
+			fieldErrors["title"] = "is too long"
+		}
+	}
+	if params.Description != nil && len(*params.Description) > maxDescriptionLength {
+		fieldErrors["description"] = "is too long"
+	}
+	if params.Visibility != nil && !params.Visibility.Valid() {
+		fieldErrors["visibility"] = "must be public, unlisted, or private"
+	}
+	if params.Slug != nil && !database.ValidSlug(*params.Slug) {
+		fieldErrors["slug"] = "must be lowercase letters, digits, and single dashes"
+	}
+	if params.Tags != nil {
+		if len(*params.Tags) > maxTagsPerVideo {
+			fieldErrors["tags"] = "has too many entries"
+		}
+		tags := make([]string, 0, len(*params.Tags))
+		for _, tag := range *params.Tags {
+			normalized, err := normalizeTag(tag)
+			if err != nil {
+				fieldErrors["tags"] = err.Error()
+				break
+			}
+			tags = append(tags, normalized)
+		}
+		params.Tags = &tags
+	}
+	if len(fieldErrors) > 0 {
+		respondWithJSON(w, http.StatusBadRequest, validationErrorResponse{
+			Error:  "Invalid video metadata",
+			Fields: fieldErrors,
+		})
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if !cfg.canEditVideo(r.Context(), video, userID) {
+		respondWithError(w, http.StatusForbidden, "You can't edit this video", nil)
+		return
+	}
+	current, err := cfg.newVideoResponse(r.Context(), video, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if !checkPreconditions(w, r, current) {
+		return
+	}
+	if params.Visibility != nil && video.TakenDownAt != nil {
+		respondWithError(w, http.StatusForbidden, "Visibility can't be changed on a video that was taken down", nil)
+		return
+	}
+	if params.Slug != nil {
+		available, err := cfg.db.SlugAvailable(r.Context(), *params.Slug, video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check slug", err)
+			return
+		}
+		if !available {
+			respondWithJSON(w, http.StatusConflict, validationErrorResponse{
+				Error:  "Invalid video metadata",
+				Fields: map[string]string{"slug": "is already taken"},
+			})
+			return
+		}
+	}
+
+	err = cfg.db.UpdateVideoMetadata(r.Context(), videoID, database.UpdateVideoMetadataParams{
+		Title:       params.Title,
+		Description: params.Description,
+		Visibility:  params.Visibility,
+		Slug:        params.Slug,
+		Tags:        params.Tags,
+		Version:     &video.Version,
+	})
+	if errors.Is(err, database.ErrVideoConflict) {
+		respondWithError(w, http.StatusConflict, "Video was modified by another request", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	video, err = cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	go cfg.notifySubscribers(context.WithoutCancel(r.Context()), video)
+
+	resp, err := cfg.newVideoResponse(r.Context(), video, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if etag, err := computeETag(resp); err == nil {
+		w.Header().Set("ETag", etag)
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func validateWebhookParams(rawURL string, eventTypes []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	// Hostnames are checked again when a delivery connects, since DNS can
+	// change after the subscription is saved.
+	host := u.Hostname()
+	if ip := net.ParseIP(host); (ip != nil && !publicIP(ip)) || strings.EqualFold(host, "localhost") {
+		return errWebhookAddress
+	}
+	if len(eventTypes) == 0 {
+		return errors.New("event_types must not be empty")
+	}
+	for _, t := range eventTypes {
+		if !webhookEventTypes[t] {
+			return errors.New("unknown event type: " + t)
+		}
+	}
+	return nil
+}
+
+// getOwnedWebhook loads a subscription from the path and checks that it
+// belongs to the authenticated user, writing an error response if not.
+func (cfg *apiConfig) getOwnedWebhook(w http.ResponseWriter, r *http.Request) (database.WebhookSubscription, bool) {
+	webhookID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.WebhookSubscription{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.WebhookSubscription{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.WebhookSubscription{}, false
+	}
+
+	sub, err := cfg.db.GetWebhookSubscription(r.Context(), webhookID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook", err)
+		return database.WebhookSubscription{}, false
+	}
+	if sub.ID == uuid.Nil || sub.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Webhook not found", nil)
+		return database.WebhookSubscription{}, false
+	}
+	return sub, true
+}
+
+func (cfg *apiConfig) handlerWebhookCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Secret     string   `json:"secret"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	err = validateWebhookParams(params.URL, params.EventTypes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if params.Secret == "" {
+		buf := make([]byte, 32)
+		_, err = rand.Read(buf)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate webhook secret", err)
+			return
+		}
+		params.Secret = hex.EncodeToString(buf)
+	}
+
+	sub, err := cfg.db.CreateWebhookSubscription(r.Context(), database.CreateWebhookSubscriptionParams{
+		UserID:     userID,
+		URL:        params.URL,
+		EventTypes: params.EventTypes,
+		Secret:     params.Secret,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create webhook", err)
+		return
+	}
+
+	// The secret is only ever returned on creation.
+	respondWithJSON(w, http.StatusCreated, sub)
+}
+
+func (cfg *apiConfig) handlerWebhooksList(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	subs, err := cfg.db.GetWebhookSubscriptions(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve webhooks", err)
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	respondWithJSON(w, http.StatusOK, subs)
+}
+
+func (cfg *apiConfig) handlerWebhookGet(w http.ResponseWriter, r *http.Request) {
+	sub, ok := cfg.getOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+	sub.Secret = ""
+	respondWithJSON(w, http.StatusOK, sub)
+}
+
+func (cfg *apiConfig) handlerWebhookUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+	}
+
+	sub, ok := cfg.getOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	err = validateWebhookParams(params.URL, params.EventTypes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	err = cfg.db.UpdateWebhookSubscription(r.Context(), sub.ID, params.URL, params.EventTypes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update webhook", err)
+		return
+	}
+
+	sub, err = cfg.db.GetWebhookSubscription(r.Context(), sub.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook", err)
+		return
+	}
+	sub.Secret = ""
+	respondWithJSON(w, http.StatusOK, sub)
+}
+
+func (cfg *apiConfig) handlerWebhookDelete(w http.ResponseWriter, r *http.Request) {
+	sub, ok := cfg.getOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeleteWebhookSubscription(r.Context(), sub.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete webhook", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	sub, ok := cfg.getOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	deliveries, err := cfg.db.GetWebhookDeliveries(r.Context(), sub.ID, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve deliveries", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, deliveries)
+}
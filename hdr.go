@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+)
+
+// HDR formats, told apart by the transfer function ffprobe reports.
+const (
+	hdrFormatHDR10 = "hdr10"
+	hdrFormatHLG   = "hlg"
+)
+
+// hdrFormat is the HDR format of a video stream with the given transfer
+// function, or "" for SDR.
+func hdrFormat(colorTransfer string) string {
+	switch colorTransfer {
+	case "smpte2084":
+		return hdrFormatHDR10
+	case "arib-std-b67":
+		return hdrFormatHLG
+	}
+	return ""
+}
+
+// sdrToneMapFilter converts HDR video to BT.709 SDR: zscale linearises it,
+// tonemap compresses the highlights with the Hable curve, and zscale puts
+// it back into BT.709. It needs an ffmpeg built with libzimg.
+const sdrToneMapFilter = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+// toneMapSDR re-encodes an HDR video as an SDR H.264 MP4 beside it, keeping
+// every audio stream.
+func toneMapSDR(ctx context.Context, ffmpegPath, filePath string) (string, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg tonemap", tracing.KindInternal)
+	defer span.End()
+	outputPath := filePath + ".sdr.mp4"
+	cmd := exec.CommandContext(ctx,
+		ffmpegPath, "-i", filePath,
+		"-map", "0:v:0", "-map", "0:a?",
+		"-vf", sdrToneMapFilter,
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "20",
+		"-c:a", "copy",
+		"-movflags", "faststart",
+		"-y", outputPath,
+	)
+	if err := runCommand(cmd); err != nil {
+		span.RecordError(err)
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// packageVideoSDR tone-maps an HDR video to SDR, for the many screens and
+// browsers that show HDR washed out, and stores it in S3.
+func (cfg *apiConfig) packageVideoSDR(ctx context.Context, processedPath string, probe videoProbe) (database.Rendition, error) {
+	var sdrPath string
+	err := cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		sdrPath, err = toneMapSDR(ctx, cfg.ffmpegPath, processedPath)
+		return err
+	})
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't tone-map video: %w", err)
+	}
+	defer os.Remove(sdrPath)
+
+	key, size, err := cfg.uploadEncodedFile(ctx, sdrPath, string(probe.aspect()), "video/mp4")
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't write SDR rendition to s3: %w", err)
+	}
+	var bitrate int64
+	if probe.DurationSeconds > 0 {
+		bitrate = int64(float64(size*8) / probe.DurationSeconds)
+	}
+	return database.Rendition{
+		Quality:          database.RenditionQualitySDR,
+		Codec:            "h264",
+		S3Key:            key,
+		SizeBytes:        size,
+		Bitrate:          bitrate,
+		ContainerProfile: containerProfileProgressive,
+	}, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// heatmapMaxSeconds bounds a heatmap's length.
+const heatmapMaxSeconds = 24 * 60 * 60
+
+// watchHeatmap counts, for each second of a video, the sessions that
+// watched it and the times it was watched. Plays above viewers mark parts
+// that were rewatched; a falling viewers count marks where viewers left.
+type watchHeatmap struct {
+	VideoID         uuid.UUID `json:"video_id"`
+	Days            int       `json:"days"`
+	Sessions        int       `json:"sessions"`
+	DurationSeconds int       `json:"duration_seconds"`
+	Viewers         []int     `json:"viewers"`
+	Plays           []int     `json:"plays"`
+}
+
+// handlerVideoHeatmap reports a video's watch heatmap for the sessions
+// started in the last days days, adding up the daily heatmaps the
+// analytics rollup stores.
+func (cfg *apiConfig) handlerVideoHeatmap(w http.ResponseWriter, r *http.Request) {
+	video, _, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	days, err := parseStatsDays(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	daily, err := cfg.db.GetVideoHeatmaps(r.Context(), video.ID, statsSince(days).Format(time.DateOnly))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get heatmap", err)
+		return
+	}
+
+	length := 0
+	if video.DurationSeconds != nil {
+		length = int(math.Ceil(*video.DurationSeconds))
+	} else {
+		for _, h := range daily {
+			length = max(length, len(h.Viewers))
+		}
+	}
+	length = min(length, heatmapMaxSeconds)
+	heatmap := watchHeatmap{
+		VideoID:         video.ID,
+		Days:            days,
+		DurationSeconds: length,
+		Viewers:         make([]int, length),
+		Plays:           make([]int, length),
+	}
+	for _, h := range daily {
+		heatmap.Sessions += h.Sessions
+		for i := 0; i < min(length, len(h.Viewers), len(h.Plays)); i++ {
+			heatmap.Viewers[i] += h.Viewers[i]
+			heatmap.Plays[i] += h.Plays[i]
+		}
+	}
+	respondWithJSON(w, http.StatusOK, heatmap)
+}
+
+// watchedSpan is a stretch of a video a session played through.
+type watchedSpan struct {
+	from, to float64
+}
+
+// buildWatchHeatmap replays each session's events, which must be grouped by
+// session in the order they happened. Playback runs from a play until the
+// next pause or seek; a session that stops reporting while playing is
+// taken to have watched up to its last reported position. The heatmap runs
+// to the furthest second watched.
+func buildWatchHeatmap(events []database.PlaybackEvent) watchHeatmap {
+	var sessions [][]watchedSpan
+	for start := 0; start < len(events); {
+		end := start + 1
+		for end < len(events) && events[end].SessionID == events[start].SessionID {
+			end++
+		}
+		if spans := sessionSpans(events[start:end]); len(spans) > 0 {
+			sessions = append(sessions, spans)
+		}
+		start = end
+	}
+
+	length := 0
+	for _, spans := range sessions {
+		for _, span := range spans {
+			length = max(length, int(math.Ceil(span.to)))
+		}
+	}
+	length = min(length, heatmapMaxSeconds)
+
+	heatmap := watchHeatmap{
+		Sessions:        len(sessions),
+		DurationSeconds: length,
+		Viewers:         make([]int, length),
+		Plays:           make([]int, length),
+	}
+	// lastSession[i] is the last session counted as a viewer of second i,
+	// plus one, so rewatches within a session aren't counted twice.
+	lastSession := make([]int, length)
+	for s, spans := range sessions {
+		for _, span := range spans {
+			for i := max(0, int(span.from)); i < min(length, int(math.Ceil(span.to))); i++ {
+				heatmap.Plays[i]++
+				if lastSession[i] != s+1 {
+					lastSession[i] = s + 1
+					heatmap.Viewers[i]++
+				}
+			}
+		}
+	}
+	return heatmap
+}
+
+// sessionSpans works out what one session played. A span can't be longer
+// than twice the time that passed, so a bogus position can't fill the map.
+func sessionSpans(events []database.PlaybackEvent) []watchedSpan {
+	var spans []watchedSpan
+	playing := false
+	var from float64
+	var since database.PlaybackEvent
+	stop := func(to float64, e database.PlaybackEvent) {
+		limit := from + 2*e.OccurredAt.Sub(since.OccurredAt).Seconds() + 1
+		if to = min(to, limit); to > from {
+			spans = append(spans, watchedSpan{from: from, to: to})
+		}
+	}
+	for _, e := range events {
+		switch e.Type {
+		case database.PlaybackEventPlay:
+			if playing {
+				stop(e.PositionSeconds, e)
+			}
+			playing, from, since = true, e.PositionSeconds, e
+		case database.PlaybackEventPause:
+			if playing {
+				stop(e.PositionSeconds, e)
+			}
+			playing = false
+		case database.PlaybackEventSeek:
+			if playing && e.FromSeconds != nil {
+				stop(*e.FromSeconds, e)
+				from, since = e.PositionSeconds, e
+			}
+		}
+	}
+	if playing {
+		last := events[len(events)-1]
+		stop(last.PositionSeconds, last)
+	}
+	return spans
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// hlsSegmentSeconds is the target length of an HLS segment. Streams are
+	// copied, so segments are cut at the nearest keyframe after it.
+	hlsSegmentSeconds = 6
+	hlsPlaylistName   = "index.m3u8"
+)
+
+// hlsContentTypes are the content types of the files packageHLS writes.
+var hlsContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+}
+
+// hlsAudioPlaylistName is the name of the audio-only playlist of the i'th
+// audio track, stored beside the main playlist. The first track has none;
+// it's muxed with the video.
+func hlsAudioPlaylistName(i int) string {
+	return fmt.Sprintf("audio_%d.m3u8", i)
+}
+
+// hlsKeyURL is where players fetch a video's HLS key.
+func (cfg *apiConfig) hlsKeyURL(videoID uuid.UUID) string {
+	return fmt.Sprintf("%s%s/videos/%s/hls.key", cfg.baseURL, apiVersionPrefix, videoID)
+}
+
+// hlsKeyTokenKey stands in for an S3 key in playback tokens that grant a
+// video's HLS key.
+const hlsKeyTokenKey = "hls.key"
+
+// playbackHLSKeyURL is the key URL with a playback token for viewerID, for
+// players that can't send the viewer's bearer token with key requests. It's
+// the bare URL when playback tokens are off.
+func (cfg *apiConfig) playbackHLSKeyURL(ctx context.Context, videoID, viewerID uuid.UUID, expiresAt time.Time) string {
+	keyURL := cfg.hlsKeyURL(videoID)
+	if cfg.playbackTokenSecret == "" {
+		return keyURL
+	}
+	token, err := auth.MakePlaybackToken(auth.PlaybackClaims{
+		VideoID:  videoID,
+		ViewerID: viewerID,
+		Key:      hlsKeyTokenKey,
+	}, cfg.playbackTokenSecret, expiresAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't make playback token", "video_id", videoID, "error", err)
+		return keyURL
+	}
+	return keyURL + "?token=" + url.QueryEscape(token)
+}
+
+// packageVideoHLS segments a processed file for HLS and uploads the
+// playlist and segments under a prefix of their own. The segments are
+// encrypted with the video's key when HLS encryption is on.
+func (cfg *apiConfig) packageVideoHLS(ctx context.Context, videoID uuid.UUID, processedPath string, probe videoProbe) (database.Rendition, error) {
+	var keyInfo *hlsKeyInfo
+	if cfg.hlsEncryption {
+		key, err := cfg.db.EnsureHLSKey(ctx, videoID)
+		if err != nil {
+			return database.Rendition{}, fmt.Errorf("couldn't get HLS key: %w", err)
+		}
+		keyInfo = &hlsKeyInfo{URI: cfg.hlsKeyURL(videoID), Key: key}
+	}
+
+	var dir string
+	err := cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		dir, err = packageHLS(ctx, cfg.ffmpegPath, processedPath, keyInfo, len(probe.AudioTracks))
+		return err
+	})
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't package HLS: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	randBuf := make([]byte, 32)
+	if _, err := rand.Read(randBuf); err != nil {
+		return database.Rendition{}, err
+	}
+	prefix := "hls/" + base64.RawURLEncoding.EncodeToString(randBuf) + "/"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't read HLS output: %w", err)
+	}
+	var sizeBytes int64
+	for _, entry := range entries {
+		size, err := cfg.uploadHLSFile(ctx, filepath.Join(dir, entry.Name()), prefix+entry.Name())
+		if err != nil {
+			if derr := cfg.deleteS3Prefix(context.WithoutCancel(ctx), prefix); derr != nil {
+				slog.ErrorContext(ctx, "Couldn't delete partial HLS upload", "prefix", prefix, "error", derr)
+			}
+			return database.Rendition{}, fmt.Errorf("couldn't write HLS to s3: %w", err)
+		}
+		sizeBytes += size
+	}
+
+	return database.Rendition{
+		Quality:   database.RenditionQualityHLS,
+		Codec:     probe.Codec,
+		S3Key:     prefix + hlsPlaylistName,
+		SizeBytes: sizeBytes,
+		Bitrate:   probe.Bitrate,
+	}, nil
+}
+
+func (cfg *apiConfig) uploadHLSFile(ctx context.Context, path, key string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	contentType := hlsContentTypes[strings.ToLower(filepath.Ext(path))]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &cfg.s3Bucket,
+		Key:         &key,
+		Body:        file,
+		ContentType: &contentType,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// handlerHLSKey serves the key a video's HLS segments are encrypted with,
+// to anyone who may view the video. Players of private videos have to send
+// the viewer's bearer token with the key request, or carry a share link's
+// token in ?share= or a playback token for the key in ?token=.
+func (cfg *apiConfig) handlerHLSKey(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.DeletedAt != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	viewerID := cfg.optionalUserID(r)
+	if !cfg.canViewVideo(r.Context(), video, viewerID) {
+		granted, err := cfg.hlsKeyGranted(r, video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+			return
+		}
+		if !granted {
+			respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+			return
+		}
+	}
+	if !cfg.checkGeoRestriction(w, r, video, viewerID) {
+		return
+	}
+	key, err := cfg.db.GetHLSKey(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get HLS key", err)
+		return
+	}
+	if key == nil {
+		respondWithError(w, http.StatusNotFound, "Video isn't encrypted", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(key)
+}
+
+// hlsKeyGranted reports whether a key request carries a token that opens up
+// video regardless of its visibility: an unexpired share link for it, or a
+// playback token for its key. Like share links themselves, neither works
+// once the video isn't available.
+func (cfg *apiConfig) hlsKeyGranted(r *http.Request, video database.Video) (bool, error) {
+	granted := false
+	if shareToken := r.URL.Query().Get("share"); shareToken != "" {
+		// Fetching the key doesn't count as a view, so a share link
+		// whose last view was just used still plays to the end.
+		share, err := cfg.db.GetVideoShareByToken(r.Context(), shareToken)
+		if err != nil {
+			return false, err
+		}
+		granted = share.VideoID == video.ID && time.Now().Before(share.ExpiresAt)
+	} else if token := r.URL.Query().Get("token"); token != "" && cfg.playbackTokenSecret != "" {
+		claims, err := auth.ValidatePlaybackToken(token, cfg.playbackTokenSecret)
+		granted = err == nil && claims.VideoID == video.ID && claims.Key == hlsKeyTokenKey
+	}
+	return granted && cfg.videoAvailable(r.Context(), video, uuid.Nil), nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerHLSKey(t *testing.T) {
+	hlsKey := []byte("0123456789abcdef")
+	const playbackSecret = "playback-secret"
+	playbackToken := func(t *testing.T, videoID uuid.UUID, key string) string {
+		token, err := auth.MakePlaybackToken(auth.PlaybackClaims{VideoID: videoID, Key: key}, playbackSecret, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name      string
+		query     func(t *testing.T, video database.Video) url.Values
+		expired   bool
+		suspended bool
+		want      int
+	}{
+		{
+			name:  "no token",
+			query: func(t *testing.T, video database.Video) url.Values { return nil },
+			want:  http.StatusNotFound,
+		},
+		{
+			name:  "share link",
+			query: func(t *testing.T, video database.Video) url.Values { return url.Values{"share": {"share-token"}} },
+			want:  http.StatusOK,
+		},
+		{
+			name:    "expired share link",
+			query:   func(t *testing.T, video database.Video) url.Values { return url.Values{"share": {"share-token"}} },
+			expired: true,
+			want:    http.StatusNotFound,
+		},
+		{
+			name:  "unknown share link",
+			query: func(t *testing.T, video database.Video) url.Values { return url.Values{"share": {"other-token"}} },
+			want:  http.StatusNotFound,
+		},
+		{
+			name:      "share link, owner suspended",
+			query:     func(t *testing.T, video database.Video) url.Values { return url.Values{"share": {"share-token"}} },
+			suspended: true,
+			want:      http.StatusNotFound,
+		},
+		{
+			name: "playback token",
+			query: func(t *testing.T, video database.Video) url.Values {
+				return url.Values{"token": {playbackToken(t, video.ID, hlsKeyTokenKey)}}
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "playback token for another file",
+			query: func(t *testing.T, video database.Video) url.Values {
+				return url.Values{"token": {playbackToken(t, video.ID, "hls/abc/index.m3u8")}}
+			},
+			want: http.StatusNotFound,
+		},
+		{
+			name: "playback token for another video",
+			query: func(t *testing.T, video database.Video) url.Values {
+				return url.Values{"token": {playbackToken(t, uuid.New(), hlsKeyTokenKey)}}
+			},
+			want: http.StatusNotFound,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, store, _ := newTestConfig(t)
+			cfg.playbackTokenSecret = playbackSecret
+			video := &database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New(), Visibility: database.VisibilityPrivate}}
+			stubVideo(store, video)
+			store.IsUserSuspendedFunc = func(ctx context.Context, id uuid.UUID) (bool, error) {
+				return tc.suspended, nil
+			}
+			store.GetHLSKeyFunc = func(ctx context.Context, videoID uuid.UUID) ([]byte, error) {
+				return hlsKey, nil
+			}
+			expiresAt := time.Now().Add(time.Hour)
+			if tc.expired {
+				expiresAt = time.Now().Add(-time.Minute)
+			}
+			store.GetVideoShareByTokenFunc = func(ctx context.Context, token string) (database.VideoShare, error) {
+				if token != "share-token" {
+					return database.VideoShare{}, nil
+				}
+				return database.VideoShare{ID: uuid.New(), Token: token, VideoID: video.ID, ExpiresAt: expiresAt}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/videos/"+video.ID.String()+"/hls.key?"+tc.query(t, *video).Encode(), nil)
+			req.SetPathValue("videoID", video.ID.String())
+			rec := httptest.NewRecorder()
+			cfg.handlerHLSKey(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+			if tc.want == http.StatusOK && !bytes.Equal(rec.Body.Bytes(), hlsKey) {
+				t.Errorf("key = %x, want %x", rec.Body.Bytes(), hlsKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3Server returns an HTTP/3 server that answers QUIC connections on
+// the same port as srv's TLS listener, with the same certificates and
+// handler.
+func newHTTP3Server(srv *http.Server) *http3.Server {
+	return &http3.Server{
+		Addr:        srv.Addr,
+		Handler:     srv.Handler,
+		TLSConfig:   http3.ConfigureTLSConfig(srv.TLSConfig),
+		IdleTimeout: srv.IdleTimeout,
+	}
+}
+
+// altSvcMiddleware advertises h3 on responses sent over TCP, so clients that
+// speak QUIC switch to it for their next requests. Nothing is advertised
+// until the HTTP/3 server is listening.
+func altSvcMiddleware(next http.Handler, h3 *http3.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			h3.SetQUICHeaders(w.Header())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3Server(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+	// Borrow httptest's certificate, which is valid for 127.0.0.1.
+	certs := httptest.NewTLSServer(http.NotFoundHandler())
+	certs.Close()
+
+	h3Srv := newHTTP3Server(&http.Server{Handler: handler, TLSConfig: certs.TLS})
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- h3Srv.Serve(udp) }()
+	t.Cleanup(func() {
+		h3Srv.Close()
+		if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+
+	tcp := httptest.NewUnstartedServer(altSvcMiddleware(handler, h3Srv))
+	tcp.EnableHTTP2 = true
+	tcp.StartTLS()
+	defer tcp.Close()
+
+	resp, err := tcp.Client().Get(tcp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	port := udp.LocalAddr().(*net.UDPAddr).Port
+	if got, want := resp.Header.Get("Alt-Svc"), fmt.Sprintf(`h3=":%d"; ma=2592000`, port); got != want {
+		t.Errorf("Alt-Svc over TCP = %q, want %q", got, want)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certs.Certificate())
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	defer transport.Close()
+	resp, err = (&http.Client{Transport: transport}).Get(fmt.Sprintf("https://127.0.0.1:%d/", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "HTTP/3.0" {
+		t.Errorf("served over %s, want HTTP/3.0", body)
+	}
+}
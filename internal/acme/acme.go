@@ -0,0 +1,441 @@
+// Package acme obtains certificates from an ACME certificate authority such
+// as Let's Encrypt (RFC 8555). It supports what a single server needs: an
+// ES256 account, and orders validated with http-01 challenges.
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LetsEncryptURL is the directory of Let's Encrypt's production CA.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// pollInterval is how long to wait before checking again on an order or
+// authorization the CA is still processing.
+var pollInterval = 2 * time.Second
+
+// Problem is an error document returned by the CA.
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("acme: %s: %s", p.Type, p.Detail)
+}
+
+const problemBadNonce = "urn:ietf:params:acme:error:badNonce"
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+// Client talks to one CA on behalf of one account.
+type Client struct {
+	directoryURL string
+	key          *ecdsa.PrivateKey
+	http         *http.Client
+
+	mu     sync.Mutex
+	dir    *directory
+	kid    string
+	nonces []string
+}
+
+// NewClient returns a client for the CA at directoryURL using the P-256
+// account key.
+func NewClient(directoryURL string, key *ecdsa.PrivateKey) *Client {
+	return &Client{
+		directoryURL: directoryURL,
+		key:          key,
+		http:         &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Register creates the account, or finds the existing one for the key.
+func (c *Client) Register(ctx context.Context, email string) error {
+	dir, err := c.directory(ctx)
+	if err != nil {
+		return err
+	}
+	req := map[string]any{"termsOfServiceAgreed": true}
+	if email != "" {
+		req["contact"] = []string{"mailto:" + email}
+	}
+	resp, _, err := c.post(ctx, dir.NewAccount, req, true)
+	if err != nil {
+		return err
+	}
+	kid := resp.Header.Get("Location")
+	if kid == "" {
+		return errors.New("acme: account response has no Location")
+	}
+	c.mu.Lock()
+	c.kid = kid
+	c.mu.Unlock()
+	return nil
+}
+
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *Problem `json:"error"`
+}
+
+type authorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []struct {
+		Type   string   `json:"type"`
+		URL    string   `json:"url"`
+		Token  string   `json:"token"`
+		Status string   `json:"status"`
+		Error  *Problem `json:"error"`
+	} `json:"challenges"`
+}
+
+// HTTP01Responder publishes the response to an http-01 challenge at
+// /.well-known/acme-challenge/<token>, or withdraws it when keyAuth is "".
+type HTTP01Responder func(token, keyAuth string)
+
+// Obtain orders a certificate for domains, signed over certKey's public
+// key, and returns the DER-encoded chain with the leaf first. Register must
+// have been called.
+func (c *Client) Obtain(ctx context.Context, domains []string, certKey crypto.Signer, respond HTTP01Responder) ([][]byte, error) {
+	dir, err := c.directory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	identifiers := make([]map[string]string, len(domains))
+	for i, d := range domains {
+		identifiers[i] = map[string]string{"type": "dns", "value": d}
+	}
+	resp, body, err := c.post(ctx, dir.NewOrder, map[string]any{"identifiers": identifiers}, false)
+	if err != nil {
+		return nil, err
+	}
+	orderURL := resp.Header.Get("Location")
+	var o order
+	if err := json.Unmarshal(body, &o); err != nil {
+		return nil, err
+	}
+
+	for _, authzURL := range o.Authorizations {
+		if err := c.authorize(ctx, authzURL, respond); err != nil {
+			return nil, err
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, certKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, body, err = c.post(ctx, o.Finalize, map[string]string{"csr": b64(csr)}, false); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &o); err != nil {
+		return nil, err
+	}
+	for o.Status != "valid" {
+		if o.Status == "invalid" {
+			if o.Error != nil {
+				return nil, fmt.Errorf("acme: order failed: %w", o.Error)
+			}
+			return nil, errors.New("acme: order failed")
+		}
+		if err := sleep(ctx, pollInterval); err != nil {
+			return nil, err
+		}
+		if _, body, err = c.post(ctx, orderURL, nil, false); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(body, &o); err != nil {
+			return nil, err
+		}
+	}
+
+	_, body, err = c.post(ctx, o.Certificate, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	var chain [][]byte
+	for {
+		var block *pem.Block
+		block, body = pem.Decode(body)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("acme: no certificates in response")
+	}
+	return chain, nil
+}
+
+// authorize completes the http-01 challenge for one authorization.
+func (c *Client) authorize(ctx context.Context, authzURL string, respond HTTP01Responder) error {
+	var authz authorization
+	_, body, err := c.post(ctx, authzURL, nil, false)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+
+	idx := -1
+	for i, ch := range authz.Challenges {
+		if ch.Type == "http-01" {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("acme: no http-01 challenge offered for %s", authz.Identifier.Value)
+	}
+	challenge := authz.Challenges[idx]
+	respond(challenge.Token, challenge.Token+"."+c.thumbprint())
+	defer respond(challenge.Token, "")
+
+	if _, _, err := c.post(ctx, challenge.URL, struct{}{}, false); err != nil {
+		return err
+	}
+	for {
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+		if _, body, err = c.post(ctx, authzURL, nil, false); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(body, &authz); err != nil {
+			return err
+		}
+		switch authz.Status {
+		case "valid":
+			return nil
+		case "pending", "processing":
+			continue
+		}
+		for _, ch := range authz.Challenges {
+			if ch.Error != nil {
+				return fmt.Errorf("acme: validating %s: %w", authz.Identifier.Value, ch.Error)
+			}
+		}
+		return fmt.Errorf("acme: authorization for %s is %s", authz.Identifier.Value, authz.Status)
+	}
+}
+
+func (c *Client) directory(ctx context.Context) (*directory, error) {
+	c.mu.Lock()
+	dir := c.dir
+	c.mu.Unlock()
+	if dir != nil {
+		return dir, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.directoryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("acme: directory returned %s", resp.Status)
+	}
+	dir = &directory{}
+	if err := json.NewDecoder(resp.Body).Decode(dir); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.dir = dir
+	c.mu.Unlock()
+	return dir, nil
+}
+
+func (c *Client) nonce(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		c.mu.Unlock()
+		return nonce, nil
+	}
+	c.mu.Unlock()
+
+	dir, err := c.directory(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("acme: no nonce returned")
+	}
+	return nonce, nil
+}
+
+// post sends a JWS-signed request. A nil payload makes a POST-as-GET. The
+// account's JWK is embedded instead of its key ID when registering.
+func (c *Client) post(ctx context.Context, url string, payload any, withJWK bool) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.postOnce(ctx, url, payload, withJWK)
+		var problem *Problem
+		if errors.As(err, &problem) && problem.Type == problemBadNonce && attempt < 3 {
+			continue
+		}
+		return resp, body, err
+	}
+}
+
+func (c *Client) postOnce(ctx context.Context, url string, payload any, withJWK bool) (*http.Response, []byte, error) {
+	nonce, err := c.nonce(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	protected := map[string]any{"alg": "ES256", "nonce": nonce, "url": url}
+	if withJWK {
+		protected["jwk"] = c.jwk()
+	} else {
+		c.mu.Lock()
+		protected["kid"] = c.kid
+		c.mu.Unlock()
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, nil, err
+	}
+	encodedPayload := ""
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		encodedPayload = b64(data)
+	}
+	signingInput := b64(header) + "." + encodedPayload
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	jws, err := json.Marshal(map[string]string{
+		"protected": b64(header),
+		"payload":   encodedPayload,
+		"signature": b64(sig),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jws))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.mu.Lock()
+		c.nonces = append(c.nonces, nonce)
+		c.mu.Unlock()
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 400 {
+		problem := &Problem{Status: resp.StatusCode}
+		if json.Unmarshal(body, problem) != nil || problem.Type == "" {
+			problem.Type = "http"
+			problem.Detail = resp.Status
+		}
+		return nil, nil, problem
+	}
+	return resp, body, nil
+}
+
+func (c *Client) jwk() map[string]string {
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   b64(pad32(c.key.X)),
+		"y":   b64(pad32(c.key.Y)),
+	}
+}
+
+// thumbprint is the RFC 7638 thumbprint of the account key, which key
+// authorizations are built from.
+func (c *Client) thumbprint() string {
+	jwk := c.jwk()
+	// The members must be in lexical order with no whitespace.
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk["crv"], jwk["kty"], jwk["x"], jwk["y"])
+	sum := sha256.Sum256([]byte(canonical))
+	return b64(sum[:])
+}
+
+func pad32(n *big.Int) []byte {
+	b := make([]byte, 32)
+	n.FillBytes(b)
+	return b
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
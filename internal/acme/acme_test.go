@@ -0,0 +1,527 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	pollInterval = time.Millisecond
+}
+
+// fakeCA is an ACME server that checks requests the way a real CA would:
+// every POST must be signed by the account key over the request URL with an
+// unused nonce, and an http-01 challenge only passes if the key
+// authorization for its token has been published.
+type fakeCA struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	mu sync.Mutex
+	// nonces are the issued nonces that haven't been used.
+	nonces    map[string]bool
+	nextNonce int
+	// badNonces is how many more valid requests to reject with badNonce.
+	badNonces  int
+	accountKey *ecdsa.PublicKey
+	accounts   int
+	// published maps challenge tokens to the key authorizations the
+	// client's responder is serving.
+	published map[string]string
+	// offerHTTP01 is whether authorizations offer an http-01 challenge.
+	offerHTTP01 bool
+
+	identifiers []string
+	authzStatus []string
+	orderStatus string
+	orderPolls  int
+	csr         *x509.CertificateRequest
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &fakeCA{
+		t:           t,
+		caKey:       caKey,
+		caCert:      caCert,
+		nonces:      map[string]bool{},
+		published:   map[string]string{},
+		offerHTTP01: true,
+	}
+	ca.srv = httptest.NewServer(http.HandlerFunc(ca.serveHTTP))
+	t.Cleanup(ca.srv.Close)
+	return ca
+}
+
+func (ca *fakeCA) directoryURL() string { return ca.srv.URL + "/directory" }
+
+// respond is the HTTP01Responder the client under test is given.
+func (ca *fakeCA) respond(token, keyAuth string) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if keyAuth == "" {
+		delete(ca.published, token)
+		return
+	}
+	ca.published[token] = keyAuth
+}
+
+func (ca *fakeCA) issueNonce(w http.ResponseWriter) {
+	ca.nextNonce++
+	nonce := "nonce-" + strconv.Itoa(ca.nextNonce)
+	ca.nonces[nonce] = true
+	w.Header().Set("Replay-Nonce", nonce)
+}
+
+func (ca *fakeCA) problem(w http.ResponseWriter, status int, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{Type: typ, Detail: detail, Status: status})
+}
+
+func (ca *fakeCA) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if r.URL.Path == "/directory" {
+		json.NewEncoder(w).Encode(directory{
+			NewNonce:   ca.srv.URL + "/new-nonce",
+			NewAccount: ca.srv.URL + "/new-account",
+			NewOrder:   ca.srv.URL + "/new-order",
+		})
+		return
+	}
+	ca.issueNonce(w)
+	if r.URL.Path == "/new-nonce" {
+		return
+	}
+	if r.Method != http.MethodPost {
+		ca.problem(w, http.StatusMethodNotAllowed, "urn:ietf:params:acme:error:malformed", "POST required")
+		return
+	}
+	payload, ok := ca.verify(w, r)
+	if !ok {
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/new-account":
+		ca.accounts++
+		w.Header().Set("Location", ca.srv.URL+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"valid"}`))
+	case r.URL.Path == "/new-order":
+		var req struct {
+			Identifiers []struct{ Type, Value string } `json:"identifiers"`
+		}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			ca.t.Errorf("new order: %v", err)
+		}
+		ca.identifiers = nil
+		ca.authzStatus = nil
+		for _, id := range req.Identifiers {
+			if id.Type != "dns" {
+				ca.t.Errorf("identifier type = %q, want dns", id.Type)
+			}
+			ca.identifiers = append(ca.identifiers, id.Value)
+			ca.authzStatus = append(ca.authzStatus, "pending")
+		}
+		ca.orderStatus = "pending"
+		w.Header().Set("Location", ca.srv.URL+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		ca.writeOrder(w)
+	case strings.HasPrefix(r.URL.Path, "/authz/"):
+		ca.writeAuthz(w, ca.index(r, "/authz/"))
+	case strings.HasPrefix(r.URL.Path, "/chall/"):
+		i := ca.index(r, "/chall/")
+		token := fmt.Sprintf("token-%d", i)
+		if ca.published[token] == token+"."+ca.thumbprint() {
+			ca.authzStatus[i] = "valid"
+		} else {
+			ca.authzStatus[i] = "invalid"
+		}
+		w.Write([]byte(`{"status":"processing"}`))
+	case r.URL.Path == "/finalize/1":
+		for _, status := range ca.authzStatus {
+			if status != "valid" {
+				ca.problem(w, http.StatusForbidden, "urn:ietf:params:acme:error:orderNotReady", "authorizations aren't valid")
+				return
+			}
+		}
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		json.Unmarshal(payload, &req)
+		der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+		if err == nil {
+			ca.csr, err = x509.ParseCertificateRequest(der)
+		}
+		if err != nil {
+			ca.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badCSR", err.Error())
+			return
+		}
+		if !slices.Equal(ca.csr.DNSNames, ca.identifiers) {
+			ca.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badCSR", "names don't match the order")
+			return
+		}
+		// Issuing takes one poll, so the client has to wait for it.
+		ca.orderStatus = "processing"
+		ca.writeOrder(w)
+	case r.URL.Path == "/order/1":
+		ca.orderPolls++
+		if ca.orderStatus == "processing" {
+			ca.orderStatus = "valid"
+		}
+		ca.writeOrder(w)
+	case r.URL.Path == "/cert/1":
+		leaf := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: ca.identifiers[0]},
+			DNSNames:     ca.identifiers,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, leaf, ca.caCert, ca.csr.PublicKey, ca.caKey)
+		if err != nil {
+			ca.t.Errorf("issuing: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})
+	default:
+		ca.problem(w, http.StatusNotFound, "urn:ietf:params:acme:error:malformed", "not found")
+	}
+}
+
+func (ca *fakeCA) index(r *http.Request, prefix string) int {
+	i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix))
+	if err != nil || i < 0 || i >= len(ca.authzStatus) {
+		ca.t.Errorf("unknown resource %s", r.URL.Path)
+		return 0
+	}
+	return i
+}
+
+func (ca *fakeCA) writeOrder(w http.ResponseWriter) {
+	o := order{Status: ca.orderStatus, Finalize: ca.srv.URL + "/finalize/1"}
+	for i := range ca.identifiers {
+		o.Authorizations = append(o.Authorizations, fmt.Sprintf("%s/authz/%d", ca.srv.URL, i))
+	}
+	if ca.orderStatus == "valid" {
+		o.Certificate = ca.srv.URL + "/cert/1"
+	}
+	json.NewEncoder(w).Encode(o)
+}
+
+func (ca *fakeCA) writeAuthz(w http.ResponseWriter, i int) {
+	challenges := []map[string]any{
+		{"type": "dns-01", "url": fmt.Sprintf("%s/dns/%d", ca.srv.URL, i), "token": "dns-token"},
+	}
+	if ca.offerHTTP01 {
+		challenge := map[string]any{"type": "http-01", "url": fmt.Sprintf("%s/chall/%d", ca.srv.URL, i), "token": fmt.Sprintf("token-%d", i)}
+		if ca.authzStatus[i] == "invalid" {
+			challenge["error"] = Problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "key authorization didn't match"}
+		}
+		challenges = append(challenges, challenge)
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":     ca.authzStatus[i],
+		"identifier": map[string]string{"type": "dns", "value": ca.identifiers[i]},
+		"challenges": challenges,
+	})
+}
+
+// verify checks a request's JWS and returns its payload, writing a problem
+// document if it's rejected.
+func (ca *fakeCA) verify(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+		Signature string `json:"signature"`
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/jose+json" {
+		ca.t.Errorf("Content-Type = %q", ct)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		ca.t.Errorf("decoding JWS: %v", err)
+		return nil, false
+	}
+	headerJSON, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var header struct {
+		Alg   string            `json:"alg"`
+		Nonce string            `json:"nonce"`
+		URL   string            `json:"url"`
+		JWK   map[string]string `json:"jwk"`
+		KID   string            `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		ca.t.Errorf("decoding protected header: %v", err)
+		return nil, false
+	}
+	if header.Alg != "ES256" {
+		ca.t.Errorf("alg = %q, want ES256", header.Alg)
+	}
+	if want := ca.srv.URL + r.URL.Path; header.URL != want {
+		ca.t.Errorf("url = %q, want %q", header.URL, want)
+	}
+	if !ca.nonces[header.Nonce] {
+		ca.t.Errorf("nonce %q wasn't issued or was reused", header.Nonce)
+		ca.problem(w, http.StatusBadRequest, problemBadNonce, "unknown nonce")
+		return nil, false
+	}
+	delete(ca.nonces, header.Nonce)
+	if ca.badNonces > 0 {
+		ca.badNonces--
+		ca.problem(w, http.StatusBadRequest, problemBadNonce, "nonce expired")
+		return nil, false
+	}
+
+	key := ca.accountKey
+	switch {
+	case r.URL.Path == "/new-account":
+		if header.JWK == nil || header.KID != "" {
+			ca.t.Errorf("new account request must carry a jwk and no kid: %s", headerJSON)
+			return nil, false
+		}
+		x, _ := base64.RawURLEncoding.DecodeString(header.JWK["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(header.JWK["y"])
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		ca.accountKey = key
+	case header.KID != ca.srv.URL+"/account/1" || header.JWK != nil:
+		ca.t.Errorf("request to %s must carry the account kid and no jwk: %s", r.URL.Path, headerJSON)
+		ca.problem(w, http.StatusUnauthorized, "urn:ietf:params:acme:error:accountDoesNotExist", "no account")
+		return nil, false
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if len(sig) != 64 || !ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		ca.t.Errorf("bad signature on request to %s", r.URL.Path)
+		ca.problem(w, http.StatusUnauthorized, "urn:ietf:params:acme:error:malformed", "bad signature")
+		return nil, false
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload, true
+}
+
+// thumbprint computes the RFC 7638 thumbprint of the registered account
+// key independently of the client: json.Marshal writes map keys in order
+// without whitespace.
+func (ca *fakeCA) thumbprint() string {
+	canonical, _ := json.Marshal(map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   base64.RawURLEncoding.EncodeToString(pad32(ca.accountKey.X)),
+		"y":   base64.RawURLEncoding.EncodeToString(pad32(ca.accountKey.Y)),
+	})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func newTestClient(t *testing.T, ca *fakeCA) *Client {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(ca.directoryURL(), key)
+	if err := c.Register(context.Background(), "admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestObtain(t *testing.T) {
+	ca := newFakeCA(t)
+	c := newTestClient(t, ca)
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domains := []string{"example.com", "www.example.com"}
+	chain, err := c.Obtain(context.Background(), domains, certKey, ca.respond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chain) != 2 {
+		t.Fatalf("chain has %d certificates, want 2", len(chain))
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(leaf.DNSNames, domains) {
+		t.Errorf("leaf names = %v, want %v", leaf.DNSNames, domains)
+	}
+	if !leaf.PublicKey.(*ecdsa.PublicKey).Equal(&certKey.PublicKey) {
+		t.Error("leaf isn't for the certificate key")
+	}
+	if ca.csr.Subject.CommonName != domains[0] {
+		t.Errorf("CSR common name = %q, want %q", ca.csr.Subject.CommonName, domains[0])
+	}
+	if ca.orderPolls == 0 {
+		t.Error("order wasn't polled while it was processing")
+	}
+	if len(ca.published) != 0 {
+		t.Errorf("challenge responses still published: %v", ca.published)
+	}
+}
+
+func TestObtainRetriesBadNonce(t *testing.T) {
+	ca := newFakeCA(t)
+	c := newTestClient(t, ca)
+	ca.badNonces = 2
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if _, err := c.Obtain(context.Background(), []string{"example.com"}, certKey, ca.respond); err != nil {
+		t.Fatal(err)
+	}
+	if ca.badNonces != 0 {
+		t.Errorf("%d badNonce rejections weren't hit", ca.badNonces)
+	}
+}
+
+func TestPostGivesUpOnRepeatedBadNonce(t *testing.T) {
+	ca := newFakeCA(t)
+	c := newTestClient(t, ca)
+	ca.badNonces = 10
+
+	_, err := c.Obtain(context.Background(), []string{"example.com"}, nil, ca.respond)
+	var problem *Problem
+	if !errors.As(err, &problem) || problem.Type != problemBadNonce {
+		t.Fatalf("err = %v, want a badNonce problem", err)
+	}
+	if ca.badNonces != 6 {
+		t.Errorf("request was sent %d times, want 4", 10-ca.badNonces)
+	}
+}
+
+func TestRegisterReusesAccount(t *testing.T) {
+	ca := newFakeCA(t)
+	c := newTestClient(t, ca)
+	if err := c.Register(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if ca.accounts != 2 {
+		t.Errorf("new-account called %d times, want 2", ca.accounts)
+	}
+}
+
+func TestObtainFailedChallenge(t *testing.T) {
+	ca := newFakeCA(t)
+	c := newTestClient(t, ca)
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// A responder that publishes the wrong key authorization.
+	respond := func(token, keyAuth string) {
+		if keyAuth != "" {
+			keyAuth = token + ".wrong"
+		}
+		ca.respond(token, keyAuth)
+	}
+	_, err := c.Obtain(context.Background(), []string{"example.com"}, certKey, respond)
+	var problem *Problem
+	if !errors.As(err, &problem) || problem.Type != "urn:ietf:params:acme:error:unauthorized" {
+		t.Fatalf("err = %v, want the challenge's unauthorized problem", err)
+	}
+	if !strings.Contains(err.Error(), "example.com") {
+		t.Errorf("err = %v, want it to name the domain", err)
+	}
+	if len(ca.published) != 0 {
+		t.Errorf("challenge responses still published: %v", ca.published)
+	}
+}
+
+func TestObtainWithoutHTTP01(t *testing.T) {
+	ca := newFakeCA(t)
+	ca.offerHTTP01 = false
+	c := newTestClient(t, ca)
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	_, err := c.Obtain(context.Background(), []string{"example.com"}, certKey, ca.respond)
+	if err == nil || !strings.Contains(err.Error(), "no http-01 challenge") {
+		t.Fatalf("err = %v, want no http-01 challenge", err)
+	}
+}
+
+func TestObtainCancelled(t *testing.T) {
+	ca := newFakeCA(t)
+	c := newTestClient(t, ca)
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Cancel once the challenge is published, while the client waits on it.
+	respond := func(token, keyAuth string) {
+		ca.respond(token, keyAuth)
+		cancel()
+	}
+	if _, err := c.Obtain(ctx, []string{"example.com"}, certKey, respond); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestProblemFromNonJSONError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/directory":
+			fmt.Fprintf(w, `{"newNonce":"http://%[1]s/nonce","newAccount":"http://%[1]s/account"}`, r.Host)
+		case "/nonce":
+			w.Header().Set("Replay-Nonce", "n")
+		default:
+			http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	err := NewClient(srv.URL+"/directory", key).Register(context.Background(), "")
+	var problem *Problem
+	if !errors.As(err, &problem) || problem.Status != http.StatusBadGateway || problem.Type != "http" {
+		t.Fatalf("err = %#v, want an http problem with status 502", err)
+	}
+}
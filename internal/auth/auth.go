@@ -17,7 +17,9 @@ import (
 type TokenType string
 
 const (
-	TokenTypeAccess TokenType = "tubely-access"
+	TokenTypeAccess   TokenType = "tubely-access"
+	TokenTypePlayback TokenType = "tubely-playback"
+	TokenTypeEmbed    TokenType = "tubely-embed"
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
@@ -80,6 +82,124 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return id, nil
 }
 
+// PlaybackClaims bind a playback token to one object of one video, and to
+// the viewer it was issued to (uuid.Nil for anonymous viewers).
+type PlaybackClaims struct {
+	VideoID  uuid.UUID
+	ViewerID uuid.UUID
+	Key      string
+}
+
+type playbackJWTClaims struct {
+	jwt.RegisteredClaims
+	Key    string `json:"key"`
+	Viewer string `json:"vwr,omitempty"`
+}
+
+// MakePlaybackToken signs a token that lets a CDN or proxy serve
+// claims.Key until expiresAt. The token has no issue time, so tokens for
+// the same claims and expiry are identical.
+func MakePlaybackToken(claims PlaybackClaims, tokenSecret string, expiresAt time.Time) (string, error) {
+	c := playbackJWTClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypePlayback),
+			ExpiresAt: jwt.NewNumericDate(expiresAt.UTC()),
+			Subject:   claims.VideoID.String(),
+		},
+		Key: claims.Key,
+	}
+	if claims.ViewerID != uuid.Nil {
+		c.Viewer = claims.ViewerID.String()
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
+	return token.SignedString([]byte(tokenSecret))
+}
+
+func ValidatePlaybackToken(tokenString, tokenSecret string) (PlaybackClaims, error) {
+	c := playbackJWTClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&c,
+		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+	)
+	if err != nil {
+		return PlaybackClaims{}, err
+	}
+	if c.Issuer != string(TokenTypePlayback) {
+		return PlaybackClaims{}, errors.New("invalid issuer")
+	}
+	if c.ExpiresAt == nil {
+		return PlaybackClaims{}, errors.New("token has no expiry")
+	}
+
+	claims := PlaybackClaims{Key: c.Key}
+	claims.VideoID, err = uuid.Parse(c.Subject)
+	if err != nil {
+		return PlaybackClaims{}, fmt.Errorf("invalid video ID: %w", err)
+	}
+	if c.Viewer != "" {
+		claims.ViewerID, err = uuid.Parse(c.Viewer)
+		if err != nil {
+			return PlaybackClaims{}, fmt.Errorf("invalid viewer ID: %w", err)
+		}
+	}
+	return claims, nil
+}
+
+// EmbedClaims let a video's embed player load when framed by a page on
+// Domain, or anywhere if Domain is empty.
+type EmbedClaims struct {
+	VideoID  uuid.UUID
+	Domain   string
+	IssuedAt time.Time
+}
+
+type embedJWTClaims struct {
+	jwt.RegisteredClaims
+	Domain string `json:"dom,omitempty"`
+}
+
+// MakeEmbedToken signs a token that lets claims.VideoID be embedded until
+// expiresAt.
+func MakeEmbedToken(claims EmbedClaims, tokenSecret string, expiresAt time.Time) (string, error) {
+	c := embedJWTClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeEmbed),
+			IssuedAt:  jwt.NewNumericDate(claims.IssuedAt.UTC()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt.UTC()),
+			Subject:   claims.VideoID.String(),
+		},
+		Domain: claims.Domain,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
+	return token.SignedString([]byte(tokenSecret))
+}
+
+func ValidateEmbedToken(tokenString, tokenSecret string) (EmbedClaims, error) {
+	c := embedJWTClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&c,
+		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+	)
+	if err != nil {
+		return EmbedClaims{}, err
+	}
+	if c.Issuer != string(TokenTypeEmbed) {
+		return EmbedClaims{}, errors.New("invalid issuer")
+	}
+	if c.ExpiresAt == nil || c.IssuedAt == nil {
+		return EmbedClaims{}, errors.New("token has no expiry or issue time")
+	}
+
+	claims := EmbedClaims{Domain: c.Domain, IssuedAt: c.IssuedAt.Time}
+	claims.VideoID, err = uuid.Parse(c.Subject)
+	if err != nil {
+		return EmbedClaims{}, fmt.Errorf("invalid video ID: %w", err)
+	}
+	return claims, nil
+}
+
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ownerNotSuspended filters a query on videos down to those whose owner
+// isn't suspended. Public listings use it so suspended users' videos drop
+// out until they're reinstated.
+const ownerNotSuspended = "videos.user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL)"
+
+// AdminUser is a user as admins see them, with their account state and how
+// much they've uploaded.
+type AdminUser struct {
+	ID                    uuid.UUID  `json:"id"`
+	Email                 string     `json:"email"`
+	CreatedAt             time.Time  `json:"created_at"`
+	IsAdmin               bool       `json:"is_admin"`
+	BannedAt              *time.Time `json:"banned_at"`
+	SuspendedAt           *time.Time `json:"suspended_at"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	VideoCount            int        `json:"video_count"`
+	StorageBytes          int64      `json:"storage_bytes"`
+}
+
+func (c *Client) migrateUserSuspension(ctx context.Context) error {
+	err := c.addColumnIfMissing(ctx, "users", "suspended_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	return c.addColumnIfMissing(ctx, "users", "password_reset_required", "BOOLEAN NOT NULL DEFAULT FALSE")
+}
+
+const adminUserQuery = `
+	SELECT
+		u.id,
+		u.email,
+		u.created_at,
+		u.is_admin,
+		u.banned_at,
+		u.suspended_at,
+		u.password_reset_required,
+		(SELECT COUNT(*) FROM videos WHERE user_id = u.id AND deleted_at IS NULL),
+		(SELECT COALESCE(SUM(size_bytes), 0) FROM videos WHERE user_id = u.id)
+			+ (SELECT COALESCE(SUM(r.size_bytes), 0) FROM renditions r JOIN videos v ON v.id = r.video_id WHERE v.user_id = u.id)
+	FROM users u
+`
+
+func scanAdminUser(row rowScanner) (AdminUser, error) {
+	var user AdminUser
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsAdmin,
+		&user.BannedAt,
+		&user.SuspendedAt,
+		&user.PasswordResetRequired,
+		&user.VideoCount,
+		&user.StorageBytes,
+	)
+	return user, err
+}
+
+// ListUsers returns users, newest first. A non-empty search matches part of
+// their email address, ignoring case.
+func (c Client) ListUsers(ctx context.Context, search string, limit, offset int) ([]AdminUser, error) {
+	query := adminUserQuery
+	args := []any{}
+	if search != "" {
+		query += "WHERE LOWER(u.email) LIKE ?\n"
+		args = append(args, "%"+strings.ToLower(search)+"%")
+	}
+	query += "ORDER BY u.created_at DESC, u.id\nLIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := c.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []AdminUser{}
+	for rows.Next() {
+		user, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetAdminUser returns nil if the user doesn't exist.
+func (c Client) GetAdminUser(ctx context.Context, id uuid.UUID) (*AdminUser, error) {
+	user, err := scanAdminUser(c.db.QueryRow(ctx, adminUserQuery+"WHERE u.id = ?", id.String()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SuspendUser stops a user uploading and hides their videos until they're
+// unsuspended. Unlike a ban, they can still sign in.
+func (c Client) SuspendUser(ctx context.Context, id uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "UPDATE users SET suspended_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND suspended_at IS NULL", time.Now().UTC(), id.String())
+	return err
+}
+
+func (c Client) UnsuspendUser(ctx context.Context, id uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "UPDATE users SET suspended_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id.String())
+	return err
+}
+
+func (c Client) IsUserSuspended(ctx context.Context, id uuid.UUID) (bool, error) {
+	var suspendedAt *time.Time
+	err := c.db.QueryRow(ctx, "SELECT suspended_at FROM users WHERE id = ?", id.String()).Scan(&suspendedAt)
+	if err != nil {
+		return false, err
+	}
+	return suspendedAt != nil, nil
+}
+
+// RequirePasswordReset makes a user choose a new password the next time
+// they sign in, and revokes their refresh tokens so existing sessions can't
+// be renewed.
+func (c Client) RequirePasswordReset(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET password_reset_required = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id.String())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", id.String())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) IsPasswordResetRequired(ctx context.Context, id uuid.UUID) (bool, error) {
+	var required bool
+	err := c.db.QueryRow(ctx, "SELECT password_reset_required FROM users WHERE id = ?", id.String()).Scan(&required)
+	if err != nil {
+		return false, err
+	}
+	return required, nil
+}
+
+// SetUserPassword replaces a user's password hash and clears any required
+// reset.
+func (c Client) SetUserPassword(ctx context.Context, id uuid.UUID, hashedPassword string) error {
+	_, err := c.db.Exec(ctx, "UPDATE users SET password = ?, password_reset_required = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = ?", hashedPassword, id.String())
+	return err
+}
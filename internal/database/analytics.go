@@ -0,0 +1,275 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AnalyticsPeriod is the length of an analytics bucket.
+type AnalyticsPeriod string
+
+const (
+	AnalyticsHour AnalyticsPeriod = "hour"
+	AnalyticsDay  AnalyticsPeriod = "day"
+)
+
+// AnalyticsBucket is a video's or channel's activity over one period.
+// Bucket is its start, as YYYY-MM-DD HH:00:00 for hours and YYYY-MM-DD for
+// days. Sessions, watch time, and buffering come from beacon events and
+// count towards the hour the session started.
+type AnalyticsBucket struct {
+	Bucket       string  `json:"bucket"`
+	Views        int64   `json:"views"`
+	Sessions     int64   `json:"sessions"`
+	WatchSeconds float64 `json:"watch_seconds"`
+	BufferEvents int64   `json:"buffer_events"`
+	BufferMS     int64   `json:"buffer_ms"`
+}
+
+// VideoAnalytics is one video's activity over one hour.
+type VideoAnalytics struct {
+	VideoID uuid.UUID
+	AnalyticsBucket
+}
+
+// VideoHeatmap is a video's watch heatmap for the sessions started on one
+// day. Viewers and Plays hold a count for each second.
+type VideoHeatmap struct {
+	VideoID  uuid.UUID
+	Day      string
+	Sessions int
+	Viewers  []int
+	Plays    []int
+}
+
+// HourlyViews is how many times a video was viewed in one hour.
+type HourlyViews struct {
+	VideoID uuid.UUID
+	Hour    string
+	Views   int64
+}
+
+// Rollups are kept after their video is deleted only for channels, so a
+// channel's history stays complete.
+func (c *Client) migrateAnalytics(ctx context.Context) error {
+	for _, table := range []string{"video_analytics", "channel_analytics"} {
+		key := "video_id"
+		if table == "channel_analytics" {
+			key = "channel_id"
+		}
+		_, err := c.db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS `+table+` (
+			`+key+` TEXT NOT NULL,
+			period TEXT NOT NULL,
+			bucket TEXT NOT NULL,
+			views BIGINT NOT NULL,
+			sessions BIGINT NOT NULL,
+			watch_seconds REAL NOT NULL,
+			buffer_events BIGINT NOT NULL,
+			buffer_ms BIGINT NOT NULL,
+			PRIMARY KEY(`+key+`, period, bucket)
+		);
+		`)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS video_heatmaps (
+		video_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		sessions INTEGER NOT NULL,
+		viewers TEXT NOT NULL,
+		plays TEXT NOT NULL,
+		PRIMARY KEY(video_id, day)
+	);
+	`)
+	return err
+}
+
+// GetHourlyViews counts views per video and hour since a time.
+func (c Client) GetHourlyViews(ctx context.Context, since time.Time) ([]HourlyViews, error) {
+	hour := c.db.dialect.hour("viewed_at")
+	rows, err := c.db.Query(ctx, `
+	SELECT video_id, `+hour+`, COUNT(*)
+	FROM video_views
+	WHERE viewed_at >= ?
+	GROUP BY video_id, `+hour, formatTimestamp(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := []HourlyViews{}
+	for rows.Next() {
+		var v HourlyViews
+		if err := rows.Scan(&v.VideoID, &v.Hour, &v.Views); err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+// ReplaceAnalytics replaces every rollup from since, which must be the
+// start of a day, with hourly and heatmaps. Daily rollups and channel
+// rollups are recomputed from the hourly ones, so rolling the same
+// events up again gives the same totals.
+func (c Client) ReplaceAnalytics(ctx context.Context, since time.Time, hourly []VideoAnalytics, heatmaps []VideoHeatmap) error {
+	sinceHour := formatTimestamp(since)
+	sinceDay := since.UTC().Format(time.DateOnly)
+
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{"DELETE FROM video_analytics WHERE period = ? AND bucket >= ?", []any{AnalyticsHour, sinceHour}},
+		{"DELETE FROM video_analytics WHERE period = ? AND bucket >= ?", []any{AnalyticsDay, sinceDay}},
+		{"DELETE FROM channel_analytics WHERE period = ? AND bucket >= ?", []any{AnalyticsHour, sinceHour}},
+		{"DELETE FROM channel_analytics WHERE period = ? AND bucket >= ?", []any{AnalyticsDay, sinceDay}},
+		{"DELETE FROM video_heatmaps WHERE day >= ?", []any{sinceDay}},
+	}
+	for _, s := range statements {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range hourly {
+		_, err := tx.Exec(`
+		INSERT INTO video_analytics (video_id, period, bucket, views, sessions, watch_seconds, buffer_events, buffer_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, a.VideoID, AnalyticsHour, a.Bucket, a.Views, a.Sessions, a.WatchSeconds, a.BufferEvents, a.BufferMS)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+	INSERT INTO video_analytics (video_id, period, bucket, views, sessions, watch_seconds, buffer_events, buffer_ms)
+	SELECT video_id, ?, SUBSTR(bucket, 1, 10), SUM(views), SUM(sessions), SUM(watch_seconds), SUM(buffer_events), SUM(buffer_ms)
+	FROM video_analytics
+	WHERE period = ? AND bucket >= ?
+	GROUP BY video_id, SUBSTR(bucket, 1, 10)
+	`, AnalyticsDay, AnalyticsHour, sinceHour)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO channel_analytics (channel_id, period, bucket, views, sessions, watch_seconds, buffer_events, buffer_ms)
+	SELECT videos.channel_id, a.period, a.bucket, SUM(a.views), SUM(a.sessions), SUM(a.watch_seconds), SUM(a.buffer_events), SUM(a.buffer_ms)
+	FROM video_analytics a
+	JOIN videos ON videos.id = a.video_id
+	WHERE videos.channel_id IS NOT NULL
+		AND ((a.period = ? AND a.bucket >= ?) OR (a.period = ? AND a.bucket >= ?))
+	GROUP BY videos.channel_id, a.period, a.bucket
+	`, AnalyticsHour, sinceHour, AnalyticsDay, sinceDay)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range heatmaps {
+		viewers, err := json.Marshal(h.Viewers)
+		if err != nil {
+			return err
+		}
+		plays, err := json.Marshal(h.Plays)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"INSERT INTO video_heatmaps (video_id, day, sessions, viewers, plays) VALUES (?, ?, ?, ?, ?)",
+			h.VideoID, h.Day, h.Sessions, string(viewers), string(plays),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteHourlyAnalyticsBefore prunes hourly rollups; daily ones are kept.
+func (c Client) DeleteHourlyAnalyticsBefore(ctx context.Context, cutoff time.Time) error {
+	for _, table := range []string{"video_analytics", "channel_analytics"} {
+		_, err := c.db.Exec(ctx, "DELETE FROM "+table+" WHERE period = ? AND bucket < ?", AnalyticsHour, formatTimestamp(cutoff))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetVideoAnalytics returns a video's rollups from since, oldest first.
+// Periods without activity are left out.
+func (c Client) GetVideoAnalytics(ctx context.Context, videoID uuid.UUID, period AnalyticsPeriod, since string) ([]AnalyticsBucket, error) {
+	return c.queryAnalytics(ctx, "video_analytics", "video_id", videoID, period, since)
+}
+
+// GetChannelAnalytics returns a channel's rollups from since, oldest first.
+// Periods without activity are left out.
+func (c Client) GetChannelAnalytics(ctx context.Context, channelID uuid.UUID, period AnalyticsPeriod, since string) ([]AnalyticsBucket, error) {
+	return c.queryAnalytics(ctx, "channel_analytics", "channel_id", channelID, period, since)
+}
+
+func (c Client) queryAnalytics(ctx context.Context, table, key string, id uuid.UUID, period AnalyticsPeriod, since string) ([]AnalyticsBucket, error) {
+	rows, err := c.onReplica().db.Query(ctx, `
+	SELECT bucket, views, sessions, watch_seconds, buffer_events, buffer_ms
+	FROM `+table+`
+	WHERE `+key+` = ? AND period = ? AND bucket >= ?
+	ORDER BY bucket
+	`, id, period, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []AnalyticsBucket{}
+	for rows.Next() {
+		var b AnalyticsBucket
+		if err := rows.Scan(&b.Bucket, &b.Views, &b.Sessions, &b.WatchSeconds, &b.BufferEvents, &b.BufferMS); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+// GetVideoHeatmaps returns a video's daily heatmaps from since, a
+// YYYY-MM-DD day.
+func (c Client) GetVideoHeatmaps(ctx context.Context, videoID uuid.UUID, since string) ([]VideoHeatmap, error) {
+	rows, err := c.onReplica().db.Query(ctx, `
+	SELECT video_id, day, sessions, viewers, plays
+	FROM video_heatmaps
+	WHERE video_id = ? AND day >= ?
+	ORDER BY day
+	`, videoID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	heatmaps := []VideoHeatmap{}
+	for rows.Next() {
+		var h VideoHeatmap
+		var viewers, plays string
+		if err := rows.Scan(&h.VideoID, &h.Day, &h.Sessions, &viewers, &plays); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(viewers), &h.Viewers); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(plays), &h.Plays); err != nil {
+			return nil, err
+		}
+		heatmaps = append(heatmaps, h)
+	}
+	return heatmaps, rows.Err()
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// AudioTrack is one of a video's audio streams, such as the original
+// language, a dub, or commentary. Index is its position among the audio
+// streams of the processed file.
+type AudioTrack struct {
+	Index int `json:"index"`
+	// Language is the stream's language tag, usually ISO 639-2 like "eng",
+	// or empty if the upload didn't say.
+	Language string `json:"language,omitempty"`
+	// Label is the stream's title, such as "Director's commentary".
+	Label    string `json:"label,omitempty"`
+	Codec    string `json:"codec"`
+	Channels int    `json:"channels"`
+	Default  bool   `json:"default"`
+}
+
+func (c *Client) migrateAudioTracks(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS audio_tracks (
+		video_id TEXT NOT NULL,
+		track_index INTEGER NOT NULL,
+		language TEXT NOT NULL DEFAULT '',
+		label TEXT NOT NULL DEFAULT '',
+		codec TEXT NOT NULL,
+		channels INTEGER NOT NULL,
+		is_default BOOLEAN NOT NULL DEFAULT FALSE,
+		PRIMARY KEY(video_id, track_index),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	return err
+}
+
+// GetAudioTracks returns a video's audio tracks in order.
+func (c Client) GetAudioTracks(ctx context.Context, videoID uuid.UUID) ([]AudioTrack, error) {
+	rows, err := c.db.Query(ctx, `
+	SELECT track_index, language, label, codec, channels, is_default
+	FROM audio_tracks
+	WHERE video_id = ?
+	ORDER BY track_index
+	`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tracks := []AudioTrack{}
+	for rows.Next() {
+		var t AudioTrack
+		if err := rows.Scan(&t.Index, &t.Language, &t.Label, &t.Codec, &t.Channels, &t.Default); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks, rows.Err()
+}
+
+// replaceAudioTracks swaps a video's audio tracks for a new set inside tx.
+func replaceAudioTracks(tx tx, videoID uuid.UUID, tracks []AudioTrack) error {
+	if _, err := tx.Exec("DELETE FROM audio_tracks WHERE video_id = ?", videoID); err != nil {
+		return err
+	}
+	for _, t := range tracks {
+		_, err := tx.Exec(`
+		INSERT INTO audio_tracks (video_id, track_index, language, label, codec, channels, is_default)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, videoID, t.Index, t.Language, t.Label, t.Codec, t.Channels, t.Default)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
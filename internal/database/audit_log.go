@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditLogEntry struct {
+	ID         uuid.UUID `json:"id"`
+	ActorID    uuid.UUID `json:"actor_id"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreateAuditLogEntryParams struct {
+	ActorID    uuid.UUID
+	Action     string
+	TargetType string
+	TargetID   string
+	Details    string
+}
+
+func (c Client) CreateAuditLogEntry(ctx context.Context, params CreateAuditLogEntryParams) error {
+	query := `
+	INSERT INTO audit_log (
+		id,
+		actor_id,
+		action,
+		target_type,
+		target_id,
+		details,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(ctx, query, uuid.New(), params.ActorID, params.Action, params.TargetType, params.TargetID, params.Details)
+	return err
+}
+
+func (c Client) GetAuditLog(ctx context.Context, limit, offset int) ([]AuditLogEntry, error) {
+	query := `
+	SELECT
+		id,
+		actor_id,
+		action,
+		target_type,
+		target_id,
+		details,
+		created_at
+	FROM audit_log
+	ORDER BY created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditLogEntry{}
+	for rows.Next() {
+		var entry AuditLogEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.ActorID,
+			&entry.Action,
+			&entry.TargetType,
+			&entry.TargetID,
+			&entry.Details,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
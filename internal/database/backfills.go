@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type BackfillStatus string
+
+// A backfill runs until every video has been queued and processed, unless
+// an admin pauses it, which stops new videos being queued until it's
+// resumed, or cancels it.
+const (
+	BackfillRunning   BackfillStatus = "running"
+	BackfillPaused    BackfillStatus = "paused"
+	BackfillCompleted BackfillStatus = "completed"
+	BackfillCancelled BackfillStatus = "cancelled"
+)
+
+// Backfill re-runs processing over existing videos in ID order. LastVideoID
+// is the last video queued, so a backfill resumes from there after a
+// restart.
+type Backfill struct {
+	ID          uuid.UUID      `json:"id"`
+	Status      BackfillStatus `json:"status"`
+	LastVideoID *uuid.UUID     `json:"last_video_id"`
+	Total       int            `json:"total"`
+	Queued      int            `json:"queued"`
+	Succeeded   int            `json:"succeeded"`
+	Failed      int            `json:"failed"`
+	Skipped     int            `json:"skipped"`
+	CreatedBy   uuid.UUID      `json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	FinishedAt  *time.Time     `json:"finished_at"`
+}
+
+// BackfillResult is how reprocessing one video ended.
+type BackfillResult string
+
+const (
+	BackfillResultSucceeded BackfillResult = "succeeded"
+	BackfillResultFailed    BackfillResult = "failed"
+	BackfillResultSkipped   BackfillResult = "skipped"
+)
+
+// backfillVideos are the videos a backfill processes: those with a file
+// that aren't in the trash or being processed already.
+const backfillVideos = "video_url IS NOT NULL AND deleted_at IS NULL AND status = 'ready'"
+
+func (c *Client) migrateBackfills(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS backfills (
+		id TEXT PRIMARY KEY,
+		status TEXT NOT NULL,
+		last_video_id TEXT,
+		total INTEGER NOT NULL,
+		queued INTEGER NOT NULL DEFAULT 0,
+		succeeded INTEGER NOT NULL DEFAULT 0,
+		failed INTEGER NOT NULL DEFAULT 0,
+		skipped INTEGER NOT NULL DEFAULT 0,
+		created_by TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP
+	);
+	`)
+	return err
+}
+
+const backfillColumns = `
+		id,
+		status,
+		last_video_id,
+		total,
+		queued,
+		succeeded,
+		failed,
+		skipped,
+		created_by,
+		created_at,
+		updated_at,
+		finished_at`
+
+func scanBackfill(row rowScanner) (Backfill, error) {
+	var b Backfill
+	err := row.Scan(
+		&b.ID,
+		&b.Status,
+		&b.LastVideoID,
+		&b.Total,
+		&b.Queued,
+		&b.Succeeded,
+		&b.Failed,
+		&b.Skipped,
+		&b.CreatedBy,
+		&b.CreatedAt,
+		&b.UpdatedAt,
+		&b.FinishedAt,
+	)
+	if err != nil {
+		return Backfill{}, err
+	}
+	return b, nil
+}
+
+// CreateBackfill starts a backfill over every video that currently has a
+// file.
+func (c Client) CreateBackfill(ctx context.Context, createdBy uuid.UUID) (Backfill, error) {
+	var total int
+	if err := c.db.QueryRow(ctx, "SELECT COUNT(*) FROM videos WHERE "+backfillVideos).Scan(&total); err != nil {
+		return Backfill{}, err
+	}
+	now := time.Now().UTC()
+	b := Backfill{
+		ID:        uuid.New(),
+		Status:    BackfillRunning,
+		Total:     total,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	query := `
+	INSERT INTO backfills (id, status, total, created_by, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(ctx, query, b.ID, b.Status, b.Total, b.CreatedBy, b.CreatedAt, b.UpdatedAt)
+	if err != nil {
+		return Backfill{}, err
+	}
+	return b, nil
+}
+
+// GetBackfill returns nil if there's no such backfill.
+func (c Client) GetBackfill(ctx context.Context, id uuid.UUID) (*Backfill, error) {
+	b, err := scanBackfill(c.db.QueryRow(ctx, "SELECT"+backfillColumns+" FROM backfills WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetActiveBackfill returns the backfill that's running or paused, or nil.
+// Only one is allowed at a time.
+func (c Client) GetActiveBackfill(ctx context.Context) (*Backfill, error) {
+	query := "SELECT" + backfillColumns + " FROM backfills WHERE status IN (?, ?) ORDER BY created_at LIMIT 1"
+	b, err := scanBackfill(c.db.QueryRow(ctx, query, BackfillRunning, BackfillPaused))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListBackfills lists backfills, newest first.
+func (c Client) ListBackfills(ctx context.Context, limit, offset int) ([]Backfill, error) {
+	query := `
+	SELECT` + backfillColumns + `
+	FROM backfills
+	ORDER BY created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backfills := []Backfill{}
+	for rows.Next() {
+		b, err := scanBackfill(rows)
+		if err != nil {
+			return nil, err
+		}
+		backfills = append(backfills, b)
+	}
+	return backfills, rows.Err()
+}
+
+// SetBackfillStatus moves a backfill from one status to another. It
+// returns false if the backfill wasn't in status from.
+func (c Client) SetBackfillStatus(ctx context.Context, id uuid.UUID, from, to BackfillStatus) (bool, error) {
+	now := time.Now().UTC()
+	var finishedAt *time.Time
+	if to == BackfillCompleted || to == BackfillCancelled {
+		finishedAt = &now
+	}
+	query := `
+	UPDATE backfills
+	SET status = ?, updated_at = ?, finished_at = ?
+	WHERE id = ? AND status = ?
+	`
+	result, err := c.db.Exec(ctx, query, to, now, finishedAt, id, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetBackfillVideos returns up to limit videos for a backfill to process
+// after the given one, in ID order.
+func (c Client) GetBackfillVideos(ctx context.Context, after *uuid.UUID, limit int) ([]uuid.UUID, error) {
+	last := ""
+	if after != nil {
+		last = after.String()
+	}
+	query := "SELECT id FROM videos WHERE " + backfillVideos + " AND id > ? ORDER BY id LIMIT ?"
+	rows, err := c.db.Query(ctx, query, last, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AdvanceBackfill records that a video was queued, so the backfill moves
+// on past it.
+func (c Client) AdvanceBackfill(ctx context.Context, id, videoID uuid.UUID) error {
+	query := `
+	UPDATE backfills
+	SET last_video_id = ?, queued = queued + 1, updated_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(ctx, query, videoID, time.Now().UTC(), id)
+	return err
+}
+
+// RecordBackfillResult counts how reprocessing one of a backfill's videos
+// ended.
+func (c Client) RecordBackfillResult(ctx context.Context, id uuid.UUID, result BackfillResult) error {
+	var column string
+	switch result {
+	case BackfillResultSucceeded:
+		column = "succeeded"
+	case BackfillResultFailed:
+		column = "failed"
+	case BackfillResultSkipped:
+		column = "skipped"
+	default:
+		return errors.New("unknown backfill result")
+	}
+	query := "UPDATE backfills SET " + column + " = " + column + " + 1, updated_at = ? WHERE id = ?"
+	_, err := c.db.Exec(ctx, query, time.Now().UTC(), id)
+	return err
+}
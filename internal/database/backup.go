@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Backup writes a consistent snapshot of the database to path, which must
+// not exist. SQLite databases are copied with VACUUM INTO, which is safe
+// while the server is running. Postgres databases are dumped with pg_dump
+// in its custom format, so pg_dump must be on the PATH.
+func (c Client) Backup(ctx context.Context, path string) error {
+	if c.db.dialect == dialectPostgres {
+		dsn, env := pgToolDSN(c.db.dsn)
+		cmd := exec.CommandContext(ctx, "pg_dump", "--format=custom", "--no-owner", "--file", path, dsn)
+		cmd.Env = env
+		return runTool(cmd)
+	}
+	// The snapshot can take longer than a normal query, so it isn't bounded
+	// by the query timeout.
+	_, err := c.db.db.ExecContext(ctx, "VACUUM INTO ?", path)
+	return err
+}
+
+// Restore replaces the contents of the database named by dsn with a snapshot
+// written by Backup. The server must be stopped first. For SQLite the
+// database file is overwritten; for Postgres existing objects are dropped
+// and recreated with pg_restore.
+func Restore(ctx context.Context, dsn, path string) error {
+	d, _ := parseDSN(dsn)
+	if d == dialectPostgres {
+		dsn, env := pgToolDSN(dsn)
+		cmd := exec.CommandContext(ctx, "pg_restore", "--clean", "--if-exists", "--no-owner", "--single-transaction", "--dbname", dsn, path)
+		cmd.Env = env
+		return runTool(cmd)
+	}
+
+	dbPath, _, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Copy next to the database and rename over it so a failed copy never
+	// leaves a half-written database behind.
+	tmp, err := os.CreateTemp(filepath.Dir(dbPath), ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// Stale journal files would be replayed against the restored database.
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		os.Remove(dbPath + suffix)
+	}
+	return os.Rename(tmp.Name(), dbPath)
+}
+
+// pgToolDSN takes the password out of a Postgres DSN, which would otherwise
+// be visible to anyone who can list processes, and returns the DSN without
+// it and an environment passing it in PGPASSWORD instead.
+func pgToolDSN(dsn string) (string, []string) {
+	env := os.Environ()
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn, env
+	}
+	password, ok := u.User.Password()
+	q := u.Query()
+	if q.Has("password") {
+		password, ok = q.Get("password"), true
+		q.Del("password")
+		u.RawQuery = q.Encode()
+	}
+	if !ok {
+		return dsn, env
+	}
+	if u.User != nil {
+		u.User = url.User(u.User.Username())
+	}
+	return u.String(), append(env, "PGPASSWORD="+password)
+}
+
+func runTool(cmd *exec.Cmd) error {
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by ApplyBatchVideoChange when the video, as read inside the
+// item's transaction, can't take the change.
+var (
+	ErrVideoNotFound  = errors.New("video not found")
+	ErrVideoTakenDown = errors.New("video was taken down")
+	ErrVideoRetained  = errors.New("video is under retention")
+)
+
+// BatchVideoChange is the change a batch request makes to each of its videos.
+// Exactly one field is set.
+type BatchVideoChange struct {
+	Delete     bool
+	Visibility *Visibility
+	Tag        *string
+}
+
+// ApplyBatchVideoChange applies change to one video in its own transaction.
+// The takedown and retention checks are made inside the transaction and
+// repeated in the UPDATE's WHERE clause, so a takedown or retention change
+// committed after the caller last read the video can't be overwritten; a
+// write that loses that race fails with ErrVideoConflict.
+func (c Client) ApplyBatchVideoChange(ctx context.Context, id uuid.UUID, change BatchVideoChange) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt, takenDownAt, retainUntil *time.Time
+	err = tx.QueryRow(
+		"SELECT deleted_at, taken_down_at, retain_until FROM videos WHERE id = ?", id,
+	).Scan(&deletedAt, &takenDownAt, &retainUntil)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && deletedAt != nil) {
+		return ErrVideoNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case change.Delete:
+		if retainUntil != nil && now.Before(*retainUntil) {
+			return ErrVideoRetained
+		}
+		query := `
+		UPDATE videos
+		SET deleted_at = ?
+		WHERE id = ? AND deleted_at IS NULL AND (retain_until IS NULL OR retain_until <= ?)
+		`
+		result, err := tx.Exec(query, now, id, now)
+		if err != nil {
+			return err
+		}
+		if err := checkVideoUpdated(result); err != nil {
+			return err
+		}
+	case change.Visibility != nil:
+		if takenDownAt != nil {
+			return ErrVideoTakenDown
+		}
+		query := `
+		UPDATE videos
+		SET visibility = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND deleted_at IS NULL AND taken_down_at IS NULL
+		`
+		result, err := tx.Exec(query, *change.Visibility, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVideoUpdated(result); err != nil {
+			return err
+		}
+	case change.Tag != nil:
+		query := `
+		INSERT INTO video_tags (
+			video_id,
+			tag
+		) VALUES (?, ?)
+		ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.Exec(query, id, *change.Tag); err != nil {
+			return err
+		}
+	default:
+		return errors.New("batch change has no operation")
+	}
+
+	return tx.Commit()
+}
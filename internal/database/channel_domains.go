@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ChannelDomainStatus string
+
+const (
+	// ChannelDomainPending domains are waiting for their DNS verification
+	// record to be found, then for a certificate.
+	ChannelDomainPending ChannelDomainStatus = "pending"
+	ChannelDomainActive  ChannelDomainStatus = "active"
+	// ChannelDomainFailed domains couldn't get a certificate, usually
+	// because their DNS doesn't point at the server yet. They're retried.
+	ChannelDomainFailed ChannelDomainStatus = "failed"
+)
+
+// ErrChannelDomainTaken is returned when another channel already uses a
+// domain.
+var ErrChannelDomainTaken = errors.New("domain is used by another channel")
+
+// ChannelDomain is a custom domain a channel's public pages are served on.
+type ChannelDomain struct {
+	ChannelID  uuid.UUID           `json:"channel_id"`
+	Domain     string              `json:"domain"`
+	Status     ChannelDomainStatus `json:"status"`
+	Error      string              `json:"error,omitempty"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+	VerifiedAt *time.Time          `json:"verified_at,omitempty"`
+	// VerificationToken is the value of the TXT record that proves the
+	// channel controls the domain.
+	VerificationToken string `json:"verification_token,omitempty"`
+	// DNSVerifiedAt is when the TXT record was found. Until then the
+	// domain stays pending.
+	DNSVerifiedAt *time.Time `json:"dns_verified_at,omitempty"`
+}
+
+func (c *Client) migrateChannelDomains(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS channel_domains (
+		channel_id TEXT PRIMARY KEY,
+		domain TEXT NOT NULL UNIQUE,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		verified_at TIMESTAMP,
+		FOREIGN KEY(channel_id) REFERENCES channels(id)
+	);
+	`)
+	return err
+}
+
+func (c *Client) migrateChannelDomainVerification(ctx context.Context) error {
+	if err := c.addColumnIfMissing(ctx, "channel_domains", "verification_token", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := c.addColumnIfMissing(ctx, "channel_domains", "dns_verified_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	// Domains already being served keep working; pending and failed ones
+	// have to be set again to get a verification token.
+	_, err := c.db.Exec(ctx, "UPDATE channel_domains SET dns_verified_at = verified_at WHERE status = 'active' AND dns_verified_at IS NULL")
+	return err
+}
+
+const channelDomainColumns = `
+	channel_id,
+	domain,
+	status,
+	error,
+	created_at,
+	updated_at,
+	verified_at,
+	verification_token,
+	dns_verified_at
+`
+
+func scanChannelDomain(row rowScanner) (ChannelDomain, error) {
+	var d ChannelDomain
+	err := row.Scan(
+		&d.ChannelID,
+		&d.Domain,
+		&d.Status,
+		&d.Error,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&d.VerifiedAt,
+		&d.VerificationToken,
+		&d.DNSVerifiedAt,
+	)
+	return d, err
+}
+
+// SetChannelDomain points a channel at a domain, replacing any domain it
+// had. The domain is pending until the TXT record holding token is found.
+// It returns ErrChannelDomainTaken if another channel has the domain.
+func (c Client) SetChannelDomain(ctx context.Context, channelID uuid.UUID, domain, token string) (ChannelDomain, error) {
+	existing, err := c.GetChannelDomainByName(ctx, domain)
+	if err != nil {
+		return ChannelDomain{}, err
+	}
+	if existing != nil && existing.ChannelID != channelID {
+		return ChannelDomain{}, ErrChannelDomainTaken
+	}
+
+	now := formatTimestamp(time.Now())
+	query := `
+	INSERT INTO channel_domains (channel_id, domain, status, error, created_at, updated_at, verified_at, verification_token, dns_verified_at)
+	VALUES (?, ?, ?, '', ?, ?, NULL, ?, NULL)
+	ON CONFLICT(channel_id) DO UPDATE SET
+		domain = excluded.domain,
+		status = excluded.status,
+		error = '',
+		created_at = excluded.created_at,
+		updated_at = excluded.updated_at,
+		verified_at = NULL,
+		verification_token = excluded.verification_token,
+		dns_verified_at = NULL
+	`
+	if _, err := c.db.Exec(ctx, query, channelID, domain, ChannelDomainPending, now, now, token); err != nil {
+		// Two channels can race for a domain past the check above.
+		if existing, gerr := c.GetChannelDomainByName(ctx, domain); gerr == nil && existing != nil && existing.ChannelID != channelID {
+			return ChannelDomain{}, ErrChannelDomainTaken
+		}
+		return ChannelDomain{}, err
+	}
+	d, err := c.GetChannelDomain(ctx, channelID)
+	if err != nil {
+		return ChannelDomain{}, err
+	}
+	return *d, nil
+}
+
+// GetChannelDomain returns a channel's domain, or nil if it has none.
+func (c Client) GetChannelDomain(ctx context.Context, channelID uuid.UUID) (*ChannelDomain, error) {
+	d, err := scanChannelDomain(c.db.QueryRow(ctx, "SELECT"+channelDomainColumns+" FROM channel_domains WHERE channel_id = ?", channelID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetChannelDomainByName returns the channel domain for a host name, or
+// nil if no channel uses it.
+func (c Client) GetChannelDomainByName(ctx context.Context, domain string) (*ChannelDomain, error) {
+	d, err := scanChannelDomain(c.db.QueryRow(ctx, "SELECT"+channelDomainColumns+" FROM channel_domains WHERE domain = ?", domain))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListChannelDomains lists every channel domain, whatever its status.
+func (c Client) ListChannelDomains(ctx context.Context) ([]ChannelDomain, error) {
+	rows, err := c.db.Query(ctx, "SELECT"+channelDomainColumns+" FROM channel_domains ORDER BY domain")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []ChannelDomain{}
+	for rows.Next() {
+		d, err := scanChannelDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+// SetChannelDomainStatus records the outcome of getting a certificate for
+// a domain. errMsg is kept for failures and cleared otherwise.
+func (c Client) SetChannelDomainStatus(ctx context.Context, domain string, status ChannelDomainStatus, errMsg string) error {
+	now := formatTimestamp(time.Now())
+	var verifiedAt *string
+	if status == ChannelDomainActive {
+		verifiedAt = &now
+	}
+	query := `
+	UPDATE channel_domains
+	SET status = ?, error = ?, updated_at = ?, verified_at = COALESCE(?, verified_at)
+	WHERE domain = ?
+	`
+	_, err := c.db.Exec(ctx, query, status, errMsg, now, verifiedAt, domain)
+	return err
+}
+
+// MarkChannelDomainDNSVerified records that a domain's verification record
+// was found.
+func (c Client) MarkChannelDomainDNSVerified(ctx context.Context, domain string) error {
+	now := formatTimestamp(time.Now())
+	query := `
+	UPDATE channel_domains
+	SET dns_verified_at = ?, updated_at = ?
+	WHERE domain = ? AND dns_verified_at IS NULL
+	`
+	_, err := c.db.Exec(ctx, query, now, now, domain)
+	return err
+}
+
+func (c Client) DeleteChannelDomain(ctx context.Context, channelID uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM channel_domains WHERE channel_id = ?", channelID)
+	return err
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ChannelRole string
+
+const (
+	ChannelRoleOwner  ChannelRole = "owner"
+	ChannelRoleAdmin  ChannelRole = "admin"
+	ChannelRoleEditor ChannelRole = "editor"
+	ChannelRoleViewer ChannelRole = "viewer"
+)
+
+var channelRoleRanks = map[ChannelRole]int{
+	ChannelRoleViewer: 1,
+	ChannelRoleEditor: 2,
+	ChannelRoleAdmin:  3,
+	ChannelRoleOwner:  4,
+}
+
+func (r ChannelRole) Valid() bool {
+	_, ok := channelRoleRanks[r]
+	return ok
+}
+
+// AtLeast reports whether the role grants at least the permissions of min.
+func (r ChannelRole) AtLeast(min ChannelRole) bool {
+	return channelRoleRanks[r] >= channelRoleRanks[min]
+}
+
+type Channel struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ChannelMember struct {
+	ChannelID uuid.UUID   `json:"channel_id"`
+	UserID    uuid.UUID   `json:"user_id"`
+	Email     string      `json:"email"`
+	Role      ChannelRole `json:"role"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type CreateChannelParams struct {
+	Name        string
+	Description string
+	OwnerID     uuid.UUID
+}
+
+// CreateChannel creates a channel and makes its creator the owner.
+func (c Client) CreateChannel(ctx context.Context, params CreateChannelParams) (Channel, error) {
+	id := uuid.New()
+
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return Channel{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO channels (id, name, description, created_at, updated_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, id, params.Name, params.Description)
+	if err != nil {
+		return Channel{}, err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO channel_members (channel_id, user_id, role, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`, id, params.OwnerID, ChannelRoleOwner)
+	if err != nil {
+		return Channel{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Channel{}, err
+	}
+
+	return c.GetChannel(ctx, id)
+}
+
+func (c Client) GetChannel(ctx context.Context, id uuid.UUID) (Channel, error) {
+	query := `
+	SELECT id, name, description, created_at, updated_at
+	FROM channels
+	WHERE id = ?
+	`
+	var ch Channel
+	err := c.db.QueryRow(ctx, query, id).Scan(&ch.ID, &ch.Name, &ch.Description, &ch.CreatedAt, &ch.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Channel{}, nil
+		}
+		return Channel{}, err
+	}
+	return ch, nil
+}
+
+// GetChannelsForUser lists the channels a user is a member of.
+func (c Client) GetChannelsForUser(ctx context.Context, userID uuid.UUID) ([]Channel, error) {
+	query := `
+	SELECT c.id, c.name, c.description, c.created_at, c.updated_at
+	FROM channels c
+	JOIN channel_members m ON m.channel_id = c.id
+	WHERE m.user_id = ?
+	ORDER BY c.name
+	`
+	rows, err := c.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []Channel{}
+	for rows.Next() {
+		var ch Channel
+		if err := rows.Scan(&ch.ID, &ch.Name, &ch.Description, &ch.CreatedAt, &ch.UpdatedAt); err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// GetChannelRole returns the user's role in a channel, or "" if they are not
+// a member.
+func (c Client) GetChannelRole(ctx context.Context, channelID, userID uuid.UUID) (ChannelRole, error) {
+	query := `
+	SELECT role
+	FROM channel_members
+	WHERE channel_id = ? AND user_id = ?
+	`
+	var role ChannelRole
+	err := c.db.QueryRow(ctx, query, channelID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+func (c Client) GetChannelMembers(ctx context.Context, channelID uuid.UUID) ([]ChannelMember, error) {
+	query := `
+	SELECT m.channel_id, m.user_id, u.email, m.role, m.created_at
+	FROM channel_members m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.channel_id = ?
+	ORDER BY m.created_at
+	`
+	rows, err := c.db.Query(ctx, query, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []ChannelMember{}
+	for rows.Next() {
+		var m ChannelMember
+		if err := rows.Scan(&m.ChannelID, &m.UserID, &m.Email, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetChannelMember adds a member or changes an existing member's role.
+func (c Client) SetChannelMember(ctx context.Context, channelID, userID uuid.UUID, role ChannelRole) error {
+	query := `
+	INSERT INTO channel_members (channel_id, user_id, role, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(channel_id, user_id) DO UPDATE SET role = excluded.role
+	`
+	_, err := c.db.Exec(ctx, query, channelID, userID, role)
+	return err
+}
+
+func (c Client) RemoveChannelMember(ctx context.Context, channelID, userID uuid.UUID) error {
+	query := `
+	DELETE FROM channel_members
+	WHERE channel_id = ? AND user_id = ?
+	`
+	_, err := c.db.Exec(ctx, query, channelID, userID)
+	return err
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Chapter is a named marker in a video, running from StartSeconds to the
+// next chapter's start or the end of the video.
+type Chapter struct {
+	StartSeconds float64 `json:"start_seconds"`
+	Title        string  `json:"title"`
+}
+
+func (c *Client) migrateChapters(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS video_chapters (
+		video_id TEXT NOT NULL,
+		start_seconds REAL NOT NULL,
+		title TEXT NOT NULL,
+		PRIMARY KEY(video_id, start_seconds),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	return err
+}
+
+// migrateChapterSuggestions adds a table for chapters suggested from a
+// video's transcript, which wait there for the owner to publish them.
+func (c *Client) migrateChapterSuggestions(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS chapter_suggestions (
+		video_id TEXT NOT NULL,
+		start_seconds REAL NOT NULL,
+		title TEXT NOT NULL,
+		PRIMARY KEY(video_id, start_seconds),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	return err
+}
+
+// SetChapters replaces a video's chapters. An empty list removes them.
+func (c Client) SetChapters(ctx context.Context, videoID uuid.UUID, chapters []Chapter) error {
+	return c.replaceChapters(ctx, "video_chapters", videoID, chapters)
+}
+
+// GetChapters returns a video's chapters in order.
+func (c Client) GetChapters(ctx context.Context, videoID uuid.UUID) ([]Chapter, error) {
+	return c.queryChapters(ctx, "video_chapters", videoID)
+}
+
+// SetChapterSuggestions replaces the chapters suggested for a video. An
+// empty list discards them.
+func (c Client) SetChapterSuggestions(ctx context.Context, videoID uuid.UUID, chapters []Chapter) error {
+	return c.replaceChapters(ctx, "chapter_suggestions", videoID, chapters)
+}
+
+// GetChapterSuggestions returns the chapters suggested for a video in
+// order.
+func (c Client) GetChapterSuggestions(ctx context.Context, videoID uuid.UUID) ([]Chapter, error) {
+	return c.queryChapters(ctx, "chapter_suggestions", videoID)
+}
+
+// PublishChapterSuggestions replaces a video's chapters with the ones
+// suggested for it, which are then discarded.
+func (c Client) PublishChapterSuggestions(ctx context.Context, videoID uuid.UUID) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM video_chapters WHERE video_id = ?", videoID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO video_chapters (video_id, start_seconds, title)
+	SELECT video_id, start_seconds, title FROM chapter_suggestions WHERE video_id = ?
+	`, videoID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM chapter_suggestions WHERE video_id = ?", videoID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) replaceChapters(ctx context.Context, table string, videoID uuid.UUID, chapters []Chapter) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM "+table+" WHERE video_id = ?", videoID); err != nil {
+		return err
+	}
+	for _, ch := range chapters {
+		_, err := tx.Exec("INSERT INTO "+table+" (video_id, start_seconds, title) VALUES (?, ?, ?)", videoID, ch.StartSeconds, ch.Title)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c Client) queryChapters(ctx context.Context, table string, videoID uuid.UUID) ([]Chapter, error) {
+	rows, err := c.db.Query(ctx, "SELECT start_seconds, title FROM "+table+" WHERE video_id = ? ORDER BY start_seconds", videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chapters := []Chapter{}
+	for rows.Next() {
+		var ch Chapter
+		if err := rows.Scan(&ch.StartSeconds, &ch.Title); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, ch)
+	}
+	return chapters, rows.Err()
+}
@@ -1,31 +1,132 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Client struct {
-	db *sql.DB
+	db conn
+	// replica serves read-heavy queries that can tolerate replication lag.
+	// It's the primary unless a read replica is configured.
+	replica conn
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+// PoolConfig tunes the connection pool. Zero fields keep database/sql's
+// defaults.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// BusyTimeout is how long a SQLite connection waits for a lock held by
+	// another connection before failing. Postgres ignores it.
+	BusyTimeout time.Duration
+}
+
+// NewClient opens the database named by dsn and applies any pending
+// migrations.
+func NewClient(ctx context.Context, dsn string, pool PoolConfig) (Client, error) {
+	c, err := Open(dsn, pool)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	_, err = c.Migrate(ctx)
 	if err != nil {
 		return Client{}, err
 	}
 	return c, nil
+}
 
+// Open opens the database named by dsn without touching the schema: a
+// postgres:// URL for Postgres, or otherwise a path to a SQLite file.
+func Open(dsn string, pool PoolConfig) (Client, error) {
+	d, driverDSN := parseDSN(dsn)
+	if d == dialectSQLite && pool.BusyTimeout > 0 {
+		driverDSN = withDSNParam(driverDSN, "_busy_timeout", strconv.FormatInt(pool.BusyTimeout.Milliseconds(), 10))
+	}
+	db, err := sql.Open(d.driverName(), driverDSN)
+	if err != nil {
+		return Client{}, err
+	}
+	if pool.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+	primary := conn{db: db, dialect: d, dsn: dsn}
+	return Client{db: primary, replica: primary}, nil
 }
 
-func (c *Client) autoMigrate() error {
+// WithReadReplica returns a copy of the client that sends listing, search,
+// and ranking queries to the replica named by dsn. The replica must use the
+// same backend as the primary.
+func (c Client) WithReadReplica(dsn string, pool PoolConfig) (Client, error) {
+	r, err := Open(dsn, pool)
+	if err != nil {
+		return Client{}, err
+	}
+	if r.db.dialect != c.db.dialect {
+		r.Close()
+		return Client{}, errors.New("read replica must use the same database backend as the primary")
+	}
+	r.db.timeout = c.db.timeout
+	c.replica = r.db
+	return c, nil
+}
+
+// onReplica returns a copy of the client whose queries all go to the read
+// replica.
+func (c Client) onReplica() Client {
+	c.db = c.replica
+	return c
+}
+
+// WithQueryTimeout returns a copy of the client that bounds each query, or
+// each transaction, to d. Zero means no limit beyond the caller's context.
+func (c Client) WithQueryTimeout(d time.Duration) Client {
+	c.db.timeout = d
+	c.replica.timeout = d
+	return c
+}
+
+// Ping checks that the primary database is reachable.
+func (c Client) Ping(ctx context.Context) error {
+	ctx, cancel := c.db.withTimeout(ctx)
+	defer cancel()
+	return c.db.db.PingContext(ctx)
+}
+
+// PoolStats reports the connection pool's current usage.
+func (c Client) PoolStats() sql.DBStats {
+	return c.db.db.Stats()
+}
+
+func (c Client) Close() error {
+	if c.replica.db != c.db.db {
+		c.replica.db.Close()
+	}
+	return c.db.db.Close()
+}
+
+// migrateBaseline creates the schema as it stood before versioned
+// migrations. Every statement is idempotent so it also adopts databases
+// that were set up by earlier releases.
+func (c *Client) migrateBaseline(ctx context.Context) error {
 	userTable := `
 	CREATE TABLE IF NOT EXISTS users (
 		id TEXT PRIMARY KEY,
@@ -35,10 +136,19 @@ func (c *Client) autoMigrate() error {
 		email TEXT UNIQUE NOT NULL
 	);
 	`
-	_, err := c.db.Exec(userTable)
+	_, err := c.db.Exec(ctx, userTable)
 	if err != nil {
 		return err
 	}
+	err = c.addColumnIfMissing(ctx, "users", "is_admin", "BOOLEAN NOT NULL DEFAULT FALSE")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing(ctx, "users", "banned_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+
 	refreshTokenTable := `
 	CREATE TABLE IF NOT EXISTS refresh_tokens (
 		token TEXT PRIMARY KEY,
@@ -50,7 +160,37 @@ func (c *Client) autoMigrate() error {
 		FOREIGN KEY(user_id) REFERENCES users(id)
 	);
 	`
-	_, err = c.db.Exec(refreshTokenTable)
+	_, err = c.db.Exec(ctx, refreshTokenTable)
+	if err != nil {
+		return err
+	}
+
+	channelTable := `
+	CREATE TABLE IF NOT EXISTS channels (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err = c.db.Exec(ctx, channelTable)
+	if err != nil {
+		return err
+	}
+
+	channelMemberTable := `
+	CREATE TABLE IF NOT EXISTS channel_members (
+		channel_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(channel_id, user_id),
+		FOREIGN KEY(channel_id) REFERENCES channels(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, channelMemberTable)
 	if err != nil {
 		return err
 	}
@@ -63,27 +203,547 @@ func (c *Client) autoMigrate() error {
 		title TEXT NOT NULL,
 		description TEXT,
 		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
+		video_url TEXT,
+		user_id TEXT,
 		FOREIGN KEY(user_id) REFERENCES users(id)
 	);
 	`
-	_, err = c.db.Exec(videoTable)
+	_, err = c.db.Exec(ctx, videoTable)
+	if err != nil {
+		return err
+	}
+
+	err = c.addColumnIfMissing(ctx, "videos", "visibility", "TEXT NOT NULL DEFAULT 'unlisted'")
+	if err != nil {
+		return err
+	}
+
+	err = c.addColumnIfMissing(ctx, "videos", "deleted_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+
+	mediaColumns := []struct{ name, definition string }{
+		{"duration_seconds", "REAL"},
+		{"width", "INTEGER"},
+		{"height", "INTEGER"},
+		{"frame_rate", "REAL"},
+		{"size_bytes", "INTEGER"},
+	}
+	for _, col := range mediaColumns {
+		err = c.addColumnIfMissing(ctx, "videos", col.name, col.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.addColumnIfMissing(ctx, "videos", "status", "TEXT NOT NULL DEFAULT 'draft'")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing(ctx, "videos", "aspect", "TEXT")
+	if err != nil {
+		return err
+	}
+
+	err = c.addColumnIfMissing(ctx, "videos", "channel_id", "TEXT REFERENCES channels(id)")
+	if err != nil {
+		return err
+	}
+
+	err = c.addColumnIfMissing(ctx, "videos", "slug", "TEXT")
+	if err != nil {
+		return err
+	}
+
+	err = c.addColumnIfMissing(ctx, "videos", "view_count", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	err = c.addColumnIfMissing(ctx, "videos", "report_count", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	err = c.addColumnIfMissing(ctx, "videos", "taken_down_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+
+	err = c.addColumnIfMissing(ctx, "videos", "legal_hold", "BOOLEAN NOT NULL DEFAULT FALSE")
+	if err != nil {
+		return err
+	}
+
+	videoIndexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_videos_user_created ON videos(user_id, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_videos_status_created ON videos(status, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_videos_aspect_created ON videos(aspect, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_videos_channel_created ON videos(channel_id, created_at)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_videos_slug ON videos(slug)",
+	}
+	for _, index := range videoIndexes {
+		_, err = c.db.Exec(ctx, index)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.backfillVideoSlugs(ctx)
+	if err != nil {
+		return err
+	}
+
+	watchHistoryTable := `
+	CREATE TABLE IF NOT EXISTS watch_history (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		watched_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, watchHistoryTable)
+	if err != nil {
+		return err
+	}
+
+	videoTagsTable := `
+	CREATE TABLE IF NOT EXISTS video_tags (
+		video_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY(video_id, tag),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, videoTagsTable)
+	if err != nil {
+		return err
+	}
+
+	webhookSubscriptionsTable := `
+	CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		event_types TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, webhookSubscriptionsTable)
+	if err != nil {
+		return err
+	}
+
+	webhookDeliveriesTable := `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id TEXT PRIMARY KEY,
+		subscription_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		status_code INTEGER,
+		error TEXT,
+		success BOOLEAN NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(subscription_id) REFERENCES webhook_subscriptions(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, webhookDeliveriesTable)
+	if err != nil {
+		return err
+	}
+
+	videoSharesTable := `
+	CREATE TABLE IF NOT EXISTS video_shares (
+		id TEXT PRIMARY KEY,
+		token TEXT UNIQUE NOT NULL,
+		video_id TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		max_views INTEGER,
+		view_count INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(created_by) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, videoSharesTable)
+	if err != nil {
+		return err
+	}
+
+	videoViewsTable := `
+	CREATE TABLE IF NOT EXISTS video_views (
+		video_id TEXT NOT NULL,
+		viewed_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, videoViewsTable)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_video_views_viewed ON video_views(viewed_at, video_id)")
+	if err != nil {
+		return err
+	}
+
+	trendingScoresTable := `
+	CREATE TABLE IF NOT EXISTS trending_scores (
+		period TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		views INTEGER NOT NULL,
+		score REAL NOT NULL,
+		computed_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(period, video_id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, trendingScoresTable)
+	if err != nil {
+		return err
+	}
+
+	playbackPositionsTable := `
+	CREATE TABLE IF NOT EXISTS playback_positions (
+		user_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		position_seconds REAL NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(user_id, video_id),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, playbackPositionsTable)
+	if err != nil {
+		return err
+	}
+
+	watchLaterTable := `
+	CREATE TABLE IF NOT EXISTS watch_later (
+		user_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		added_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(user_id, video_id),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, watchLaterTable)
+	if err != nil {
+		return err
+	}
+
+	subscriptionsTable := `
+	CREATE TABLE IF NOT EXISTS subscriptions (
+		id TEXT PRIMARY KEY,
+		subscriber_id TEXT NOT NULL,
+		creator_id TEXT,
+		channel_id TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(subscriber_id, creator_id),
+		UNIQUE(subscriber_id, channel_id),
+		CHECK((creator_id IS NULL) != (channel_id IS NULL)),
+		FOREIGN KEY(subscriber_id) REFERENCES users(id),
+		FOREIGN KEY(creator_id) REFERENCES users(id),
+		FOREIGN KEY(channel_id) REFERENCES channels(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, subscriptionsTable)
+	if err != nil {
+		return err
+	}
+
+	notificationsTable := `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		video_id TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		read_at TIMESTAMP,
+		UNIQUE(user_id, type, video_id),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, notificationsTable)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications(user_id, created_at)")
+	if err != nil {
+		return err
+	}
+
+	videoReportsTable := `
+	CREATE TABLE IF NOT EXISTS video_reports (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		reporter_id TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(video_id, reporter_id),
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(reporter_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, videoReportsTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing(ctx, "video_reports", "resolved_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfMissing(ctx, "video_reports", "resolution", "TEXT")
+	if err != nil {
+		return err
+	}
+
+	auditLogTable := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id TEXT PRIMARY KEY,
+		actor_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(actor_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, auditLogTable)
+	if err != nil {
+		return err
+	}
+
+	dmcaTakedownsTable := `
+	CREATE TABLE IF NOT EXISTS dmca_takedowns (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		claimant_name TEXT NOT NULL,
+		claimant_email TEXT NOT NULL,
+		work_description TEXT NOT NULL,
+		previous_visibility TEXT NOT NULL,
+		counter_notice TEXT,
+		counter_noticed_at TIMESTAMP,
+		created_by TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		resolved_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(created_by) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(ctx, dmcaTakedownsTable)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
+// addColumnIfMissing adds a column to an existing table. CREATE TABLE IF NOT
+// EXISTS leaves tables created by older versions untouched, so new columns
+// have to be added separately.
+func (c *Client) addColumnIfMissing(ctx context.Context, table, column, definition string) error {
+	if c.db.dialect == dialectPostgres {
+		_, err := c.db.Exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, column, definition))
+		return err
+	}
+
+	rows, err := c.db.Query(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = c.db.Exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func (c Client) Reset(ctx context.Context) error {
+	if _, err := c.db.Exec(ctx, "DELETE FROM thumbnail_variant_clicks"); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM thumbnail_variants"); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM audio_tracks"); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM chapter_suggestions"); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_transcript_cues"); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_chapters"); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM embed_settings"); err != nil {
+		return fmt.Errorf("failed to reset table embed_settings: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM channel_domains"); err != nil {
+		return fmt.Errorf("failed to reset table channel_domains: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM resumable_upload_parts"); err != nil {
+		return fmt.Errorf("failed to reset table resumable_upload_parts: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM resumable_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table resumable_uploads: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM form_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table form_uploads: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM storage_discrepancies"); err != nil {
+		return fmt.Errorf("failed to reset table storage_discrepancies: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_heatmaps"); err != nil {
+		return fmt.Errorf("failed to reset table video_heatmaps: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM channel_analytics"); err != nil {
+		return fmt.Errorf("failed to reset table channel_analytics: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_analytics"); err != nil {
+		return fmt.Errorf("failed to reset table video_analytics: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM playback_events"); err != nil {
+		return fmt.Errorf("failed to reset table playback_events: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM live_streams"); err != nil {
+		return fmt.Errorf("failed to reset table live_streams: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM stream_keys"); err != nil {
+		return fmt.Errorf("failed to reset table stream_keys: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM delivery_logs"); err != nil {
+		return fmt.Errorf("failed to reset table delivery_logs: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM delivery_usage"); err != nil {
+		return fmt.Errorf("failed to reset table delivery_usage: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM geo_restrictions"); err != nil {
+		return fmt.Errorf("failed to reset table geo_restrictions: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM hls_keys"); err != nil {
+		return fmt.Errorf("failed to reset table hls_keys: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM backfills"); err != nil {
+		return fmt.Errorf("failed to reset table backfills: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM quarantined_objects"); err != nil {
+		return fmt.Errorf("failed to reset table quarantined_objects: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM moderation_scans"); err != nil {
+		return fmt.Errorf("failed to reset table moderation_scans: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM email_preferences"); err != nil {
+		return fmt.Errorf("failed to reset table email_preferences: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM user_retention"); err != nil {
+		return fmt.Errorf("failed to reset table user_retention: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM user_quotas"); err != nil {
+		return fmt.Errorf("failed to reset table user_quotas: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM feature_flags"); err != nil {
+		return fmt.Errorf("failed to reset table feature_flags: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM renditions"); err != nil {
+		return fmt.Errorf("failed to reset table renditions: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM jobs"); err != nil {
+		return fmt.Errorf("failed to reset table jobs: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM pending_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table pending_uploads: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM dmca_takedowns"); err != nil {
+		return fmt.Errorf("failed to reset table dmca_takedowns: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM audit_log"); err != nil {
+		return fmt.Errorf("failed to reset table audit_log: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_reports"); err != nil {
+		return fmt.Errorf("failed to reset table video_reports: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM notifications"); err != nil {
+		return fmt.Errorf("failed to reset table notifications: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM subscriptions"); err != nil {
+		return fmt.Errorf("failed to reset table subscriptions: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM watch_later"); err != nil {
+		return fmt.Errorf("failed to reset table watch_later: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM playback_positions"); err != nil {
+		return fmt.Errorf("failed to reset table playback_positions: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM trending_scores"); err != nil {
+		return fmt.Errorf("failed to reset table trending_scores: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_views"); err != nil {
+		return fmt.Errorf("failed to reset table video_views: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_shares"); err != nil {
+		return fmt.Errorf("failed to reset table video_shares: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM webhook_deliveries"); err != nil {
+		return fmt.Errorf("failed to reset table webhook_deliveries: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM webhook_subscriptions"); err != nil {
+		return fmt.Errorf("failed to reset table webhook_subscriptions: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_tags"); err != nil {
+		return fmt.Errorf("failed to reset table video_tags: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM watch_history"); err != nil {
+		return fmt.Errorf("failed to reset table watch_history: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
+	if _, err := c.db.Exec(ctx, "DELETE FROM users"); err != nil {
 		return fmt.Errorf("failed to reset table users: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
+	if _, err := c.db.Exec(ctx, "DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM channel_members"); err != nil {
+		return fmt.Errorf("failed to reset table channel_members: %w", err)
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM channels"); err != nil {
+		return fmt.Errorf("failed to reset table channels: %w", err)
+	}
 	return nil
 }
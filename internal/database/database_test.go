@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// newTestClient opens a migrated SQLite database in a temporary directory.
+func newTestClient(t *testing.T) Client {
+	t.Helper()
+	c, err := NewClient(context.Background(), filepath.Join(t.TempDir(), "tubely.db"), PoolConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// createTestVideo creates a user and a video belonging to them.
+func createTestVideo(t *testing.T, c Client, params CreateVideoParams) Video {
+	t.Helper()
+	ctx := context.Background()
+	if params.UserID == uuid.Nil {
+		user, err := c.CreateUser(ctx, CreateUserParams{Email: uuid.NewString() + "@example.com", Password: "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.UserID = user.ID
+	}
+	if params.Title == "" {
+		params.Title = "Test video"
+	}
+	video, err := c.CreateVideo(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeliveryUsage is what the CDN delivered of one video on one UTC day.
+type DeliveryUsage struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Day      string    `json:"day"`
+	Bytes    int64     `json:"bytes"`
+	Requests int64     `json:"requests"`
+}
+
+// DailyDelivery is delivery summed over one UTC day.
+type DailyDelivery struct {
+	Day      string `json:"day"`
+	Bytes    int64  `json:"bytes"`
+	Requests int64  `json:"requests"`
+}
+
+// VideoDelivery is delivery of one video summed over a period.
+type VideoDelivery struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	Bytes    int64     `json:"bytes"`
+	Requests int64     `json:"requests"`
+}
+
+// OwnerDelivery is delivery of one user's videos summed over a period.
+type OwnerDelivery struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Bytes    int64     `json:"bytes"`
+	Requests int64     `json:"requests"`
+}
+
+// Usage is kept after its video is deleted, so an owner's totals still
+// cover what was delivered before.
+func (c *Client) migrateDelivery(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS delivery_usage (
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		bytes BIGINT NOT NULL,
+		requests INTEGER NOT NULL,
+		PRIMARY KEY(video_id, day)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_delivery_usage_user_day ON delivery_usage(user_id, day)")
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS delivery_logs (
+		s3_key TEXT PRIMARY KEY,
+		ingested_at TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// RecordDeliveryLog adds the usage counted from one access log file. Each
+// file is only counted once: it returns false, recording nothing, if the
+// file was ingested already.
+func (c Client) RecordDeliveryLog(ctx context.Context, key string, usage []DeliveryUsage) (bool, error) {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var existing string
+	err = tx.QueryRow("SELECT s3_key FROM delivery_logs WHERE s3_key = ?", key).Scan(&existing)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	if _, err := tx.Exec("INSERT INTO delivery_logs (s3_key, ingested_at) VALUES (?, ?)", key, time.Now().UTC()); err != nil {
+		return false, err
+	}
+
+	query := `
+	INSERT INTO delivery_usage (video_id, user_id, day, bytes, requests)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(video_id, day) DO UPDATE SET
+		bytes = delivery_usage.bytes + excluded.bytes,
+		requests = delivery_usage.requests + excluded.requests
+	`
+	for _, u := range usage {
+		if _, err := tx.Exec(query, u.VideoID, u.UserID, u.Day, u.Bytes, u.Requests); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// GetLastDeliveryLog returns the key of the last access log file ingested,
+// in key order, or "" if there's none.
+func (c Client) GetLastDeliveryLog(ctx context.Context) (string, error) {
+	var key sql.NullString
+	if err := c.db.QueryRow(ctx, "SELECT MAX(s3_key) FROM delivery_logs").Scan(&key); err != nil {
+		return "", err
+	}
+	return key.String, nil
+}
+
+// FindVideoByS3Key returns the video a stored object belongs to, and its
+// owner. Both are uuid.Nil if no rendition uses the key.
+func (c Client) FindVideoByS3Key(ctx context.Context, key string) (videoID, userID uuid.UUID, err error) {
+	query := `
+	SELECT renditions.video_id, videos.user_id
+	FROM renditions
+	JOIN videos ON videos.id = renditions.video_id
+	WHERE renditions.s3_key = ?
+	LIMIT 1
+	`
+	err = c.db.QueryRow(ctx, query, key).Scan(&videoID, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, uuid.Nil, nil
+	}
+	return videoID, userID, err
+}
+
+// GetVideoDailyDelivery returns a video's delivery per day since the given
+// one, oldest first. Days without delivery are omitted.
+func (c Client) GetVideoDailyDelivery(ctx context.Context, videoID uuid.UUID, since time.Time) ([]DailyDelivery, error) {
+	query := `
+	SELECT day, bytes, requests
+	FROM delivery_usage
+	WHERE video_id = ? AND day >= ?
+	ORDER BY day
+	`
+	return c.queryDailyDelivery(ctx, query, videoID, since.Format(time.DateOnly))
+}
+
+// GetUserDailyDelivery returns the delivery of a user's videos per day
+// since the given one, oldest first. Days without delivery are omitted.
+func (c Client) GetUserDailyDelivery(ctx context.Context, userID uuid.UUID, since time.Time) ([]DailyDelivery, error) {
+	query := `
+	SELECT day, SUM(bytes), SUM(requests)
+	FROM delivery_usage
+	WHERE user_id = ? AND day >= ?
+	GROUP BY day
+	ORDER BY day
+	`
+	return c.queryDailyDelivery(ctx, query, userID, since.Format(time.DateOnly))
+}
+
+func (c Client) queryDailyDelivery(ctx context.Context, query string, args ...any) ([]DailyDelivery, error) {
+	rows, err := c.onReplica().db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DailyDelivery{}
+	for rows.Next() {
+		var d DailyDelivery
+		if err := rows.Scan(&d.Day, &d.Bytes, &d.Requests); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// GetUserDeliveryByVideo returns the user's videos that used the most
+// bandwidth since the given day.
+func (c Client) GetUserDeliveryByVideo(ctx context.Context, userID uuid.UUID, since time.Time, limit int) ([]VideoDelivery, error) {
+	query := `
+	SELECT video_id, SUM(bytes) AS total_bytes, SUM(requests)
+	FROM delivery_usage
+	WHERE user_id = ? AND day >= ?
+	GROUP BY video_id
+	ORDER BY total_bytes DESC
+	LIMIT ?
+	`
+	rows, err := c.onReplica().db.Query(ctx, query, userID, since.Format(time.DateOnly), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []VideoDelivery{}
+	for rows.Next() {
+		var v VideoDelivery
+		if err := rows.Scan(&v.VideoID, &v.Bytes, &v.Requests); err != nil {
+			return nil, err
+		}
+		videos = append(videos, v)
+	}
+	return videos, rows.Err()
+}
+
+// GetDeliveryByOwner ranks users by the bandwidth their videos used since
+// the given day.
+func (c Client) GetDeliveryByOwner(ctx context.Context, since time.Time, limit, offset int) ([]OwnerDelivery, error) {
+	query := `
+	SELECT user_id, SUM(bytes) AS total_bytes, SUM(requests)
+	FROM delivery_usage
+	WHERE day >= ?
+	GROUP BY user_id
+	ORDER BY total_bytes DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.onReplica().db.Query(ctx, query, since.Format(time.DateOnly), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owners := []OwnerDelivery{}
+	for rows.Next() {
+		var o OwnerDelivery
+		if err := rows.Scan(&o.UserID, &o.Bytes, &o.Requests); err != nil {
+			return nil, err
+		}
+		owners = append(owners, o)
+	}
+	return owners, rows.Err()
+}
@@ -0,0 +1,296 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+)
+
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// parseDSN picks the driver for a DSN. postgres:// and postgresql:// URLs
+// use Postgres; anything else is treated as a path to a SQLite file.
+func parseDSN(dsn string) (dialect, string) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dialectSQLite, dsn
+	}
+	// CURRENT_TIMESTAMP defaults are stored in TIMESTAMP columns without a
+	// zone, so pin the session to UTC to match SQLite.
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dialectPostgres, dsn
+	}
+	q := u.Query()
+	if q.Get("timezone") == "" {
+		q.Set("timezone", "UTC")
+		u.RawQuery = q.Encode()
+	}
+	return dialectPostgres, u.String()
+}
+
+// withDSNParam adds a query parameter to a SQLite DSN unless it's already
+// set.
+func withDSNParam(dsn, key, value string) string {
+	path, query, _ := strings.Cut(dsn, "?")
+	q, err := url.ParseQuery(query)
+	if err != nil || q.Has(key) {
+		return dsn
+	}
+	q.Set(key, value)
+	return path + "?" + q.Encode()
+}
+
+// system is the dialect's OpenTelemetry db.system name.
+func (d dialect) system() string {
+	if d == dialectPostgres {
+		return "postgresql"
+	}
+	return "sqlite"
+}
+
+func (d dialect) driverName() string {
+	if d == dialectPostgres {
+		return "postgres"
+	}
+	return "sqlite3"
+}
+
+// rebind rewrites ? placeholders into the dialect's bind syntax. Queries are
+// written for SQLite; Postgres needs numbered $N parameters. Question marks
+// inside quoted strings are left alone.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var sb strings.Builder
+	sb.Grow(len(query) + 16)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inString = !inString
+			sb.WriteByte(ch)
+		case ch == '?' && !inString:
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
+}
+
+// daysSince returns an expression for the number of days between a
+// timestamp parameter and a column.
+func (d dialect) daysSince(column string) string {
+	if d == dialectPostgres {
+		return fmt.Sprintf("(EXTRACT(EPOCH FROM (CAST(? AS TIMESTAMP) - %s)) / 86400)", column)
+	}
+	return fmt.Sprintf("(julianday(?) - julianday(%s))", column)
+}
+
+// day returns an expression for a timestamp column's date as YYYY-MM-DD
+// text.
+func (d dialect) day(column string) string {
+	if d == dialectPostgres {
+		return fmt.Sprintf("TO_CHAR(%s, 'YYYY-MM-DD')", column)
+	}
+	return fmt.Sprintf("date(%s)", column)
+}
+
+// hour returns an expression for the start of a timestamp column's hour as
+// YYYY-MM-DD HH:00:00 text.
+func (d dialect) hour(column string) string {
+	if d == dialectPostgres {
+		return fmt.Sprintf("TO_CHAR(%s, 'YYYY-MM-DD HH24:00:00')", column)
+	}
+	return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00', %s)", column)
+}
+
+// conn wraps a *sql.DB so queries written with ? placeholders run unchanged
+// against either backend, and so every query is bounded by the client's
+// query timeout on top of the caller's context.
+type conn struct {
+	db      *sql.DB
+	dialect dialect
+	timeout time.Duration
+	// dsn is the DSN as configured, for tools such as pg_dump that connect
+	// on their own.
+	dsn string
+}
+
+func (c conn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+func (c conn) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := c.startSpan(ctx, query)
+	defer span.End()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	result, err := c.db.ExecContext(ctx, c.dialect.rebind(query), args...)
+	span.RecordError(err)
+	return result, err
+}
+
+// Query returns rows that release the query's timeout when closed.
+func (c conn) Query(ctx context.Context, query string, args ...any) (*rows, error) {
+	ctx, span := c.startSpan(ctx, query)
+	ctx, cancel := c.withTimeout(ctx)
+	r, err := c.db.QueryContext(ctx, c.dialect.rebind(query), args...)
+	if err != nil {
+		cancel()
+		span.RecordError(err)
+		span.End()
+		return nil, err
+	}
+	return &rows{r, cancel, span}, nil
+}
+
+// QueryRow returns a row that releases the query's timeout once scanned.
+func (c conn) QueryRow(ctx context.Context, query string, args ...any) row {
+	ctx, span := c.startSpan(ctx, query)
+	ctx, cancel := c.withTimeout(ctx)
+	return row{c.db.QueryRowContext(ctx, c.dialect.rebind(query), args...), cancel, span}
+}
+
+// Begin starts a transaction whose statements all run under ctx. The
+// timeout covers the whole transaction and is released on Commit or
+// Rollback.
+func (c conn) Begin(ctx context.Context) (tx, error) {
+	ctx, span := tracing.Start(ctx, "db transaction", tracing.KindClient, tracing.String("db.system", c.dialect.system()))
+	ctx, cancel := c.withTimeout(ctx)
+	t, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		span.RecordError(err)
+		span.End()
+		return tx{}, err
+	}
+	return tx{t, ctx, cancel, c.dialect, span}, nil
+}
+
+// startSpan traces a single statement, named after its leading keyword.
+func (c conn) startSpan(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	statement := strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(statement, " ")
+	if len(statement) > 1000 {
+		statement = statement[:1000]
+	}
+	return tracing.Start(ctx, "db "+strings.ToUpper(operation), tracing.KindClient,
+		tracing.String("db.system", c.dialect.system()),
+		tracing.String("db.statement", statement),
+	)
+}
+
+type rows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+	span   *tracing.Span
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	r.span.RecordError(r.Rows.Err())
+	r.span.End()
+	return err
+}
+
+type row struct {
+	row    *sql.Row
+	cancel context.CancelFunc
+	span   *tracing.Span
+}
+
+func (r row) Scan(dest ...any) error {
+	defer r.cancel()
+	defer r.span.End()
+	err := r.row.Scan(dest...)
+	if !errors.Is(err, sql.ErrNoRows) {
+		r.span.RecordError(err)
+	}
+	return err
+}
+
+type tx struct {
+	tx      *sql.Tx
+	ctx     context.Context
+	cancel  context.CancelFunc
+	dialect dialect
+	span    *tracing.Span
+}
+
+func (t tx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.tx.ExecContext(t.ctx, t.dialect.rebind(query), args...)
+}
+
+func (t tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.tx.QueryContext(t.ctx, t.dialect.rebind(query), args...)
+}
+
+func (t tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(t.ctx, t.dialect.rebind(query), args...)
+}
+
+func (t tx) Commit() error {
+	defer t.cancel()
+	err := t.tx.Commit()
+	t.span.RecordError(err)
+	t.span.End()
+	return err
+}
+
+// Rollback is deferred after every Begin, so it's usually called after
+// Commit and fails with sql.ErrTxDone; that isn't recorded as an error.
+func (t tx) Rollback() error {
+	defer t.cancel()
+	err := t.tx.Rollback()
+	if !errors.Is(err, sql.ErrTxDone) {
+		t.span.RecordError(err)
+	}
+	t.span.End()
+	return err
+}
+
+// scanTimestamp converts a timestamp read from an untyped expression such as
+// MAX(created_at). SQLite returns text for those while Postgres keeps the
+// column type.
+func scanTimestamp(v any) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case []byte:
+		return parseTimestamp(string(t))
+	case string:
+		return parseTimestamp(t)
+	}
+	return time.Time{}
+}
+
+func parseTimestamp(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
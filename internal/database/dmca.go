@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DMCATakedownStatus string
+
+const (
+	// DMCATakedownActive takedowns are waiting for a counter-notice.
+	DMCATakedownActive DMCATakedownStatus = "active"
+	// DMCATakedownCounterNoticed takedowns have been disputed by the
+	// uploader and are waiting on an admin to restore the video.
+	DMCATakedownCounterNoticed DMCATakedownStatus = "counter_noticed"
+	DMCATakedownRestored       DMCATakedownStatus = "restored"
+)
+
+type DMCATakedown struct {
+	ID                 uuid.UUID          `json:"id"`
+	VideoID            uuid.UUID          `json:"video_id"`
+	Status             DMCATakedownStatus `json:"status"`
+	ClaimantName       string             `json:"claimant_name"`
+	ClaimantEmail      string             `json:"claimant_email"`
+	WorkDescription    string             `json:"work_description"`
+	PreviousVisibility Visibility         `json:"previous_visibility"`
+	CounterNotice      *string            `json:"counter_notice"`
+	CounterNoticedAt   *time.Time         `json:"counter_noticed_at"`
+	CreatedBy          uuid.UUID          `json:"created_by"`
+	CreatedAt          time.Time          `json:"created_at"`
+	ResolvedAt         *time.Time         `json:"resolved_at"`
+}
+
+type CreateDMCATakedownParams struct {
+	VideoID         uuid.UUID
+	ClaimantName    string
+	ClaimantEmail   string
+	WorkDescription string
+	CreatedBy       uuid.UUID
+}
+
+const dmcaTakedownColumns = `
+		id,
+		video_id,
+		status,
+		claimant_name,
+		claimant_email,
+		work_description,
+		previous_visibility,
+		counter_notice,
+		counter_noticed_at,
+		created_by,
+		created_at,
+		resolved_at`
+
+func scanDMCATakedown(row rowScanner) (DMCATakedown, error) {
+	var t DMCATakedown
+	err := row.Scan(
+		&t.ID,
+		&t.VideoID,
+		&t.Status,
+		&t.ClaimantName,
+		&t.ClaimantEmail,
+		&t.WorkDescription,
+		&t.PreviousVisibility,
+		&t.CounterNotice,
+		&t.CounterNoticedAt,
+		&t.CreatedBy,
+		&t.CreatedAt,
+		&t.ResolvedAt,
+	)
+	return t, err
+}
+
+// CreateDMCATakedown records a takedown and, in the same transaction, takes
+// the video down, marks it as under legal hold so it can't be purged, and
+// revokes its share links. Restoring the video doesn't bring them back.
+func (c Client) CreateDMCATakedown(ctx context.Context, params CreateDMCATakedownParams) (DMCATakedown, error) {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return DMCATakedown{}, err
+	}
+	defer tx.Rollback()
+
+	var visibility Visibility
+	err = tx.QueryRow("SELECT visibility FROM videos WHERE id = ?", params.VideoID).Scan(&visibility)
+	if err != nil {
+		return DMCATakedown{}, err
+	}
+
+	id := uuid.New()
+	query := `
+	INSERT INTO dmca_takedowns (
+		id,
+		video_id,
+		status,
+		claimant_name,
+		claimant_email,
+		work_description,
+		previous_visibility,
+		created_by,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err = tx.Exec(query, id, params.VideoID, DMCATakedownActive, params.ClaimantName, params.ClaimantEmail, params.WorkDescription, visibility, params.CreatedBy)
+	if err != nil {
+		return DMCATakedown{}, err
+	}
+
+	query = `
+	UPDATE videos
+	SET taken_down_at = COALESCE(taken_down_at, ?), visibility = ?, legal_hold = TRUE, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err = tx.Exec(query, time.Now().UTC(), VisibilityPrivate, params.VideoID)
+	if err != nil {
+		return DMCATakedown{}, err
+	}
+	_, err = tx.Exec("DELETE FROM video_shares WHERE video_id = ?", params.VideoID)
+	if err != nil {
+		return DMCATakedown{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return DMCATakedown{}, err
+	}
+	return c.GetDMCATakedown(ctx, id)
+}
+
+func (c Client) GetDMCATakedown(ctx context.Context, id uuid.UUID) (DMCATakedown, error) {
+	query := `
+	SELECT` + dmcaTakedownColumns + `
+	FROM dmca_takedowns
+	WHERE id = ?
+	`
+	t, err := scanDMCATakedown(c.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DMCATakedown{}, nil
+		}
+		return DMCATakedown{}, err
+	}
+	return t, nil
+}
+
+// GetOpenDMCATakedownForVideo returns the video's unresolved takedown, or a
+// zero value when there is none.
+func (c Client) GetOpenDMCATakedownForVideo(ctx context.Context, videoID uuid.UUID) (DMCATakedown, error) {
+	query := `
+	SELECT` + dmcaTakedownColumns + `
+	FROM dmca_takedowns
+	WHERE video_id = ? AND resolved_at IS NULL
+	ORDER BY created_at DESC
+	LIMIT 1
+	`
+	t, err := scanDMCATakedown(c.db.QueryRow(ctx, query, videoID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DMCATakedown{}, nil
+		}
+		return DMCATakedown{}, err
+	}
+	return t, nil
+}
+
+// GetDMCATakedowns lists takedowns, optionally filtered by status.
+func (c Client) GetDMCATakedowns(ctx context.Context, status DMCATakedownStatus, limit, offset int) ([]DMCATakedown, error) {
+	query := `
+	SELECT` + dmcaTakedownColumns + `
+	FROM dmca_takedowns
+	WHERE ? = '' OR status = ?
+	ORDER BY created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, status, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	takedowns := []DMCATakedown{}
+	for rows.Next() {
+		t, err := scanDMCATakedown(rows)
+		if err != nil {
+			return nil, err
+		}
+		takedowns = append(takedowns, t)
+	}
+	return takedowns, rows.Err()
+}
+
+func (c Client) SubmitDMCACounterNotice(ctx context.Context, id uuid.UUID, statement string) error {
+	query := `
+	UPDATE dmca_takedowns
+	SET status = ?, counter_notice = ?, counter_noticed_at = ?
+	WHERE id = ? AND status = ?
+	`
+	_, err := c.db.Exec(ctx, query, DMCATakedownCounterNoticed, statement, time.Now().UTC(), id, DMCATakedownActive)
+	return err
+}
+
+// RestoreDMCATakedown resolves a takedown and puts the video back the way it
+// was: its previous visibility, no takedown marker, and no legal hold.
+func (c Client) RestoreDMCATakedown(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var videoID uuid.UUID
+	var visibility Visibility
+	err = tx.QueryRow("SELECT video_id, previous_visibility FROM dmca_takedowns WHERE id = ?", id).Scan(&videoID, &visibility)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE dmca_takedowns SET status = ?, resolved_at = ? WHERE id = ?", DMCATakedownRestored, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	query := `
+	UPDATE videos
+	SET taken_down_at = NULL, visibility = ?, legal_hold = FALSE, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err = tx.Exec(query, visibility, videoID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateDMCATakedown(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	video := createTestVideo(t, c, CreateVideoParams{Visibility: VisibilityPublic})
+	share, err := c.CreateVideoShare(ctx, CreateVideoShareParams{
+		Token:     "share-token",
+		VideoID:   video.ID,
+		CreatedBy: video.UserID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	takedown, err := c.CreateDMCATakedown(ctx, CreateDMCATakedownParams{
+		VideoID:         video.ID,
+		ClaimantName:    "Claimant",
+		ClaimantEmail:   "claimant@example.com",
+		WorkDescription: "A song",
+		CreatedBy:       uuid.New(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	video, err = c.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.TakenDownAt == nil || !video.LegalHold || video.Visibility != VisibilityPrivate {
+		t.Errorf("video after takedown: taken_down_at %v, legal_hold %v, visibility %s", video.TakenDownAt, video.LegalHold, video.Visibility)
+	}
+	if redeemed, err := c.RedeemVideoShare(ctx, share.Token); err != nil || redeemed.ID != uuid.Nil {
+		t.Errorf("share link still redeemable after takedown: %+v, %v", redeemed, err)
+	}
+
+	if err := c.RestoreDMCATakedown(ctx, takedown.ID); err != nil {
+		t.Fatal(err)
+	}
+	video, err = c.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.TakenDownAt != nil || video.LegalHold || video.Visibility != VisibilityPublic {
+		t.Errorf("video after restore: taken_down_at %v, legal_hold %v, visibility %s", video.TakenDownAt, video.LegalHold, video.Visibility)
+	}
+}
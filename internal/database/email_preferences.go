@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailKind is a kind of email notification a user can opt out of.
+type EmailKind string
+
+const (
+	EmailProcessingComplete EmailKind = "processing_complete"
+	EmailProcessingFailed   EmailKind = "processing_failed"
+	EmailQuotaWarning       EmailKind = "quota_warning"
+)
+
+// EmailKinds lists every kind of email notification.
+var EmailKinds = []EmailKind{EmailProcessingComplete, EmailProcessingFailed, EmailQuotaWarning}
+
+func (k EmailKind) Valid() bool {
+	switch k {
+	case EmailProcessingComplete, EmailProcessingFailed, EmailQuotaWarning:
+		return true
+	}
+	return false
+}
+
+func (c *Client) migrateEmailPreferences(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS email_preferences (
+		user_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (user_id, kind),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`)
+	return err
+}
+
+// GetEmailPreferences returns whether each kind of email is enabled for a
+// user. Every kind is enabled until the user turns it off.
+func (c Client) GetEmailPreferences(ctx context.Context, userID uuid.UUID) (map[EmailKind]bool, error) {
+	prefs := map[EmailKind]bool{}
+	for _, kind := range EmailKinds {
+		prefs[kind] = true
+	}
+	rows, err := c.db.Query(ctx, "SELECT kind, enabled FROM email_preferences WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind EmailKind
+		var enabled bool
+		if err := rows.Scan(&kind, &enabled); err != nil {
+			return nil, err
+		}
+		if kind.Valid() {
+			prefs[kind] = enabled
+		}
+	}
+	return prefs, rows.Err()
+}
+
+// SetEmailPreference turns one kind of email on or off for a user.
+func (c Client) SetEmailPreference(ctx context.Context, userID uuid.UUID, kind EmailKind, enabled bool) error {
+	query := `
+	INSERT INTO email_preferences (
+		user_id,
+		kind,
+		enabled,
+		updated_at
+	) VALUES (?, ?, ?, ?)
+	ON CONFLICT(user_id, kind) DO UPDATE SET
+		enabled = excluded.enabled,
+		updated_at = excluded.updated_at
+	`
+	_, err := c.db.Exec(ctx, query, userID, kind, enabled, time.Now().UTC())
+	return err
+}
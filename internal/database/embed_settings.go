@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmbedSettings restrict where a video's embed player may be framed. With
+// AllowedDomains set, only pages on those domains, or their subdomains for
+// entries starting with "*.", may frame it. With RequireToken set, the
+// player only loads with a signed embed token; tokens issued before
+// TokensValidAfter are revoked.
+type EmbedSettings struct {
+	VideoID          uuid.UUID  `json:"video_id"`
+	AllowedDomains   []string   `json:"allowed_domains"`
+	RequireToken     bool       `json:"require_token"`
+	TokensValidAfter *time.Time `json:"tokens_valid_after,omitempty"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func (c *Client) migrateEmbedSettings(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS embed_settings (
+		video_id TEXT PRIMARY KEY,
+		allowed_domains TEXT NOT NULL,
+		require_token BOOLEAN NOT NULL DEFAULT FALSE,
+		tokens_valid_after TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	return err
+}
+
+// SetEmbedSettings creates or replaces a video's allowed domains and token
+// requirement, keeping any token revocation.
+func (c Client) SetEmbedSettings(ctx context.Context, videoID uuid.UUID, allowedDomains []string, requireToken bool) (EmbedSettings, error) {
+	query := `
+	INSERT INTO embed_settings (video_id, allowed_domains, require_token, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(video_id) DO UPDATE SET
+		allowed_domains = excluded.allowed_domains,
+		require_token = excluded.require_token,
+		updated_at = excluded.updated_at
+	`
+	_, err := c.db.Exec(ctx, query, videoID, strings.Join(allowedDomains, ","), requireToken, formatTimestamp(time.Now()))
+	if err != nil {
+		return EmbedSettings{}, err
+	}
+	s, err := c.GetEmbedSettings(ctx, videoID)
+	if err != nil {
+		return EmbedSettings{}, err
+	}
+	return *s, nil
+}
+
+// RevokeEmbedTokens invalidates every embed token issued for a video until
+// now, creating default settings if it has none.
+func (c Client) RevokeEmbedTokens(ctx context.Context, videoID uuid.UUID) (EmbedSettings, error) {
+	now := formatTimestamp(time.Now())
+	query := `
+	INSERT INTO embed_settings (video_id, allowed_domains, require_token, tokens_valid_after, updated_at)
+	VALUES (?, '', FALSE, ?, ?)
+	ON CONFLICT(video_id) DO UPDATE SET
+		tokens_valid_after = excluded.tokens_valid_after,
+		updated_at = excluded.updated_at
+	`
+	if _, err := c.db.Exec(ctx, query, videoID, now, now); err != nil {
+		return EmbedSettings{}, err
+	}
+	s, err := c.GetEmbedSettings(ctx, videoID)
+	if err != nil {
+		return EmbedSettings{}, err
+	}
+	return *s, nil
+}
+
+// GetEmbedSettings returns nil if the video's embeds aren't restricted.
+func (c Client) GetEmbedSettings(ctx context.Context, videoID uuid.UUID) (*EmbedSettings, error) {
+	s := EmbedSettings{VideoID: videoID}
+	var domains string
+	query := "SELECT allowed_domains, require_token, tokens_valid_after, updated_at FROM embed_settings WHERE video_id = ?"
+	err := c.db.QueryRow(ctx, query, videoID).Scan(&domains, &s.RequireToken, &s.TokensValidAfter, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.AllowedDomains = []string{}
+	if domains != "" {
+		s.AllowedDomains = strings.Split(domains, ",")
+	}
+	return &s, nil
+}
+
+func (c Client) DeleteEmbedSettings(ctx context.Context, videoID uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM embed_settings WHERE video_id = ?", videoID)
+	return err
+}
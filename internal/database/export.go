@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExportedVideo is a video with its all-time stats, as included in a
+// catalog export.
+type ExportedVideo struct {
+	Video
+	Views            int   `json:"views"`
+	DeliveredBytes   int64 `json:"delivered_bytes"`
+	DeliveryRequests int64 `json:"delivery_requests"`
+}
+
+// ExportVideos lists all of a user's videos, including those in the trash,
+// oldest first, with their tags and stats. A non-zero from or to limits it
+// to videos created at or after from and before to.
+func (c Client) ExportVideos(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]ExportedVideo, error) {
+	c = c.onReplica()
+	query := `
+	SELECT` + videoColumns + `, view_count, COALESCE(d.bytes, 0), COALESCE(d.requests, 0)
+	FROM videos
+	LEFT JOIN (
+		SELECT video_id, SUM(bytes) AS bytes, SUM(requests) AS requests
+		FROM delivery_usage
+		WHERE user_id = ?
+		GROUP BY video_id
+	) d ON d.video_id = videos.id
+	WHERE user_id = ?
+	`
+	args := []any{userID, userID}
+	if !from.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, formatTimestamp(from))
+	}
+	if !to.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, formatTimestamp(to))
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := c.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []ExportedVideo{}
+	index := map[uuid.UUID]int{}
+	for rows.Next() {
+		var v ExportedVideo
+		v.Video, err = scanVideo(trailingScanner{rows, []any{&v.Views, &v.DeliveredBytes, &v.DeliveryRequests}})
+		if err != nil {
+			return nil, err
+		}
+		v.Tags = []string{}
+		index[v.ID] = len(videos)
+		videos = append(videos, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Tags are read in one query rather than one per video.
+	tagRows, err := c.db.Query(ctx, `
+	SELECT video_tags.video_id, video_tags.tag
+	FROM video_tags
+	JOIN videos ON videos.id = video_tags.video_id
+	WHERE videos.user_id = ?
+	ORDER BY video_tags.tag
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var videoID uuid.UUID
+		var tag string
+		if err := tagRows.Scan(&videoID, &tag); err != nil {
+			return nil, err
+		}
+		if i, ok := index[videoID]; ok {
+			videos[i].Tags = append(videos[i].Tags, tag)
+		}
+	}
+	return videos, tagRows.Err()
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// FeatureFlag overrides a flag's configured default. RolloutPercent limits
+// an enabled flag to that share of users.
+type FeatureFlag struct {
+	Name           string    `json:"name"`
+	Enabled        bool      `json:"enabled"`
+	RolloutPercent int       `json:"rollout_percent"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (c *Client) migrateFeatureFlags(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS feature_flags (
+		name TEXT PRIMARY KEY,
+		enabled BOOLEAN NOT NULL,
+		rollout_percent INTEGER NOT NULL DEFAULT 100,
+		updated_at TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+func (c Client) GetFeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	rows, err := c.db.Query(ctx, "SELECT name, enabled, rollout_percent, updated_at FROM feature_flags ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []FeatureFlag{}
+	for rows.Next() {
+		var flag FeatureFlag
+		if err := rows.Scan(&flag.Name, &flag.Enabled, &flag.RolloutPercent, &flag.UpdatedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+	return flags, rows.Err()
+}
+
+// SetFeatureFlag creates or replaces a flag's override.
+func (c Client) SetFeatureFlag(ctx context.Context, flag FeatureFlag) (FeatureFlag, error) {
+	flag.UpdatedAt = time.Now().UTC()
+	query := `
+	INSERT INTO feature_flags (
+		name,
+		enabled,
+		rollout_percent,
+		updated_at
+	) VALUES (?, ?, ?, ?)
+	ON CONFLICT(name) DO UPDATE SET
+		enabled = excluded.enabled,
+		rollout_percent = excluded.rollout_percent,
+		updated_at = excluded.updated_at
+	`
+	_, err := c.db.Exec(ctx, query, flag.Name, flag.Enabled, flag.RolloutPercent, flag.UpdatedAt)
+	if err != nil {
+		return FeatureFlag{}, err
+	}
+	return flag, nil
+}
+
+// DeleteFeatureFlag removes a flag's override so it falls back to its
+// configured default.
+func (c Client) DeleteFeatureFlag(ctx context.Context, name string) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM feature_flags WHERE name = ?", name)
+	return err
+}
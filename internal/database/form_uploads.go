@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FormUpload is a video file a browser posts straight to the bucket with a
+// signed POST policy. The object lands under KeyPrefix in Bucket, and S3
+// redirects the browser to the server's callback to have it processed.
+type FormUpload struct {
+	ID      uuid.UUID
+	VideoID uuid.UUID
+	UserID  uuid.UUID
+	// Bucket is empty for uploads signed before it was recorded, which
+	// went to the serving bucket.
+	Bucket           string
+	KeyPrefix        string
+	ContainerProfile string
+	// RedirectURL is where the browser is sent once the upload is queued
+	// for processing, if the client gave one.
+	RedirectURL string
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+	// CompletingAt is when a callback claimed the upload, if one has.
+	CompletingAt *time.Time
+}
+
+func (c *Client) migrateFormUploads(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS form_uploads (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		key_prefix TEXT NOT NULL,
+		container_profile TEXT NOT NULL DEFAULT '',
+		redirect_url TEXT NOT NULL DEFAULT '',
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		completing_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_form_uploads_expires ON form_uploads(expires_at)")
+	return err
+}
+
+func (c *Client) migrateFormUploadBucket(ctx context.Context) error {
+	return c.addColumnIfMissing(ctx, "form_uploads", "bucket", "TEXT NOT NULL DEFAULT ''")
+}
+
+func (c Client) CreateFormUpload(ctx context.Context, u FormUpload) error {
+	query := `
+	INSERT INTO form_uploads (
+		id,
+		video_id,
+		user_id,
+		bucket,
+		key_prefix,
+		container_profile,
+		redirect_url,
+		expires_at,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(ctx, query,
+		u.ID,
+		u.VideoID,
+		u.UserID,
+		u.Bucket,
+		u.KeyPrefix,
+		u.ContainerProfile,
+		u.RedirectURL,
+		formatTimestamp(u.ExpiresAt),
+		formatTimestamp(u.CreatedAt),
+	)
+	return err
+}
+
+const formUploadColumns = `
+	id,
+	video_id,
+	user_id,
+	bucket,
+	key_prefix,
+	container_profile,
+	redirect_url,
+	expires_at,
+	created_at,
+	completing_at
+`
+
+func scanFormUpload(row rowScanner) (FormUpload, error) {
+	var u FormUpload
+	err := row.Scan(
+		&u.ID,
+		&u.VideoID,
+		&u.UserID,
+		&u.Bucket,
+		&u.KeyPrefix,
+		&u.ContainerProfile,
+		&u.RedirectURL,
+		&u.ExpiresAt,
+		&u.CreatedAt,
+		&u.CompletingAt,
+	)
+	return u, err
+}
+
+// GetFormUpload returns nil if there's no upload with the ID.
+func (c Client) GetFormUpload(ctx context.Context, id uuid.UUID) (*FormUpload, error) {
+	u, err := scanFormUpload(c.db.QueryRow(ctx, "SELECT"+formUploadColumns+" FROM form_uploads WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ClaimFormUpload marks an upload as being processed. It reports false if
+// another callback claimed it since staleBefore; older claims are taken to
+// belong to requests that died.
+func (c Client) ClaimFormUpload(ctx context.Context, id uuid.UUID, staleBefore time.Time) (bool, error) {
+	query := `
+	UPDATE form_uploads
+	SET completing_at = ?
+	WHERE id = ? AND (completing_at IS NULL OR completing_at < ?)
+	`
+	result, err := c.db.Exec(ctx, query, formatTimestamp(time.Now()), id, formatTimestamp(staleBefore))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ReleaseFormUpload drops a claim, so the callback can be tried again.
+func (c Client) ReleaseFormUpload(ctx context.Context, id uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "UPDATE form_uploads SET completing_at = NULL WHERE id = ?", id)
+	return err
+}
+
+// DeleteFormUpload removes an upload. The caller deletes its object first.
+func (c Client) DeleteFormUpload(ctx context.Context, id uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM form_uploads WHERE id = ?", id)
+	return err
+}
+
+// GetFormUploadsExpiredBefore lists uploads that expired before now, other
+// than those claimed since staleBefore.
+func (c Client) GetFormUploadsExpiredBefore(ctx context.Context, now, staleBefore time.Time) ([]FormUpload, error) {
+	query := `
+	SELECT` + formUploadColumns + `
+	FROM form_uploads
+	WHERE expires_at < ? AND (completing_at IS NULL OR completing_at < ?)
+	ORDER BY expires_at
+	`
+	rows, err := c.db.Query(ctx, query, formatTimestamp(now), formatTimestamp(staleBefore))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []FormUpload{}
+	for rows.Next() {
+		u, err := scanFormUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GeoRestriction limits the countries a video plays in, by ISO 3166-1
+// alpha-2 code. With Allowed set, only those countries may play it; Blocked
+// countries never may.
+type GeoRestriction struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	Allowed   []string  `json:"allowed"`
+	Blocked   []string  `json:"blocked"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Allows reports whether a viewer in country may play the video. An
+// unknown country, "", is only allowed when there's no allow list.
+func (g GeoRestriction) Allows(country string) bool {
+	if country != "" && slices.Contains(g.Blocked, country) {
+		return false
+	}
+	return len(g.Allowed) == 0 || slices.Contains(g.Allowed, country)
+}
+
+func (c *Client) migrateGeoRestrictions(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS geo_restrictions (
+		video_id TEXT PRIMARY KEY,
+		allowed TEXT NOT NULL,
+		blocked TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	return err
+}
+
+// SetGeoRestriction creates or replaces a video's restriction.
+func (c Client) SetGeoRestriction(ctx context.Context, videoID uuid.UUID, allowed, blocked []string) (GeoRestriction, error) {
+	g := GeoRestriction{
+		VideoID:   videoID,
+		Allowed:   allowed,
+		Blocked:   blocked,
+		UpdatedAt: time.Now().UTC(),
+	}
+	query := `
+	INSERT INTO geo_restrictions (video_id, allowed, blocked, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(video_id) DO UPDATE SET
+		allowed = excluded.allowed,
+		blocked = excluded.blocked,
+		updated_at = excluded.updated_at
+	`
+	_, err := c.db.Exec(ctx, query, videoID, strings.Join(allowed, ","), strings.Join(blocked, ","), g.UpdatedAt)
+	if err != nil {
+		return GeoRestriction{}, err
+	}
+	return g, nil
+}
+
+// GetGeoRestriction returns nil if the video isn't restricted.
+func (c Client) GetGeoRestriction(ctx context.Context, videoID uuid.UUID) (*GeoRestriction, error) {
+	g := GeoRestriction{VideoID: videoID}
+	var allowed, blocked string
+	query := "SELECT allowed, blocked, updated_at FROM geo_restrictions WHERE video_id = ?"
+	err := c.db.QueryRow(ctx, query, videoID).Scan(&allowed, &blocked, &g.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.Allowed = splitCountries(allowed)
+	g.Blocked = splitCountries(blocked)
+	return &g, nil
+}
+
+func (c Client) DeleteGeoRestriction(ctx context.Context, videoID uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM geo_restrictions WHERE video_id = ?", videoID)
+	return err
+}
+
+func splitCountries(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
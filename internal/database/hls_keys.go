@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// hlsKeySize is the size of an AES-128 key.
+const hlsKeySize = 16
+
+func (c *Client) migrateHLSKeys(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS hls_keys (
+		video_id TEXT PRIMARY KEY,
+		key_hex TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	return err
+}
+
+// EnsureHLSKey returns the key a video's HLS segments are encrypted with,
+// creating it if the video doesn't have one yet. The key is kept when the
+// video is reprocessed.
+func (c Client) EnsureHLSKey(ctx context.Context, videoID uuid.UUID) ([]byte, error) {
+	key := make([]byte, hlsKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	query := `
+	INSERT INTO hls_keys (video_id, key_hex, created_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(video_id) DO NOTHING
+	`
+	if _, err := c.db.Exec(ctx, query, videoID, hex.EncodeToString(key), time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	stored, err := c.GetHLSKey(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, errors.New("HLS key wasn't stored")
+	}
+	return stored, nil
+}
+
+// GetHLSKey returns nil if the video has no HLS key.
+func (c Client) GetHLSKey(ctx context.Context, videoID uuid.UUID) ([]byte, error) {
+	var keyHex string
+	err := c.db.QueryRow(ctx, "SELECT key_hex FROM hls_keys WHERE video_id = ?", videoID).Scan(&keyHex)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(keyHex)
+}
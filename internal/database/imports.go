@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrEmailTaken is returned when importing a user whose email address
+// belongs to a different user here.
+var ErrEmailTaken = errors.New("email is used by another user")
+
+// MigratedUser is a user as copied from one instance to another. The
+// password hash comes along, so they can log in with the same password.
+type MigratedUser struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	Password  string    `json:"password"`
+	IsAdmin   bool      `json:"is_admin"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExportUsers lists every user, oldest first, for copying to another
+// instance.
+func (c Client) ExportUsers(ctx context.Context) ([]MigratedUser, error) {
+	rows, err := c.db.Query(ctx, "SELECT id, email, password, is_admin, created_at, updated_at FROM users ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []MigratedUser{}
+	for rows.Next() {
+		var u MigratedUser
+		if err := rows.Scan(&u.ID, &u.Email, &u.Password, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// ImportUser creates a user copied from another instance with the same ID.
+// It reports false if the user was already imported, and returns
+// ErrEmailTaken if someone else here has their email address.
+func (c Client) ImportUser(ctx context.Context, u MigratedUser) (bool, error) {
+	query := `
+	INSERT INTO users (
+		id,
+		created_at,
+		updated_at,
+		email,
+		password,
+		is_admin
+	) VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT DO NOTHING
+	`
+	result, err := c.db.Exec(ctx, query, u.ID.String(), formatTimestamp(u.CreatedAt), formatTimestamp(u.UpdatedAt), u.Email, u.Password, u.IsAdmin)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return affected > 0, err
+	}
+	existing, err := c.GetUser(ctx, u.ID)
+	if err != nil {
+		return false, err
+	}
+	if existing == nil {
+		return false, ErrEmailTaken
+	}
+	return false, nil
+}
+
+// ImportVideo creates a video copied from another instance with the same
+// ID, along with its tags and renditions. Its slug is kept unless another
+// video here has it, and it's left out of its channel if the channel
+// doesn't exist here. It reports false if the video was already imported.
+func (c Client) ImportVideo(ctx context.Context, video Video, renditions []Rendition) (bool, error) {
+	slug := video.Slug
+	if slug != nil {
+		taken, err := c.slugTaken(ctx, *slug, video.ID)
+		if err != nil {
+			return false, err
+		}
+		if taken {
+			slug = nil
+		}
+	}
+	if slug == nil {
+		s, err := c.uniqueSlug(ctx, video.Title, video.ID)
+		if err != nil {
+			return false, err
+		}
+		slug = &s
+	}
+
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO videos (
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		user_id,
+		channel_id,
+		visibility,
+		slug,
+		status,
+		deleted_at,
+		video_url,
+		thumbnail_url,
+		duration_seconds,
+		width,
+		height,
+		frame_rate,
+		size_bytes,
+		projection,
+		hdr,
+		aspect
+	) VALUES (?, ?, ?, ?, ?, ?, (SELECT id FROM channels WHERE id = ?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT DO NOTHING
+	`
+	var deletedAt any
+	if video.DeletedAt != nil {
+		deletedAt = formatTimestamp(*video.DeletedAt)
+	}
+	result, err := tx.Exec(query,
+		video.ID,
+		formatTimestamp(video.CreatedAt),
+		formatTimestamp(video.UpdatedAt),
+		video.Title,
+		video.Description,
+		video.UserID,
+		video.ChannelID,
+		video.Visibility,
+		*slug,
+		video.Status,
+		deletedAt,
+		video.VideoURL,
+		video.ThumbnailURL,
+		video.DurationSeconds,
+		video.Width,
+		video.Height,
+		video.FrameRate,
+		video.SizeBytes,
+		video.Projection,
+		video.HDR,
+		video.Aspect,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+	for _, tag := range video.Tags {
+		if _, err := tx.Exec("INSERT INTO video_tags (video_id, tag) VALUES (?, ?) ON CONFLICT DO NOTHING", video.ID, tag); err != nil {
+			return false, err
+		}
+	}
+	if err := replaceRenditions(tx, video.ID, renditions); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
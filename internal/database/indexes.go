@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+)
+
+type index struct {
+	name       string
+	definition string
+}
+
+// listingIndexes back the video listing, search, and feed queries. Missing
+// any of them turns those queries into full table scans, so CheckIndexes
+// warns about them at startup.
+var listingIndexes = []index{
+	{"idx_videos_user_created", "videos(user_id, created_at)"},
+	{"idx_videos_status_created", "videos(status, created_at)"},
+	{"idx_videos_aspect_created", "videos(aspect, created_at)"},
+	{"idx_videos_channel_created", "videos(channel_id, created_at)"},
+	{"idx_videos_visibility_created", "videos(visibility, created_at)"},
+	{"idx_videos_created", "videos(created_at, id)"},
+	{"idx_videos_deleted", "videos(deleted_at)"},
+	{"idx_video_tags_tag", "video_tags(tag, video_id)"},
+	{"idx_subscriptions_creator", "subscriptions(creator_id)"},
+	{"idx_subscriptions_channel", "subscriptions(channel_id)"},
+	{"idx_watch_history_user", "watch_history(user_id, watched_at)"},
+	{"idx_channel_members_user", "channel_members(user_id)"},
+	{"idx_webhook_subscriptions_user", "webhook_subscriptions(user_id)"},
+}
+
+func (c *Client) migrateListingIndexes(ctx context.Context) error {
+	for _, idx := range listingIndexes {
+		_, err := c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS "+idx.name+" ON "+idx.definition)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MissingIndexes returns the names of listing indexes that don't exist, for
+// example because they were dropped by hand or a migration was skipped.
+func (c Client) MissingIndexes(ctx context.Context) ([]string, error) {
+	query := "SELECT name FROM sqlite_master WHERE type = 'index'"
+	if c.db.dialect == dialectPostgres {
+		query = "SELECT indexname FROM pg_indexes WHERE schemaname = current_schema()"
+	}
+	rows, err := c.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, idx := range listingIndexes {
+		if !existing[idx.name] {
+			missing = append(missing, idx.name)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,449 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+// Jobs move pending → running → succeeded, or back to pending for a retry
+// when a run fails with attempts left. A job that fails its last attempt is
+// dead-lettered, keeping the diagnostics of its last run. Workers renew a
+// running job's lease while they work on it; one whose lease expires,
+// because the worker died, can be claimed again. An
+// admin can cancel a pending or running job, and put a dead or cancelled
+// one back to pending.
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusDead      JobStatus = "dead"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+func (s JobStatus) Valid() bool {
+	switch s {
+	case JobStatusPending, JobStatusRunning, JobStatusSucceeded, JobStatusDead, JobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	Type        string          `json:"type"`
+	VideoID     *uuid.UUID      `json:"video_id"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      JobStatus       `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Error       *string         `json:"error"`
+	// Diagnostics describe the last failed run, such as the input and
+	// ffmpeg's stderr, as a JSON object.
+	Diagnostics json.RawMessage `json:"diagnostics,omitempty"`
+	RunAfter    time.Time       `json:"run_after"`
+	LockedUntil *time.Time      `json:"locked_until,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+	// TraceParent is the W3C traceparent of the request that queued the
+	// job, so the job's span joins that request's trace.
+	TraceParent string `json:"-"`
+}
+
+type CreateJobParams struct {
+	Type        string
+	VideoID     *uuid.UUID
+	Payload     any
+	MaxAttempts int
+}
+
+func (c *Client) migrateJobs(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		video_id TEXT,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		error TEXT,
+		run_after TIMESTAMP NOT NULL,
+		locked_until TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		started_at TIMESTAMP,
+		finished_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_jobs_status_run_after ON jobs(status, run_after)")
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_jobs_video ON jobs(video_id)")
+	return err
+}
+
+func (c *Client) migrateJobTraceParent(ctx context.Context) error {
+	return c.addColumnIfMissing(ctx, "jobs", "trace_parent", "TEXT NOT NULL DEFAULT ''")
+}
+
+func (c *Client) migrateJobDeadLetter(ctx context.Context) error {
+	err := c.addColumnIfMissing(ctx, "jobs", "diagnostics", "TEXT")
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "UPDATE jobs SET status = 'dead' WHERE status = 'failed'")
+	return err
+}
+
+const jobColumns = `
+		id,
+		type,
+		video_id,
+		payload,
+		status,
+		attempts,
+		max_attempts,
+		error,
+		run_after,
+		locked_until,
+		created_at,
+		started_at,
+		finished_at,
+		trace_parent,
+		diagnostics`
+
+func scanJob(row rowScanner) (Job, error) {
+	var job Job
+	var payload string
+	var diagnostics sql.NullString
+	err := row.Scan(
+		&job.ID,
+		&job.Type,
+		&job.VideoID,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.Error,
+		&job.RunAfter,
+		&job.LockedUntil,
+		&job.CreatedAt,
+		&job.StartedAt,
+		&job.FinishedAt,
+		&job.TraceParent,
+		&diagnostics,
+	)
+	job.Payload = json.RawMessage(payload)
+	if diagnostics.Valid {
+		job.Diagnostics = json.RawMessage(diagnostics.String)
+	}
+	return job, err
+}
+
+func (c Client) CreateJob(ctx context.Context, params CreateJobParams) (Job, error) {
+	payload, err := json.Marshal(params.Payload)
+	if err != nil {
+		return Job{}, err
+	}
+	id := uuid.New()
+	query := `
+	INSERT INTO jobs (
+		id,
+		type,
+		video_id,
+		payload,
+		status,
+		max_attempts,
+		run_after,
+		trace_parent,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err = c.db.Exec(ctx, query, id, params.Type, params.VideoID, string(payload), JobStatusPending, params.MaxAttempts, formatTimestamp(time.Now()), tracing.TraceParent(ctx))
+	if err != nil {
+		return Job{}, err
+	}
+	return c.GetJob(ctx, id)
+}
+
+func (c Client) GetJob(ctx context.Context, id uuid.UUID) (Job, error) {
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs
+	WHERE id = ?
+	`
+	job, err := scanJob(c.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// GetLatestVideoJob returns the newest job of a type for a video, or a zero
+// Job if there's none.
+func (c Client) GetLatestVideoJob(ctx context.Context, videoID uuid.UUID, jobType string) (Job, error) {
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs
+	WHERE video_id = ? AND type = ?
+	ORDER BY created_at DESC
+	LIMIT 1
+	`
+	job, err := scanJob(c.db.QueryRow(ctx, query, videoID, jobType))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// ListJobs lists jobs newest first, optionally filtered by status.
+func (c Client) ListJobs(ctx context.Context, status JobStatus, limit, offset int) ([]Job, error) {
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs
+	WHERE ? = '' OR status = ?
+	ORDER BY created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, status, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// CountJobsByStatus returns how many jobs are in each status.
+func (c Client) CountJobsByStatus(ctx context.Context) (map[JobStatus]int, error) {
+	rows, err := c.db.Query(ctx, "SELECT status, COUNT(*) FROM jobs GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[JobStatus]int{}
+	for rows.Next() {
+		var status JobStatus
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// CountUnfinishedJobs returns how many jobs of a type are pending or
+// running.
+func (c Client) CountUnfinishedJobs(ctx context.Context, jobType string) (int, error) {
+	var n int
+	err := c.db.QueryRow(ctx, "SELECT COUNT(*) FROM jobs WHERE type = ? AND status IN (?, ?)", jobType, JobStatusPending, JobStatusRunning).Scan(&n)
+	return n, err
+}
+
+// JobTypes picks the jobs a worker claims: only those of the listed types,
+// or with Exclude, all but them. The zero value matches every job.
+type JobTypes struct {
+	Types   []string
+	Exclude bool
+}
+
+// condition is the SQL condition and arguments matching types.
+func (t JobTypes) condition() (string, []any) {
+	if len(t.Types) == 0 {
+		return "TRUE", nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(t.Types)), ", ")
+	args := make([]any, len(t.Types))
+	for i, jobType := range t.Types {
+		args[i] = jobType
+	}
+	if t.Exclude {
+		return "type NOT IN (" + placeholders + ")", args
+	}
+	return "type IN (" + placeholders + ")", args
+}
+
+// ClaimJob takes the oldest runnable job of types, marks it running, and
+// leases it to the caller until lease elapses. It returns a zero Job when
+// there is nothing to run.
+func (c Client) ClaimJob(ctx context.Context, lease time.Duration, types JobTypes) (Job, error) {
+	typeCondition, typeArgs := types.condition()
+	for {
+		now := formatTimestamp(time.Now())
+		var id uuid.UUID
+		query := `
+		SELECT id
+		FROM jobs
+		WHERE ((status = ? AND run_after <= ?) OR (status = ? AND locked_until < ?)) AND ` + typeCondition + `
+		ORDER BY run_after
+		LIMIT 1
+		`
+		args := append([]any{JobStatusPending, now, JobStatusRunning, now}, typeArgs...)
+		err := c.db.QueryRow(ctx, query, args...).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		if err != nil {
+			return Job{}, err
+		}
+
+		// Another worker may claim the same job between the SELECT and the
+		// UPDATE; only one UPDATE matches, and the loser tries again.
+		query = `
+		UPDATE jobs
+		SET status = ?, attempts = attempts + 1, started_at = ?, locked_until = ?, finished_at = NULL
+		WHERE id = ? AND ((status = ? AND run_after <= ?) OR (status = ? AND locked_until < ?))
+		`
+		result, err := c.db.Exec(ctx, query,
+			JobStatusRunning, now, formatTimestamp(time.Now().Add(lease)),
+			id, JobStatusPending, now, JobStatusRunning, now,
+		)
+		if err != nil {
+			return Job{}, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return Job{}, err
+		}
+		if n == 1 {
+			return c.GetJob(ctx, id)
+		}
+	}
+}
+
+// ExtendJobLease renews the lease on a running job until lease from now,
+// for a worker that's still working on it. attempt is the job's attempt
+// count when the worker claimed it, which tells its claim apart from a
+// later one. It reports false if that claim is gone: the job was
+// cancelled, or its lease ran out and another worker claimed it.
+func (c Client) ExtendJobLease(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) (bool, error) {
+	query := `
+	UPDATE jobs
+	SET locked_until = ?
+	WHERE id = ? AND status = ? AND attempts = ?
+	`
+	result, err := c.db.Exec(ctx, query, formatTimestamp(time.Now().Add(lease)), id, JobStatusRunning, attempt)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// CompleteJob marks a running job as succeeded.
+func (c Client) CompleteJob(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE jobs
+	SET status = ?, error = NULL, diagnostics = NULL, locked_until = NULL, finished_at = ?
+	WHERE id = ? AND status = ?
+	`
+	_, err := c.db.Exec(ctx, query, JobStatusSucceeded, formatTimestamp(time.Now()), id, JobStatusRunning)
+	return err
+}
+
+// ReleaseJob puts a running job back in the queue to run at runAfter
+// without counting the attempt, for a job interrupted by the server
+// shutting down or held up by a dependency that's down.
+func (c Client) ReleaseJob(ctx context.Context, id uuid.UUID, runAfter time.Time) error {
+	query := `
+	UPDATE jobs
+	SET status = ?, attempts = attempts - 1, run_after = ?, locked_until = NULL
+	WHERE id = ? AND status = ?
+	`
+	_, err := c.db.Exec(ctx, query, JobStatusPending, formatTimestamp(runAfter), id, JobStatusRunning)
+	return err
+}
+
+// FailJob records a failed run and its diagnostics. The job goes back to
+// pending until retryAt if it has attempts left, and is otherwise
+// dead-lettered. It reports whether the job will be retried.
+func (c Client) FailJob(ctx context.Context, id uuid.UUID, runErr, diagnostics string, retryAt time.Time) (retrying bool, err error) {
+	job, err := c.GetJob(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if job.Status != JobStatusRunning {
+		return false, nil
+	}
+
+	if job.Attempts < job.MaxAttempts {
+		query := `
+		UPDATE jobs
+		SET status = ?, error = ?, diagnostics = ?, run_after = ?, locked_until = NULL
+		WHERE id = ? AND status = ?
+		`
+		_, err = c.db.Exec(ctx, query, JobStatusPending, runErr, diagnostics, formatTimestamp(retryAt), id, JobStatusRunning)
+		return err == nil, err
+	}
+
+	query := `
+	UPDATE jobs
+	SET status = ?, error = ?, diagnostics = ?, locked_until = NULL, finished_at = ?
+	WHERE id = ? AND status = ?
+	`
+	_, err = c.db.Exec(ctx, query, JobStatusDead, runErr, diagnostics, formatTimestamp(time.Now()), id, JobStatusRunning)
+	return false, err
+}
+
+// RetryJob puts a dead or cancelled job back in the queue with its
+// attempts reset. It reports false if the job isn't dead or cancelled.
+func (c Client) RetryJob(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE jobs
+	SET status = ?, attempts = 0, error = NULL, diagnostics = NULL, run_after = ?, locked_until = NULL, started_at = NULL, finished_at = NULL
+	WHERE id = ? AND status IN (?, ?)
+	`
+	result, err := c.db.Exec(ctx, query, JobStatusPending, formatTimestamp(time.Now()), id, JobStatusDead, JobStatusCancelled)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// CancelJob marks a pending or running job cancelled. A worker running it
+// notices on its next check and stops. It reports false if the job had
+// already finished.
+func (c Client) CancelJob(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE jobs
+	SET status = ?, locked_until = NULL, finished_at = ?
+	WHERE id = ? AND status IN (?, ?)
+	`
+	result, err := c.db.Exec(ctx, query, JobStatusCancelled, formatTimestamp(time.Now()), id, JobStatusPending, JobStatusRunning)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func createTestJob(t *testing.T, c Client, maxAttempts int) Job {
+	t.Helper()
+	job, err := c.CreateJob(context.Background(), CreateJobParams{Type: "test", Payload: map[string]string{}, MaxAttempts: maxAttempts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func claimTestJob(t *testing.T, c Client, lease time.Duration) Job {
+	t.Helper()
+	job, err := c.ClaimJob(context.Background(), lease, JobTypes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestJobRetriesThenDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	created := createTestJob(t, c, 2)
+
+	job := claimTestJob(t, c, time.Minute)
+	if job.ID != created.ID || job.Status != JobStatusRunning || job.Attempts != 1 {
+		t.Fatalf("claimed %+v, want job %s running on attempt 1", job, created.ID)
+	}
+	if again := claimTestJob(t, c, time.Minute); again.ID == job.ID {
+		t.Fatal("a leased job was claimed twice")
+	}
+
+	retrying, err := c.FailJob(ctx, job.ID, "boom", "{}", time.Now().Add(-time.Second))
+	if err != nil || !retrying {
+		t.Fatalf("FailJob = %v, %v; want a retry", retrying, err)
+	}
+	job = claimTestJob(t, c, time.Minute)
+	if job.ID != created.ID || job.Attempts != 2 {
+		t.Fatalf("claimed %+v, want job %s on attempt 2", job, created.ID)
+	}
+	retrying, err = c.FailJob(ctx, job.ID, "boom again", "{}", time.Now())
+	if err != nil || retrying {
+		t.Fatalf("FailJob = %v, %v; want the job dead-lettered", retrying, err)
+	}
+	job, err = c.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusDead || job.Error == nil || *job.Error != "boom again" {
+		t.Fatalf("job = %+v, want dead with the last error", job)
+	}
+
+	ok, err := c.RetryJob(ctx, job.ID)
+	if err != nil || !ok {
+		t.Fatalf("RetryJob = %v, %v", ok, err)
+	}
+	job = claimTestJob(t, c, time.Minute)
+	if job.ID != created.ID || job.Attempts != 1 {
+		t.Fatalf("claimed %+v, want job %s on attempt 1 after a retry", job, created.ID)
+	}
+	if err := c.CompleteJob(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.RetryJob(ctx, job.ID); err != nil || ok {
+		t.Errorf("RetryJob of a succeeded job = %v, %v; want false", ok, err)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	job := createTestJob(t, c, 3)
+	job = claimTestJob(t, c, time.Minute)
+
+	ok, err := c.CancelJob(ctx, job.ID)
+	if err != nil || !ok {
+		t.Fatalf("CancelJob = %v, %v", ok, err)
+	}
+	if renewed, err := c.ExtendJobLease(ctx, job.ID, job.Attempts, time.Minute); err != nil || renewed {
+		t.Errorf("ExtendJobLease of a cancelled job = %v, %v; want false", renewed, err)
+	}
+	// The worker notices the cancellation and stops; nothing it records
+	// afterwards brings the job back.
+	if _, err := c.FailJob(ctx, job.ID, "killed", "{}", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if job, err = c.GetJob(ctx, job.ID); err != nil || job.Status != JobStatusCancelled {
+		t.Fatalf("job = %+v, %v; want cancelled", job, err)
+	}
+	if ok, err := c.CancelJob(ctx, job.ID); err != nil || ok {
+		t.Errorf("CancelJob of a cancelled job = %v, %v; want false", ok, err)
+	}
+	if ok, err := c.RetryJob(ctx, job.ID); err != nil || !ok {
+		t.Errorf("RetryJob of a cancelled job = %v, %v; want true", ok, err)
+	}
+}
+
+func TestExtendJobLease(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	createTestJob(t, c, 3)
+	job := claimTestJob(t, c, -time.Second)
+
+	// The lease has run out, so the job is up for grabs until it's
+	// renewed.
+	renewed, err := c.ExtendJobLease(ctx, job.ID, job.Attempts, time.Minute)
+	if err != nil || !renewed {
+		t.Fatalf("ExtendJobLease = %v, %v; want renewed", renewed, err)
+	}
+	if other := claimTestJob(t, c, time.Minute); other.ID == job.ID {
+		t.Fatal("job with a renewed lease was claimed again")
+	}
+
+	// Let it lapse again and have another worker take it over; the first
+	// worker's claim can't be renewed after that.
+	_, err = c.db.Exec(ctx, "UPDATE jobs SET locked_until = ? WHERE id = ?", formatTimestamp(time.Now().Add(-time.Second)), job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reclaimed := claimTestJob(t, c, time.Minute)
+	if reclaimed.ID != job.ID || reclaimed.Attempts != job.Attempts+1 {
+		t.Fatalf("reclaimed %+v, want job %s on attempt %d", reclaimed, job.ID, job.Attempts+1)
+	}
+	if renewed, err := c.ExtendJobLease(ctx, job.ID, job.Attempts, time.Minute); err != nil || renewed {
+		t.Errorf("ExtendJobLease of a reclaimed job = %v, %v; want false", renewed, err)
+	}
+	if renewed, err := c.ExtendJobLease(ctx, job.ID, reclaimed.Attempts, time.Minute); err != nil || !renewed {
+		t.Errorf("ExtendJobLease by the new holder = %v, %v; want renewed", renewed, err)
+	}
+}
+
+func TestClaimJobByType(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	for _, jobType := range []string{"transcode", "webhook"} {
+		_, err := c.CreateJob(ctx, CreateJobParams{Type: jobType, Payload: map[string]string{}, MaxAttempts: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	webhooks := JobTypes{Types: []string{"webhook"}}
+	job, err := c.ClaimJob(ctx, time.Minute, webhooks)
+	if err != nil || job.Type != "webhook" {
+		t.Fatalf("ClaimJob(webhooks) = %+v, %v", job, err)
+	}
+	if job, err := c.ClaimJob(ctx, time.Minute, webhooks); err != nil || job.ID != uuid.Nil {
+		t.Fatalf("ClaimJob(webhooks) again = %+v, %v; want nothing", job, err)
+	}
+	job, err = c.ClaimJob(ctx, time.Minute, JobTypes{Types: webhooks.Types, Exclude: true})
+	if err != nil || job.Type != "transcode" {
+		t.Fatalf("ClaimJob(all but webhooks) = %+v, %v", job, err)
+	}
+}
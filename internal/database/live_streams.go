@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LiveStreamStatus string
+
+const (
+	LiveStreamStatusLive  LiveStreamStatus = "live"
+	LiveStreamStatusEnded LiveStreamStatus = "ended"
+)
+
+// LiveStream is one broadcast from a user's encoder. The video it's
+// published as is live while the stream is.
+type LiveStream struct {
+	ID      uuid.UUID        `json:"id"`
+	UserID  uuid.UUID        `json:"user_id"`
+	VideoID uuid.UUID        `json:"video_id"`
+	Status  LiveStreamStatus `json:"status"`
+	S3Key   string           `json:"-"`
+	// LowLatency streams are packaged as LL-HLS.
+	LowLatency bool       `json:"low_latency"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+}
+
+// StreamKey is a user's stream key, without the key itself, and the
+// settings streams published with it use.
+type StreamKey struct {
+	UserID     uuid.UUID `json:"user_id"`
+	LowLatency bool      `json:"low_latency"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type StartLiveStreamParams struct {
+	UserID  uuid.UUID
+	VideoID uuid.UUID
+	// S3Key is where the stream's playlist is uploaded, and VideoURL where
+	// it's played from.
+	S3Key      string
+	VideoURL   string
+	LowLatency bool
+}
+
+// Only a hash of a stream key is stored; a user has at most one.
+func (c *Client) migrateLiveStreams(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS stream_keys (
+		user_id TEXT PRIMARY KEY,
+		key_hash TEXT UNIQUE NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS live_streams (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		s3_key TEXT NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		ended_at TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_live_streams_user_started ON live_streams(user_id, started_at)")
+	return err
+}
+
+func (c *Client) migrateLiveLowLatency(ctx context.Context) error {
+	if err := c.addColumnIfMissing(ctx, "stream_keys", "low_latency", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	return c.addColumnIfMissing(ctx, "live_streams", "low_latency", "BOOLEAN NOT NULL DEFAULT FALSE")
+}
+
+// SetStreamKey replaces the user's stream key with one hashing to keyHash.
+// The key's settings are kept.
+func (c Client) SetStreamKey(ctx context.Context, userID uuid.UUID, keyHash string) error {
+	query := `
+	INSERT INTO stream_keys (user_id, key_hash, created_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		key_hash = excluded.key_hash,
+		created_at = excluded.created_at
+	`
+	_, err := c.db.Exec(ctx, query, userID, keyHash, time.Now().UTC())
+	return err
+}
+
+// GetStreamKeyByHash returns the stream key hashing to keyHash, or nil if
+// there's none.
+func (c Client) GetStreamKeyByHash(ctx context.Context, keyHash string) (*StreamKey, error) {
+	return c.getStreamKey(ctx, "key_hash = ?", keyHash)
+}
+
+// GetStreamKey returns the user's stream key, or nil if they haven't made
+// one.
+func (c Client) GetStreamKey(ctx context.Context, userID uuid.UUID) (*StreamKey, error) {
+	return c.getStreamKey(ctx, "user_id = ?", userID)
+}
+
+func (c Client) getStreamKey(ctx context.Context, where string, arg any) (*StreamKey, error) {
+	var key StreamKey
+	query := "SELECT user_id, low_latency, created_at FROM stream_keys WHERE " + where
+	err := c.db.QueryRow(ctx, query, arg).Scan(&key.UserID, &key.LowLatency, &key.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// SetStreamKeyLowLatency sets whether streams published with the user's key
+// are packaged as LL-HLS. It returns nil if the user has no key.
+func (c Client) SetStreamKeyLowLatency(ctx context.Context, userID uuid.UUID, lowLatency bool) (*StreamKey, error) {
+	if _, err := c.db.Exec(ctx, "UPDATE stream_keys SET low_latency = ? WHERE user_id = ?", lowLatency, userID); err != nil {
+		return nil, err
+	}
+	return c.GetStreamKey(ctx, userID)
+}
+
+// StartLiveStream records a stream going live and makes its video live,
+// playing from the stream's playlist.
+func (c Client) StartLiveStream(ctx context.Context, params StartLiveStreamParams) (LiveStream, error) {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return LiveStream{}, err
+	}
+	defer tx.Rollback()
+
+	stream := LiveStream{
+		ID:         uuid.New(),
+		UserID:     params.UserID,
+		VideoID:    params.VideoID,
+		Status:     LiveStreamStatusLive,
+		S3Key:      params.S3Key,
+		LowLatency: params.LowLatency,
+		StartedAt:  time.Now().UTC(),
+	}
+	query := `
+	INSERT INTO live_streams (id, user_id, video_id, status, s3_key, low_latency, started_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(query, stream.ID, stream.UserID, stream.VideoID, stream.Status, stream.S3Key, stream.LowLatency, stream.StartedAt)
+	if err != nil {
+		return LiveStream{}, err
+	}
+	query = `
+	UPDATE videos
+	SET video_url = ?, status = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1
+	WHERE id = ?
+	`
+	if _, err := tx.Exec(query, params.VideoURL, VideoStatusLive, params.VideoID); err != nil {
+		return LiveStream{}, err
+	}
+	err = replaceRenditions(tx, params.VideoID, []Rendition{{
+		Quality: RenditionQualityHLS,
+		S3Key:   params.S3Key,
+	}})
+	if err != nil {
+		return LiveStream{}, err
+	}
+	return stream, tx.Commit()
+}
+
+// EndLiveStream records a stream ending. Its video stops playing the
+// stream and takes the given status: processing while its recording is
+// made into a file, or draft if there's none.
+func (c Client) EndLiveStream(ctx context.Context, id uuid.UUID, status VideoStatus) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var videoID uuid.UUID
+	err = tx.QueryRow("SELECT video_id FROM live_streams WHERE id = ? AND status = ?", id, LiveStreamStatusLive).Scan(&videoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE live_streams SET status = ?, ended_at = ? WHERE id = ?", LiveStreamStatusEnded, time.Now().UTC(), id); err != nil {
+		return err
+	}
+	query := `
+	UPDATE videos
+	SET video_url = NULL, status = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1
+	WHERE id = ? AND status = ?
+	`
+	result, err := tx.Exec(query, status, videoID, VideoStatusLive)
+	if err != nil {
+		return err
+	}
+	// Leave a video that's no longer live alone.
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return tx.Commit()
+	}
+	if err := replaceRenditions(tx, videoID, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetLiveStreams returns the streams of a user that are still live.
+func (c Client) GetLiveStreams(ctx context.Context, userID uuid.UUID) ([]LiveStream, error) {
+	query := `
+	SELECT` + liveStreamColumns + `
+	FROM live_streams
+	WHERE user_id = ? AND status = ?
+	ORDER BY started_at
+	`
+	return c.queryLiveStreams(ctx, c.db, query, userID, LiveStreamStatusLive)
+}
+
+// GetLiveStreamByVideo returns the live stream a video is playing, or nil
+// if it isn't live.
+func (c Client) GetLiveStreamByVideo(ctx context.Context, videoID uuid.UUID) (*LiveStream, error) {
+	query := `
+	SELECT` + liveStreamColumns + `
+	FROM live_streams
+	WHERE video_id = ? AND status = ?
+	`
+	streams, err := c.queryLiveStreams(ctx, c.db, query, videoID, LiveStreamStatusLive)
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+	return &streams[0], nil
+}
+
+// ListLiveStreams returns a user's streams, newest first.
+func (c Client) ListLiveStreams(ctx context.Context, userID uuid.UUID, limit, offset int) ([]LiveStream, error) {
+	query := `
+	SELECT` + liveStreamColumns + `
+	FROM live_streams
+	WHERE user_id = ?
+	ORDER BY started_at DESC
+	LIMIT ? OFFSET ?
+	`
+	return c.queryLiveStreams(ctx, c.onReplica().db, query, userID, limit, offset)
+}
+
+const liveStreamColumns = `
+		id,
+		user_id,
+		video_id,
+		status,
+		s3_key,
+		low_latency,
+		started_at,
+		ended_at`
+
+func (c Client) queryLiveStreams(ctx context.Context, db conn, query string, args ...any) ([]LiveStream, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	streams := []LiveStream{}
+	for rows.Next() {
+		var s LiveStream
+		if err := rows.Scan(&s.ID, &s.UserID, &s.VideoID, &s.Status, &s.S3Key, &s.LowLatency, &s.StartedAt, &s.EndedAt); err != nil {
+			return nil, err
+		}
+		streams = append(streams, s)
+	}
+	return streams, rows.Err()
+}
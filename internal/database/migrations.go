@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type migration struct {
+	version int
+	name    string
+	up      func(c *Client, ctx context.Context) error
+}
+
+// migrations lists schema changes in the order they're applied. Append new
+// migrations to the end and never edit or renumber one that has shipped.
+// A migration that fails part way is rerun from the start, so its
+// statements should be safe to repeat.
+var migrations = []migration{
+	{1, "baseline", (*Client).migrateBaseline},
+	{2, "pending_uploads", (*Client).migratePendingUploads},
+	{3, "video_version", (*Client).migrateVideoVersion},
+	{4, "jobs", (*Client).migrateJobs},
+	{5, "renditions", (*Client).migrateRenditions},
+	{6, "listing_indexes", (*Client).migrateListingIndexes},
+	{7, "job_trace_parent", (*Client).migrateJobTraceParent},
+	{8, "feature_flags", (*Client).migrateFeatureFlags},
+	{9, "job_dead_letter", (*Client).migrateJobDeadLetter},
+	{10, "user_quotas", (*Client).migrateUserQuotas},
+	{11, "email_preferences", (*Client).migrateEmailPreferences},
+	{12, "notification_actor", (*Client).migrateNotificationActor},
+	{13, "user_suspension", (*Client).migrateUserSuspension},
+	{14, "moderation_scans", (*Client).migrateModerationScans},
+	{15, "virus_scans", (*Client).migrateVirusScans},
+	{16, "quarantine", (*Client).migrateQuarantine},
+	{17, "rendition_quality", (*Client).migrateRenditionQuality},
+	{18, "backfills", (*Client).migrateBackfills},
+	{19, "hls_keys", (*Client).migrateHLSKeys},
+	{20, "geo_restrictions", (*Client).migrateGeoRestrictions},
+	{21, "delivery", (*Client).migrateDelivery},
+	{22, "live_streams", (*Client).migrateLiveStreams},
+	{23, "live_low_latency", (*Client).migrateLiveLowLatency},
+	{24, "playback_events", (*Client).migratePlaybackEvents},
+	{25, "analytics", (*Client).migrateAnalytics},
+	{26, "storage_discrepancies", (*Client).migrateStorageDiscrepancies},
+	{27, "resumable_uploads", (*Client).migrateResumableUploads},
+	{28, "channel_domains", (*Client).migrateChannelDomains},
+	{29, "embed_settings", (*Client).migrateEmbedSettings},
+	{30, "video_chapters", (*Client).migrateChapters},
+	{31, "rendition_container_profile", (*Client).migrateRenditionContainerProfile},
+	{32, "video_transcript_cues", (*Client).migrateTranscripts},
+	{33, "chapter_suggestions", (*Client).migrateChapterSuggestions},
+	{34, "audio_tracks", (*Client).migrateAudioTracks},
+	{35, "video_projection", (*Client).migrateVideoProjection},
+	{36, "video_hdr", (*Client).migrateVideoHDR},
+	{37, "thumbnail_variants", (*Client).migrateThumbnailVariants},
+	{38, "form_uploads", (*Client).migrateFormUploads},
+	{39, "object_lock_retention", (*Client).migrateObjectLockRetention},
+	{40, "channel_domain_verification", (*Client).migrateChannelDomainVerification},
+	{41, "video_status_backfill", (*Client).migrateVideoStatusBackfill},
+	{42, "transcript_search", (*Client).migrateTranscriptSearch},
+	{43, "form_upload_bucket", (*Client).migrateFormUploadBucket},
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+func (c *Client) ensureMigrationsTable(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	return err
+}
+
+// Migrate applies pending migrations in order and returns the ones it ran.
+func (c *Client) Migrate(ctx context.Context) ([]MigrationStatus, error) {
+	status, err := c.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []MigrationStatus{}
+	for i, m := range migrations {
+		if status[i].AppliedAt != nil {
+			continue
+		}
+		if err := m.up(c, ctx); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		now := time.Now().UTC()
+		_, err := c.db.Exec(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.version, m.name, formatTimestamp(now))
+		if err != nil {
+			return applied, fmt.Errorf("couldn't record migration %d: %w", m.version, err)
+		}
+		applied = append(applied, MigrationStatus{Version: m.version, Name: m.name, AppliedAt: &now})
+	}
+	return applied, nil
+}
+
+// MigrationStatus reports every known migration and when it was applied.
+func (c *Client) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	if err := c.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i] = MigrationStatus{Version: m.version, Name: m.name}
+		if at, ok := appliedAt[m.version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
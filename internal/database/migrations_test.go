@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMigrateVideoStatusBackfill(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	uploaded := createTestVideo(t, c, CreateVideoParams{})
+	draft := createTestVideo(t, c, CreateVideoParams{})
+
+	// Put the database back to how a pre-status upload looked after the
+	// baseline: a video URL but the column's draft default.
+	_, err := c.db.Exec(ctx, "UPDATE videos SET video_url = 'https://cdn.example.com/a.mp4', status = 'draft' WHERE id = ?", uploaded.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.db.Exec(ctx, "DELETE FROM schema_migrations WHERE version = 41")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := c.Migrate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Name != "video_status_backfill" {
+		t.Fatalf("applied = %+v, want only video_status_backfill", applied)
+	}
+
+	for _, tc := range []struct {
+		video Video
+		want  VideoStatus
+	}{{uploaded, VideoStatusReady}, {draft, VideoStatusDraft}} {
+		video, err := c.GetVideo(ctx, tc.video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if video.Status != tc.want {
+			t.Errorf("video %s status = %s, want %s", video.ID, video.Status, tc.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ModerationQueueItem is a video with unresolved reports against it.
+type ModerationQueueItem struct {
+	Video          Video                `json:"video"`
+	OpenReports    int                  `json:"open_reports"`
+	Reasons        map[ReportReason]int `json:"reasons"`
+	LastReportedAt time.Time            `json:"last_reported_at"`
+}
+
+// GetModerationQueue lists videos with unresolved reports, most reported
+// first.
+func (c Client) GetModerationQueue(ctx context.Context, limit, offset int) ([]ModerationQueueItem, error) {
+	query := `
+	SELECT` + videoColumns + `, r.open_reports, r.last_reported_at
+	FROM videos
+	JOIN (
+		SELECT video_id, COUNT(*) AS open_reports, MAX(created_at) AS last_reported_at
+		FROM video_reports
+		WHERE resolved_at IS NULL
+		GROUP BY video_id
+	) r ON r.video_id = videos.id
+	WHERE deleted_at IS NULL
+	ORDER BY r.open_reports DESC, r.last_reported_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ModerationQueueItem{}
+	for rows.Next() {
+		var item ModerationQueueItem
+		var lastReportedAt any
+		item.Video, err = scanVideo(trailingScanner{rows, []any{&item.OpenReports, &lastReportedAt}})
+		if err != nil {
+			return nil, err
+		}
+		// MAX() loses the column's declared type in SQLite, so the driver
+		// returns text there.
+		item.LastReportedAt = scanTimestamp(lastReportedAt)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range items {
+		items[i].Reasons, err = c.getOpenReportReasons(ctx, items[i].Video.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (c Client) getOpenReportReasons(ctx context.Context, videoID uuid.UUID) (map[ReportReason]int, error) {
+	query := `
+	SELECT reason, COUNT(*)
+	FROM video_reports
+	WHERE video_id = ? AND resolved_at IS NULL
+	GROUP BY reason
+	`
+	rows, err := c.db.Query(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reasons := map[ReportReason]int{}
+	for rows.Next() {
+		var reason ReportReason
+		var n int
+		if err := rows.Scan(&reason, &n); err != nil {
+			return nil, err
+		}
+		reasons[reason] = n
+	}
+	return reasons, rows.Err()
+}
+
+// ResolveVideoReports closes every open report against a video.
+func (c Client) ResolveVideoReports(ctx context.Context, videoID uuid.UUID, resolution string) error {
+	query := `
+	UPDATE video_reports
+	SET resolved_at = CURRENT_TIMESTAMP, resolution = ?
+	WHERE video_id = ? AND resolved_at IS NULL
+	`
+	_, err := c.db.Exec(ctx, query, resolution, videoID)
+	return err
+}
+
+// TakeDownVideo hides a video from everyone but its owner and channel by
+// making it private and marking it taken down, which stops its visibility
+// from being changed back.
+func (c Client) TakeDownVideo(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET taken_down_at = ?, visibility = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND taken_down_at IS NULL
+	`
+	_, err := c.db.Exec(ctx, query, time.Now().UTC(), VisibilityPrivate, id)
+	return err
+}
+
+// TakeDownUserVideos takes down every video a user owns.
+func (c Client) TakeDownUserVideos(ctx context.Context, userID uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET taken_down_at = ?, visibility = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = ? AND taken_down_at IS NULL
+	`
+	_, err := c.db.Exec(ctx, query, time.Now().UTC(), VisibilityPrivate, userID)
+	return err
+}
+
+func (c Client) IsUserAdmin(ctx context.Context, id uuid.UUID) (bool, error) {
+	var isAdmin bool
+	err := c.db.QueryRow(ctx, "SELECT is_admin FROM users WHERE id = ?", id.String()).Scan(&isAdmin)
+	if err != nil {
+		return false, err
+	}
+	return isAdmin, nil
+}
+
+// BanUser marks a user as banned and revokes their refresh tokens so they
+// can't obtain new access tokens.
+func (c Client) BanUser(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET banned_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND banned_at IS NULL", time.Now().UTC(), id.String())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL", id.String())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) IsUserBanned(ctx context.Context, id uuid.UUID) (bool, error) {
+	var bannedAt *time.Time
+	err := c.db.QueryRow(ctx, "SELECT banned_at FROM users WHERE id = ?", id.String()).Scan(&bannedAt)
+	if err != nil {
+		return false, err
+	}
+	return bannedAt != nil, nil
+}
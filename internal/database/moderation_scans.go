@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ModerationVerdict is what automated content scanning decided about a
+// video.
+type ModerationVerdict string
+
+const (
+	ModerationVerdictClean       ModerationVerdict = "clean"
+	ModerationVerdictFlagged     ModerationVerdict = "flagged"
+	ModerationVerdictQuarantined ModerationVerdict = "quarantined"
+)
+
+func (v ModerationVerdict) Valid() bool {
+	switch v {
+	case ModerationVerdictClean, ModerationVerdictFlagged, ModerationVerdictQuarantined:
+		return true
+	}
+	return false
+}
+
+// ModerationScan is the result of the latest automated scan of a video.
+// Label and Score are the highest scoring label the policy acts on.
+type ModerationScan struct {
+	VideoID   uuid.UUID          `json:"video_id"`
+	Verdict   ModerationVerdict  `json:"verdict"`
+	Label     string             `json:"label"`
+	Score     float64            `json:"score"`
+	Scores    map[string]float64 `json:"scores"`
+	ScannedAt time.Time          `json:"scanned_at"`
+}
+
+func (c *Client) migrateModerationScans(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS moderation_scans (
+		video_id TEXT PRIMARY KEY,
+		verdict TEXT NOT NULL,
+		label TEXT NOT NULL DEFAULT '',
+		score REAL NOT NULL DEFAULT 0,
+		scores TEXT NOT NULL DEFAULT '{}',
+		scanned_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_moderation_scans_verdict ON moderation_scans(verdict, scanned_at)")
+	return err
+}
+
+// SaveModerationScan records a scan, replacing any earlier one of the same
+// video.
+func (c Client) SaveModerationScan(ctx context.Context, scan ModerationScan) error {
+	scores, err := json.Marshal(scan.Scores)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO moderation_scans (
+		video_id,
+		verdict,
+		label,
+		score,
+		scores,
+		scanned_at
+	) VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(video_id) DO UPDATE SET
+		verdict = excluded.verdict,
+		label = excluded.label,
+		score = excluded.score,
+		scores = excluded.scores,
+		scanned_at = excluded.scanned_at
+	`
+	_, err = c.db.Exec(ctx, query, scan.VideoID, scan.Verdict, scan.Label, scan.Score, string(scores), scan.ScannedAt)
+	return err
+}
+
+func scanModerationScan(row rowScanner) (ModerationScan, error) {
+	var scan ModerationScan
+	var scores string
+	err := row.Scan(&scan.VideoID, &scan.Verdict, &scan.Label, &scan.Score, &scores, &scan.ScannedAt)
+	if err != nil {
+		return ModerationScan{}, err
+	}
+	if err := json.Unmarshal([]byte(scores), &scan.Scores); err != nil {
+		return ModerationScan{}, err
+	}
+	return scan, nil
+}
+
+// GetModerationScan returns nil if the video hasn't been scanned.
+func (c Client) GetModerationScan(ctx context.Context, videoID uuid.UUID) (*ModerationScan, error) {
+	scan, err := scanModerationScan(c.db.QueryRow(ctx, "SELECT video_id, verdict, label, score, scores, scanned_at FROM moderation_scans WHERE video_id = ?", videoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &scan, nil
+}
+
+// GetModerationScans lists scans with a verdict, newest first.
+func (c Client) GetModerationScans(ctx context.Context, verdict ModerationVerdict, limit, offset int) ([]ModerationScan, error) {
+	query := `
+	SELECT video_id, verdict, label, score, scores, scanned_at
+	FROM moderation_scans
+	WHERE verdict = ?
+	ORDER BY scanned_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, verdict, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scans := []ModerationScan{}
+	for rows.Next() {
+		scan, err := scanModerationScan(rows)
+		if err != nil {
+			return nil, err
+		}
+		scans = append(scans, scan)
+	}
+	return scans, rows.Err()
+}
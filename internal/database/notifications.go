@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type NotificationType string
+
+const (
+	// NotificationNewUpload tells a subscriber that a creator or channel
+	// they follow published a video.
+	NotificationNewUpload NotificationType = "new_upload"
+	// NotificationProcessingFinished tells a creator their upload is ready.
+	NotificationProcessingFinished NotificationType = "processing_finished"
+	// NotificationProcessingFailed tells a creator their upload couldn't be
+	// processed.
+	NotificationProcessingFailed NotificationType = "processing_failed"
+	// NotificationNewSubscriber tells a creator, or a channel's owners, that
+	// the actor subscribed to them.
+	NotificationNewSubscriber NotificationType = "new_subscriber"
+)
+
+type Notification struct {
+	ID        uuid.UUID        `json:"id"`
+	UserID    uuid.UUID        `json:"user_id"`
+	Type      NotificationType `json:"type"`
+	VideoID   *uuid.UUID       `json:"video_id"`
+	ActorID   *uuid.UUID       `json:"actor_id"`
+	CreatedAt time.Time        `json:"created_at"`
+	ReadAt    *time.Time       `json:"read_at"`
+}
+
+type CreateNotificationParams struct {
+	UserID  uuid.UUID
+	Type    NotificationType
+	VideoID *uuid.UUID
+	ActorID *uuid.UUID
+}
+
+func (c *Client) migrateNotificationActor(ctx context.Context) error {
+	return c.addColumnIfMissing(ctx, "notifications", "actor_id", "TEXT")
+}
+
+// CreateNotification stores a notification unless the user already has one
+// of the same type for the video. It returns the new notification, or nil
+// if it was a duplicate.
+func (c Client) CreateNotification(ctx context.Context, params CreateNotificationParams) (*Notification, error) {
+	n := Notification{
+		ID:        uuid.New(),
+		UserID:    params.UserID,
+		Type:      params.Type,
+		VideoID:   params.VideoID,
+		ActorID:   params.ActorID,
+		CreatedAt: time.Now().UTC(),
+	}
+	query := `
+	INSERT INTO notifications (
+		id,
+		user_id,
+		type,
+		video_id,
+		actor_id,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT DO NOTHING
+	`
+	result, err := c.db.Exec(ctx, query, n.ID, n.UserID, n.Type, n.VideoID, n.ActorID, n.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func (c Client) GetNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit, offset int) ([]Notification, error) {
+	query := `
+	SELECT
+		id,
+		user_id,
+		type,
+		video_id,
+		actor_id,
+		created_at,
+		read_at
+	FROM notifications
+	WHERE user_id = ? AND (? = FALSE OR read_at IS NULL)
+	ORDER BY created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.Type,
+			&n.VideoID,
+			&n.ActorID,
+			&n.CreatedAt,
+			&n.ReadAt,
+		); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (c Client) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := c.db.QueryRow(ctx, "SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead marks one of a user's notifications read. It reports
+// false if the user has no such notification.
+func (c Client) MarkNotificationRead(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE notifications
+	SET read_at = COALESCE(read_at, ?)
+	WHERE id = ? AND user_id = ?
+	`
+	result, err := c.db.Exec(ctx, query, time.Now().UTC(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// MarkAllNotificationsRead marks every unread notification of a user read
+// and returns how many there were.
+func (c Client) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := c.db.Exec(ctx, "UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL", time.Now().UTC(), userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PendingUpload records an object that is being written to S3 for a video
+// but isn't referenced by the video yet. The row is removed in the same
+// transaction that points the video at the object, so any row that outlives
+// its upload marks an object that may be orphaned.
+type PendingUpload struct {
+	ID        uuid.UUID `json:"id"`
+	VideoID   uuid.UUID `json:"video_id"`
+	S3Key     string    `json:"s3_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c *Client) migratePendingUploads(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS pending_uploads (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		s3_key TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_pending_uploads_created ON pending_uploads(created_at)")
+	return err
+}
+
+func (c Client) CreatePendingUpload(ctx context.Context, videoID uuid.UUID, s3Key string) (PendingUpload, error) {
+	upload := PendingUpload{
+		ID:        uuid.New(),
+		VideoID:   videoID,
+		S3Key:     s3Key,
+		CreatedAt: time.Now().UTC(),
+	}
+	query := `
+	INSERT INTO pending_uploads (
+		id,
+		video_id,
+		s3_key,
+		created_at
+	) VALUES (?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(ctx, query, upload.ID, upload.VideoID, upload.S3Key, formatTimestamp(upload.CreatedAt))
+	if err != nil {
+		return PendingUpload{}, err
+	}
+	return upload, nil
+}
+
+func (c Client) DeletePendingUpload(ctx context.Context, id uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM pending_uploads WHERE id = ?", id)
+	return err
+}
+
+// GetPendingUploadsBefore lists pending uploads started before cutoff.
+func (c Client) GetPendingUploadsBefore(ctx context.Context, cutoff time.Time) ([]PendingUpload, error) {
+	query := `
+	SELECT
+		id,
+		video_id,
+		s3_key,
+		created_at
+	FROM pending_uploads
+	WHERE created_at < ?
+	ORDER BY created_at
+	`
+	rows, err := c.db.Query(ctx, query, formatTimestamp(cutoff))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []PendingUpload{}
+	for rows.Next() {
+		var upload PendingUpload
+		if err := rows.Scan(
+			&upload.ID,
+			&upload.VideoID,
+			&upload.S3Key,
+			&upload.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+// FinalizeVideoUpload points the video at its uploaded object, replaces its
+// renditions and audio tracks, and clears the pending upload in one
+// transaction. Only the file-related columns are
+// written, so metadata edits made while the upload was in progress are kept.
+func (c Client) FinalizeVideoUpload(ctx context.Context, video Video, pendingID uuid.UUID, renditions []Rendition, audioTracks []AudioTrack) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE videos
+	SET
+		video_url = ?,
+		duration_seconds = ?,
+		width = ?,
+		height = ?,
+		frame_rate = ?,
+		size_bytes = ?,
+		projection = ?,
+		hdr = ?,
+		aspect = ?,
+		status = ?,
+		retain_until = ?,
+		updated_at = CURRENT_TIMESTAMP,
+		version = version + 1
+	WHERE id = ?
+	`
+	result, err := tx.Exec(query,
+		video.VideoURL,
+		video.DurationSeconds,
+		video.Width,
+		video.Height,
+		video.FrameRate,
+		video.SizeBytes,
+		video.Projection,
+		video.HDR,
+		video.Aspect,
+		video.Status,
+		video.RetainUntil,
+		video.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := checkVideoUpdated(result); err != nil {
+		return err
+	}
+	if err := replaceRenditions(tx, video.ID, renditions); err != nil {
+		return err
+	}
+	if err := replaceAudioTracks(tx, video.ID, audioTracks); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM pending_uploads WHERE id = ?", pendingID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
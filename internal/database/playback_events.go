@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PlaybackEventType is something a viewer's player did.
+type PlaybackEventType string
+
+const (
+	PlaybackEventPlay          PlaybackEventType = "play"
+	PlaybackEventPause         PlaybackEventType = "pause"
+	PlaybackEventSeek          PlaybackEventType = "seek"
+	PlaybackEventQualitySwitch PlaybackEventType = "quality_switch"
+	PlaybackEventBuffer        PlaybackEventType = "buffer"
+)
+
+// PlaybackEvent is one event reported by a player. SessionID groups the
+// events of one playback; it's chosen by the player and isn't tied to a
+// user. FromSeconds is where a seek started, Quality the rendition
+// switched to, and DurationMS how long the player buffered.
+type PlaybackEvent struct {
+	VideoID         uuid.UUID         `json:"video_id"`
+	SessionID       string            `json:"session_id"`
+	Type            PlaybackEventType `json:"type"`
+	PositionSeconds float64           `json:"position_seconds"`
+	FromSeconds     *float64          `json:"from_seconds,omitempty"`
+	Quality         *string           `json:"quality,omitempty"`
+	DurationMS      *int              `json:"duration_ms,omitempty"`
+	OccurredAt      time.Time         `json:"occurred_at"`
+}
+
+// Events are appended in batches and only ever read in bulk by time, so
+// the table has no key of its own.
+func (c *Client) migratePlaybackEvents(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS playback_events (
+		video_id TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		position_seconds REAL NOT NULL,
+		from_seconds REAL,
+		quality TEXT,
+		duration_ms INTEGER,
+		occurred_at TIMESTAMP NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_playback_events_video_occurred ON playback_events(video_id, occurred_at)")
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_playback_events_occurred ON playback_events(occurred_at)")
+	return err
+}
+
+// RecordPlaybackEvents stores a batch of events with a single insert.
+func (c Client) RecordPlaybackEvents(ctx context.Context, events []PlaybackEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	rows := make([]string, len(events))
+	args := make([]any, 0, len(events)*8)
+	for i, e := range events {
+		rows[i] = "(?, ?, ?, ?, ?, ?, ?, ?)"
+		args = append(args, e.VideoID, e.SessionID, e.Type, e.PositionSeconds, e.FromSeconds, e.Quality, e.DurationMS, formatTimestamp(e.OccurredAt))
+	}
+	query := `
+	INSERT INTO playback_events (
+		video_id,
+		session_id,
+		type,
+		position_seconds,
+		from_seconds,
+		quality,
+		duration_ms,
+		occurred_at
+	) VALUES ` + strings.Join(rows, ", ")
+	_, err := c.db.Exec(ctx, query, args...)
+	return err
+}
+
+// DeletePlaybackEventsBefore prunes events older than the retention period.
+func (c Client) DeletePlaybackEventsBefore(ctx context.Context, cutoff time.Time) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM playback_events WHERE occurred_at < ?", formatTimestamp(cutoff))
+	return err
+}
+
+// GetPlaybackEventsSince returns every event since a time, grouped by
+// video and session and in the order they happened.
+func (c Client) GetPlaybackEventsSince(ctx context.Context, since time.Time) ([]PlaybackEvent, error) {
+	query := `
+	SELECT
+		video_id,
+		session_id,
+		type,
+		position_seconds,
+		from_seconds,
+		quality,
+		duration_ms,
+		occurred_at
+	FROM playback_events
+	WHERE occurred_at >= ?
+	ORDER BY video_id, session_id, occurred_at
+	`
+	rows, err := c.db.Query(ctx, query, formatTimestamp(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []PlaybackEvent{}
+	for rows.Next() {
+		var e PlaybackEvent
+		err := rows.Scan(
+			&e.VideoID,
+			&e.SessionID,
+			&e.Type,
+			&e.PositionSeconds,
+			&e.FromSeconds,
+			&e.Quality,
+			&e.DurationMS,
+			&e.OccurredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
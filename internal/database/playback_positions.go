@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PlaybackPosition struct {
+	VideoID         uuid.UUID `json:"video_id"`
+	PositionSeconds float64   `json:"position_seconds"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// SetPlaybackPosition stores where a user stopped watching a video,
+// replacing any earlier position.
+func (c Client) SetPlaybackPosition(ctx context.Context, userID, videoID uuid.UUID, positionSeconds float64) (PlaybackPosition, error) {
+	position := PlaybackPosition{
+		VideoID:         videoID,
+		PositionSeconds: positionSeconds,
+		UpdatedAt:       time.Now().UTC(),
+	}
+	query := `
+	INSERT INTO playback_positions (
+		user_id,
+		video_id,
+		position_seconds,
+		updated_at
+	) VALUES (?, ?, ?, ?)
+	ON CONFLICT(user_id, video_id) DO UPDATE SET
+		position_seconds = excluded.position_seconds,
+		updated_at = excluded.updated_at
+	`
+	_, err := c.db.Exec(ctx, query, userID, videoID, position.PositionSeconds, position.UpdatedAt)
+	if err != nil {
+		return PlaybackPosition{}, err
+	}
+	return position, nil
+}
+
+// GetPlaybackPosition returns a user's saved position in a video, or nil if
+// they haven't started it.
+func (c Client) GetPlaybackPosition(ctx context.Context, userID, videoID uuid.UUID) (*PlaybackPosition, error) {
+	query := `
+	SELECT
+		video_id,
+		position_seconds,
+		updated_at
+	FROM playback_positions
+	WHERE user_id = ? AND video_id = ?
+	`
+	var position PlaybackPosition
+	err := c.db.QueryRow(ctx, query, userID, videoID).Scan(
+		&position.VideoID,
+		&position.PositionSeconds,
+		&position.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &position, nil
+}
+
+func (c Client) DeletePlaybackPosition(ctx context.Context, userID, videoID uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM playback_positions WHERE user_id = ? AND video_id = ?", userID, videoID)
+	return err
+}
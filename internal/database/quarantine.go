@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type QuarantineStatus string
+
+const (
+	// QuarantinePending objects are waiting for an admin to review them.
+	QuarantinePending QuarantineStatus = "pending"
+	// QuarantineReleased objects were moved back to their original key.
+	QuarantineReleased QuarantineStatus = "released"
+	// QuarantineRejected objects were deleted.
+	QuarantineRejected QuarantineStatus = "rejected"
+)
+
+func (s QuarantineStatus) Valid() bool {
+	switch s {
+	case QuarantinePending, QuarantineReleased, QuarantineRejected:
+		return true
+	}
+	return false
+}
+
+// QuarantinedObject is a video file that was moved out of the serving path
+// because it was flagged. OriginalKey is where it goes back to if released.
+type QuarantinedObject struct {
+	VideoID            uuid.UUID        `json:"video_id"`
+	Bucket             string           `json:"bucket"`
+	Key                string           `json:"key"`
+	OriginalKey        string           `json:"original_key"`
+	Reason             string           `json:"reason"`
+	PreviousVisibility Visibility       `json:"previous_visibility"`
+	Status             QuarantineStatus `json:"status"`
+	CreatedAt          time.Time        `json:"created_at"`
+	ReviewedBy         *uuid.UUID       `json:"reviewed_by"`
+	ReviewedAt         *time.Time       `json:"reviewed_at"`
+}
+
+type QuarantineObjectParams struct {
+	VideoID            uuid.UUID
+	Bucket             string
+	Key                string
+	OriginalKey        string
+	Reason             string
+	PreviousVisibility Visibility
+}
+
+func (c *Client) migrateQuarantine(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS quarantined_objects (
+		video_id TEXT PRIMARY KEY,
+		bucket TEXT NOT NULL,
+		s3_key TEXT NOT NULL,
+		original_key TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		previous_visibility TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		reviewed_by TEXT,
+		reviewed_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_quarantined_objects_status ON quarantined_objects(status, created_at)")
+	return err
+}
+
+const quarantinedObjectColumns = `
+		video_id,
+		bucket,
+		s3_key,
+		original_key,
+		reason,
+		previous_visibility,
+		status,
+		created_at,
+		reviewed_by,
+		reviewed_at`
+
+func scanQuarantinedObject(row rowScanner) (QuarantinedObject, error) {
+	var q QuarantinedObject
+	err := row.Scan(
+		&q.VideoID,
+		&q.Bucket,
+		&q.Key,
+		&q.OriginalKey,
+		&q.Reason,
+		&q.PreviousVisibility,
+		&q.Status,
+		&q.CreatedAt,
+		&q.ReviewedBy,
+		&q.ReviewedAt,
+	)
+	if err != nil {
+		return QuarantinedObject{}, err
+	}
+	return q, nil
+}
+
+// QuarantineObject records that a video's file was moved to quarantine,
+// replacing any earlier record for the video.
+func (c Client) QuarantineObject(ctx context.Context, params QuarantineObjectParams) (QuarantinedObject, error) {
+	q := QuarantinedObject{
+		VideoID:            params.VideoID,
+		Bucket:             params.Bucket,
+		Key:                params.Key,
+		OriginalKey:        params.OriginalKey,
+		Reason:             params.Reason,
+		PreviousVisibility: params.PreviousVisibility,
+		Status:             QuarantinePending,
+		CreatedAt:          time.Now().UTC(),
+	}
+	query := `
+	INSERT INTO quarantined_objects (
+		video_id,
+		bucket,
+		s3_key,
+		original_key,
+		reason,
+		previous_visibility,
+		status,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(video_id) DO UPDATE SET
+		bucket = excluded.bucket,
+		s3_key = excluded.s3_key,
+		original_key = excluded.original_key,
+		reason = excluded.reason,
+		previous_visibility = excluded.previous_visibility,
+		status = excluded.status,
+		created_at = excluded.created_at,
+		reviewed_by = NULL,
+		reviewed_at = NULL
+	`
+	_, err := c.db.Exec(ctx, query, q.VideoID, q.Bucket, q.Key, q.OriginalKey, q.Reason, q.PreviousVisibility, q.Status, q.CreatedAt)
+	if err != nil {
+		return QuarantinedObject{}, err
+	}
+	return q, nil
+}
+
+// GetQuarantinedObject returns nil if the video's file was never
+// quarantined.
+func (c Client) GetQuarantinedObject(ctx context.Context, videoID uuid.UUID) (*QuarantinedObject, error) {
+	q, err := scanQuarantinedObject(c.db.QueryRow(ctx, "SELECT"+quarantinedObjectColumns+" FROM quarantined_objects WHERE video_id = ?", videoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// ListQuarantinedObjects lists quarantined files with a status, oldest
+// first so the review queue is worked in order.
+func (c Client) ListQuarantinedObjects(ctx context.Context, status QuarantineStatus, limit, offset int) ([]QuarantinedObject, error) {
+	query := `
+	SELECT` + quarantinedObjectColumns + `
+	FROM quarantined_objects
+	WHERE status = ?
+	ORDER BY created_at ASC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []QuarantinedObject{}
+	for rows.Next() {
+		q, err := scanQuarantinedObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, q)
+	}
+	return objects, rows.Err()
+}
+
+// ReleaseQuarantinedObject marks a video's file released and lifts the
+// takedown, restoring the visibility it had before it was quarantined. The
+// caller moves the file back first.
+func (c Client) ReleaseQuarantinedObject(ctx context.Context, videoID, reviewerID uuid.UUID) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var visibility Visibility
+	err = tx.QueryRow("SELECT previous_visibility FROM quarantined_objects WHERE video_id = ?", videoID).Scan(&visibility)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE quarantined_objects SET status = ?, reviewed_by = ?, reviewed_at = ? WHERE video_id = ?", QuarantineReleased, reviewerID, time.Now().UTC(), videoID)
+	if err != nil {
+		return err
+	}
+	query := `
+	UPDATE videos
+	SET taken_down_at = NULL, visibility = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	if _, err := tx.Exec(query, visibility, videoID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RejectQuarantinedObject marks a video's file rejected and detaches it from
+// the video, which stays taken down and has to be uploaded again. The
+// caller deletes the file.
+func (c Client) RejectQuarantinedObject(ctx context.Context, videoID, reviewerID uuid.UUID) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE quarantined_objects SET status = ?, reviewed_by = ?, reviewed_at = ? WHERE video_id = ?", QuarantineRejected, reviewerID, time.Now().UTC(), videoID)
+	if err != nil {
+		return err
+	}
+	// The video may have been given a newer file since; that one is kept.
+	var inUse bool
+	err = tx.QueryRow(`
+	SELECT EXISTS (
+		SELECT 1 FROM renditions
+		WHERE video_id = ? AND s3_key = (SELECT original_key FROM quarantined_objects WHERE video_id = ?)
+	)
+	`, videoID, videoID).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if !inUse {
+		return tx.Commit()
+	}
+	if err := replaceRenditions(tx, videoID, nil); err != nil {
+		return err
+	}
+	query := `
+	UPDATE videos
+	SET video_url = NULL, status = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1
+	WHERE id = ?
+	`
+	if _, err := tx.Exec(query, VideoStatusFailed, videoID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
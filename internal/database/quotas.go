@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserQuota overrides the configured upload limits for one user. A nil
+// limit falls back to the default, and zero means unlimited.
+type UserQuota struct {
+	UserID       uuid.UUID `json:"user_id"`
+	StorageBytes *int64    `json:"storage_bytes"`
+	VideosPerDay *int      `json:"videos_per_day"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UserUsage is what counts against a user's quota.
+type UserUsage struct {
+	// StorageBytes counts source files and renditions of the user's videos,
+	// including those in the trash.
+	StorageBytes int64 `json:"storage_bytes"`
+	VideosToday  int   `json:"videos_today"`
+}
+
+func (c *Client) migrateUserQuotas(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS user_quotas (
+		user_id TEXT PRIMARY KEY,
+		storage_bytes INTEGER,
+		videos_per_day INTEGER,
+		updated_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`)
+	return err
+}
+
+// GetUserQuota returns a user's override, or nil if they have none.
+func (c Client) GetUserQuota(ctx context.Context, userID uuid.UUID) (*UserQuota, error) {
+	quota := UserQuota{UserID: userID}
+	err := c.db.QueryRow(ctx, "SELECT storage_bytes, videos_per_day, updated_at FROM user_quotas WHERE user_id = ?", userID).
+		Scan(&quota.StorageBytes, &quota.VideosPerDay, &quota.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// SetUserQuota creates or replaces a user's override.
+func (c Client) SetUserQuota(ctx context.Context, quota UserQuota) (UserQuota, error) {
+	quota.UpdatedAt = time.Now().UTC()
+	query := `
+	INSERT INTO user_quotas (
+		user_id,
+		storage_bytes,
+		videos_per_day,
+		updated_at
+	) VALUES (?, ?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		storage_bytes = excluded.storage_bytes,
+		videos_per_day = excluded.videos_per_day,
+		updated_at = excluded.updated_at
+	`
+	_, err := c.db.Exec(ctx, query, quota.UserID, quota.StorageBytes, quota.VideosPerDay, quota.UpdatedAt)
+	if err != nil {
+		return UserQuota{}, err
+	}
+	return quota, nil
+}
+
+// DeleteUserQuota removes a user's override so the defaults apply.
+func (c Client) DeleteUserQuota(ctx context.Context, userID uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM user_quotas WHERE user_id = ?", userID)
+	return err
+}
+
+// GetUserUsage totals a user's storage and counts the videos they've
+// created since dayStart.
+func (c Client) GetUserUsage(ctx context.Context, userID uuid.UUID, dayStart time.Time) (UserUsage, error) {
+	var usage UserUsage
+	err := c.db.QueryRow(ctx, `
+	SELECT
+		(SELECT COALESCE(SUM(size_bytes), 0) FROM videos WHERE user_id = ?)
+			+ (SELECT COALESCE(SUM(r.size_bytes), 0) FROM renditions r JOIN videos v ON v.id = r.video_id WHERE v.user_id = ?),
+		(SELECT COUNT(*) FROM videos WHERE user_id = ? AND created_at >= ?)
+	`, userID, userID, userID, formatTimestamp(dayStart)).Scan(&usage.StorageBytes, &usage.VideosToday)
+	return usage, err
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// GetRelatedVideoCandidates returns public videos that share a tag or the
+// owner with a video, or contain one of the given title words. Ranking is
+// left to the caller.
+func (c Client) GetRelatedVideoCandidates(ctx context.Context, video Video, titleWords []string, limit int) ([]Video, error) {
+	c = c.onReplica()
+	conditions := []string{"user_id = ?"}
+	args := []any{video.UserID}
+	if len(video.Tags) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(video.Tags)), ", ")
+		conditions = append(conditions, "id IN (SELECT video_id FROM video_tags WHERE tag IN ("+placeholders+"))")
+		for _, tag := range video.Tags {
+			args = append(args, tag)
+		}
+	}
+	for _, word := range titleWords {
+		conditions = append(conditions, "LOWER(title) LIKE ?")
+		args = append(args, "%"+word+"%")
+	}
+
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE id != ? AND deleted_at IS NULL AND visibility = ? AND ` + ownerNotSuspended + `
+		AND (` + strings.Join(conditions, " OR ") + `)
+	ORDER BY created_at DESC
+	LIMIT ?
+	`
+	args = append([]any{video.ID, VisibilityPublic}, args...)
+	args = append(args, limit)
+	return c.queryVideos(ctx, query, args...)
+}
+
+// GetTagsForVideos loads the tags of several videos at once.
+func (c Client) GetTagsForVideos(ctx context.Context, videoIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	c = c.onReplica()
+	tags := map[uuid.UUID][]string{}
+	if len(videoIDs) == 0 {
+		return tags, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(videoIDs)), ", ")
+	args := make([]any, len(videoIDs))
+	for i, id := range videoIDs {
+		args[i] = id
+	}
+	rows, err := c.db.Query(ctx, "SELECT video_id, tag FROM video_tags WHERE video_id IN ("+placeholders+") ORDER BY tag", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RenditionQualitySource is the rendition remuxed from the uploaded file
+// without re-encoding.
+const RenditionQualitySource = "source"
+
+// RenditionQualityHLS is the source rendition segmented for HLS. Its S3Key
+// is the playlist; the segments are stored beside it.
+const RenditionQualityHLS = "hls"
+
+// RenditionQualityVertical is a 9:16 crop of a landscape video, for
+// publishing as a short.
+const RenditionQualityVertical = "vertical"
+
+// RenditionQualitySDR is an HDR video tone-mapped to SDR, for screens that
+// can't show HDR.
+const RenditionQualitySDR = "sdr"
+
+// RenditionQualityAudio is a video's audio alone, as AAC in an M4A file.
+const RenditionQualityAudio = "audio"
+
+// RenditionQualityTrailer is a short trailer stitched from a video's
+// highlights. It isn't an alternative to the video, so players don't pick
+// it.
+const RenditionQualityTrailer = "trailer"
+
+// Rendition is one encoded copy of a video's file. A video's VideoURL points
+// at its default rendition; the rest are alternatives a player can pick from.
+type Rendition struct {
+	ID        uuid.UUID `json:"id"`
+	VideoID   uuid.UUID `json:"video_id"`
+	Quality   string    `json:"quality"`
+	Codec     string    `json:"codec"`
+	S3Key     string    `json:"s3_key"`
+	SizeBytes int64     `json:"size_bytes"`
+	Bitrate   int64     `json:"bitrate"`
+	// ContainerProfile is how an MP4 rendition's container was written,
+	// empty for the progressive MP4s written before profiles existed and
+	// for renditions that aren't MP4s.
+	ContainerProfile string `json:"container_profile,omitempty"`
+	// VMAF and SSIM score the rendition against the uploaded file, when
+	// quality scoring is on.
+	VMAF      *float64  `json:"vmaf,omitempty"`
+	SSIM      *float64  `json:"ssim,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c *Client) migrateRenditions(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS renditions (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		quality TEXT NOT NULL,
+		codec TEXT NOT NULL,
+		s3_key TEXT NOT NULL,
+		size_bytes INTEGER NOT NULL,
+		bitrate INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(video_id, quality),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	return err
+}
+
+func (c *Client) migrateRenditionQuality(ctx context.Context) error {
+	if err := c.addColumnIfMissing(ctx, "renditions", "vmaf", "REAL"); err != nil {
+		return err
+	}
+	return c.addColumnIfMissing(ctx, "renditions", "ssim", "REAL")
+}
+
+func (c *Client) migrateRenditionContainerProfile(ctx context.Context) error {
+	return c.addColumnIfMissing(ctx, "renditions", "container_profile", "TEXT NOT NULL DEFAULT ''")
+}
+
+// GetRenditions returns a video's renditions, largest first.
+func (c Client) GetRenditions(ctx context.Context, videoID uuid.UUID) ([]Rendition, error) {
+	query := `
+	SELECT id, video_id, quality, codec, s3_key, size_bytes, bitrate, container_profile, vmaf, ssim, created_at
+	FROM renditions
+	WHERE video_id = ?
+	ORDER BY bitrate DESC, quality
+	`
+	rows, err := c.db.Query(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	renditions := []Rendition{}
+	for rows.Next() {
+		var rendition Rendition
+		err := rows.Scan(
+			&rendition.ID,
+			&rendition.VideoID,
+			&rendition.Quality,
+			&rendition.Codec,
+			&rendition.S3Key,
+			&rendition.SizeBytes,
+			&rendition.Bitrate,
+			&rendition.ContainerProfile,
+			&rendition.VMAF,
+			&rendition.SSIM,
+			&rendition.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, rendition)
+	}
+	return renditions, rows.Err()
+}
+
+// replaceRenditions swaps a video's renditions for a new set inside tx.
+func replaceRenditions(tx tx, videoID uuid.UUID, renditions []Rendition) error {
+	if _, err := tx.Exec("DELETE FROM renditions WHERE video_id = ?", videoID); err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO renditions (
+		id,
+		video_id,
+		quality,
+		codec,
+		s3_key,
+		size_bytes,
+		bitrate,
+		container_profile,
+		vmaf,
+		ssim,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	now := formatTimestamp(time.Now())
+	for _, rendition := range renditions {
+		_, err := tx.Exec(query,
+			uuid.New(),
+			videoID,
+			rendition.Quality,
+			rendition.Codec,
+			rendition.S3Key,
+			rendition.SizeBytes,
+			rendition.Bitrate,
+			rendition.ContainerProfile,
+			rendition.VMAF,
+			rendition.SSIM,
+			now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenditionQualityStats summarizes the quality scores of one kind of
+// rendition, for tuning its encoding preset. Averages are nil if no
+// rendition of the kind has that score.
+type RenditionQualityStats struct {
+	Quality        string   `json:"quality"`
+	Codec          string   `json:"codec"`
+	Count          int      `json:"count"`
+	AverageBitrate float64  `json:"average_bitrate"`
+	AverageVMAF    *float64 `json:"average_vmaf"`
+	MinVMAF        *float64 `json:"min_vmaf"`
+	AverageSSIM    *float64 `json:"average_ssim"`
+	MinSSIM        *float64 `json:"min_ssim"`
+}
+
+// GetRenditionQualityStats summarizes scored renditions by quality and
+// codec.
+func (c Client) GetRenditionQualityStats(ctx context.Context) ([]RenditionQualityStats, error) {
+	query := `
+	SELECT quality, codec, COUNT(*), AVG(bitrate), AVG(vmaf), MIN(vmaf), AVG(ssim), MIN(ssim)
+	FROM renditions
+	WHERE vmaf IS NOT NULL OR ssim IS NOT NULL
+	GROUP BY quality, codec
+	ORDER BY quality, codec
+	`
+	rows, err := c.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []RenditionQualityStats{}
+	for rows.Next() {
+		var s RenditionQualityStats
+		err := rows.Scan(&s.Quality, &s.Codec, &s.Count, &s.AverageBitrate, &s.AverageVMAF, &s.MinVMAF, &s.AverageSSIM, &s.MinSSIM)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReportReason string
+
+const (
+	ReportReasonSpam           ReportReason = "spam"
+	ReportReasonHarassment     ReportReason = "harassment"
+	ReportReasonHate           ReportReason = "hate"
+	ReportReasonViolence       ReportReason = "violence"
+	ReportReasonSexual         ReportReason = "sexual"
+	ReportReasonCopyright      ReportReason = "copyright"
+	ReportReasonMisinformation ReportReason = "misinformation"
+	ReportReasonOther          ReportReason = "other"
+)
+
+func (r ReportReason) Valid() bool {
+	switch r {
+	case ReportReasonSpam, ReportReasonHarassment, ReportReasonHate, ReportReasonViolence,
+		ReportReasonSexual, ReportReasonCopyright, ReportReasonMisinformation, ReportReasonOther:
+		return true
+	}
+	return false
+}
+
+type VideoReport struct {
+	ID         uuid.UUID    `json:"id"`
+	VideoID    uuid.UUID    `json:"video_id"`
+	ReporterID uuid.UUID    `json:"reporter_id"`
+	Reason     ReportReason `json:"reason"`
+	Details    string       `json:"details"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type CreateVideoReportParams struct {
+	VideoID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     ReportReason
+	Details    string
+}
+
+// CreateVideoReport records a report and bumps the video's report_count.
+// Each user can report a video once; a repeat report returns the original
+// with created set to false and leaves the count alone.
+func (c Client) CreateVideoReport(ctx context.Context, params CreateVideoReportParams) (report VideoReport, created bool, err error) {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return VideoReport{}, false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO video_reports (
+		id,
+		video_id,
+		reporter_id,
+		reason,
+		details,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT DO NOTHING
+	`
+	result, err := tx.Exec(query, uuid.New(), params.VideoID, params.ReporterID, params.Reason, params.Details)
+	if err != nil {
+		return VideoReport{}, false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return VideoReport{}, false, err
+	}
+	created = n > 0
+	if created {
+		_, err = tx.Exec("UPDATE videos SET report_count = report_count + 1 WHERE id = ?", params.VideoID)
+		if err != nil {
+			return VideoReport{}, false, err
+		}
+	}
+
+	query = `
+	SELECT
+		id,
+		video_id,
+		reporter_id,
+		reason,
+		details,
+		created_at
+	FROM video_reports
+	WHERE video_id = ? AND reporter_id = ?
+	`
+	err = tx.QueryRow(query, params.VideoID, params.ReporterID).Scan(
+		&report.ID,
+		&report.VideoID,
+		&report.ReporterID,
+		&report.Reason,
+		&report.Details,
+		&report.CreatedAt,
+	)
+	if err != nil {
+		return VideoReport{}, false, err
+	}
+	return report, created, tx.Commit()
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResumableUpload is a video file being sent in parts, backed by an S3
+// multipart upload. It's kept in the database so an upload survives a
+// restart and can be continued through any instance.
+type ResumableUpload struct {
+	ID         uuid.UUID
+	VideoID    uuid.UUID
+	UserID     uuid.UUID
+	S3Key      string
+	S3UploadID string
+	SizeBytes  int64
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	// CompletingAt is when a request claimed the upload to assemble its
+	// parts, if one has.
+	CompletingAt *time.Time
+	// Parts holds the ETag of each part received. It's only filled in by
+	// GetResumableUpload.
+	Parts map[int32]string
+}
+
+func (c *Client) migrateResumableUploads(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS resumable_uploads (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		s3_key TEXT NOT NULL,
+		s3_upload_id TEXT NOT NULL,
+		size_bytes BIGINT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		completing_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS resumable_upload_parts (
+		upload_id TEXT NOT NULL,
+		part_number INTEGER NOT NULL,
+		etag TEXT NOT NULL,
+		PRIMARY KEY(upload_id, part_number),
+		FOREIGN KEY(upload_id) REFERENCES resumable_uploads(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_resumable_uploads_expires ON resumable_uploads(expires_at)")
+	return err
+}
+
+func (c Client) CreateResumableUpload(ctx context.Context, u ResumableUpload) error {
+	query := `
+	INSERT INTO resumable_uploads (
+		id,
+		video_id,
+		user_id,
+		s3_key,
+		s3_upload_id,
+		size_bytes,
+		expires_at,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(ctx, query,
+		u.ID,
+		u.VideoID,
+		u.UserID,
+		u.S3Key,
+		u.S3UploadID,
+		u.SizeBytes,
+		formatTimestamp(u.ExpiresAt),
+		formatTimestamp(u.CreatedAt),
+	)
+	return err
+}
+
+const resumableUploadColumns = `
+	id,
+	video_id,
+	user_id,
+	s3_key,
+	s3_upload_id,
+	size_bytes,
+	expires_at,
+	created_at,
+	completing_at
+`
+
+func scanResumableUpload(row rowScanner) (ResumableUpload, error) {
+	var u ResumableUpload
+	err := row.Scan(
+		&u.ID,
+		&u.VideoID,
+		&u.UserID,
+		&u.S3Key,
+		&u.S3UploadID,
+		&u.SizeBytes,
+		&u.ExpiresAt,
+		&u.CreatedAt,
+		&u.CompletingAt,
+	)
+	return u, err
+}
+
+// GetResumableUpload returns an upload with the parts it has received, or
+// nil if there's no upload with the ID.
+func (c Client) GetResumableUpload(ctx context.Context, id uuid.UUID) (*ResumableUpload, error) {
+	u, err := scanResumableUpload(c.db.QueryRow(ctx, "SELECT"+resumableUploadColumns+" FROM resumable_uploads WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(ctx, "SELECT part_number, etag FROM resumable_upload_parts WHERE upload_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	u.Parts = map[int32]string{}
+	for rows.Next() {
+		var n int32
+		var etag string
+		if err := rows.Scan(&n, &etag); err != nil {
+			return nil, err
+		}
+		u.Parts[n] = etag
+	}
+	return &u, rows.Err()
+}
+
+// RecordResumableUploadPart stores the ETag of a part, replacing the one
+// of a part sent again. It reports false without storing it if the upload
+// has been claimed since staleBefore, since the part would be left out.
+func (c Client) RecordResumableUploadPart(ctx context.Context, id uuid.UUID, n int32, etag string, staleBefore time.Time) (bool, error) {
+	query := `
+	INSERT INTO resumable_upload_parts (upload_id, part_number, etag)
+	SELECT ?, CAST(? AS INTEGER), ?
+	WHERE EXISTS (
+		SELECT 1 FROM resumable_uploads
+		WHERE id = ? AND (completing_at IS NULL OR completing_at < ?)
+	)
+	ON CONFLICT(upload_id, part_number) DO UPDATE SET etag = excluded.etag
+	`
+	result, err := c.db.Exec(ctx, query, id, n, etag, id, formatTimestamp(staleBefore))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ClaimResumableUpload marks an upload as being completed. It reports
+// false if another request claimed it since staleBefore; older claims are
+// taken to belong to requests that died.
+func (c Client) ClaimResumableUpload(ctx context.Context, id uuid.UUID, staleBefore time.Time) (bool, error) {
+	query := `
+	UPDATE resumable_uploads
+	SET completing_at = ?
+	WHERE id = ? AND (completing_at IS NULL OR completing_at < ?)
+	`
+	result, err := c.db.Exec(ctx, query, formatTimestamp(time.Now()), id, formatTimestamp(staleBefore))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ReleaseResumableUpload drops a claim, so the upload can be completed
+// again.
+func (c Client) ReleaseResumableUpload(ctx context.Context, id uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "UPDATE resumable_uploads SET completing_at = NULL WHERE id = ?", id)
+	return err
+}
+
+// DeleteResumableUpload removes an upload and its parts. The caller
+// aborts or completes the multipart upload first.
+func (c Client) DeleteResumableUpload(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM resumable_upload_parts WHERE upload_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM resumable_uploads WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetResumableUploadsExpiredBefore lists uploads that expired before now,
+// other than those claimed since staleBefore.
+func (c Client) GetResumableUploadsExpiredBefore(ctx context.Context, now, staleBefore time.Time) ([]ResumableUpload, error) {
+	query := `
+	SELECT` + resumableUploadColumns + `
+	FROM resumable_uploads
+	WHERE expires_at < ? AND (completing_at IS NULL OR completing_at < ?)
+	ORDER BY expires_at
+	`
+	rows, err := c.db.Query(ctx, query, formatTimestamp(now), formatTimestamp(staleBefore))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []ResumableUpload{}
+	for rows.Next() {
+		u, err := scanResumableUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
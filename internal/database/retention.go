@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserRetention puts a user in compliance mode: the files they upload are
+// stored under S3 Object Lock for RetentionDays, and their videos can't be
+// deleted until it runs out.
+type UserRetention struct {
+	UserID        uuid.UUID `json:"user_id"`
+	RetentionDays int       `json:"retention_days"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (c *Client) migrateObjectLockRetention(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS user_retention (
+		user_id TEXT PRIMARY KEY,
+		retention_days INTEGER NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	return c.addColumnIfMissing(ctx, "videos", "retain_until", "TIMESTAMP")
+}
+
+// GetUserRetention returns a user's retention, or nil if they aren't in
+// compliance mode.
+func (c Client) GetUserRetention(ctx context.Context, userID uuid.UUID) (*UserRetention, error) {
+	retention := UserRetention{UserID: userID}
+	err := c.db.QueryRow(ctx, "SELECT retention_days, updated_at FROM user_retention WHERE user_id = ?", userID).
+		Scan(&retention.RetentionDays, &retention.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &retention, nil
+}
+
+// SetUserRetention creates or replaces a user's retention. It applies to
+// files uploaded from then on.
+func (c Client) SetUserRetention(ctx context.Context, retention UserRetention) (UserRetention, error) {
+	retention.UpdatedAt = time.Now().UTC()
+	query := `
+	INSERT INTO user_retention (
+		user_id,
+		retention_days,
+		updated_at
+	) VALUES (?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		retention_days = excluded.retention_days,
+		updated_at = excluded.updated_at
+	`
+	_, err := c.db.Exec(ctx, query, retention.UserID, retention.RetentionDays, retention.UpdatedAt)
+	if err != nil {
+		return UserRetention{}, err
+	}
+	return retention, nil
+}
+
+// DeleteUserRetention takes a user out of compliance mode. Files already
+// locked stay locked, and their videos stay undeletable, until their
+// retention runs out.
+func (c Client) DeleteUserRetention(ctx context.Context, userID uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM user_retention WHERE user_id = ?", userID)
+	return err
+}
+
+// ExtendVideoRetention keeps a video from being deleted until retainUntil,
+// unless it's already kept for longer.
+func (c Client) ExtendVideoRetention(ctx context.Context, videoID uuid.UUID, retainUntil time.Time) error {
+	query := `
+	UPDATE videos
+	SET retain_until = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND (retain_until IS NULL OR retain_until < ?)
+	`
+	_, err := c.db.Exec(ctx, query, retainUntil, videoID, retainUntil)
+	return err
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoShare struct {
+	ID        uuid.UUID `json:"id"`
+	Token     string    `json:"token"`
+	VideoID   uuid.UUID `json:"video_id"`
+	CreatedBy uuid.UUID `json:"created_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxViews  *int      `json:"max_views"`
+	ViewCount int       `json:"view_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateVideoShareParams struct {
+	Token     string
+	VideoID   uuid.UUID
+	CreatedBy uuid.UUID
+	ExpiresAt time.Time
+	MaxViews  *int
+}
+
+const videoShareColumns = `
+		id,
+		token,
+		video_id,
+		created_by,
+		expires_at,
+		max_views,
+		view_count,
+		created_at`
+
+func scanVideoShare(row rowScanner) (VideoShare, error) {
+	var share VideoShare
+	var maxViews sql.NullInt64
+	err := row.Scan(
+		&share.ID,
+		&share.Token,
+		&share.VideoID,
+		&share.CreatedBy,
+		&share.ExpiresAt,
+		&maxViews,
+		&share.ViewCount,
+		&share.CreatedAt,
+	)
+	if err != nil {
+		return VideoShare{}, err
+	}
+	if maxViews.Valid {
+		n := int(maxViews.Int64)
+		share.MaxViews = &n
+	}
+	return share, nil
+}
+
+func (c Client) CreateVideoShare(ctx context.Context, params CreateVideoShareParams) (VideoShare, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO video_shares (
+		id,
+		token,
+		video_id,
+		created_by,
+		expires_at,
+		max_views,
+		view_count,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, 0, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(ctx, query, id, params.Token, params.VideoID, params.CreatedBy, formatTimestamp(params.ExpiresAt), params.MaxViews)
+	if err != nil {
+		return VideoShare{}, err
+	}
+	return c.getVideoShare(ctx, "id", id)
+}
+
+func (c Client) GetVideoShareByToken(ctx context.Context, token string) (VideoShare, error) {
+	return c.getVideoShare(ctx, "token", token)
+}
+
+func (c Client) getVideoShare(ctx context.Context, column string, value any) (VideoShare, error) {
+	query := `
+	SELECT` + videoShareColumns + `
+	FROM video_shares
+	WHERE ` + column + ` = ?
+	`
+	share, err := scanVideoShare(c.db.QueryRow(ctx, query, value))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoShare{}, nil
+		}
+		return VideoShare{}, err
+	}
+	return share, nil
+}
+
+// RedeemVideoShare counts a view against a share link. It returns a zero
+// VideoShare when the token is unknown, expired, or out of views. The check
+// and increment happen in one statement so concurrent viewers can't exceed
+// max_views.
+func (c Client) RedeemVideoShare(ctx context.Context, token string) (VideoShare, error) {
+	query := `
+	UPDATE video_shares
+	SET view_count = view_count + 1
+	WHERE token = ?
+		AND expires_at > ?
+		AND (max_views IS NULL OR view_count < max_views)
+	`
+	result, err := c.db.Exec(ctx, query, token, formatTimestamp(time.Now()))
+	if err != nil {
+		return VideoShare{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return VideoShare{}, err
+	}
+	if n == 0 {
+		return VideoShare{}, nil
+	}
+	return c.GetVideoShareByToken(ctx, token)
+}
+
+func (c Client) GetVideoShares(ctx context.Context, videoID uuid.UUID) ([]VideoShare, error) {
+	query := `
+	SELECT` + videoShareColumns + `
+	FROM video_shares
+	WHERE video_id = ?
+	ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []VideoShare{}
+	for rows.Next() {
+		share, err := scanVideoShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func (c Client) DeleteVideoShare(ctx context.Context, id uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM video_shares WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+const MaxSlugLength = 80
+
+// reservedSlugs are the literal segments routed under /api/videos/, which
+// would shadow a video with the same slug.
+var reservedSlugs = map[string]bool{
+	"batch":    true,
+	"public":   true,
+	"top":      true,
+	"trash":    true,
+	"trending": true,
+}
+
+// Slugify lowercases a title and collapses everything but ASCII letters and
+// digits into single dashes.
+func Slugify(title string) string {
+	var sb strings.Builder
+	lastDash := true
+	for _, c := range strings.ToLower(title) {
+		switch {
+		case c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c)):
+			sb.WriteRune(c)
+			lastDash = false
+		case !lastDash:
+			sb.WriteByte('-')
+			lastDash = true
+		}
+	}
+	slug := strings.TrimSuffix(sb.String(), "-")
+	if len(slug) > MaxSlugLength {
+		slug = strings.TrimRight(slug[:MaxSlugLength], "-")
+	}
+	return slug
+}
+
+// ValidSlug reports whether s is a slug Slugify could have produced. UUIDs
+// and reserved route names are rejected so a path value is never ambiguous.
+func ValidSlug(s string) bool {
+	if s == "" || len(s) > MaxSlugLength || Slugify(s) != s || reservedSlugs[s] {
+		return false
+	}
+	_, err := uuid.Parse(s)
+	return err != nil
+}
+
+// uniqueSlug derives a slug from a title that isn't used by any other video,
+// appending -2, -3, ... on collision.
+func (c Client) uniqueSlug(ctx context.Context, title string, videoID uuid.UUID) (string, error) {
+	base := Slugify(title)
+	start := 1
+	switch {
+	case reservedSlugs[base]:
+		start = 2
+	case !ValidSlug(base):
+		base = "video"
+	}
+	for i := start; ; i++ {
+		candidate := base
+		if i > 1 {
+			suffix := fmt.Sprintf("-%d", i)
+			candidate = strings.TrimRight(base[:min(len(base), MaxSlugLength-len(suffix))], "-") + suffix
+		}
+		taken, err := c.slugTaken(ctx, candidate, videoID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
+
+func (c Client) slugTaken(ctx context.Context, slug string, videoID uuid.UUID) (bool, error) {
+	var id uuid.UUID
+	err := c.db.QueryRow(ctx, "SELECT id FROM videos WHERE slug = ?", slug).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return id != videoID, nil
+}
+
+// SlugAvailable reports whether slug is free to be assigned to the video.
+func (c Client) SlugAvailable(ctx context.Context, slug string, videoID uuid.UUID) (bool, error) {
+	taken, err := c.slugTaken(ctx, slug, videoID)
+	return !taken, err
+}
+
+func (c Client) GetVideoBySlug(ctx context.Context, slug string) (Video, error) {
+	var id uuid.UUID
+	err := c.db.QueryRow(ctx, "SELECT id FROM videos WHERE slug = ?", slug).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Video{}, nil
+		}
+		return Video{}, err
+	}
+	return c.GetVideo(ctx, id)
+}
+
+// backfillVideoSlugs assigns slugs to videos created before slugs existed.
+func (c *Client) backfillVideoSlugs(ctx context.Context) error {
+	rows, err := c.db.Query(ctx, "SELECT id, title FROM videos WHERE slug IS NULL")
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id    uuid.UUID
+		title string
+	}
+	videos := []pending{}
+	for rows.Next() {
+		var v pending
+		if err := rows.Scan(&v.id, &v.title); err != nil {
+			rows.Close()
+			return err
+		}
+		videos = append(videos, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, v := range videos {
+		slug, err := c.uniqueSlug(ctx, v.title, v.id)
+		if err != nil {
+			return err
+		}
+		if _, err := c.db.Exec(ctx, "UPDATE videos SET slug = ? WHERE id = ?", slug, v.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// SystemTotals summarizes what the service is storing.
+type SystemTotals struct {
+	Videos         int                 `json:"videos"`
+	TrashedVideos  int                 `json:"trashed_videos"`
+	VideosByStatus map[VideoStatus]int `json:"videos_by_status"`
+	Users          int                 `json:"users"`
+	// StorageBytes counts source files and renditions, including videos in
+	// the trash, which keep their files until they're purged.
+	StorageBytes int64 `json:"storage_bytes"`
+}
+
+// DailyUploads is the number and size of videos created on one UTC day.
+type DailyUploads struct {
+	Day    string `json:"day"`
+	Videos int    `json:"videos"`
+	Bytes  int64  `json:"bytes"`
+}
+
+func (c Client) GetSystemTotals(ctx context.Context) (SystemTotals, error) {
+	totals := SystemTotals{VideosByStatus: map[VideoStatus]int{}}
+	err := c.db.QueryRow(ctx, `
+	SELECT
+		(SELECT COUNT(*) FROM videos WHERE deleted_at IS NULL),
+		(SELECT COUNT(*) FROM videos WHERE deleted_at IS NOT NULL),
+		(SELECT COUNT(*) FROM users),
+		(SELECT COALESCE(SUM(size_bytes), 0) FROM videos)
+			+ (SELECT COALESCE(SUM(size_bytes), 0) FROM renditions)
+	`).Scan(&totals.Videos, &totals.TrashedVideos, &totals.Users, &totals.StorageBytes)
+	if err != nil {
+		return SystemTotals{}, err
+	}
+
+	rows, err := c.db.Query(ctx, "SELECT status, COUNT(*) FROM videos WHERE deleted_at IS NULL GROUP BY status")
+	if err != nil {
+		return SystemTotals{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status VideoStatus
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return SystemTotals{}, err
+		}
+		totals.VideosByStatus[status] = n
+	}
+	return totals, rows.Err()
+}
+
+// ListDailyUploads returns upload volume per day since the given time,
+// oldest first. Days without uploads are omitted.
+func (c Client) ListDailyUploads(ctx context.Context, since time.Time) ([]DailyUploads, error) {
+	day := c.db.dialect.day("created_at")
+	rows, err := c.db.Query(ctx, `
+	SELECT `+day+`, COUNT(*), COALESCE(SUM(size_bytes), 0)
+	FROM videos
+	WHERE created_at >= ?
+	GROUP BY `+day+`
+	ORDER BY `+day, formatTimestamp(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DailyUploads{}
+	for rows.Next() {
+		var d DailyUploads
+		if err := rows.Scan(&d.Day, &d.Videos, &d.Bytes); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
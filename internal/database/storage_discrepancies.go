@@ -0,0 +1,294 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StorageReferenceSource is the kind of row that refers to a stored object.
+type StorageReferenceSource string
+
+const (
+	StorageReferenceVideo         StorageReferenceSource = "video"
+	StorageReferenceRendition     StorageReferenceSource = "rendition"
+	StorageReferenceLiveStream    StorageReferenceSource = "live_stream"
+	StorageReferencePendingUpload StorageReferenceSource = "pending_upload"
+)
+
+// StorageReference is a row that refers to an object in the bucket. ID is
+// the row's ID. Key is the object key, except for videos, where it's the
+// video URL the key has to be recovered from.
+type StorageReference struct {
+	Source  StorageReferenceSource
+	ID      uuid.UUID
+	VideoID uuid.UUID
+	Key     string
+}
+
+// StorageDiscrepancyKind is how the database and the bucket disagree.
+type StorageDiscrepancyKind string
+
+const (
+	// StorageObjectMissing is a row whose object isn't in the bucket.
+	StorageObjectMissing StorageDiscrepancyKind = "missing_object"
+	// StorageObjectOrphaned is an object no row refers to.
+	StorageObjectOrphaned StorageDiscrepancyKind = "orphaned_object"
+)
+
+func (k StorageDiscrepancyKind) Valid() bool {
+	switch k {
+	case StorageObjectMissing, StorageObjectOrphaned:
+		return true
+	}
+	return false
+}
+
+// StorageDiscrepancy is something the storage reconciler found. Source,
+// SourceID, and VideoID identify the row of a missing object; SizeBytes is
+// the size of an orphaned one. Resolution says how it was resolved: by a
+// repair, or "cleared" when a later run no longer found it.
+type StorageDiscrepancy struct {
+	ID         uuid.UUID              `json:"id"`
+	Kind       StorageDiscrepancyKind `json:"kind"`
+	Key        string                 `json:"key"`
+	Source     StorageReferenceSource `json:"source,omitempty"`
+	SourceID   *uuid.UUID             `json:"source_id,omitempty"`
+	VideoID    *uuid.UUID             `json:"video_id,omitempty"`
+	SizeBytes  *int64                 `json:"size_bytes,omitempty"`
+	DetectedAt time.Time              `json:"detected_at"`
+	Resolution *string                `json:"resolution,omitempty"`
+	ResolvedBy *uuid.UUID             `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time             `json:"resolved_at,omitempty"`
+}
+
+// StorageDiscrepancyResolutionCleared marks discrepancies a later
+// reconciliation run no longer found.
+const StorageDiscrepancyResolutionCleared = "cleared"
+
+// Discrepancies keep no foreign keys: an orphaned object has no row, and a
+// missing one's row may be removed by the repair.
+func (c *Client) migrateStorageDiscrepancies(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS storage_discrepancies (
+		id TEXT PRIMARY KEY,
+		kind TEXT NOT NULL,
+		s3_key TEXT NOT NULL,
+		source TEXT NOT NULL DEFAULT '',
+		source_id TEXT,
+		video_id TEXT,
+		size_bytes INTEGER,
+		detected_at TIMESTAMP NOT NULL,
+		resolution TEXT,
+		resolved_by TEXT,
+		resolved_at TIMESTAMP
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_storage_discrepancies_resolved ON storage_discrepancies(resolved_at, detected_at)")
+	return err
+}
+
+// GetStorageReferences returns every row that refers to an object in the
+// bucket: videos with a file, other than live and failed ones and those
+// whose file is quarantined or was rejected, renditions, live streams on
+// air, and pending uploads.
+func (c Client) GetStorageReferences(ctx context.Context) ([]StorageReference, error) {
+	query := `
+	SELECT ?, id, id, video_url
+	FROM videos
+	WHERE video_url IS NOT NULL
+		AND status NOT IN (?, ?)
+		AND id NOT IN (SELECT video_id FROM quarantined_objects WHERE status <> ?)
+	UNION ALL
+	SELECT ?, id, video_id, s3_key FROM renditions
+	UNION ALL
+	SELECT ?, id, video_id, s3_key FROM live_streams WHERE status = ?
+	UNION ALL
+	SELECT ?, id, video_id, s3_key FROM pending_uploads
+	`
+	rows, err := c.db.Query(ctx, query,
+		StorageReferenceVideo, VideoStatusLive, VideoStatusFailed, QuarantineReleased,
+		StorageReferenceRendition,
+		StorageReferenceLiveStream, LiveStreamStatusLive,
+		StorageReferencePendingUpload,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []StorageReference{}
+	for rows.Next() {
+		var ref StorageReference
+		if err := rows.Scan(&ref.Source, &ref.ID, &ref.VideoID, &ref.Key); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// RecordStorageDiscrepancies replaces the open discrepancies with those a
+// reconciliation run found. Ones still found keep their ID and detection
+// time; ones no longer found are resolved as cleared.
+func (c Client) RecordStorageDiscrepancies(ctx context.Context, found []StorageDiscrepancy) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// A video and its rendition can point at the same missing object, so
+	// discrepancies are told apart by source as well as key.
+	type key struct {
+		kind   StorageDiscrepancyKind
+		key    string
+		source StorageReferenceSource
+	}
+	open := map[key]uuid.UUID{}
+	rows, err := tx.Query("SELECT id, kind, s3_key, source FROM storage_discrepancies WHERE resolved_at IS NULL")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id uuid.UUID
+		var k key
+		if err := rows.Scan(&id, &k.kind, &k.key, &k.source); err != nil {
+			rows.Close()
+			return err
+		}
+		open[k] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := formatTimestamp(time.Now())
+	for _, d := range found {
+		k := key{d.Kind, d.Key, d.Source}
+		if _, ok := open[k]; ok {
+			delete(open, k)
+			continue
+		}
+		_, err := tx.Exec(`
+		INSERT INTO storage_discrepancies (id, kind, s3_key, source, source_id, video_id, size_bytes, detected_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, uuid.New(), d.Kind, d.Key, d.Source, d.SourceID, d.VideoID, d.SizeBytes, now)
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range open {
+		_, err := tx.Exec(
+			"UPDATE storage_discrepancies SET resolution = ?, resolved_at = ? WHERE id = ?",
+			StorageDiscrepancyResolutionCleared, now, id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const storageDiscrepancyColumns = `
+	id,
+	kind,
+	s3_key,
+	source,
+	source_id,
+	video_id,
+	size_bytes,
+	detected_at,
+	resolution,
+	resolved_by,
+	resolved_at
+`
+
+func scanStorageDiscrepancy(row rowScanner) (StorageDiscrepancy, error) {
+	var d StorageDiscrepancy
+	err := row.Scan(
+		&d.ID,
+		&d.Kind,
+		&d.Key,
+		&d.Source,
+		&d.SourceID,
+		&d.VideoID,
+		&d.SizeBytes,
+		&d.DetectedAt,
+		&d.Resolution,
+		&d.ResolvedBy,
+		&d.ResolvedAt,
+	)
+	return d, err
+}
+
+// GetStorageDiscrepancy returns nil if there's no discrepancy with the ID.
+func (c Client) GetStorageDiscrepancy(ctx context.Context, id uuid.UUID) (*StorageDiscrepancy, error) {
+	d, err := scanStorageDiscrepancy(c.db.QueryRow(ctx, "SELECT"+storageDiscrepancyColumns+" FROM storage_discrepancies WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListStorageDiscrepancies lists open discrepancies, oldest first, or
+// resolved ones, most recently resolved first. An empty kind lists both
+// kinds.
+func (c Client) ListStorageDiscrepancies(ctx context.Context, kind StorageDiscrepancyKind, resolved bool, limit, offset int) ([]StorageDiscrepancy, error) {
+	query := "SELECT" + storageDiscrepancyColumns + " FROM storage_discrepancies WHERE resolved_at IS NULL"
+	order := " ORDER BY detected_at ASC"
+	if resolved {
+		query = "SELECT" + storageDiscrepancyColumns + " FROM storage_discrepancies WHERE resolved_at IS NOT NULL"
+		order = " ORDER BY resolved_at DESC"
+	}
+	args := []any{}
+	if kind != "" {
+		query += " AND kind = ?"
+		args = append(args, kind)
+	}
+	query += order + " LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := c.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discrepancies := []StorageDiscrepancy{}
+	for rows.Next() {
+		d, err := scanStorageDiscrepancy(rows)
+		if err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies, rows.Err()
+}
+
+// ResolveStorageDiscrepancy records how an open discrepancy was resolved.
+// resolvedBy is nil for automatic repairs.
+func (c Client) ResolveStorageDiscrepancy(ctx context.Context, id uuid.UUID, resolution string, resolvedBy *uuid.UUID) error {
+	_, err := c.db.Exec(ctx, `
+	UPDATE storage_discrepancies
+	SET resolution = ?, resolved_by = ?, resolved_at = ?
+	WHERE id = ? AND resolved_at IS NULL
+	`, resolution, resolvedBy, formatTimestamp(time.Now()), id)
+	return err
+}
+
+// DeleteRendition removes one rendition row. The caller deletes its object.
+func (c Client) DeleteRendition(ctx context.Context, id uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM renditions WHERE id = ?", id)
+	return err
+}
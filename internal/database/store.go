@@ -0,0 +1,285 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Store is the set of queries the API uses. Client implements it against
+// SQLite or Postgres; tests can substitute a fake.
+type Store interface {
+	Ping(ctx context.Context) error
+	PoolStats() sql.DBStats
+	Backup(ctx context.Context, path string) error
+	MissingIndexes(ctx context.Context) ([]string, error)
+	GetSystemTotals(ctx context.Context) (SystemTotals, error)
+	ListDailyUploads(ctx context.Context, since time.Time) ([]DailyUploads, error)
+
+	GetFeatureFlags(ctx context.Context) ([]FeatureFlag, error)
+	SetFeatureFlag(ctx context.Context, flag FeatureFlag) (FeatureFlag, error)
+	DeleteFeatureFlag(ctx context.Context, name string) error
+
+	GetUserQuota(ctx context.Context, userID uuid.UUID) (*UserQuota, error)
+	SetUserQuota(ctx context.Context, quota UserQuota) (UserQuota, error)
+	DeleteUserQuota(ctx context.Context, userID uuid.UUID) error
+	GetUserRetention(ctx context.Context, userID uuid.UUID) (*UserRetention, error)
+	SetUserRetention(ctx context.Context, retention UserRetention) (UserRetention, error)
+	DeleteUserRetention(ctx context.Context, userID uuid.UUID) error
+	ExtendVideoRetention(ctx context.Context, videoID uuid.UUID, retainUntil time.Time) error
+	ExportUsers(ctx context.Context) ([]MigratedUser, error)
+	ImportUser(ctx context.Context, u MigratedUser) (bool, error)
+	ImportVideo(ctx context.Context, video Video, renditions []Rendition) (bool, error)
+	GetUserUsage(ctx context.Context, userID uuid.UUID, dayStart time.Time) (UserUsage, error)
+
+	GetEmailPreferences(ctx context.Context, userID uuid.UUID) (map[EmailKind]bool, error)
+	SetEmailPreference(ctx context.Context, userID uuid.UUID, kind EmailKind, enabled bool) error
+
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserByRefreshToken(ctx context.Context, token string) (*User, error)
+	CreateUser(ctx context.Context, params CreateUserParams) (*User, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+
+	CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	GetRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	DeleteRefreshToken(ctx context.Context, token string) error
+
+	GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error)
+	GetTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error)
+	ExportVideos(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]ExportedVideo, error)
+	GetVideosDeletedBefore(ctx context.Context, cutoff time.Time) ([]Video, error)
+	ListVideos(ctx context.Context, params ListVideosParams) (videos []Video, more bool, err error)
+	CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error)
+	GetVideo(ctx context.Context, id uuid.UUID) (Video, error)
+	UpdateVideo(ctx context.Context, video Video) error
+	UpdateVideoMetadata(ctx context.Context, id uuid.UUID, params UpdateVideoMetadataParams) error
+	SetVideoStatus(ctx context.Context, id uuid.UUID, status VideoStatus) error
+	SetVideoVisibility(ctx context.Context, id uuid.UUID, visibility Visibility) error
+	SoftDeleteVideo(ctx context.Context, id uuid.UUID) error
+	ApplyBatchVideoChange(ctx context.Context, id uuid.UUID, change BatchVideoChange) error
+	RestoreVideo(ctx context.Context, id uuid.UUID) error
+	DeleteVideo(ctx context.Context, id uuid.UUID) error
+
+	CreatePendingUpload(ctx context.Context, videoID uuid.UUID, s3Key string) (PendingUpload, error)
+	DeletePendingUpload(ctx context.Context, id uuid.UUID) error
+	GetPendingUploadsBefore(ctx context.Context, cutoff time.Time) ([]PendingUpload, error)
+	CreateResumableUpload(ctx context.Context, u ResumableUpload) error
+	GetResumableUpload(ctx context.Context, id uuid.UUID) (*ResumableUpload, error)
+	RecordResumableUploadPart(ctx context.Context, id uuid.UUID, n int32, etag string, staleBefore time.Time) (bool, error)
+	ClaimResumableUpload(ctx context.Context, id uuid.UUID, staleBefore time.Time) (bool, error)
+	ReleaseResumableUpload(ctx context.Context, id uuid.UUID) error
+	DeleteResumableUpload(ctx context.Context, id uuid.UUID) error
+	GetResumableUploadsExpiredBefore(ctx context.Context, now, staleBefore time.Time) ([]ResumableUpload, error)
+	CreateFormUpload(ctx context.Context, u FormUpload) error
+	GetFormUpload(ctx context.Context, id uuid.UUID) (*FormUpload, error)
+	ClaimFormUpload(ctx context.Context, id uuid.UUID, staleBefore time.Time) (bool, error)
+	ReleaseFormUpload(ctx context.Context, id uuid.UUID) error
+	DeleteFormUpload(ctx context.Context, id uuid.UUID) error
+	GetFormUploadsExpiredBefore(ctx context.Context, now, staleBefore time.Time) ([]FormUpload, error)
+	FinalizeVideoUpload(ctx context.Context, video Video, pendingID uuid.UUID, renditions []Rendition, audioTracks []AudioTrack) error
+	GetRenditions(ctx context.Context, videoID uuid.UUID) ([]Rendition, error)
+	GetRenditionQualityStats(ctx context.Context) ([]RenditionQualityStats, error)
+	EnsureHLSKey(ctx context.Context, videoID uuid.UUID) ([]byte, error)
+	GetHLSKey(ctx context.Context, videoID uuid.UUID) ([]byte, error)
+	SetGeoRestriction(ctx context.Context, videoID uuid.UUID, allowed, blocked []string) (GeoRestriction, error)
+	GetGeoRestriction(ctx context.Context, videoID uuid.UUID) (*GeoRestriction, error)
+	DeleteGeoRestriction(ctx context.Context, videoID uuid.UUID) error
+	SetEmbedSettings(ctx context.Context, videoID uuid.UUID, allowedDomains []string, requireToken bool) (EmbedSettings, error)
+	RevokeEmbedTokens(ctx context.Context, videoID uuid.UUID) (EmbedSettings, error)
+	GetEmbedSettings(ctx context.Context, videoID uuid.UUID) (*EmbedSettings, error)
+	DeleteEmbedSettings(ctx context.Context, videoID uuid.UUID) error
+	SetChapters(ctx context.Context, videoID uuid.UUID, chapters []Chapter) error
+	GetChapters(ctx context.Context, videoID uuid.UUID) ([]Chapter, error)
+	SetChapterSuggestions(ctx context.Context, videoID uuid.UUID, chapters []Chapter) error
+	GetChapterSuggestions(ctx context.Context, videoID uuid.UUID) ([]Chapter, error)
+	PublishChapterSuggestions(ctx context.Context, videoID uuid.UUID) error
+	GetAudioTracks(ctx context.Context, videoID uuid.UUID) ([]AudioTrack, error)
+	SetTranscript(ctx context.Context, videoID uuid.UUID, cues []TranscriptCue) error
+	GetTranscript(ctx context.Context, videoID uuid.UUID) ([]TranscriptCue, error)
+	SearchTranscript(ctx context.Context, videoID uuid.UUID, query string, limit int) ([]TranscriptCue, error)
+	SearchTranscripts(ctx context.Context, query string, snippets, limit, offset int) ([]TranscriptMatch, error)
+	CreateThumbnailVariant(ctx context.Context, videoID uuid.UUID, url string) (ThumbnailVariant, error)
+	GetThumbnailVariant(ctx context.Context, id uuid.UUID) (ThumbnailVariant, error)
+	GetThumbnailVariants(ctx context.Context, videoID uuid.UUID) ([]ThumbnailVariant, error)
+	GetThumbnailVariantURLs(ctx context.Context, videoIDs []uuid.UUID) (map[uuid.UUID]map[uuid.UUID]string, error)
+	RecordThumbnailImpressions(ctx context.Context, variantIDs []uuid.UUID) error
+	RecordThumbnailClick(ctx context.Context, variantID uuid.UUID, sessionID string, clickedAt time.Time) error
+	DeleteThumbnailVariant(ctx context.Context, id uuid.UUID) error
+
+	RecordDeliveryLog(ctx context.Context, key string, usage []DeliveryUsage) (bool, error)
+	GetLastDeliveryLog(ctx context.Context) (string, error)
+	FindVideoByS3Key(ctx context.Context, key string) (videoID, userID uuid.UUID, err error)
+	GetVideoDailyDelivery(ctx context.Context, videoID uuid.UUID, since time.Time) ([]DailyDelivery, error)
+	GetUserDailyDelivery(ctx context.Context, userID uuid.UUID, since time.Time) ([]DailyDelivery, error)
+	GetUserDeliveryByVideo(ctx context.Context, userID uuid.UUID, since time.Time, limit int) ([]VideoDelivery, error)
+	GetDeliveryByOwner(ctx context.Context, since time.Time, limit, offset int) ([]OwnerDelivery, error)
+
+	SetStreamKey(ctx context.Context, userID uuid.UUID, keyHash string) error
+	GetStreamKeyByHash(ctx context.Context, keyHash string) (*StreamKey, error)
+	GetStreamKey(ctx context.Context, userID uuid.UUID) (*StreamKey, error)
+	SetStreamKeyLowLatency(ctx context.Context, userID uuid.UUID, lowLatency bool) (*StreamKey, error)
+	StartLiveStream(ctx context.Context, params StartLiveStreamParams) (LiveStream, error)
+	EndLiveStream(ctx context.Context, id uuid.UUID, status VideoStatus) error
+	GetLiveStreams(ctx context.Context, userID uuid.UUID) ([]LiveStream, error)
+	GetLiveStreamByVideo(ctx context.Context, videoID uuid.UUID) (*LiveStream, error)
+	ListLiveStreams(ctx context.Context, userID uuid.UUID, limit, offset int) ([]LiveStream, error)
+
+	CreateJob(ctx context.Context, params CreateJobParams) (Job, error)
+	GetJob(ctx context.Context, id uuid.UUID) (Job, error)
+	GetLatestVideoJob(ctx context.Context, videoID uuid.UUID, jobType string) (Job, error)
+	ListJobs(ctx context.Context, status JobStatus, limit, offset int) ([]Job, error)
+	CountJobsByStatus(ctx context.Context) (map[JobStatus]int, error)
+	CountUnfinishedJobs(ctx context.Context, jobType string) (int, error)
+	ClaimJob(ctx context.Context, lease time.Duration, types JobTypes) (Job, error)
+	ExtendJobLease(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) (bool, error)
+	CompleteJob(ctx context.Context, id uuid.UUID) error
+	FailJob(ctx context.Context, id uuid.UUID, runErr, diagnostics string, retryAt time.Time) (retrying bool, err error)
+	ReleaseJob(ctx context.Context, id uuid.UUID, runAfter time.Time) error
+	RetryJob(ctx context.Context, id uuid.UUID) (bool, error)
+	CancelJob(ctx context.Context, id uuid.UUID) (bool, error)
+
+	CreateBackfill(ctx context.Context, createdBy uuid.UUID) (Backfill, error)
+	GetBackfill(ctx context.Context, id uuid.UUID) (*Backfill, error)
+	GetActiveBackfill(ctx context.Context) (*Backfill, error)
+	ListBackfills(ctx context.Context, limit, offset int) ([]Backfill, error)
+	SetBackfillStatus(ctx context.Context, id uuid.UUID, from, to BackfillStatus) (bool, error)
+	GetBackfillVideos(ctx context.Context, after *uuid.UUID, limit int) ([]uuid.UUID, error)
+	AdvanceBackfill(ctx context.Context, id, videoID uuid.UUID) error
+	RecordBackfillResult(ctx context.Context, id uuid.UUID, result BackfillResult) error
+
+	SlugAvailable(ctx context.Context, slug string, videoID uuid.UUID) (bool, error)
+	GetVideoBySlug(ctx context.Context, slug string) (Video, error)
+
+	AddVideoTag(ctx context.Context, videoID uuid.UUID, tag string) error
+	GetVideoTags(ctx context.Context, videoID uuid.UUID) ([]string, error)
+
+	GetRelatedVideoCandidates(ctx context.Context, video Video, titleWords []string, limit int) ([]Video, error)
+	GetTagsForVideos(ctx context.Context, videoIDs []uuid.UUID) (map[uuid.UUID][]string, error)
+
+	CreateChannel(ctx context.Context, params CreateChannelParams) (Channel, error)
+	GetChannel(ctx context.Context, id uuid.UUID) (Channel, error)
+	GetChannelsForUser(ctx context.Context, userID uuid.UUID) ([]Channel, error)
+	GetChannelRole(ctx context.Context, channelID, userID uuid.UUID) (ChannelRole, error)
+	GetChannelMembers(ctx context.Context, channelID uuid.UUID) ([]ChannelMember, error)
+	SetChannelMember(ctx context.Context, channelID, userID uuid.UUID, role ChannelRole) error
+	RemoveChannelMember(ctx context.Context, channelID, userID uuid.UUID) error
+	SetChannelDomain(ctx context.Context, channelID uuid.UUID, domain, token string) (ChannelDomain, error)
+	GetChannelDomain(ctx context.Context, channelID uuid.UUID) (*ChannelDomain, error)
+	GetChannelDomainByName(ctx context.Context, domain string) (*ChannelDomain, error)
+	ListChannelDomains(ctx context.Context) ([]ChannelDomain, error)
+	SetChannelDomainStatus(ctx context.Context, domain string, status ChannelDomainStatus, errMsg string) error
+	MarkChannelDomainDNSVerified(ctx context.Context, domain string) error
+	DeleteChannelDomain(ctx context.Context, channelID uuid.UUID) error
+
+	RecordWatch(ctx context.Context, userID, videoID uuid.UUID) (WatchHistoryEntry, error)
+	GetWatchHistory(ctx context.Context, userID uuid.UUID, limit, offset int) ([]WatchHistoryEntry, error)
+	ClearWatchHistory(ctx context.Context, userID uuid.UUID) error
+
+	CreateWebhookSubscription(ctx context.Context, params CreateWebhookSubscriptionParams) (WebhookSubscription, error)
+	GetWebhookSubscription(ctx context.Context, id uuid.UUID) (WebhookSubscription, error)
+	GetWebhookSubscriptions(ctx context.Context, userID uuid.UUID) ([]WebhookSubscription, error)
+	GetWebhookSubscriptionsForEvent(ctx context.Context, userID uuid.UUID, eventType string) ([]WebhookSubscription, error)
+	UpdateWebhookSubscription(ctx context.Context, id uuid.UUID, url string, eventTypes []string) error
+	DeleteWebhookSubscription(ctx context.Context, id uuid.UUID) error
+	CreateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit, offset int) ([]WebhookDelivery, error)
+
+	CreateVideoShare(ctx context.Context, params CreateVideoShareParams) (VideoShare, error)
+	GetVideoShareByToken(ctx context.Context, token string) (VideoShare, error)
+	RedeemVideoShare(ctx context.Context, token string) (VideoShare, error)
+	GetVideoShares(ctx context.Context, videoID uuid.UUID) ([]VideoShare, error)
+	DeleteVideoShare(ctx context.Context, id uuid.UUID) error
+
+	RecordView(ctx context.Context, videoID uuid.UUID) error
+	GetTopVideos(ctx context.Context, since time.Time, limit int) ([]RankedVideo, error)
+	RefreshTrendingScores(ctx context.Context, period string, length time.Duration) error
+	GetTrendingVideos(ctx context.Context, period string, limit int) ([]RankedVideo, error)
+	DeleteViewsBefore(ctx context.Context, cutoff time.Time) error
+
+	RecordPlaybackEvents(ctx context.Context, events []PlaybackEvent) error
+	GetPlaybackEventsSince(ctx context.Context, since time.Time) ([]PlaybackEvent, error)
+	DeletePlaybackEventsBefore(ctx context.Context, cutoff time.Time) error
+
+	GetHourlyViews(ctx context.Context, since time.Time) ([]HourlyViews, error)
+	ReplaceAnalytics(ctx context.Context, since time.Time, hourly []VideoAnalytics, heatmaps []VideoHeatmap) error
+	DeleteHourlyAnalyticsBefore(ctx context.Context, cutoff time.Time) error
+	GetVideoAnalytics(ctx context.Context, videoID uuid.UUID, period AnalyticsPeriod, since string) ([]AnalyticsBucket, error)
+	GetChannelAnalytics(ctx context.Context, channelID uuid.UUID, period AnalyticsPeriod, since string) ([]AnalyticsBucket, error)
+	GetVideoHeatmaps(ctx context.Context, videoID uuid.UUID, since string) ([]VideoHeatmap, error)
+
+	GetStorageReferences(ctx context.Context) ([]StorageReference, error)
+	RecordStorageDiscrepancies(ctx context.Context, found []StorageDiscrepancy) error
+	GetStorageDiscrepancy(ctx context.Context, id uuid.UUID) (*StorageDiscrepancy, error)
+	ListStorageDiscrepancies(ctx context.Context, kind StorageDiscrepancyKind, resolved bool, limit, offset int) ([]StorageDiscrepancy, error)
+	ResolveStorageDiscrepancy(ctx context.Context, id uuid.UUID, resolution string, resolvedBy *uuid.UUID) error
+	DeleteRendition(ctx context.Context, id uuid.UUID) error
+
+	SetPlaybackPosition(ctx context.Context, userID, videoID uuid.UUID, positionSeconds float64) (PlaybackPosition, error)
+	GetPlaybackPosition(ctx context.Context, userID, videoID uuid.UUID) (*PlaybackPosition, error)
+	DeletePlaybackPosition(ctx context.Context, userID, videoID uuid.UUID) error
+
+	AddToWatchLater(ctx context.Context, userID, videoID uuid.UUID) error
+	RemoveFromWatchLater(ctx context.Context, userID, videoID uuid.UUID) error
+	IsInWatchLater(ctx context.Context, userID, videoID uuid.UUID) (bool, error)
+	GetWatchLater(ctx context.Context, userID uuid.UUID, limit, offset int) ([]WatchLaterEntry, error)
+
+	CreateSubscription(ctx context.Context, subscriberID uuid.UUID, creatorID, channelID *uuid.UUID) (sub Subscription, created bool, err error)
+	GetSubscription(ctx context.Context, id uuid.UUID) (Subscription, error)
+	GetSubscriptions(ctx context.Context, subscriberID uuid.UUID) ([]Subscription, error)
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+	GetSubscriberIDs(ctx context.Context, creatorID uuid.UUID, channelID *uuid.UUID) ([]uuid.UUID, error)
+	GetSubscriptionFeed(ctx context.Context, subscriberID uuid.UUID, limit, offset int) ([]Video, error)
+
+	CreateNotification(ctx context.Context, params CreateNotificationParams) (*Notification, error)
+	GetNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit, offset int) ([]Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int, error)
+	MarkNotificationRead(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error)
+
+	CreateVideoReport(ctx context.Context, params CreateVideoReportParams) (report VideoReport, created bool, err error)
+
+	GetModerationQueue(ctx context.Context, limit, offset int) ([]ModerationQueueItem, error)
+	ResolveVideoReports(ctx context.Context, videoID uuid.UUID, resolution string) error
+	TakeDownVideo(ctx context.Context, id uuid.UUID) error
+	TakeDownUserVideos(ctx context.Context, userID uuid.UUID) error
+	IsUserAdmin(ctx context.Context, id uuid.UUID) (bool, error)
+	BanUser(ctx context.Context, id uuid.UUID) error
+	IsUserBanned(ctx context.Context, id uuid.UUID) (bool, error)
+	SaveModerationScan(ctx context.Context, scan ModerationScan) error
+	GetModerationScan(ctx context.Context, videoID uuid.UUID) (*ModerationScan, error)
+	GetModerationScans(ctx context.Context, verdict ModerationVerdict, limit, offset int) ([]ModerationScan, error)
+	SetVideoVirusScan(ctx context.Context, videoID uuid.UUID, scan VirusScan) error
+	QuarantineObject(ctx context.Context, params QuarantineObjectParams) (QuarantinedObject, error)
+	GetQuarantinedObject(ctx context.Context, videoID uuid.UUID) (*QuarantinedObject, error)
+	ListQuarantinedObjects(ctx context.Context, status QuarantineStatus, limit, offset int) ([]QuarantinedObject, error)
+	ReleaseQuarantinedObject(ctx context.Context, videoID, reviewerID uuid.UUID) error
+	RejectQuarantinedObject(ctx context.Context, videoID, reviewerID uuid.UUID) error
+
+	ListUsers(ctx context.Context, search string, limit, offset int) ([]AdminUser, error)
+	GetAdminUser(ctx context.Context, id uuid.UUID) (*AdminUser, error)
+	SuspendUser(ctx context.Context, id uuid.UUID) error
+	UnsuspendUser(ctx context.Context, id uuid.UUID) error
+	IsUserSuspended(ctx context.Context, id uuid.UUID) (bool, error)
+	RequirePasswordReset(ctx context.Context, id uuid.UUID) error
+	IsPasswordResetRequired(ctx context.Context, id uuid.UUID) (bool, error)
+	SetUserPassword(ctx context.Context, id uuid.UUID, hashedPassword string) error
+
+	CreateAuditLogEntry(ctx context.Context, params CreateAuditLogEntryParams) error
+	GetAuditLog(ctx context.Context, limit, offset int) ([]AuditLogEntry, error)
+
+	CreateDMCATakedown(ctx context.Context, params CreateDMCATakedownParams) (DMCATakedown, error)
+	GetDMCATakedown(ctx context.Context, id uuid.UUID) (DMCATakedown, error)
+	GetOpenDMCATakedownForVideo(ctx context.Context, videoID uuid.UUID) (DMCATakedown, error)
+	GetDMCATakedowns(ctx context.Context, status DMCATakedownStatus, limit, offset int) ([]DMCATakedown, error)
+	SubmitDMCACounterNotice(ctx context.Context, id uuid.UUID, statement string) error
+	RestoreDMCATakedown(ctx context.Context, id uuid.UUID) error
+
+	Reset(ctx context.Context) error
+}
+
+var _ Store = Client{}
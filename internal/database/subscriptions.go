@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscription follows either a creator or a channel; exactly one of
+// CreatorID and ChannelID is set.
+type Subscription struct {
+	ID           uuid.UUID  `json:"id"`
+	SubscriberID uuid.UUID  `json:"subscriber_id"`
+	CreatorID    *uuid.UUID `json:"creator_id"`
+	ChannelID    *uuid.UUID `json:"channel_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+const subscriptionColumns = `
+		id,
+		subscriber_id,
+		creator_id,
+		channel_id,
+		created_at`
+
+func scanSubscription(row rowScanner) (Subscription, error) {
+	var sub Subscription
+	err := row.Scan(
+		&sub.ID,
+		&sub.SubscriberID,
+		&sub.CreatorID,
+		&sub.ChannelID,
+		&sub.CreatedAt,
+	)
+	return sub, err
+}
+
+// CreateSubscription subscribes a user to a creator or channel. Subscribing
+// twice returns the existing subscription, with created false.
+func (c Client) CreateSubscription(ctx context.Context, subscriberID uuid.UUID, creatorID, channelID *uuid.UUID) (sub Subscription, created bool, err error) {
+	query := `
+	INSERT INTO subscriptions (
+		id,
+		subscriber_id,
+		creator_id,
+		channel_id,
+		created_at
+	) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT DO NOTHING
+	`
+	result, err := c.db.Exec(ctx, query, uuid.New(), subscriberID, creatorID, channelID)
+	if err != nil {
+		return Subscription{}, false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Subscription{}, false, err
+	}
+
+	query = `
+	SELECT` + subscriptionColumns + `
+	FROM subscriptions
+	WHERE subscriber_id = ? AND (creator_id = ? OR channel_id = ?)
+	`
+	sub, err = scanSubscription(c.db.QueryRow(ctx, query, subscriberID, creatorID, channelID))
+	return sub, n > 0, err
+}
+
+func (c Client) GetSubscription(ctx context.Context, id uuid.UUID) (Subscription, error) {
+	query := `
+	SELECT` + subscriptionColumns + `
+	FROM subscriptions
+	WHERE id = ?
+	`
+	sub, err := scanSubscription(c.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Subscription{}, nil
+		}
+		return Subscription{}, err
+	}
+	return sub, nil
+}
+
+func (c Client) GetSubscriptions(ctx context.Context, subscriberID uuid.UUID) ([]Subscription, error) {
+	query := `
+	SELECT` + subscriptionColumns + `
+	FROM subscriptions
+	WHERE subscriber_id = ?
+	ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(ctx, query, subscriberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (c Client) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM subscriptions WHERE id = ?", id)
+	return err
+}
+
+// GetSubscriberIDs lists the users subscribed to a creator or to a channel,
+// without duplicates. channelID may be nil.
+func (c Client) GetSubscriberIDs(ctx context.Context, creatorID uuid.UUID, channelID *uuid.UUID) ([]uuid.UUID, error) {
+	query := `
+	SELECT DISTINCT subscriber_id
+	FROM subscriptions
+	WHERE creator_id = ? OR (channel_id IS NOT NULL AND channel_id = ?)
+	`
+	rows, err := c.db.Query(ctx, query, creatorID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetSubscriptionFeed lists public, ready videos from everything a user
+// subscribes to, newest first.
+func (c Client) GetSubscriptionFeed(ctx context.Context, subscriberID uuid.UUID, limit, offset int) ([]Video, error) {
+	c = c.onReplica()
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at IS NULL
+		AND visibility = ?
+		AND status = ?
+		AND ` + ownerNotSuspended + `
+		AND (
+			user_id IN (SELECT creator_id FROM subscriptions WHERE subscriber_id = ? AND creator_id IS NOT NULL)
+			OR channel_id IN (SELECT channel_id FROM subscriptions WHERE subscriber_id = ? AND channel_id IS NOT NULL)
+		)
+	ORDER BY created_at DESC, id DESC
+	LIMIT ? OFFSET ?
+	`
+	return c.queryVideos(ctx, query, VisibilityPublic, VideoStatusReady, subscriberID, subscriberID, limit, offset)
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+func (c Client) AddVideoTag(ctx context.Context, videoID uuid.UUID, tag string) error {
+	query := `
+	INSERT INTO video_tags (
+		video_id,
+		tag
+	) VALUES (?, ?)
+	ON CONFLICT DO NOTHING
+	`
+	_, err := c.db.Exec(ctx, query, videoID, tag)
+	return err
+}
+
+func (c Client) GetVideoTags(ctx context.Context, videoID uuid.UUID) ([]string, error) {
+	query := `
+	SELECT tag
+	FROM video_tags
+	WHERE video_id = ?
+	ORDER BY tag
+	`
+	rows, err := c.db.Query(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
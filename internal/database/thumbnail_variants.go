@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ThumbnailVariant is one of the candidate thumbnails shown in rotation
+// while a video's owner tests which gets the most clicks. Impressions are
+// the times it was shown in a listing, and Clicks the playback sessions
+// that started from it.
+type ThumbnailVariant struct {
+	ID          uuid.UUID `json:"id"`
+	VideoID     uuid.UUID `json:"video_id"`
+	URL         string    `json:"url"`
+	Impressions int64     `json:"impressions"`
+	Clicks      int64     `json:"clicks"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (c *Client) migrateThumbnailVariants(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS thumbnail_variants (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		impressions INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(ctx, "CREATE INDEX IF NOT EXISTS idx_thumbnail_variants_video ON thumbnail_variants(video_id, created_at)")
+	if err != nil {
+		return err
+	}
+	// A session counts as one click however many times its player
+	// reports it.
+	_, err = c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS thumbnail_variant_clicks (
+		variant_id TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		clicked_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(variant_id, session_id),
+		FOREIGN KEY(variant_id) REFERENCES thumbnail_variants(id)
+	);
+	`)
+	return err
+}
+
+const thumbnailVariantColumns = `
+		id,
+		video_id,
+		url,
+		impressions,
+		(SELECT COUNT(*) FROM thumbnail_variant_clicks WHERE variant_id = thumbnail_variants.id),
+		created_at`
+
+func scanThumbnailVariant(row rowScanner) (ThumbnailVariant, error) {
+	var v ThumbnailVariant
+	err := row.Scan(&v.ID, &v.VideoID, &v.URL, &v.Impressions, &v.Clicks, &v.CreatedAt)
+	return v, err
+}
+
+// CreateThumbnailVariant adds a candidate thumbnail to a video.
+func (c Client) CreateThumbnailVariant(ctx context.Context, videoID uuid.UUID, url string) (ThumbnailVariant, error) {
+	id := uuid.New()
+	_, err := c.db.Exec(ctx, `
+	INSERT INTO thumbnail_variants (id, video_id, url, impressions, created_at)
+	VALUES (?, ?, ?, 0, CURRENT_TIMESTAMP)
+	`, id, videoID, url)
+	if err != nil {
+		return ThumbnailVariant{}, err
+	}
+	return c.GetThumbnailVariant(ctx, id)
+}
+
+// GetThumbnailVariant returns a zero ThumbnailVariant if there's no
+// variant with the ID.
+func (c Client) GetThumbnailVariant(ctx context.Context, id uuid.UUID) (ThumbnailVariant, error) {
+	query := `
+	SELECT` + thumbnailVariantColumns + `
+	FROM thumbnail_variants
+	WHERE id = ?
+	`
+	v, err := scanThumbnailVariant(c.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ThumbnailVariant{}, nil
+		}
+		return ThumbnailVariant{}, err
+	}
+	return v, nil
+}
+
+// GetThumbnailVariants returns a video's candidate thumbnails, oldest
+// first.
+func (c Client) GetThumbnailVariants(ctx context.Context, videoID uuid.UUID) ([]ThumbnailVariant, error) {
+	query := `
+	SELECT` + thumbnailVariantColumns + `
+	FROM thumbnail_variants
+	WHERE video_id = ?
+	ORDER BY created_at, id
+	`
+	rows, err := c.onReplica().db.Query(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []ThumbnailVariant{}
+	for rows.Next() {
+		v, err := scanThumbnailVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// GetThumbnailVariantURLs returns the candidate thumbnails of each of the
+// given videos that has any, as variant ID to URL. It leaves out the
+// counts, since it's read for every listing.
+func (c Client) GetThumbnailVariantURLs(ctx context.Context, videoIDs []uuid.UUID) (map[uuid.UUID]map[uuid.UUID]string, error) {
+	variants := map[uuid.UUID]map[uuid.UUID]string{}
+	if len(videoIDs) == 0 {
+		return variants, nil
+	}
+	query := "SELECT id, video_id, url FROM thumbnail_variants WHERE video_id IN (?" + strings.Repeat(", ?", len(videoIDs)-1) + ")"
+	args := make([]any, len(videoIDs))
+	for i, id := range videoIDs {
+		args[i] = id
+	}
+	rows, err := c.onReplica().db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, videoID uuid.UUID
+		var url string
+		if err := rows.Scan(&id, &videoID, &url); err != nil {
+			return nil, err
+		}
+		if variants[videoID] == nil {
+			variants[videoID] = map[uuid.UUID]string{}
+		}
+		variants[videoID][id] = url
+	}
+	return variants, rows.Err()
+}
+
+// RecordThumbnailImpressions counts one impression for each variant ID,
+// repeating an ID to count it more than once.
+func (c Client) RecordThumbnailImpressions(ctx context.Context, variantIDs []uuid.UUID) error {
+	if len(variantIDs) == 0 {
+		return nil
+	}
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range variantIDs {
+		if _, err := tx.Exec("UPDATE thumbnail_variants SET impressions = impressions + 1 WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RecordThumbnailClick counts a playback session as a click on a variant.
+// Repeat reports from the same session are ignored.
+func (c Client) RecordThumbnailClick(ctx context.Context, variantID uuid.UUID, sessionID string, clickedAt time.Time) error {
+	_, err := c.db.Exec(ctx, `
+	INSERT INTO thumbnail_variant_clicks (variant_id, session_id, clicked_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT DO NOTHING
+	`, variantID, sessionID, formatTimestamp(clickedAt))
+	return err
+}
+
+// DeleteThumbnailVariant removes a variant and its clicks.
+func (c Client) DeleteThumbnailVariant(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM thumbnail_variant_clicks WHERE variant_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM thumbnail_variants WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
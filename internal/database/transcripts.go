@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// TranscriptCue is a line of a video's captions, shown from StartSeconds to
+// EndSeconds.
+type TranscriptCue struct {
+	StartSeconds float64 `json:"start_seconds"`
+	EndSeconds   float64 `json:"end_seconds"`
+	Text         string  `json:"text"`
+}
+
+func (c *Client) migrateTranscripts(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS video_transcript_cues (
+		video_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		start_seconds REAL NOT NULL,
+		end_seconds REAL NOT NULL,
+		text TEXT NOT NULL,
+		PRIMARY KEY(video_id, position),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`)
+	return err
+}
+
+// SetTranscript replaces a video's transcript. An empty list removes it.
+func (c Client) SetTranscript(ctx context.Context, videoID uuid.UUID, cues []TranscriptCue) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM video_transcript_cues WHERE video_id = ?", videoID); err != nil {
+		return err
+	}
+	for i, cue := range cues {
+		_, err := tx.Exec(`
+		INSERT INTO video_transcript_cues (video_id, position, start_seconds, end_seconds, text)
+		VALUES (?, ?, ?, ?, ?)
+		`, videoID, i, cue.StartSeconds, cue.EndSeconds, cue.Text)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTranscript returns a video's transcript in order.
+func (c Client) GetTranscript(ctx context.Context, videoID uuid.UUID) ([]TranscriptCue, error) {
+	return c.queryCues(ctx, "SELECT start_seconds, end_seconds, text FROM video_transcript_cues WHERE video_id = ? ORDER BY position", videoID)
+}
+
+// TranscriptMatch is a video whose transcript matched a search, with the
+// first few cues that matched.
+type TranscriptMatch struct {
+	Video    Video
+	Snippets []TranscriptCue
+}
+
+// migrateTranscriptSearch indexes transcript text for searching. SQLite gets
+// an FTS4 table kept in step with the cues by triggers; go-sqlite3 only
+// builds FTS5 with the sqlite_fts5 tag. Postgres gets a GIN index on the
+// cues' text search vector.
+func (c *Client) migrateTranscriptSearch(ctx context.Context) error {
+	statements := []string{
+		"CREATE INDEX IF NOT EXISTS idx_video_transcript_cues_search ON video_transcript_cues USING GIN (to_tsvector('simple', text))",
+	}
+	if c.db.dialect != dialectPostgres {
+		statements = []string{
+			`CREATE VIRTUAL TABLE IF NOT EXISTS video_transcript_cues_fts USING fts4(content="video_transcript_cues", text, tokenize=unicode61)`,
+			`CREATE TRIGGER IF NOT EXISTS video_transcript_cues_fts_insert AFTER INSERT ON video_transcript_cues BEGIN
+				INSERT INTO video_transcript_cues_fts(docid, text) VALUES (new.rowid, new.text);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS video_transcript_cues_fts_delete BEFORE DELETE ON video_transcript_cues BEGIN
+				DELETE FROM video_transcript_cues_fts WHERE docid = old.rowid;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS video_transcript_cues_fts_update_before BEFORE UPDATE ON video_transcript_cues BEGIN
+				DELETE FROM video_transcript_cues_fts WHERE docid = old.rowid;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS video_transcript_cues_fts_update_after AFTER UPDATE ON video_transcript_cues BEGIN
+				INSERT INTO video_transcript_cues_fts(docid, text) VALUES (new.rowid, new.text);
+			END`,
+			"INSERT INTO video_transcript_cues_fts(video_transcript_cues_fts) VALUES ('rebuild')",
+		}
+	}
+	for _, statement := range statements {
+		if _, err := c.db.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transcriptTerms splits a search into the lowercased words the full-text
+// index matches on. Punctuation, including LIKE and MATCH syntax, separates
+// words and is otherwise ignored.
+func transcriptTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// transcriptMatch returns a condition on video_transcript_cues, aliased c,
+// that's true for cues containing the words of terms in order, the last
+// letters of each word optional, and its parameter.
+func (d dialect) transcriptMatch(terms []string) (string, string) {
+	if d == dialectPostgres {
+		words := make([]string, len(terms))
+		for i, term := range terms {
+			words[i] = term + ":*"
+		}
+		return "to_tsvector('simple', c.text) @@ to_tsquery('simple', ?)", strings.Join(words, " <-> ")
+	}
+	words := make([]string, len(terms))
+	for i, term := range terms {
+		words[i] = term + "*"
+	}
+	return "c.rowid IN (SELECT docid FROM video_transcript_cues_fts WHERE video_transcript_cues_fts MATCH ?)", `"` + strings.Join(words, " ") + `"`
+}
+
+// SearchTranscript returns the cues of a video's transcript that say query,
+// ignoring case, in order.
+func (c Client) SearchTranscript(ctx context.Context, videoID uuid.UUID, query string, limit int) ([]TranscriptCue, error) {
+	terms := transcriptTerms(query)
+	if len(terms) == 0 {
+		return []TranscriptCue{}, nil
+	}
+	c = c.onReplica()
+	match, arg := c.db.dialect.transcriptMatch(terms)
+	return c.queryCues(ctx, `
+	SELECT c.start_seconds, c.end_seconds, c.text
+	FROM video_transcript_cues c
+	WHERE c.video_id = ? AND `+match+`
+	ORDER BY c.position
+	LIMIT ?
+	`, videoID, arg, limit)
+}
+
+// SearchTranscripts returns public, processed videos whose transcripts say
+// query, ignoring case, newest first, each with up to snippets of the cues
+// that say it.
+func (c Client) SearchTranscripts(ctx context.Context, query string, snippets, limit, offset int) ([]TranscriptMatch, error) {
+	terms := transcriptTerms(query)
+	if len(terms) == 0 {
+		return []TranscriptMatch{}, nil
+	}
+	c = c.onReplica()
+	match, arg := c.db.dialect.transcriptMatch(terms)
+	rows, err := c.db.Query(ctx, `
+	WITH matches AS (
+		SELECT c.video_id, c.position, c.start_seconds, c.end_seconds, c.text,
+			ROW_NUMBER() OVER (PARTITION BY c.video_id ORDER BY c.position) AS n
+		FROM video_transcript_cues c
+		WHERE `+match+`
+	), page AS (
+		SELECT`+videoColumns+`
+		FROM videos
+		WHERE deleted_at IS NULL AND visibility = ? AND status = ? AND `+ownerNotSuspended+`
+			AND id IN (SELECT video_id FROM matches)
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?
+	)
+	SELECT page.*, m.start_seconds, m.end_seconds, m.text
+	FROM page
+	JOIN matches m ON m.video_id = page.id AND m.n <= ?
+	ORDER BY page.created_at DESC, page.id, m.position
+	`, arg, VisibilityPublic, VideoStatusReady, limit, offset, snippets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []TranscriptMatch{}
+	for rows.Next() {
+		var cue TranscriptCue
+		video, err := scanVideo(trailingScanner{row: rows, extra: []any{&cue.StartSeconds, &cue.EndSeconds, &cue.Text}})
+		if err != nil {
+			return nil, err
+		}
+		if n := len(results); n == 0 || results[n-1].Video.ID != video.ID {
+			results = append(results, TranscriptMatch{Video: video})
+		}
+		last := &results[len(results)-1]
+		last.Snippets = append(last.Snippets, cue)
+	}
+	return results, rows.Err()
+}
+
+func (c Client) queryCues(ctx context.Context, query string, args ...any) ([]TranscriptCue, error) {
+	rows, err := c.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cues := []TranscriptCue{}
+	for rows.Next() {
+		var cue TranscriptCue
+		if err := rows.Scan(&cue.StartSeconds, &cue.EndSeconds, &cue.Text); err != nil {
+			return nil, err
+		}
+		cues = append(cues, cue)
+	}
+	return cues, rows.Err()
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSearchTranscript(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	video := createTestVideo(t, c, CreateVideoParams{})
+	cues := []TranscriptCue{
+		{StartSeconds: 0, EndSeconds: 2, Text: "Welcome back to the channel"},
+		{StartSeconds: 2, EndSeconds: 4, Text: "Today we visit an ÉCOLE in Lyon"},
+		{StartSeconds: 4, EndSeconds: 6, Text: "Prices went up 50% this year"},
+		{StartSeconds: 6, EndSeconds: 8, Text: "See you next time"},
+	}
+	if err := c.SetTranscript(ctx, video.ID, cues); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"welcome BACK", []string{cues[0].Text}},
+		{"école", []string{cues[1].Text}},
+		{"Ecole", []string{cues[1].Text}},
+		{"pric", []string{cues[2].Text}},
+		{"back welcome", nil},
+		{"%", nil},
+		{"_", nil},
+		{`"`, nil},
+		{"time OR channel", nil},
+	}
+	for _, tt := range tests {
+		got, err := c.SearchTranscript(ctx, video.ID, tt.query, 10)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q matched %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Text != tt.want[i] {
+				t.Errorf("%q matched %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// Replacing the transcript drops the old cues from the index.
+	if err := c.SetTranscript(ctx, video.ID, cues[3:]); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.SearchTranscript(ctx, video.ID, "welcome", 10); err != nil || len(got) != 0 {
+		t.Errorf("replaced cue still matched: %v, %v", got, err)
+	}
+}
+
+func TestSearchTranscripts(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	newVideo := func(visibility Visibility, lines ...string) Video {
+		video := createTestVideo(t, c, CreateVideoParams{Visibility: visibility})
+		if err := c.SetVideoStatus(ctx, video.ID, VideoStatusReady); err != nil {
+			t.Fatal(err)
+		}
+		cues := make([]TranscriptCue, len(lines))
+		for i, line := range lines {
+			cues[i] = TranscriptCue{StartSeconds: float64(i), EndSeconds: float64(i + 1), Text: line}
+		}
+		if err := c.SetTranscript(ctx, video.ID, cues); err != nil {
+			t.Fatal(err)
+		}
+		return video
+	}
+	older := newVideo(VisibilityPublic, "hello there", "nothing here", "hello again", "hello once more")
+	newer := newVideo(VisibilityPublic, "well hello")
+	newVideo(VisibilityPrivate, "hello from a private video")
+	newVideo(VisibilityPublic, "goodbye")
+
+	matches, err := c.SearchTranscripts(ctx, "HELLO", 2, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("matches = %+v, want the two public videos", matches)
+	}
+	snippets := map[uuid.UUID][]TranscriptCue{}
+	for _, match := range matches {
+		snippets[match.Video.ID] = match.Snippets
+	}
+	if s := snippets[newer.ID]; len(s) != 1 || s[0].Text != "well hello" {
+		t.Errorf("newer snippets = %v", s)
+	}
+	if s := snippets[older.ID]; len(s) != 2 || s[0].Text != "hello there" || s[1].Text != "hello again" {
+		t.Errorf("older snippets = %v, want the first two matching cues", s)
+	}
+
+	page, err := c.SearchTranscripts(ctx, "hello", 2, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].Video.ID != matches[1].Video.ID || len(page[0].Snippets) != len(matches[1].Snippets) {
+		t.Errorf("second page = %+v, want %+v", page, matches[1:])
+	}
+
+	if matches, err := c.SearchTranscripts(ctx, "%", 2, 10, 0); err != nil || len(matches) != 0 {
+		t.Errorf("wildcard search matched %+v, %v", matches, err)
+	}
+}
@@ -1,31 +1,122 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type VideoStatus string
+
+const (
+	// VideoStatusDraft videos have metadata but no uploaded file yet.
+	VideoStatusDraft      VideoStatus = "draft"
+	VideoStatusProcessing VideoStatus = "processing"
+	VideoStatusReady      VideoStatus = "ready"
+	VideoStatusFailed     VideoStatus = "failed"
+	// VideoStatusLive videos are being streamed live.
+	VideoStatusLive VideoStatus = "live"
+)
+
+func (s VideoStatus) Valid() bool {
+	switch s {
+	case VideoStatusDraft, VideoStatusProcessing, VideoStatusReady, VideoStatusFailed, VideoStatusLive:
+		return true
+	}
+	return false
+}
+
+// Aspect buckets a video's orientation.
+type Aspect string
+
+const (
+	AspectLandscape Aspect = "landscape"
+	AspectPortrait  Aspect = "portrait"
+	AspectOther     Aspect = "other"
+)
+
+func (a Aspect) Valid() bool {
+	switch a {
+	case AspectLandscape, AspectPortrait, AspectOther:
+		return true
+	}
+	return false
+}
+
+type Visibility string
+
+const (
+	VisibilityPublic   Visibility = "public"
+	VisibilityUnlisted Visibility = "unlisted"
+	VisibilityPrivate  Visibility = "private"
+)
+
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// MediaInfo holds technical properties of the stored video file, collected
+// during processing. Fields are nil until a file has been processed.
+type MediaInfo struct {
+	DurationSeconds *float64 `json:"duration_seconds"`
+	Width           *int     `json:"width"`
+	Height          *int     `json:"height"`
+	FrameRate       *float64 `json:"frame_rate"`
+	SizeBytes       *int64   `json:"size_bytes"`
+	// Projection is how a 360° video's picture maps onto the sphere, such as
+	// "equirectangular", or nil for a flat video.
+	Projection *string `json:"projection"`
+	// HDR is the HDR format of the video's file, "hdr10" or "hlg", or nil
+	// for SDR.
+	HDR *string `json:"hdr"`
+}
+
+// ErrVideoConflict is returned by updates that expected an older version of
+// the video than the one stored. Video.Version is incremented by every
+// metadata update.
+var ErrVideoConflict = errors.New("video was modified by another request")
+
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID           uuid.UUID   `json:"id"`
+	Slug         *string     `json:"slug"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	ThumbnailURL *string     `json:"thumbnail_url"`
+	VideoURL     *string     `json:"video_url"`
+	DeletedAt    *time.Time  `json:"deleted_at,omitempty"`
+	TakenDownAt  *time.Time  `json:"taken_down_at,omitempty"`
+	LegalHold    bool        `json:"legal_hold,omitempty"`
+	RetainUntil  *time.Time  `json:"retain_until,omitempty"`
+	Tags         []string    `json:"tags,omitempty"`
+	Status       VideoStatus `json:"status"`
+	Aspect       *Aspect     `json:"aspect"`
+	Version      int         `json:"version"`
+
+	// ThumbnailVariantID is set on listings when ThumbnailURL is one of
+	// the video's candidate thumbnails, for players to report clicks on.
+	ThumbnailVariantID *uuid.UUID `json:"thumbnail_variant_id,omitempty"`
+	MediaInfo
 	CreateVideoParams
 }
 
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	UserID      uuid.UUID  `json:"user_id"`
+	ChannelID   *uuid.UUID `json:"channel_id"`
+	Visibility  Visibility `json:"visibility"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,13 +124,74 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
+		user_id,
+		visibility,
+		deleted_at,
+		duration_seconds,
+		width,
+		height,
+		frame_rate,
+		size_bytes,
+		projection,
+		hdr,
+		status,
+		aspect,
+		channel_id,
+		slug,
+		taken_down_at,
+		legal_hold,
+		retain_until,
+		version`
 
-	rows, err := c.db.Query(query, userID)
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// trailingScanner scans extra columns selected after videoColumns, so
+// scanVideo can be reused by queries that join in per-row values.
+type trailingScanner struct {
+	row   rowScanner
+	extra []any
+}
+
+func (s trailingScanner) Scan(dest ...any) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.UserID,
+		&video.Visibility,
+		&video.DeletedAt,
+		&video.DurationSeconds,
+		&video.Width,
+		&video.Height,
+		&video.FrameRate,
+		&video.SizeBytes,
+		&video.Projection,
+		&video.HDR,
+		&video.Status,
+		&video.Aspect,
+		&video.ChannelID,
+		&video.Slug,
+		&video.TakenDownAt,
+		&video.LegalHold,
+		&video.RetainUntil,
+		&video.Version,
+	)
+	return video, err
+}
+
+func (c Client) queryVideos(ctx context.Context, query string, args ...any) ([]Video, error) {
+	rows, err := c.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,27 +199,157 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
 
-	return videos, nil
+	return videos, rows.Err()
+}
+
+func (c Client) GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NULL
+	ORDER BY created_at DESC
+	`
+	return c.queryVideos(ctx, query, userID)
+}
+
+// GetTrashedVideos lists a user's soft-deleted videos, most recently deleted
+// first.
+func (c Client) GetTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC
+	`
+	return c.queryVideos(ctx, query, userID)
+}
+
+// GetVideosDeletedBefore lists soft-deleted videos whose retention period has
+// elapsed. Videos under legal hold, or whose files are still under Object
+// Lock retention, are never returned.
+func (c Client) GetVideosDeletedBefore(ctx context.Context, cutoff time.Time) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at IS NOT NULL AND deleted_at < ? AND NOT legal_hold
+		AND (retain_until IS NULL OR retain_until < ?)
+	`
+	return c.queryVideos(ctx, query, cutoff, time.Now().UTC())
+}
+
+// PageCursor identifies a row's position in the created_at, id ordering
+// used by paginated listings.
+type PageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (v Video) Cursor() PageCursor {
+	return PageCursor{CreatedAt: v.CreatedAt, ID: v.ID}
+}
+
+// ListVideosParams filters and pages a video listing. Trashed videos are
+// never included. At most one of After and Before may be set.
+type ListVideosParams struct {
+	// UserID restricts the listing to one owner when set.
+	UserID uuid.UUID
+	// ChannelID restricts the listing to one channel when set.
+	ChannelID uuid.UUID
+	// PublicOnly restricts the listing to public videos.
+	PublicOnly bool
+	Status     VideoStatus
+	Aspect     Aspect
+	Limit      int
+	After      *PageCursor
+	Before     *PageCursor
+}
+
+// ListVideos returns a page of videos, newest first, using keyset pagination
+// so pages stay stable while new videos are created. more reports whether
+// further rows exist beyond the page in the direction of travel.
+func (c Client) ListVideos(ctx context.Context, params ListVideosParams) (videos []Video, more bool, err error) {
+	c = c.onReplica()
+	where := []string{"deleted_at IS NULL"}
+	args := []any{}
+	if params.UserID != uuid.Nil {
+		where = append(where, "user_id = ?")
+		args = append(args, params.UserID)
+	}
+	if params.ChannelID != uuid.Nil {
+		where = append(where, "channel_id = ?")
+		args = append(args, params.ChannelID)
+	}
+	if params.PublicOnly {
+		where = append(where, "visibility = ?", ownerNotSuspended)
+		args = append(args, VisibilityPublic)
+	}
+	if params.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, params.Status)
+	}
+	if params.Aspect != "" {
+		where = append(where, "aspect = ?")
+		args = append(args, params.Aspect)
+	}
+
+	order := "created_at DESC, id DESC"
+	switch {
+	case params.After != nil:
+		where = append(where, "(created_at < ? OR (created_at = ? AND id < ?))")
+		ts := formatTimestamp(params.After.CreatedAt)
+		args = append(args, ts, ts, params.After.ID.String())
+	case params.Before != nil:
+		where = append(where, "(created_at > ? OR (created_at = ? AND id > ?))")
+		ts := formatTimestamp(params.Before.CreatedAt)
+		args = append(args, ts, ts, params.Before.ID.String())
+		order = "created_at ASC, id ASC"
+	}
+
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY ` + order + `
+	LIMIT ?
+	`
+	args = append(args, params.Limit+1)
+
+	videos, err = c.queryVideos(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(videos) > params.Limit {
+		videos = videos[:params.Limit]
+		more = true
+	}
+	if params.Before != nil {
+		slices.Reverse(videos)
+	}
+	return videos, more, nil
+}
+
+// formatTimestamp formats a time the way SQLite's CURRENT_TIMESTAMP stores
+// it, so comparisons against defaulted columns work on the stored text.
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
 }
 
-func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
+func (c Client) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
 	id := uuid.New()
+	if params.Visibility == "" {
+		params.Visibility = VisibilityUnlisted
+	}
+	slug, err := c.uniqueSlug(ctx, params.Title, id)
+	if err != nil {
+		return Video{}, err
+	}
 	query := `
 	INSERT INTO videos (
 		id,
@@ -75,42 +357,28 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		user_id,
+		channel_id,
+		visibility,
+		slug
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err = c.db.Exec(ctx, query, id, params.Title, params.Description, params.UserID, params.ChannelID, params.Visibility, slug)
 	if err != nil {
 		return Video{}, err
 	}
 
-	return c.GetVideo(id)
+	return c.GetVideo(ctx, id)
 }
 
-func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+func (c Client) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -118,38 +386,312 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		return Video{}, err
 	}
 
+	video.Tags, err = c.GetVideoTags(ctx, id)
+	if err != nil {
+		return Video{}, err
+	}
+
 	return video, nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
-	query := `
+const updateVideoQuery = `
 	UPDATE videos
 	SET
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
-	WHERE id = ?
+		user_id = ?,
+		visibility = ?,
+		duration_seconds = ?,
+		width = ?,
+		height = ?,
+		frame_rate = ?,
+		size_bytes = ?,
+		projection = ?,
+		hdr = ?,
+		status = ?,
+		aspect = ?,
+		channel_id = ?,
+		slug = ?,
+		version = version + 1
+	WHERE id = ? AND version = ?
 	`
 
-	_, err := c.db.Exec(
-		query,
+func updateVideoArgs(video Video) []any {
+	return []any{
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
 		video.UserID,
+		video.Visibility,
+		video.DurationSeconds,
+		video.Width,
+		video.Height,
+		video.FrameRate,
+		video.SizeBytes,
+		video.Projection,
+		video.HDR,
+		video.Status,
+		video.Aspect,
+		video.ChannelID,
+		video.Slug,
 		video.ID,
-	)
+		video.Version,
+	}
+}
+
+// UpdateVideo writes every column of the video. It fails with
+// ErrVideoConflict if the stored video is no longer at video.Version.
+func (c Client) UpdateVideo(ctx context.Context, video Video) error {
+	result, err := c.db.Exec(ctx, updateVideoQuery, updateVideoArgs(video)...)
+	if err != nil {
+		return err
+	}
+	return checkVideoUpdated(result)
+}
+
+func checkVideoUpdated(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVideoConflict
+	}
+	return nil
+}
+
+// UpdateVideoMetadataParams describes a partial update. Nil fields are left
+// unchanged; a non-nil Tags replaces the video's full tag set.
+type UpdateVideoMetadataParams struct {
+	Title       *string
+	Description *string
+	Visibility  *Visibility
+	Slug        *string
+	Tags        *[]string
+	// Version, when set, makes the update fail with ErrVideoConflict unless
+	// the stored video is still at that version.
+	Version *int
+}
+
+// UpdateVideoMetadata applies a partial update to the editable metadata of a
+// video in a single transaction, leaving columns like video_url untouched.
+func (c Client) UpdateVideoMetadata(ctx context.Context, id uuid.UUID, params UpdateVideoMetadataParams) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sets := []string{"updated_at = CURRENT_TIMESTAMP", "version = version + 1"}
+	args := []any{}
+	if params.Title != nil {
+		sets = append(sets, "title = ?")
+		args = append(args, *params.Title)
+	}
+	if params.Description != nil {
+		sets = append(sets, "description = ?")
+		args = append(args, *params.Description)
+	}
+	if params.Visibility != nil {
+		sets = append(sets, "visibility = ?")
+		args = append(args, *params.Visibility)
+	}
+	if params.Slug != nil {
+		sets = append(sets, "slug = ?")
+		args = append(args, *params.Slug)
+	}
+	args = append(args, id)
+
+	query := "UPDATE videos SET " + strings.Join(sets, ", ") + " WHERE id = ?"
+	if params.Version != nil {
+		query += " AND version = ?"
+		args = append(args, *params.Version)
+	}
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if err := checkVideoUpdated(result); err != nil {
+		return err
+	}
+
+	if params.Tags != nil {
+		if _, err := tx.Exec("DELETE FROM video_tags WHERE video_id = ?", id); err != nil {
+			return err
+		}
+		for _, tag := range *params.Tags {
+			if _, err := tx.Exec("INSERT INTO video_tags (video_id, tag) VALUES (?, ?) ON CONFLICT DO NOTHING", id, tag); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (c Client) SetVideoStatus(ctx context.Context, id uuid.UUID, status VideoStatus) error {
+	query := `
+	UPDATE videos
+	SET status = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(ctx, query, status, id)
+	return err
+}
+
+func (c Client) SetVideoVisibility(ctx context.Context, id uuid.UUID, visibility Visibility) error {
+	query := `
+	UPDATE videos
+	SET visibility = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(ctx, query, visibility, id)
+	return err
+}
+
+// SoftDeleteVideo moves a video to the trash. The row and its stored objects
+// are kept until RestoreVideo is called or the video is purged.
+func (c Client) SoftDeleteVideo(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = ?
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	_, err := c.db.Exec(ctx, query, time.Now().UTC(), id)
 	return err
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
+func (c Client) RestoreVideo(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = NULL
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(ctx, query, id)
+	return err
+}
+
+// DeleteVideo permanently removes a video and the rows that reference it.
+func (c Client) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	if _, err := c.db.Exec(ctx, "DELETE FROM watch_history WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_tags WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_shares WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_views WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM playback_events WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_analytics WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_heatmaps WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM trending_scores WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM playback_positions WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM watch_later WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM notifications WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_reports WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM dmca_takedowns WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM moderation_scans WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM quarantined_objects WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM pending_uploads WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM resumable_upload_parts WHERE upload_id IN (SELECT id FROM resumable_uploads WHERE video_id = ?)", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM resumable_uploads WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM form_uploads WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM jobs WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM renditions WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM hls_keys WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM geo_restrictions WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM thumbnail_variant_clicks WHERE variant_id IN (SELECT id FROM thumbnail_variants WHERE video_id = ?)", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM thumbnail_variants WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM audio_tracks WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM chapter_suggestions WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_transcript_cues WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM video_chapters WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM embed_settings WHERE video_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(ctx, "DELETE FROM live_streams WHERE video_id = ?", id); err != nil {
+		return err
+	}
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
+	_, err := c.db.Exec(ctx, query, id)
+	return err
+}
+
+func (c *Client) migrateVideoVersion(ctx context.Context) error {
+	return c.addColumnIfMissing(ctx, "videos", "version", "INTEGER NOT NULL DEFAULT 0")
+}
+
+func (c *Client) migrateVideoProjection(ctx context.Context) error {
+	return c.addColumnIfMissing(ctx, "videos", "projection", "TEXT")
+}
+
+func (c *Client) migrateVideoHDR(ctx context.Context) error {
+	return c.addColumnIfMissing(ctx, "videos", "hdr", "TEXT")
+}
+
+// migrateVideoStatusBackfill marks videos uploaded before statuses existed
+// as ready; the baseline gave them the column's draft default.
+func (c *Client) migrateVideoStatusBackfill(ctx context.Context) error {
+	_, err := c.db.Exec(ctx, "UPDATE videos SET status = 'ready' WHERE video_url IS NOT NULL AND status = 'draft'")
 	return err
 }
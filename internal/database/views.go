@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RankedVideo is a video with the view count it was ranked by.
+type RankedVideo struct {
+	Video
+	Views int `json:"views"`
+}
+
+// RecordView counts one playback of a video, signed in or not. Unlike
+// watch_history these rows aren't tied to a user; they feed the windowed
+// rankings and are pruned once older than every window, while the video's
+// view_count keeps the all-time total. view_count is deliberately left out of
+// Video so that views don't change the video's ETag.
+func (c Client) RecordView(ctx context.Context, videoID uuid.UUID) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"INSERT INTO video_views (video_id, viewed_at) VALUES (?, ?)",
+		videoID, formatTimestamp(time.Now()),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE videos SET view_count = view_count + 1 WHERE id = ?", videoID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTopVideos ranks public, ready videos by views since the given time, or
+// by all-time views when since is zero.
+func (c Client) GetTopVideos(ctx context.Context, since time.Time, limit int) ([]RankedVideo, error) {
+	c = c.onReplica()
+	if since.IsZero() {
+		query := `
+		SELECT` + videoColumns + `, view_count
+		FROM videos
+		WHERE deleted_at IS NULL AND visibility = ? AND status = ? AND view_count > 0 AND ` + ownerNotSuspended + `
+		ORDER BY view_count DESC, created_at DESC
+		LIMIT ?
+		`
+		return c.queryRankedVideos(ctx, query, VisibilityPublic, VideoStatusReady, limit)
+	}
+
+	query := `
+	SELECT` + videoColumns + `, v.views
+	FROM videos
+	JOIN (
+		SELECT video_id, COUNT(*) AS views
+		FROM video_views
+		WHERE viewed_at >= ?
+		GROUP BY video_id
+	) v ON v.video_id = videos.id
+	WHERE deleted_at IS NULL AND visibility = ? AND status = ? AND ` + ownerNotSuspended + `
+	ORDER BY v.views DESC, created_at DESC
+	LIMIT ?
+	`
+	return c.queryRankedVideos(ctx, query, formatTimestamp(since), VisibilityPublic, VideoStatusReady, limit)
+}
+
+// RefreshTrendingScores recomputes the trending ranking for one period.
+// Views are weighted linearly by recency so a video gaining views now
+// outranks one that got the same views at the start of the period.
+func (c Client) RefreshTrendingScores(ctx context.Context, period string, length time.Duration) error {
+	now := time.Now()
+	days := length.Hours() / 24
+
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM trending_scores WHERE period = ?", period); err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO trending_scores (period, video_id, views, score, computed_at)
+	SELECT
+		?,
+		video_id,
+		COUNT(*),
+		SUM(1.0 - ` + c.db.dialect.daysSince("viewed_at") + ` / ?),
+		CURRENT_TIMESTAMP
+	FROM video_views
+	WHERE viewed_at >= ?
+	GROUP BY video_id
+	`
+	ts := formatTimestamp(now)
+	_, err = tx.Exec(query, period, ts, days, formatTimestamp(now.Add(-length)))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTrendingVideos lists public, ready videos by their last computed
+// trending score for a period.
+func (c Client) GetTrendingVideos(ctx context.Context, period string, limit int) ([]RankedVideo, error) {
+	c = c.onReplica()
+	query := `
+	SELECT` + videoColumns + `, t.views
+	FROM videos
+	JOIN trending_scores t ON t.video_id = videos.id
+	WHERE t.period = ? AND deleted_at IS NULL AND visibility = ? AND status = ? AND ` + ownerNotSuspended + `
+	ORDER BY t.score DESC, created_at DESC
+	LIMIT ?
+	`
+	return c.queryRankedVideos(ctx, query, period, VisibilityPublic, VideoStatusReady, limit)
+}
+
+// DeleteViewsBefore prunes view rows older than every ranking window.
+func (c Client) DeleteViewsBefore(ctx context.Context, cutoff time.Time) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM video_views WHERE viewed_at < ?", formatTimestamp(cutoff))
+	return err
+}
+
+func (c Client) queryRankedVideos(ctx context.Context, query string, args ...any) ([]RankedVideo, error) {
+	rows, err := c.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []RankedVideo{}
+	for rows.Next() {
+		var ranked RankedVideo
+		ranked.Video, err = scanVideo(trailingScanner{rows, []any{&ranked.Views}})
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, ranked)
+	}
+	return videos, rows.Err()
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VirusScanStatus string
+
+const (
+	VirusScanClean    VirusScanStatus = "clean"
+	VirusScanInfected VirusScanStatus = "infected"
+)
+
+// VirusScan is the result of scanning the latest file uploaded for a video.
+// Signature names what was found in an infected file.
+type VirusScan struct {
+	Status    VirusScanStatus
+	Signature string
+	ScannedAt time.Time
+}
+
+func (c *Client) migrateVirusScans(ctx context.Context) error {
+	for _, col := range []struct{ name, definition string }{
+		{"virus_scan_status", "TEXT"},
+		{"virus_signature", "TEXT"},
+		{"virus_scanned_at", "TIMESTAMP"},
+	} {
+		if err := c.addColumnIfMissing(ctx, "videos", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetVideoVirusScan records the result of scanning a file uploaded for a
+// video, whether or not the file was accepted.
+func (c Client) SetVideoVirusScan(ctx context.Context, videoID uuid.UUID, scan VirusScan) error {
+	query := `
+	UPDATE videos
+	SET virus_scan_status = ?, virus_signature = ?, virus_scanned_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(ctx, query, scan.Status, scan.Signature, scan.ScannedAt, videoID)
+	return err
+}
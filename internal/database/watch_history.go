@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WatchHistoryEntry struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	VideoID   uuid.UUID `json:"video_id"`
+	WatchedAt time.Time `json:"watched_at"`
+}
+
+func (c Client) RecordWatch(ctx context.Context, userID, videoID uuid.UUID) (WatchHistoryEntry, error) {
+	entry := WatchHistoryEntry{
+		ID:        uuid.New(),
+		UserID:    userID,
+		VideoID:   videoID,
+		WatchedAt: time.Now().UTC(),
+	}
+	query := `
+	INSERT INTO watch_history (
+		id,
+		user_id,
+		video_id,
+		watched_at
+	) VALUES (?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(ctx, query, entry.ID, entry.UserID, entry.VideoID, entry.WatchedAt)
+	if err != nil {
+		return WatchHistoryEntry{}, err
+	}
+	return entry, nil
+}
+
+func (c Client) GetWatchHistory(ctx context.Context, userID uuid.UUID, limit, offset int) ([]WatchHistoryEntry, error) {
+	query := `
+	SELECT
+		id,
+		user_id,
+		video_id,
+		watched_at
+	FROM watch_history
+	WHERE user_id = ?
+	ORDER BY watched_at DESC
+	LIMIT ? OFFSET ?
+	`
+
+	rows, err := c.db.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WatchHistoryEntry{}
+	for rows.Next() {
+		var entry WatchHistoryEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.VideoID,
+			&entry.WatchedAt,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (c Client) ClearWatchHistory(ctx context.Context, userID uuid.UUID) error {
+	query := `
+	DELETE FROM watch_history
+	WHERE user_id = ?
+	`
+	_, err := c.db.Exec(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WatchLaterEntry struct {
+	Video   Video     `json:"video"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// AddToWatchLater saves a video to a user's watch later list. Adding a video
+// that's already on the list keeps its original position.
+func (c Client) AddToWatchLater(ctx context.Context, userID, videoID uuid.UUID) error {
+	query := `
+	INSERT INTO watch_later (
+		user_id,
+		video_id,
+		added_at
+	) VALUES (?, ?, ?)
+	ON CONFLICT DO NOTHING
+	`
+	_, err := c.db.Exec(ctx, query, userID, videoID, time.Now().UTC())
+	return err
+}
+
+func (c Client) RemoveFromWatchLater(ctx context.Context, userID, videoID uuid.UUID) error {
+	_, err := c.db.Exec(ctx, "DELETE FROM watch_later WHERE user_id = ? AND video_id = ?", userID, videoID)
+	return err
+}
+
+func (c Client) IsInWatchLater(ctx context.Context, userID, videoID uuid.UUID) (bool, error) {
+	var n int
+	err := c.db.QueryRow(ctx, "SELECT COUNT(*) FROM watch_later WHERE user_id = ? AND video_id = ?", userID, videoID).Scan(&n)
+	return n > 0, err
+}
+
+// GetWatchLater lists a user's watch later videos, most recently added
+// first. Trashed videos are skipped but stay on the list in case they're
+// restored.
+func (c Client) GetWatchLater(ctx context.Context, userID uuid.UUID, limit, offset int) ([]WatchLaterEntry, error) {
+	query := `
+	SELECT` + videoColumns + `, w.added_at
+	FROM videos
+	JOIN (
+		SELECT video_id, added_at
+		FROM watch_later
+		WHERE user_id = ?
+	) w ON w.video_id = videos.id
+	WHERE deleted_at IS NULL
+	ORDER BY w.added_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WatchLaterEntry{}
+	for rows.Next() {
+		var entry WatchLaterEntry
+		entry.Video, err = scanVideo(trailingScanner{rows, []any{&entry.AddedAt}})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
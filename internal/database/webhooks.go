@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookSubscription struct {
+	ID         uuid.UUID `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type CreateWebhookSubscriptionParams struct {
+	UserID     uuid.UUID
+	URL        string
+	EventTypes []string
+	Secret     string
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID `json:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	EventType      string    `json:"event_type"`
+	Payload        string    `json:"payload"`
+	Attempt        int       `json:"attempt"`
+	StatusCode     *int      `json:"status_code"`
+	Error          *string   `json:"error"`
+	Success        bool      `json:"success"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+const webhookSubscriptionColumns = `
+		id,
+		user_id,
+		url,
+		event_types,
+		secret,
+		created_at,
+		updated_at`
+
+func scanWebhookSubscription(row rowScanner) (WebhookSubscription, error) {
+	var sub WebhookSubscription
+	var eventTypes string
+	err := row.Scan(
+		&sub.ID,
+		&sub.UserID,
+		&sub.URL,
+		&eventTypes,
+		&sub.Secret,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+	)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	sub.EventTypes = strings.Split(eventTypes, ",")
+	return sub, nil
+}
+
+func (c Client) queryWebhookSubscriptions(ctx context.Context, query string, args ...any) ([]WebhookSubscription, error) {
+	rows, err := c.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (c Client) CreateWebhookSubscription(ctx context.Context, params CreateWebhookSubscriptionParams) (WebhookSubscription, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO webhook_subscriptions (
+		id,
+		user_id,
+		url,
+		event_types,
+		secret,
+		created_at,
+		updated_at
+	) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(ctx, query, id, params.UserID, params.URL, strings.Join(params.EventTypes, ","), params.Secret)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	return c.GetWebhookSubscription(ctx, id)
+}
+
+func (c Client) GetWebhookSubscription(ctx context.Context, id uuid.UUID) (WebhookSubscription, error) {
+	query := `
+	SELECT` + webhookSubscriptionColumns + `
+	FROM webhook_subscriptions
+	WHERE id = ?
+	`
+	sub, err := scanWebhookSubscription(c.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WebhookSubscription{}, nil
+		}
+		return WebhookSubscription{}, err
+	}
+	return sub, nil
+}
+
+func (c Client) GetWebhookSubscriptions(ctx context.Context, userID uuid.UUID) ([]WebhookSubscription, error) {
+	query := `
+	SELECT` + webhookSubscriptionColumns + `
+	FROM webhook_subscriptions
+	WHERE user_id = ?
+	ORDER BY created_at DESC
+	`
+	return c.queryWebhookSubscriptions(ctx, query, userID)
+}
+
+// GetWebhookSubscriptionsForEvent lists a user's subscriptions that include
+// the given event type.
+func (c Client) GetWebhookSubscriptionsForEvent(ctx context.Context, userID uuid.UUID, eventType string) ([]WebhookSubscription, error) {
+	subs, err := c.GetWebhookSubscriptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	matching := []WebhookSubscription{}
+	for _, sub := range subs {
+		for _, t := range sub.EventTypes {
+			if t == eventType {
+				matching = append(matching, sub)
+				break
+			}
+		}
+	}
+	return matching, nil
+}
+
+func (c Client) UpdateWebhookSubscription(ctx context.Context, id uuid.UUID, url string, eventTypes []string) error {
+	query := `
+	UPDATE webhook_subscriptions
+	SET url = ?, event_types = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(ctx, query, url, strings.Join(eventTypes, ","), id)
+	return err
+}
+
+func (c Client) DeleteWebhookSubscription(ctx context.Context, id uuid.UUID) error {
+	if _, err := c.db.Exec(ctx, "DELETE FROM webhook_deliveries WHERE subscription_id = ?", id); err != nil {
+		return err
+	}
+	_, err := c.db.Exec(ctx, "DELETE FROM webhook_subscriptions WHERE id = ?", id)
+	return err
+}
+
+func (c Client) CreateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	query := `
+	INSERT INTO webhook_deliveries (
+		id,
+		subscription_id,
+		event_type,
+		payload,
+		attempt,
+		status_code,
+		error,
+		success,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(ctx,
+		query,
+		delivery.ID,
+		delivery.SubscriptionID,
+		delivery.EventType,
+		delivery.Payload,
+		delivery.Attempt,
+		delivery.StatusCode,
+		delivery.Error,
+		delivery.Success,
+	)
+	return err
+}
+
+func (c Client) GetWebhookDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit, offset int) ([]WebhookDelivery, error) {
+	query := `
+	SELECT
+		id,
+		subscription_id,
+		event_type,
+		payload,
+		attempt,
+		status_code,
+		error,
+		success,
+		created_at
+	FROM webhook_deliveries
+	WHERE subscription_id = ?
+	ORDER BY created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(ctx, query, subscriptionID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(
+			&d.ID,
+			&d.SubscriptionID,
+			&d.EventType,
+			&d.Payload,
+			&d.Attempt,
+			&d.StatusCode,
+			&d.Error,
+			&d.Success,
+			&d.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,179 @@
+package graphql
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// FieldFunc resolves one field of an object given the field's arguments.
+type FieldFunc func(args map[string]any) (any, error)
+
+// Object is a resolved GraphQL object: a set of lazily resolved fields.
+// Resolvers return Objects for object types, slices for lists, and plain Go
+// values for scalars.
+type Object map[string]FieldFunc
+
+// Error is a resolver error reported in the response "errors" list.
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Response is the standard GraphQL response envelope.
+type Response struct {
+	Data   map[string]any `json:"data"`
+	Errors []Error        `json:"errors,omitempty"`
+}
+
+// Execute resolves the selected fields against the root object. A failing
+// field resolves to null and is reported in Errors without failing the rest
+// of the query.
+func Execute(root Object, fields []Field) Response {
+	e := &executor{}
+	data := e.resolveObject(root, fields, nil)
+	return Response{Data: data, Errors: e.errors}
+}
+
+type executor struct {
+	errors []Error
+}
+
+func (e *executor) fail(path []any, err error) {
+	e.errors = append(e.errors, Error{
+		Message: err.Error(),
+		Path:    append([]any(nil), path...),
+	})
+}
+
+func (e *executor) resolveObject(obj Object, fields []Field, path []any) map[string]any {
+	fields = e.collectFields(obj, fields, path)
+	result := make(map[string]any, len(fields))
+	for _, field := range fields {
+		fieldPath := append(path, field.Key())
+		if field.Name == "__typename" {
+			result[field.Key()] = nil
+			if fn, ok := obj["__typename"]; ok {
+				result[field.Key()], _ = fn(nil)
+			}
+			continue
+		}
+		fn, ok := obj[field.Name]
+		if !ok {
+			e.fail(fieldPath, fmt.Errorf("unknown field %q", field.Name))
+			result[field.Key()] = nil
+			continue
+		}
+		value, err := fn(field.Args)
+		if err != nil {
+			e.fail(fieldPath, err)
+			result[field.Key()] = nil
+			continue
+		}
+		result[field.Key()] = e.complete(value, field, fieldPath)
+	}
+	return result
+}
+
+// collectFields flattens the fragments that apply to obj into the fields
+// they select, merging the subselections of fields returned under the same
+// key, as GraphQL does for a field selected both directly and in a fragment.
+func (e *executor) collectFields(obj Object, fields []Field, path []any) []Field {
+	var collected []Field
+	index := map[string]int{}
+	typeName := typeNameOf(obj)
+	var collect func([]Field)
+	collect = func(fields []Field) {
+		for _, field := range fields {
+			if field.Fragment != nil {
+				if cond := field.Fragment.TypeCondition; cond == "" || cond == typeName {
+					collect(field.Fragment.Selections)
+				}
+				continue
+			}
+			i, ok := index[field.Key()]
+			if !ok {
+				index[field.Key()] = len(collected)
+				collected = append(collected, field)
+				continue
+			}
+			if collected[i].Name != field.Name {
+				e.fail(append(path, field.Key()), fmt.Errorf("fields %q and %q can't both be returned as %q", collected[i].Name, field.Name, field.Key()))
+				continue
+			}
+			collected[i].Selections = slices.Concat(collected[i].Selections, field.Selections)
+		}
+	}
+	collect(fields)
+	return collected
+}
+
+func typeNameOf(obj Object) string {
+	fn, ok := obj["__typename"]
+	if !ok {
+		return ""
+	}
+	name, _ := fn(nil)
+	s, _ := name.(string)
+	return s
+}
+
+func (e *executor) complete(value any, field Field, path []any) any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case Object:
+		if len(field.Selections) == 0 {
+			e.fail(path, fmt.Errorf("field %q must have a selection of subfields", field.Name))
+			return nil
+		}
+		return e.resolveObject(v, field.Selections, path)
+	case []Object:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = e.complete(item, field, append(path, i))
+		}
+		return list
+	default:
+		if len(field.Selections) > 0 {
+			e.fail(path, fmt.Errorf("field %q is a scalar and can't have subfields", field.Name))
+			return nil
+		}
+		return v
+	}
+}
+
+// IntArg reads an optional integer argument.
+func IntArg(args map[string]any, name string, fallback int) (int, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return fallback, nil
+	}
+	switch n := v.(type) {
+	case float64:
+		if n != float64(int(n)) {
+			return 0, fmt.Errorf("argument %q must be an integer", name)
+		}
+		return int(n), nil
+	case string:
+		i, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, fmt.Errorf("argument %q must be an integer", name)
+		}
+		return i, nil
+	}
+	return 0, fmt.Errorf("argument %q must be an integer", name)
+}
+
+// StringArg reads an optional string argument.
+func StringArg(args map[string]any, name string) (string, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+	return s, nil
+}
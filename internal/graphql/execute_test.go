@@ -0,0 +1,160 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testRoot is a small schema: a user with videos, each with an owner.
+func testRoot() Object {
+	user := Object{
+		"__typename": func(map[string]any) (any, error) { return "User", nil },
+		"id":         func(map[string]any) (any, error) { return "u1", nil },
+		"email":      func(map[string]any) (any, error) { return "a@example.com", nil },
+	}
+	video := func(id string) Object {
+		return Object{
+			"__typename": func(map[string]any) (any, error) { return "Video", nil },
+			"id":         func(map[string]any) (any, error) { return id, nil },
+			"owner":      func(map[string]any) (any, error) { return user, nil },
+			"secret": func(map[string]any) (any, error) {
+				return nil, errors.New("not allowed")
+			},
+		}
+	}
+	return Object{
+		"me": func(map[string]any) (any, error) { return user, nil },
+		"videos": func(args map[string]any) (any, error) {
+			first, err := IntArg(args, "first", 2)
+			if err != nil {
+				return nil, err
+			}
+			return []Object{video("v1"), video("v2")}[:first], nil
+		},
+		"nothing": func(map[string]any) (any, error) { return nil, nil },
+	}
+}
+
+// run parses and executes query against testRoot and returns the response
+// round-tripped through JSON, as a client would see it.
+func run(t *testing.T, query string, variables map[string]any) map[string]any {
+	t.Helper()
+	fields, err := Parse(query, variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(Execute(testRoot(), fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func checkResponse(t *testing.T, got map[string]any, want string) {
+	t.Helper()
+	var wantResp map[string]any
+	if err := json.Unmarshal([]byte(want), &wantResp); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wantResp) {
+		gotJSON, _ := json.Marshal(got)
+		t.Errorf("got  %s\nwant %s", gotJSON, want)
+	}
+}
+
+func TestExecuteNested(t *testing.T) {
+	got := run(t, `query($n: Int) {
+		me { __typename id }
+		first: videos(first: $n) { id owner { email } }
+		nothing { id }
+	}`, map[string]any{"n": float64(1)})
+	checkResponse(t, got, `{"data": {
+		"me": {"__typename": "User", "id": "u1"},
+		"first": [{"id": "v1", "owner": {"email": "a@example.com"}}],
+		"nothing": null
+	}}`)
+}
+
+func TestExecuteFragments(t *testing.T) {
+	got := run(t, `{
+		videos {
+			id
+			...VideoOwner
+			... on User { email }
+			owner { id }
+		}
+	}
+	fragment VideoOwner on Video { owner { email } }`, nil)
+	// The User fragment doesn't apply to videos, and the two owner
+	// selections are merged.
+	checkResponse(t, got, `{"data": {"videos": [
+		{"id": "v1", "owner": {"email": "a@example.com", "id": "u1"}},
+		{"id": "v2", "owner": {"email": "a@example.com", "id": "u1"}}
+	]}}`)
+}
+
+func TestExecuteErrors(t *testing.T) {
+	got := run(t, `{
+		videos { id secret }
+		me { id missing }
+		bad: videos(first: "x") { id }
+		scalar: me { id { deeper } }
+		object: me
+	}`, nil)
+	checkResponse(t, got, `{
+		"data": {
+			"videos": [{"id": "v1", "secret": null}, {"id": "v2", "secret": null}],
+			"me": {"id": "u1", "missing": null},
+			"bad": null,
+			"scalar": {"id": null},
+			"object": null
+		},
+		"errors": [
+			{"message": "not allowed", "path": ["videos", 0, "secret"]},
+			{"message": "not allowed", "path": ["videos", 1, "secret"]},
+			{"message": "unknown field \"missing\"", "path": ["me", "missing"]},
+			{"message": "argument \"first\" must be an integer", "path": ["bad"]},
+			{"message": "field \"id\" is a scalar and can't have subfields", "path": ["scalar", "id"]},
+			{"message": "field \"me\" must have a selection of subfields", "path": ["object"]}
+		]
+	}`)
+}
+
+func TestExecuteConflictingAliases(t *testing.T) {
+	got := run(t, `{ me { x: id x: email } }`, nil)
+	checkResponse(t, got, `{
+		"data": {"me": {"x": "u1"}},
+		"errors": [{"message": "fields \"id\" and \"email\" can't both be returned as \"x\"", "path": ["me", "x"]}]
+	}`)
+}
+
+func TestArgs(t *testing.T) {
+	args := map[string]any{"n": float64(3), "s": "7", "f": 1.5, "str": "x", "num": float64(1), "null": nil}
+	if n, err := IntArg(args, "n", 0); n != 3 || err != nil {
+		t.Errorf("IntArg(n) = %d, %v", n, err)
+	}
+	if n, err := IntArg(args, "s", 0); n != 7 || err != nil {
+		t.Errorf("IntArg(s) = %d, %v", n, err)
+	}
+	if n, err := IntArg(args, "absent", 9); n != 9 || err != nil {
+		t.Errorf("IntArg(absent) = %d, %v", n, err)
+	}
+	if n, err := IntArg(args, "null", 9); n != 9 || err != nil {
+		t.Errorf("IntArg(null) = %d, %v", n, err)
+	}
+	if _, err := IntArg(args, "f", 0); err == nil {
+		t.Error("IntArg accepted 1.5")
+	}
+	if s, err := StringArg(args, "str"); s != "x" || err != nil {
+		t.Errorf("StringArg(str) = %q, %v", s, err)
+	}
+	if _, err := StringArg(args, "num"); err == nil {
+		t.Error("StringArg accepted a number")
+	}
+}
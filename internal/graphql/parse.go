@@ -0,0 +1,611 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Field is a single selection in a query, with its arguments resolved against
+// the request variables. A field with a Fragment is a fragment spread or
+// inline fragment rather than a field of the object.
+type Field struct {
+	Name       string
+	Alias      string
+	Args       map[string]any
+	Selections []Field
+	Fragment   *Fragment
+
+	// spread is the name of the fragment a spread refers to, until it's
+	// looked up once the whole document is parsed.
+	spread string
+}
+
+// Key is the name the field's result is returned under.
+func (f Field) Key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Fragment is a set of selections that applies to objects whose __typename
+// is TypeCondition, or to every object if it's empty.
+type Fragment struct {
+	TypeCondition string
+	Selections    []Field
+}
+
+// Parse parses a query document containing a single query operation and the
+// fragments it uses. Only the subset of GraphQL needed by the API is
+// supported: aliases, arguments, variables, nested selections, and named and
+// inline fragments. Directives and mutations are rejected.
+func Parse(query string, variables map[string]any) ([]Field, error) {
+	p := &parser{src: query, variables: variables, fragments: map[string]*Fragment{}}
+	p.next()
+
+	var fields []Field
+	for p.tok.kind != tokEOF {
+		if p.tok.kind == tokName && p.tok.value == "fragment" {
+			if err := p.parseFragmentDefinition(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if fields != nil {
+			return nil, p.errorf("only one operation per document is supported")
+		}
+		var err error
+		if fields, err = p.parseOperation(); err != nil {
+			return nil, err
+		}
+	}
+	if fields == nil {
+		return nil, p.errorf("expected %q", "{")
+	}
+
+	expanding := map[string]bool{}
+	for name := range p.fragments {
+		if err := p.expandFragment(name, expanding); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expandSpreads(fields, expanding); err != nil {
+		return nil, err
+	}
+	p.resolveVariables(fields, map[*Fragment]bool{})
+	return fields, nil
+}
+
+func (p *parser) parseOperation() ([]Field, error) {
+	if p.tok.kind == tokName {
+		switch p.tok.value {
+		case "query":
+			p.next()
+		case "mutation", "subscription":
+			return nil, fmt.Errorf("%s operations are not supported", p.tok.value)
+		default:
+			return nil, p.errorf("unexpected %q", p.tok.value)
+		}
+		if p.tok.kind == tokName {
+			p.next()
+		}
+		if p.tok.is("(") {
+			if err := p.parseVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p.parseSelectionSet()
+}
+
+// parseFragmentDefinition parses "fragment Name on Type { ... }".
+func (p *parser) parseFragmentDefinition() error {
+	p.next()
+	if p.tok.kind != tokName || p.tok.value == "on" {
+		return p.errorf("expected fragment name")
+	}
+	name := p.tok.value
+	if _, ok := p.fragments[name]; ok {
+		return fmt.Errorf("fragment %q is defined more than once", name)
+	}
+	p.next()
+	if p.tok.kind != tokName || p.tok.value != "on" {
+		return p.errorf("expected \"on\"")
+	}
+	p.next()
+	if p.tok.kind != tokName {
+		return p.errorf("expected type name")
+	}
+	fragment := &Fragment{TypeCondition: p.tok.value}
+	p.next()
+	if p.tok.is("@") {
+		return errors.New("directives are not supported")
+	}
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return err
+	}
+	fragment.Selections = selections
+	p.fragments[name] = fragment
+	return nil
+}
+
+// expandFragment replaces the spreads in a fragment definition with the
+// fragments they name, failing if fragments spread each other in a cycle.
+func (p *parser) expandFragment(name string, expanding map[string]bool) error {
+	if expanding[name] {
+		return fmt.Errorf("fragment %q spreads itself", name)
+	}
+	if p.expanded[name] {
+		return nil
+	}
+	expanding[name] = true
+	defer delete(expanding, name)
+	if err := p.expandSpreads(p.fragments[name].Selections, expanding); err != nil {
+		return err
+	}
+	if p.expanded == nil {
+		p.expanded = map[string]bool{}
+	}
+	p.expanded[name] = true
+	return nil
+}
+
+func (p *parser) expandSpreads(fields []Field, expanding map[string]bool) error {
+	for i := range fields {
+		f := &fields[i]
+		if f.spread != "" {
+			fragment, ok := p.fragments[f.spread]
+			if !ok {
+				return fmt.Errorf("unknown fragment %q", f.spread)
+			}
+			if err := p.expandFragment(f.spread, expanding); err != nil {
+				return err
+			}
+			f.Fragment = fragment
+			f.spread = ""
+			continue
+		}
+		if f.Fragment != nil {
+			if err := p.expandSpreads(f.Fragment.Selections, expanding); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := p.expandSpreads(f.Selections, expanding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// variable is a reference to a request variable in an argument, replaced
+// with its value once the operation's defaults are known.
+type variable string
+
+func (p *parser) resolveVariables(fields []Field, seen map[*Fragment]bool) {
+	for i := range fields {
+		f := &fields[i]
+		for name, value := range f.Args {
+			f.Args[name] = p.resolveValue(value)
+		}
+		p.resolveVariables(f.Selections, seen)
+		if f.Fragment != nil && !seen[f.Fragment] {
+			seen[f.Fragment] = true
+			p.resolveVariables(f.Fragment.Selections, seen)
+		}
+	}
+}
+
+func (p *parser) resolveValue(value any) any {
+	switch v := value.(type) {
+	case variable:
+		if value, ok := p.variables[string(v)]; ok {
+			return value
+		}
+		return p.defaults[string(v)]
+	case []any:
+		for i := range v {
+			v[i] = p.resolveValue(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = p.resolveValue(v[k])
+		}
+	}
+	return value
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+	tokError
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func (t token) is(punct string) bool {
+	return t.kind == tokPunct && t.value == punct
+}
+
+type parser struct {
+	src       string
+	pos       int
+	tok       token
+	variables map[string]any
+	defaults  map[string]any
+	fragments map[string]*Fragment
+	expanded  map[string]bool
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) next() {
+	p.tok = p.lex()
+}
+
+func (p *parser) lex() token {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return p.lexToken()
+		}
+	}
+	return token{kind: tokEOF}
+}
+
+func (p *parser) lexToken() token {
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		return token{kind: tokPunct, value: "..."}
+	case strings.ContainsRune("{}()[]:$!=@", rune(c)):
+		p.pos++
+		return token{kind: tokPunct, value: string(c)}
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		return token{kind: tokName, value: p.src[start:p.pos]}
+	case c == '-' || unicode.IsDigit(rune(c)):
+		kind := tokInt
+		p.pos++
+		for p.pos < len(p.src) {
+			d := p.src[p.pos]
+			if d == '.' || d == 'e' || d == 'E' || d == '+' || (d == '-' && kind == tokFloat) {
+				kind = tokFloat
+			} else if !unicode.IsDigit(rune(d)) {
+				break
+			}
+			p.pos++
+		}
+		return token{kind: kind, value: p.src[start:p.pos]}
+	case c == '"':
+		return p.lexString()
+	}
+	p.pos++
+	return token{kind: tokError, value: string(c)}
+}
+
+func (p *parser) lexString() token {
+	var sb strings.Builder
+	p.pos++
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return token{kind: tokString, value: sb.String()}
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				return token{kind: tokError, value: "unterminated string"}
+			}
+			esc := p.src[p.pos+1]
+			p.pos += 2
+			switch esc {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					return token{kind: tokError, value: "invalid unicode escape"}
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return token{kind: tokError, value: "invalid unicode escape"}
+				}
+				sb.WriteRune(rune(r))
+				p.pos += 4
+			case '"', '\\', '/':
+				sb.WriteByte(esc)
+			default:
+				return token{kind: tokError, value: fmt.Sprintf("invalid escape \\%c", esc)}
+			}
+		case '\n':
+			return token{kind: tokError, value: "unterminated string"}
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	return token{kind: tokError, value: "unterminated string"}
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.tok.is(punct) {
+		return p.errorf("expected %q", punct)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseVariableDefinitions() error {
+	p.defaults = map[string]any{}
+	p.next()
+	for !p.tok.is(")") {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		if p.tok.kind != tokName {
+			return p.errorf("expected variable name")
+		}
+		name := p.tok.value
+		p.next()
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if p.tok.is("=") {
+			p.next()
+			value, err := p.parseValue(true)
+			if err != nil {
+				return err
+			}
+			p.defaults[name] = value
+		}
+	}
+	p.next()
+	return nil
+}
+
+// skipType consumes a variable's type. Types are not checked; resolvers
+// validate their own arguments.
+func (p *parser) skipType() error {
+	switch {
+	case p.tok.is("["):
+		p.next()
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	case p.tok.kind == tokName:
+		p.next()
+	default:
+		return p.errorf("expected type")
+	}
+	if p.tok.is("!") {
+		p.next()
+	}
+	return nil
+}
+
+func (p *parser) parseSelectionSet() ([]Field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	fields := []Field{}
+	for !p.tok.is("}") {
+		if p.tok.is("...") {
+			field, err := p.parseFragmentSelection()
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+			continue
+		}
+		if p.tok.is("@") {
+			return nil, errors.New("directives are not supported")
+		}
+		if p.tok.kind != tokName {
+			return nil, p.errorf("expected field name")
+		}
+		field := Field{Name: p.tok.value}
+		p.next()
+		if p.tok.is(":") {
+			p.next()
+			if p.tok.kind != tokName {
+				return nil, p.errorf("expected field name after alias")
+			}
+			field.Alias = field.Name
+			field.Name = p.tok.value
+			p.next()
+		}
+		if p.tok.is("(") {
+			args, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+			field.Args = args
+		}
+		if p.tok.is("@") {
+			return nil, errors.New("directives are not supported")
+		}
+		if p.tok.is("{") {
+			selections, err := p.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			field.Selections = selections
+		}
+		fields = append(fields, field)
+	}
+	p.next()
+	return fields, nil
+}
+
+// parseFragmentSelection parses a fragment spread, "...Name", or an inline
+// fragment, "... on Type { ... }" or "... { ... }".
+func (p *parser) parseFragmentSelection() (Field, error) {
+	p.next()
+	fragment := &Fragment{}
+	switch {
+	case p.tok.kind == tokName && p.tok.value == "on":
+		p.next()
+		if p.tok.kind != tokName {
+			return Field{}, p.errorf("expected type name")
+		}
+		fragment.TypeCondition = p.tok.value
+		p.next()
+	case p.tok.kind == tokName:
+		name := p.tok.value
+		p.next()
+		if p.tok.is("@") {
+			return Field{}, errors.New("directives are not supported")
+		}
+		return Field{spread: name}, nil
+	}
+	if p.tok.is("@") {
+		return Field{}, errors.New("directives are not supported")
+	}
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return Field{}, err
+	}
+	fragment.Selections = selections
+	return Field{Fragment: fragment}, nil
+}
+
+func (p *parser) parseArguments() (map[string]any, error) {
+	args := map[string]any{}
+	p.next()
+	for !p.tok.is(")") {
+		if p.tok.kind != tokName {
+			return nil, p.errorf("expected argument name")
+		}
+		name := p.tok.value
+		p.next()
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = value
+	}
+	p.next()
+	return args, nil
+}
+
+func (p *parser) parseValue(constant bool) (any, error) {
+	tok := p.tok
+	switch {
+	case tok.is("$") && !constant:
+		p.next()
+		if p.tok.kind != tokName {
+			return nil, p.errorf("expected variable name")
+		}
+		name := p.tok.value
+		p.next()
+		return variable(name), nil
+	case tok.is("["):
+		p.next()
+		list := []any{}
+		for !p.tok.is("]") {
+			value, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		p.next()
+		return list, nil
+	case tok.is("{"):
+		p.next()
+		obj := map[string]any{}
+		for !p.tok.is("}") {
+			if p.tok.kind != tokName {
+				return nil, p.errorf("expected field name")
+			}
+			name := p.tok.value
+			p.next()
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = value
+		}
+		p.next()
+		return obj, nil
+	case tok.kind == tokInt:
+		p.next()
+		// Numbers are decoded as float64 to match encoding/json variables.
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid int %q", tok.value)
+		}
+		return float64(n), nil
+	case tok.kind == tokFloat:
+		p.next()
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %q", tok.value)
+		}
+		return f, nil
+	case tok.kind == tokString:
+		p.next()
+		return tok.value, nil
+	case tok.kind == tokName:
+		p.next()
+		switch tok.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// Enum values are passed to resolvers as strings.
+		return tok.value, nil
+	case tok.kind == tokError:
+		return nil, p.errorf("%s", tok.value)
+	}
+	return nil, p.errorf("expected value")
+}
@@ -0,0 +1,146 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSelections(t *testing.T) {
+	fields, err := Parse(`
+		# A comment.
+		query Videos {
+			me { id, email }
+			latest: videos(first: 2, after: "abc") {
+				edges { node { id title } }
+			}
+		}`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Field{
+		{Name: "me", Selections: []Field{{Name: "id"}, {Name: "email"}}},
+		{Name: "videos", Alias: "latest", Args: map[string]any{"first": float64(2), "after": "abc"}, Selections: []Field{
+			{Name: "edges", Selections: []Field{
+				{Name: "node", Selections: []Field{{Name: "id"}, {Name: "title"}}},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got %+v\nwant %+v", fields, want)
+	}
+	if fields[1].Key() != "latest" || fields[0].Key() != "me" {
+		t.Errorf("keys = %q, %q", fields[0].Key(), fields[1].Key())
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	fields, err := Parse(`{ f(s: "tab\tquote\"\u00e9\/snow☃", i: -3, x: 1.5e2, b: true, n: null, e: DAY, l: [1, "a"], o: {k: false}) }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"s": "tab\tquote\"é/snow☃",
+		"i": float64(-3),
+		"x": float64(150),
+		"b": true,
+		"n": nil,
+		"e": "DAY",
+		"l": []any{float64(1), "a"},
+		"o": map[string]any{"k": false},
+	}
+	if !reflect.DeepEqual(fields[0].Args, want) {
+		t.Errorf("args = %#v\nwant %#v", fields[0].Args, want)
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	query := `query Q($id: ID!, $first: Int = 5, $tags: [String]) {
+		video(id: $id) { id }
+		videos(first: $first, filter: {tags: $tags}) { edges { cursor } }
+	}`
+	fields, err := Parse(query, map[string]any{"id": "v1", "tags": []any{"go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fields[0].Args["id"]; got != "v1" {
+		t.Errorf("id = %v, want v1", got)
+	}
+	if got := fields[1].Args["first"]; got != float64(5) {
+		t.Errorf("first = %v, want the default 5", got)
+	}
+	if got := fields[1].Args["filter"]; !reflect.DeepEqual(got, map[string]any{"tags": []any{"go"}}) {
+		t.Errorf("filter = %v, want the variable inside the object", got)
+	}
+
+	// A supplied variable wins over its default, even when it's null.
+	fields, err = Parse(query, map[string]any{"first": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := fields[1].Args["first"]; !ok || got != nil {
+		t.Errorf("first = %v, want null", got)
+	}
+}
+
+func TestParseFragments(t *testing.T) {
+	// Fragments may be defined before or after the operation, spread each
+	// other, and use the operation's variables.
+	fields, err := Parse(`
+		fragment VideoFields on Video { id ...Owner }
+		query($first: Int = 1) {
+			videos(first: $first) { edges { node { ...VideoFields } } }
+			me { ... on User { email } ... { id } }
+		}
+		fragment Owner on Video { owner { id } tags(limit: $first) }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spread := fields[0].Selections[0].Selections[0].Selections[0]
+	if spread.Fragment == nil || spread.Fragment.TypeCondition != "Video" {
+		t.Fatalf("spread = %+v, want the VideoFields fragment", spread)
+	}
+	inner := spread.Fragment.Selections[1]
+	if inner.Fragment == nil || inner.Fragment.TypeCondition != "Video" || len(inner.Fragment.Selections) != 2 {
+		t.Fatalf("nested spread = %+v, want the Owner fragment", inner)
+	}
+	if got := inner.Fragment.Selections[1].Args["limit"]; got != float64(1) {
+		t.Errorf("variable in fragment = %v, want 1", got)
+	}
+
+	me := fields[1].Selections
+	if len(me) != 2 || me[0].Fragment.TypeCondition != "User" || me[1].Fragment.TypeCondition != "" {
+		t.Errorf("inline fragments = %+v", me)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                                  `expected "{"`,
+		"{ me { id }":                       `expected`,
+		"{ me(: 1) }":                       "",
+		`{ f(s: "unterminated) }`:           "",
+		`{ f(s: "\q") }`:                    `invalid escape \q`,
+		"mutation { deleteVideo }":          "mutation operations are not supported",
+		"subscription { events }":           "subscription operations are not supported",
+		"{ me @include(if: true) }":         "directives are not supported",
+		"{ a } { b }":                       "only one operation",
+		"{ ...Missing }":                    `unknown fragment "Missing"`,
+		"{ ...A } fragment A on T { ...A }": `fragment "A" spreads itself`,
+		"{ ...A } fragment A on T { ...B } fragment B on T { ...A }": "spreads itself",
+		"{ ...A } fragment A on T { id } fragment A on T { id }":     "defined more than once",
+		"{ ...A } fragment A { id }":                                 `expected "on"`,
+		"fragment A on T { id }":                                     `expected "{"`,
+	}
+	for query, want := range tests {
+		_, err := Parse(query, nil)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded", query)
+			continue
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) = %v, want an error containing %q", query, err, want)
+		}
+	}
+}
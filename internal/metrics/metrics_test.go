@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+	var sb strings.Builder
+	if err := r.WriteText(context.Background(), &sb); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests served.", "method", "code")
+	requests.Inc("POST", "201")
+	requests.Inc("GET", "200")
+	requests.Add(2.5, "GET", "200")
+	up := r.NewGauge("up", "Whether the server is up.")
+	up.Set(1)
+	queue := r.NewGauge("queue_depth", "Jobs waiting.", "type")
+	queue.Set(5, "process_video")
+	queue.Add(-2, "process_video")
+
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",code="200"} 3.5
+requests_total{method="POST",code="201"} 1
+# HELP up Whether the server is up.
+# TYPE up gauge
+up 1
+# HELP queue_depth Jobs waiting.
+# TYPE queue_depth gauge
+queue_depth{type="process_video"} 3
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("escaped_total", "Help with a \\ backslash,\na newline and \"quotes\".", "path")
+	c.Inc("C:\\videos\\\"new\"\nclip.mp4")
+
+	want := `# HELP escaped_total Help with a \\ backslash,\na newline and "quotes".
+# TYPE escaped_total counter
+escaped_total{path="C:\\videos\\\"new\"\nclip.mp4"} 1
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	// Buckets are sorted, whatever order they're given in.
+	h := r.NewHistogram("duration_seconds", "Time taken.", []float64{1, 0.1, 0.5}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		h.Observe(v, "/api/videos")
+	}
+	h.Observe(0.5, `/a"b`)
+
+	// Bounds are inclusive and counts cumulative, +Inf equals _count, and
+	// le comes after the metric's own labels.
+	want := `# HELP duration_seconds Time taken.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/a\"b",le="0.1"} 0
+duration_seconds_bucket{route="/a\"b",le="0.5"} 1
+duration_seconds_bucket{route="/a\"b",le="1"} 1
+duration_seconds_bucket{route="/a\"b",le="+Inf"} 1
+duration_seconds_sum{route="/a\"b"} 0.5
+duration_seconds_count{route="/a\"b"} 1
+duration_seconds_bucket{route="/api/videos",le="0.1"} 2
+duration_seconds_bucket{route="/api/videos",le="0.5"} 3
+duration_seconds_bucket{route="/api/videos",le="1"} 4
+duration_seconds_bucket{route="/api/videos",le="+Inf"} 5
+duration_seconds_sum{route="/api/videos"} 3.15
+duration_seconds_count{route="/api/videos"} 5
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("size_bytes", "Upload sizes.", []float64{1024})
+	h.Observe(10)
+
+	want := `# HELP size_bytes Upload sizes.
+# TYPE size_bytes histogram
+size_bytes_bucket{le="1024"} 1
+size_bytes_bucket{le="+Inf"} 1
+size_bytes_sum 10
+size_bytes_count 1
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := map[float64]string{
+		0:            "0",
+		-3:           "-3",
+		0.25:         "0.25",
+		1e-5:         "1e-05",
+		1 << 40:      "1.099511627776e+12",
+		math.Inf(1):  "+Inf",
+		math.Inf(-1): "-Inf",
+		math.NaN():   "NaN",
+	}
+	for v, want := range tests {
+		if got := formatValue(v); got != want {
+			t.Errorf("formatValue(%v) = %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestBeforeScrape(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("temp_bytes", "Temp disk usage.")
+	r.BeforeScrape(func(ctx context.Context) { g.Set(42) })
+
+	if got := render(t, r); !strings.Contains(got, "\ntemp_bytes 42\n") {
+		t.Errorf("hook didn't run before rendering:\n%s", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("hits_total", "Hits.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.HasSuffix(rec.Body.String(), "\nhits_total 1\n") {
+		t.Errorf("body = %q", rec.Body)
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("c_total", "C.", "a")
+	tests := map[string]func(){
+		"too few labels":      func() { c.Inc() },
+		"too many labels":     func() { c.Inc("x", "y") },
+		"decreasing counter":  func() { c.Add(-1, "x") },
+		"histogram labels":    func() { r.NewHistogram("h", "H.", DefBuckets, "a").Observe(1) },
+		"gauge without label": func() { r.NewGauge("g", "G.", "a").Set(1) },
+	}
+	for name, fn := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s didn't panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
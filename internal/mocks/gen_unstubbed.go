@@ -0,0 +1,128 @@
+//go:build ignore
+
+// gen_unstubbed writes unstubbed.go: an implementation of every
+// database.Store method that fails the test instead of querying anything.
+// Run it with go generate after changing the Store interface.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+func main() {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "../database/store.go", nil, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var store *ast.InterfaceType
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if ok && spec.Name.Name == "Store" {
+			store, _ = spec.Type.(*ast.InterfaceType)
+			return false
+		}
+		return true
+	})
+	if store == nil {
+		log.Fatal("no Store interface in ../database/store.go")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`// Code generated by gen_unstubbed.go; DO NOT EDIT.
+
+package mocks
+
+import (
+`)
+	var std, other []string
+	for _, imp := range file.Imports {
+		if strings.Contains(imp.Path.Value, ".") {
+			other = append(other, imp.Path.Value)
+		} else {
+			std = append(std, imp.Path.Value)
+		}
+	}
+	other = append(other, `"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"`)
+	slices.Sort(other)
+	fmt.Fprintf(&buf, "\t%s\n\n\t%s\n)\n\n", strings.Join(std, "\n\t"), strings.Join(other, "\n\t"))
+	for _, method := range store.Methods.List {
+		fn, ok := method.Type.(*ast.FuncType)
+		if !ok || len(method.Names) != 1 {
+			log.Fatalf("Store embeds %s; only methods are supported", expr(fset, method.Type))
+		}
+		name := method.Names[0].Name
+		fmt.Fprintf(&buf, "func (s unstubbedStore) %s(%s) (%s) {\n\ts.fail(%q)\n\treturn\n}\n\n",
+			name, fields(fset, fn.Params), fields(fset, fn.Results), name)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("couldn't format generated code: %v\n%s", err, buf.Bytes())
+	}
+	if err := os.WriteFile("unstubbed.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// fields lists a parameter or result list with every name blank, so
+// results are named and a bare return gives zero values.
+func fields(fset *token.FileSet, list *ast.FieldList) string {
+	if list == nil {
+		return ""
+	}
+	var out []string
+	for _, field := range list.List {
+		typ := expr(fset, qualify(field.Type))
+		n := max(len(field.Names), 1)
+		for range n {
+			out = append(out, "_ "+typ)
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// qualify prefixes the database package's own types with "database.". The
+// copy has no positions, so it prints on one line.
+func qualify(e ast.Expr) ast.Expr {
+	switch e := e.(type) {
+	case *ast.Ident:
+		if ast.IsExported(e.Name) {
+			return &ast.SelectorExpr{X: ast.NewIdent("database"), Sel: ast.NewIdent(e.Name)}
+		}
+		return ast.NewIdent(e.Name)
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: qualify(e.X)}
+	case *ast.ArrayType:
+		if e.Len != nil {
+			log.Fatal("unsupported array type in Store")
+		}
+		return &ast.ArrayType{Elt: qualify(e.Elt)}
+	case *ast.MapType:
+		return &ast.MapType{Key: qualify(e.Key), Value: qualify(e.Value)}
+	case *ast.Ellipsis:
+		return &ast.Ellipsis{Elt: qualify(e.Elt)}
+	case *ast.SelectorExpr:
+		return &ast.SelectorExpr{X: qualify(e.X), Sel: ast.NewIdent(e.Sel.Name)}
+	}
+	log.Fatalf("unsupported type %T in Store", e)
+	return nil
+}
+
+func expr(fset *token.FileSet, e ast.Expr) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, e); err != nil {
+		log.Fatal(err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,322 @@
+package mocks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Client is an in-memory bucket. PutObject stores the body under its key
+// and DeleteObject removes it, so tests can assert on what was uploaded.
+// Set the Func fields to inject failures.
+type S3Client struct {
+	mu      sync.Mutex
+	Objects map[string][]byte
+	Holds   map[string]bool
+	// Retention holds the Object Lock retain-until date of locked objects.
+	Retention map[string]time.Time
+	// Uploads holds the parts of multipart uploads in progress, by upload ID.
+	Uploads map[string]*MultipartUpload
+
+	PutObjectFunc          func(ctx context.Context, params *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	GetObjectFunc          func(ctx context.Context, params *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	DeleteObjectFunc       func(ctx context.Context, params *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+	CopyObjectFunc         func(ctx context.Context, params *s3.CopyObjectInput) (*s3.CopyObjectOutput, error)
+	PutObjectLegalHoldFunc func(ctx context.Context, params *s3.PutObjectLegalHoldInput) (*s3.PutObjectLegalHoldOutput, error)
+	PutObjectRetentionFunc func(ctx context.Context, params *s3.PutObjectRetentionInput) (*s3.PutObjectRetentionOutput, error)
+	ListObjectsV2Func      func(ctx context.Context, params *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
+	HeadBucketFunc         func(ctx context.Context, params *s3.HeadBucketInput) (*s3.HeadBucketOutput, error)
+
+	CreateMultipartUploadFunc   func(ctx context.Context, params *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
+	UploadPartFunc              func(ctx context.Context, params *s3.UploadPartInput) (*s3.UploadPartOutput, error)
+	CompleteMultipartUploadFunc func(ctx context.Context, params *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUploadFunc    func(ctx context.Context, params *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error)
+	ListMultipartUploadsFunc    func(ctx context.Context, params *s3.ListMultipartUploadsInput) (*s3.ListMultipartUploadsOutput, error)
+
+	nextUpload int
+}
+
+// MultipartUpload is an upload started with CreateMultipartUpload.
+type MultipartUpload struct {
+	Key       string
+	Parts     map[int32][]byte
+	Initiated time.Time
+}
+
+func NewS3Client() *S3Client {
+	return &S3Client{
+		Objects:   map[string][]byte{},
+		Holds:     map[string]bool{},
+		Retention: map[string]time.Time{},
+		Uploads:   map[string]*MultipartUpload{},
+	}
+}
+
+func (m *S3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if m.PutObjectFunc != nil {
+		return m.PutObjectFunc(ctx, params)
+	}
+	var body []byte
+	if params.Body != nil {
+		var err error
+		body, err = io.ReadAll(params.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Objects[*params.Key] = body
+	if params.ObjectLockRetainUntilDate != nil {
+		m.Retention[*params.Key] = *params.ObjectLockRetainUntilDate
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+// GetObject returns a stored object, or *types.NoSuchKey like S3 does.
+func (m *S3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if m.GetObjectFunc != nil {
+		return m.GetObjectFunc(ctx, params)
+	}
+	m.mu.Lock()
+	body, ok := m.Objects[*params.Key]
+	m.mu.Unlock()
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	size := int64(len(body))
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(bytes.Clone(body))),
+		ContentLength: &size,
+	}, nil
+}
+
+func (m *S3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if m.DeleteObjectFunc != nil {
+		return m.DeleteObjectFunc(ctx, params)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Holds[*params.Key] {
+		return nil, fmt.Errorf("object %s is under legal hold", *params.Key)
+	}
+	delete(m.Objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// CopyObject copies within the one bucket, ignoring the bucket named in
+// CopySource.
+func (m *S3Client) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if m.CopyObjectFunc != nil {
+		return m.CopyObjectFunc(ctx, params)
+	}
+	source, err := url.PathUnescape(*params.CopySource)
+	if err != nil {
+		return nil, err
+	}
+	_, source, _ = strings.Cut(source, "/")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	body, ok := m.Objects[source]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	m.Objects[*params.Key] = bytes.Clone(body)
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (m *S3Client) PutObjectLegalHold(ctx context.Context, params *s3.PutObjectLegalHoldInput, optFns ...func(*s3.Options)) (*s3.PutObjectLegalHoldOutput, error) {
+	if m.PutObjectLegalHoldFunc != nil {
+		return m.PutObjectLegalHoldFunc(ctx, params)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Holds[*params.Key] = params.LegalHold != nil && params.LegalHold.Status == types.ObjectLockLegalHoldStatusOn
+	return &s3.PutObjectLegalHoldOutput{}, nil
+}
+
+func (m *S3Client) PutObjectRetention(ctx context.Context, params *s3.PutObjectRetentionInput, optFns ...func(*s3.Options)) (*s3.PutObjectRetentionOutput, error) {
+	if m.PutObjectRetentionFunc != nil {
+		return m.PutObjectRetentionFunc(ctx, params)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if params.Retention != nil && params.Retention.RetainUntilDate != nil {
+		m.Retention[*params.Key] = *params.Retention.RetainUntilDate
+	}
+	return &s3.PutObjectRetentionOutput{}, nil
+}
+
+// ListObjectsV2 lists every stored object under the prefix, after
+// StartAfter if it's set, in one page.
+func (m *S3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	if m.ListObjectsV2Func != nil {
+		return m.ListObjectsV2Func(ctx, params)
+	}
+	prefix := ""
+	if params.Prefix != nil {
+		prefix = *params.Prefix
+	}
+	startAfter := ""
+	if params.StartAfter != nil {
+		startAfter = *params.StartAfter
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := &s3.ListObjectsV2Output{}
+	for key, body := range m.Objects {
+		if !strings.HasPrefix(key, prefix) || key <= startAfter {
+			continue
+		}
+		size := int64(len(body))
+		out.Contents = append(out.Contents, types.Object{Key: &key, Size: &size})
+	}
+	sort.Slice(out.Contents, func(i, j int) bool { return *out.Contents[i].Key < *out.Contents[j].Key })
+	return out, nil
+}
+
+func (m *S3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if m.HeadBucketFunc != nil {
+		return m.HeadBucketFunc(ctx, params)
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (m *S3Client) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if m.CreateMultipartUploadFunc != nil {
+		return m.CreateMultipartUploadFunc(ctx, params)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextUpload++
+	id := fmt.Sprintf("upload-%d", m.nextUpload)
+	m.Uploads[id] = &MultipartUpload{Key: *params.Key, Parts: map[int32][]byte{}, Initiated: time.Now()}
+	return &s3.CreateMultipartUploadOutput{UploadId: &id}, nil
+}
+
+// UploadPart stores a part, using its index as the ETag.
+func (m *S3Client) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if m.UploadPartFunc != nil {
+		return m.UploadPartFunc(ctx, params)
+	}
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload, ok := m.Uploads[*params.UploadId]
+	if !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	upload.Parts[*params.PartNumber] = body
+	etag := fmt.Sprintf("%q", fmt.Sprint(*params.PartNumber))
+	return &s3.UploadPartOutput{ETag: &etag}, nil
+}
+
+// CompleteMultipartUpload joins the listed parts into the object.
+func (m *S3Client) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	if m.CompleteMultipartUploadFunc != nil {
+		return m.CompleteMultipartUploadFunc(ctx, params)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload, ok := m.Uploads[*params.UploadId]
+	if !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	var body []byte
+	if params.MultipartUpload != nil {
+		for _, part := range params.MultipartUpload.Parts {
+			data, ok := upload.Parts[*part.PartNumber]
+			if !ok {
+				return nil, fmt.Errorf("part %d wasn't uploaded", *part.PartNumber)
+			}
+			body = append(body, data...)
+		}
+	}
+	m.Objects[upload.Key] = body
+	delete(m.Uploads, *params.UploadId)
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (m *S3Client) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	if m.AbortMultipartUploadFunc != nil {
+		return m.AbortMultipartUploadFunc(ctx, params)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.Uploads[*params.UploadId]; !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	delete(m.Uploads, *params.UploadId)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// ListMultipartUploads lists every upload in progress under the prefix in
+// one page.
+func (m *S3Client) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	if m.ListMultipartUploadsFunc != nil {
+		return m.ListMultipartUploadsFunc(ctx, params)
+	}
+	prefix := ""
+	if params.Prefix != nil {
+		prefix = *params.Prefix
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := &s3.ListMultipartUploadsOutput{}
+	for id, upload := range m.Uploads {
+		if !strings.HasPrefix(upload.Key, prefix) {
+			continue
+		}
+		out.Uploads = append(out.Uploads, types.MultipartUpload{Key: &upload.Key, UploadId: &id, Initiated: &upload.Initiated})
+	}
+	sort.Slice(out.Uploads, func(i, j int) bool { return *out.Uploads[i].Key < *out.Uploads[j].Key })
+	return out, nil
+}
+
+// Object returns a copy of a stored object's body.
+func (m *S3Client) Object(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	body, ok := m.Objects[key]
+	return bytes.Clone(body), ok
+}
+
+// S3Presigner signs URLs without credentials. The URL encodes the bucket
+// and key so tests can check what was signed.
+type S3Presigner struct{}
+
+func (S3Presigner) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	return &v4.PresignedHTTPRequest{
+		URL:    fmt.Sprintf("https://%s.s3.amazonaws.com/%s?X-Amz-Signature=mock", *params.Bucket, *params.Key),
+		Method: "GET",
+	}, nil
+}
+
+// PresignPostObject returns the bucket's URL and the fields S3 would
+// expect, with a fake signature.
+func (S3Presigner) PresignPostObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignPostOptions)) (*s3.PresignedPostRequest, error) {
+	return &s3.PresignedPostRequest{
+		URL: fmt.Sprintf("https://%s.s3.amazonaws.com", *params.Bucket),
+		Values: map[string]string{
+			"key":              *params.Key,
+			"policy":           "mock",
+			"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+			"x-amz-credential": "mock",
+			"x-amz-date":       "20060102T150405Z",
+			"x-amz-signature":  "mock",
+		},
+	}, nil
+}
@@ -0,0 +1,324 @@
+// Package mocks provides stand-ins for the server's database and S3 client
+// so handlers can be exercised without live infrastructure.
+package mocks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+//go:generate go run gen_unstubbed.go
+
+// Store is a database.Store for handler tests. The methods the upload
+// handlers call can be replaced through the Func fields; anything else falls
+// through to the embedded Store. NewStore sets that to one that marks the
+// test failed with the name of the method and returns zero values, so a
+// query the test didn't set up is reported instead of panicking.
+type Store struct {
+	database.Store
+
+	GetVideoFunc                        func(ctx context.Context, id uuid.UUID) (database.Video, error)
+	UpdateVideoFunc                     func(ctx context.Context, video database.Video) error
+	SetVideoStatusFunc                  func(ctx context.Context, id uuid.UUID, status database.VideoStatus) error
+	IsUserBannedFunc                    func(ctx context.Context, id uuid.UUID) (bool, error)
+	IsUserSuspendedFunc                 func(ctx context.Context, id uuid.UUID) (bool, error)
+	GetChannelRoleFunc                  func(ctx context.Context, channelID, userID uuid.UUID) (database.ChannelRole, error)
+	GetWebhookSubscriptionsForEventFunc func(ctx context.Context, userID uuid.UUID, eventType string) ([]database.WebhookSubscription, error)
+	GetSubscriberIDsFunc                func(ctx context.Context, creatorID uuid.UUID, channelID *uuid.UUID) ([]uuid.UUID, error)
+	CreateNotificationFunc              func(ctx context.Context, params database.CreateNotificationParams) (*database.Notification, error)
+	CreatePendingUploadFunc             func(ctx context.Context, videoID uuid.UUID, s3Key string) (database.PendingUpload, error)
+	DeletePendingUploadFunc             func(ctx context.Context, id uuid.UUID) error
+	FinalizeVideoUploadFunc             func(ctx context.Context, video database.Video, pendingID uuid.UUID, renditions []database.Rendition, audioTracks []database.AudioTrack) error
+	CreateJobFunc                       func(ctx context.Context, params database.CreateJobParams) (database.Job, error)
+	GetUserQuotaFunc                    func(ctx context.Context, userID uuid.UUID) (*database.UserQuota, error)
+	GetUserUsageFunc                    func(ctx context.Context, userID uuid.UUID, dayStart time.Time) (database.UserUsage, error)
+	SetVideoVirusScanFunc               func(ctx context.Context, videoID uuid.UUID, scan database.VirusScan) error
+	RedeemVideoShareFunc                func(ctx context.Context, token string) (database.VideoShare, error)
+	GetEmbedSettingsFunc                func(ctx context.Context, videoID uuid.UUID) (*database.EmbedSettings, error)
+	GetVideoShareByTokenFunc            func(ctx context.Context, token string) (database.VideoShare, error)
+	GetHLSKeyFunc                       func(ctx context.Context, videoID uuid.UUID) ([]byte, error)
+	GetJobFunc                          func(ctx context.Context, id uuid.UUID) (database.Job, error)
+	ExtendJobLeaseFunc                  func(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) (bool, error)
+	GetVideoAnalyticsFunc               func(ctx context.Context, videoID uuid.UUID, period database.AnalyticsPeriod, since string) ([]database.AnalyticsBucket, error)
+	GetChannelAnalyticsFunc             func(ctx context.Context, channelID uuid.UUID, period database.AnalyticsPeriod, since string) ([]database.AnalyticsBucket, error)
+	RecordViewFunc                      func(ctx context.Context, videoID uuid.UUID) error
+	RecordWatchFunc                     func(ctx context.Context, userID, videoID uuid.UUID) (database.WatchHistoryEntry, error)
+	GetFormUploadFunc                   func(ctx context.Context, id uuid.UUID) (*database.FormUpload, error)
+	ClaimFormUploadFunc                 func(ctx context.Context, id uuid.UUID, staleBefore time.Time) (bool, error)
+	DeleteFormUploadFunc                func(ctx context.Context, id uuid.UUID) error
+	GetUserFunc                         func(ctx context.Context, id uuid.UUID) (*database.User, error)
+	IsUserAdminFunc                     func(ctx context.Context, id uuid.UUID) (bool, error)
+	CreateAuditLogEntryFunc             func(ctx context.Context, params database.CreateAuditLogEntryParams) error
+	RetryJobFunc                        func(ctx context.Context, id uuid.UUID) (bool, error)
+	CancelJobFunc                       func(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+// NewStore returns a Store whose methods fail t unless they're stubbed or
+// have a default below.
+func NewStore(t testing.TB) *Store {
+	return &Store{Store: unstubbedStore{t: t}}
+}
+
+// unstubbedStore implements every database.Store method, in unstubbed.go,
+// by failing the test. It uses Errorf rather than Fatalf because handlers
+// reach the store from the job worker and other goroutines, where FailNow
+// isn't allowed.
+type unstubbedStore struct {
+	t testing.TB
+}
+
+func (s unstubbedStore) fail(method string) {
+	s.t.Helper()
+	s.t.Errorf("mocks.Store: unexpected call to %s; stub it with a Func field", method)
+}
+
+func (m *Store) GetVideo(ctx context.Context, id uuid.UUID) (database.Video, error) {
+	if m.GetVideoFunc == nil {
+		return m.Store.GetVideo(ctx, id)
+	}
+	return m.GetVideoFunc(ctx, id)
+}
+
+func (m *Store) UpdateVideo(ctx context.Context, video database.Video) error {
+	if m.UpdateVideoFunc == nil {
+		return m.Store.UpdateVideo(ctx, video)
+	}
+	return m.UpdateVideoFunc(ctx, video)
+}
+
+func (m *Store) SetVideoStatus(ctx context.Context, id uuid.UUID, status database.VideoStatus) error {
+	if m.SetVideoStatusFunc == nil {
+		return m.Store.SetVideoStatus(ctx, id, status)
+	}
+	return m.SetVideoStatusFunc(ctx, id, status)
+}
+
+// IsUserBanned reports no user as banned unless overridden.
+func (m *Store) IsUserBanned(ctx context.Context, id uuid.UUID) (bool, error) {
+	if m.IsUserBannedFunc == nil {
+		return false, nil
+	}
+	return m.IsUserBannedFunc(ctx, id)
+}
+
+// IsUserSuspended reports no user as suspended unless overridden.
+func (m *Store) IsUserSuspended(ctx context.Context, id uuid.UUID) (bool, error) {
+	if m.IsUserSuspendedFunc == nil {
+		return false, nil
+	}
+	return m.IsUserSuspendedFunc(ctx, id)
+}
+
+func (m *Store) GetChannelRole(ctx context.Context, channelID, userID uuid.UUID) (database.ChannelRole, error) {
+	if m.GetChannelRoleFunc == nil {
+		return m.Store.GetChannelRole(ctx, channelID, userID)
+	}
+	return m.GetChannelRoleFunc(ctx, channelID, userID)
+}
+
+// GetWebhookSubscriptionsForEvent reports no subscriptions unless
+// overridden, so uploads don't try to deliver webhooks.
+func (m *Store) GetWebhookSubscriptionsForEvent(ctx context.Context, userID uuid.UUID, eventType string) ([]database.WebhookSubscription, error) {
+	if m.GetWebhookSubscriptionsForEventFunc == nil {
+		return nil, nil
+	}
+	return m.GetWebhookSubscriptionsForEventFunc(ctx, userID, eventType)
+}
+
+// GetSubscriberIDs reports no subscribers unless overridden.
+func (m *Store) GetSubscriberIDs(ctx context.Context, creatorID uuid.UUID, channelID *uuid.UUID) ([]uuid.UUID, error) {
+	if m.GetSubscriberIDsFunc == nil {
+		return nil, nil
+	}
+	return m.GetSubscriberIDsFunc(ctx, creatorID, channelID)
+}
+
+func (m *Store) CreateNotification(ctx context.Context, params database.CreateNotificationParams) (*database.Notification, error) {
+	if m.CreateNotificationFunc == nil {
+		return m.Store.CreateNotification(ctx, params)
+	}
+	return m.CreateNotificationFunc(ctx, params)
+}
+
+func (m *Store) CreatePendingUpload(ctx context.Context, videoID uuid.UUID, s3Key string) (database.PendingUpload, error) {
+	if m.CreatePendingUploadFunc == nil {
+		return m.Store.CreatePendingUpload(ctx, videoID, s3Key)
+	}
+	return m.CreatePendingUploadFunc(ctx, videoID, s3Key)
+}
+
+func (m *Store) DeletePendingUpload(ctx context.Context, id uuid.UUID) error {
+	if m.DeletePendingUploadFunc == nil {
+		return m.Store.DeletePendingUpload(ctx, id)
+	}
+	return m.DeletePendingUploadFunc(ctx, id)
+}
+
+func (m *Store) FinalizeVideoUpload(ctx context.Context, video database.Video, pendingID uuid.UUID, renditions []database.Rendition, audioTracks []database.AudioTrack) error {
+	if m.FinalizeVideoUploadFunc == nil {
+		return m.Store.FinalizeVideoUpload(ctx, video, pendingID, renditions, audioTracks)
+	}
+	return m.FinalizeVideoUploadFunc(ctx, video, pendingID, renditions, audioTracks)
+}
+
+func (m *Store) CreateJob(ctx context.Context, params database.CreateJobParams) (database.Job, error) {
+	if m.CreateJobFunc == nil {
+		return m.Store.CreateJob(ctx, params)
+	}
+	return m.CreateJobFunc(ctx, params)
+}
+
+// GetUserQuota reports no quota override unless overridden.
+func (m *Store) GetUserQuota(ctx context.Context, userID uuid.UUID) (*database.UserQuota, error) {
+	if m.GetUserQuotaFunc == nil {
+		return nil, nil
+	}
+	return m.GetUserQuotaFunc(ctx, userID)
+}
+
+// GetUserUsage reports no usage unless overridden.
+func (m *Store) GetUserUsage(ctx context.Context, userID uuid.UUID, dayStart time.Time) (database.UserUsage, error) {
+	if m.GetUserUsageFunc == nil {
+		return database.UserUsage{}, nil
+	}
+	return m.GetUserUsageFunc(ctx, userID, dayStart)
+}
+
+func (m *Store) SetVideoVirusScan(ctx context.Context, videoID uuid.UUID, scan database.VirusScan) error {
+	if m.SetVideoVirusScanFunc == nil {
+		return m.Store.SetVideoVirusScan(ctx, videoID, scan)
+	}
+	return m.SetVideoVirusScanFunc(ctx, videoID, scan)
+}
+
+func (m *Store) RedeemVideoShare(ctx context.Context, token string) (database.VideoShare, error) {
+	if m.RedeemVideoShareFunc == nil {
+		return m.Store.RedeemVideoShare(ctx, token)
+	}
+	return m.RedeemVideoShareFunc(ctx, token)
+}
+
+// GetEmbedSettings reports no embed settings unless overridden.
+func (m *Store) GetEmbedSettings(ctx context.Context, videoID uuid.UUID) (*database.EmbedSettings, error) {
+	if m.GetEmbedSettingsFunc == nil {
+		return nil, nil
+	}
+	return m.GetEmbedSettingsFunc(ctx, videoID)
+}
+
+func (m *Store) GetVideoShareByToken(ctx context.Context, token string) (database.VideoShare, error) {
+	if m.GetVideoShareByTokenFunc == nil {
+		return m.Store.GetVideoShareByToken(ctx, token)
+	}
+	return m.GetVideoShareByTokenFunc(ctx, token)
+}
+
+// GetHLSKey reports the video as unencrypted unless overridden.
+func (m *Store) GetHLSKey(ctx context.Context, videoID uuid.UUID) ([]byte, error) {
+	if m.GetHLSKeyFunc == nil {
+		return nil, nil
+	}
+	return m.GetHLSKeyFunc(ctx, videoID)
+}
+
+func (m *Store) GetJob(ctx context.Context, id uuid.UUID) (database.Job, error) {
+	if m.GetJobFunc == nil {
+		return m.Store.GetJob(ctx, id)
+	}
+	return m.GetJobFunc(ctx, id)
+}
+
+func (m *Store) ExtendJobLease(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) (bool, error) {
+	if m.ExtendJobLeaseFunc == nil {
+		return m.Store.ExtendJobLease(ctx, id, attempt, lease)
+	}
+	return m.ExtendJobLeaseFunc(ctx, id, attempt, lease)
+}
+
+func (m *Store) GetVideoAnalytics(ctx context.Context, videoID uuid.UUID, period database.AnalyticsPeriod, since string) ([]database.AnalyticsBucket, error) {
+	if m.GetVideoAnalyticsFunc == nil {
+		return m.Store.GetVideoAnalytics(ctx, videoID, period, since)
+	}
+	return m.GetVideoAnalyticsFunc(ctx, videoID, period, since)
+}
+
+func (m *Store) GetChannelAnalytics(ctx context.Context, channelID uuid.UUID, period database.AnalyticsPeriod, since string) ([]database.AnalyticsBucket, error) {
+	if m.GetChannelAnalyticsFunc == nil {
+		return m.Store.GetChannelAnalytics(ctx, channelID, period, since)
+	}
+	return m.GetChannelAnalyticsFunc(ctx, channelID, period, since)
+}
+
+func (m *Store) RecordView(ctx context.Context, videoID uuid.UUID) error {
+	if m.RecordViewFunc == nil {
+		return m.Store.RecordView(ctx, videoID)
+	}
+	return m.RecordViewFunc(ctx, videoID)
+}
+
+func (m *Store) RecordWatch(ctx context.Context, userID, videoID uuid.UUID) (database.WatchHistoryEntry, error) {
+	if m.RecordWatchFunc == nil {
+		return m.Store.RecordWatch(ctx, userID, videoID)
+	}
+	return m.RecordWatchFunc(ctx, userID, videoID)
+}
+
+func (m *Store) GetFormUpload(ctx context.Context, id uuid.UUID) (*database.FormUpload, error) {
+	if m.GetFormUploadFunc == nil {
+		return m.Store.GetFormUpload(ctx, id)
+	}
+	return m.GetFormUploadFunc(ctx, id)
+}
+
+func (m *Store) ClaimFormUpload(ctx context.Context, id uuid.UUID, staleBefore time.Time) (bool, error) {
+	if m.ClaimFormUploadFunc == nil {
+		return m.Store.ClaimFormUpload(ctx, id, staleBefore)
+	}
+	return m.ClaimFormUploadFunc(ctx, id, staleBefore)
+}
+
+func (m *Store) DeleteFormUpload(ctx context.Context, id uuid.UUID) error {
+	if m.DeleteFormUploadFunc == nil {
+		return m.Store.DeleteFormUpload(ctx, id)
+	}
+	return m.DeleteFormUploadFunc(ctx, id)
+}
+
+func (m *Store) GetUser(ctx context.Context, id uuid.UUID) (*database.User, error) {
+	if m.GetUserFunc == nil {
+		return m.Store.GetUser(ctx, id)
+	}
+	return m.GetUserFunc(ctx, id)
+}
+
+func (m *Store) IsUserAdmin(ctx context.Context, id uuid.UUID) (bool, error) {
+	if m.IsUserAdminFunc == nil {
+		return m.Store.IsUserAdmin(ctx, id)
+	}
+	return m.IsUserAdminFunc(ctx, id)
+}
+
+func (m *Store) CreateAuditLogEntry(ctx context.Context, params database.CreateAuditLogEntryParams) error {
+	if m.CreateAuditLogEntryFunc == nil {
+		return m.Store.CreateAuditLogEntry(ctx, params)
+	}
+	return m.CreateAuditLogEntryFunc(ctx, params)
+}
+
+func (m *Store) RetryJob(ctx context.Context, id uuid.UUID) (bool, error) {
+	if m.RetryJobFunc == nil {
+		return m.Store.RetryJob(ctx, id)
+	}
+	return m.RetryJobFunc(ctx, id)
+}
+
+func (m *Store) CancelJob(ctx context.Context, id uuid.UUID) (bool, error) {
+	if m.CancelJobFunc == nil {
+		return m.Store.CancelJob(ctx, id)
+	}
+	return m.CancelJobFunc(ctx, id)
+}
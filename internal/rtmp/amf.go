@@ -0,0 +1,206 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// AMF0 type markers.
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0a
+	amfDate        = 0x0b
+	amfLongString  = 0x0c
+)
+
+// amfMaxDepth bounds how deeply objects may nest in a command.
+const amfMaxDepth = 16
+
+var errAMFShort = errors.New("amf: value is truncated")
+
+// amfProperty is a property of an object being encoded. Objects are
+// encoded from a slice of them so the properties keep their order.
+type amfProperty struct {
+	Key   string
+	Value any
+}
+
+type amfObj []amfProperty
+
+// decodeAMF decodes every AMF0 value in b. Numbers decode to float64,
+// objects and ECMA arrays to map[string]any, strict arrays to []any and
+// null and undefined to nil.
+func decodeAMF(b []byte) ([]any, error) {
+	var values []any
+	for len(b) > 0 {
+		v, n, err := decodeAMFValue(b, 0)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values, nil
+}
+
+func decodeAMFValue(b []byte, depth int) (any, int, error) {
+	if len(b) < 1 {
+		return nil, 0, errAMFShort
+	}
+	if depth > amfMaxDepth {
+		return nil, 0, errors.New("amf: values nest too deeply")
+	}
+	switch b[0] {
+	case amfNumber:
+		if len(b) < 9 {
+			return nil, 0, errAMFShort
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:9])), 9, nil
+	case amfBoolean:
+		if len(b) < 2 {
+			return nil, 0, errAMFShort
+		}
+		return b[1] != 0, 2, nil
+	case amfString:
+		s, n, err := decodeAMFString(b[1:])
+		return s, 1 + n, err
+	case amfLongString:
+		if len(b) < 5 {
+			return nil, 0, errAMFShort
+		}
+		size := int(binary.BigEndian.Uint32(b[1:5]))
+		if len(b)-5 < size {
+			return nil, 0, errAMFShort
+		}
+		return string(b[5 : 5+size]), 5 + size, nil
+	case amfNull, amfUndefined:
+		return nil, 1, nil
+	case amfObject:
+		obj, n, err := decodeAMFProperties(b[1:], depth)
+		return obj, 1 + n, err
+	case amfECMAArray:
+		// The count is only a hint; the properties end like an object's.
+		if len(b) < 5 {
+			return nil, 0, errAMFShort
+		}
+		obj, n, err := decodeAMFProperties(b[5:], depth)
+		return obj, 5 + n, err
+	case amfStrictArray:
+		if len(b) < 5 {
+			return nil, 0, errAMFShort
+		}
+		count := int(binary.BigEndian.Uint32(b[1:5]))
+		// Every value takes at least a byte.
+		if count > len(b)-5 {
+			return nil, 0, errAMFShort
+		}
+		off := 5
+		var values []any
+		for i := 0; i < count; i++ {
+			v, n, err := decodeAMFValue(b[off:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, v)
+			off += n
+		}
+		return values, off, nil
+	case amfDate:
+		if len(b) < 11 {
+			return nil, 0, errAMFShort
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:9])), 11, nil
+	default:
+		return nil, 0, fmt.Errorf("amf: unsupported type %#x", b[0])
+	}
+}
+
+func decodeAMFString(b []byte) (string, int, error) {
+	if len(b) < 2 {
+		return "", 0, errAMFShort
+	}
+	size := int(binary.BigEndian.Uint16(b))
+	if len(b)-2 < size {
+		return "", 0, errAMFShort
+	}
+	return string(b[2 : 2+size]), 2 + size, nil
+}
+
+// decodeAMFProperties decodes key/value pairs up to the object end marker.
+func decodeAMFProperties(b []byte, depth int) (map[string]any, int, error) {
+	obj := map[string]any{}
+	off := 0
+	for {
+		key, n, err := decodeAMFString(b[off:])
+		if err != nil {
+			return nil, 0, err
+		}
+		off += n
+		if key == "" {
+			if off >= len(b) || b[off] != amfObjectEnd {
+				return nil, 0, errors.New("amf: object isn't terminated")
+			}
+			return obj, off + 1, nil
+		}
+		v, n, err := decodeAMFValue(b[off:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		obj[key] = v
+		off += n
+	}
+}
+
+// encodeAMF encodes values as AMF0. It supports the types the server sends:
+// numbers, booleans, strings, nil and objects.
+func encodeAMF(values ...any) []byte {
+	var b []byte
+	for _, v := range values {
+		b = appendAMF(b, v)
+	}
+	return b
+}
+
+func appendAMF(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case float64:
+		b = append(b, amfNumber)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	case int:
+		return appendAMF(b, float64(v))
+	case bool:
+		if v {
+			return append(b, amfBoolean, 1)
+		}
+		return append(b, amfBoolean, 0)
+	case string:
+		b = append(b, amfString)
+		return appendAMFString(b, v)
+	case amfObj:
+		b = append(b, amfObject)
+		for _, p := range v {
+			b = appendAMFString(b, p.Key)
+			b = appendAMF(b, p.Value)
+		}
+		return append(b, 0, 0, amfObjectEnd)
+	default:
+		return append(b, amfNull)
+	}
+}
+
+func appendAMFString(b []byte, s string) []byte {
+	if len(s) > math.MaxUint16 {
+		s = s[:math.MaxUint16]
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
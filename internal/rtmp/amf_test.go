@@ -0,0 +1,80 @@
+package rtmp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAMFRoundTrip(t *testing.T) {
+	b := encodeAMF("connect", 1, true, nil, amfObj{
+		{"app", "live"},
+		{"nested", amfObj{{"n", 2.5}}},
+	})
+	values, err := decodeAMF(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"connect", float64(1), true, nil, map[string]any{
+		"app":    "live",
+		"nested": map[string]any{"n": 2.5},
+	}}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got %#v\nwant %#v", values, want)
+	}
+}
+
+func TestDecodeAMFTypes(t *testing.T) {
+	b := []byte{
+		amfLongString, 0, 0, 0, 2, 'h', 'i',
+		amfUndefined,
+		amfECMAArray, 0, 0, 0, 1, 0, 1, 'k', amfBoolean, 0, 0, 0, amfObjectEnd,
+		amfStrictArray, 0, 0, 0, 2, amfNull, amfString, 0, 1, 'x',
+		amfDate, 0x40, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	}
+	values, err := decodeAMF(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"hi", nil, map[string]any{"k": false}, []any{nil, "x"}, float64(2)}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got %#v\nwant %#v", values, want)
+	}
+}
+
+func TestDecodeAMFErrors(t *testing.T) {
+	deep := strings.Repeat("\x03\x00\x01k", amfMaxDepth+2)
+	tests := map[string][]byte{
+		"short number":          {amfNumber, 0, 0},
+		"short string":          {amfString, 0, 5, 'a'},
+		"short long string":     {amfLongString, 0xff, 0xff, 0xff, 0xff, 'a'},
+		"unterminated object":   {amfObject, 0, 1, 'k', amfNull},
+		"bad object end":        {amfObject, 0, 0, amfNull},
+		"array longer than msg": {amfStrictArray, 0xff, 0xff, 0xff, 0xff, amfNull},
+		"unsupported type":      {0x11},
+		"too deep":              []byte(deep),
+	}
+	for name, b := range tests {
+		if _, err := decodeAMF(b); err == nil {
+			t.Errorf("%s: decoded %x", name, b)
+		}
+	}
+}
+
+func TestStripSetDataFrame(t *testing.T) {
+	meta := encodeAMF("onMetaData", amfObj{{"width", 1920}})
+	if got := stripSetDataFrame(append(encodeAMF("@setDataFrame"), meta...)); !reflect.DeepEqual(got, meta) {
+		t.Errorf("got %x, want %x", got, meta)
+	}
+	if got := stripSetDataFrame(meta); !reflect.DeepEqual(got, meta) {
+		t.Errorf("changed a payload without @setDataFrame: %x", got)
+	}
+}
+
+func FuzzDecodeAMF(f *testing.F) {
+	f.Add(encodeAMF("connect", 1, amfObj{{"app", "live"}, {"tcUrl", "rtmp://localhost/live"}}))
+	f.Add([]byte{amfStrictArray, 0, 0, 0, 2, amfNull, amfECMAArray, 0, 0, 0, 0, 0, 0, amfObjectEnd})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		decodeAMF(b)
+	})
+}
@@ -0,0 +1,268 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+const (
+	// defaultChunkSize is the chunk size both ends start with.
+	defaultChunkSize = 128
+	// maxMessageSize is the largest message a publisher may send. Video
+	// keyframes are the largest messages in practice, and a few MB even at
+	// high bitrates; the header's 24-bit length alone would allow 16 MB.
+	maxMessageSize = 8 << 20
+	// maxChunkSize is the largest chunk size a peer may set. Larger chunks
+	// could only carry messages too large to accept.
+	maxChunkSize = maxMessageSize
+	// maxChunkStreams bounds how many chunk streams a peer may open.
+	maxChunkStreams = 64
+	// maxBufferedSize bounds the partial messages held across all chunk
+	// streams, so interleaving doesn't multiply maxMessageSize.
+	maxBufferedSize = 2 * maxMessageSize
+	// extendedTimestamp marks a timestamp that doesn't fit in 24 bits and
+	// follows the header in full.
+	extendedTimestamp = 0xffffff
+)
+
+// Message type IDs.
+const (
+	msgSetChunkSize     = 1
+	msgAbort            = 2
+	msgAck              = 3
+	msgUserControl      = 4
+	msgWindowAckSize    = 5
+	msgSetPeerBandwidth = 6
+	msgAudio            = 8
+	msgVideo            = 9
+	msgAMF3Data         = 15
+	msgAMF3Command      = 17
+	msgAMF0Data         = 18
+	msgAMF0Command      = 20
+)
+
+// message is a complete RTMP message, reassembled from its chunks.
+type message struct {
+	typeID    uint8
+	streamID  uint32
+	timestamp uint32
+	payload   []byte
+}
+
+// chunkStream is the state of one chunk stream: the last header seen on it
+// and the message being reassembled.
+type chunkStream struct {
+	timestamp uint32
+	delta     uint32
+	length    uint32
+	typeID    uint8
+	streamID  uint32
+	extended  bool
+	payload   []byte
+}
+
+type chunkReader struct {
+	r         *bufio.Reader
+	chunkSize uint32
+	streams   map[uint32]*chunkStream
+	// buffered is the size of the partial messages in streams.
+	buffered int
+	header   [11]byte
+}
+
+func newChunkReader(r *bufio.Reader) *chunkReader {
+	return &chunkReader{
+		r:         r,
+		chunkSize: defaultChunkSize,
+		streams:   map[uint32]*chunkStream{},
+	}
+}
+
+// readMessage reads chunks until a message is complete.
+func (cr *chunkReader) readMessage() (message, error) {
+	for {
+		msg, ok, err := cr.readChunk()
+		if err != nil {
+			return message{}, err
+		}
+		if ok {
+			return msg, nil
+		}
+	}
+}
+
+// readChunk reads one chunk. It reports whether the chunk completed a
+// message.
+func (cr *chunkReader) readChunk() (message, bool, error) {
+	b, err := cr.r.ReadByte()
+	if err != nil {
+		return message{}, false, err
+	}
+	format := b >> 6
+	csid := uint32(b & 0x3f)
+	switch csid {
+	case 0:
+		b, err := cr.r.ReadByte()
+		if err != nil {
+			return message{}, false, err
+		}
+		csid = 64 + uint32(b)
+	case 1:
+		if _, err := io.ReadFull(cr.r, cr.header[:2]); err != nil {
+			return message{}, false, err
+		}
+		csid = 64 + uint32(cr.header[0]) + uint32(cr.header[1])<<8
+	}
+
+	cs, ok := cr.streams[csid]
+	if !ok {
+		if format != 0 {
+			return message{}, false, fmt.Errorf("chunk stream %d starts without a full header", csid)
+		}
+		if len(cr.streams) >= maxChunkStreams {
+			return message{}, false, fmt.Errorf("too many chunk streams")
+		}
+		cs = &chunkStream{}
+		cr.streams[csid] = cs
+	}
+
+	if format < 3 && len(cs.payload) > 0 {
+		// Only continuation chunks may follow the first chunk of a
+		// message, or its length could change under it.
+		return message{}, false, fmt.Errorf("chunk stream %d starts a message before finishing the last", csid)
+	}
+
+	var timestamp uint32
+	switch format {
+	case 0:
+		if _, err := io.ReadFull(cr.r, cr.header[:11]); err != nil {
+			return message{}, false, err
+		}
+		timestamp = uint24(cr.header[0:3])
+		cs.length = uint24(cr.header[3:6])
+		cs.typeID = cr.header[6]
+		cs.streamID = binary.LittleEndian.Uint32(cr.header[7:11])
+	case 1:
+		if _, err := io.ReadFull(cr.r, cr.header[:7]); err != nil {
+			return message{}, false, err
+		}
+		timestamp = uint24(cr.header[0:3])
+		cs.length = uint24(cr.header[3:6])
+		cs.typeID = cr.header[6]
+	case 2:
+		if _, err := io.ReadFull(cr.r, cr.header[:3]); err != nil {
+			return message{}, false, err
+		}
+		timestamp = uint24(cr.header[0:3])
+	}
+	if format < 3 {
+		cs.extended = timestamp == extendedTimestamp
+	}
+	if cs.extended {
+		// The full timestamp is repeated on every chunk of the message.
+		if _, err := io.ReadFull(cr.r, cr.header[:4]); err != nil {
+			return message{}, false, err
+		}
+		timestamp = binary.BigEndian.Uint32(cr.header[:4])
+	}
+
+	if len(cs.payload) == 0 {
+		switch format {
+		case 0:
+			cs.timestamp = timestamp
+			cs.delta = 0
+		case 1, 2:
+			cs.delta = timestamp
+			cs.timestamp += timestamp
+		case 3:
+			cs.timestamp += cs.delta
+		}
+		if cs.length > maxMessageSize {
+			return message{}, false, fmt.Errorf("message of %d bytes is too large", cs.length)
+		}
+	}
+
+	// The payload grows as chunks arrive rather than by the length the
+	// header claims, so memory follows what the peer has actually sent.
+	n := int(min(cr.chunkSize, cs.length-uint32(len(cs.payload))))
+	if cr.buffered+n > maxBufferedSize {
+		return message{}, false, errors.New("too much of a message buffered")
+	}
+	start := len(cs.payload)
+	cs.payload = slices.Grow(cs.payload, n)[:start+n]
+	if _, err := io.ReadFull(cr.r, cs.payload[start:]); err != nil {
+		return message{}, false, err
+	}
+	cr.buffered += n
+	if uint32(len(cs.payload)) < cs.length {
+		return message{}, false, nil
+	}
+	cr.buffered -= len(cs.payload)
+
+	msg := message{
+		typeID:    cs.typeID,
+		streamID:  cs.streamID,
+		timestamp: cs.timestamp,
+		payload:   cs.payload,
+	}
+	cs.payload = nil
+	return msg, true, nil
+}
+
+// abort discards the partial message on a chunk stream, as the peer asks
+// with an abort message.
+func (cr *chunkReader) abort(csid uint32) {
+	if cs, ok := cr.streams[csid]; ok {
+		cr.buffered -= len(cs.payload)
+		cs.payload = nil
+	}
+}
+
+type chunkWriter struct {
+	w         *bufio.Writer
+	chunkSize int
+}
+
+func newChunkWriter(w *bufio.Writer) *chunkWriter {
+	return &chunkWriter{w: w, chunkSize: defaultChunkSize}
+}
+
+// writeMessage writes a message on a chunk stream, split into chunks. The
+// server only sends small control and command messages, so they all go
+// with a full header and a zero timestamp.
+func (cw *chunkWriter) writeMessage(csid uint8, typeID uint8, streamID uint32, payload []byte) error {
+	header := make([]byte, 0, 12)
+	header = append(header, csid&0x3f, 0, 0, 0)
+	header = appendUint24(header, uint32(len(payload)))
+	header = append(header, typeID)
+	header = binary.LittleEndian.AppendUint32(header, streamID)
+	if _, err := cw.w.Write(header); err != nil {
+		return err
+	}
+	for {
+		n := min(cw.chunkSize, len(payload))
+		if _, err := cw.w.Write(payload[:n]); err != nil {
+			return err
+		}
+		payload = payload[n:]
+		if len(payload) == 0 {
+			break
+		}
+		if err := cw.w.WriteByte(0xc0 | csid&0x3f); err != nil {
+			return err
+		}
+	}
+	return cw.w.Flush()
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
+
+func appendUint24(b []byte, v uint32) []byte {
+	return append(b, byte(v>>16), byte(v>>8), byte(v))
+}
@@ -0,0 +1,261 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chunkHeader builds a chunk's basic and message headers. Fields a format
+// doesn't carry are ignored.
+func chunkHeader(format uint8, csid uint32, timestamp, length uint32, typeID uint8, streamID uint32) []byte {
+	var b []byte
+	switch {
+	case csid < 64:
+		b = append(b, format<<6|byte(csid))
+	case csid < 64+256:
+		b = append(b, format<<6, byte(csid-64))
+	default:
+		b = append(b, format<<6|1, byte(csid-64), byte((csid-64)>>8))
+	}
+	ts := min(timestamp, extendedTimestamp)
+	switch format {
+	case 0:
+		b = appendUint24(b, ts)
+		b = appendUint24(b, length)
+		b = append(b, typeID)
+		b = binary.LittleEndian.AppendUint32(b, streamID)
+	case 1:
+		b = appendUint24(b, ts)
+		b = appendUint24(b, length)
+		b = append(b, typeID)
+	case 2:
+		b = appendUint24(b, ts)
+	}
+	if timestamp >= extendedTimestamp {
+		b = binary.BigEndian.AppendUint32(b, timestamp)
+	}
+	return b
+}
+
+func readAll(t *testing.T, data []byte, chunkSize uint32) ([]message, error) {
+	t.Helper()
+	cr := newChunkReader(bufio.NewReader(bytes.NewReader(data)))
+	if chunkSize != 0 {
+		cr.chunkSize = chunkSize
+	}
+	var msgs []message
+	for {
+		msg, err := cr.readMessage()
+		if err == io.EOF {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestChunkReaderHeaders(t *testing.T) {
+	var data []byte
+	// A full header, then headers that reuse the stream ID, then the type
+	// and length, then everything but the timestamp delta.
+	data = append(data, chunkHeader(0, 4, 1000, 3, msgAudio, 1)...)
+	data = append(data, "abc"...)
+	data = append(data, chunkHeader(1, 4, 20, 2, msgVideo, 0)...)
+	data = append(data, "de"...)
+	data = append(data, chunkHeader(2, 4, 30, 0, 0, 0)...)
+	data = append(data, "fg"...)
+	data = append(data, chunkHeader(3, 4, 0, 0, 0, 0)...)
+	data = append(data, "hi"...)
+	// Stream IDs that need the two- and three-byte basic headers.
+	data = append(data, chunkHeader(0, 300, 5, 1, msgAMF0Data, 1)...)
+	data = append(data, "j"...)
+	data = append(data, chunkHeader(0, 70, 6, 1, msgAMF0Data, 1)...)
+	data = append(data, "k"...)
+
+	msgs, err := readAll(t, data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []message{
+		{typeID: msgAudio, streamID: 1, timestamp: 1000, payload: []byte("abc")},
+		{typeID: msgVideo, streamID: 1, timestamp: 1020, payload: []byte("de")},
+		{typeID: msgVideo, streamID: 1, timestamp: 1050, payload: []byte("fg")},
+		{typeID: msgVideo, streamID: 1, timestamp: 1080, payload: []byte("hi")},
+		{typeID: msgAMF0Data, streamID: 1, timestamp: 5, payload: []byte("j")},
+		{typeID: msgAMF0Data, streamID: 1, timestamp: 6, payload: []byte("k")},
+	}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("got %+v\nwant %+v", msgs, want)
+	}
+}
+
+func TestChunkReaderReassembly(t *testing.T) {
+	video := bytes.Repeat([]byte("v"), 10)
+	audio := bytes.Repeat([]byte("a"), 6)
+	var data []byte
+	// Two messages split into 4-byte chunks and interleaved, the video's
+	// timestamp in the extended field on every chunk.
+	data = append(data, chunkHeader(0, 6, 0x01000000, 10, msgVideo, 1)...)
+	data = append(data, video[:4]...)
+	data = append(data, chunkHeader(0, 4, 7, 6, msgAudio, 1)...)
+	data = append(data, audio[:4]...)
+	data = append(data, chunkHeader(3, 6, 0x01000000, 0, 0, 0)...)
+	data = append(data, video[4:8]...)
+	data = append(data, chunkHeader(3, 4, 0, 0, 0, 0)...)
+	data = append(data, audio[4:]...)
+	data = append(data, chunkHeader(3, 6, 0x01000000, 0, 0, 0)...)
+	data = append(data, video[8:]...)
+
+	msgs, err := readAll(t, data, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+	if !bytes.Equal(msgs[0].payload, audio) || msgs[0].timestamp != 7 {
+		t.Errorf("audio = %q at %d", msgs[0].payload, msgs[0].timestamp)
+	}
+	if !bytes.Equal(msgs[1].payload, video) || msgs[1].timestamp != 0x01000000 {
+		t.Errorf("video = %q at %#x", msgs[1].payload, msgs[1].timestamp)
+	}
+}
+
+func TestChunkReaderAbort(t *testing.T) {
+	var data []byte
+	data = append(data, chunkHeader(0, 4, 0, 8, msgVideo, 1)...)
+	data = append(data, "abcd"...)
+	cr := newChunkReader(bufio.NewReader(bytes.NewReader(data)))
+	cr.chunkSize = 4
+	if _, ok, err := cr.readChunk(); ok || err != nil {
+		t.Fatalf("readChunk = %v, %v", ok, err)
+	}
+	if cr.buffered != 4 {
+		t.Errorf("buffered = %d, want 4", cr.buffered)
+	}
+	cr.abort(4)
+	if cr.buffered != 0 || cr.streams[4].payload != nil {
+		t.Errorf("abort left %d bytes buffered", cr.buffered)
+	}
+}
+
+func TestChunkReaderErrors(t *testing.T) {
+	tests := map[string]struct {
+		data []byte
+		want string
+	}{
+		"no full header": {
+			chunkHeader(1, 4, 0, 1, msgAudio, 0),
+			"starts without a full header",
+		},
+		"message too large": {
+			chunkHeader(0, 4, 0, maxMessageSize+1, msgVideo, 1),
+			"too large",
+		},
+		"new message mid-message": {
+			// Before this was refused, the longer length overran the
+			// payload allocated for the first.
+			concat(
+				chunkHeader(0, 4, 0, 200, msgVideo, 1), make([]byte, 128),
+				chunkHeader(1, 4, 0, 1000, msgVideo, 0), make([]byte, 128),
+			),
+			"before finishing the last",
+		},
+		"too many streams": {
+			func() []byte {
+				var b []byte
+				for csid := range uint32(maxChunkStreams + 1) {
+					b = append(b, chunkHeader(0, csid+2, 0, 1, msgAudio, 1)...)
+					b = append(b, 0)
+				}
+				return b
+			}(),
+			"too many chunk streams",
+		},
+		"truncated": {
+			concat(chunkHeader(0, 4, 0, 10, msgVideo, 1), []byte("abc")),
+			"unexpected EOF",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readAll(t, tc.data, 0)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestChunkReaderBufferLimit(t *testing.T) {
+	// Each stream starts a message as large as allowed, half of it in the
+	// first chunk, until the fifth takes the total over the limit.
+	const length = maxMessageSize
+	var data []byte
+	for csid := uint32(4); csid < 9; csid++ {
+		data = append(data, chunkHeader(0, csid, 0, length, msgVideo, 1)...)
+		data = append(data, make([]byte, maxMessageSize/2)...)
+	}
+	_, err := readAll(t, data, maxMessageSize/2)
+	if err == nil || !strings.Contains(err.Error(), "too much of a message buffered") {
+		t.Errorf("err = %v, want the buffer limit", err)
+	}
+}
+
+func TestChunkWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	cw := newChunkWriter(w)
+	cw.chunkSize = 5
+	payload := []byte("a command split into chunks")
+	if err := cw.writeMessage(csidCommand, msgAMF0Command, 1, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := readAll(t, buf.Bytes(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []message{{typeID: msgAMF0Command, streamID: 1, payload: payload}}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("got %+v, want %+v", msgs, want)
+	}
+}
+
+func FuzzChunkReader(f *testing.F) {
+	f.Add(concat(chunkHeader(0, 3, 0, 4, msgAMF0Command, 0), []byte{1, 2, 3, 4}), uint16(128))
+	f.Add(concat(
+		chunkHeader(0, 4, 0x01000000, 6, msgVideo, 1), []byte("abc"),
+		chunkHeader(3, 4, 0x01000000, 0, 0, 0), []byte("def"),
+		chunkHeader(1, 4, 5, 2, msgAudio, 0), []byte("gh"),
+		chunkHeader(2, 4, 5, 0, 0, 0), []byte("ij"),
+	), uint16(3))
+	f.Fuzz(func(t *testing.T, data []byte, chunkSize uint16) {
+		cr := newChunkReader(bufio.NewReader(bytes.NewReader(data)))
+		cr.chunkSize = max(uint32(chunkSize), 1)
+		for {
+			msg, err := cr.readMessage()
+			if err != nil {
+				return
+			}
+			if len(msg.payload) > maxMessageSize {
+				t.Fatalf("read a %d byte message", len(msg.payload))
+			}
+			if cr.buffered < 0 || cr.buffered > maxBufferedSize {
+				t.Fatalf("buffered = %d", cr.buffered)
+			}
+		}
+	})
+}
+
+// concat concatenates byte slices.
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
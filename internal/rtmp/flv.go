@@ -0,0 +1,33 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// FLV tag types. They match the RTMP message types they carry.
+const (
+	flvTagAudio  = msgAudio
+	flvTagVideo  = msgVideo
+	flvTagScript = msgAMF0Data
+)
+
+// flvHeader starts a file with audio and video, followed by the zero size
+// of the tag before the first.
+var flvHeader = []byte{'F', 'L', 'V', 1, 0x05, 0, 0, 0, 9, 0, 0, 0, 0}
+
+// FLVHeaderSize is how much of a stream's FLV comes before its first tag.
+const FLVHeaderSize = 13
+
+// writeFLVTag writes one tag and the size that follows it.
+func writeFLVTag(w io.Writer, tagType uint8, timestamp uint32, data []byte) error {
+	tag := make([]byte, 0, 11+len(data)+4)
+	tag = append(tag, tagType)
+	tag = appendUint24(tag, uint32(len(data)))
+	tag = appendUint24(tag, timestamp&0xffffff)
+	tag = append(tag, byte(timestamp>>24), 0, 0, 0)
+	tag = append(tag, data...)
+	tag = binary.BigEndian.AppendUint32(tag, uint32(11+len(data)))
+	_, err := w.Write(tag)
+	return err
+}
@@ -0,0 +1,341 @@
+// Package rtmp accepts live streams published over RTMP and passes their
+// audio and video on as FLV. Only publishing is supported: streams are
+// played back some other way.
+package rtmp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	handshakeSize = 1536
+	rtmpVersion   = 3
+
+	// serverChunkSize is the chunk size the server switches to.
+	serverChunkSize = 4096
+	// serverWindowSize is the acknowledgement window the server asks for.
+	serverWindowSize = 5000000
+	// publishStreamID is the message stream createStream hands out. A
+	// connection publishes at most one stream.
+	publishStreamID = 1
+
+	csidControl = 2
+	csidCommand = 3
+	csidStatus  = 5
+
+	defaultTimeout = 30 * time.Second
+)
+
+// PublishFunc starts a stream named name in the application app. The
+// stream's audio and video are written to the returned writer as FLV, and
+// it's closed when the publisher stops or disconnects. A non-nil error
+// refuses the stream; its message is sent to the publisher.
+type PublishFunc func(ctx context.Context, app, name string) (io.WriteCloser, error)
+
+type Server struct {
+	Publish PublishFunc
+	// Timeout closes connections that send nothing for this long. Zero
+	// means 30 seconds.
+	Timeout time.Duration
+}
+
+// Serve accepts connections on ln until ctx is cancelled, which also
+// closes the connections being served.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go s.serveConn(ctx, nc)
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, nc net.Conn) {
+	defer nc.Close()
+	stop := context.AfterFunc(ctx, func() { nc.Close() })
+	defer stop()
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	tc := &timeoutConn{Conn: nc, timeout: timeout}
+	c := &conn{
+		srv: s,
+		rw:  bufio.NewReadWriter(bufio.NewReader(tc), bufio.NewWriter(tc)),
+		tc:  tc,
+	}
+	err := c.serve(ctx)
+	if c.out != nil {
+		if cerr := c.out.Close(); cerr != nil {
+			slog.ErrorContext(ctx, "Couldn't end RTMP stream", "app", c.app, "error", cerr)
+		}
+	}
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		slog.InfoContext(ctx, "RTMP connection closed", "remote", nc.RemoteAddr().String(), "error", err)
+	}
+}
+
+// timeoutConn sets a deadline before every read and write, and counts the
+// bytes read for acknowledgements.
+type timeoutConn struct {
+	net.Conn
+	timeout   time.Duration
+	bytesRead uint64
+}
+
+func (tc *timeoutConn) Read(p []byte) (int, error) {
+	tc.Conn.SetReadDeadline(time.Now().Add(tc.timeout))
+	n, err := tc.Conn.Read(p)
+	tc.bytesRead += uint64(n)
+	return n, err
+}
+
+func (tc *timeoutConn) Write(p []byte) (int, error) {
+	tc.Conn.SetWriteDeadline(time.Now().Add(tc.timeout))
+	return tc.Conn.Write(p)
+}
+
+type conn struct {
+	srv *Server
+	rw  *bufio.ReadWriter
+	tc  *timeoutConn
+	cr  *chunkReader
+	cw  *chunkWriter
+
+	app string
+	// out receives the stream once publishing starts.
+	out io.WriteCloser
+
+	// ackWindow is the acknowledgement window the publisher asked for, and
+	// lastAck the byte count last acknowledged.
+	ackWindow uint32
+	lastAck   uint64
+}
+
+func (c *conn) serve(ctx context.Context) error {
+	if err := c.handshake(); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	c.cr = newChunkReader(c.rw.Reader)
+	c.cw = newChunkWriter(c.rw.Writer)
+
+	for {
+		msg, err := c.cr.readMessage()
+		if err != nil {
+			return err
+		}
+		if err := c.acknowledge(); err != nil {
+			return err
+		}
+		done, err := c.handle(ctx, msg)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// handshake performs the plain RTMP handshake: the server's random bytes
+// aren't checked by publishers, and S2 echoes C1.
+func (c *conn) handshake() error {
+	c0c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(c.rw, c0c1); err != nil {
+		return err
+	}
+	if c0c1[0] != rtmpVersion {
+		return fmt.Errorf("unsupported version %d", c0c1[0])
+	}
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	s0s1s2[0] = rtmpVersion
+	// S1 is a zero time and zero field followed by random bytes.
+	if _, err := rand.Read(s0s1s2[9 : 1+handshakeSize]); err != nil {
+		return err
+	}
+	copy(s0s1s2[1+handshakeSize:], c0c1[1:])
+	if _, err := c.rw.Write(s0s1s2); err != nil {
+		return err
+	}
+	if err := c.rw.Flush(); err != nil {
+		return err
+	}
+	c2 := make([]byte, handshakeSize)
+	_, err := io.ReadFull(c.rw, c2)
+	return err
+}
+
+// acknowledge sends an acknowledgement each time the publisher's window
+// of bytes has been read.
+func (c *conn) acknowledge() error {
+	if c.ackWindow == 0 || c.tc.bytesRead-c.lastAck < uint64(c.ackWindow) {
+		return nil
+	}
+	c.lastAck = c.tc.bytesRead
+	return c.cw.writeMessage(csidControl, msgAck, 0, binary.BigEndian.AppendUint32(nil, uint32(c.lastAck)))
+}
+
+// handle handles one message. It reports whether the publisher is done.
+func (c *conn) handle(ctx context.Context, msg message) (bool, error) {
+	switch msg.typeID {
+	case msgSetChunkSize:
+		if len(msg.payload) < 4 {
+			return false, errors.New("short set chunk size message")
+		}
+		size := binary.BigEndian.Uint32(msg.payload) & 0x7fffffff
+		if size < 1 || size > maxChunkSize {
+			return false, fmt.Errorf("invalid chunk size %d", size)
+		}
+		c.cr.chunkSize = size
+	case msgAbort:
+		if len(msg.payload) < 4 {
+			return false, errors.New("short abort message")
+		}
+		c.cr.abort(binary.BigEndian.Uint32(msg.payload))
+	case msgWindowAckSize:
+		if len(msg.payload) < 4 {
+			return false, errors.New("short window acknowledgement size message")
+		}
+		c.ackWindow = binary.BigEndian.Uint32(msg.payload)
+	case msgAMF0Command:
+		return c.handleCommand(ctx, msg, msg.payload)
+	case msgAMF3Command:
+		// AMF3 commands start with a format byte and are otherwise AMF0.
+		if len(msg.payload) < 1 {
+			return false, errors.New("empty command")
+		}
+		return c.handleCommand(ctx, msg, msg.payload[1:])
+	case msgAudio, msgVideo:
+		if c.out == nil {
+			return false, nil
+		}
+		return false, writeFLVTag(c.out, msg.typeID, msg.timestamp, msg.payload)
+	case msgAMF0Data:
+		if c.out == nil {
+			return false, nil
+		}
+		return false, writeFLVTag(c.out, flvTagScript, msg.timestamp, stripSetDataFrame(msg.payload))
+	}
+	return false, nil
+}
+
+func (c *conn) handleCommand(ctx context.Context, msg message, payload []byte) (bool, error) {
+	values, err := decodeAMF(payload)
+	if err != nil {
+		return false, err
+	}
+	if len(values) < 2 {
+		return false, errors.New("command is missing its name or transaction")
+	}
+	name, _ := values[0].(string)
+	txn, _ := values[1].(float64)
+
+	switch name {
+	case "connect":
+		if len(values) > 2 {
+			if obj, ok := values[2].(map[string]any); ok {
+				app, _ := obj["app"].(string)
+				c.app = strings.Trim(app, "/")
+			}
+		}
+		if err := c.cw.writeMessage(csidControl, msgWindowAckSize, 0, binary.BigEndian.AppendUint32(nil, serverWindowSize)); err != nil {
+			return false, err
+		}
+		// The limit type is dynamic.
+		bandwidth := append(binary.BigEndian.AppendUint32(nil, serverWindowSize), 2)
+		if err := c.cw.writeMessage(csidControl, msgSetPeerBandwidth, 0, bandwidth); err != nil {
+			return false, err
+		}
+		if err := c.cw.writeMessage(csidControl, msgSetChunkSize, 0, binary.BigEndian.AppendUint32(nil, serverChunkSize)); err != nil {
+			return false, err
+		}
+		c.cw.chunkSize = serverChunkSize
+		return false, c.writeCommand(0, "_result", txn,
+			amfObj{
+				{"fmsVer", "FMS/3,0,1,123"},
+				{"capabilities", 31},
+			},
+			amfObj{
+				{"level", "status"},
+				{"code", "NetConnection.Connect.Success"},
+				{"description", "Connection succeeded."},
+				{"objectEncoding", 0},
+			},
+		)
+	case "releaseStream", "FCPublish":
+		return false, c.writeCommand(0, "_result", txn, nil)
+	case "createStream":
+		return false, c.writeCommand(0, "_result", txn, nil, publishStreamID)
+	case "publish":
+		if c.out != nil {
+			return false, errors.New("already publishing")
+		}
+		var streamName string
+		if len(values) > 3 {
+			streamName, _ = values[3].(string)
+		}
+		// Publishers may append a query string to the stream name.
+		streamName, _, _ = strings.Cut(streamName, "?")
+		out, err := c.srv.Publish(ctx, c.app, streamName)
+		if err != nil {
+			werr := c.writeStatus(msg.streamID, "error", "NetStream.Publish.BadName", err.Error())
+			return true, werr
+		}
+		if _, err := out.Write(flvHeader); err != nil {
+			out.Close()
+			return true, err
+		}
+		c.out = out
+		return false, c.writeStatus(msg.streamID, "status", "NetStream.Publish.Start", "Publishing "+streamName+".")
+	case "deleteStream", "closeStream":
+		return c.out != nil, nil
+	}
+	return false, nil
+}
+
+func (c *conn) writeCommand(streamID uint32, name string, txn float64, args ...any) error {
+	payload := encodeAMF(append([]any{name, txn}, args...)...)
+	return c.cw.writeMessage(csidCommand, msgAMF0Command, streamID, payload)
+}
+
+func (c *conn) writeStatus(streamID uint32, level, code, description string) error {
+	payload := encodeAMF("onStatus", 0, nil, amfObj{
+		{"level", level},
+		{"code", code},
+		{"description", description},
+	})
+	return c.cw.writeMessage(csidStatus, msgAMF0Command, streamID, payload)
+}
+
+// stripSetDataFrame drops the "@setDataFrame" publishers put before
+// onMetaData, which FLV files don't have.
+func stripSetDataFrame(payload []byte) []byte {
+	const name = "@setDataFrame"
+	if len(payload) < 3+len(name) || payload[0] != amfString {
+		return payload
+	}
+	if s, n, err := decodeAMFString(payload[1:]); err == nil && s == name {
+		return payload[1+n:]
+	}
+	return payload
+}
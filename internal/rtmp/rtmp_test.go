@@ -0,0 +1,219 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// publisher is the client end of a connection to the server.
+type publisher struct {
+	nc   net.Conn
+	cr   *chunkReader
+	cw   *chunkWriter
+	done chan struct{}
+}
+
+// dial connects a publisher to srv over a pipe and does the handshake.
+func dial(t *testing.T, srv *Server) *publisher {
+	t.Helper()
+	client, server := net.Pipe()
+	p := &publisher{nc: client, done: make(chan struct{})}
+	go func() {
+		srv.serveConn(context.Background(), server)
+		close(p.done)
+	}()
+	t.Cleanup(p.close)
+	client.SetDeadline(time.Now().Add(10 * time.Second))
+
+	c0c1 := make([]byte, 1+handshakeSize)
+	c0c1[0] = rtmpVersion
+	copy(c0c1[9:], "client random")
+	if _, err := client.Write(c0c1); err != nil {
+		t.Fatal(err)
+	}
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	if _, err := io.ReadFull(client, s0s1s2); err != nil {
+		t.Fatal(err)
+	}
+	if s0s1s2[0] != rtmpVersion || !bytes.Equal(s0s1s2[1+handshakeSize:], c0c1[1:]) {
+		t.Fatal("S2 doesn't echo C1")
+	}
+	if _, err := client.Write(s0s1s2[1 : 1+handshakeSize]); err != nil {
+		t.Fatal(err)
+	}
+
+	p.cr = newChunkReader(bufio.NewReader(client))
+	p.cw = newChunkWriter(bufio.NewWriter(client))
+	return p
+}
+
+// close disconnects and waits for the server to finish with the
+// connection.
+func (p *publisher) close() {
+	p.nc.Close()
+	<-p.done
+}
+
+func (p *publisher) command(t *testing.T, streamID uint32, name string, txn float64, args ...any) {
+	t.Helper()
+	payload := encodeAMF(append([]any{name, txn}, args...)...)
+	if err := p.cw.writeMessage(csidCommand, msgAMF0Command, streamID, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readCommand reads up to the next command, following the server's chunk
+// size changes on the way.
+func (p *publisher) readCommand(t *testing.T) []any {
+	t.Helper()
+	for {
+		msg, err := p.cr.readMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch msg.typeID {
+		case msgSetChunkSize:
+			p.cr.chunkSize = binary.BigEndian.Uint32(msg.payload)
+		case msgAMF0Command:
+			values, err := decodeAMF(msg.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return values
+		}
+	}
+}
+
+func statusCode(values []any) string {
+	if len(values) < 4 {
+		return ""
+	}
+	info, _ := values[3].(map[string]any)
+	code, _ := info["code"].(string)
+	return code
+}
+
+// stream is what a publish wrote, once it's closed.
+type stream struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (s *stream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestPublish(t *testing.T) {
+	var app, name string
+	out := &stream{}
+	srv := &Server{Publish: func(ctx context.Context, a, n string) (io.WriteCloser, error) {
+		app, name = a, n
+		return out, nil
+	}}
+	p := dial(t, srv)
+
+	p.command(t, 0, "connect", 1, amfObj{{"app", "/live/"}, {"tcUrl", "rtmp://localhost/live"}})
+	if values := p.readCommand(t); values[0] != "_result" || values[1] != float64(1) {
+		t.Fatalf("connect = %v", values)
+	}
+	if p.cr.chunkSize != serverChunkSize {
+		t.Errorf("server chunk size = %d, want %d", p.cr.chunkSize, serverChunkSize)
+	}
+	p.command(t, 0, "createStream", 2, nil)
+	if values := p.readCommand(t); values[0] != "_result" || values[3] != float64(publishStreamID) {
+		t.Fatalf("createStream = %v", values)
+	}
+	p.command(t, publishStreamID, "publish", 3, nil, "key?token=x", "live")
+	if values := p.readCommand(t); statusCode(values) != "NetStream.Publish.Start" {
+		t.Fatalf("publish = %v", values)
+	}
+	if app != "live" || name != "key" {
+		t.Errorf("published %q/%q, want live/key", app, name)
+	}
+
+	// Larger chunks, then a frame split across them and some metadata.
+	if err := p.cw.writeMessage(csidControl, msgSetChunkSize, 0, binary.BigEndian.AppendUint32(nil, 1024)); err != nil {
+		t.Fatal(err)
+	}
+	p.cw.chunkSize = 1024
+	frame := bytes.Repeat([]byte{0x17}, 3000)
+	if err := p.cw.writeMessage(6, msgVideo, publishStreamID, frame); err != nil {
+		t.Fatal(err)
+	}
+	meta := encodeAMF("onMetaData", amfObj{{"width", 1280}})
+	if err := p.cw.writeMessage(4, msgAMF0Data, publishStreamID, append(encodeAMF("@setDataFrame"), meta...)); err != nil {
+		t.Fatal(err)
+	}
+	p.command(t, publishStreamID, "deleteStream", 4, nil, publishStreamID)
+	<-p.done
+
+	var want bytes.Buffer
+	want.Write(flvHeader)
+	writeFLVTag(&want, flvTagVideo, 0, frame)
+	writeFLVTag(&want, flvTagScript, 0, meta)
+	if !out.closed {
+		t.Error("stream wasn't closed")
+	}
+	if !bytes.Equal(out.buf.Bytes(), want.Bytes()) {
+		t.Errorf("FLV = %d bytes, want %d", out.buf.Len(), want.Len())
+	}
+}
+
+func TestPublishRefused(t *testing.T) {
+	srv := &Server{Publish: func(ctx context.Context, app, name string) (io.WriteCloser, error) {
+		return nil, errors.New("invalid stream key")
+	}}
+	p := dial(t, srv)
+
+	p.command(t, 0, "connect", 1, amfObj{{"app", "live"}})
+	p.readCommand(t)
+	p.command(t, publishStreamID, "publish", 2, nil, "wrong", "live")
+	values := p.readCommand(t)
+	if statusCode(values) != "NetStream.Publish.BadName" {
+		t.Fatalf("publish = %v", values)
+	}
+	if info := values[3].(map[string]any); info["description"] != "invalid stream key" {
+		t.Errorf("description = %v", info["description"])
+	}
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server kept the connection open")
+	}
+}
+
+func TestInvalidChunkSize(t *testing.T) {
+	srv := &Server{Publish: func(ctx context.Context, app, name string) (io.WriteCloser, error) {
+		t.Error("published")
+		return nil, nil
+	}}
+	for _, size := range []uint32{0, maxChunkSize + 1} {
+		p := dial(t, srv)
+		if err := p.cw.writeMessage(csidControl, msgSetChunkSize, 0, binary.BigEndian.AppendUint32(nil, size)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-p.done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("chunk size %d was accepted", size)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// collector is an OTLP/HTTP endpoint that records the requests it gets.
+type collector struct {
+	srv      *httptest.Server
+	status   int
+	requests chan exportRequest
+}
+
+// exportRequest is the part of ExportTraceServiceRequest's JSON encoding
+// the tests check, decoded without the exporter's types.
+type exportRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []attribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			Spans []exportedSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type exportedSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      *string        `json:"parentSpanId"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []attribute    `json:"attributes"`
+	Status            map[string]any `json:"status"`
+}
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{status: http.StatusOK, requests: make(chan exportRequest, 16)}
+	c.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+			t.Errorf("%s %s, want POST /v1/traces", r.Method, r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req exportRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("decoding %s: %v", body, err)
+		}
+		c.requests <- req
+		w.WriteHeader(c.status)
+	}))
+	t.Cleanup(c.srv.Close)
+	return c
+}
+
+func (c *collector) spans(t *testing.T, req exportRequest) []exportedSpan {
+	t.Helper()
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("request = %+v, want one resource with one scope", req)
+	}
+	return req.ResourceSpans[0].ScopeSpans[0].Spans
+}
+
+func TestExport(t *testing.T) {
+	c := newCollector(t)
+	tracer := NewTracer(c.srv.URL, "tubely-test")
+	useTracer(t, tracer)
+
+	ctx, root := Start(context.Background(), "GET /api/videos", KindServer,
+		String("http.method", "GET"),
+		Int("http.status_code", 200),
+		Int64("size", 1<<40),
+		Float64("ratio", 1.5),
+		Bool("cached", true),
+		Attr{"elapsed", 1500 * time.Millisecond},
+	)
+	_, child := Start(ctx, "db.query", KindClient)
+	child.RecordError(errors.New("no such table"))
+	child.End()
+	root.SetName("GET /api/videos/{id}")
+	root.End()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tracer.Shutdown(shutdownCtx)
+
+	var req exportRequest
+	select {
+	case req = <-c.requests:
+	default:
+		t.Fatal("Shutdown didn't export the queued spans")
+	}
+	resource := req.ResourceSpans[0].Resource.Attributes
+	if len(resource) != 1 || resource[0].Key != "service.name" || resource[0].Value["stringValue"] != "tubely-test" {
+		t.Errorf("resource attributes = %+v", resource)
+	}
+	if scope := req.ResourceSpans[0].ScopeSpans[0].Scope.Name; scope != "tubely" {
+		t.Errorf("scope = %q", scope)
+	}
+	spans := c.spans(t, req)
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	gotChild, gotRoot := spans[0], spans[1]
+
+	if gotRoot.Name != "GET /api/videos/{id}" || gotRoot.Kind != int(KindServer) {
+		t.Errorf("root = %q kind %d", gotRoot.Name, gotRoot.Kind)
+	}
+	if gotRoot.TraceID != root.sc.TraceID.String() || gotRoot.SpanID != root.sc.SpanID.String() {
+		t.Errorf("root IDs = %s/%s, want %s/%s", gotRoot.TraceID, gotRoot.SpanID, root.sc.TraceID, root.sc.SpanID)
+	}
+	if len(gotRoot.TraceID) != 32 || len(gotRoot.SpanID) != 16 {
+		t.Errorf("IDs aren't hex: %s/%s", gotRoot.TraceID, gotRoot.SpanID)
+	}
+	if gotRoot.ParentSpanID != nil {
+		t.Errorf("root has parentSpanId %q", *gotRoot.ParentSpanID)
+	}
+	if len(gotRoot.Status) != 0 {
+		t.Errorf("root status = %v, want unset", gotRoot.Status)
+	}
+	wantAttrs := map[string]map[string]any{
+		"http.method":      {"stringValue": "GET"},
+		"http.status_code": {"intValue": "200"},
+		"size":             {"intValue": "1099511627776"},
+		"ratio":            {"doubleValue": 1.5},
+		"cached":           {"boolValue": true},
+		"elapsed":          {"stringValue": "1.5s"},
+	}
+	if len(gotRoot.Attributes) != len(wantAttrs) {
+		t.Errorf("root attributes = %+v", gotRoot.Attributes)
+	}
+	for _, a := range gotRoot.Attributes {
+		want := wantAttrs[a.Key]
+		if len(a.Value) != 1 || len(want) != 1 {
+			t.Errorf("attribute %s = %v, want %v", a.Key, a.Value, want)
+			continue
+		}
+		for k, v := range want {
+			if a.Value[k] != v {
+				t.Errorf("attribute %s = %v, want %v", a.Key, a.Value, want)
+			}
+		}
+	}
+	start, err1 := strconv.ParseInt(gotRoot.StartTimeUnixNano, 10, 64)
+	end, err2 := strconv.ParseInt(gotRoot.EndTimeUnixNano, 10, 64)
+	if err1 != nil || err2 != nil || start <= 0 || end < start {
+		t.Errorf("root times = %s to %s", gotRoot.StartTimeUnixNano, gotRoot.EndTimeUnixNano)
+	}
+
+	if gotChild.ParentSpanID == nil || *gotChild.ParentSpanID != gotRoot.SpanID || gotChild.TraceID != gotRoot.TraceID {
+		t.Errorf("child %+v isn't under root %s", gotChild, gotRoot.SpanID)
+	}
+	if gotChild.Kind != int(KindClient) {
+		t.Errorf("child kind = %d", gotChild.Kind)
+	}
+	if gotChild.Status["code"] != float64(2) || gotChild.Status["message"] != "no such table" {
+		t.Errorf("child status = %v, want code 2 with the error", gotChild.Status)
+	}
+}
+
+func TestExportFullBatch(t *testing.T) {
+	c := newCollector(t)
+	tracer := NewTracer(c.srv.URL, "tubely-test")
+	useTracer(t, tracer)
+	defer tracer.Shutdown(context.Background())
+
+	for range batchSize {
+		_, span := Start(context.Background(), "span", KindInternal)
+		span.End()
+	}
+	select {
+	case req := <-c.requests:
+		if n := len(c.spans(t, req)); n != batchSize {
+			t.Errorf("exported %d spans, want %d", n, batchSize)
+		}
+	case <-time.After(flushInterval / 2):
+		t.Fatal("a full batch wasn't exported before the flush interval")
+	}
+}
+
+func TestExportCollectorError(t *testing.T) {
+	c := newCollector(t)
+	c.status = http.StatusServiceUnavailable
+	tracer := &Tracer{endpoint: c.srv.URL, service: "tubely-test", client: c.srv.Client()}
+
+	span := &Span{name: "span", start: time.Now(), end: time.Now()}
+	if err := tracer.export([]*Span{span}); err == nil {
+		t.Error("export succeeded though the collector returned 503")
+	}
+}
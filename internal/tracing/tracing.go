@@ -0,0 +1,225 @@
+// Package tracing records OpenTelemetry-compatible spans and exports them to
+// an OTLP/HTTP collector using the JSON encoding. It covers what the server
+// needs: nested spans carried through a context, W3C traceparent
+// propagation, attributes, errors, and batched export.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpanKind mirrors the OTLP span kinds.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Attr is a span attribute. Values may be strings, bools, ints, int64s,
+// or float64s; anything else is recorded with fmt.Sprint.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attr          { return Attr{key, value} }
+func Int(key string, value int) Attr         { return Attr{key, int64(value)} }
+func Int64(key string, value int64) Attr     { return Attr{key, value} }
+func Float64(key string, value float64) Attr { return Attr{key, value} }
+func Bool(key string, value bool) Attr       { return Attr{key, value} }
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// SpanContext identifies a span, possibly one in another process.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Span is an in-progress operation. A nil *Span is valid and does nothing,
+// which is what Start returns when tracing is disabled.
+type Span struct {
+	mu       sync.Mutex
+	tracer   *Tracer
+	sc       SpanContext
+	parent   SpanID
+	name     string
+	kind     SpanKind
+	start    time.Time
+	end      time.Time
+	attrs    []Attr
+	errMsg   string
+	failed   bool
+	finished bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// RecordError marks the span as failed. A nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.errMsg = err.Error()
+}
+
+// End finishes the span and queues it for export. Calls after the first
+// are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	s.tracer.enqueue(s)
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func parentFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault installs the tracer used by Start. Until it's called, Start
+// records nothing.
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start begins a span as a child of the span in ctx, or of a remote parent
+// set with ContextWithRemoteParent, and returns a context carrying it.
+// Callers must End the span.
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attr) (context.Context, *Span) {
+	t := defaultTracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	parent := parentFromContext(ctx)
+	s := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+		attrs:  attrs,
+		parent: parent.SpanID,
+	}
+	s.sc.TraceID = parent.TraceID
+	if !parent.Valid() {
+		rand.Read(s.sc.TraceID[:])
+	}
+	rand.Read(s.sc.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// TraceParent formats the current span as a W3C traceparent header value,
+// or returns "" when there is no span.
+func TraceParent(ctx context.Context) string {
+	sc := parentFromContext(ctx)
+	if !sc.Valid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]))
+}
+
+// ContextWithRemoteParent makes spans started from the returned context
+// children of the span described by a traceparent value. Invalid values are
+// ignored.
+func ContextWithRemoteParent(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ctx
+	}
+	var sc SpanContext
+	// hex.Decode writes past the arrays if the IDs are too long, so their
+	// lengths are checked first.
+	if len(parts[1]) != 2*len(sc.TraceID) || len(parts[2]) != 2*len(sc.SpanID) {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	if !sc.Valid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Extract reads the traceparent header of an incoming request.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return ContextWithRemoteParent(ctx, h.Get("traceparent"))
+}
+
+// Inject sets the traceparent header for an outgoing request.
+func Inject(ctx context.Context, h http.Header) {
+	if tp := TraceParent(ctx); tp != "" {
+		h.Set("traceparent", tp)
+	}
+}
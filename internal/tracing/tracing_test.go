@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStartWithoutTracer(t *testing.T) {
+	ctx, span := Start(context.Background(), "noop", KindInternal)
+	if span != nil {
+		t.Fatalf("span = %v, want nil with no tracer installed", span)
+	}
+	// A nil span accepts every call.
+	span.SetName("renamed")
+	span.SetAttributes(String("k", "v"))
+	span.RecordError(errors.New("boom"))
+	span.End()
+	if span.SpanContext().Valid() {
+		t.Error("nil span has a valid span context")
+	}
+	if tp := TraceParent(ctx); tp != "" {
+		t.Errorf("TraceParent = %q, want empty", tp)
+	}
+}
+
+func TestRemoteParent(t *testing.T) {
+	useTracer(t, &Tracer{queue: make(chan *Span, 1)})
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	h := http.Header{}
+	h.Set("traceparent", traceparent)
+	ctx := Extract(context.Background(), h)
+	if got := TraceParent(ctx); got != traceparent {
+		t.Errorf("TraceParent of the remote parent = %q, want %q", got, traceparent)
+	}
+
+	ctx, span := Start(ctx, "child", KindServer)
+	sc := span.SpanContext()
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the remote parent's", sc.TraceID)
+	}
+	if span.parent.String() != "00f067aa0ba902b7" {
+		t.Errorf("parent = %s, want the remote span", span.parent)
+	}
+	if sc.SpanID == span.parent {
+		t.Error("child reused its parent's span ID")
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + sc.SpanID.String() + "-01"
+	if got := out.Get("traceparent"); got != want {
+		t.Errorf("injected traceparent = %q, want %q", got, want)
+	}
+}
+
+func TestContextWithRemoteParentIgnoresInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"garbage",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"0-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736ffff-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7ffff-01",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-" + strings.Repeat("a", 1000) + "-00f067aa0ba902b7-01",
+	}
+	for _, tp := range tests {
+		ctx := ContextWithRemoteParent(context.Background(), tp)
+		if got := TraceParent(ctx); got != "" {
+			t.Errorf("%q was accepted as %q", tp, got)
+		}
+	}
+}
+
+func TestNestedSpans(t *testing.T) {
+	tracer := &Tracer{queue: make(chan *Span, 2)}
+	useTracer(t, tracer)
+
+	ctx, root := Start(context.Background(), "root", KindServer)
+	if SpanFromContext(ctx) != root {
+		t.Fatal("context doesn't carry the root span")
+	}
+	_, child := Start(ctx, "child", KindClient)
+	if child.sc.TraceID != root.sc.TraceID || child.parent != root.sc.SpanID {
+		t.Errorf("child %+v (parent %s) isn't under root %+v", child.sc, child.parent, root.sc)
+	}
+	if root.parent != (SpanID{}) {
+		t.Errorf("root has parent %s", root.parent)
+	}
+
+	child.End()
+	child.End()
+	root.End()
+	if len(tracer.queue) != 2 {
+		t.Errorf("%d spans queued, want each span once", len(tracer.queue))
+	}
+}
+
+func TestEnqueueDropsWhenFull(t *testing.T) {
+	tracer := &Tracer{queue: make(chan *Span, 1)}
+	useTracer(t, tracer)
+	for range 3 {
+		_, span := Start(context.Background(), "span", KindInternal)
+		span.End() // doesn't block with the queue full
+	}
+	if len(tracer.queue) != 1 {
+		t.Errorf("%d spans queued, want 1", len(tracer.queue))
+	}
+}
+
+// useTracer installs tracer as the default for the test.
+func useTracer(t *testing.T, tracer *Tracer) {
+	t.Helper()
+	SetDefault(tracer)
+	t.Cleanup(func() { SetDefault(nil) })
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+	"github.com/google/uuid"
+)
+
+const (
+	jobTypeProcessVideo   = "process_video"
+	jobTypeReprocessVideo = "reprocess_video"
+)
+
+const (
+	// jobLease is how long a worker holds a job without renewing it. The
+	// worker renews it every jobCancelCheckInterval while the job runs, so
+	// a job still running after its lease is assumed to belong to a dead
+	// worker and is picked up again.
+	jobLease = 5 * time.Minute
+	// jobRetryDelay is the wait before the first retry; it doubles with each
+	// further attempt.
+	jobRetryDelay = time.Minute
+	// jobCancelCheckInterval is how often a running job checks whether an
+	// admin cancelled it and renews its lease.
+	jobCancelCheckInterval = 5 * time.Second
+)
+
+type jobHandler func(ctx context.Context, job database.Job) error
+
+func (cfg *apiConfig) jobHandler(jobType string) (jobHandler, bool) {
+	switch jobType {
+	case jobTypeProcessVideo:
+		return cfg.runProcessVideoJob, true
+	case jobTypeReprocessVideo:
+		return cfg.runReprocessVideoJob, true
+	case jobTypeSuggestChapters:
+		return cfg.runSuggestChaptersJob, true
+	case jobTypeDeliverWebhook:
+		return cfg.runDeliverWebhookJob, true
+	}
+	return nil, false
+}
+
+// errShuttingDown is the cause given when a running job is cut short by
+// the server shutting down.
+var errShuttingDown = errors.New("server shutting down")
+
+// errJobCancelled is the cause given when an admin cancels a running job.
+var errJobCancelled = errors.New("job cancelled")
+
+// errJobLeaseLost is the cause given when a worker can't renew a running
+// job's lease, so another worker may have claimed it.
+var errJobLeaseLost = errors.New("job lease lost")
+
+// webhookJobs are the jobs webhook workers run. Media workers run
+// everything else, so deliveries never wait behind a transcode, and a slow
+// receiver never holds up processing.
+var webhookJobs = database.JobTypes{Types: []string{jobTypeDeliverWebhook}}
+
+// webhookWorkers is how many deliveries each instance makes at once.
+const webhookWorkers = 4
+
+// runJobWorker claims and runs queued jobs of types one at a time, polling
+// when there are none. It stops claiming jobs when ctx is cancelled and
+// returns once the current job finishes. Cancelling abort with
+// errShuttingDown interrupts the current job, which is put back in the
+// queue.
+func (cfg *apiConfig) runJobWorker(ctx, abort context.Context, pollInterval time.Duration, types database.JobTypes) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		job, err := cfg.db.ClaimJob(ctx, jobLease, types)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Couldn't claim job", "error", err)
+		}
+		if err == nil && job.ID != uuid.Nil {
+			cfg.runJob(abort, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (cfg *apiConfig) runJob(ctx context.Context, job database.Job) {
+	ctx = tracing.ContextWithRemoteParent(ctx, job.TraceParent)
+	ctx, span := tracing.Start(ctx, "job "+job.Type, tracing.KindInternal,
+		tracing.String("job.id", job.ID.String()),
+		tracing.Int("job.attempt", job.Attempts),
+	)
+	defer span.End()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	go cfg.watchJobCancellation(ctx, cancel, job, jobCancelCheckInterval)
+
+	start := time.Now()
+	var err error
+	if handler, ok := cfg.jobHandler(job.Type); ok {
+		err = handler(ctx, job)
+	} else {
+		err = fmt.Errorf("unknown job type %q", job.Type)
+	}
+	span.RecordError(err)
+	cancel(nil)
+
+	// The job's context may be cancelled by now, but its outcome still
+	// needs recording.
+	cause := context.Cause(ctx)
+	interrupted := errors.Is(cause, errShuttingDown)
+	ctx = context.WithoutCancel(ctx)
+	if err != nil && errors.Is(cause, errJobCancelled) {
+		cfg.metrics.jobDuration.Observe(time.Since(start).Seconds(), job.Type, "cancelled")
+		slog.WarnContext(ctx, "Job cancelled", "job_id", job.ID, "type", job.Type)
+		return
+	}
+	// Whoever holds the job now records how it went.
+	if err != nil && errors.Is(cause, errJobLeaseLost) {
+		cfg.metrics.jobDuration.Observe(time.Since(start).Seconds(), job.Type, "lease_lost")
+		slog.WarnContext(ctx, "Job stopped, lease lost", "job_id", job.ID, "type", job.Type)
+		return
+	}
+	if err != nil && interrupted {
+		if err := cfg.db.ReleaseJob(ctx, job.ID, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "Couldn't release interrupted job", "job_id", job.ID, "error", err)
+			return
+		}
+		slog.WarnContext(ctx, "Job interrupted by shutdown, requeued", "job_id", job.ID, "type", job.Type)
+		return
+	}
+	// An outage shouldn't use up the attempts of every job that runs into
+	// it, so the job waits out the breaker's cooldown instead.
+	var openErr *circuitOpenError
+	if errors.As(err, &openErr) {
+		cfg.metrics.jobDuration.Observe(time.Since(start).Seconds(), job.Type, "deferred")
+		if err := cfg.db.ReleaseJob(ctx, job.ID, time.Now().Add(openErr.retryAfter)); err != nil {
+			slog.ErrorContext(ctx, "Couldn't release deferred job", "job_id", job.ID, "error", err)
+			return
+		}
+		slog.WarnContext(ctx, "Job deferred, dependency unavailable", "job_id", job.ID, "type", job.Type, "error", err)
+		return
+	}
+
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	cfg.metrics.jobDuration.Observe(time.Since(start).Seconds(), job.Type, outcome)
+
+	if err == nil {
+		if err := cfg.db.CompleteJob(ctx, job.ID); err != nil {
+			slog.ErrorContext(ctx, "Couldn't complete job", "job_id", job.ID, "error", err)
+		}
+		return
+	}
+
+	retryAt := time.Now().UTC().Add(jobRetryDelay << (job.Attempts - 1))
+	retrying, ferr := cfg.db.FailJob(ctx, job.ID, err.Error(), newJobDiagnostics(job, err), retryAt)
+	if ferr != nil {
+		slog.ErrorContext(ctx, "Couldn't record job failure", "job_id", job.ID, "error", ferr)
+		return
+	}
+	cfg.metrics.jobFailures.Inc(job.Type, strconv.FormatBool(!retrying))
+	if retrying {
+		slog.WarnContext(ctx, "Job failed, retrying", "job_id", job.ID, "type", job.Type, "attempt", job.Attempts, "error", err)
+	} else {
+		slog.ErrorContext(ctx, "Job dead-lettered", "job_id", job.ID, "type", job.Type, "attempts", job.Attempts, "error", err)
+	}
+}
+
+// jobInputError annotates a job's error with details of the input it was
+// working on, for the job's diagnostics.
+type jobInputError struct {
+	err   error
+	input map[string]any
+}
+
+func (e *jobInputError) Error() string {
+	return e.err.Error()
+}
+
+func (e *jobInputError) Unwrap() error {
+	return e.err
+}
+
+// newJobDiagnostics describes a failed run as JSON, including the input
+// and the stderr of a failed ffmpeg or ffprobe command when err carries
+// them.
+func newJobDiagnostics(job database.Job, err error) string {
+	diagnostics := struct {
+		Error    string         `json:"error"`
+		Attempt  int            `json:"attempt"`
+		FailedAt time.Time      `json:"failed_at"`
+		Input    map[string]any `json:"input,omitempty"`
+		Command  []string       `json:"command,omitempty"`
+		Stderr   string         `json:"stderr,omitempty"`
+	}{
+		Error:    err.Error(),
+		Attempt:  job.Attempts,
+		FailedAt: time.Now().UTC(),
+	}
+	var inputErr *jobInputError
+	if errors.As(err, &inputErr) {
+		diagnostics.Input = inputErr.input
+	}
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		diagnostics.Command = cmdErr.Args
+		diagnostics.Stderr = cmdErr.Stderr
+	}
+	dat, err := json.Marshal(diagnostics)
+	if err != nil {
+		return ""
+	}
+	return string(dat)
+}
+
+// watchJobCancellation polls a running job's status and cancels its context
+// with errJobCancelled once an admin has cancelled it, which also kills any
+// ffmpeg process it started. Each poll also renews the job's lease. If the
+// lease can't be renewed before it runs out, the context is cancelled with
+// errJobLeaseLost so the job doesn't run alongside another worker's claim.
+// It returns when ctx is done.
+func (cfg *apiConfig) watchJobCancellation(ctx context.Context, cancel context.CancelCauseFunc, job database.Job, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	leaseUntil := time.Now().Add(jobLease)
+	if job.LockedUntil != nil {
+		leaseUntil = *job.LockedUntil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := cfg.db.GetJob(ctx, job.ID)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.ErrorContext(ctx, "Couldn't check job status", "job_id", job.ID, "error", err)
+			}
+		} else if current.Status == database.JobStatusCancelled {
+			cancel(errJobCancelled)
+			return
+		}
+
+		renewedAt := time.Now()
+		renewed, err := cfg.db.ExtendJobLease(ctx, job.ID, job.Attempts, jobLease)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				slog.ErrorContext(ctx, "Couldn't renew job lease", "job_id", job.ID, "error", err)
+			}
+		case !renewed:
+			cancel(errJobLeaseLost)
+			return
+		default:
+			leaseUntil = renewedAt.Add(jobLease)
+		}
+		// Give up a poll early, so the job has stopped by the time another
+		// worker could claim it.
+		if time.Now().Add(interval).After(leaseUntil) {
+			cancel(errJobLeaseLost)
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// watchTestJob runs watchJobCancellation over job until it cancels the
+// job's context or timeout passes, and returns the cause.
+func watchTestJob(t *testing.T, cfg *apiConfig, job database.Job, timeout time.Duration) error {
+	t.Helper()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	done := make(chan struct{})
+	go func() {
+		cfg.watchJobCancellation(ctx, cancel, job, time.Millisecond)
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+	case <-time.After(timeout):
+		cancel(nil)
+	}
+	<-done
+	return context.Cause(ctx)
+}
+
+func TestWatchJobCancellationRenewsLease(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	job := database.Job{ID: uuid.New(), Status: database.JobStatusRunning, Attempts: 2}
+	store.GetJobFunc = func(ctx context.Context, id uuid.UUID) (database.Job, error) {
+		return job, nil
+	}
+	var renewals atomic.Int32
+	store.ExtendJobLeaseFunc = func(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) (bool, error) {
+		if id != job.ID || attempt != job.Attempts || lease != jobLease {
+			t.Errorf("ExtendJobLease(%s, %d, %s), want (%s, %d, %s)", id, attempt, lease, job.ID, job.Attempts, jobLease)
+		}
+		renewals.Add(1)
+		return true, nil
+	}
+
+	if cause := watchTestJob(t, cfg, job, 50*time.Millisecond); !errors.Is(cause, context.Canceled) {
+		t.Errorf("cause = %v, want the job left running", cause)
+	}
+	if renewals.Load() == 0 {
+		t.Error("lease was never renewed")
+	}
+}
+
+func TestWatchJobCancellationStopsCancelledJob(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	job := database.Job{ID: uuid.New(), Status: database.JobStatusRunning, Attempts: 1}
+	store.GetJobFunc = func(ctx context.Context, id uuid.UUID) (database.Job, error) {
+		return database.Job{ID: id, Status: database.JobStatusCancelled}, nil
+	}
+
+	if cause := watchTestJob(t, cfg, job, time.Second); !errors.Is(cause, errJobCancelled) {
+		t.Errorf("cause = %v, want %v", cause, errJobCancelled)
+	}
+}
+
+func TestWatchJobCancellationStopsReclaimedJob(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	job := database.Job{ID: uuid.New(), Status: database.JobStatusRunning, Attempts: 1}
+	store.GetJobFunc = func(ctx context.Context, id uuid.UUID) (database.Job, error) {
+		return database.Job{ID: id, Status: database.JobStatusRunning, Attempts: 2}, nil
+	}
+	store.ExtendJobLeaseFunc = func(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) (bool, error) {
+		return false, nil
+	}
+
+	if cause := watchTestJob(t, cfg, job, time.Second); !errors.Is(cause, errJobLeaseLost) {
+		t.Errorf("cause = %v, want %v", cause, errJobLeaseLost)
+	}
+}
+
+func TestWatchJobCancellationStopsAtLeaseDeadline(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	lockedUntil := time.Now().Add(20 * time.Millisecond)
+	job := database.Job{ID: uuid.New(), Status: database.JobStatusRunning, Attempts: 1, LockedUntil: &lockedUntil}
+	store.GetJobFunc = func(ctx context.Context, id uuid.UUID) (database.Job, error) {
+		return database.Job{}, errors.New("database unavailable")
+	}
+	store.ExtendJobLeaseFunc = func(ctx context.Context, id uuid.UUID, attempt int, lease time.Duration) (bool, error) {
+		return false, errors.New("database unavailable")
+	}
+
+	cause := watchTestJob(t, cfg, job, time.Second)
+	if !errors.Is(cause, errJobLeaseLost) {
+		t.Fatalf("cause = %v, want %v", cause, errJobLeaseLost)
+	}
+	if time.Now().Before(lockedUntil.Add(-10 * time.Millisecond)) {
+		t.Error("job stopped long before its lease ran out")
+	}
+}
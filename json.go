@@ -2,22 +2,114 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
 )
 
+// errorCode identifies the kind of failure in an error response, so clients
+// can branch on it rather than on the message. Codes are part of the API:
+// add new ones, but never rename one.
+type errorCode string
+
+// Codes that follow from the status alone.
+const (
+	errCodeBadRequest         errorCode = "BAD_REQUEST"
+	errCodeUnauthorized       errorCode = "UNAUTHORIZED"
+	errCodeForbidden          errorCode = "FORBIDDEN"
+	errCodeNotFound           errorCode = "NOT_FOUND"
+	errCodeConflict           errorCode = "CONFLICT"
+	errCodeGone               errorCode = "GONE"
+	errCodePreconditionFailed errorCode = "PRECONDITION_FAILED"
+	errCodeTooLarge           errorCode = "PAYLOAD_TOO_LARGE"
+	errCodeRateLimited        errorCode = "RATE_LIMITED"
+	errCodeInternal           errorCode = "INTERNAL_ERROR"
+	errCodeNotImplemented     errorCode = "NOT_IMPLEMENTED"
+	errCodeUnavailable        errorCode = "SERVICE_UNAVAILABLE"
+)
+
+// Codes for specific failures.
+const (
+	errCodeVideoTooLarge        errorCode = "VIDEO_TOO_LARGE"
+	errCodeThumbnailTooLarge    errorCode = "THUMBNAIL_TOO_LARGE"
+	errCodeUnsupportedMediaType errorCode = "UNSUPPORTED_MEDIA_TYPE"
+	errCodeVideoNotReady        errorCode = "VIDEO_NOT_READY"
+	errCodeProcessingFailed     errorCode = "PROCESSING_FAILED"
+	errCodeQuotaExceeded        errorCode = "QUOTA_EXCEEDED"
+	errCodeDailyLimitReached    errorCode = "DAILY_LIMIT_REACHED"
+	errCodeUploadsBusy          errorCode = "UPLOADS_BUSY"
+	errCodeAccountBanned        errorCode = "ACCOUNT_BANNED"
+	errCodeAccountSuspended     errorCode = "ACCOUNT_SUSPENDED"
+	errCodePasswordResetNeeded  errorCode = "PASSWORD_RESET_REQUIRED"
+	errCodeInfectedFile         errorCode = "INFECTED_FILE"
+	errCodeGeoRestricted        errorCode = "GEO_RESTRICTED"
+	errCodeUnderRetention       errorCode = "UNDER_RETENTION"
+	errCodeDomainNotVerified    errorCode = "DOMAIN_NOT_VERIFIED"
+)
+
+var statusErrorCodes = map[int]errorCode{
+	http.StatusBadRequest:            errCodeBadRequest,
+	http.StatusUnauthorized:          errCodeUnauthorized,
+	http.StatusForbidden:             errCodeForbidden,
+	http.StatusNotFound:              errCodeNotFound,
+	http.StatusConflict:              errCodeConflict,
+	http.StatusGone:                  errCodeGone,
+	http.StatusPreconditionFailed:    errCodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: errCodeTooLarge,
+	http.StatusTooManyRequests:       errCodeRateLimited,
+	http.StatusNotImplemented:        errCodeNotImplemented,
+	http.StatusServiceUnavailable:    errCodeUnavailable,
+}
+
+// statusErrorCode is the code for a failure with nothing more specific.
+func statusErrorCode(status int) errorCode {
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	if status < 500 {
+		return errCodeBadRequest
+	}
+	return errCodeInternal
+}
+
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Println(err)
+	respondWithErrorCode(w, code, statusErrorCode(code), msg, err, nil)
+}
+
+// respondWithErrorCode is respondWithError with a specific error code, and
+// details that help a client act on it, such as the limit that was hit.
+func respondWithErrorCode(w http.ResponseWriter, status int, code errorCode, msg string, err error, details map[string]any) {
+	// A dependency behind an open circuit breaker will be back shortly, so
+	// say so rather than reporting an internal error.
+	var openErr *circuitOpenError
+	if status > 499 && errors.As(err, &openErr) {
+		status = http.StatusServiceUnavailable
+		code = errCodeUnavailable
+		msg = strings.ToUpper(openErr.service[:1]) + openErr.service[1:] + " temporarily unavailable, try again shortly"
+		details = map[string]any{"service": openErr.service}
+		w.Header().Set("Retry-After", retryAfterSeconds(openErr.retryAfter))
 	}
-	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+
+	// The request ID is set on the response by requestIDMiddleware; echoing
+	// it in the body lets users quote it when reporting a failure.
+	requestID := w.Header().Get(requestIDHeader)
+	if status > 499 {
+		slog.Error("Responding with 5XX error", "status", status, "code", code, "message", msg, "error", err, "request_id", requestID)
+	} else if err != nil {
+		slog.Debug("Responding with error", "status", status, "code", code, "message", msg, "error", err, "request_id", requestID)
 	}
 	type errorResponse struct {
-		Error string `json:"error"`
+		Error     string         `json:"error"`
+		Code      errorCode      `json:"code"`
+		Details   map[string]any `json:"details,omitempty"`
+		RequestID string         `json:"request_id,omitempty"`
 	}
-	respondWithJSON(w, code, errorResponse{
-		Error: msg,
+	respondWithJSON(w, status, errorResponse{
+		Error:     msg,
+		Code:      code,
+		Details:   details,
+		RequestID: requestID,
 	})
 }
 
@@ -25,7 +117,7 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("Error marshalling JSON", "error", err, "request_id", w.Header().Get(requestIDHeader))
 		w.WriteHeader(500)
 		return
 	}
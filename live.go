@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/rtmp"
+	"github.com/google/uuid"
+)
+
+const (
+	// liveApp is the RTMP application streams are published to.
+	liveApp = "live"
+	// liveSegmentSeconds and liveWindowSegments keep latency low: players
+	// start a few short segments behind the encoder.
+	liveSegmentSeconds = 2
+	liveWindowSegments = 6
+	// livePollInterval is how often new segments are uploaded.
+	livePollInterval = 500 * time.Millisecond
+	// livePlaylistCacheControl keeps the CDN from serving a stale playlist
+	// for longer than a segment.
+	livePlaylistCacheControl = "max-age=1"
+	// videoLiveMessage refuses uploads and downloads of a video that's
+	// being streamed live: it has no file until the stream's recording is
+	// processed.
+	videoLiveMessage = "Video is being streamed live"
+)
+
+var (
+	errStreamKeyInvalid = errors.New("invalid stream key")
+	errAlreadyLive      = errors.New("already streaming with this key")
+	// errStreamingNotAllowed refuses streams from banned or suspended users.
+	errStreamingNotAllowed = errors.New("account can't stream")
+)
+
+// rejectLive writes a 409 and returns true when the video is being streamed
+// live.
+func rejectLive(w http.ResponseWriter, video database.Video) bool {
+	if video.Status != database.VideoStatusLive {
+		return false
+	}
+	respondWithError(w, http.StatusConflict, videoLiveMessage, nil)
+	return true
+}
+
+// liveConfig is the RTMP ingest listener. Live streaming is off when
+// address is empty.
+type liveConfig struct {
+	address string
+	// ingestURL is the URL encoders are told to publish to.
+	ingestURL string
+	// whipGatewayURL is the WebRTC gateway browsers' WHIP offers are
+	// passed to. WHIP ingest is off when it's empty.
+	whipGatewayURL string
+}
+
+// liveIngests tracks the users streaming to this instance, so each only
+// streams once at a time.
+type liveIngests struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]bool
+}
+
+func (l *liveIngests) claim(userID uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.users == nil {
+		l.users = map[uuid.UUID]bool{}
+	}
+	if l.users[userID] {
+		return false
+	}
+	l.users[userID] = true
+	return true
+}
+
+func (l *liveIngests) release(userID uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.users, userID)
+}
+
+func hashStreamKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// runLiveIngest accepts RTMP streams on ln until ctx is cancelled.
+func (cfg *apiConfig) runLiveIngest(ctx context.Context, ln net.Listener) {
+	srv := &rtmp.Server{Publish: cfg.publishLiveStream}
+	if err := srv.Serve(ctx, ln); err != nil {
+		slog.ErrorContext(ctx, "RTMP ingest stopped", "error", err)
+	}
+}
+
+// publishLiveStream starts a stream published with a user's stream key. It
+// creates a live video for the stream and has ffmpeg repackage it as HLS,
+// which is uploaded as it's written.
+func (cfg *apiConfig) publishLiveStream(ctx context.Context, app, key string) (io.WriteCloser, error) {
+	if app != liveApp {
+		return nil, fmt.Errorf("unknown application %q", app)
+	}
+	streamKey, err := cfg.streamKeyUser(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.liveIngests.claim(streamKey.UserID) {
+		return nil, errAlreadyLive
+	}
+
+	ingest, err := cfg.startLiveIngest(ctx, streamKey)
+	if err != nil {
+		cfg.liveIngests.release(streamKey.UserID)
+		slog.ErrorContext(ctx, "Couldn't start live stream", "user_id", streamKey.UserID, "error", err)
+		return nil, errors.New("couldn't start stream")
+	}
+	slog.InfoContext(ctx, "Live stream started", "stream_id", ingest.stream.ID, "video_id", ingest.stream.VideoID)
+	return ingest, nil
+}
+
+// streamKeyUser returns a stream key, if its user may stream.
+func (cfg *apiConfig) streamKeyUser(ctx context.Context, key string) (*database.StreamKey, error) {
+	streamKey, err := cfg.db.GetStreamKeyByHash(ctx, hashStreamKey(key))
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't check stream key", "error", err)
+		return nil, errors.New("couldn't check stream key")
+	}
+	if streamKey == nil {
+		return nil, errStreamKeyInvalid
+	}
+	banned, err := cfg.db.IsUserBanned(ctx, streamKey.UserID)
+	if err != nil {
+		return nil, errors.New("couldn't check account")
+	}
+	suspended, err := cfg.db.IsUserSuspended(ctx, streamKey.UserID)
+	if err != nil {
+		return nil, errors.New("couldn't check account")
+	}
+	if banned || suspended {
+		return nil, errStreamingNotAllowed
+	}
+	return streamKey, nil
+}
+
+func (cfg *apiConfig) startLiveIngest(ctx context.Context, streamKey *database.StreamKey) (*liveIngest, error) {
+	userID := streamKey.UserID
+	// A stream still recorded as live can't be publishing: this instance
+	// isn't ingesting it, so the one that was has gone away.
+	stale, err := cfg.db.GetLiveStreams(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stale {
+		cfg.endLiveStream(ctx, s, database.VideoStatusDraft)
+	}
+
+	video, err := cfg.db.CreateVideo(ctx, database.CreateVideoParams{
+		Title:  "Live stream " + time.Now().UTC().Format("2006-01-02 15:04"),
+		UserID: userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create video: %w", err)
+	}
+	randBuf := make([]byte, 32)
+	if _, err := rand.Read(randBuf); err != nil {
+		return nil, err
+	}
+	prefix := "live/" + base64.RawURLEncoding.EncodeToString(randBuf) + "/"
+
+	dir, err := os.MkdirTemp(cfg.uploadsRoot, "live-")
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-f", "flv", "-i", "pipe:0", "-c", "copy"}
+	// Low-latency streams play from the API, which can hold playlist
+	// requests until the part a player wants is ready.
+	videoURL := fmt.Sprintf("%s/%s%s", cfg.s3CfDistribution, prefix, hlsPlaylistName)
+	if streamKey.LowLatency {
+		args = append(args, llhlsArgs(dir)...)
+		videoURL = fmt.Sprintf("%s%s/videos/%s/live.m3u8", cfg.baseURL, apiVersionPrefix, video.ID)
+	} else {
+		args = append(args,
+			"-f", "hls",
+			"-hls_time", fmt.Sprint(liveSegmentSeconds),
+			"-hls_list_size", fmt.Sprint(liveWindowSegments),
+			"-hls_flags", "delete_segments+temp_file+independent_segments",
+			"-hls_segment_filename", filepath.Join(dir, "segment%05d.ts"),
+			filepath.Join(dir, hlsPlaylistName),
+		)
+	}
+	cmd := exec.Command(cfg.ffmpegPath, args...)
+	stderr := &tailBuffer{limit: commandStderrLimit}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// The stream is also recorded as it came in, to be processed into the
+	// video once it ends. Like an upload, it's spooled as upload-*, so the
+	// reconciler removes it if its job never runs.
+	recording, err := os.CreateTemp(cfg.uploadsRoot, "upload-live-*.flv")
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		recording.Close()
+		os.Remove(recording.Name())
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	stream, err := cfg.db.StartLiveStream(ctx, database.StartLiveStreamParams{
+		UserID:     userID,
+		VideoID:    video.ID,
+		S3Key:      prefix + hlsPlaylistName,
+		VideoURL:   videoURL,
+		LowLatency: streamKey.LowLatency,
+	})
+	if err != nil {
+		stdin.Close()
+		cmd.Wait()
+		recording.Close()
+		os.Remove(recording.Name())
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("couldn't record stream: %w", err)
+	}
+
+	uploadCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	ingest := &liveIngest{
+		cfg:       cfg,
+		stream:    stream,
+		prefix:    prefix,
+		dir:       dir,
+		cmd:       cmd,
+		stdin:     stdin,
+		stderr:    stderr,
+		recording: recording,
+		uploaded:  map[string]bool{},
+		stop:      stop,
+		done:      make(chan struct{}),
+	}
+	if streamKey.LowLatency {
+		ingest.llhls = newLLHLSPackager(cfg, prefix, dir)
+	}
+	go ingest.run(uploadCtx)
+	return ingest, nil
+}
+
+// endLiveStream marks a stream ended and deletes what was uploaded of it.
+// The video becomes a draft unless its recording is being processed.
+func (cfg *apiConfig) endLiveStream(ctx context.Context, stream database.LiveStream, status database.VideoStatus) {
+	if err := cfg.db.EndLiveStream(ctx, stream.ID, status); err != nil {
+		slog.ErrorContext(ctx, "Couldn't end live stream", "stream_id", stream.ID, "error", err)
+		return
+	}
+	if err := cfg.deleteVideoObject(ctx, stream.S3Key); err != nil {
+		slog.ErrorContext(ctx, "Couldn't delete live stream", "stream_id", stream.ID, "error", err)
+	}
+}
+
+// liveIngest is a stream being published: the publisher's FLV is written to
+// ffmpeg, and the segments and playlist it writes are uploaded as they're
+// finished.
+type liveIngest struct {
+	cfg    *apiConfig
+	stream database.LiveStream
+	prefix string
+	dir    string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tailBuffer
+
+	// recording is where the stream is recorded, until a write to it fails.
+	recording    *os.File
+	recordingErr error
+
+	// llhls packages low-latency streams. Other streams are uploaded as
+	// ffmpeg writes them.
+	llhls *llhlsPackager
+	// uploaded holds the segments in the last playlist that have been
+	// uploaded, and playlist that playlist.
+	uploaded map[string]bool
+	playlist []byte
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+func (l *liveIngest) Write(p []byte) (int, error) {
+	if l.recordingErr == nil {
+		if _, err := l.recording.Write(p); err != nil {
+			// Losing the recording shouldn't cut the stream off.
+			l.recordingErr = err
+			slog.Error("Couldn't record live stream", "stream_id", l.stream.ID, "error", err)
+		}
+	}
+	return l.stdin.Write(p)
+}
+
+// Close ends the stream once ffmpeg has finished writing it.
+func (l *liveIngest) Close() error {
+	l.stdin.Close()
+	waitErr := l.cmd.Wait()
+	l.stop()
+	<-l.done
+
+	ctx := context.Background()
+	if err := l.sync(ctx, true); err != nil {
+		slog.ErrorContext(ctx, "Couldn't upload end of live stream", "stream_id", l.stream.ID, "error", err)
+	}
+	// The stream is ended before its recording is queued, so the job can't
+	// finish before the live video is taken down.
+	recording := l.finishRecording()
+	status := database.VideoStatusDraft
+	if recording != "" {
+		status = database.VideoStatusProcessing
+	}
+	l.cfg.endLiveStream(ctx, l.stream, status)
+	if recording != "" {
+		l.queueRecording(ctx, recording)
+	}
+	l.cfg.liveIngests.release(l.stream.UserID)
+	os.RemoveAll(l.dir)
+	slog.InfoContext(ctx, "Live stream ended", "stream_id", l.stream.ID, "video_id", l.stream.VideoID)
+
+	if waitErr != nil {
+		return &commandError{Args: l.cmd.Args, Stderr: string(l.stderr.buf), Err: waitErr}
+	}
+	return nil
+}
+
+// finishRecording closes the recording and returns its path, or "" if
+// there's nothing to process.
+func (l *liveIngest) finishRecording() string {
+	path := l.recording.Name()
+	closeErr := l.recording.Close()
+	info, statErr := os.Stat(path)
+	if l.recordingErr != nil || closeErr != nil || statErr != nil || info.Size() <= rtmp.FLVHeaderSize {
+		os.Remove(path)
+		return ""
+	}
+	return path
+}
+
+// queueRecording queues a stream's recording to be processed like an
+// upload, which makes it the video's file and announces it.
+func (l *liveIngest) queueRecording(ctx context.Context, path string) {
+	videoID := l.stream.VideoID
+	_, err := l.cfg.db.CreateJob(ctx, database.CreateJobParams{
+		Type:        jobTypeProcessVideo,
+		VideoID:     &videoID,
+		Payload:     processVideoPayload{SourcePath: path},
+		MaxAttempts: l.cfg.jobMaxAttempts,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't queue live recording", "stream_id", l.stream.ID, "error", err)
+		os.Remove(path)
+		l.cfg.restoreVideoStatus(ctx, videoID, processVideoPayload{})
+	}
+}
+
+// run uploads new segments until the stream ends.
+func (l *liveIngest) run(ctx context.Context) {
+	defer close(l.done)
+	ticker := time.NewTicker(livePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := l.sync(ctx, false); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Couldn't upload live segments", "stream_id", l.stream.ID, "error", err)
+		}
+	}
+}
+
+// sync uploads the segments in ffmpeg's playlist that haven't been, then
+// the playlist itself. ffmpeg renames files into place once they're
+// written, so everything the playlist lists is complete. final is set once
+// ffmpeg has exited.
+func (l *liveIngest) sync(ctx context.Context, final bool) error {
+	if l.llhls != nil {
+		return l.llhls.sync(ctx, final)
+	}
+	playlist, err := os.ReadFile(filepath.Join(l.dir, hlsPlaylistName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(playlist, l.playlist) {
+		return nil
+	}
+
+	uploaded := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := filepath.Base(line)
+		if !l.uploaded[name] {
+			if _, err := l.cfg.uploadHLSFile(ctx, filepath.Join(l.dir, name), l.prefix+name); err != nil {
+				return err
+			}
+		}
+		uploaded[name] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	l.uploaded = uploaded
+
+	key := l.prefix + hlsPlaylistName
+	contentType := hlsContentTypes[".m3u8"]
+	cacheControl := livePlaylistCacheControl
+	_, err = l.cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       &l.cfg.s3Bucket,
+		Key:          &key,
+		Body:         bytes.NewReader(playlist),
+		ContentType:  &contentType,
+		CacheControl: &cacheControl,
+	})
+	if err != nil {
+		return err
+	}
+	l.playlist = playlist
+	return nil
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+const (
+	// llhlsPartSeconds is the target length of an LL-HLS part. Streams are
+	// copied, so parts are cut at keyframes: encoders should send one every
+	// second.
+	llhlsPartSeconds     = 1
+	llhlsPartsPerSegment = liveSegmentSeconds / llhlsPartSeconds
+	// llhlsPartSegments is how many of the last segments list their parts.
+	llhlsPartSegments = 3
+	llhlsInitName     = "init.mp4"
+	// llhlsPoll is how often a blocked playlist request checks for the part
+	// it's waiting for, and how long playlists are cached between checks.
+	llhlsPoll = 100 * time.Millisecond
+)
+
+// llhlsArgs are the ffmpeg output options for a low-latency stream: every
+// fMP4 file ffmpeg writes becomes a part, and llhlsPackager groups them
+// into segments.
+func llhlsArgs(dir string) []string {
+	return []string{
+		"-f", "hls",
+		"-hls_time", fmt.Sprint(llhlsPartSeconds),
+		"-hls_list_size", fmt.Sprint(liveWindowSegments * llhlsPartsPerSegment),
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", llhlsInitName,
+		"-hls_flags", "delete_segments+temp_file+independent_segments",
+		"-hls_segment_filename", filepath.Join(dir, "part%05d.m4s"),
+		filepath.Join(dir, hlsPlaylistName),
+	}
+}
+
+type llhlsPart struct {
+	name     string
+	duration float64
+}
+
+type llhlsSegment struct {
+	msn      int
+	name     string
+	duration float64
+	parts    []llhlsPart
+}
+
+// llhlsPackager turns the parts ffmpeg writes into an LL-HLS playlist. Parts
+// are uploaded as they're finished, and every llhlsPartsPerSegment of them
+// are also uploaded together as a segment.
+type llhlsPackager struct {
+	cfg    *apiConfig
+	prefix string
+	dir    string
+
+	initUploaded bool
+	// lastSeq is the media sequence number of the last part uploaded.
+	lastSeq int
+	// segments are the complete segments in the playlist window, and
+	// current the one being filled, with its parts' data.
+	segments    []llhlsSegment
+	current     llhlsSegment
+	currentData []byte
+	playlist    []byte
+}
+
+func newLLHLSPackager(cfg *apiConfig, prefix, dir string) *llhlsPackager {
+	return &llhlsPackager{cfg: cfg, prefix: prefix, dir: dir, lastSeq: -1}
+}
+
+// sync uploads the parts ffmpeg has finished since the last call and the
+// playlist listing them. final ends the playlist, with whatever parts are
+// left as a shorter last segment.
+func (p *llhlsPackager) sync(ctx context.Context, final bool) error {
+	local, err := os.ReadFile(filepath.Join(p.dir, hlsPlaylistName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	mediaSeq, parts, err := parseLocalPlaylist(local)
+	if err != nil {
+		return err
+	}
+
+	if !p.initUploaded {
+		if _, err := p.cfg.uploadHLSFile(ctx, filepath.Join(p.dir, llhlsInitName), p.prefix+llhlsInitName); err != nil {
+			return err
+		}
+		p.initUploaded = true
+	}
+	for i, part := range parts {
+		seq := mediaSeq + i
+		if seq <= p.lastSeq {
+			continue
+		}
+		if err := p.addPart(ctx, seq, part); err != nil {
+			return err
+		}
+	}
+	if final && len(p.current.parts) > 0 {
+		if err := p.finishSegment(ctx); err != nil {
+			return err
+		}
+	}
+
+	playlist := p.render(final)
+	if bytes.Equal(playlist, p.playlist) {
+		return nil
+	}
+	key := p.prefix + hlsPlaylistName
+	contentType := hlsContentTypes[".m3u8"]
+	cacheControl := livePlaylistCacheControl
+	_, err = p.cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       &p.cfg.s3Bucket,
+		Key:          &key,
+		Body:         bytes.NewReader(playlist),
+		ContentType:  &contentType,
+		CacheControl: &cacheControl,
+	})
+	if err != nil {
+		return err
+	}
+	p.playlist = playlist
+	return nil
+}
+
+func (p *llhlsPackager) addPart(ctx context.Context, seq int, part llhlsPart) error {
+	data, err := os.ReadFile(filepath.Join(p.dir, part.name))
+	if err != nil {
+		return err
+	}
+	contentType := "video/mp4"
+	key := p.prefix + part.name
+	_, err = p.cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &p.cfg.s3Bucket,
+		Key:         &key,
+		Body:        bytes.NewReader(data),
+		ContentType: &contentType,
+	})
+	if err != nil {
+		return err
+	}
+	p.lastSeq = seq
+
+	if len(p.current.parts) == 0 {
+		p.current.msn = seq / llhlsPartsPerSegment
+	}
+	p.current.parts = append(p.current.parts, part)
+	p.current.duration += part.duration
+	p.currentData = append(p.currentData, data...)
+	if len(p.current.parts) == llhlsPartsPerSegment {
+		return p.finishSegment(ctx)
+	}
+	return nil
+}
+
+// finishSegment uploads the current segment: its parts' fragments,
+// concatenated.
+func (p *llhlsPackager) finishSegment(ctx context.Context) error {
+	p.current.name = fmt.Sprintf("segment%05d.m4s", p.current.msn)
+	contentType := "video/mp4"
+	key := p.prefix + p.current.name
+	_, err := p.cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &p.cfg.s3Bucket,
+		Key:         &key,
+		Body:        bytes.NewReader(p.currentData),
+		ContentType: &contentType,
+	})
+	if err != nil {
+		return err
+	}
+	p.segments = append(p.segments, p.current)
+	if len(p.segments) > liveWindowSegments {
+		p.segments = p.segments[len(p.segments)-liveWindowSegments:]
+	}
+	p.current = llhlsSegment{}
+	p.currentData = nil
+	return nil
+}
+
+// render writes the playlist. URIs are absolute, since players may load it
+// from the API rather than the CDN.
+func (p *llhlsPackager) render(final bool) []byte {
+	base := fmt.Sprintf("%s/%s", p.cfg.s3CfDistribution, p.prefix)
+	targetDuration := float64(liveSegmentSeconds)
+	for _, seg := range p.segments {
+		targetDuration = math.Max(targetDuration, seg.duration)
+	}
+	mediaSeq := p.current.msn
+	if len(p.segments) > 0 {
+		mediaSeq = p.segments[0].msn
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:9\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(targetDuration)))
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3.0*llhlsPartSeconds)
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", float64(llhlsPartSeconds))
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", mediaSeq)
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s%s\"\n", base, llhlsInitName)
+	writeParts := func(parts []llhlsPart) {
+		for _, part := range parts {
+			fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"%s%s\",INDEPENDENT=YES\n", part.duration, base, part.name)
+		}
+	}
+	for i, seg := range p.segments {
+		if i >= len(p.segments)-llhlsPartSegments {
+			writeParts(seg.parts)
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s%s\n", seg.duration, base, seg.name)
+	}
+	writeParts(p.current.parts)
+	if final {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return b.Bytes()
+}
+
+// parseLocalPlaylist reads the media sequence number and files of a
+// playlist ffmpeg wrote.
+func parseLocalPlaylist(data []byte) (int, []llhlsPart, error) {
+	mediaSeq := 0
+	var parts []llhlsPart
+	var duration float64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			n, err := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"))
+			if err != nil {
+				return 0, nil, fmt.Errorf("invalid media sequence: %w", err)
+			}
+			mediaSeq = n
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			d, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return 0, nil, fmt.Errorf("invalid duration: %w", err)
+			}
+			duration = d
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			parts = append(parts, llhlsPart{name: filepath.Base(line), duration: duration})
+		}
+	}
+	return mediaSeq, parts, scanner.Err()
+}
+
+// llhlsPosition is how far a playlist goes: the next segment to complete,
+// how many of its parts are listed, and whether the stream has ended.
+type llhlsPosition struct {
+	nextMSN int
+	parts   int
+	ended   bool
+}
+
+func parseLLHLSPosition(playlist []byte) llhlsPosition {
+	var pos llhlsPosition
+	mediaSeq, segments := 0, 0
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			mediaSeq, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			segments++
+			pos.parts = 0
+		case strings.HasPrefix(line, "#EXT-X-PART:"):
+			pos.parts++
+		case line == "#EXT-X-ENDLIST":
+			pos.ended = true
+		}
+	}
+	pos.nextMSN = mediaSeq + segments
+	return pos
+}
+
+// has reports whether the playlist includes segment msn, or its part part
+// when part isn't negative.
+func (pos llhlsPosition) has(msn, part int) bool {
+	if pos.ended || msn < pos.nextMSN {
+		return true
+	}
+	return msn == pos.nextMSN && part >= 0 && part < pos.parts
+}
+
+// livePlaylistCache holds live playlists read from the bucket briefly, so
+// blocked requests for the same stream share reads.
+type livePlaylistCache struct {
+	mu      sync.Mutex
+	entries map[string]*livePlaylistEntry
+}
+
+type livePlaylistEntry struct {
+	mu        sync.Mutex
+	data      []byte
+	fetchedAt time.Time
+}
+
+func (c *livePlaylistCache) get(ctx context.Context, cfg *apiConfig, key string) ([]byte, error) {
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[string]*livePlaylistEntry{}
+	}
+	entry, ok := c.entries[key]
+	if !ok {
+		// Drop the playlists of streams nobody has asked for in a while.
+		for k, e := range c.entries {
+			if e.mu.TryLock() {
+				stale := time.Since(e.fetchedAt) > time.Minute
+				e.mu.Unlock()
+				if stale {
+					delete(c.entries, k)
+				}
+			}
+		}
+		entry = &livePlaylistEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if time.Since(entry.fetchedAt) < llhlsPoll {
+		return entry.data, nil
+	}
+	out, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+	entry.data = data
+	entry.fetchedAt = time.Now()
+	return data, nil
+}
+
+// handlerLivePlaylist serves a live video's playlist. For low-latency
+// streams it supports blocking reloads: a request with _HLS_msn, and
+// optionally _HLS_part, waits until the playlist has that segment or part.
+func (cfg *apiConfig) handlerLivePlaylist(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	viewerID := cfg.optionalUserID(r)
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(r.Context(), video, viewerID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if !cfg.checkGeoRestriction(w, r, video, viewerID) {
+		return
+	}
+	stream, err := cfg.db.GetLiveStreamByVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get live stream", err)
+		return
+	}
+	if stream == nil {
+		respondWithError(w, http.StatusNotFound, "Video isn't live", nil)
+		return
+	}
+
+	msn, part := -1, -1
+	if v := r.URL.Query().Get("_HLS_msn"); v != "" {
+		msn, err = strconv.Atoi(v)
+		if err != nil || msn < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid _HLS_msn", err)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("_HLS_part"); v != "" {
+		part, err = strconv.Atoi(v)
+		if err != nil || part < 0 || msn < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid _HLS_part", err)
+			return
+		}
+	}
+
+	// Give up after three target durations, as the spec suggests.
+	deadline := time.Now().Add(3 * liveSegmentSeconds * time.Second)
+	for {
+		playlist, err := cfg.livePlaylists.get(r.Context(), cfg, stream.S3Key)
+		if err != nil {
+			respondWithError(w, http.StatusServiceUnavailable, "Live playlist isn't available yet", err)
+			return
+		}
+		pos := parseLLHLSPosition(playlist)
+		if msn < 0 || !stream.LowLatency || pos.has(msn, part) {
+			w.Header().Set("Content-Type", hlsContentTypes[".m3u8"])
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			w.Write(playlist)
+			return
+		}
+		if msn > pos.nextMSN+2 {
+			respondWithError(w, http.StatusBadRequest, "_HLS_msn is too far ahead of the stream", nil)
+			return
+		}
+		if time.Now().After(deadline) {
+			respondWithError(w, http.StatusServiceUnavailable, "Timed out waiting for the playlist", nil)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(llhlsPoll):
+		}
+	}
+}
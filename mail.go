@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/google/uuid"
+)
+
+type mailMessage struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// mailer sends email. Which implementation is used is chosen by
+// MAIL_PROVIDER.
+type mailer interface {
+	Send(ctx context.Context, msg mailMessage) error
+}
+
+// logMailer writes emails to the log instead of sending them, for
+// development.
+type logMailer struct{}
+
+func (logMailer) Send(ctx context.Context, msg mailMessage) error {
+	slog.InfoContext(ctx, "Email", "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+	return nil
+}
+
+// smtpMailer sends through an SMTP relay, upgrading to TLS when the server
+// offers STARTTLS.
+type smtpMailer struct {
+	addr     string
+	from     string
+	username string
+	password string
+}
+
+func (m smtpMailer) Send(ctx context.Context, msg mailMessage) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		host, _, _ := net.SplitHostPort(m.addr)
+		auth = smtp.PlainAuth("", m.username, m.password, host)
+	}
+	data, err := formatMail(m.from, msg)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, auth, m.from, []string{msg.To}, data)
+}
+
+// formatMail renders msg as a plain text RFC 5322 message.
+func formatMail(from string, msg mailMessage) ([]byte, error) {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(from, "\r\n") {
+		return nil, fmt.Errorf("invalid address")
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", uuid.New(), mailDomain(from))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := io.WriteString(w, strings.ReplaceAll(msg.Text, "\n", "\r\n")); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func mailDomain(address string) string {
+	_, domain, _ := strings.Cut(strings.TrimSuffix(address, ">"), "@")
+	if domain == "" {
+		return "localhost"
+	}
+	return domain
+}
+
+// sesMailer sends through the Amazon SES v2 API, signing requests with the
+// same AWS credentials the server uses for S3.
+type sesMailer struct {
+	region      string
+	from        string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	client      *http.Client
+}
+
+func newSESMailer(region, from string, credentials aws.CredentialsProvider) sesMailer {
+	return sesMailer{
+		region:      region,
+		from:        from,
+		credentials: credentials,
+		signer:      v4.NewSigner(),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (m sesMailer) Send(ctx context.Context, msg mailMessage) error {
+	type content struct {
+		Data    string
+		Charset string
+	}
+	var body struct {
+		FromEmailAddress string
+		Destination      struct{ ToAddresses []string }
+		Content          struct {
+			Simple struct {
+				Subject content
+				Body    struct{ Text content }
+			}
+		}
+	}
+	body.FromEmailAddress = m.from
+	body.Destination.ToAddresses = []string{msg.To}
+	body.Content.Simple.Subject = content{Data: msg.Subject, Charset: "UTF-8"}
+	body.Content.Simple.Body.Text = content{Data: msg.Text, Charset: "UTF-8"}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://email.%s.amazonaws.com/v2/email/outbound-emails", m.region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	creds, err := m.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(payload)
+	if err := m.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "ses", m.region, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("SES returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
@@ -2,30 +2,89 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/quic-go/quic-go/http3"
+	"google.golang.org/grpc"
 )
 
 type apiConfig struct {
-	db               database.Client
-	s3Client         *s3.Client
-	jwtSecret        string
-	platform         string
-	filepathRoot     string
-	assetsRoot       string
-	s3Bucket         string
-	s3Region         string
-	s3CfDistribution string
-	port             string
+	db                       database.Store
+	s3Client                 s3API
+	s3Presigner              s3PresignAPI
+	jwtSecret                string
+	platform                 string
+	filepathRoot             string
+	assetsRoot               string
+	uploadsRoot              string
+	ffmpegPath               string
+	ffprobePath              string
+	qualityMetrics           []string
+	ffmpegBreaker            *circuitBreaker
+	maxVideoUploadBytes      int64
+	maxThumbnailUploadBytes  int64
+	heicThumbnailFormat      string
+	containerProfiles        []string
+	defaultContainerProfile  string
+	jobMaxAttempts           int
+	backfillMaxQueued        int
+	quotas                   quotaLimits
+	quotaWarningPercent      int
+	mailer                   mailer
+	notifications            *notificationHub
+	moderator                *contentModerator
+	verticalCropper          *verticalCropper
+	chapterSuggester         chapterSuggester
+	virusScanner             *clamdScanner
+	quarantineBucket         string
+	quarantinePrefix         string
+	stagingBucket            string
+	stagingPrefix            string
+	objectLockMode           string
+	playbackTokenSecret      string
+	playbackTokenTTL         time.Duration
+	hlsEncryption            bool
+	preserveHDR              bool
+	normalizeFrameRate       bool
+	geoLocator               geoLocator
+	deliveryLogs             deliveryLogConfig
+	beacon                   beaconConfig
+	analyticsHourlyRetention time.Duration
+	live                     liveConfig
+	liveIngests              *liveIngests
+	livePlaylists            *livePlaylistCache
+	sitemap                  *sitemapCache
+	channelDomains           *channelDomainCache
+	certs                    *certManager
+	features                 *featureFlags
+	backupKey                []byte
+	backupRetention          int
+	metrics                  *serverMetrics
+	metricsToken             string
+	s3Bucket                 string
+	s3Region                 string
+	s3CfDistribution         string
+	port                     string
+	baseURL                  string
+	adminEmails              map[string]bool
+	trashRetention           time.Duration
 }
 
 type thumbnail struct {
@@ -36,107 +95,526 @@ type thumbnail struct {
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
-	if pathToDB == "" {
-		log.Fatal("DB_URL must be set")
+	var fileNames []string
+	if path := configFilePath(); path != "" {
+		var err error
+		fileNames, err = applyConfigFile(path)
+		if err != nil {
+			log.Fatalf("Couldn't load config file: %v", err)
+		}
 	}
 
-	db, err := database.NewClient(pathToDB)
-	if err != nil {
-		log.Fatalf("Couldn't connect to database: %v", err)
-	}
-
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	if len(os.Args) > 1 && (os.Args[1] == "migrate" || os.Args[1] == "restore") {
+		// DB_URL takes a postgres:// URL; DB_PATH is a SQLite file path.
+		dsn := os.Getenv("DB_URL")
+		if dsn == "" {
+			dsn = os.Getenv("DB_PATH")
+		}
+		if dsn == "" {
+			log.Fatal("DB_URL or DB_PATH must be set")
+		}
+		if os.Args[1] == "migrate" {
+			runMigrate(dsn, os.Args[2:])
+		} else {
+			runRestore(dsn, os.Args[2:])
+		}
+		return
 	}
 
-	platform := os.Getenv("PLATFORM")
-	if platform == "" {
-		log.Fatal("PLATFORM environment variable is not set")
+	conf, err := loadConfig(fileNames)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
-	filepathRoot := os.Getenv("FILEPATH_ROOT")
-	if filepathRoot == "" {
-		log.Fatal("FILEPATH_ROOT environment variable is not set")
+	logger, err := newLogger(os.Stderr, conf.logFormat, conf.logLevel)
+	if err != nil {
+		log.Fatal(err)
 	}
+	slog.SetDefault(logger)
 
-	assetsRoot := os.Getenv("ASSETS_ROOT")
-	if assetsRoot == "" {
-		log.Fatal("ASSETS_ROOT environment variable is not set")
+	var tracer *tracing.Tracer
+	if conf.otlpEndpoint != "" {
+		tracer = tracing.NewTracer(conf.otlpEndpoint, conf.serviceName)
+		tracing.SetDefault(tracer)
 	}
 
-	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
-		log.Fatal("S3_BUCKET environment variable is not set")
+	db, err := database.NewClient(context.Background(), conf.dsn, conf.pool)
+	if err != nil {
+		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
-	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
-		log.Fatal("S3_REGION environment variable is not set")
+	missingIndexes, err := db.MissingIndexes(context.Background())
+	if err != nil {
+		slog.Error("Couldn't check database indexes", "error", err)
 	}
-
-	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
-		log.Fatal("S3_CF_DISTRO environment variable is not set")
+	for _, name := range missingIndexes {
+		slog.Warn("Index is missing; listing queries will be slow until it's recreated", "index", name)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("PORT environment variable is not set")
+	// Listings, search, and rankings can be served from a read replica.
+	if conf.replicaDSN != "" {
+		db, err = db.WithReadReplica(conf.replicaDSN, conf.pool)
+		if err != nil {
+			log.Fatalf("Couldn't connect to read replica: %v", err)
+		}
 	}
+	db = db.WithQueryTimeout(conf.queryTimeout)
 
-	config, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
+	config, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(conf.s3Region))
 	if err != nil {
 		log.Fatal("Unable to load aws config")
 	}
 	s3Client := s3.NewFromConfig(config)
+	serverMetrics := newServerMetrics()
+	s3Breaker := newCircuitBreaker("s3", "storage", conf.circuitThreshold, conf.circuitCooldown, classifyS3, serverMetrics.circuitState)
 
 	cfg := apiConfig{
-		db:               db,
-		s3Client:         s3Client,
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
+		db:                       db,
+		s3Client:                 instrumentedS3{breakerS3{s3Client, s3Breaker}, serverMetrics.s3Operations},
+		s3Presigner:              s3.NewPresignClient(s3Client),
+		jwtSecret:                conf.jwtSecret,
+		platform:                 conf.platform,
+		filepathRoot:             conf.filepathRoot,
+		assetsRoot:               conf.assetsRoot,
+		uploadsRoot:              conf.uploadsRoot,
+		ffmpegPath:               conf.ffmpegPath,
+		qualityMetrics:           conf.qualityMetrics,
+		ffprobePath:              conf.ffprobePath,
+		ffmpegBreaker:            newCircuitBreaker("ffmpeg", "video processing", conf.circuitThreshold, conf.circuitCooldown, classifyFFmpeg, serverMetrics.circuitState),
+		maxVideoUploadBytes:      conf.maxVideoUploadBytes,
+		maxThumbnailUploadBytes:  conf.maxThumbnailUploadBytes,
+		heicThumbnailFormat:      conf.heicThumbnailFormat,
+		containerProfiles:        conf.containerProfiles,
+		defaultContainerProfile:  conf.defaultContainerProfile,
+		jobMaxAttempts:           conf.jobMaxAttempts,
+		backfillMaxQueued:        conf.backfillMaxQueued,
+		quotas:                   conf.quotas,
+		quotaWarningPercent:      conf.quotaWarningPercent,
+		notifications:            newNotificationHub(),
+		moderator:                newContentModerator(conf.moderation),
+		verticalCropper:          newVerticalCropper(conf.verticalCrop),
+		chapterSuggester:         newChapterSuggester(conf.chapterSuggestion),
+		virusScanner:             newClamdScanner(conf.clamdAddress, conf.clamdTimeout),
+		quarantineBucket:         conf.quarantineBucket,
+		quarantinePrefix:         conf.quarantinePrefix,
+		stagingBucket:            conf.stagingBucket,
+		stagingPrefix:            conf.stagingPrefix,
+		objectLockMode:           conf.objectLockMode,
+		playbackTokenSecret:      conf.playbackTokenSecret,
+		playbackTokenTTL:         conf.playbackTokenTTL,
+		hlsEncryption:            conf.hlsEncryption,
+		preserveHDR:              conf.preserveHDR,
+		normalizeFrameRate:       conf.normalizeFrameRate,
+		geoLocator:               newGeoLocator(conf.geo),
+		deliveryLogs:             conf.deliveryLogs,
+		beacon:                   conf.beacon,
+		analyticsHourlyRetention: conf.analyticsHourlyRetention,
+		live:                     conf.live,
+		liveIngests:              &liveIngests{},
+		livePlaylists:            &livePlaylistCache{},
+		sitemap:                  &sitemapCache{},
+		channelDomains:           newChannelDomainCache(conf.baseURL, conf.tlsDomains),
+		features:                 newFeatureFlags(conf.featureFlags),
+		backupKey:                conf.backupKey,
+		backupRetention:          conf.backupRetention,
+		metrics:                  serverMetrics,
+		metricsToken:             conf.metricsToken,
+		s3Bucket:                 conf.s3Bucket,
+		s3Region:                 conf.s3Region,
+		s3CfDistribution:         conf.s3CfDistribution,
+		port:                     conf.port,
+		baseURL:                  conf.baseURL,
+		adminEmails:              conf.adminEmails,
+		trashRetention:           conf.trashRetention,
+	}
+	switch conf.mailProvider {
+	case "log":
+		cfg.mailer = logMailer{}
+	case "smtp":
+		cfg.mailer = smtpMailer{addr: conf.smtpAddr, from: conf.mailFrom, username: conf.smtpUsername, password: conf.smtpPassword}
+	case "ses":
+		cfg.mailer = newSESMailer(conf.sesRegion, conf.mailFrom, config.Credentials)
 	}
 
+	serverMetrics.registry.BeforeScrape(cfg.collectGauges)
+
 	err = cfg.ensureAssetsDir()
 	if err != nil {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
+	err = cfg.ensureUploadsDir()
+	if err != nil {
+		log.Fatalf("Couldn't create uploads directory: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(&cfg, os.Args[2:])
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go cfg.runTrashPurger(ctx, time.Hour)
+	go cfg.runTrendingAggregator(ctx, 5*time.Minute)
+	go cfg.runAnalyticsRollup(ctx, 15*time.Minute)
+	go cfg.runUploadReconciler(ctx, 15*time.Minute)
+	go cfg.runBackfiller(ctx, 30*time.Second)
+	go cfg.runFeatureFlagRefresher(ctx, 30*time.Second)
+	if conf.deliveryLogs.prefix != "" {
+		go cfg.runDeliveryMeter(ctx, 15*time.Minute)
+	}
+	if conf.live.address != "" {
+		ln, err := net.Listen("tcp", conf.live.address)
+		if err != nil {
+			log.Fatalf("Couldn't listen for RTMP: %v", err)
+		}
+		go cfg.runLiveIngest(ctx, ln)
+	}
+	var grpcSrv *grpc.Server
+	if conf.grpcAddress != "" {
+		ln, err := net.Listen("tcp", conf.grpcAddress)
+		if err != nil {
+			log.Fatalf("Couldn't listen for gRPC: %v", err)
+		}
+		grpcSrv = cfg.newGRPCServer()
+		go func() {
+			if err := grpcSrv.Serve(ln); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+	jobsCtx, abortJobs := context.WithCancelCause(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		cfg.runJobWorker(ctx, jobsCtx, 5*time.Second, database.JobTypes{Types: webhookJobs.Types, Exclude: true})
+	}()
+	for range webhookWorkers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			cfg.runJobWorker(ctx, jobsCtx, time.Second, webhookJobs)
+		}()
+	}
+	workerDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workerDone)
+	}()
+	if conf.backupInterval > 0 {
+		go cfg.runBackupScheduler(ctx, conf.backupInterval)
+	}
+	if conf.storageReconcileInterval > 0 {
+		go cfg.runStorageReconciler(ctx, conf.storageReconcileInterval, conf.storageAutoRepair)
+	}
 
 	mux := http.NewServeMux()
-	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
+	appHandler, err := newFrontendHandler(conf.filepathRoot)
+	if err != nil {
+		log.Fatalf("Couldn't load frontend: %v", err)
+	}
 	mux.Handle("/app/", appHandler)
+	mux.Handle("GET /{$}", http.RedirectHandler("/app/", http.StatusFound))
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
+	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(conf.assetsRoot)))
 	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
 
-	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
-	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
-	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	api := newAPIRouter(mux, conf.requestTimeout, conf.uploadMinThroughput, conf.legacyAPISunset)
+	api.handleFunc("POST /api/login", cfg.handlerLogin, routeDoc{Summary: "Log in with email and password"})
+	api.handleFunc("POST /api/refresh", cfg.handlerRefresh, routeDoc{Summary: "Exchange a refresh token for an access token"})
+	api.handleFunc("POST /api/revoke", cfg.handlerRevoke, routeDoc{Summary: "Revoke a refresh token"})
+
+	api.handleFunc("POST /api/users", cfg.handlerUsersCreate, routeDoc{Summary: "Create a user"})
+	api.handleFunc("GET /api/users/me/delivery", cfg.handlerUserDelivery, routeDoc{Summary: "Get the bandwidth your videos used", Auth: true})
+	api.handleFunc("POST /api/users/me/stream-key", cfg.handlerStreamKeyCreate, routeDoc{Summary: "Create a new stream key for live streaming", Auth: true})
+	api.handleFunc("PATCH /api/users/me/stream-key", cfg.handlerStreamKeyUpdate, routeDoc{Summary: "Change the settings of your stream key", Auth: true})
+	api.handleFunc("GET /api/users/me/live-streams", cfg.handlerLiveStreamsList, routeDoc{Summary: "List your live streams", Auth: true})
+	api.handleFunc("POST /api/whip", cfg.handlerWHIPPublish, routeDoc{Summary: "Go live from a browser over WHIP, with a stream key as the bearer token"})
+	api.handleFunc("PATCH /api/whip/{sessionID}", cfg.handlerWHIPSession, routeDoc{Summary: "Send ICE candidates for a WHIP session"})
+	api.handleFunc("DELETE /api/whip/{sessionID}", cfg.handlerWHIPSession, routeDoc{Summary: "End a WHIP session"})
+	api.handleFunc("GET /api/users/me/export", cfg.handlerVideosExport, routeDoc{Summary: "Export your video catalog as JSON or CSV", Auth: true})
+	api.handleFunc("GET /api/users/me/quota", cfg.handlerQuotaGet, routeDoc{Summary: "Get your upload quota and usage", Auth: true})
+	api.handleFunc("GET /api/users/me/email-preferences", cfg.handlerEmailPreferencesGet, routeDoc{Summary: "Get which notification emails you receive", Auth: true})
+	api.handleFunc("PUT /api/users/me/email-preferences", cfg.handlerEmailPreferencesSet, routeDoc{Summary: "Turn notification emails on or off", Auth: true})
+	api.handleFunc("GET /api/users/me/history", cfg.handlerHistoryGet, routeDoc{Summary: "List your watch history", Auth: true})
+	api.handleFunc("DELETE /api/users/me/history", cfg.handlerHistoryClear, routeDoc{Summary: "Clear your watch history", Auth: true})
+	api.handleFunc("GET /api/users/me/watch-later", cfg.handlerWatchLaterList, routeDoc{Summary: "List your watch later videos", Auth: true})
+	api.handleFunc("PUT /api/users/me/watch-later/{videoID}", cfg.handlerWatchLaterAdd, routeDoc{Summary: "Add a video to watch later", Auth: true})
+	api.handleFunc("DELETE /api/users/me/watch-later/{videoID}", cfg.handlerWatchLaterRemove, routeDoc{Summary: "Remove a video from watch later", Auth: true})
+
+	api.handleFunc("POST /api/videos", cfg.handlerVideoMetaCreate, routeDoc{Summary: "Create a video draft", Auth: true})
+	api.handleFunc("POST /api/videos/batch", cfg.handlerVideosBatch, routeDoc{Summary: "Apply an operation to many videos", Auth: true})
+	uploads := newUploadAdmission(conf.maxUploads, conf.maxUploadBytes, conf.uploadQueueTimeout, conf.maxVideoUploadBytes, serverMetrics)
+	throttle := newUploadThrottle(conf.uploadBandwidth, conf.uploadConnBandwidth)
+	api.handleFunc("POST /api/thumbnail_upload/{videoID}", throttle.middleware(cfg.handlerUploadThumbnail), routeDoc{Summary: "Upload a thumbnail image", Auth: true, Timeout: conf.uploadTimeout, Upload: true})
+	api.handleFunc("GET /api/videos/{videoID}/thumbnail-variants", cfg.handlerThumbnailVariantsList, routeDoc{Summary: "List a video's thumbnail variants", Auth: true})
+	api.handleFunc("POST /api/videos/{videoID}/thumbnail-variants", throttle.middleware(cfg.handlerThumbnailVariantCreate), routeDoc{Summary: "Upload a thumbnail variant to test", Auth: true, Timeout: conf.uploadTimeout, Upload: true})
+	api.handleFunc("DELETE /api/videos/{videoID}/thumbnail-variants/{variantID}", cfg.handlerThumbnailVariantDelete, routeDoc{Summary: "Delete a thumbnail variant", Auth: true})
+	api.handleFunc("POST /api/video_upload/{videoID}", uploads.middleware(throttle.middleware(cfg.handlerUploadVideo)), routeDoc{Summary: "Upload the video file", Auth: true, Timeout: conf.uploadTimeout, Upload: true})
+	api.handleFunc("POST /api/videos/{videoID}/uploads", cfg.handlerResumableUploadCreate, routeDoc{Summary: "Start a resumable upload of the video file", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/uploads/{uploadID}", cfg.handlerResumableUploadGet, routeDoc{Summary: "List the parts a resumable upload has received", Auth: true})
+	api.handleFunc("PUT /api/videos/{videoID}/uploads/{uploadID}/parts/{part}", uploads.middleware(throttle.middleware(cfg.handlerResumableUploadPart)), routeDoc{Summary: "Upload one part of a resumable upload", Auth: true, Timeout: conf.uploadTimeout, Upload: true})
+	api.handleFunc("POST /api/videos/{videoID}/uploads/{uploadID}/complete", cfg.handlerResumableUploadComplete, routeDoc{Summary: "Finish a resumable upload and process the video", Auth: true, Timeout: conf.uploadTimeout})
+	api.handleFunc("DELETE /api/videos/{videoID}/uploads/{uploadID}", cfg.handlerResumableUploadAbort, routeDoc{Summary: "Abandon a resumable upload", Auth: true})
+	api.handleFunc("POST /api/videos/{videoID}/form-uploads", cfg.handlerFormUploadCreate, routeDoc{Summary: "Sign a policy for uploading the video file from an HTML form", Auth: true})
+	api.handleFunc("GET /api/form-uploads/{uploadID}/callback", cfg.handlerFormUploadCallback, routeDoc{Summary: "Process a file uploaded from an HTML form; S3 redirects the browser here", Timeout: conf.uploadTimeout})
+	api.handleFunc("GET /api/videos", cfg.handlerVideosRetrieve, routeDoc{Summary: "List your videos", Auth: true})
+	api.handleFunc("GET /api/videos/public", cfg.handlerVideosPublic, routeDoc{Summary: "List public videos"})
+	api.handleFunc("GET /api/videos/trending", cfg.handlerVideosTrending, routeDoc{Summary: "List trending public videos"})
+	api.handleFunc("GET /api/videos/top", cfg.handlerVideosTop, routeDoc{Summary: "List the most viewed public videos"})
+	api.handleFunc("GET /api/videos/trash", cfg.handlerVideosTrash, routeDoc{Summary: "List your deleted videos", Auth: true})
+	api.handleFunc("POST /api/videos/{videoID}/restore", cfg.handlerVideoRestore, routeDoc{Summary: "Restore a deleted video", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet, routeDoc{Summary: "Get a video by ID or slug"})
+	api.handleFunc("POST /api/videos/{videoID}/reprocess", cfg.handlerVideoReprocess, routeDoc{Summary: "Process a video whose processing failed again without re-uploading it", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/delivery", cfg.handlerVideoDelivery, routeDoc{Summary: "Get the bandwidth a video used", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/analytics", cfg.handlerVideoAnalytics, routeDoc{Summary: "Get a video's views, watch time, and buffering per hour or day", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/analytics/heatmap", cfg.handlerVideoHeatmap, routeDoc{Summary: "Get where a video's viewers watched, rewatched, and left", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/analytics/thumbnails", cfg.handlerThumbnailAnalytics, routeDoc{Summary: "Get the click-through rate of a video's thumbnail variants and the winner", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/geo-restriction", cfg.handlerGeoRestrictionGet, routeDoc{Summary: "Get the countries a video may be played in", Auth: true})
+	api.handleFunc("PUT /api/videos/{videoID}/geo-restriction", cfg.handlerGeoRestrictionSet, routeDoc{Summary: "Set the countries a video may be played in", Auth: true})
+	api.handleFunc("DELETE /api/videos/{videoID}/geo-restriction", cfg.handlerGeoRestrictionDelete, routeDoc{Summary: "Lift a video's geo-restriction", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/embed-settings", cfg.handlerEmbedSettingsGet, routeDoc{Summary: "Get the sites a video may be embedded on", Auth: true})
+	api.handleFunc("PUT /api/videos/{videoID}/embed-settings", cfg.handlerEmbedSettingsSet, routeDoc{Summary: "Restrict the sites a video may be embedded on", Auth: true})
+	api.handleFunc("DELETE /api/videos/{videoID}/embed-settings", cfg.handlerEmbedSettingsDelete, routeDoc{Summary: "Lift a video's embed restrictions", Auth: true})
+	api.handleFunc("POST /api/videos/{videoID}/embed-tokens", cfg.handlerEmbedTokenCreate, routeDoc{Summary: "Sign a token to embed a video", Auth: true})
+	api.handleFunc("DELETE /api/videos/{videoID}/embed-tokens", cfg.handlerEmbedTokensRevoke, routeDoc{Summary: "Revoke every embed token issued for a video", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/chapters", cfg.handlerChaptersGet, routeDoc{Summary: "List a video's chapters"})
+	api.handleFunc("PUT /api/videos/{videoID}/chapters", cfg.handlerChaptersSet, routeDoc{Summary: "Replace a video's chapters", Auth: true})
+	api.handleFunc("DELETE /api/videos/{videoID}/chapters", cfg.handlerChaptersDelete, routeDoc{Summary: "Remove a video's chapters", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/chapters/suggestions", cfg.handlerChapterSuggestionsGet, routeDoc{Summary: "List chapters suggested from a video's transcript", Auth: true})
+	api.handleFunc("POST /api/videos/{videoID}/chapters/suggestions", cfg.handlerChapterSuggestionsCreate, routeDoc{Summary: "Suggest chapters from a video's transcript", Auth: true})
+	api.handleFunc("POST /api/videos/{videoID}/chapters/suggestions/publish", cfg.handlerChapterSuggestionsPublish, routeDoc{Summary: "Publish a video's suggested chapters", Auth: true})
+	api.handleFunc("DELETE /api/videos/{videoID}/chapters/suggestions", cfg.handlerChapterSuggestionsDelete, routeDoc{Summary: "Discard a video's suggested chapters", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/transcript", cfg.handlerTranscriptGet, routeDoc{Summary: "Get a video's transcript"})
+	api.handleFunc("PUT /api/videos/{videoID}/transcript", cfg.handlerTranscriptSet, routeDoc{Summary: "Replace a video's transcript from a WebVTT or SRT captions file", Auth: true})
+	api.handleFunc("DELETE /api/videos/{videoID}/transcript", cfg.handlerTranscriptDelete, routeDoc{Summary: "Remove a video's transcript", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/transcript/search", cfg.handlerTranscriptSearch, routeDoc{Summary: "Search a video's transcript"})
+	api.handleFunc("GET /api/search/transcripts", cfg.handlerTranscriptsSearch, routeDoc{Summary: "Search public videos' transcripts"})
+	api.handleFunc("GET /api/videos/{videoID}/hls/master.m3u8", cfg.handlerHLSMasterPlaylist, routeDoc{Summary: "Get a video's HLS multivariant playlist, with its chapters"})
+	api.handleFunc("GET /api/videos/{videoID}/hls/chapters.json", cfg.handlerHLSChapters, routeDoc{Summary: "Get a video's chapters for HLS players"})
+	api.handleFunc("GET /api/videos/{videoID}/hls.key", cfg.handlerHLSKey, routeDoc{Summary: "Get the key a video's HLS segments are encrypted with"})
+	api.handleFunc("GET /api/videos/{videoID}/playback", cfg.handlerVideoPlayback, routeDoc{Summary: "Get signed playback URLs for a video"})
+	api.handleFunc("POST /api/beacon", cfg.handlerBeacon, routeDoc{Summary: "Record a batch of playback events from a player"})
+	api.handleFunc("GET /api/videos/{videoID}/live.m3u8", cfg.handlerLivePlaylist, routeDoc{Summary: "Get a live video's playlist, with LL-HLS blocking reloads"})
+	api.handleFunc("GET /api/playback/auth", cfg.handlerPlaybackAuth, routeDoc{Summary: "Check a playback token for a CDN or proxy"})
+	api.handleFunc("POST /api/videos/{videoID}/report", cfg.handlerVideoReport, routeDoc{Summary: "Report a video to moderators", Auth: true})
+	api.handleFunc("POST /api/videos/{videoID}/counter-notice", cfg.handlerDMCACounterNotice, routeDoc{Summary: "File a counter-notice against a DMCA takedown", Auth: true})
+	api.handleFunc("PUT /api/videos/{videoID}/position", cfg.handlerPlaybackPositionSet, routeDoc{Summary: "Save your playback position", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/download", cfg.handlerVideoDownload, routeDoc{Summary: "Download the original video file", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/related", cfg.handlerVideoRelated, routeDoc{Summary: "List videos related to a video"})
+	api.handleFunc("POST /api/videos/{videoID}/share", cfg.handlerVideoShareCreate, routeDoc{Summary: "Create an expiring share link", Auth: true})
+	api.handleFunc("GET /api/videos/{videoID}/shares", cfg.handlerVideoSharesList, routeDoc{Summary: "List a video's share links", Auth: true})
+	api.handleFunc("DELETE /api/videos/{videoID}/shares/{shareID}", cfg.handlerVideoShareRevoke, routeDoc{Summary: "Revoke a share link", Auth: true})
+	api.handleFunc("GET /api/shares/{token}", cfg.handlerSharedVideoGet, routeDoc{Summary: "Get a video through a share link"})
+	api.handleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoPatch, routeDoc{Summary: "Update video metadata", Auth: true})
+	api.handleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete, routeDoc{Summary: "Move a video to the trash", Auth: true})
+
+	api.handleFunc("POST /api/channels", cfg.handlerChannelCreate, routeDoc{Summary: "Create a channel", Auth: true})
+	api.handleFunc("GET /api/channels", cfg.handlerChannelsList, routeDoc{Summary: "List your channels", Auth: true})
+	api.handleFunc("GET /api/channels/{channelID}", cfg.handlerChannelGet, routeDoc{Summary: "Get a channel", Auth: true})
+	api.handleFunc("GET /api/channels/{channelID}/analytics", cfg.handlerChannelAnalytics, routeDoc{Summary: "Get a channel's views, watch time, and buffering per hour or day", Auth: true})
+	api.handleFunc("GET /api/channels/{channelID}/members", cfg.handlerChannelMembersList, routeDoc{Summary: "List channel members", Auth: true})
+	api.handleFunc("PUT /api/channels/{channelID}/members", cfg.handlerChannelMemberSet, routeDoc{Summary: "Add a channel member or change their role", Auth: true})
+	api.handleFunc("DELETE /api/channels/{channelID}/members/{userID}", cfg.handlerChannelMemberRemove, routeDoc{Summary: "Remove a channel member", Auth: true})
+	api.handleFunc("GET /api/channels/{channelID}/domain", cfg.handlerChannelDomainGet, routeDoc{Summary: "Get a channel's custom domain", Auth: true})
+	api.handleFunc("PUT /api/channels/{channelID}/domain", cfg.handlerChannelDomainSet, routeDoc{Summary: "Serve a channel's public pages on a custom domain", Auth: true})
+	api.handleFunc("DELETE /api/channels/{channelID}/domain", cfg.handlerChannelDomainDelete, routeDoc{Summary: "Remove a channel's custom domain", Auth: true})
+	api.handleFunc("POST /api/channels/{channelID}/domain/verify", cfg.handlerChannelDomainVerify, routeDoc{Summary: "Check a channel domain's DNS verification record", Auth: true})
+	api.handleFunc("GET /api/channels/{channelID}/page", cfg.handlerChannelPage, routeDoc{Summary: "HTML page of a channel's public videos"})
+
+	api.handleFunc("GET /api/channels/{channelID}/feed.rss", cfg.handlerChannelFeed, routeDoc{Summary: "RSS feed of a channel's public videos"})
+	api.handleFunc("GET /api/channels/{channelID}/podcast.rss", cfg.handlerChannelPodcast, routeDoc{Summary: "Podcast feed of a channel's public videos' audio"})
+	api.handleFunc("GET /api/users/{userID}/feed.rss", cfg.handlerUserFeed, routeDoc{Summary: "RSS feed of a user's public videos"})
+
+	api.handleFunc("GET /embed/{videoID}", cfg.handlerEmbedPlayer, routeDoc{Summary: "Embeddable HTML5 player page"})
+	api.handleFunc("GET /embed/{videoID}/chapters.vtt", cfg.handlerEmbedChapters, routeDoc{Summary: "A video's chapters as a WebVTT track for the embed player"})
+	api.handleFunc("GET /oembed", cfg.handlerOEmbed, routeDoc{Summary: "oEmbed metadata for a video link"})
+
+	api.handleFunc("POST /api/subscriptions", cfg.handlerSubscriptionCreate, routeDoc{Summary: "Subscribe to a creator or channel", Auth: true})
+	api.handleFunc("GET /api/subscriptions", cfg.handlerSubscriptionsList, routeDoc{Summary: "List your subscriptions", Auth: true})
+	api.handleFunc("GET /api/subscriptions/feed", cfg.handlerSubscriptionFeed, routeDoc{Summary: "List new videos from your subscriptions", Auth: true})
+	api.handleFunc("DELETE /api/subscriptions/{subscriptionID}", cfg.handlerSubscriptionDelete, routeDoc{Summary: "Unsubscribe", Auth: true})
+	api.handleFunc("GET /api/notifications", cfg.handlerNotificationsList, routeDoc{Summary: "List your notifications", Auth: true})
+	api.handleFunc("GET /api/notifications/unread-count", cfg.handlerNotificationsUnreadCount, routeDoc{Summary: "Count your unread notifications", Auth: true})
+	api.handleFunc("GET /api/notifications/stream", cfg.handlerNotificationsStream, routeDoc{Summary: "Stream new notifications as server-sent events", Auth: true, Stream: true})
+	api.handleFunc("POST /api/notifications/read", cfg.handlerNotificationsReadAll, routeDoc{Summary: "Mark all your notifications read", Auth: true})
+	api.handleFunc("POST /api/notifications/{notificationID}/read", cfg.handlerNotificationRead, routeDoc{Summary: "Mark a notification read", Auth: true})
+
+	api.handleFunc("POST /api/webhooks", cfg.handlerWebhookCreate, routeDoc{Summary: "Create a webhook subscription", Auth: true})
+	api.handleFunc("GET /api/webhooks", cfg.handlerWebhooksList, routeDoc{Summary: "List your webhook subscriptions", Auth: true})
+	api.handleFunc("GET /api/webhooks/{webhookID}", cfg.handlerWebhookGet, routeDoc{Summary: "Get a webhook subscription", Auth: true})
+	api.handleFunc("PUT /api/webhooks/{webhookID}", cfg.handlerWebhookUpdate, routeDoc{Summary: "Update a webhook subscription", Auth: true})
+	api.handleFunc("DELETE /api/webhooks/{webhookID}", cfg.handlerWebhookDelete, routeDoc{Summary: "Delete a webhook subscription", Auth: true})
+	api.handleFunc("GET /api/webhooks/{webhookID}/deliveries", cfg.handlerWebhookDeliveries, routeDoc{Summary: "List deliveries for a webhook subscription", Auth: true})
+
+	api.handleFunc("POST /graphql", cfg.handlerGraphQL, routeDoc{Summary: "Run a GraphQL query"})
+	api.handleFunc("GET /graphql", cfg.handlerGraphQL, routeDoc{Summary: "Run a GraphQL query"})
 
-	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	api.handleFunc("GET /admin/moderation/queue", cfg.handlerModerationQueue, routeDoc{Summary: "List reported videos awaiting moderation", Auth: true})
+	api.handleFunc("GET /admin/moderation/scans", cfg.handlerModerationScans, routeDoc{Summary: "List videos flagged by automated content scanning", Auth: true})
+	api.handleFunc("POST /admin/moderation/videos/{videoID}", cfg.handlerModerationAction, routeDoc{Summary: "Apply a moderation action to a video", Auth: true})
+	api.handleFunc("GET /admin/videos/{videoID}/renditions", cfg.handlerAdminVideoRenditions, routeDoc{Summary: "List a video's renditions with their quality scores", Auth: true})
+	api.handleFunc("GET /admin/renditions/quality", cfg.handlerRenditionQuality, routeDoc{Summary: "Summarize rendition quality scores by quality and codec", Auth: true})
+	api.handleFunc("GET /admin/quarantine", cfg.handlerQuarantineList, routeDoc{Summary: "List quarantined video files", Auth: true})
+	api.handleFunc("GET /admin/quarantine/{videoID}/preview", cfg.handlerQuarantinePreview, routeDoc{Summary: "Get a short-lived link to a quarantined video file", Auth: true})
+	api.handleFunc("POST /admin/quarantine/{videoID}/release", cfg.handlerQuarantineRelease, routeDoc{Summary: "Move a quarantined video file back and lift its takedown", Auth: true})
+	api.handleFunc("POST /admin/quarantine/{videoID}/reject", cfg.handlerQuarantineReject, routeDoc{Summary: "Delete a quarantined video file", Auth: true})
+	api.handleFunc("POST /admin/dmca/takedowns", cfg.handlerDMCATakedownCreate, routeDoc{Summary: "Take down a video under a DMCA notice", Auth: true})
+	api.handleFunc("GET /admin/dmca/takedowns", cfg.handlerDMCATakedownsList, routeDoc{Summary: "List DMCA takedowns", Auth: true})
+	api.handleFunc("POST /admin/dmca/takedowns/{takedownID}/restore", cfg.handlerDMCATakedownRestore, routeDoc{Summary: "Restore a video taken down under a DMCA notice", Auth: true})
+	api.handleFunc("GET /admin/users", cfg.handlerAdminUsersList, routeDoc{Summary: "List or search users", Auth: true})
+	api.handleFunc("GET /admin/users/{userID}", cfg.handlerAdminUserGet, routeDoc{Summary: "Get a user's account state and usage", Auth: true})
+	api.handleFunc("POST /admin/users/{userID}/suspend", cfg.handlerAdminUserSuspend, routeDoc{Summary: "Suspend a user's uploads and playback", Auth: true})
+	api.handleFunc("POST /admin/users/{userID}/unsuspend", cfg.handlerAdminUserUnsuspend, routeDoc{Summary: "Lift a user's suspension", Auth: true})
+	api.handleFunc("POST /admin/users/{userID}/password-reset", cfg.handlerAdminUserPasswordReset, routeDoc{Summary: "Require a user to choose a new password", Auth: true})
+	api.handleFunc("GET /admin/users/{userID}/quota", cfg.handlerAdminQuotaGet, routeDoc{Summary: "Get a user's upload quota and usage", Auth: true})
+	api.handleFunc("PUT /admin/users/{userID}/quota", cfg.handlerAdminQuotaSet, routeDoc{Summary: "Override a user's upload quota", Auth: true})
+	api.handleFunc("DELETE /admin/users/{userID}/quota", cfg.handlerAdminQuotaReset, routeDoc{Summary: "Reset a user's upload quota to the defaults", Auth: true})
+	api.handleFunc("GET /admin/users/{userID}/retention", cfg.handlerAdminRetentionGet, routeDoc{Summary: "Get a user's compliance mode retention", Auth: true})
+	api.handleFunc("PUT /admin/users/{userID}/retention", cfg.handlerAdminRetentionSet, routeDoc{Summary: "Put a user in compliance mode, locking their uploads for a retention period", Auth: true})
+	api.handleFunc("DELETE /admin/users/{userID}/retention", cfg.handlerAdminRetentionReset, routeDoc{Summary: "Take a user out of compliance mode for future uploads", Auth: true})
+	api.handleFunc("GET /admin/jobs", cfg.handlerJobsList, routeDoc{Summary: "List processing jobs", Auth: true})
+	api.handleFunc("GET /admin/jobs/{jobID}", cfg.handlerJobGet, routeDoc{Summary: "Get a processing job", Auth: true})
+	api.handleFunc("POST /admin/jobs/{jobID}/retry", cfg.handlerJobRetry, routeDoc{Summary: "Retry a dead or cancelled job", Auth: true})
+	api.handleFunc("POST /admin/jobs/dead/requeue", cfg.handlerDeadJobsRequeue, routeDoc{Summary: "Retry every dead-lettered job", Auth: true})
+	api.handleFunc("POST /admin/jobs/{jobID}/cancel", cfg.handlerJobCancel, routeDoc{Summary: "Cancel a pending or running job", Auth: true})
+	api.handleFunc("POST /admin/backfills", cfg.handlerBackfillCreate, routeDoc{Summary: "Start reprocessing every video with the current pipeline", Auth: true})
+	api.handleFunc("GET /admin/backfills", cfg.handlerBackfillsList, routeDoc{Summary: "List backfills", Auth: true})
+	api.handleFunc("GET /admin/backfills/{backfillID}", cfg.handlerBackfillGet, routeDoc{Summary: "Get a backfill's progress", Auth: true})
+	api.handleFunc("POST /admin/backfills/{backfillID}/pause", cfg.handlerBackfillPause, routeDoc{Summary: "Stop a backfill queueing more videos", Auth: true})
+	api.handleFunc("POST /admin/backfills/{backfillID}/resume", cfg.handlerBackfillResume, routeDoc{Summary: "Resume a paused backfill", Auth: true})
+	api.handleFunc("POST /admin/backfills/{backfillID}/cancel", cfg.handlerBackfillCancel, routeDoc{Summary: "Cancel a backfill", Auth: true})
+	api.handleFunc("GET /admin/delivery", cfg.handlerAdminDelivery, routeDoc{Summary: "Rank users by the bandwidth their videos used", Auth: true})
+	api.handleFunc("GET /admin/stats", cfg.handlerAdminStats, routeDoc{Summary: "Get system totals, job backlog, and upload volume", Auth: true})
+	api.handleFunc("GET /admin/db/pool", cfg.handlerDBPoolStats, routeDoc{Summary: "Get database connection pool stats", Auth: true})
+	api.handleFunc("POST /admin/backups", cfg.handlerBackupCreate, routeDoc{Summary: "Back up the database to S3", Auth: true, Timeout: conf.uploadTimeout})
+	api.handleFunc("GET /admin/backups", cfg.handlerBackupsList, routeDoc{Summary: "List database backups", Auth: true})
+	api.handleFunc("POST /admin/storage/reconcile", cfg.handlerStorageReconcile, routeDoc{Summary: "Cross-check the database against the S3 bucket", Auth: true, Timeout: conf.uploadTimeout})
+	api.handleFunc("GET /admin/storage/discrepancies", cfg.handlerStorageDiscrepancies, routeDoc{Summary: "List rows missing their objects and objects no row refers to", Auth: true})
+	api.handleFunc("POST /admin/storage/discrepancies/{discrepancyID}/repair", cfg.handlerStorageDiscrepancyRepair, routeDoc{Summary: "Repair a storage discrepancy", Auth: true})
+	api.handleFunc("GET /admin/feature-flags", cfg.handlerFeatureFlagsList, routeDoc{Summary: "List feature flags", Auth: true})
+	api.handleFunc("PUT /admin/feature-flags/{name}", cfg.handlerFeatureFlagSet, routeDoc{Summary: "Override a feature flag", Auth: true})
+	api.handleFunc("DELETE /admin/feature-flags/{name}", cfg.handlerFeatureFlagReset, routeDoc{Summary: "Reset a feature flag to its default", Auth: true})
+	api.handleFunc("GET /admin/migration/export", cfg.handlerMigrationExport, routeDoc{Summary: "Export every user and video for another instance to import", Auth: true, Stream: true})
+	api.handleFunc("POST /admin/migration/import", cfg.handlerMigrationImport, routeDoc{Summary: "Import users and videos from another instance or an archive", Auth: true, Timeout: conf.uploadTimeout, Upload: true})
+	api.handleFunc("GET /admin/audit-log", cfg.handlerAuditLog, routeDoc{Summary: "List admin actions", Auth: true})
+	api.handleFunc("POST /admin/reset", cfg.handlerReset, routeDoc{Summary: "Reset the database (dev only)"})
 
-	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
-	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
-	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
-	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
-	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
-	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("GET /healthz", handlerHealthz)
+	mux.HandleFunc("GET /readyz", cfg.handlerReadyz)
+	mux.HandleFunc("GET /metrics", cfg.handlerMetrics)
+	mux.HandleFunc("GET /sitemap.xml", cfg.handlerSitemap)
+	cfg.registerDebugRoutes(mux)
+	mux.HandleFunc("GET /api/docs", handlerSwaggerUI)
+	mux.HandleFunc("GET /api/docs/openapi.json", api.handlerOpenAPISpec)
 
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	// Middleware is listed innermost first.
+	var handler http.Handler = mux
+	handler = compressMiddleware(handler)
+	handler = cfg.channelDomainMiddleware(handler)
+	handler = newRateLimiter(conf.rateLimit, conf.rateLimitWindow).middleware(handler, cfg.optionalUserID)
+	handler = recoverMiddleware(handler, conf.errorReporter)
+	handler = serverMetrics.middleware(handler)
+	handler = tracingMiddleware(handler)
+	handler = conf.cors.middleware(handler)
+	handler = requestIDMiddleware(handler)
+	inflight := &inflightRequests{}
+	handler = inflight.middleware(handler)
 
 	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:              ":" + conf.port,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
 	}
+	srv.RegisterOnShutdown(cfg.notifications.close)
 
-	log.Printf("Serving on: http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+	var challengeSrv *http.Server
+	var h3Srv *http3.Server
+	if len(conf.tlsDomains) > 0 {
+		var cache certCache = dirCertCache(conf.acmeCache)
+		if conf.acmeCache == "s3" {
+			cache = s3CertCache{client: cfg.s3Client, bucket: conf.acmeS3Bucket}
+		}
+		certs := newCertManager(conf.acmeDirectoryURL, conf.acmeEmail, conf.tlsDomains, cache)
+
+		// The challenge server has to be up before a certificate can be
+		// issued.
+		challengeSrv = &http.Server{
+			Addr:              ":" + conf.httpPort,
+			Handler:           certs.httpHandler(conf.port),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := challengeSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		certCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		err := certs.ensure(certCtx)
+		cancel()
+		if err != nil {
+			log.Fatalf("Couldn't get TLS certificate: %v", err)
+		}
+		go certs.runRenewer(ctx, 12*time.Hour)
+		cfg.certs = certs
+		go cfg.runChannelDomainCerts(ctx, channelDomainSyncInterval)
+		srv.TLSConfig = &tls.Config{
+			GetCertificate: certs.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+			NextProtos:     []string{"http/1.1"},
+		}
+		if conf.http2 {
+			// Players fetch many small segments and thumbnails at once, which
+			// HTTP/2 multiplexes over one connection.
+			srv.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+		} else {
+			srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+		if conf.http3 {
+			h3Srv = newHTTP3Server(srv)
+			srv.Handler = altSvcMiddleware(srv.Handler, h3Srv)
+		}
+	}
+
+	go func() {
+		slog.Info("Serving", "url", conf.baseURL+"/app/")
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	if h3Srv != nil {
+		go func() {
+			slog.Info("Serving HTTP/3", "addr", h3Srv.Addr)
+			if err := h3Srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	stop()
+	if challengeSrv != nil {
+		challengeSrv.Close()
+	}
+	if grpcSrv != nil {
+		stopGRPCServer(grpcSrv, conf.drainTimeout)
+	}
+	shutdown(srv, h3Srv, inflight, workerDone, abortJobs, conf.drainTimeout)
+
+	if tracer != nil {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		tracer.Shutdown(flushCtx)
+		cancel()
+	}
+	db.Close()
+	slog.Info("Shut down")
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mocks"
+	"github.com/google/uuid"
+)
+
+const testJWTSecret = "test-secret"
+
+// newTestConfig returns a config for handler tests backed by mocks. Store
+// methods the handlers reach without a stub fail the test.
+func newTestConfig(t *testing.T) (*apiConfig, *mocks.Store, *mocks.S3Client) {
+	t.Helper()
+	store := mocks.NewStore(t)
+	s3Client := mocks.NewS3Client()
+	cfg := &apiConfig{
+		db:                      store,
+		s3Client:                s3Client,
+		s3Presigner:             mocks.S3Presigner{},
+		jwtSecret:               testJWTSecret,
+		assetsRoot:              t.TempDir(),
+		uploadsRoot:             t.TempDir(),
+		maxVideoUploadBytes:     1 << 20,
+		maxThumbnailUploadBytes: 1 << 10,
+		containerProfiles:       []string{containerProfileProgressive},
+		defaultContainerProfile: containerProfileProgressive,
+		jobMaxAttempts:          3,
+		metrics:                 newServerMetrics(),
+		s3Bucket:                "tubely-test",
+		s3CfDistribution:        "https://cdn.example.com",
+		baseURL:                 "http://localhost:8091",
+	}
+	return cfg, store, s3Client
+}
+
+// newUploadRequest builds a multipart upload of body in field, signed in as
+// userID.
+func newUploadRequest(t *testing.T, videoID, userID uuid.UUID, field, filename, contentType string, body []byte) *http.Request {
+	t.Helper()
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="`+field+`"; filename="`+filename+`"`)
+	header.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(body)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/videos/"+videoID.String()+"/"+field, &form)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.SetPathValue("videoID", videoID.String())
+	authorize(t, req, userID)
+	return req
+}
+
+// authorize signs r in as userID.
+func authorize(t *testing.T, r *http.Request, userID uuid.UUID) {
+	t.Helper()
+	token, err := auth.MakeJWT(userID, testJWTSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+}
+
+// stubVideo makes GetVideo return video and records the statuses it's set
+// to.
+func stubVideo(store *mocks.Store, video *database.Video) *[]database.VideoStatus {
+	statuses := &[]database.VideoStatus{}
+	store.GetVideoFunc = func(ctx context.Context, id uuid.UUID) (database.Video, error) {
+		if id != video.ID {
+			return database.Video{}, nil
+		}
+		return *video, nil
+	}
+	store.SetVideoStatusFunc = func(ctx context.Context, id uuid.UUID, status database.VideoStatus) error {
+		*statuses = append(*statuses, status)
+		video.Status = status
+		return nil
+	}
+	return statuses
+}
+
+func errorCodeOf(t *testing.T, rec *httptest.ResponseRecorder) errorCode {
+	t.Helper()
+	var resp struct {
+		Code errorCode `json:"code"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("couldn't decode error response %q: %v", rec.Body.String(), err)
+	}
+	return resp.Code
+}
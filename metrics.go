@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/metrics"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+)
+
+type serverMetrics struct {
+	registry        *metrics.Registry
+	requestDuration *metrics.Histogram
+	uploadSize      *metrics.Histogram
+	jobDuration     *metrics.Histogram
+	jobFailures     *metrics.Counter
+	s3Operations    *metrics.Counter
+	tempDiskUsage   *metrics.Gauge
+	jobQueueDepth   *metrics.Gauge
+	dbConnections   *metrics.Gauge
+	dbWaits         *metrics.Gauge
+	uploadsInFlight *metrics.Gauge
+	uploadsRejected *metrics.Counter
+	circuitState    *metrics.Gauge
+	moderationScans *metrics.Counter
+}
+
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry: r,
+		requestDuration: r.NewHistogram("tubely_http_request_duration_seconds",
+			"Time taken to serve HTTP requests.", metrics.DefBuckets, "method", "route", "status"),
+		uploadSize: r.NewHistogram("tubely_upload_size_bytes",
+			"Size of uploaded files.",
+			[]float64{100 << 10, 1 << 20, 10 << 20, 100 << 20, 500 << 20, 1 << 30, 5 << 30, 10 << 30}, "kind"),
+		jobDuration: r.NewHistogram("tubely_job_duration_seconds",
+			"Time taken to run processing jobs.",
+			[]float64{1, 5, 15, 30, 60, 120, 300, 600, 1800}, "type", "outcome"),
+		jobFailures: r.NewCounter("tubely_job_failures_total",
+			"Failed processing job runs. final is true when the job won't be retried.", "type", "final"),
+		s3Operations: r.NewCounter("tubely_s3_operations_total",
+			"S3 API calls by operation and outcome.", "operation", "outcome"),
+		tempDiskUsage: r.NewGauge("tubely_upload_spool_bytes",
+			"Disk space used by spooled uploads awaiting processing."),
+		jobQueueDepth: r.NewGauge("tubely_jobs",
+			"Processing jobs by status.", "status"),
+		dbConnections: r.NewGauge("tubely_db_connections",
+			"Database pool connections by state.", "state"),
+		dbWaits: r.NewGauge("tubely_db_connection_waits",
+			"Total number of times a query waited for a free database connection."),
+		uploadsInFlight: r.NewGauge("tubely_uploads_in_flight",
+			"Video uploads currently being received."),
+		uploadsRejected: r.NewCounter("tubely_uploads_rejected_total",
+			"Video uploads turned away because the server was at its upload limit."),
+		circuitState: r.NewGauge("tubely_circuit_state",
+			"Circuit breaker state by dependency: 0 closed, 1 half-open, 2 open.", "dependency"),
+		moderationScans: r.NewCounter("tubely_moderation_scans_total",
+			"Automated content scans by verdict.", "verdict"),
+	}
+}
+
+// collectGauges refreshes the gauges that are read on demand at scrape time.
+func (cfg *apiConfig) collectGauges(ctx context.Context) {
+	m := cfg.metrics
+
+	counts, err := cfg.db.CountJobsByStatus(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't count jobs", "error", err)
+	} else {
+		for _, status := range []database.JobStatus{
+			database.JobStatusPending,
+			database.JobStatusRunning,
+			database.JobStatusSucceeded,
+			database.JobStatusDead,
+			database.JobStatusCancelled,
+		} {
+			m.jobQueueDepth.Set(float64(counts[status]), string(status))
+		}
+	}
+
+	stats := cfg.db.PoolStats()
+	m.dbConnections.Set(float64(stats.InUse), "in_use")
+	m.dbConnections.Set(float64(stats.Idle), "idle")
+	m.dbWaits.Set(float64(stats.WaitCount))
+
+	var spooled int64
+	filepath.WalkDir(cfg.uploadsRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			spooled += info.Size()
+		}
+		return nil
+	})
+	m.tempDiskUsage.Set(float64(spooled))
+}
+
+// handlerMetrics serves Prometheus metrics. When METRICS_TOKEN is set the
+// scraper must send it as a bearer token.
+func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+	if cfg.metricsToken != "" {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.metricsToken)) != 1 {
+			respondWithError(w, http.StatusUnauthorized, "Invalid metrics token", err)
+			return
+		}
+	}
+	cfg.metrics.registry.Handler().ServeHTTP(w, r)
+}
+
+// middleware records the latency of each request, labelled with the
+// route pattern it matched so that path parameters don't explode the number
+// of series.
+func (m *serverMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		// ServeMux records the matched pattern on the request it's given.
+		req := r.WithContext(r.Context())
+		next.ServeHTTP(rec, req)
+
+		route := req.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		m.requestDuration.Observe(time.Since(start).Seconds(), r.Method, route, strconv.Itoa(rec.status))
+	})
+}
+
+// instrumentedS3 counts and traces every S3 call.
+type instrumentedS3 struct {
+	s3API
+	operations *metrics.Counter
+}
+
+func (s instrumentedS3) start(ctx context.Context, operation string, bucket, key *string) (context.Context, *tracing.Span) {
+	attrs := []tracing.Attr{tracing.String("aws.s3.bucket", aws.ToString(bucket))}
+	if key != nil {
+		attrs = append(attrs, tracing.String("aws.s3.key", *key))
+	}
+	return tracing.Start(ctx, "S3 "+operation, tracing.KindClient, attrs...)
+}
+
+func (s instrumentedS3) record(span *tracing.Span, operation string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	s.operations.Inc(operation, outcome)
+	span.RecordError(err)
+	span.End()
+}
+
+func (s instrumentedS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	ctx, span := s.start(ctx, "PutObject", params.Bucket, params.Key)
+	out, err := s.s3API.PutObject(ctx, params, optFns...)
+	s.record(span, "PutObject", err)
+	return out, err
+}
+
+func (s instrumentedS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	ctx, span := s.start(ctx, "GetObject", params.Bucket, params.Key)
+	out, err := s.s3API.GetObject(ctx, params, optFns...)
+	s.record(span, "GetObject", err)
+	return out, err
+}
+
+func (s instrumentedS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	ctx, span := s.start(ctx, "DeleteObject", params.Bucket, params.Key)
+	out, err := s.s3API.DeleteObject(ctx, params, optFns...)
+	s.record(span, "DeleteObject", err)
+	return out, err
+}
+
+func (s instrumentedS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	ctx, span := s.start(ctx, "CopyObject", params.Bucket, params.Key)
+	out, err := s.s3API.CopyObject(ctx, params, optFns...)
+	s.record(span, "CopyObject", err)
+	return out, err
+}
+
+func (s instrumentedS3) PutObjectLegalHold(ctx context.Context, params *s3.PutObjectLegalHoldInput, optFns ...func(*s3.Options)) (*s3.PutObjectLegalHoldOutput, error) {
+	ctx, span := s.start(ctx, "PutObjectLegalHold", params.Bucket, params.Key)
+	out, err := s.s3API.PutObjectLegalHold(ctx, params, optFns...)
+	s.record(span, "PutObjectLegalHold", err)
+	return out, err
+}
+
+func (s instrumentedS3) PutObjectRetention(ctx context.Context, params *s3.PutObjectRetentionInput, optFns ...func(*s3.Options)) (*s3.PutObjectRetentionOutput, error) {
+	ctx, span := s.start(ctx, "PutObjectRetention", params.Bucket, params.Key)
+	out, err := s.s3API.PutObjectRetention(ctx, params, optFns...)
+	s.record(span, "PutObjectRetention", err)
+	return out, err
+}
+
+func (s instrumentedS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	ctx, span := s.start(ctx, "ListObjectsV2", params.Bucket, nil)
+	out, err := s.s3API.ListObjectsV2(ctx, params, optFns...)
+	s.record(span, "ListObjectsV2", err)
+	return out, err
+}
+
+func (s instrumentedS3) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	ctx, span := s.start(ctx, "HeadBucket", params.Bucket, nil)
+	out, err := s.s3API.HeadBucket(ctx, params, optFns...)
+	s.record(span, "HeadBucket", err)
+	return out, err
+}
+
+func (s instrumentedS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	ctx, span := s.start(ctx, "CreateMultipartUpload", params.Bucket, params.Key)
+	out, err := s.s3API.CreateMultipartUpload(ctx, params, optFns...)
+	s.record(span, "CreateMultipartUpload", err)
+	return out, err
+}
+
+func (s instrumentedS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	ctx, span := s.start(ctx, "UploadPart", params.Bucket, params.Key)
+	out, err := s.s3API.UploadPart(ctx, params, optFns...)
+	s.record(span, "UploadPart", err)
+	return out, err
+}
+
+func (s instrumentedS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	ctx, span := s.start(ctx, "CompleteMultipartUpload", params.Bucket, params.Key)
+	out, err := s.s3API.CompleteMultipartUpload(ctx, params, optFns...)
+	s.record(span, "CompleteMultipartUpload", err)
+	return out, err
+}
+
+func (s instrumentedS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	ctx, span := s.start(ctx, "AbortMultipartUpload", params.Bucket, params.Key)
+	out, err := s.s3API.AbortMultipartUpload(ctx, params, optFns...)
+	s.record(span, "AbortMultipartUpload", err)
+	return out, err
+}
+
+func (s instrumentedS3) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	ctx, span := s.start(ctx, "ListMultipartUploads", params.Bucket, nil)
+	out, err := s.s3API.ListMultipartUploads(ctx, params, optFns...)
+	s.record(span, "ListMultipartUploads", err)
+	return out, err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// runMigrate implements the migrate subcommand:
+//
+//	tubely migrate         apply pending migrations
+//	tubely migrate status  list migrations and when they were applied
+func runMigrate(dsn string, args []string) {
+	db, err := database.Open(dsn, database.PoolConfig{})
+	if err != nil {
+		log.Fatalf("Couldn't connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if len(args) > 0 && args[0] == "status" {
+		status, err := db.MigrationStatus(context.Background())
+		if err != nil {
+			log.Fatalf("Couldn't get migration status: %v", err)
+		}
+		for _, m := range status {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-30s %s\n", m.Version, m.Name, applied)
+		}
+		return
+	}
+	if len(args) > 0 {
+		log.Fatalf("Unknown migrate command %q", args[0])
+	}
+
+	applied, err := db.Migrate(context.Background())
+	for _, m := range applied {
+		fmt.Printf("Applied %d %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Fatalf("Couldn't migrate database: %v", err)
+	}
+	if len(applied) == 0 {
+		fmt.Println("Database is up to date")
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// A migration archive is a gzipped tar file. manifest.json comes first and
+// describes the users and videos; the videos' files and thumbnails follow
+// under the names the manifest gives them.
+const (
+	migrationArchiveVersion = 1
+	migrationManifestName   = "manifest.json"
+)
+
+type migrationManifest struct {
+	Version    int                     `json:"version"`
+	ExportedAt time.Time               `json:"exported_at"`
+	Users      []database.MigratedUser `json:"users"`
+	Videos     []migratedVideo         `json:"videos"`
+}
+
+// migratedVideo is a video in an archive. File and Thumbnail name the
+// entries holding its source MP4 and thumbnail, if it has them. Other
+// renditions aren't archived.
+type migratedVideo struct {
+	database.Video
+	Source    *database.Rendition `json:"source,omitempty"`
+	File      string              `json:"file,omitempty"`
+	Thumbnail string              `json:"thumbnail,omitempty"`
+
+	key         string
+	path        string
+	retainUntil *time.Time
+}
+
+type migrationImportResult struct {
+	UsersImported  int `json:"users_imported"`
+	UsersSkipped   int `json:"users_skipped"`
+	VideosImported int `json:"videos_imported"`
+	VideosSkipped  int `json:"videos_skipped"`
+	// Errors lists what couldn't be imported. The rest of the archive is
+	// imported regardless.
+	Errors []string `json:"errors"`
+}
+
+// writeMigrationArchive writes every user and video, including videos in
+// the trash, with their files, for importing into another instance. A file
+// that has gone missing is left out, and the video is imported without it.
+func (cfg *apiConfig) writeMigrationArchive(ctx context.Context, w io.Writer) error {
+	users, err := cfg.db.ExportUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't list users: %w", err)
+	}
+	manifest := migrationManifest{
+		Version:    migrationArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		Users:      users,
+		Videos:     []migratedVideo{},
+	}
+	for _, user := range users {
+		videos, err := cfg.db.ExportVideos(ctx, user.ID, time.Time{}, time.Time{})
+		if err != nil {
+			return fmt.Errorf("couldn't list videos: %w", err)
+		}
+		for _, v := range videos {
+			video, err := cfg.newMigratedVideo(ctx, v.Video)
+			if err != nil {
+				return err
+			}
+			manifest.Videos = append(manifest.Videos, video)
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	dat, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, migrationManifestName, int64(len(dat)), strings.NewReader(string(dat))); err != nil {
+		return err
+	}
+	for _, video := range manifest.Videos {
+		if video.File != "" {
+			if err := cfg.archiveVideoFile(ctx, tw, video); err != nil {
+				return err
+			}
+		}
+		if video.Thumbnail != "" {
+			if err := archiveThumbnail(tw, video); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// newMigratedVideo finds where a video's source file and thumbnail are
+// stored, and names their archive entries.
+func (cfg *apiConfig) newMigratedVideo(ctx context.Context, video database.Video) (migratedVideo, error) {
+	v := migratedVideo{Video: video}
+	renditions, err := cfg.db.GetRenditions(ctx, video.ID)
+	if err != nil {
+		return migratedVideo{}, fmt.Errorf("couldn't get renditions: %w", err)
+	}
+	for _, rendition := range renditions {
+		if rendition.Quality == database.RenditionQualitySource {
+			v.Source = &rendition
+			v.key = rendition.S3Key
+		}
+	}
+	if v.key == "" && video.VideoURL != nil && video.Status != database.VideoStatusLive {
+		v.key, _ = cfg.s3KeyFromURL(*video.VideoURL)
+	}
+	if v.key != "" {
+		v.File = "videos/" + video.ID.String() + ".mp4"
+	}
+	if video.ThumbnailURL != nil {
+		if p, ok := cfg.assetPathFromURL(*video.ThumbnailURL); ok {
+			v.path = p
+			v.Thumbnail = "thumbnails/" + video.ID.String() + filepath.Ext(p)
+		}
+	}
+	return v, nil
+}
+
+func (cfg *apiConfig) archiveVideoFile(ctx context.Context, tw *tar.Writer, video migratedVideo) error {
+	obj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &video.key,
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		slog.WarnContext(ctx, "Archived video without its missing file", "video_id", video.ID, "key", video.key)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't get video file: %w", err)
+	}
+	defer obj.Body.Close()
+	if obj.ContentLength == nil {
+		return fmt.Errorf("couldn't get video file: no length for %s", video.key)
+	}
+	return writeTarEntry(tw, video.File, *obj.ContentLength, obj.Body)
+}
+
+func archiveThumbnail(tw *tar.Writer, video migratedVideo) error {
+	f, err := os.Open(video.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read thumbnail: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("couldn't read thumbnail: %w", err)
+	}
+	return writeTarEntry(tw, video.Thumbnail, info.Size(), f)
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, r, size)
+	return err
+}
+
+// fetchMigrationArchive downloads an archive from another instance's
+// export endpoint, with an admin's access token there.
+func fetchMigrationArchive(ctx context.Context, sourceURL, token string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(sourceURL, "/")+"/admin/migration/export", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("source instance responded with %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// importMigrationArchive copies the users and videos in an archive here,
+// keeping their IDs and slugs. Video files are uploaded to this bucket and
+// thumbnails to the assets directory. Users and videos that already exist
+// are skipped, so an interrupted import can be run again.
+func (cfg *apiConfig) importMigrationArchive(ctx context.Context, r io.Reader) (migrationImportResult, error) {
+	result := migrationImportResult{Errors: []string{}}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return result, fmt.Errorf("couldn't read archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil {
+		return result, fmt.Errorf("couldn't read archive: %w", err)
+	}
+	if hdr.Name != migrationManifestName {
+		return result, fmt.Errorf("archive must start with %s", migrationManifestName)
+	}
+	var manifest migrationManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return result, fmt.Errorf("couldn't read manifest: %w", err)
+	}
+	if manifest.Version != migrationArchiveVersion {
+		return result, fmt.Errorf("unsupported archive version %d", manifest.Version)
+	}
+
+	skippedUsers := map[uuid.UUID]bool{}
+	for _, user := range manifest.Users {
+		imported, err := cfg.db.ImportUser(ctx, user)
+		if err != nil {
+			skippedUsers[user.ID] = true
+			result.Errors = append(result.Errors, fmt.Sprintf("user %s: %v", user.ID, err))
+			continue
+		}
+		if imported {
+			result.UsersImported++
+		} else {
+			result.UsersSkipped++
+		}
+	}
+
+	// Files are only uploaded for videos that will be imported.
+	entries := map[string]*migratedVideo{}
+	for i := range manifest.Videos {
+		video := &manifest.Videos[i]
+		if skippedUsers[video.UserID] {
+			continue
+		}
+		existing, err := cfg.db.GetVideo(ctx, video.ID)
+		if err != nil {
+			return result, fmt.Errorf("couldn't get video: %w", err)
+		}
+		if existing.ID != uuid.Nil {
+			continue
+		}
+		if video.File != "" {
+			entries[video.File] = video
+		}
+		if video.Thumbnail != "" {
+			entries[video.Thumbnail] = video
+		}
+	}
+	// Whatever was stored for a video that isn't imported in the end is
+	// removed again.
+	imported := map[uuid.UUID]bool{}
+	defer func() {
+		for _, video := range entries {
+			if !imported[video.ID] {
+				cfg.discardImportedFiles(context.WithoutCancel(ctx), *video)
+			}
+		}
+	}()
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("couldn't read archive: %w", err)
+		}
+		video, ok := entries[hdr.Name]
+		if !ok {
+			continue
+		}
+		if hdr.Name == video.File {
+			video.key, video.retainUntil, err = cfg.importVideoFile(ctx, *video, tr)
+		} else {
+			video.path, err = cfg.importThumbnail(hdr.Name, tr)
+		}
+		if err != nil {
+			return result, fmt.Errorf("couldn't import %s: %w", hdr.Name, err)
+		}
+	}
+
+	for _, video := range manifest.Videos {
+		if skippedUsers[video.UserID] {
+			result.VideosSkipped++
+			continue
+		}
+		ok, err := cfg.importVideo(ctx, video)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("video %s: %v", video.ID, err))
+			continue
+		}
+		if !ok {
+			result.VideosSkipped++
+			continue
+		}
+		imported[video.ID] = true
+		result.VideosImported++
+	}
+	return result, nil
+}
+
+// importVideoFile uploads a video's file under a new key, like a processed
+// upload. It's spooled to disk first so the upload can be signed. The file
+// is locked until the later of the user's retention here, if they're in
+// compliance mode, and the retention it had on the source instance; it
+// returns when that is.
+func (cfg *apiConfig) importVideoFile(ctx context.Context, video migratedVideo, r io.Reader) (string, *time.Time, error) {
+	f, err := os.CreateTemp(cfg.uploadsRoot, "import-*.mp4")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return "", nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+
+	retainUntil, err := cfg.uploadRetainUntil(ctx, video.UserID)
+	if err != nil {
+		return "", nil, fmt.Errorf("couldn't get retention: %w", err)
+	}
+	if underRetention(video.Video) && (retainUntil == nil || video.RetainUntil.After(*retainUntil)) {
+		retainUntil = video.RetainUntil
+	}
+
+	prefix := database.AspectOther
+	if video.Aspect != nil {
+		prefix = *video.Aspect
+	}
+	randBuf := make([]byte, 32)
+	if _, err := rand.Read(randBuf); err != nil {
+		return "", nil, err
+	}
+	key := string(prefix) + "/" + base64.RawURLEncoding.EncodeToString(randBuf) + ".mp4"
+	mediaType := "video/mp4"
+	params := s3.PutObjectInput{
+		Bucket:      &cfg.s3Bucket,
+		Key:         &key,
+		Body:        f,
+		ContentType: &mediaType,
+	}
+	if retainUntil != nil {
+		params.ObjectLockMode = types.ObjectLockMode(cfg.objectLockMode)
+		params.ObjectLockRetainUntilDate = retainUntil
+	}
+	if _, err := cfg.s3Client.PutObject(ctx, &params); err != nil {
+		return "", nil, err
+	}
+	return key, retainUntil, nil
+}
+
+// importThumbnail writes a thumbnail to the assets directory under a new
+// name, keeping its extension.
+func (cfg *apiConfig) importThumbnail(name string, r io.Reader) (string, error) {
+	randBuf := make([]byte, 32)
+	if _, err := rand.Read(randBuf); err != nil {
+		return "", err
+	}
+	p := filepath.Join(cfg.assetsRoot, base64.RawURLEncoding.EncodeToString(randBuf)+path.Ext(name))
+	f, err := os.Create(p)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(p)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(p)
+		return "", err
+	}
+	return p, nil
+}
+
+// importVideo records an archived video with the files imported for it and
+// queues its file for processing, so it gets this instance's renditions like
+// an upload. A video whose file is missing is marked failed, so its owner
+// can upload it again.
+func (cfg *apiConfig) importVideo(ctx context.Context, v migratedVideo) (bool, error) {
+	video := v.Video
+	video.VideoURL = nil
+	video.ThumbnailURL = nil
+	video.RetainUntil = v.retainUntil
+	var renditions []database.Rendition
+	if v.key != "" {
+		url := fmt.Sprintf("%s/%s", cfg.s3CfDistribution, v.key)
+		video.VideoURL = &url
+		source := database.Rendition{Quality: database.RenditionQualitySource, S3Key: v.key}
+		if v.Source != nil {
+			source = *v.Source
+			source.S3Key = v.key
+		}
+		renditions = append(renditions, source)
+	}
+	if v.path != "" {
+		url := fmt.Sprintf("%s/assets/%s", cfg.baseURL, filepath.Base(v.path))
+		video.ThumbnailURL = &url
+	}
+	switch {
+	case video.VideoURL == nil && video.Status != database.VideoStatusDraft:
+		video.Status = database.VideoStatusFailed
+	case video.VideoURL != nil:
+		video.Status = database.VideoStatusProcessing
+	}
+	ok, err := cfg.db.ImportVideo(ctx, video, renditions)
+	if err != nil || !ok || video.VideoURL == nil {
+		return ok, err
+	}
+
+	_, err = cfg.db.CreateJob(ctx, database.CreateJobParams{
+		Type:        jobTypeReprocessVideo,
+		VideoID:     &video.ID,
+		Payload:     reprocessVideoPayload{},
+		MaxAttempts: cfg.jobMaxAttempts,
+	})
+	if err != nil {
+		// A failed video with a file can be reprocessed by its owner.
+		slog.ErrorContext(ctx, "Couldn't queue processing for imported video", "video_id", video.ID, "error", err)
+		if err := cfg.db.SetVideoStatus(ctx, video.ID, database.VideoStatusFailed); err != nil {
+			slog.ErrorContext(ctx, "Couldn't update video status", "video_id", video.ID, "error", err)
+		}
+	}
+	return true, nil
+}
+
+func (cfg *apiConfig) discardImportedFiles(ctx context.Context, video migratedVideo) {
+	if video.key != "" {
+		if err := cfg.deleteS3Object(ctx, video.key); err != nil {
+			slog.ErrorContext(ctx, "Couldn't delete imported file", "video_id", video.ID, "key", video.key, "error", err)
+		}
+	}
+	if video.path != "" {
+		os.Remove(video.path)
+	}
+}
+
+// runImport imports an archive file, or the archive of the instance at a
+// URL, given an admin's access token there in IMPORT_SOURCE_TOKEN.
+func runImport(cfg *apiConfig, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: tubely import <archive.tar.gz | https://source-instance>")
+		os.Exit(2)
+	}
+	ctx := context.Background()
+	var archive io.ReadCloser
+	if strings.HasPrefix(args[0], "http://") || strings.HasPrefix(args[0], "https://") {
+		token := os.Getenv("IMPORT_SOURCE_TOKEN")
+		if token == "" {
+			fmt.Fprintln(os.Stderr, "IMPORT_SOURCE_TOKEN must be set to import from another instance")
+			os.Exit(1)
+		}
+		var err error
+		archive, err = fetchMigrationArchive(ctx, args[0], token)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't download archive: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		var err error
+		archive, err = os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't open archive: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	defer archive.Close()
+
+	result, err := cfg.importMigrationArchive(ctx, archive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		os.Exit(1)
+	}
+	for _, msg := range result.Errors {
+		fmt.Fprintf(os.Stderr, "Skipped %s\n", msg)
+	}
+	fmt.Printf("Imported %d users (%d already here) and %d videos (%d skipped)\n", result.UsersImported, result.UsersSkipped, result.VideosImported, result.VideosSkipped)
+}
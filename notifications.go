@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// notificationStreamBuffer is how many notifications a stream may fall
+// behind by before further ones are dropped for it. Clients catch up by
+// listing notifications when they reconnect.
+const notificationStreamBuffer = 16
+
+// notificationHub passes new notifications to the open notification
+// streams of their users. It only reaches streams connected to this
+// instance.
+type notificationHub struct {
+	mu      sync.Mutex
+	streams map[uuid.UUID]map[chan database.Notification]struct{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newNotificationHub() *notificationHub {
+	return &notificationHub{
+		streams: map[uuid.UUID]map[chan database.Notification]struct{}{},
+		closed:  make(chan struct{}),
+	}
+}
+
+// subscribe opens a stream for userID. The caller must unsubscribe it.
+func (h *notificationHub) subscribe(userID uuid.UUID) chan database.Notification {
+	ch := make(chan database.Notification, notificationStreamBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streams[userID] == nil {
+		h.streams[userID] = map[chan database.Notification]struct{}{}
+	}
+	h.streams[userID][ch] = struct{}{}
+	return ch
+}
+
+func (h *notificationHub) unsubscribe(userID uuid.UUID, ch chan database.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streams[userID], ch)
+	if len(h.streams[userID]) == 0 {
+		delete(h.streams, userID)
+	}
+}
+
+func (h *notificationHub) publish(n database.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.streams[n.UserID] {
+		select {
+		case ch <- n:
+		default:
+		}
+	}
+}
+
+// close ends every stream, so shutdown doesn't wait on them.
+func (h *notificationHub) close() {
+	h.once.Do(func() { close(h.closed) })
+}
+
+// notify stores a notification and pushes it to the user's open streams.
+// It reports whether the notification was new.
+func (cfg *apiConfig) notify(ctx context.Context, params database.CreateNotificationParams) bool {
+	n, err := cfg.db.CreateNotification(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't create notification", "user_id", params.UserID, "type", params.Type, "error", err)
+		return false
+	}
+	if n == nil {
+		return false
+	}
+	cfg.notifications.publish(*n)
+	return true
+}
+
+// notifyProcessingFailed tells a video's owner, in the app and by email,
+// that its processing job gave up.
+func (cfg *apiConfig) notifyProcessingFailed(ctx context.Context, videoID uuid.UUID) {
+	video, err := cfg.db.GetVideo(ctx, videoID)
+	if err != nil || video.ID == uuid.Nil {
+		return
+	}
+	cfg.notify(ctx, database.CreateNotificationParams{
+		UserID:  video.UserID,
+		Type:    database.NotificationProcessingFailed,
+		VideoID: &video.ID,
+	})
+	cfg.sendEmail(ctx, video.UserID, database.EmailProcessingFailed, emailData{Video: video})
+}
+
+// notifyNewSubscriber tells a creator, or each owner of a channel, that
+// someone subscribed to them.
+func (cfg *apiConfig) notifyNewSubscriber(ctx context.Context, sub database.Subscription) {
+	var recipients []uuid.UUID
+	if sub.CreatorID != nil {
+		recipients = append(recipients, *sub.CreatorID)
+	}
+	if sub.ChannelID != nil {
+		members, err := cfg.db.GetChannelMembers(ctx, *sub.ChannelID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't get channel members", "channel_id", *sub.ChannelID, "error", err)
+			return
+		}
+		for _, member := range members {
+			if member.Role == database.ChannelRoleOwner && member.UserID != sub.SubscriberID {
+				recipients = append(recipients, member.UserID)
+			}
+		}
+	}
+	for _, userID := range recipients {
+		cfg.notify(ctx, database.CreateNotificationParams{
+			UserID:  userID,
+			Type:    database.NotificationNewSubscriber,
+			ActorID: &sub.SubscriberID,
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// routeDoc describes a route for the generated OpenAPI document, along with
+// how long its handler may run.
+type routeDoc struct {
+	Summary string
+	// Auth marks routes that require a bearer access token.
+	Auth bool
+	// Timeout replaces the router's default handler timeout for routes
+	// such as uploads that legitimately run long.
+	Timeout time.Duration
+	// Upload marks routes whose body is a file upload. With a minimum
+	// upload throughput set, those that declare a Content-Length get a
+	// timeout sized to it, and Timeout only applies to the others.
+	Upload bool
+	// Stream marks long-lived streaming routes, which get no handler
+	// timeout at all.
+	Stream bool
+}
+
+type apiRoute struct {
+	method string
+	path   string
+	doc    routeDoc
+}
+
+// apiVersionPrefix is where the current version of the API is served.
+const apiVersionPrefix = "/api/v1"
+
+// legacyAPIDeprecated is when the unversioned /api/ paths were deprecated.
+var legacyAPIDeprecated = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// apiRouter registers handlers on a ServeMux and records them so the OpenAPI
+// document is generated from the same table that serves requests.
+type apiRouter struct {
+	mux     *http.ServeMux
+	routes  []apiRoute
+	timeout time.Duration
+	// minUploadThroughput sizes the timeouts of upload routes, in bytes
+	// per second. Zero gives them their fixed Timeout.
+	minUploadThroughput int64
+	// legacySunset is when the unversioned /api/ paths go away, if that's
+	// been decided.
+	legacySunset time.Time
+}
+
+// newAPIRouter returns a router whose handlers are cut off after timeout
+// unless their routeDoc sets their own. Uploads get timeout plus the time
+// to read them at minUploadThroughput.
+func newAPIRouter(mux *http.ServeMux, timeout time.Duration, minUploadThroughput int64, legacySunset time.Time) *apiRouter {
+	return &apiRouter{mux: mux, timeout: timeout, minUploadThroughput: minUploadThroughput, legacySunset: legacySunset}
+}
+
+// handleFunc registers a handler for a "METHOD /path" pattern. Paths under
+// /api/ are served under /api/v1/, and at their original path for clients
+// that predate versioning, with headers announcing its deprecation.
+func (a *apiRouter) handleFunc(pattern string, handler http.HandlerFunc, doc routeDoc) {
+	timeout := a.timeout
+	if doc.Timeout != 0 {
+		timeout = doc.Timeout
+	}
+	if doc.Stream {
+		timeout = 0
+	}
+	withTimeout := func(h http.Handler) http.Handler {
+		if doc.Upload {
+			return uploadTimeoutMiddleware(h, a.timeout, timeout, a.minUploadThroughput)
+		}
+		return timeoutMiddleware(h, timeout)
+	}
+	method, path, _ := strings.Cut(pattern, " ")
+	if rest, ok := strings.CutPrefix(path, "/api/"); ok {
+		a.mux.Handle(pattern, withTimeout(a.legacyMiddleware(handler)))
+		path = apiVersionPrefix + "/" + rest
+		pattern = method + " " + path
+	}
+	a.mux.Handle(pattern, withTimeout(handler))
+	a.routes = append(a.routes, apiRoute{
+		method: strings.ToLower(method),
+		path:   path,
+		doc:    doc,
+	})
+}
+
+// legacyMiddleware marks a response from an unversioned path as deprecated
+// (RFC 9745), pointing at the same path under /api/v1.
+func (a *apiRouter) legacyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		successor := apiVersionPrefix + strings.TrimPrefix(r.URL.Path, "/api")
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(legacyAPIDeprecated.Unix(), 10))
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		if !a.legacySunset.IsZero() {
+			w.Header().Set("Sunset", a.legacySunset.UTC().Format(http.TimeFormat))
+		}
+		next(w, r)
+	}
+}
+
+func (a *apiRouter) openAPISpec() map[string]any {
+	paths := map[string]map[string]any{}
+	for _, route := range a.routes {
+		op := map[string]any{
+			"summary":     route.doc.Summary,
+			"operationId": route.method + strings.ReplaceAll(route.path, "/", "_"),
+			"tags":        []string{routeTag(route.path)},
+			"responses": map[string]any{
+				"default": map[string]any{
+					"description": "JSON response; errors are returned as {\"error\": string, \"code\": string, \"details\": object, \"request_id\": string}",
+				},
+			},
+		}
+		if params := pathParams(route.path); len(params) > 0 {
+			op["parameters"] = params
+		}
+		if route.doc.Auth {
+			op["security"] = []map[string][]string{{"bearerAuth": {}}}
+		}
+		if paths[route.path] == nil {
+			paths[route.path] = map[string]any{}
+		}
+		paths[route.path][route.method] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Tubely API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+}
+
+// routeTag groups operations by the first path segment after /api/v1.
+func routeTag(path string) string {
+	if rest, ok := strings.CutPrefix(path, apiVersionPrefix+"/"); ok {
+		path = rest
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	return segments[0]
+}
+
+func pathParams(path string) []map[string]any {
+	params := []map[string]any{}
+	for _, segment := range strings.Split(path, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.Trim(segment, "{}"), "...")
+		params = append(params, map[string]any{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]string{"type": "string"},
+		})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		return params[i]["name"].(string) < params[j]["name"].(string)
+	})
+	return params
+}
+
+func (a *apiRouter) handlerOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, a.openAPISpec())
+}
+
+const swaggerUIPage = `<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="UTF-8" />
+    <title>Tubely API</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css" />
+  </head>
+  <body>
+    <div id="swagger-ui"></div>
+    <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+    <script>
+      window.ui = SwaggerUIBundle({ url: '/api/docs/openapi.json', dom_id: '#swagger-ui' });
+    </script>
+  </body>
+</html>
+`
+
+func handlerSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// optionalUserID returns the ID of the authenticated user, or uuid.Nil when
+// the request has no valid access token. Use it on endpoints that are public
+// but behave differently for signed-in users.
+func (cfg *apiConfig) optionalUserID(r *http.Request) uuid.UUID {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil
+	}
+	return userID
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+func parsePagination(r *http.Request) (limit int, offset int, err error) {
+	limit = defaultPageLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return 0, 0, errors.New("limit must be a positive integer")
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+	}
+	if s := r.URL.Query().Get("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// encodeCursor turns a row position into an opaque cursor for clients.
+func encodeCursor(c database.PageCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (database.PageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return database.PageCursor{}, errors.New("invalid cursor")
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return database.PageCursor{}, errors.New("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return database.PageCursor{}, errors.New("invalid cursor")
+	}
+	videoID, err := uuid.Parse(id)
+	if err != nil {
+		return database.PageCursor{}, errors.New("invalid cursor")
+	}
+	return database.PageCursor{CreatedAt: createdAt, ID: videoID}, nil
+}
+
+// parseCursorPagination reads the limit, after, and before query parameters.
+func parseCursorPagination(r *http.Request) (limit int, after, before *database.PageCursor, err error) {
+	limit, _, err = parsePagination(r)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	query := r.URL.Query()
+	if query.Get("after") != "" && query.Get("before") != "" {
+		return 0, nil, nil, errors.New("after and before can't be combined")
+	}
+	if s := query.Get("after"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		after = &c
+	}
+	if s := query.Get("before"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		before = &c
+	}
+	return limit, after, before, nil
+}
+
+// respondWithVideoPage lists a page of videos and advertises the adjacent
+// pages in a Link header (RFC 8288).
+func (cfg *apiConfig) respondWithVideoPage(w http.ResponseWriter, r *http.Request, params database.ListVideosParams) {
+	videos, more, err := cfg.db.ListVideos(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	var next, prev string
+	if len(videos) > 0 {
+		first := encodeCursor(videos[0].Cursor())
+		last := encodeCursor(videos[len(videos)-1].Cursor())
+		if params.Before != nil {
+			next = last
+			if more {
+				prev = first
+			}
+		} else {
+			if more {
+				next = last
+			}
+			if params.After != nil {
+				prev = first
+			}
+		}
+	}
+	setPageLinks(w, r, params.Limit, next, prev)
+
+	if params.PublicOnly {
+		cfg.rotateThumbnails(r.Context(), videos)
+	}
+	respondWithJSON(w, http.StatusOK, videos)
+}
+
+func setPageLinks(w http.ResponseWriter, r *http.Request, limit int, next, prev string) {
+	link := func(param, cursor, rel string) string {
+		u := *r.URL
+		query := u.Query()
+		query.Del("after")
+		query.Del("before")
+		query.Del("offset")
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set(param, cursor)
+		u.RawQuery = query.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+	}
+
+	links := []string{}
+	if next != "" {
+		links = append(links, link("after", next, "next"))
+	}
+	if prev != "" {
+		links = append(links, link("before", prev, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
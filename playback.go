@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// playbackTokenExpiry is when tokens issued at now expire. Expiries are
+// rounded to the token TTL so a video's URLs, and so its ETag, stay the
+// same for a while; every token is valid for at least the TTL.
+func (cfg *apiConfig) playbackTokenExpiry(now time.Time) time.Time {
+	return now.UTC().Truncate(cfg.playbackTokenTTL).Add(2 * cfg.playbackTokenTTL)
+}
+
+// playbackURL adds a playback token for viewerID to a URL served from the
+// CDN. URLs are returned unchanged when playback tokens are off.
+func (cfg *apiConfig) playbackURL(ctx context.Context, rawURL string, videoID, viewerID uuid.UUID, expiresAt time.Time) string {
+	if cfg.playbackTokenSecret == "" {
+		return rawURL
+	}
+	key, ok := cfg.s3KeyFromURL(rawURL)
+	if !ok {
+		return rawURL
+	}
+	token, err := auth.MakePlaybackToken(auth.PlaybackClaims{
+		VideoID:  videoID,
+		ViewerID: viewerID,
+		Key:      key,
+	}, cfg.playbackTokenSecret, expiresAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't make playback token", "video_id", videoID, "error", err)
+		return rawURL
+	}
+	return rawURL + "?token=" + url.QueryEscape(token)
+}
+
+// playbackRenditions lists a video's renditions with URLs signed for
+// viewerID. The trailer, if the video has one, is returned on its own
+// rather than as one of the renditions.
+func (cfg *apiConfig) playbackRenditions(ctx context.Context, videoID, viewerID uuid.UUID, expiresAt time.Time) ([]renditionResponse, *renditionResponse, error) {
+	renditions, err := cfg.db.GetRenditions(ctx, videoID)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := []renditionResponse{}
+	var trailer *renditionResponse
+	for _, rendition := range renditions {
+		r := renditionResponse{
+			Quality:          rendition.Quality,
+			Codec:            rendition.Codec,
+			URL:              cfg.playbackURL(ctx, fmt.Sprintf("%s/%s", cfg.s3CfDistribution, rendition.S3Key), videoID, viewerID, expiresAt),
+			SizeBytes:        rendition.SizeBytes,
+			Bitrate:          rendition.Bitrate,
+			ContainerProfile: rendition.ContainerProfile,
+		}
+		if rendition.Quality == database.RenditionQualityTrailer {
+			trailer = &r
+			continue
+		}
+		resp = append(resp, r)
+	}
+	return resp, trailer, nil
+}
+
+// recordPlayback counts a view of a video whose playback URLs were just
+// handed out, and adds it to a signed-in viewer's watch history. Owners
+// watching their own videos aren't counted, and neither are videos with no
+// file to play yet.
+func (cfg *apiConfig) recordPlayback(ctx context.Context, video database.Video, viewerID uuid.UUID) {
+	if video.VideoURL == nil || video.UserID == viewerID {
+		return
+	}
+	if err := cfg.db.RecordView(ctx, video.ID); err != nil {
+		slog.ErrorContext(ctx, "Couldn't record view", "video_id", video.ID, "error", err)
+	}
+	if viewerID == uuid.Nil {
+		return
+	}
+	if _, err := cfg.db.RecordWatch(ctx, viewerID, video.ID); err != nil {
+		slog.ErrorContext(ctx, "Couldn't record watch history", "video_id", video.ID, "error", err)
+	}
+}
+
+type playbackResponse struct {
+	URL        string              `json:"url"`
+	Renditions []renditionResponse `json:"renditions"`
+	Trailer    *renditionResponse  `json:"trailer,omitempty"`
+	HLSKeyURL  string              `json:"hls_key_url,omitempty"`
+	ExpiresAt  *time.Time          `json:"expires_at,omitempty"`
+}
+
+// handlerVideoPlayback returns fresh playback URLs for a video, so players
+// can renew expiring tokens without refetching the video, which counts a
+// view.
+func (cfg *apiConfig) handlerVideoPlayback(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	viewerID := cfg.optionalUserID(r)
+	if video.ID == uuid.Nil || video.DeletedAt != nil || !cfg.canViewVideo(r.Context(), video, viewerID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if !cfg.checkGeoRestriction(w, r, video, viewerID) {
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has not been uploaded yet", nil)
+		return
+	}
+
+	expiresAt := cfg.playbackTokenExpiry(time.Now())
+	renditions, trailer, err := cfg.playbackRenditions(r.Context(), video.ID, viewerID, expiresAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get renditions", err)
+		return
+	}
+	playback := playbackResponse{
+		URL:        cfg.playbackURL(r.Context(), *video.VideoURL, video.ID, viewerID, expiresAt),
+		Renditions: renditions,
+		Trailer:    trailer,
+	}
+	key, err := cfg.db.GetHLSKey(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get HLS key", err)
+		return
+	}
+	if key != nil {
+		playback.HLSKeyURL = cfg.playbackHLSKeyURL(r.Context(), video.ID, viewerID, expiresAt)
+	}
+	if cfg.playbackTokenSecret != "" {
+		playback.ExpiresAt = &expiresAt
+	}
+	respondWithJSON(w, http.StatusOK, playback)
+}
+
+// handlerPlaybackAuth lets a CDN or proxy check a playback token before
+// serving a file, for example from nginx's auth_request. The requested URI
+// comes from the X-Original-URI header, or the uri query parameter, and
+// carries the token in its own token parameter. It responds 204 if the
+// token is valid for that object and 403 if not. It doesn't touch the
+// database, so it's cheap enough to call on every request.
+func (cfg *apiConfig) handlerPlaybackAuth(w http.ResponseWriter, r *http.Request) {
+	if cfg.playbackTokenSecret == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	rawURI := r.Header.Get("X-Original-URI")
+	if rawURI == "" {
+		rawURI = r.URL.Query().Get("uri")
+	}
+	uri, err := url.Parse(rawURI)
+	if err != nil || uri.Path == "" {
+		respondWithError(w, http.StatusForbidden, "Invalid playback URI", err)
+		return
+	}
+	claims, err := auth.ValidatePlaybackToken(uri.Query().Get("token"), cfg.playbackTokenSecret)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, "Invalid playback token", err)
+		return
+	}
+	if claims.Key != strings.TrimPrefix(uri.Path, "/") {
+		respondWithError(w, http.StatusForbidden, "Playback token is for another file", nil)
+		return
+	}
+	// Proxies pass the player's headers along; a signed-in player must be
+	// the viewer the token was issued to.
+	if viewerID := cfg.optionalUserID(r); viewerID != uuid.Nil && claims.ViewerID != uuid.Nil && viewerID != claims.ViewerID {
+		respondWithError(w, http.StatusForbidden, "Playback token is for another viewer", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
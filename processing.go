@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+)
+
+// commandStderrLimit caps how much of a command's stderr is kept for error
+// reports. ffmpeg puts the cause of a failure at the end.
+const commandStderrLimit = 8 << 10
+
+// commandError is a failed ffmpeg or ffprobe run, with the end of its
+// stderr.
+type commandError struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *commandError) Error() string {
+	return fmt.Sprintf("%s: %v", filepath.Base(e.Args[0]), e.Err)
+}
+
+func (e *commandError) Unwrap() error {
+	return e.Err
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.limit {
+		t.buf = t.buf[len(t.buf)-t.limit:]
+	}
+	return len(p), nil
+}
+
+// runCommand runs cmd, returning a *commandError holding its stderr if it
+// fails.
+func runCommand(cmd *exec.Cmd) error {
+	stderr := &tailBuffer{limit: commandStderrLimit}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return &commandError{Args: cmd.Args, Stderr: string(stderr.buf), Err: err}
+	}
+	return nil
+}
+
+// videoProbe is the subset of ffprobe output we store for a video.
+type videoProbe struct {
+	Width           int
+	Height          int
+	DurationSeconds float64
+	FrameRate       float64
+	Codec           string
+	// Bitrate is the overall bitrate in bits per second, or 0 if ffprobe
+	// didn't report one.
+	Bitrate  int64
+	HasAudio bool
+	// AudioTracks are the audio streams, in order, all of which are kept
+	// through processing.
+	AudioTracks []database.AudioTrack
+	// Projection is set for 360° videos to how the picture maps onto the
+	// sphere, such as "equirectangular".
+	Projection string
+	// HDR is the video's HDR format, or "" for SDR.
+	HDR string
+	// VariableFrameRate reports whether the video's frame rate varies.
+	VariableFrameRate bool
+}
+
+func probeVideo(ctx context.Context, ffprobePath, filePath string) (videoProbe, error) {
+	ctx, span := tracing.Start(ctx, "ffprobe", tracing.KindInternal)
+	defer span.End()
+	cmd := exec.CommandContext(ctx, ffprobePath, "-v", "error", "-print_format", "json", "-show_streams", "-show_format", filePath)
+	buf := bytes.Buffer{}
+	cmd.Stdout = &buf
+	err := runCommand(cmd)
+	if err != nil {
+		span.RecordError(err)
+		return videoProbe{}, err
+	}
+
+	data := struct {
+		Streams []struct {
+			CodecType     string `json:"codec_type"`
+			CodecName     string `json:"codec_name"`
+			Height        int    `json:"height"`
+			Width         int    `json:"width"`
+			AvgFrameRate  string `json:"avg_frame_rate"`
+			RFrameRate    string `json:"r_frame_rate"`
+			ColorTransfer string `json:"color_transfer"`
+			Channels      int    `json:"channels"`
+			Tags          struct {
+				Language string `json:"language"`
+				Title    string `json:"title"`
+			} `json:"tags"`
+			Disposition struct {
+				Default int `json:"default"`
+			} `json:"disposition"`
+			SideDataList []struct {
+				SideDataType string `json:"side_data_type"`
+				Projection   string `json:"projection"`
+			} `json:"side_data_list"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+			BitRate  string `json:"bit_rate"`
+		} `json:"format"`
+	}{}
+	err = json.Unmarshal(buf.Bytes(), &data)
+	if err != nil {
+		return videoProbe{}, err
+	}
+
+	var audioTracks []database.AudioTrack
+	hasDefault := false
+	for _, stream := range data.Streams {
+		if stream.CodecType != "audio" {
+			continue
+		}
+		language := stream.Tags.Language
+		if language == "und" {
+			language = ""
+		}
+		audioTracks = append(audioTracks, database.AudioTrack{
+			Index:    len(audioTracks),
+			Language: language,
+			Label:    stream.Tags.Title,
+			Codec:    stream.CodecName,
+			Channels: stream.Channels,
+			Default:  stream.Disposition.Default == 1 && !hasDefault,
+		})
+		hasDefault = hasDefault || stream.Disposition.Default == 1
+	}
+	// Players need exactly one default, and the first track is the one a
+	// player without track selection plays.
+	if len(audioTracks) > 0 && !hasDefault {
+		audioTracks[0].Default = true
+	}
+	for _, stream := range data.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+		probe := videoProbe{
+			Width:             stream.Width,
+			Height:            stream.Height,
+			FrameRate:         parseFrameRate(stream.AvgFrameRate),
+			Codec:             stream.CodecName,
+			HasAudio:          len(audioTracks) > 0,
+			AudioTracks:       audioTracks,
+			HDR:               hdrFormat(stream.ColorTransfer),
+			VariableFrameRate: isVariableFrameRate(parseFrameRate(stream.RFrameRate), parseFrameRate(stream.AvgFrameRate)),
+		}
+		for _, sideData := range stream.SideDataList {
+			if sideData.SideDataType == "Spherical Mapping" && sideData.Projection != "" {
+				probe.Projection = strings.ReplaceAll(strings.ToLower(sideData.Projection), " ", "_")
+			}
+		}
+		probe.DurationSeconds, _ = strconv.ParseFloat(data.Format.Duration, 64)
+		probe.Bitrate, _ = strconv.ParseInt(data.Format.BitRate, 10, 64)
+		if probe.Width == 0 || probe.Height == 0 {
+			return videoProbe{}, errors.New("Missing video dimensions")
+		}
+		return probe, nil
+	}
+	return videoProbe{}, errors.New("Missing video stream data")
+}
+
+// parseFrameRate converts ffprobe's rational frame rates such as
+// "30000/1001" into frames per second.
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(rate, 64)
+		return f
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// aspect buckets a video into the orientations we store videos under. This
+// is not the ideal way to determine aspect ratio, but for this demo it is
+// sufficient.
+func (p videoProbe) aspect() database.Aspect {
+	result := float64(p.Width) / float64(p.Height)
+	switch {
+	case result < 1.0:
+		return database.AspectPortrait
+	case result > 1.0 && result < 2.0:
+		return database.AspectLandscape
+	default:
+		return database.AspectOther
+	}
+}
+
+// fileMetadata is written into processed MP4s so that downloaded files
+// carry where they came from. Empty fields are left out.
+type fileMetadata struct {
+	Title     string
+	Artist    string
+	Comment   string
+	CreatedAt time.Time
+}
+
+// args are the ffmpeg options that set the tags, overriding any the
+// uploaded file had.
+func (m fileMetadata) args() []string {
+	tags := [][2]string{
+		{"title", m.Title},
+		{"artist", m.Artist},
+		{"comment", m.Comment},
+	}
+	if !m.CreatedAt.IsZero() {
+		tags = append(tags, [2]string{"creation_time", m.CreatedAt.UTC().Format(time.RFC3339)})
+	}
+	var args []string
+	for _, tag := range tags {
+		if tag[1] != "" {
+			args = append(args, "-metadata", tag[0]+"="+tag[1])
+		}
+	}
+	return args
+}
+
+// Container profiles choose how processed MP4s are written.
+const (
+	// containerProfileProgressive is a regular MP4 with its index moved to
+	// the front, so it can start playing before it's fully downloaded.
+	containerProfileProgressive = "progressive"
+	// containerProfileFMP4 is a fragmented MP4, cut at keyframes, which
+	// suits streaming players and Media Source Extensions.
+	containerProfileFMP4 = "fmp4"
+	// containerProfileCMAF is a fragmented MP4 that follows CMAF, so the
+	// same file can back both HLS and DASH.
+	containerProfileCMAF = "cmaf"
+)
+
+// containerMovFlags are the mp4 muxer flags each container profile is
+// written with.
+var containerMovFlags = map[string]string{
+	containerProfileProgressive: "faststart",
+	containerProfileFMP4:        "frag_keyframe+empty_moov+default_base_moof",
+	containerProfileCMAF:        "cmaf+frag_keyframe+empty_moov+default_base_moof",
+}
+
+// remuxVideo copies a video's streams into a new MP4 written with the given
+// container profile and tagged with metadata. The first video stream and
+// every audio stream are kept, along with 360° projection metadata.
+func remuxVideo(ctx context.Context, ffmpegPath, filePath, profile string, metadata fileMetadata) (string, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg remux", tracing.KindInternal)
+	defer span.End()
+	movFlags, ok := containerMovFlags[profile]
+	if !ok {
+		return "", fmt.Errorf("unknown container profile %q", profile)
+	}
+	outputPath := filePath + ".processing"
+	args := []string{"-i", filePath, "-map", "0:v:0", "-map", "0:a?", "-c", "copy"}
+	args = append(args, metadata.args()...)
+	// The mp4 muxer only writes spherical video boxes (sv3d and st3d), which
+	// aren't part of the MP4 standard, when unofficial extensions are
+	// allowed; otherwise 360° videos come out flat.
+	args = append(args, "-strict", "unofficial", "-movflags", movFlags, "-f", "mp4", outputPath)
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	err := runCommand(cmd)
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+
+	return outputPath, nil
+}
+
+// hlsKeyInfo is the AES-128 key HLS segments are encrypted with and the URI
+// players fetch it from.
+type hlsKeyInfo struct {
+	URI string
+	Key []byte
+}
+
+// packageHLS segments a video into a VOD playlist and MPEG-TS segments in a
+// new directory, which the caller must remove. Streams are copied, not
+// re-encoded. With keyInfo, segments are AES-128 encrypted.
+//
+// With more than one audio track, the first stays in the main playlist with
+// the video and each of the others gets an audio-only playlist of its own,
+// named by hlsAudioPlaylistName, for the master playlist to offer as an
+// alternative.
+func packageHLS(ctx context.Context, ffmpegPath, filePath string, keyInfo *hlsKeyInfo, audioTracks int) (string, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg hls", tracing.KindInternal)
+	defer span.End()
+
+	dir, err := os.MkdirTemp(filepath.Dir(filePath), "hls-")
+	if err != nil {
+		return "", err
+	}
+	playlist := filepath.Join(dir, hlsPlaylistName)
+	segments := filepath.Join(dir, "segment%04d.ts")
+	args := []string{"-i", filePath}
+	if audioTracks > 1 {
+		args = append(args, "-map", "0:v:0")
+		variants := []string{"v:0,a:0,name:" + strings.TrimSuffix(hlsPlaylistName, ".m3u8")}
+		for i := range audioTracks {
+			args = append(args, "-map", fmt.Sprintf("0:a:%d", i))
+			if i > 0 {
+				variants = append(variants, fmt.Sprintf("a:%d,name:%s", i, strings.TrimSuffix(hlsAudioPlaylistName(i), ".m3u8")))
+			}
+		}
+		args = append(args, "-var_stream_map", strings.Join(variants, " "))
+		playlist = filepath.Join(dir, "%v.m3u8")
+		segments = filepath.Join(dir, "%v_%04d.ts")
+	}
+	args = append(args,
+		"-c", "copy",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", segments,
+	)
+	if keyInfo != nil {
+		// The key files are kept out of dir so they're never uploaded.
+		infoPath, err := writeHLSKeyInfo(filepath.Dir(filePath), keyInfo)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		defer os.Remove(infoPath)
+		defer os.Remove(infoPath + ".key")
+		args = append(args, "-hls_key_info_file", infoPath)
+	}
+	args = append(args, playlist)
+
+	if err := runCommand(exec.CommandContext(ctx, ffmpegPath, args...)); err != nil {
+		span.RecordError(err)
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// writeHLSKeyInfo writes the key, and the key info file ffmpeg reads it
+// through, into dir. The key is at the returned path plus ".key".
+func writeHLSKeyInfo(dir string, keyInfo *hlsKeyInfo) (string, error) {
+	info, err := os.CreateTemp(dir, "hls-*.keyinfo")
+	if err != nil {
+		return "", err
+	}
+	keyPath := info.Name() + ".key"
+	if err := os.WriteFile(keyPath, keyInfo.Key, 0o600); err != nil {
+		info.Close()
+		os.Remove(info.Name())
+		return "", err
+	}
+	_, err = fmt.Fprintf(info, "%s\n%s\n", keyInfo.URI, keyPath)
+	if cerr := info.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(info.Name())
+		os.Remove(keyPath)
+		return "", err
+	}
+	return info.Name(), nil
+}
+
+// sampleFrames extracts up to count JPEG frames spread evenly across a video
+// into a new directory beside it, which the caller must remove.
+func sampleFrames(ctx context.Context, ffmpegPath, filePath string, durationSeconds float64, count int) (dir string, frames []string, err error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg sample frames", tracing.KindInternal)
+	defer span.End()
+	dir, err = os.MkdirTemp(filepath.Dir(filePath), "frames-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	rate := "1"
+	if durationSeconds > 0 {
+		rate = strconv.FormatFloat(float64(count)/durationSeconds, 'f', -1, 64)
+	}
+	cmd := exec.CommandContext(ctx,
+		ffmpegPath, "-i", filePath,
+		"-vf", "fps="+rate+",scale=512:-2",
+		"-frames:v", strconv.Itoa(count),
+		"-q:v", "4",
+		filepath.Join(dir, "frame%03d.jpg"),
+	)
+	if err := runCommand(cmd); err != nil {
+		span.RecordError(err)
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	frames, err = filepath.Glob(filepath.Join(dir, "frame*.jpg"))
+	if err == nil && len(frames) == 0 {
+		err = errors.New("no frames sampled")
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return dir, frames, nil
+}
+
+// Formats HEIC thumbnails can be converted to.
+const (
+	thumbnailFormatJPEG = "jpeg"
+	thumbnailFormatWebP = "webp"
+)
+
+// convertImage converts the first image in a file, such as the primary
+// image of a HEIC photo, to format beside it, returning the new file's path.
+// HEIC photos from phones are stored as a grid of tiles, which needs ffmpeg
+// 7.1 or later to reassemble.
+func convertImage(ctx context.Context, ffmpegPath, filePath, format string) (string, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg convert image", tracing.KindInternal)
+	defer span.End()
+
+	outputPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "." + format
+	args := []string{"-i", filePath, "-frames:v", "1"}
+	switch format {
+	case thumbnailFormatWebP:
+		args = append(args, "-c:v", "libwebp", "-quality", "85")
+	default:
+		args = append(args, "-q:v", "2")
+	}
+	args = append(args, "-y", outputPath)
+
+	if err := runCommand(exec.CommandContext(ctx, ffmpegPath, args...)); err != nil {
+		span.RecordError(err)
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// Quality metrics scoreQuality can compute.
+const (
+	qualityMetricVMAF = "vmaf"
+	qualityMetricSSIM = "ssim"
+)
+
+// qualityScores are how close a rendition is to its source, averaged over
+// its frames. Metrics that weren't computed are nil.
+type qualityScores struct {
+	VMAF *float64
+	SSIM *float64
+}
+
+// scoreQuality compares a rendition with the file it was made from in one
+// ffmpeg run. The rendition is scaled to width x height, the source's size,
+// since VMAF and SSIM compare frames pixel for pixel.
+func scoreQuality(ctx context.Context, ffmpegPath, renditionPath, sourcePath string, width, height int, metrics []string) (qualityScores, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg quality score", tracing.KindInternal)
+	defer span.End()
+	dir, err := os.MkdirTemp(filepath.Dir(renditionPath), "quality-")
+	if err != nil {
+		return qualityScores{}, err
+	}
+	defer os.RemoveAll(dir)
+	vmafLog := filepath.Join(dir, "vmaf.json")
+	ssimLog := filepath.Join(dir, "ssim.log")
+
+	distorted := fmt.Sprintf("[0:v]scale=%d:%d:flags=bicubic,setpts=PTS-STARTPTS,split=%d", width, height, len(metrics))
+	reference := fmt.Sprintf("[1:v]setpts=PTS-STARTPTS,split=%d", len(metrics))
+	var comparisons []string
+	for i, metric := range metrics {
+		distorted += fmt.Sprintf("[d%d]", i)
+		reference += fmt.Sprintf("[r%d]", i)
+		switch metric {
+		case qualityMetricVMAF:
+			comparisons = append(comparisons, fmt.Sprintf("[d%d][r%d]libvmaf=log_fmt=json:log_path=%s", i, i, vmafLog))
+		case qualityMetricSSIM:
+			comparisons = append(comparisons, fmt.Sprintf("[d%d][r%d]ssim=stats_file=%s", i, i, ssimLog))
+		default:
+			return qualityScores{}, fmt.Errorf("unknown quality metric %q", metric)
+		}
+	}
+	graph := strings.Join(append([]string{distorted, reference}, comparisons...), ";")
+
+	cmd := exec.CommandContext(ctx,
+		ffmpegPath, "-i", renditionPath, "-i", sourcePath,
+		"-lavfi", graph,
+		"-f", "null", "-",
+	)
+	if err := runCommand(cmd); err != nil {
+		span.RecordError(err)
+		return qualityScores{}, err
+	}
+
+	var scores qualityScores
+	for _, metric := range metrics {
+		var score float64
+		switch metric {
+		case qualityMetricVMAF:
+			score, err = readVMAFLog(vmafLog)
+			scores.VMAF = &score
+		case qualityMetricSSIM:
+			score, err = readSSIMLog(ssimLog)
+			scores.SSIM = &score
+		}
+		if err != nil {
+			span.RecordError(err)
+			return qualityScores{}, fmt.Errorf("couldn't read %s score: %w", metric, err)
+		}
+	}
+	return scores, nil
+}
+
+// readVMAFLog returns the mean VMAF from a libvmaf JSON log.
+func readVMAFLog(path string) (float64, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var log struct {
+		PooledMetrics struct {
+			VMAF struct {
+				Mean *float64 `json:"mean"`
+			} `json:"vmaf"`
+		} `json:"pooled_metrics"`
+	}
+	if err := json.Unmarshal(dat, &log); err != nil {
+		return 0, err
+	}
+	if log.PooledMetrics.VMAF.Mean == nil {
+		return 0, errors.New("no pooled vmaf score")
+	}
+	return *log.PooledMetrics.VMAF.Mean, nil
+}
+
+// readSSIMLog averages the combined SSIM of every frame in an ssim stats
+// file, whose lines look like "n:1 Y:0.99 U:0.98 V:0.98 All:0.987 (18.9)".
+func readSSIMLog(path string) (float64, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	var frames int
+	for _, line := range strings.Split(string(dat), "\n") {
+		for _, field := range strings.Fields(line) {
+			value, ok := strings.CutPrefix(field, "All:")
+			if !ok {
+				continue
+			}
+			score, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid ssim line %q", line)
+			}
+			total += score
+			frames++
+		}
+	}
+	if frames == 0 {
+		return 0, errors.New("no frames scored")
+	}
+	return total / float64(frames), nil
+}
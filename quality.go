@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// scoreRendition scores a rendition's file against the upload it was made
+// from, if quality scoring is on. The scores are only used to tune encoding
+// presets, so a failure is logged rather than failing processing.
+func (cfg *apiConfig) scoreRendition(ctx context.Context, videoID uuid.UUID, rendition *database.Rendition, path, sourcePath string, probe videoProbe) {
+	if len(cfg.qualityMetrics) == 0 {
+		return
+	}
+	scores, err := scoreQuality(ctx, cfg.ffmpegPath, path, sourcePath, probe.Width, probe.Height, cfg.qualityMetrics)
+	if err != nil {
+		slog.WarnContext(ctx, "Couldn't score rendition quality", "video_id", videoID, "quality", rendition.Quality, "error", err)
+		return
+	}
+	rendition.VMAF = scores.VMAF
+	rendition.SSIM = scores.SSIM
+}
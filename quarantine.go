@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// quarantineReasonContentScan marks files quarantined by automated content
+// scanning.
+const quarantineReasonContentScan = "content_scan"
+
+// recordQuarantinedFile records a video file stored in quarantine for
+// review. A file of the same video still awaiting review is deleted, as the
+// newer upload replaces it.
+func (cfg *apiConfig) recordQuarantinedFile(ctx context.Context, params database.QuarantineObjectParams) error {
+	existing, err := cfg.db.GetQuarantinedObject(ctx, params.VideoID)
+	if err != nil {
+		return fmt.Errorf("couldn't get quarantined file: %w", err)
+	}
+	if existing != nil && existing.Status == database.QuarantinePending && existing.Key != params.Key {
+		if err := cfg.deleteQuarantinedFile(ctx, *existing); err != nil {
+			return fmt.Errorf("couldn't delete replaced quarantined file: %w", err)
+		}
+	}
+
+	if _, err := cfg.db.QuarantineObject(ctx, params); err != nil {
+		return fmt.Errorf("couldn't record quarantined file: %w", err)
+	}
+	slog.InfoContext(ctx, "Quarantined video file", "video_id", params.VideoID, "bucket", params.Bucket, "key", params.Key, "reason", params.Reason)
+	return nil
+}
+
+func (cfg *apiConfig) deleteQuarantinedFile(ctx context.Context, q database.QuarantinedObject) error {
+	_, err := cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &q.Bucket,
+		Key:    &q.Key,
+	})
+	return err
+}
+
+// abandonQuarantinedFile removes a file written to quarantine by processing
+// that then failed. The pending upload only tracks the serving path, so
+// the reconciler wouldn't find it.
+func (cfg *apiConfig) abandonQuarantinedFile(ctx context.Context, quarantine bool, bucket, key string) {
+	if !quarantine {
+		return
+	}
+	if err := cfg.deleteQuarantinedFile(ctx, database.QuarantinedObject{Bucket: bucket, Key: key}); err != nil {
+		slog.ErrorContext(ctx, "Couldn't delete abandoned quarantine file", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// quotaLimits are a user's upload limits. Zero means unlimited.
+type quotaLimits struct {
+	StorageBytes int64 `json:"storage_bytes"`
+	VideosPerDay int   `json:"videos_per_day"`
+}
+
+// quotaStatus is a user's limits and how much of them they've used. The
+// daily video count resets at midnight UTC.
+type quotaStatus struct {
+	Limits     quotaLimits        `json:"limits"`
+	Usage      database.UserUsage `json:"usage"`
+	Overridden bool               `json:"overridden"`
+	ResetsAt   time.Time          `json:"resets_at"`
+}
+
+func (cfg *apiConfig) quotaStatus(ctx context.Context, userID uuid.UUID) (quotaStatus, error) {
+	status := quotaStatus{Limits: cfg.quotas}
+	override, err := cfg.db.GetUserQuota(ctx, userID)
+	if err != nil {
+		return quotaStatus{}, err
+	}
+	if override != nil {
+		status.Overridden = true
+		if override.StorageBytes != nil {
+			status.Limits.StorageBytes = *override.StorageBytes
+		}
+		if override.VideosPerDay != nil {
+			status.Limits.VideosPerDay = *override.VideosPerDay
+		}
+	}
+
+	dayStart := time.Now().UTC().Truncate(24 * time.Hour)
+	status.ResetsAt = dayStart.Add(24 * time.Hour)
+	status.Usage, err = cfg.db.GetUserUsage(ctx, userID, dayStart)
+	if err != nil {
+		return quotaStatus{}, err
+	}
+	return status, nil
+}
+
+// storageRemaining is how many more bytes the user may store, or -1 if
+// their storage is unlimited.
+func (s quotaStatus) storageRemaining() int64 {
+	if s.Limits.StorageBytes == 0 {
+		return -1
+	}
+	return max(s.Limits.StorageBytes-s.Usage.StorageBytes, 0)
+}
+
+// quotaDetails describes a user's quota in an error response.
+func quotaDetails(s quotaStatus) map[string]any {
+	return map[string]any{
+		"limits":    s.Limits,
+		"usage":     s.Usage,
+		"resets_at": s.ResetsAt,
+	}
+}
+
+// setQuotaHeaders reports a user's quota on a response, so scripts can see
+// how close they are without asking for it. Limit headers are left out for
+// unlimited quotas.
+func setQuotaHeaders(w http.ResponseWriter, s quotaStatus) {
+	h := w.Header()
+	h.Set("X-Quota-Storage-Used", strconv.FormatInt(s.Usage.StorageBytes, 10))
+	if s.Limits.StorageBytes > 0 {
+		h.Set("X-Quota-Storage-Limit", strconv.FormatInt(s.Limits.StorageBytes, 10))
+	}
+	h.Set("X-Quota-Videos-Used", strconv.Itoa(s.Usage.VideosToday))
+	if s.Limits.VideosPerDay > 0 {
+		h.Set("X-Quota-Videos-Limit", strconv.Itoa(s.Limits.VideosPerDay))
+	}
+	h.Set("X-Quota-Reset", strconv.FormatInt(s.ResetsAt.Unix(), 10))
+}
+
+// dailyVideosExhausted reports whether the user has created as many
+// videos today as they're allowed.
+func (s quotaStatus) dailyVideosExhausted() bool {
+	return s.Limits.VideosPerDay > 0 && s.Usage.VideosToday >= s.Limits.VideosPerDay
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rateLimiter allows each user a number of requests per fixed window. The
+// counts are kept in memory, so each instance limits separately.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	windows   map[uuid.UUID]*rateWindow
+	nextSweep time.Time
+}
+
+type rateWindow struct {
+	resetsAt time.Time
+	count    int
+}
+
+// newRateLimiter returns a limiter allowing limit requests per window, or
+// nil if limit is zero, which means unlimited.
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	if limit <= 0 || window <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: map[uuid.UUID]*rateWindow{},
+	}
+}
+
+// take counts a request by userID. It returns how many requests remain in
+// the current window and when the window resets, and reports false if the
+// user is over the limit.
+func (l *rateLimiter) take(userID uuid.UUID, now time.Time) (remaining int, resetsAt time.Time, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Windows of users who've gone quiet are dropped once they've expired.
+	if now.After(l.nextSweep) {
+		for id, w := range l.windows {
+			if !now.Before(w.resetsAt) {
+				delete(l.windows, id)
+			}
+		}
+		l.nextSweep = now.Add(l.window)
+	}
+
+	w := l.windows[userID]
+	if w == nil || !now.Before(w.resetsAt) {
+		w = &rateWindow{resetsAt: now.Add(l.window)}
+		l.windows[userID] = w
+	}
+	if w.count >= l.limit {
+		return 0, w.resetsAt, false
+	}
+	w.count++
+	return l.limit - w.count, w.resetsAt, true
+}
+
+// middleware limits requests made with a valid access token, and tells
+// clients where they stand with X-RateLimit-Limit, X-RateLimit-Remaining,
+// and X-RateLimit-Reset (Unix seconds) on every response. Anonymous requests
+// aren't limited.
+func (l *rateLimiter) middleware(next http.Handler, userID func(*http.Request) uuid.UUID) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := userID(r)
+		if id == uuid.Nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+		remaining, resetsAt, ok := l.take(id, now)
+		h := w.Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(l.limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(resetsAt.Unix(), 10))
+		if !ok {
+			h.Set("Retry-After", retryAfterSeconds(resetsAt.Sub(now)))
+			respondWithError(w, http.StatusTooManyRequests, "Too many requests, slow down", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
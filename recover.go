@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// errorReporter forwards crashes to an error tracking service.
+type errorReporter interface {
+	Report(ctx context.Context, err error, stack []byte, r *http.Request)
+}
+
+// recoverMiddleware turns a panicking handler into a 500 response carrying
+// the request ID, logs the stack, and passes it to reporter if there is one.
+// If the handler had already started its response, the connection is
+// closed instead so the client can't mistake a truncated body for a whole
+// one.
+func recoverMiddleware(next http.Handler, reporter errorReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// ErrAbortHandler is net/http's way of aborting a response on
+			// purpose; let the server handle it as usual.
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			err, ok := v.(error)
+			if !ok {
+				err = fmt.Errorf("%v", v)
+			}
+			err = fmt.Errorf("panic: %w", err)
+			stack := debug.Stack()
+
+			slog.ErrorContext(r.Context(), "Handler panicked", "method", r.Method, "path", r.URL.Path, "error", err, "stack", string(stack))
+			if reporter != nil {
+				reporter.Report(context.WithoutCancel(r.Context()), err, stack, r)
+			}
+
+			if rec.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			respondWithError(rec, http.StatusInternalServerError, "Internal server error", errors.Unwrap(err))
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// resumableUploadPartSize is how the file is split. Every part but the
+	// last must be this size, and S3 needs at least 5MB.
+	resumableUploadPartSize = 16 << 20
+	// resumableUploadTTL is how long an upload can sit unfinished before
+	// its parts are thrown away.
+	resumableUploadTTL = 24 * time.Hour
+	// resumableUploadPrefix is where parts are assembled in the bucket
+	// before the file is processed.
+	resumableUploadPrefix = "uploads/"
+)
+
+// resumableUploadClaimTimeout is how long a request can hold an upload
+// while completing or aborting it. It's longer than the default
+// UPLOAD_TIMEOUT, so an older claim belongs to a request that died, and
+// the upload can be completed again.
+const resumableUploadClaimTimeout = 2 * time.Hour
+
+// resumableUploadStaleBefore is when a claim still in force was made.
+func resumableUploadStaleBefore() time.Time {
+	return time.Now().UTC().Add(-resumableUploadClaimTimeout)
+}
+
+func resumableUploadPartCount(u database.ResumableUpload) int32 {
+	return int32((u.SizeBytes + resumableUploadPartSize - 1) / resumableUploadPartSize)
+}
+
+// resumableUploadPartLength is the size part n must be.
+func resumableUploadPartLength(u database.ResumableUpload, n int32) int64 {
+	if n < resumableUploadPartCount(u) {
+		return resumableUploadPartSize
+	}
+	return u.SizeBytes - int64(n-1)*resumableUploadPartSize
+}
+
+// resumableUploadCompletedParts lists the parts in order, or reports false
+// if one is missing.
+func resumableUploadCompletedParts(u database.ResumableUpload) ([]types.CompletedPart, bool) {
+	count := resumableUploadPartCount(u)
+	if int32(len(u.Parts)) != count {
+		return nil, false
+	}
+	parts := make([]types.CompletedPart, 0, count)
+	for n := int32(1); n <= count; n++ {
+		etag, ok := u.Parts[n]
+		if !ok {
+			return nil, false
+		}
+		parts = append(parts, types.CompletedPart{PartNumber: aws.Int32(n), ETag: aws.String(etag)})
+	}
+	return parts, true
+}
+
+type resumableUploadResponse struct {
+	ID            uuid.UUID `json:"id"`
+	VideoID       uuid.UUID `json:"video_id"`
+	SizeBytes     int64     `json:"size_bytes"`
+	PartSize      int64     `json:"part_size"`
+	PartCount     int32     `json:"part_count"`
+	ReceivedParts []int32   `json:"received_parts"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func newResumableUploadResponse(u database.ResumableUpload) resumableUploadResponse {
+	received := make([]int32, 0, len(u.Parts))
+	for n := range u.Parts {
+		received = append(received, n)
+	}
+	sort.Slice(received, func(i, j int) bool { return received[i] < received[j] })
+	return resumableUploadResponse{
+		ID:            u.ID,
+		VideoID:       u.VideoID,
+		SizeBytes:     u.SizeBytes,
+		PartSize:      resumableUploadPartSize,
+		PartCount:     resumableUploadPartCount(u),
+		ReceivedParts: received,
+		ExpiresAt:     u.ExpiresAt,
+	}
+}
+
+// handlerResumableUploadCreate starts a resumable upload of a video's file.
+// The client then PUTs each part and completes the upload, which queues the
+// file for processing like a regular upload.
+func (cfg *apiConfig) handlerResumableUploadCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		SizeBytes   int64  `json:"size_bytes"`
+		ContentType string `json:"content_type"`
+	}
+
+	video, userID, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectBanned(r.Context(), w, userID) || cfg.rejectSuspended(r.Context(), w, userID) {
+		return
+	}
+	if rejectLive(w, video) {
+		return
+	}
+	var params parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.ContentType != "video/mp4" {
+		respondWithErrorCode(w, http.StatusBadRequest, errCodeUnsupportedMediaType, "only video/mp4 mimetype accepted", nil, videoMediaTypeDetails)
+		return
+	}
+	if params.SizeBytes <= 0 {
+		respondWithError(w, http.StatusBadRequest, "size_bytes must be positive", nil)
+		return
+	}
+	if params.SizeBytes > cfg.maxVideoUploadBytes {
+		cfg.respondVideoTooLarge(w, nil)
+		return
+	}
+
+	// The size is checked against the quota up front, so a client isn't
+	// left with an upload it can never complete.
+	quota, err := cfg.quotaStatus(r.Context(), video.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to get quota", err)
+		return
+	}
+	setQuotaHeaders(w, quota)
+	storageRemaining := quota.storageRemaining()
+	if storageRemaining >= 0 && video.SizeBytes != nil {
+		storageRemaining += *video.SizeBytes
+	}
+	if storageRemaining >= 0 && params.SizeBytes > storageRemaining {
+		respondWithErrorCode(w, http.StatusForbidden, errCodeQuotaExceeded, "upload would exceed storage quota", nil, quotaDetails(quota))
+		return
+	}
+
+	randBuf := make([]byte, 32)
+	if _, err := rand.Read(randBuf); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start upload", err)
+		return
+	}
+	key := resumableUploadPrefix + base64.RawURLEncoding.EncodeToString(randBuf) + ".mp4"
+	out, err := cfg.s3Client.CreateMultipartUpload(r.Context(), &s3.CreateMultipartUploadInput{
+		Bucket:      &cfg.s3Bucket,
+		Key:         &key,
+		ContentType: aws.String("video/mp4"),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start upload", err)
+		return
+	}
+
+	// If the server stops before the upload is recorded, it's aborted by
+	// abortAbandonedMultipartUploads once it's too old to be in use.
+	now := time.Now().UTC()
+	upload := database.ResumableUpload{
+		ID:         uuid.New(),
+		VideoID:    video.ID,
+		UserID:     userID,
+		S3Key:      key,
+		S3UploadID: *out.UploadId,
+		SizeBytes:  params.SizeBytes,
+		ExpiresAt:  now.Add(resumableUploadTTL),
+		CreatedAt:  now,
+	}
+	if err := cfg.db.CreateResumableUpload(r.Context(), upload); err != nil {
+		if err := cfg.abortResumableUpload(context.WithoutCancel(r.Context()), upload); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't abort unrecorded upload", "key", key, "error", err)
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start upload", err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/videos/%s/uploads/%s", cfg.baseURL, apiVersionPrefix, video.ID, upload.ID))
+	respondWithJSON(w, http.StatusCreated, newResumableUploadResponse(upload))
+}
+
+// getResumableUpload finds the upload named in the path, which only the
+// user who started it can see, with the parts it has received.
+func (cfg *apiConfig) getResumableUpload(w http.ResponseWriter, r *http.Request) (database.ResumableUpload, bool) {
+	video, userID, ok := cfg.getEditableVideo(w, r)
+	if !ok {
+		return database.ResumableUpload{}, false
+	}
+	id, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload ID", err)
+		return database.ResumableUpload{}, false
+	}
+	upload, err := cfg.db.GetResumableUpload(r.Context(), id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return database.ResumableUpload{}, false
+	}
+	if upload == nil || upload.VideoID != video.ID || upload.UserID != userID || time.Now().After(upload.ExpiresAt) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find upload", nil)
+		return database.ResumableUpload{}, false
+	}
+	return *upload, true
+}
+
+// handlerResumableUploadGet reports which parts have been received, so a
+// client can resume by sending the rest.
+func (cfg *apiConfig) handlerResumableUploadGet(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.getResumableUpload(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newResumableUploadResponse(upload))
+}
+
+// handlerResumableUploadPart stores one part. Sending a part again replaces
+// it.
+func (cfg *apiConfig) handlerResumableUploadPart(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.getResumableUpload(w, r)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(r.PathValue("part"))
+	if err != nil || n < 1 || n > int(resumableUploadPartCount(upload)) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("part must be between 1 and %d", resumableUploadPartCount(upload)), err)
+		return
+	}
+	part := int32(n)
+	size := resumableUploadPartLength(upload, part)
+	if r.ContentLength != size {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Part %d must be %d bytes", part, size), nil)
+		return
+	}
+
+	// Parts are small enough to buffer, and S3 needs a body it can rewind
+	// to sign.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, size))
+	if err != nil {
+		cfg.respondUploadReadError(w, "Couldn't read part", err)
+		return
+	}
+	if int64(len(body)) != size {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Part %d must be %d bytes", part, size), nil)
+		return
+	}
+	out, err := cfg.s3Client.UploadPart(r.Context(), &s3.UploadPartInput{
+		Bucket:        &cfg.s3Bucket,
+		Key:           &upload.S3Key,
+		UploadId:      &upload.S3UploadID,
+		PartNumber:    aws.Int32(part),
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store part", err)
+		return
+	}
+	recorded, err := cfg.db.RecordResumableUploadPart(r.Context(), upload.ID, part, aws.ToString(out.ETag), resumableUploadStaleBefore())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record part", err)
+		return
+	}
+	if !recorded {
+		respondWithError(w, http.StatusConflict, "Upload is already being completed", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerResumableUploadComplete assembles the parts and queues the file
+// for processing. It answers like a regular upload.
+func (cfg *apiConfig) handlerResumableUploadComplete(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.getResumableUpload(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectBanned(r.Context(), w, upload.UserID) || cfg.rejectSuspended(r.Context(), w, upload.UserID) {
+		return
+	}
+	containerProfile, ok := cfg.requestedContainerProfile(w, r)
+	if !ok {
+		return
+	}
+	claimed, err := cfg.db.ClaimResumableUpload(r.Context(), upload.ID, resumableUploadStaleBefore())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't claim upload", err)
+		return
+	}
+	if !claimed {
+		respondWithJSON(w, http.StatusConflict, newResumableUploadResponse(upload))
+		return
+	}
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := cfg.db.ReleaseResumableUpload(context.WithoutCancel(r.Context()), upload.ID); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't release upload", "upload_id", upload.ID, "error", err)
+		}
+	}()
+
+	// Parts can't be recorded once the upload is claimed, so read them
+	// again now they're settled.
+	claimedUpload, err := cfg.db.GetResumableUpload(r.Context(), upload.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return
+	}
+	if claimedUpload == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find upload", nil)
+		return
+	}
+	upload = *claimedUpload
+	parts, ok := resumableUploadCompletedParts(upload)
+	if !ok {
+		respondWithJSON(w, http.StatusConflict, newResumableUploadResponse(upload))
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), upload.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to get video", err)
+		return
+	}
+	if rejectLive(w, video) {
+		return
+	}
+	assembled, err := cfg.completeResumableUpload(r.Context(), upload, parts)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't assemble upload", err)
+		return
+	}
+	if !assembled {
+		completed = true
+		respondWithError(w, http.StatusGone, "Upload was aborted", nil)
+		if err := cfg.db.DeleteResumableUpload(r.Context(), upload.ID); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't delete upload", "upload_id", upload.ID, "error", err)
+		}
+		return
+	}
+	// From here the parts are gone, so the upload is over whatever happens.
+	completed = true
+	defer func() {
+		ctx := context.WithoutCancel(r.Context())
+		if err := cfg.deleteS3Object(ctx, upload.S3Key); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't delete staged upload", "key", upload.S3Key, "error", err)
+		}
+		if err := cfg.db.DeleteResumableUpload(ctx, upload.ID); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't delete upload", "upload_id", upload.ID, "error", err)
+		}
+	}()
+
+	if !cfg.queueStagedUpload(w, r, video, cfg.s3Bucket, upload.S3Key, containerProfile) {
+		return
+	}
+
+	video, err = cfg.db.GetVideo(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, video)
+}
+
+// handlerResumableUploadAbort gives up on an upload and discards its parts.
+func (cfg *apiConfig) handlerResumableUploadAbort(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.getResumableUpload(w, r)
+	if !ok {
+		return
+	}
+	claimed, err := cfg.db.ClaimResumableUpload(r.Context(), upload.ID, resumableUploadStaleBefore())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't claim upload", err)
+		return
+	}
+	if !claimed {
+		respondWithError(w, http.StatusConflict, "Upload is already being completed", nil)
+		return
+	}
+	if err := cfg.discardResumableUpload(r.Context(), upload); err != nil {
+		if err := cfg.db.ReleaseResumableUpload(context.WithoutCancel(r.Context()), upload.ID); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't release upload", "upload_id", upload.ID, "error", err)
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't abort upload", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeResumableUpload assembles the parts. If S3 no longer knows the
+// upload but the assembled file is there, a request that died after
+// assembling it got this far, and the file is used. It reports false if
+// neither the upload nor the file exists.
+func (cfg *apiConfig) completeResumableUpload(ctx context.Context, upload database.ResumableUpload, parts []types.CompletedPart) (bool, error) {
+	_, err := cfg.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &cfg.s3Bucket,
+		Key:             &upload.S3Key,
+		UploadId:        &upload.S3UploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	var noSuchUpload *types.NoSuchUpload
+	if !errors.As(err, &noSuchUpload) {
+		return err == nil, err
+	}
+	return cfg.s3ObjectExists(ctx, upload.S3Key)
+}
+
+func (cfg *apiConfig) abortResumableUpload(ctx context.Context, upload database.ResumableUpload) error {
+	_, err := cfg.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &cfg.s3Bucket,
+		Key:      &upload.S3Key,
+		UploadId: &upload.S3UploadID,
+	})
+	var noSuchUpload *types.NoSuchUpload
+	if errors.As(err, &noSuchUpload) {
+		return nil
+	}
+	return err
+}
+
+// discardResumableUpload aborts an upload, deletes the file in case it was
+// assembled but never processed, and forgets the upload.
+func (cfg *apiConfig) discardResumableUpload(ctx context.Context, upload database.ResumableUpload) error {
+	if err := cfg.abortResumableUpload(ctx, upload); err != nil {
+		return err
+	}
+	if err := cfg.deleteS3Object(ctx, upload.S3Key); err != nil {
+		return err
+	}
+	return cfg.db.DeleteResumableUpload(ctx, upload.ID)
+}
+
+// abortExpiredUploads discards the parts of uploads that were never
+// completed, including those a request was completing when the server
+// stopped. Uploads that haven't expired are left for their clients to
+// resume.
+func (cfg *apiConfig) abortExpiredUploads(ctx context.Context) {
+	now := time.Now().UTC()
+	uploads, err := cfg.db.GetResumableUploadsExpiredBefore(ctx, now, resumableUploadStaleBefore())
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't list expired uploads", "error", err)
+		return
+	}
+	for _, upload := range uploads {
+		if err := cfg.discardResumableUpload(ctx, upload); err != nil {
+			slog.ErrorContext(ctx, "Couldn't abort expired upload", "upload_id", upload.ID, "video_id", upload.VideoID, "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Aborted expired upload", "upload_id", upload.ID, "video_id", upload.VideoID)
+	}
+	cfg.abortAbandonedMultipartUploads(ctx, now)
+}
+
+// abortAbandonedMultipartUploads aborts multipart uploads under
+// resumableUploadPrefix too old for any recorded upload to be using them,
+// such as one started just before the server stopped, so their parts don't
+// linger in the bucket.
+func (cfg *apiConfig) abortAbandonedMultipartUploads(ctx context.Context, now time.Time) {
+	cutoff := now.Add(-resumableUploadTTL - resumableUploadClaimTimeout)
+	prefix := resumableUploadPrefix
+	var keyMarker, uploadIDMarker *string
+	for {
+		out, err := cfg.s3Client.ListMultipartUploads(ctx, &s3.ListMultipartUploadsInput{
+			Bucket:         &cfg.s3Bucket,
+			Prefix:         &prefix,
+			KeyMarker:      keyMarker,
+			UploadIdMarker: uploadIDMarker,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't list multipart uploads", "error", err)
+			return
+		}
+		for _, u := range out.Uploads {
+			if u.Initiated == nil || u.Initiated.After(cutoff) {
+				continue
+			}
+			_, err := cfg.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   &cfg.s3Bucket,
+				Key:      u.Key,
+				UploadId: u.UploadId,
+			})
+			if err != nil {
+				slog.ErrorContext(ctx, "Couldn't abort abandoned multipart upload", "key", aws.ToString(u.Key), "error", err)
+				continue
+			}
+			slog.InfoContext(ctx, "Aborted abandoned multipart upload", "key", aws.ToString(u.Key))
+		}
+		if out.IsTruncated == nil || !*out.IsTruncated {
+			return
+		}
+		keyMarker, uploadIDMarker = out.NextKeyMarker, out.NextUploadIdMarker
+	}
+}
+
+// queueStagedUpload copies a file that was uploaded to bucket into the
+// uploads directory and queues it for processing like a regular upload. It
+// writes an error response and reports false if it can't.
+func (cfg *apiConfig) queueStagedUpload(w http.ResponseWriter, r *http.Request, video database.Video, bucket, key, containerProfile string) bool {
+	err := cfg.db.SetVideoStatus(r.Context(), video.ID, database.VideoStatusProcessing)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to update video status", err)
+		return false
+	}
+	queued := false
+	hadVideo := video.VideoURL != nil
+	defer func() {
+		if queued {
+			return
+		}
+		status := database.VideoStatusFailed
+		if hadVideo {
+			status = database.VideoStatusReady
+		}
+		if err := cfg.db.SetVideoStatus(context.WithoutCancel(r.Context()), video.ID, status); err != nil {
+			slog.ErrorContext(r.Context(), "Couldn't reset video status", "video_id", video.ID, "error", err)
+		}
+	}()
+
+	sourcePath, err := cfg.spoolStagedUpload(r.Context(), bucket, key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to copy file", err)
+		return false
+	}
+	defer func() {
+		if !queued {
+			os.Remove(sourcePath)
+		}
+	}()
+	if info, err := os.Stat(sourcePath); err == nil {
+		cfg.metrics.uploadSize.Observe(float64(info.Size()), "video")
+	}
+	if cfg.virusScanner != nil {
+		spooled, err := os.Open(sourcePath)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "unable to read file", err)
+			return false
+		}
+		clean := cfg.scanUpload(w, r, video.ID, spooled)
+		spooled.Close()
+		if !clean {
+			return false
+		}
+	}
+
+	_, err = cfg.db.CreateJob(r.Context(), database.CreateJobParams{
+		Type:        jobTypeProcessVideo,
+		VideoID:     &video.ID,
+		Payload:     processVideoPayload{SourcePath: sourcePath, HadVideo: hadVideo, ContainerProfile: containerProfile},
+		MaxAttempts: cfg.jobMaxAttempts,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "unable to queue processing", err)
+		return false
+	}
+	queued = true
+	return true
+}
+
+// spoolStagedUpload copies an assembled upload to the uploads directory,
+// where the processing job expects its source.
+func (cfg *apiConfig) spoolStagedUpload(ctx context.Context, bucket, key string) (string, error) {
+	obj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer obj.Body.Close()
+
+	sourceFile, err := os.CreateTemp(cfg.uploadsRoot, "upload-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(sourceFile, obj.Body); err != nil {
+		sourceFile.Close()
+		os.Remove(sourceFile.Name())
+		return "", err
+	}
+	if err := sourceFile.Close(); err != nil {
+		os.Remove(sourceFile.Name())
+		return "", err
+	}
+	return sourceFile.Name(), nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxRetentionDays bounds compliance mode's retention. Object Lock takes
+// longer, but a typo there can't be undone in COMPLIANCE mode.
+const maxRetentionDays = 100 * 365
+
+// uploadRetainUntil is when a file the user stores now can be deleted, or
+// nil if they aren't in compliance mode.
+func (cfg *apiConfig) uploadRetainUntil(ctx context.Context, userID uuid.UUID) (*time.Time, error) {
+	retention, err := cfg.db.GetUserRetention(ctx, userID)
+	if err != nil || retention == nil {
+		return nil, err
+	}
+	retainUntil := time.Now().UTC().Add(time.Duration(retention.RetentionDays) * 24 * time.Hour)
+	return &retainUntil, nil
+}
+
+// underRetention reports whether a video has files still under Object Lock,
+// so it can't be deleted yet.
+func underRetention(video database.Video) bool {
+	return video.RetainUntil != nil && time.Now().Before(*video.RetainUntil)
+}
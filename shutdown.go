@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// shutdownAbortGrace is how long requests and the running job get to clean
+// up after the drain window ends and they're cut off.
+const shutdownAbortGrace = 10 * time.Second
+
+// inflightRequests counts the requests being served, so shutdown can wait
+// for handlers to clean up after their connections are closed.
+type inflightRequests struct {
+	wg sync.WaitGroup
+}
+
+func (f *inflightRequests) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.wg.Add(1)
+		defer f.wg.Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shutdown stops the server, and the HTTP/3 server if there is one, in two
+// phases. For up to drain, new connections are refused while in-flight
+// requests and the running job finish. After that the remaining connections
+// are closed and the job is interrupted and requeued. An upload cut off
+// this way removes its spooled file and any pending S3 object, as a failed
+// upload does.
+func shutdown(srv *http.Server, h3Srv *http3.Server, inflight *inflightRequests, workerDone <-chan struct{}, abortJobs context.CancelCauseFunc, drain time.Duration) {
+	slog.Info("Shutting down, draining in-flight work", "drain_timeout", drain)
+
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	h3Done := make(chan struct{})
+	go func() {
+		defer close(h3Done)
+		if h3Srv != nil && h3Srv.Shutdown(ctx) != nil {
+			h3Srv.Close()
+		}
+	}()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("Drain window ended with requests in flight, closing them", "error", err)
+		srv.Close()
+	}
+	<-h3Done
+	select {
+	case <-workerDone:
+	case <-ctx.Done():
+		slog.Warn("Drain window ended with a job running, interrupting it")
+	}
+	abortJobs(errShuttingDown)
+
+	grace, cancel := context.WithTimeout(context.Background(), shutdownAbortGrace)
+	defer cancel()
+	requestsDone := make(chan struct{})
+	go func() {
+		inflight.wg.Wait()
+		close(requestsDone)
+	}()
+	for _, done := range []<-chan struct{}{requestsDone, workerDone} {
+		select {
+		case <-done:
+		case <-grace.Done():
+			slog.Warn("Gave up waiting for interrupted work to clean up")
+			return
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	// sitemapURLLimit is the most URLs a sitemap file may list.
+	sitemapURLLimit = 50000
+	// sitemapMaxAge bounds how long a cached sitemap is served, so changes
+	// made on another instance are picked up.
+	sitemapMaxAge = time.Hour
+	// sitemapDescriptionLimit is the longest description search engines
+	// accept, in characters.
+	sitemapDescriptionLimit = 2048
+)
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	NS      string       `xml:"xmlns,attr"`
+	VideoNS string       `xml:"xmlns:video,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string        `xml:"loc"`
+	LastMod string        `xml:"lastmod"`
+	Video   *sitemapVideo `xml:"video:video,omitempty"`
+}
+
+type sitemapVideo struct {
+	ThumbnailLoc    string   `xml:"video:thumbnail_loc"`
+	Title           string   `xml:"video:title"`
+	Description     string   `xml:"video:description"`
+	ContentLoc      string   `xml:"video:content_loc,omitempty"`
+	PlayerLoc       string   `xml:"video:player_loc"`
+	Duration        int      `xml:"video:duration,omitempty"`
+	PublicationDate string   `xml:"video:publication_date"`
+	Tags            []string `xml:"video:tag,omitempty"`
+}
+
+// sitemapCache holds the rendered sitemap. It's rebuilt on the next request
+// after a video is published or removed, or once it's sitemapMaxAge old.
+type sitemapCache struct {
+	mu      sync.Mutex
+	body    []byte
+	builtAt time.Time
+	stale   bool
+}
+
+// invalidate has the sitemap rebuilt on its next request.
+func (s *sitemapCache) invalidate() {
+	s.mu.Lock()
+	s.stale = true
+	s.mu.Unlock()
+}
+
+// get returns the cached sitemap, building it first if it's out of date.
+// Holding the lock while building means concurrent requests share one
+// build.
+func (s *sitemapCache) get(ctx context.Context, build func(context.Context) ([]byte, error)) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.body != nil && !s.stale && time.Since(s.builtAt) < sitemapMaxAge {
+		return s.body, nil
+	}
+	body, err := build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.body, s.builtAt, s.stale = body, time.Now(), false
+	return body, nil
+}
+
+// handlerSitemap serves a sitemap of public, processed videos with the
+// video extensions, so search engines can index them.
+func (cfg *apiConfig) handlerSitemap(w http.ResponseWriter, r *http.Request) {
+	body, err := cfg.sitemap.get(r.Context(), cfg.buildSitemap)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't build sitemap", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(sitemapMaxAge.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// buildSitemap lists the newest public videos, each linking to its embed
+// player. File URLs are only included when they don't need a playback
+// token, since a token would expire long before crawlers fetch them.
+func (cfg *apiConfig) buildSitemap(ctx context.Context) ([]byte, error) {
+	urlSet := sitemapURLSet{
+		NS:      "http://www.sitemaps.org/schemas/sitemap/0.9",
+		VideoNS: "http://www.google.com/schemas/sitemap-video/1.1",
+		URLs:    []sitemapURL{},
+	}
+	params := database.ListVideosParams{
+		PublicOnly: true,
+		Status:     database.VideoStatusReady,
+		Limit:      1000,
+	}
+	for len(urlSet.URLs) < sitemapURLLimit {
+		videos, more, err := cfg.db.ListVideos(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, video := range videos {
+			if len(urlSet.URLs) == sitemapURLLimit {
+				break
+			}
+			urlSet.URLs = append(urlSet.URLs, cfg.sitemapEntry(video))
+		}
+		if !more || len(videos) == 0 {
+			break
+		}
+		cursor := videos[len(videos)-1].Cursor()
+		params.After = &cursor
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(urlSet); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sitemapEntry describes a video. Search engines require a thumbnail, so
+// videos without one are listed without the video extension.
+func (cfg *apiConfig) sitemapEntry(video database.Video) sitemapURL {
+	playerURL := fmt.Sprintf("%s/embed/%s", cfg.baseURL, video.ID)
+	entry := sitemapURL{
+		Loc:     playerURL,
+		LastMod: video.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if video.ThumbnailURL == nil {
+		return entry
+	}
+
+	description := video.Description
+	if description == "" {
+		description = video.Title
+	}
+	if runes := []rune(description); len(runes) > sitemapDescriptionLimit {
+		description = string(runes[:sitemapDescriptionLimit])
+	}
+	entry.Video = &sitemapVideo{
+		ThumbnailLoc:    *video.ThumbnailURL,
+		Title:           video.Title,
+		Description:     description,
+		PlayerLoc:       playerURL,
+		PublicationDate: video.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if len(video.Tags) > 0 {
+		entry.Video.Tags = video.Tags[:min(len(video.Tags), 32)]
+	}
+	if video.VideoURL != nil && cfg.playbackTokenSecret == "" {
+		entry.Video.ContentLoc = *video.VideoURL
+	}
+	if video.DurationSeconds != nil {
+		entry.Video.Duration = max(1, int(*video.DurationSeconds))
+	}
+	return entry
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3API is the part of *s3.Client the server uses, so handlers can be
+// exercised against a fake bucket.
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	PutObjectLegalHold(ctx context.Context, params *s3.PutObjectLegalHoldInput, optFns ...func(*s3.Options)) (*s3.PutObjectLegalHoldOutput, error)
+	PutObjectRetention(ctx context.Context, params *s3.PutObjectRetentionInput, optFns ...func(*s3.Options)) (*s3.PutObjectRetentionOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error)
+}
+
+// s3PresignAPI is the part of *s3.PresignClient the server uses.
+type s3PresignAPI interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignPostObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignPostOptions)) (*s3.PresignedPostRequest, error)
+}
+
+// s3KeyFromURL recovers the object key from a playback URL built from the
+// CloudFront distribution.
+func (cfg *apiConfig) s3KeyFromURL(url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, cfg.s3CfDistribution+"/")
+	if !ok || key == "" {
+		return "", false
+	}
+	return key, true
+}
+
+// assetPathFromURL recovers the local file path of an asset served from
+// /assets/.
+func (cfg *apiConfig) assetPathFromURL(url string) (string, bool) {
+	_, name, ok := strings.Cut(url, "/assets/")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return filepath.Join(cfg.assetsRoot, name), true
+}
+
+// uploadEncodedFile stores a file ffmpeg wrote at path under a new random
+// key in prefix, with the file's extension, returning the key and the
+// file's size.
+func (cfg *apiConfig) uploadEncodedFile(ctx context.Context, path, prefix, contentType string) (string, int64, error) {
+	randBuf := make([]byte, 32)
+	if _, err := rand.Read(randBuf); err != nil {
+		return "", 0, err
+	}
+	key := prefix + "/" + base64.RawURLEncoding.EncodeToString(randBuf) + filepath.Ext(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &cfg.s3Bucket,
+		Key:         &key,
+		Body:        file,
+		ContentType: &contentType,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return key, info.Size(), nil
+}
+
+func (cfg *apiConfig) deleteS3Object(ctx context.Context, key string) error {
+	_, err := cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+	})
+	return err
+}
+
+// deleteS3Prefix deletes every object whose key starts with prefix.
+func (cfg *apiConfig) deleteS3Prefix(ctx context.Context, prefix string) error {
+	var token *string
+	for {
+		out, err := cfg.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            &cfg.s3Bucket,
+			Prefix:            &prefix,
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return err
+		}
+		for _, obj := range out.Contents {
+			if err := cfg.deleteS3Object(ctx, *obj.Key); err != nil {
+				return err
+			}
+		}
+		if out.IsTruncated == nil || !*out.IsTruncated {
+			return nil
+		}
+		token = out.NextContinuationToken
+	}
+}
+
+// deleteVideoObject deletes a stored video file. An HLS playlist is deleted
+// along with the segments stored beside it.
+func (cfg *apiConfig) deleteVideoObject(ctx context.Context, key string) error {
+	if strings.HasSuffix(key, "/"+hlsPlaylistName) {
+		return cfg.deleteS3Prefix(ctx, strings.TrimSuffix(key, hlsPlaylistName))
+	}
+	return cfg.deleteS3Object(ctx, key)
+}
+
+// copyS3Object copies an object, possibly into another bucket.
+func (cfg *apiConfig) copyS3Object(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	source := (&url.URL{Path: srcBucket + "/" + srcKey}).EscapedPath()
+	_, err := cfg.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     &dstBucket,
+		Key:        &dstKey,
+		CopySource: &source,
+	})
+	return err
+}
+
+// setS3LegalHold turns object lock legal hold on or off for a key. The bucket
+// must have object lock enabled.
+func (cfg *apiConfig) setS3LegalHold(ctx context.Context, key string, on bool) error {
+	status := types.ObjectLockLegalHoldStatusOff
+	if on {
+		status = types.ObjectLockLegalHoldStatusOn
+	}
+	_, err := cfg.s3Client.PutObjectLegalHold(ctx, &s3.PutObjectLegalHoldInput{
+		Bucket:    &cfg.s3Bucket,
+		Key:       &key,
+		LegalHold: &types.ObjectLockLegalHold{Status: status},
+	})
+	return err
+}
+
+// setS3Retention locks a key in OBJECT_LOCK_MODE until retainUntil. The
+// bucket must have object lock enabled.
+func (cfg *apiConfig) setS3Retention(ctx context.Context, key string, retainUntil time.Time) error {
+	_, err := cfg.s3Client.PutObjectRetention(ctx, &s3.PutObjectRetentionInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+		Retention: &types.ObjectLockRetention{
+			Mode:            types.ObjectLockRetentionMode(cfg.objectLockMode),
+			RetainUntilDate: &retainUntil,
+		},
+	})
+	return err
+}
+
+func (cfg *apiConfig) deleteAsset(url string) error {
+	path, ok := cfg.assetPathFromURL(url)
+	if !ok {
+		return nil
+	}
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// storageReconcilePrefixes are the parts of the bucket that hold video
+// files. Backups, resumable upload staging, delivery logs, and quarantined
+// files are cleaned up by their own jobs and aren't scanned.
+var storageReconcilePrefixes = []string{
+	string(database.AspectLandscape) + "/",
+	string(database.AspectPortrait) + "/",
+	string(database.AspectOther) + "/",
+	"hls/",
+	"live/",
+}
+
+// storageReconcileGrace is how old an object has to be before it's reported
+// as orphaned, so files uploaded before their row is written aren't.
+const storageReconcileGrace = 24 * time.Hour
+
+// Resolutions recorded for repaired discrepancies.
+const (
+	storageRepairObjectDeleted    = "object_deleted"
+	storageRepairVideoFailed      = "video_failed"
+	storageRepairRenditionRemoved = "rendition_removed"
+)
+
+// reconcileMu keeps a scheduled reconciliation and one triggered by an
+// admin from running at the same time.
+var reconcileMu sync.Mutex
+
+type storageReconcileResult struct {
+	StartedAt  time.Time `json:"started_at"`
+	Objects    int       `json:"objects"`
+	References int       `json:"references"`
+	Missing    int       `json:"missing"`
+	Orphaned   int       `json:"orphaned"`
+	Repaired   int       `json:"repaired"`
+}
+
+// storageRefIndex is the set of keys the database refers to. An HLS
+// playlist or a live stream refers to everything stored beside it.
+type storageRefIndex struct {
+	keys     map[string]bool
+	prefixes map[string]bool
+}
+
+// newStorageRefIndex indexes refs, skipping videos whose URL isn't on the
+// CloudFront distribution, such as low-latency live streams.
+func (cfg *apiConfig) newStorageRefIndex(refs []database.StorageReference) storageRefIndex {
+	idx := storageRefIndex{keys: map[string]bool{}, prefixes: map[string]bool{}}
+	for _, ref := range refs {
+		key, ok := cfg.storageRefKey(ref)
+		if !ok {
+			continue
+		}
+		idx.keys[key] = true
+		if ref.Source == database.StorageReferenceLiveStream || strings.HasSuffix(key, "/"+hlsPlaylistName) {
+			idx.prefixes[path.Dir(key)+"/"] = true
+		}
+	}
+	return idx
+}
+
+func (cfg *apiConfig) storageRefKey(ref database.StorageReference) (string, bool) {
+	if ref.Source == database.StorageReferenceVideo {
+		return cfg.s3KeyFromURL(ref.Key)
+	}
+	return ref.Key, ref.Key != ""
+}
+
+func (idx storageRefIndex) referenced(key string) bool {
+	if idx.keys[key] {
+		return true
+	}
+	dir := key
+	for {
+		i := strings.LastIndex(dir, "/")
+		if i < 0 {
+			return false
+		}
+		dir = dir[:i]
+		if idx.prefixes[dir+"/"] {
+			return true
+		}
+	}
+}
+
+// runStorageReconciler cross-checks the database against the bucket every
+// interval, repairing what it finds if autoRepair is set. It returns when
+// ctx is cancelled.
+func (cfg *apiConfig) runStorageReconciler(ctx context.Context, interval time.Duration, autoRepair bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		result, err := cfg.reconcileStorage(ctx, autoRepair)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't reconcile storage", "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Reconciled storage",
+			"objects", result.Objects,
+			"missing", result.Missing,
+			"orphaned", result.Orphaned,
+			"repaired", result.Repaired,
+		)
+	}
+}
+
+// reconcileStorage records rows whose object isn't in the bucket and
+// objects no row refers to as open discrepancies, resolving those no
+// longer found. With repair set it then repairs every open discrepancy.
+//
+// References are read before the bucket is listed, so an object written in
+// between looks orphaned, but it's too new to be reported. Each repair
+// checks its discrepancy again before acting on it.
+func (cfg *apiConfig) reconcileStorage(ctx context.Context, repair bool) (storageReconcileResult, error) {
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+
+	result := storageReconcileResult{StartedAt: time.Now().UTC()}
+	refs, err := cfg.db.GetStorageReferences(ctx)
+	if err != nil {
+		return result, err
+	}
+	objects, err := cfg.listStorageObjects(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.References, result.Objects = len(refs), len(objects)
+	idx := cfg.newStorageRefIndex(refs)
+
+	found := []database.StorageDiscrepancy{}
+	for _, ref := range refs {
+		// Live streams and pending uploads are written after their rows.
+		if ref.Source != database.StorageReferenceVideo && ref.Source != database.StorageReferenceRendition {
+			continue
+		}
+		key, ok := cfg.storageRefKey(ref)
+		if !ok {
+			continue
+		}
+		var exists bool
+		if inStorageReconcilePrefixes(key) {
+			_, exists = objects[key]
+		} else if exists, err = cfg.s3ObjectExists(ctx, key); err != nil {
+			return result, err
+		}
+		if exists {
+			continue
+		}
+		found = append(found, database.StorageDiscrepancy{
+			Kind:     database.StorageObjectMissing,
+			Key:      key,
+			Source:   ref.Source,
+			SourceID: &ref.ID,
+			VideoID:  &ref.VideoID,
+		})
+		result.Missing++
+	}
+
+	cutoff := time.Now().Add(-storageReconcileGrace)
+	for key, obj := range objects {
+		if idx.referenced(key) || obj.LastModified == nil || obj.LastModified.After(cutoff) {
+			continue
+		}
+		found = append(found, database.StorageDiscrepancy{
+			Kind:      database.StorageObjectOrphaned,
+			Key:       key,
+			SizeBytes: obj.Size,
+		})
+		result.Orphaned++
+	}
+
+	if err := cfg.db.RecordStorageDiscrepancies(ctx, found); err != nil {
+		return result, err
+	}
+	if repair {
+		result.Repaired = cfg.repairStorageDiscrepancies(ctx, idx)
+	}
+	return result, nil
+}
+
+func inStorageReconcilePrefixes(key string) bool {
+	for _, prefix := range storageReconcilePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// listStorageObjects lists every object under storageReconcilePrefixes.
+func (cfg *apiConfig) listStorageObjects(ctx context.Context) (map[string]types.Object, error) {
+	objects := map[string]types.Object{}
+	for _, prefix := range storageReconcilePrefixes {
+		var token *string
+		for {
+			out, err := cfg.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+				Bucket:            &cfg.s3Bucket,
+				Prefix:            &prefix,
+				ContinuationToken: token,
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, obj := range out.Contents {
+				objects[*obj.Key] = obj
+			}
+			if out.IsTruncated == nil || !*out.IsTruncated {
+				break
+			}
+			token = out.NextContinuationToken
+		}
+	}
+	return objects, nil
+}
+
+// s3ObjectExists reports whether an object with exactly key is stored.
+func (cfg *apiConfig) s3ObjectExists(ctx context.Context, key string) (bool, error) {
+	_, exists, err := cfg.s3ObjectSize(ctx, cfg.s3Bucket, key)
+	return exists, err
+}
+
+// s3ObjectSize returns the size of the object with exactly key in bucket,
+// and whether there is one.
+func (cfg *apiConfig) s3ObjectSize(ctx context.Context, bucket, key string) (int64, bool, error) {
+	maxKeys := int32(1)
+	out, err := cfg.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  &bucket,
+		Prefix:  &key,
+		MaxKeys: &maxKeys,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if len(out.Contents) == 0 || *out.Contents[0].Key != key {
+		return 0, false, nil
+	}
+	return aws.ToInt64(out.Contents[0].Size), true, nil
+}
+
+// repairStorageDiscrepancies repairs every open discrepancy, returning how
+// many were repaired. Failures are logged and left open.
+func (cfg *apiConfig) repairStorageDiscrepancies(ctx context.Context, idx storageRefIndex) int {
+	const pageSize = 100
+	repaired, offset := 0, 0
+	for {
+		page, err := cfg.db.ListStorageDiscrepancies(ctx, "", false, pageSize, offset)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't list storage discrepancies", "error", err)
+			return repaired
+		}
+		for _, d := range page {
+			resolution, err := cfg.repairStorageDiscrepancy(ctx, d, idx)
+			if err == nil {
+				err = cfg.db.ResolveStorageDiscrepancy(ctx, d.ID, resolution, nil)
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "Couldn't repair storage discrepancy", "discrepancy_id", d.ID, "key", d.Key, "error", err)
+				offset++
+				continue
+			}
+			if resolution != database.StorageDiscrepancyResolutionCleared {
+				repaired++
+			}
+		}
+		if len(page) < pageSize {
+			return repaired
+		}
+	}
+}
+
+// repairStorageDiscrepancy checks a discrepancy still holds, then repairs
+// it: an orphaned object is deleted, a rendition whose object is missing is
+// removed, and a video whose file is missing is marked failed so its owner
+// uploads it again. It returns the resolution to record, which is
+// "cleared" if the discrepancy no longer holds.
+func (cfg *apiConfig) repairStorageDiscrepancy(ctx context.Context, d database.StorageDiscrepancy, idx storageRefIndex) (string, error) {
+	exists, err := cfg.s3ObjectExists(ctx, d.Key)
+	if err != nil {
+		return "", err
+	}
+
+	if d.Kind == database.StorageObjectOrphaned {
+		if !exists {
+			return database.StorageDiscrepancyResolutionCleared, nil
+		}
+		if idx.referenced(d.Key) {
+			return database.StorageDiscrepancyResolutionCleared, nil
+		}
+		if err := cfg.deleteS3Object(ctx, d.Key); err != nil {
+			return "", err
+		}
+		return storageRepairObjectDeleted, nil
+	}
+
+	if exists || d.SourceID == nil || d.VideoID == nil {
+		return database.StorageDiscrepancyResolutionCleared, nil
+	}
+	switch d.Source {
+	case database.StorageReferenceVideo:
+		video, err := cfg.db.GetVideo(ctx, *d.VideoID)
+		if err != nil {
+			return "", err
+		}
+		if video.ID == uuid.Nil || video.VideoURL == nil {
+			return database.StorageDiscrepancyResolutionCleared, nil
+		}
+		if key, ok := cfg.s3KeyFromURL(*video.VideoURL); !ok || key != d.Key {
+			return database.StorageDiscrepancyResolutionCleared, nil
+		}
+		if err := cfg.db.SetVideoStatus(ctx, video.ID, database.VideoStatusFailed); err != nil {
+			return "", err
+		}
+		cfg.sitemap.invalidate()
+		return storageRepairVideoFailed, nil
+	case database.StorageReferenceRendition:
+		renditions, err := cfg.db.GetRenditions(ctx, *d.VideoID)
+		if err != nil {
+			return "", err
+		}
+		for _, rendition := range renditions {
+			if rendition.ID == *d.SourceID && rendition.S3Key == d.Key {
+				if err := cfg.db.DeleteRendition(ctx, rendition.ID); err != nil {
+					return "", err
+				}
+				return storageRepairRenditionRemoved, nil
+			}
+		}
+		return database.StorageDiscrepancyResolutionCleared, nil
+	}
+	return "", errors.New("unknown discrepancy source " + string(d.Source))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// notifySubscribers tells everyone subscribed to a video's creator or
+// channel that it was published. It's called whenever a video may have
+// become publicly available; videos that aren't public and ready are
+// ignored, and each subscriber is notified about a video at most once.
+func (cfg *apiConfig) notifySubscribers(ctx context.Context, video database.Video) {
+	// The video may also have stopped being public.
+	cfg.sitemap.invalidate()
+	if video.DeletedAt != nil || video.Visibility != database.VisibilityPublic || video.Status != database.VideoStatusReady {
+		return
+	}
+
+	subscriberIDs, err := cfg.db.GetSubscriberIDs(ctx, video.UserID, video.ChannelID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't look up subscribers", "video_id", video.ID, "error", err)
+		return
+	}
+	for _, subscriberID := range subscriberIDs {
+		if subscriberID == video.UserID {
+			continue
+		}
+		created := cfg.notify(ctx, database.CreateNotificationParams{
+			UserID:  subscriberID,
+			Type:    database.NotificationNewUpload,
+			VideoID: &video.ID,
+		})
+		if created {
+			cfg.publishEvent(ctx, subscriberID, eventSubscriptionUpload, video)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+const maxTagLength = 50
+
+// normalizeTag lowercases and trims a tag so "Cats " and "cats" are the same
+// tag.
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", errors.New("tag can't be empty")
+	}
+	if len(tag) > maxTagLength {
+		return "", errors.New("tag is too long")
+	}
+	return tag, nil
+}
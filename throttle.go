@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// throttleChunk bounds how much one Read takes from a bandwidth limiter, so
+// concurrent uploads interleave instead of one reserving seconds of
+// bandwidth at a time.
+const throttleChunk = 32 << 10
+
+// bandwidthLimiter is a token bucket measured in bytes. Reads reserve
+// bytes up front and sleep off any deficit, so the limiter may be shared
+// between uploads.
+type bandwidthLimiter struct {
+	rate float64 // bytes per second
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newBandwidthLimiter returns a limiter for bytesPerSecond, or nil if it's
+// zero, which means unlimited.
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{rate: float64(bytesPerSecond), last: time.Now()}
+}
+
+// wait takes n bytes from the bucket, sleeping until they're available.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	// At most a second's worth of unused bandwidth carries over.
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(deficit / l.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledBody reads a request body no faster than its limiters allow.
+type throttledBody struct {
+	io.ReadCloser
+	ctx      context.Context
+	limiters []*bandwidthLimiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	for _, l := range b.limiters {
+		if werr := l.wait(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// uploadThrottle caps the rate uploads are read at, both for each upload
+// and for all of them together, leaving bandwidth for playback on small
+// hosts.
+type uploadThrottle struct {
+	global        *bandwidthLimiter
+	perConnection int64
+}
+
+func newUploadThrottle(globalBytesPerSecond, perConnectionBytesPerSecond int64) *uploadThrottle {
+	return &uploadThrottle{
+		global:        newBandwidthLimiter(globalBytesPerSecond),
+		perConnection: perConnectionBytesPerSecond,
+	}
+}
+
+func (t *uploadThrottle) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var limiters []*bandwidthLimiter
+		if l := newBandwidthLimiter(t.perConnection); l != nil {
+			limiters = append(limiters, l)
+		}
+		if t.global != nil {
+			limiters = append(limiters, t.global)
+		}
+		if len(limiters) > 0 {
+			r.Body = &throttledBody{ReadCloser: r.Body, ctx: r.Context(), limiters: limiters}
+		}
+		next(w, r)
+	}
+}
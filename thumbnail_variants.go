@@ -0,0 +1,128 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxThumbnailVariants bounds the candidates in one test.
+	maxThumbnailVariants = 4
+	// thumbnailTestMinImpressions is how often every candidate has to
+	// have been shown before a winner is called.
+	thumbnailTestMinImpressions = 1000
+	// thumbnailTestZ is the z-score the leader's click-through rate has to
+	// beat the runner-up's by, 95% confidence.
+	thumbnailTestZ = 1.96
+)
+
+// rotateThumbnails shows one of each video's candidate thumbnails, picked
+// at random, in place of its thumbnail, and counts the impressions. It's
+// for listings shown to viewers; if the candidates can't be read the
+// videos keep their own thumbnails.
+func (cfg *apiConfig) rotateThumbnails(ctx context.Context, videos []database.Video) {
+	ids := make([]uuid.UUID, len(videos))
+	for i, video := range videos {
+		ids[i] = video.ID
+	}
+	variants, err := cfg.db.GetThumbnailVariantURLs(ctx, ids)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get thumbnail variants", "error", err)
+		return
+	}
+	if len(variants) == 0 {
+		return
+	}
+
+	var shown []uuid.UUID
+	for i := range videos {
+		urls := variants[videos[i].ID]
+		if len(urls) == 0 {
+			continue
+		}
+		candidates := make([]uuid.UUID, 0, len(urls))
+		for id := range urls {
+			candidates = append(candidates, id)
+		}
+		id := candidates[rand.IntN(len(candidates))]
+		url := urls[id]
+		videos[i].ThumbnailURL = &url
+		videos[i].ThumbnailVariantID = &id
+		shown = append(shown, id)
+	}
+	if err := cfg.db.RecordThumbnailImpressions(ctx, shown); err != nil {
+		slog.ErrorContext(ctx, "Couldn't record thumbnail impressions", "error", err)
+	}
+}
+
+// recordThumbnailClick counts a playback session as a click on one of a
+// video's candidate thumbnails. Variants that have since been deleted, or
+// belong to another video, are ignored.
+func (cfg *apiConfig) recordThumbnailClick(ctx context.Context, videoID, variantID uuid.UUID, sessionID string) error {
+	variant, err := cfg.db.GetThumbnailVariant(ctx, variantID)
+	if err != nil {
+		return err
+	}
+	if variant.VideoID != videoID {
+		return nil
+	}
+	return cfg.db.RecordThumbnailClick(ctx, variantID, sessionID, time.Now())
+}
+
+type thumbnailVariantStats struct {
+	database.ThumbnailVariant
+	ClickThroughRate float64 `json:"click_through_rate"`
+}
+
+type thumbnailTestReport struct {
+	Variants []thumbnailVariantStats `json:"variants"`
+	// WinnerID is the variant with the best click-through rate once
+	// every variant has enough impressions and its lead is significant.
+	WinnerID       *uuid.UUID `json:"winner_id"`
+	MinImpressions int        `json:"min_impressions"`
+}
+
+// newThumbnailTestReport works out each variant's click-through rate and
+// whether the best one has won. The leader wins when a two-proportion
+// z-test puts it ahead of the runner-up at 95% confidence.
+func newThumbnailTestReport(variants []database.ThumbnailVariant) thumbnailTestReport {
+	report := thumbnailTestReport{Variants: []thumbnailVariantStats{}, MinImpressions: thumbnailTestMinImpressions}
+	for _, v := range variants {
+		stats := thumbnailVariantStats{ThumbnailVariant: v}
+		if v.Impressions > 0 {
+			stats.ClickThroughRate = float64(v.Clicks) / float64(v.Impressions)
+		}
+		report.Variants = append(report.Variants, stats)
+	}
+	if len(report.Variants) < 2 {
+		return report
+	}
+	for _, v := range report.Variants {
+		if v.Impressions < thumbnailTestMinImpressions {
+			return report
+		}
+	}
+
+	ranked := slices.Clone(report.Variants)
+	slices.SortFunc(ranked, func(a, b thumbnailVariantStats) int {
+		return cmp.Compare(b.ClickThroughRate, a.ClickThroughRate)
+	})
+	leader, runnerUp := ranked[0], ranked[1]
+	pooled := float64(leader.Clicks+runnerUp.Clicks) / float64(leader.Impressions+runnerUp.Impressions)
+	stderr := math.Sqrt(pooled * (1 - pooled) * (1/float64(leader.Impressions) + 1/float64(runnerUp.Impressions)))
+	if stderr == 0 {
+		return report
+	}
+	if (leader.ClickThroughRate-runnerUp.ClickThroughRate)/stderr >= thumbnailTestZ {
+		report.WinnerID = &leader.ID
+	}
+	return report
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// timeoutWriteGrace is how long past its deadline a handler may still write,
+// so it can report the timeout instead of having the connection drop.
+const timeoutWriteGrace = 5 * time.Second
+
+// timeoutMiddleware cancels the request's context after d, which stops S3
+// calls and subprocesses started with it. Reading the body doesn't watch the
+// context, so the connection's read deadline is set too; that's what stops a
+// client that stalls mid-upload from holding the handler open. Zero means no
+// limit.
+func timeoutMiddleware(next http.Handler, d time.Duration) http.Handler {
+	if d <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWithTimeout(next, w, r, d)
+	})
+}
+
+// uploadTimeoutMiddleware is timeoutMiddleware with a limit sized to each
+// upload: base plus the time to read its declared Content-Length at
+// minThroughput bytes per second. A stalled small upload is cut off
+// quickly, and a large one on a slow link still has time to finish.
+// Uploads that don't declare a length get fallback.
+func uploadTimeoutMiddleware(next http.Handler, base, fallback time.Duration, minThroughput int64) http.Handler {
+	if minThroughput <= 0 {
+		return timeoutMiddleware(next, fallback)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := fallback
+		if r.ContentLength > 0 {
+			d = base + time.Duration(r.ContentLength/minThroughput+1)*time.Second
+		}
+		if d <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		serveWithTimeout(next, w, r, d)
+	})
+}
+
+func serveWithTimeout(next http.Handler, w http.ResponseWriter, r *http.Request, d time.Duration) {
+	ctx, cancel := context.WithTimeout(r.Context(), d)
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	rc := http.NewResponseController(w)
+	// Not every writer supports deadlines; the context still applies.
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline.Add(timeoutWriteGrace))
+	// The server resets the read deadline before the next request on
+	// the connection but leaves the write deadline alone.
+	defer rc.SetWriteDeadline(time.Time{})
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
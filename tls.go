@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/acme"
+)
+
+const (
+	// acmeRenewBefore is how long before expiry a certificate is replaced.
+	// Let's Encrypt certificates last 90 days.
+	acmeRenewBefore    = 30 * 24 * time.Hour
+	acmeAccountKeyName = "acme_account.key"
+)
+
+var errCertCacheMiss = errors.New("not in certificate cache")
+
+// certCache stores the ACME account key and issued certificates so they
+// survive restarts; without it every deploy would hit the CA's rate limits.
+type certCache interface {
+	Get(ctx context.Context, name string) ([]byte, error)
+	Put(ctx context.Context, name string, data []byte) error
+}
+
+// dirCertCache keeps the cache in a local directory.
+type dirCertCache string
+
+func (d dirCertCache) Get(ctx context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(string(d), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errCertCacheMiss
+	}
+	return data, err
+}
+
+func (d dirCertCache) Put(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(string(d), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(string(d), name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(string(d), name))
+}
+
+// s3CertCache keeps the cache in a private bucket under acme/, so every
+// instance behind a load balancer shares one certificate. Objects are
+// encrypted at rest, since they include private keys.
+type s3CertCache struct {
+	client s3API
+	bucket string
+}
+
+func (c s3CertCache) key(name string) *string {
+	key := "acme/" + name
+	return &key
+}
+
+func (c s3CertCache) Get(ctx context.Context, name string) ([]byte, error) {
+	out, err := c.client.GetObject(ctx, &s3.GetObjectInput{Bucket: &c.bucket, Key: c.key(name)})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, errCertCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (c s3CertCache) Put(ctx context.Context, name string, data []byte) error {
+	_, err := c.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               &c.bucket,
+		Key:                  c.key(name),
+		Body:                 bytes.NewReader(data),
+		ServerSideEncryption: types.ServerSideEncryptionAes256,
+	})
+	return err
+}
+
+// certManager serves a certificate for the configured domains, obtaining
+// and renewing it from an ACME CA with http-01 challenges. Channels' custom
+// domains each get a certificate of their own, added with ensureDomain.
+type certManager struct {
+	directoryURL string
+	email        string
+	domains      []string
+	cache        certCache
+
+	mu sync.RWMutex
+	// certs is keyed by the first domain each certificate covers.
+	certs      map[string]*tls.Certificate
+	challenges map[string]string
+}
+
+func newCertManager(directoryURL, email string, domains []string, cache certCache) *certManager {
+	return &certManager{
+		directoryURL: directoryURL,
+		email:        email,
+		domains:      domains,
+		cache:        cache,
+		certs:        map[string]*tls.Certificate{},
+		challenges:   map[string]string{},
+	}
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (m *certManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if name != "" && !slices.Contains(m.domains, name) {
+		if cert, ok := m.certs[name]; ok {
+			return cert, nil
+		}
+		return nil, fmt.Errorf("no certificate for %q", name)
+	}
+	cert, ok := m.certs[m.domains[0]]
+	if !ok {
+		return nil, errors.New("certificate not issued yet")
+	}
+	return cert, nil
+}
+
+// httpHandler answers http-01 challenges and redirects everything else to
+// HTTPS. It has to be served on port 80 for the CA to reach it.
+func (m *certManager) httpHandler(httpsPort string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/acme-challenge/{token}", m.handlerChallenge)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+	return mux
+}
+
+func (m *certManager) handlerChallenge(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	keyAuth, ok := m.challenges[r.PathValue("token")]
+	m.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+}
+
+// respond is the acme.HTTP01Responder for the challenge handler.
+func (m *certManager) respond(token, keyAuth string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if keyAuth == "" {
+		delete(m.challenges, token)
+		return
+	}
+	m.challenges[token] = keyAuth
+}
+
+// certName is the cache entry holding the private key and chain for a
+// certificate, as PEM.
+func certName(domains []string) string {
+	return domains[0] + ".pem"
+}
+
+// ensure loads the cached certificate if none is being served yet, and
+// obtains a new one if it's missing, close to expiry, or doesn't cover
+// every configured domain.
+func (m *certManager) ensure(ctx context.Context) error {
+	return m.ensureCert(ctx, m.domains)
+}
+
+// ensureDomain does what ensure does for a certificate covering just
+// domain, which is served alongside the configured domains'.
+func (m *certManager) ensureDomain(ctx context.Context, domain string) error {
+	return m.ensureCert(ctx, []string{domain})
+}
+
+// hasDomain reports whether a certificate for domain is being served.
+func (m *certManager) hasDomain(domain string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.certs[domain]
+	return ok
+}
+
+// forgetDomain stops serving a domain's certificate. The cached copy is
+// left for the CA's rate limits' sake, in case the domain comes back.
+func (m *certManager) forgetDomain(domain string) {
+	if slices.Contains(m.domains, domain) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.certs, domain)
+}
+
+// customDomains lists the channel domains certificates are served for.
+func (m *certManager) customDomains() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	domains := []string{}
+	for domain := range m.certs {
+		if !slices.Contains(m.domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+func (m *certManager) ensureCert(ctx context.Context, domains []string) error {
+	if !m.hasDomain(domains[0]) {
+		if err := m.load(ctx, domains); err != nil {
+			return err
+		}
+	}
+	if !m.needsRenewal(domains, time.Now()) {
+		return nil
+	}
+	return m.obtain(ctx, domains)
+}
+
+func (m *certManager) load(ctx context.Context, domains []string) error {
+	data, err := m.cache.Get(ctx, certName(domains))
+	if errors.Is(err, errCertCacheMiss) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read cached certificate: %w", err)
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return fmt.Errorf("couldn't parse cached certificate: %w", err)
+	}
+	m.mu.Lock()
+	m.certs[domains[0]] = &cert
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *certManager) needsRenewal(domains []string, now time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cert := m.certs[domains[0]]
+	if cert == nil || cert.Leaf == nil {
+		return true
+	}
+	if now.Add(acmeRenewBefore).After(cert.Leaf.NotAfter) {
+		return true
+	}
+	for _, domain := range domains {
+		if cert.Leaf.VerifyHostname(domain) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *certManager) obtain(ctx context.Context, domains []string) error {
+	client, err := m.account(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't register ACME account: %w", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	chain, err := client.Obtain(ctx, domains, key, m.respond)
+	if err != nil {
+		return fmt.Errorf("couldn't obtain certificate: %w", err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	for _, cert := range chain {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	}
+	cert, err := tls.X509KeyPair(buf.Bytes(), buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("couldn't parse issued certificate: %w", err)
+	}
+
+	m.mu.Lock()
+	m.certs[domains[0]] = &cert
+	m.mu.Unlock()
+	slog.InfoContext(ctx, "Obtained TLS certificate", "domains", domains, "expires", cert.Leaf.NotAfter)
+
+	// The certificate is already being served, so a cache failure only
+	// costs a reissue on the next restart.
+	if err := m.cache.Put(ctx, certName(domains), buf.Bytes()); err != nil {
+		slog.ErrorContext(ctx, "Couldn't cache TLS certificate", "error", err)
+	}
+	return nil
+}
+
+// account returns a client for the cached account key, creating and
+// caching a key on first use.
+func (m *certManager) account(ctx context.Context) (*acme.Client, error) {
+	var key *ecdsa.PrivateKey
+	data, err := m.cache.Get(ctx, acmeAccountKeyName)
+	switch {
+	case err == nil:
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("cached account key isn't PEM")
+		}
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	case errors.Is(err, errCertCacheMiss):
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		err = m.cache.Put(ctx, acmeAccountKeyName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't cache account key: %w", err)
+		}
+	default:
+		return nil, err
+	}
+
+	client := acme.NewClient(m.directoryURL, key)
+	if err := client.Register(ctx, m.email); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// runRenewer checks the certificate on every tick and renews it once it's
+// within acmeRenewBefore of expiring.
+func (m *certManager) runRenewer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		if err := m.ensure(renewCtx); err != nil {
+			slog.ErrorContext(ctx, "Couldn't renew TLS certificate", "error", err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+)
+
+// tracingMiddleware starts a server span for each request, continuing the
+// caller's trace when it sends a traceparent header. The span is named
+// after the route pattern once the mux has matched one.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, r.Method, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+			tracing.String("request.id", requestIDFromContext(ctx)),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		// ServeMux records the matched pattern on the request it's given.
+		req := r.WithContext(ctx)
+		next.ServeHTTP(rec, req)
+
+		if req.Pattern != "" {
+			span.SetName(req.Pattern)
+			span.SetAttributes(tracing.String("http.route", req.Pattern))
+		}
+		span.SetAttributes(tracing.Int("http.response.status_code", rec.status))
+		if rec.status >= 500 {
+			span.RecordError(errStatus(rec.status))
+		}
+	})
+}
+
+type errStatus int
+
+func (e errStatus) Error() string {
+	return "HTTP " + strconv.Itoa(int(e))
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+)
+
+const (
+	// trailerSeconds is how long a trailer is.
+	trailerSeconds = 30
+	// trailerClipSeconds is how long each clip in a trailer is.
+	trailerClipSeconds = 5
+	// trailerMinSourceSeconds is the shortest video a trailer is made for.
+	// Shorter videos are their own trailer.
+	trailerMinSourceSeconds = 2 * trailerSeconds
+	// silenceDB is the loudness given to silent audio, whose RMS level
+	// ffmpeg reports as -inf.
+	silenceDB = -120
+)
+
+// frameValue is a value ffmpeg's metadata filter printed for the frame at
+// Time seconds.
+type frameValue struct {
+	Time  float64
+	Value float64
+}
+
+// readFrameMetadata reads the values of key from a file written by the
+// metadata or ametadata filter's print mode, which lists each frame as a
+// "frame:N pts:P pts_time:T" line followed by its key=value lines.
+func readFrameMetadata(path, key string) ([]frameValue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var values []frameValue
+	t := 0.0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "frame:") {
+			for _, field := range strings.Fields(line) {
+				if v, ok := strings.CutPrefix(field, "pts_time:"); ok {
+					t, _ = strconv.ParseFloat(v, 64)
+				}
+			}
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || k != key {
+			continue
+		}
+		value, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+			value = silenceDB
+		}
+		values = append(values, frameValue{Time: t, Value: value})
+	}
+	return values, scanner.Err()
+}
+
+// perSecond averages values into one bucket per second of a video
+// seconds long. Seconds without a value get the lowest value seen.
+func perSecond(values []frameValue, seconds int) []float64 {
+	sums := make([]float64, seconds)
+	counts := make([]int, seconds)
+	lowest := math.Inf(1)
+	for _, v := range values {
+		i := min(max(int(v.Time), 0), seconds-1)
+		sums[i] += v.Value
+		counts[i]++
+		lowest = min(lowest, v.Value)
+	}
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= float64(counts[i])
+		} else if !math.IsInf(lowest, 1) {
+			sums[i] = lowest
+		}
+	}
+	return sums
+}
+
+// normalize scales values to between 0 and 1 in place.
+func normalize(values []float64) {
+	lo, hi := slices.Min(values), slices.Max(values)
+	for i := range values {
+		if hi > lo {
+			values[i] = (values[i] - lo) / (hi - lo)
+		} else {
+			values[i] = 0
+		}
+	}
+}
+
+// scoreSeconds rates each second of a video by how much changes on screen,
+// from ffmpeg's scene change score, and, if it has audio, how loud it is.
+func scoreSeconds(ctx context.Context, ffmpegPath, filePath string, probe videoProbe) ([]float64, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg highlights", tracing.KindInternal)
+	defer span.End()
+	dir, err := os.MkdirTemp(filepath.Dir(filePath), "highlights-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	motionPath := filepath.Join(dir, "motion.txt")
+	audioPath := filepath.Join(dir, "audio.txt")
+
+	// Both are measured on a small, slow copy of the video, which is plenty
+	// to compare seconds with each other. Audio is cut into one-second
+	// frames so each gets its own level.
+	filter := "[0:v]fps=4,scale=160:-2,select='gte(scene,0)',metadata=print:key=lavfi.scene_score:file=" + motionPath
+	if probe.HasAudio {
+		filter += ";[0:a]aresample=8000,asetnsamples=n=8000,astats=metadata=1:reset=1,ametadata=print:key=lavfi.astats.Overall.RMS_level:file=" + audioPath
+	}
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-i", filePath, "-filter_complex", filter, "-f", "null", "-")
+	if err := runCommand(cmd); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	seconds := max(int(probe.DurationSeconds), 1)
+	motion, err := readFrameMetadata(motionPath, "lavfi.scene_score")
+	if err != nil {
+		return nil, err
+	}
+	scores := perSecond(motion, seconds)
+	normalize(scores)
+	if probe.HasAudio {
+		levels, err := readFrameMetadata(audioPath, "lavfi.astats.Overall.RMS_level")
+		if err != nil {
+			return nil, err
+		}
+		loudness := perSecond(levels, seconds)
+		normalize(loudness)
+		for i := range scores {
+			scores[i] += loudness[i]
+		}
+	}
+	return scores, nil
+}
+
+// pickHighlights chooses the start seconds of the highest scoring clips of
+// clipSeconds that don't overlap, until they add up to totalSeconds, in
+// the order they appear in the video.
+func pickHighlights(scores []float64, clipSeconds, totalSeconds int) []int {
+	type window struct {
+		start int
+		score float64
+	}
+	var windows []window
+	for start := 0; start+clipSeconds <= len(scores); start++ {
+		sum := 0.0
+		for _, s := range scores[start : start+clipSeconds] {
+			sum += s
+		}
+		windows = append(windows, window{start: start, score: sum})
+	}
+	slices.SortStableFunc(windows, func(a, b window) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+		return 0
+	})
+
+	var starts []int
+	for _, w := range windows {
+		if len(starts)*clipSeconds >= totalSeconds {
+			break
+		}
+		overlaps := slices.ContainsFunc(starts, func(s int) bool {
+			return w.start < s+clipSeconds && s < w.start+clipSeconds
+		})
+		if !overlaps {
+			starts = append(starts, w.start)
+		}
+	}
+	slices.Sort(starts)
+	return starts
+}
+
+// stitchClips cuts clips of clipSeconds starting at starts out of a video
+// and joins them into a new H.264 MP4 beside it.
+func stitchClips(ctx context.Context, ffmpegPath, filePath string, starts []int, clipSeconds int, hasAudio bool) (string, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg trailer", tracing.KindInternal)
+	defer span.End()
+	outputPath := filePath + ".trailer.mp4"
+
+	var filter, inputs strings.Builder
+	for i, start := range starts {
+		fmt.Fprintf(&filter, "[0:v]trim=start=%d:duration=%d,setpts=PTS-STARTPTS[v%d];", start, clipSeconds, i)
+		fmt.Fprintf(&inputs, "[v%d]", i)
+		if hasAudio {
+			fmt.Fprintf(&filter, "[0:a]atrim=start=%d:duration=%d,asetpts=PTS-STARTPTS[a%d];", start, clipSeconds, i)
+			fmt.Fprintf(&inputs, "[a%d]", i)
+		}
+	}
+	audioStreams := 0
+	args := []string{"-i", filePath, "-map", "[v]"}
+	if hasAudio {
+		audioStreams = 1
+		args = append(args, "-map", "[a]", "-c:a", "aac", "-b:a", "128k")
+	}
+	fmt.Fprintf(&filter, "%sconcat=n=%d:v=1:a=%d[v]", inputs.String(), len(starts), audioStreams)
+	if hasAudio {
+		filter.WriteString("[a]")
+	}
+	args = append(args,
+		"-filter_complex", filter.String(),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-movflags", "faststart",
+		"-y", outputPath,
+	)
+	if err := runCommand(exec.CommandContext(ctx, ffmpegPath, args...)); err != nil {
+		span.RecordError(err)
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// packageVideoTrailer stitches a video's most eventful moments, where the
+// most changes on screen and the audio is loudest, into a short trailer
+// and stores it in S3.
+func (cfg *apiConfig) packageVideoTrailer(ctx context.Context, processedPath string, probe videoProbe) (database.Rendition, error) {
+	var scores []float64
+	err := cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		scores, err = scoreSeconds(ctx, cfg.ffmpegPath, processedPath, probe)
+		return err
+	})
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't score video: %w", err)
+	}
+	starts := pickHighlights(scores, trailerClipSeconds, trailerSeconds)
+
+	var trailerPath string
+	err = cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		trailerPath, err = stitchClips(ctx, cfg.ffmpegPath, processedPath, starts, trailerClipSeconds, probe.HasAudio)
+		return err
+	})
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't stitch trailer: %w", err)
+	}
+	defer os.Remove(trailerPath)
+
+	key, size, err := cfg.uploadEncodedFile(ctx, trailerPath, string(probe.aspect()), "video/mp4")
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't write trailer to s3: %w", err)
+	}
+	return database.Rendition{
+		Quality:          database.RenditionQualityTrailer,
+		Codec:            "h264",
+		S3Key:            key,
+		SizeBytes:        size,
+		Bitrate:          int64(float64(size*8) / float64(len(starts)*trailerClipSeconds)),
+		ContainerProfile: containerProfileProgressive,
+	}, nil
+}
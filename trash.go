@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// runTrashPurger periodically purges videos that have been in the trash for
+// longer than the retention period. It returns when ctx is cancelled.
+func (cfg *apiConfig) runTrashPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cfg.purgeTrash(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) purgeTrash(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-cfg.trashRetention)
+	videos, err := cfg.db.GetVideosDeletedBefore(ctx, cutoff)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't list expired trash", "error", err)
+		return
+	}
+
+	for _, video := range videos {
+		err := cfg.purgeVideo(ctx, video)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't purge video", "video_id", video.ID, "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Purged video from trash", "video_id", video.ID)
+	}
+}
+
+// purgeVideo removes a video's stored objects and then its row. The row is
+// only deleted once the objects are gone so a failed purge is retried on the
+// next run rather than leaking objects.
+func (cfg *apiConfig) purgeVideo(ctx context.Context, video database.Video) error {
+	renditions, err := cfg.db.GetRenditions(ctx, video.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get renditions: %w", err)
+	}
+	keys := map[string]bool{}
+	for _, rendition := range renditions {
+		keys[rendition.S3Key] = true
+	}
+	if video.VideoURL != nil {
+		if key, ok := cfg.s3KeyFromURL(*video.VideoURL); ok {
+			keys[key] = true
+		}
+	}
+	for key := range keys {
+		err := cfg.deleteVideoObject(ctx, key)
+		if err != nil {
+			return fmt.Errorf("couldn't delete video object: %w", err)
+		}
+	}
+	quarantined, err := cfg.db.GetQuarantinedObject(ctx, video.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get quarantined file: %w", err)
+	}
+	if quarantined != nil && quarantined.Status == database.QuarantinePending {
+		if err := cfg.deleteQuarantinedFile(ctx, *quarantined); err != nil {
+			return fmt.Errorf("couldn't delete quarantined file: %w", err)
+		}
+	}
+	if video.ThumbnailURL != nil {
+		err := cfg.deleteAsset(*video.ThumbnailURL)
+		if err != nil {
+			return fmt.Errorf("couldn't delete thumbnail: %w", err)
+		}
+	}
+	variants, err := cfg.db.GetThumbnailVariants(ctx, video.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get thumbnail variants: %w", err)
+	}
+	for _, variant := range variants {
+		if err := cfg.deleteAsset(variant.URL); err != nil {
+			return fmt.Errorf("couldn't delete thumbnail variant: %w", err)
+		}
+	}
+	return cfg.db.DeleteVideo(ctx, video.ID)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// pendingUploadTimeout is how long an upload may stay pending before the
+// reconciler assumes the request that started it is gone.
+const pendingUploadTimeout = 6 * time.Hour
+
+// jobSourceRetention is how long a spooled upload is kept after its job
+// failed or was cancelled, for an admin to retry it.
+const jobSourceRetention = 7 * 24 * time.Hour
+
+// abandonUpload removes the object of an upload that won't be finalized,
+// then its pending record. If the object can't be deleted the record is
+// kept so the reconciler retries. It reports whether the object was removed.
+func (cfg *apiConfig) abandonUpload(ctx context.Context, upload database.PendingUpload) bool {
+	if err := cfg.deleteS3Object(ctx, upload.S3Key); err != nil {
+		slog.ErrorContext(ctx, "Couldn't delete abandoned upload", "key", upload.S3Key, "error", err)
+		return false
+	}
+	if err := cfg.db.DeletePendingUpload(ctx, upload.ID); err != nil {
+		slog.ErrorContext(ctx, "Couldn't clear pending upload", "upload_id", upload.ID, "error", err)
+	}
+	return true
+}
+
+// runUploadReconciler periodically cleans up uploads that were never
+// finalized. It returns when ctx is cancelled.
+func (cfg *apiConfig) runUploadReconciler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cfg.reconcileUploads(ctx)
+		cfg.removeStaleSources(ctx)
+		cfg.abortExpiredUploads(ctx)
+		cfg.discardExpiredFormUploads(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) reconcileUploads(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-pendingUploadTimeout)
+	uploads, err := cfg.db.GetPendingUploadsBefore(ctx, cutoff)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't list pending uploads", "error", err)
+		return
+	}
+
+	for _, upload := range uploads {
+		video, err := cfg.db.GetVideo(ctx, upload.VideoID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't get video for pending upload", "video_id", upload.VideoID, "error", err)
+			continue
+		}
+
+		if video.VideoURL != nil {
+			if key, ok := cfg.s3KeyFromURL(*video.VideoURL); ok && key == upload.S3Key {
+				// The video already points at the object; only the record is
+				// stale.
+				if err := cfg.db.DeletePendingUpload(ctx, upload.ID); err != nil {
+					slog.ErrorContext(ctx, "Couldn't clear pending upload", "upload_id", upload.ID, "error", err)
+				}
+				continue
+			}
+		}
+
+		if !cfg.abandonUpload(ctx, upload) {
+			continue
+		}
+		slog.InfoContext(ctx, "Removed orphaned upload", "key", upload.S3Key, "video_id", upload.VideoID)
+
+		// The request that was processing the video never reset its status.
+		if video.ID != uuid.Nil && video.Status == database.VideoStatusProcessing {
+			status := database.VideoStatusFailed
+			if video.VideoURL != nil {
+				status = database.VideoStatusReady
+			}
+			if err := cfg.db.SetVideoStatus(ctx, video.ID, status); err != nil {
+				slog.ErrorContext(ctx, "Couldn't reset video status", "video_id", video.ID, "error", err)
+			}
+		}
+	}
+}
+
+// removeStaleSources deletes spooled uploads older than jobSourceRetention.
+// Files are removed as soon as their job succeeds, so anything this old
+// belongs to a job that failed or was cancelled and wasn't retried.
+func (cfg *apiConfig) removeStaleSources(ctx context.Context) {
+	entries, err := os.ReadDir(cfg.uploadsRoot)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't list uploads directory", "error", err)
+		return
+	}
+	cutoff := time.Now().Add(-jobSourceRetention)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "upload-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		path := filepath.Join(cfg.uploadsRoot, entry.Name())
+		if err := os.Remove(path); err != nil {
+			slog.ErrorContext(ctx, "Couldn't remove stale upload", "path", path, "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "Removed stale upload", "path", path)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/tracing"
+)
+
+// verticalCropConfig selects how the 9:16 crop of a landscape video is
+// positioned.
+type verticalCropConfig struct {
+	// provider is "cropdetect" to centre the crop on the picture inside any
+	// black bars, or "command" to follow the subject a local model finds in
+	// sampled frames.
+	provider string
+	command  string
+	// frames is how many frames are sampled for the model.
+	frames int
+}
+
+// subjectTracker finds the subject in sampled frames. It returns, for each
+// frame, the horizontal centre of the subject as a fraction of the frame's
+// width, or nil where there's no subject.
+type subjectTracker interface {
+	Track(ctx context.Context, frames []string) ([]*float64, error)
+}
+
+// commandTracker runs a local model, passing the frame paths as arguments
+// and reading {"centers": [0.42, null, ...]} from its stdout.
+type commandTracker struct {
+	path string
+}
+
+func (t commandTracker) Track(ctx context.Context, frames []string) ([]*float64, error) {
+	cmd := exec.CommandContext(ctx, t.path, frames...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := runCommand(cmd); err != nil {
+		return nil, err
+	}
+	var result struct {
+		Centers []*float64 `json:"centers"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("couldn't decode tracker output: %w", err)
+	}
+	return result.Centers, nil
+}
+
+// verticalCropper makes vertical renditions. tracker is nil when the crop
+// is simply centred.
+type verticalCropper struct {
+	tracker subjectTracker
+	frames  int
+}
+
+func newVerticalCropper(conf verticalCropConfig) *verticalCropper {
+	c := &verticalCropper{frames: conf.frames}
+	if conf.provider == "command" {
+		c.tracker = commandTracker{path: conf.command}
+	}
+	return c
+}
+
+// cropRect is a rectangle of a video's picture, in pixels.
+type cropRect struct {
+	X, Y, W, H int
+}
+
+// detectPicture finds the part of a video's frames that isn't black bars,
+// across the whole video.
+func detectPicture(ctx context.Context, ffmpegPath, filePath string) (cropRect, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg cropdetect", tracing.KindInternal)
+	defer span.End()
+	out, err := os.CreateTemp(filepath.Dir(filePath), "cropdetect-*.txt")
+	if err != nil {
+		return cropRect{}, err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	// With reset=0 each frame's result covers every frame before it, so
+	// the last one covers the video. One frame a second is plenty.
+	cmd := exec.CommandContext(ctx,
+		ffmpegPath, "-i", filePath,
+		"-vf", "fps=1,cropdetect=round=2:reset=0,metadata=print:file="+out.Name(),
+		"-an", "-f", "null", "-",
+	)
+	if err := runCommand(cmd); err != nil {
+		span.RecordError(err)
+		return cropRect{}, err
+	}
+	f, err := os.Open(out.Name())
+	if err != nil {
+		return cropRect{}, err
+	}
+	defer f.Close()
+
+	var rect cropRect
+	fields := map[string]*int{
+		"lavfi.cropdetect.x": &rect.X,
+		"lavfi.cropdetect.y": &rect.Y,
+		"lavfi.cropdetect.w": &rect.W,
+		"lavfi.cropdetect.h": &rect.H,
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if field, known := fields[key]; ok && known {
+			if n, err := strconv.Atoi(value); err == nil {
+				*field = n
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cropRect{}, err
+	}
+	if rect.W <= 0 || rect.H <= 0 {
+		return cropRect{}, errors.New("cropdetect found no picture")
+	}
+	return rect, nil
+}
+
+// verticalCrop is the tallest 9:16 window that fits in picture, with even
+// dimensions as the encoder needs.
+func verticalCrop(picture cropRect) (w, h int) {
+	h = min(picture.H, picture.W*16/9) &^ 1
+	w = (h * 9 / 16) &^ 1
+	return w, h
+}
+
+// trackedCropX is a crop filter x expression that pans a w-wide window
+// across picture to follow the subject, moving linearly between the
+// sampled frames. centers are fractions of frameWidth, one per frame,
+// spread evenly over durationSeconds; frames without a subject hold the
+// previous position, or the middle.
+func trackedCropX(centers []*float64, frameWidth, w int, picture cropRect, durationSeconds float64) string {
+	xs := make([]float64, len(centers))
+	prev := float64(picture.X) + float64(picture.W-w)/2
+	for i, c := range centers {
+		if c != nil {
+			prev = *c*float64(frameWidth) - float64(w)/2
+			prev = max(float64(picture.X), min(prev, float64(picture.X+picture.W-w)))
+		}
+		xs[i] = prev
+	}
+	// Average neighbouring samples so a jittery detection doesn't shake the
+	// picture.
+	smoothed := make([]float64, len(xs))
+	for i := range xs {
+		lo, hi := max(i-1, 0), min(i+1, len(xs)-1)
+		sum := 0.0
+		for _, x := range xs[lo : hi+1] {
+			sum += x
+		}
+		smoothed[i] = sum / float64(hi-lo+1)
+	}
+
+	step := durationSeconds / float64(len(smoothed))
+	expr := strconv.Itoa(int(smoothed[len(smoothed)-1]))
+	for i := len(smoothed) - 2; i >= 0; i-- {
+		t0, t1 := float64(i)*step, float64(i+1)*step
+		expr = fmt.Sprintf("if(lt(t,%.3f),lerp(%d,%d,(t-%.3f)/%.3f),%s)", t1, int(smoothed[i]), int(smoothed[i+1]), t0, step, expr)
+	}
+	return expr
+}
+
+// encodeVertical crops a video to a w by h window at x, an expression in t,
+// and y, re-encoding it as H.264 beside the input.
+func encodeVertical(ctx context.Context, ffmpegPath, filePath string, w, h int, x string, y int) (string, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg vertical", tracing.KindInternal)
+	defer span.End()
+	outputPath := filePath + ".vertical.mp4"
+	cmd := exec.CommandContext(ctx,
+		ffmpegPath, "-i", filePath,
+		"-vf", fmt.Sprintf("crop=w=%d:h=%d:x='%s':y=%d", w, h, x, y),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-c:a", "copy",
+		"-movflags", "faststart",
+		"-y", outputPath,
+	)
+	if err := runCommand(cmd); err != nil {
+		span.RecordError(err)
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// packageVideoVertical makes a 9:16 crop of a landscape video for
+// publishing as a short, following its subject when a tracker is
+// configured, and stores it in S3.
+func (cfg *apiConfig) packageVideoVertical(ctx context.Context, processedPath string, probe videoProbe) (database.Rendition, error) {
+	var picture cropRect
+	err := cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		picture, err = detectPicture(ctx, cfg.ffmpegPath, processedPath)
+		return err
+	})
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't detect picture: %w", err)
+	}
+	w, h := verticalCrop(picture)
+	y := picture.Y + (picture.H-h)/2
+	x := strconv.Itoa(picture.X + (picture.W-w)/2)
+
+	if t := cfg.verticalCropper.tracker; t != nil {
+		var dir string
+		var frames []string
+		err := cfg.ffmpegBreaker.do(ctx, func() (err error) {
+			dir, frames, err = sampleFrames(ctx, cfg.ffmpegPath, processedPath, probe.DurationSeconds, cfg.verticalCropper.frames)
+			return err
+		})
+		if err != nil {
+			return database.Rendition{}, fmt.Errorf("couldn't sample frames: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		centers, err := t.Track(ctx, frames)
+		if err != nil {
+			return database.Rendition{}, fmt.Errorf("couldn't track subject: %w", err)
+		}
+		if len(centers) != len(frames) {
+			return database.Rendition{}, fmt.Errorf("tracker returned %d results for %d frames", len(centers), len(frames))
+		}
+		x = trackedCropX(centers, probe.Width, w, picture, probe.DurationSeconds)
+	}
+
+	var verticalPath string
+	err = cfg.ffmpegBreaker.do(ctx, func() (err error) {
+		verticalPath, err = encodeVertical(ctx, cfg.ffmpegPath, processedPath, w, h, x, y)
+		return err
+	})
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't encode vertical rendition: %w", err)
+	}
+	defer os.Remove(verticalPath)
+
+	key, size, err := cfg.uploadEncodedFile(ctx, verticalPath, string(database.AspectPortrait), "video/mp4")
+	if err != nil {
+		return database.Rendition{}, fmt.Errorf("couldn't write vertical rendition to s3: %w", err)
+	}
+
+	var bitrate int64
+	if probe.DurationSeconds > 0 {
+		bitrate = int64(float64(size*8) / probe.DurationSeconds)
+	}
+	return database.Rendition{
+		Quality:          database.RenditionQualityVertical,
+		Codec:            "h264",
+		S3Key:            key,
+		SizeBytes:        size,
+		Bitrate:          bitrate,
+		ContainerProfile: containerProfileProgressive,
+	}, nil
+}
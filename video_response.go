@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// videoResponse is a video as seen by a particular viewer, with their
+// per-user state alongside the shared metadata. ETags are computed over this
+// representation so If-Match works with the tag from the viewer's last GET.
+type videoResponse struct {
+	database.Video
+	Renditions       []renditionResponse        `json:"renditions"`
+	Trailer          *renditionResponse         `json:"trailer,omitempty"`
+	Chapters         []database.Chapter         `json:"chapters"`
+	AudioTracks      []database.AudioTrack      `json:"audio_tracks"`
+	PlaybackPosition *database.PlaybackPosition `json:"playback_position,omitempty"`
+	InWatchLater     *bool                      `json:"in_watch_later,omitempty"`
+}
+
+type renditionResponse struct {
+	Quality   string `json:"quality"`
+	Codec     string `json:"codec"`
+	URL       string `json:"url"`
+	SizeBytes int64  `json:"size_bytes"`
+	Bitrate   int64  `json:"bitrate"`
+	// ContainerProfile is set on MP4 renditions written with a profile.
+	ContainerProfile string `json:"container_profile,omitempty"`
+}
+
+// newVideoResponse adds the video's renditions, chapters, and audio tracks
+// and the viewer's state to a video, with playback URLs signed for the
+// viewer. Anonymous viewers (uuid.Nil) get no per-user state.
+func (cfg *apiConfig) newVideoResponse(ctx context.Context, video database.Video, viewerID uuid.UUID) (videoResponse, error) {
+	expiresAt := cfg.playbackTokenExpiry(time.Now())
+	renditions, trailer, err := cfg.playbackRenditions(ctx, video.ID, viewerID, expiresAt)
+	if err != nil {
+		return videoResponse{}, err
+	}
+	chapters, err := cfg.db.GetChapters(ctx, video.ID)
+	if err != nil {
+		return videoResponse{}, err
+	}
+	audioTracks, err := cfg.db.GetAudioTracks(ctx, video.ID)
+	if err != nil {
+		return videoResponse{}, err
+	}
+	resp := videoResponse{Video: video, Renditions: renditions, Trailer: trailer, Chapters: chapters, AudioTracks: audioTracks}
+	if video.VideoURL != nil {
+		videoURL := cfg.playbackURL(ctx, *video.VideoURL, video.ID, viewerID, expiresAt)
+		resp.VideoURL = &videoURL
+	}
+	if viewerID == uuid.Nil {
+		return resp, nil
+	}
+	position, err := cfg.db.GetPlaybackPosition(ctx, viewerID, video.ID)
+	if err != nil {
+		return videoResponse{}, err
+	}
+	resp.PlaybackPosition = position
+
+	inWatchLater, err := cfg.db.IsInWatchLater(ctx, viewerID, video.ID)
+	if err != nil {
+		return videoResponse{}, err
+	}
+	resp.InWatchLater = &inWatchLater
+	return resp, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// canViewVideo reports whether a viewer may retrieve a video and its playback
+// URL. Public and unlisted videos are viewable by anyone who knows the ID;
+// private videos only by their owner and members of their channel. Videos
+// that aren't available, see videoAvailable, are only viewable by their
+// owner. viewerID is uuid.Nil for anonymous requests.
+func (cfg *apiConfig) canViewVideo(ctx context.Context, video database.Video, viewerID uuid.UUID) bool {
+	if !cfg.videoAvailable(ctx, video, viewerID) {
+		return false
+	}
+	if video.Visibility != database.VisibilityPrivate {
+		return true
+	}
+	return cfg.hasVideoRole(ctx, video, viewerID, database.ChannelRoleViewer)
+}
+
+// videoAvailable reports whether a video may be played by viewerID at all,
+// whatever its visibility: once it's been taken down, or while its owner is
+// suspended, only the owner may. Share links, embed tokens, and HLS key
+// tokens open up private videos without going through canViewVideo, so they
+// check this directly.
+func (cfg *apiConfig) videoAvailable(ctx context.Context, video database.Video, viewerID uuid.UUID) bool {
+	if video.UserID == viewerID {
+		return true
+	}
+	if video.TakenDownAt != nil {
+		return false
+	}
+	suspended, err := cfg.db.IsUserSuspended(ctx, video.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't check whether owner is suspended", "video_id", video.ID, "error", err)
+		return false
+	}
+	return !suspended
+}
+
+// canEditVideo reports whether a user may change a video's metadata or
+// files: its owner, or editors and above in its channel.
+func (cfg *apiConfig) canEditVideo(ctx context.Context, video database.Video, userID uuid.UUID) bool {
+	return cfg.hasVideoRole(ctx, video, userID, database.ChannelRoleEditor)
+}
+
+func (cfg *apiConfig) hasVideoRole(ctx context.Context, video database.Video, userID uuid.UUID, min database.ChannelRole) bool {
+	if userID == uuid.Nil {
+		return false
+	}
+	if video.UserID == userID {
+		return true
+	}
+	if video.ChannelID == nil {
+		return false
+	}
+	role, err := cfg.db.GetChannelRole(ctx, *video.ChannelID, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't get channel role", "video_id", video.ID, "error", err)
+		return false
+	}
+	return role.AtLeast(min)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestVideoAvailable(t *testing.T) {
+	ownerID := uuid.New()
+	takenDownAt := time.Now()
+	tests := []struct {
+		name      string
+		video     database.Video
+		suspended bool
+		viewerID  uuid.UUID
+		want      bool
+	}{
+		{"available", database.Video{}, false, uuid.Nil, true},
+		{"taken down", database.Video{TakenDownAt: &takenDownAt}, false, uuid.Nil, false},
+		{"taken down, owner", database.Video{TakenDownAt: &takenDownAt}, false, ownerID, true},
+		{"owner suspended", database.Video{}, true, uuid.New(), false},
+		{"owner suspended, owner", database.Video{}, true, ownerID, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, store, _ := newTestConfig(t)
+			store.IsUserSuspendedFunc = func(ctx context.Context, id uuid.UUID) (bool, error) {
+				return id == ownerID && tc.suspended, nil
+			}
+			tc.video.ID = uuid.New()
+			tc.video.UserID = ownerID
+			if got := cfg.videoAvailable(context.Background(), tc.video, tc.viewerID); got != tc.want {
+				t.Errorf("videoAvailable = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCanViewVideo(t *testing.T) {
+	ownerID := uuid.New()
+	memberID := uuid.New()
+	channelID := uuid.New()
+	tests := []struct {
+		name       string
+		visibility database.Visibility
+		suspended  bool
+		viewerID   uuid.UUID
+		want       bool
+	}{
+		{"public, anonymous", database.VisibilityPublic, false, uuid.Nil, true},
+		{"unlisted, anonymous", database.VisibilityUnlisted, false, uuid.Nil, true},
+		{"private, anonymous", database.VisibilityPrivate, false, uuid.Nil, false},
+		{"private, stranger", database.VisibilityPrivate, false, uuid.New(), false},
+		{"private, channel member", database.VisibilityPrivate, false, memberID, true},
+		{"private, owner", database.VisibilityPrivate, false, ownerID, true},
+		{"public, owner suspended", database.VisibilityPublic, true, uuid.Nil, false},
+		{"public, owner suspended, owner", database.VisibilityPublic, true, ownerID, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, store, _ := newTestConfig(t)
+			store.IsUserSuspendedFunc = func(ctx context.Context, id uuid.UUID) (bool, error) {
+				return tc.suspended, nil
+			}
+			store.GetChannelRoleFunc = func(ctx context.Context, cID, userID uuid.UUID) (database.ChannelRole, error) {
+				if cID == channelID && userID == memberID {
+					return database.ChannelRoleViewer, nil
+				}
+				return "", nil
+			}
+			video := database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: ownerID, ChannelID: &channelID, Visibility: tc.visibility}}
+			if got := cfg.canViewVideo(context.Background(), video, tc.viewerID); got != tc.want {
+				t.Errorf("canViewVideo = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	eventVideoCreated           = "video.created"
+	eventVideoUploaded          = "video.uploaded"
+	eventVideoThumbnailUploaded = "video.thumbnail_uploaded"
+	eventVideoDeleted           = "video.deleted"
+	eventVideoRestored          = "video.restored"
+	// eventSubscriptionUpload is sent to subscribers, not the video's owner.
+	eventSubscriptionUpload = "subscription.new_upload"
+)
+
+var webhookEventTypes = map[string]bool{
+	eventVideoCreated:           true,
+	eventVideoUploaded:          true,
+	eventVideoThumbnailUploaded: true,
+	eventVideoDeleted:           true,
+	eventVideoRestored:          true,
+	eventSubscriptionUpload:     true,
+}
+
+const jobTypeDeliverWebhook = "deliver_webhook"
+
+// maxWebhookAttempts is how many times a delivery is tried before its job is
+// dead-lettered. Retries back off like any other job's.
+const maxWebhookAttempts = 5
+
+// errWebhookAddress is returned when a webhook URL resolves to an address
+// that isn't on the public internet.
+var errWebhookAddress = errors.New("webhook URL must resolve to a public address")
+
+// webhookClient only connects to public addresses. The check runs on the
+// address actually dialled, after DNS resolution, so a hostname that
+// re-resolves to an internal address between validation and delivery is
+// still refused. Redirects aren't followed; a 3XX counts as a failed
+// delivery. No proxy is used, since the proxy's address would be the one
+// checked.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: checkWebhookDial,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func checkWebhookDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !publicIP(ip) {
+		return errWebhookAddress
+	}
+	return nil
+}
+
+// nonPublicPrefixes are special-purpose ranges the net.IP predicates in
+// publicIP don't cover. NAT64 prefixes are included because a gateway
+// translates them to any IPv4 address, internal ones too.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// publicIP reports whether ip is routable on the public internet, rejecting
+// loopback, private, link-local, multicast and unspecified addresses, and
+// the special-purpose ranges in nonPublicPrefixes.
+func publicIP(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	// An IPv4-mapped IPv6 address reaches the IPv4 address it maps.
+	addr = addr.Unmap()
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return !addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified()
+}
+
+type webhookEvent struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type webhookDeliveryPayload struct {
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventType      string          `json:"event_type"`
+	Body           json.RawMessage `json:"body"`
+}
+
+// publishEvent queues a delivery job for every matching webhook subscription
+// of the user. Queued deliveries survive a restart, and delivery failures
+// are recorded in the delivery log and never affect the request that
+// triggered the event.
+func (cfg *apiConfig) publishEvent(ctx context.Context, userID uuid.UUID, eventType string, data any) {
+	subs, err := cfg.db.GetWebhookSubscriptionsForEvent(ctx, userID, eventType)
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't look up webhook subscriptions", "event", eventType, "error", err)
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(webhookEvent{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Couldn't marshal webhook event", "event", eventType, "error", err)
+		return
+	}
+
+	for _, sub := range subs {
+		_, err := cfg.db.CreateJob(context.WithoutCancel(ctx), database.CreateJobParams{
+			Type: jobTypeDeliverWebhook,
+			Payload: webhookDeliveryPayload{
+				SubscriptionID: sub.ID,
+				EventType:      eventType,
+				Body:           body,
+			},
+			MaxAttempts: maxWebhookAttempts,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Couldn't queue webhook delivery", "subscription_id", sub.ID, "event", eventType, "error", err)
+		}
+	}
+}
+
+// runDeliverWebhookJob POSTs the event once and logs the attempt. A failed
+// attempt fails the job, so the job queue retries it with backoff until the
+// endpoint answers with a 2XX or the attempts run out.
+func (cfg *apiConfig) runDeliverWebhookJob(ctx context.Context, job database.Job) error {
+	var payload webhookDeliveryPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	sub, err := cfg.db.GetWebhookSubscription(ctx, payload.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	if sub.ID == uuid.Nil {
+		// The subscription was deleted after the event was queued.
+		return nil
+	}
+
+	delivery := database.WebhookDelivery{
+		ID:             uuid.New(),
+		SubscriptionID: sub.ID,
+		EventType:      payload.EventType,
+		Payload:        string(payload.Body),
+		Attempt:        job.Attempts,
+	}
+	statusCode, sendErr := sendWebhook(ctx, sub, payload.EventType, delivery.ID, payload.Body)
+	if statusCode != 0 {
+		delivery.StatusCode = &statusCode
+	}
+	if sendErr != nil {
+		msg := sendErr.Error()
+		delivery.Error = &msg
+	} else {
+		delivery.Success = true
+	}
+	if err := cfg.db.CreateWebhookDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		slog.ErrorContext(ctx, "Couldn't record webhook delivery", "subscription_id", sub.ID, "error", err)
+	}
+	return sendErr
+}
+
+func sendWebhook(ctx context.Context, sub database.WebhookSubscription, eventType string, deliveryID uuid.UUID, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Tubely-Webhooks/1.0")
+	req.Header.Set("X-Tubely-Event", eventType)
+	req.Header.Set("X-Tubely-Delivery", deliveryID.String())
+	req.Header.Set("X-Tubely-Timestamp", timestamp)
+	req.Header.Set("X-Tubely-Signature", "sha256="+signWebhookPayload(sub.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhookPayload computes the HMAC-SHA256 of "<timestamp>.<body>".
+// Including the timestamp lets receivers reject replayed deliveries.
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
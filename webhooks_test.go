@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"192.0.0.8", false},
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b:1::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:100.64.0.1", false},
+	}
+	for _, tc := range tests {
+		if got := publicIP(net.ParseIP(tc.ip)); got != tc.want {
+			t.Errorf("publicIP(%s) = %v, want %v", tc.ip, got, tc.want)
+		}
+	}
+}
+
+func TestValidateWebhookParams(t *testing.T) {
+	events := []string{eventVideoUploaded}
+	tests := []struct {
+		url     string
+		events  []string
+		wantErr bool
+	}{
+		{"https://hooks.example.com/tubely", events, false},
+		{"ftp://hooks.example.com/tubely", events, true},
+		{"/tubely", events, true},
+		{"http://localhost:8080/hook", events, true},
+		{"http://127.0.0.1/hook", events, true},
+		{"http://[::1]/hook", events, true},
+		{"http://169.254.169.254/latest/meta-data", events, true},
+		{"http://100.64.0.1/hook", events, true},
+		{"https://hooks.example.com/tubely", nil, true},
+		{"https://hooks.example.com/tubely", []string{"video.exploded"}, true},
+	}
+	for _, tc := range tests {
+		err := validateWebhookParams(tc.url, tc.events)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("validateWebhookParams(%q, %v) = %v, want error %v", tc.url, tc.events, err, tc.wantErr)
+		}
+	}
+}
+
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("webhook delivered to a loopback address")
+	}))
+	defer srv.Close()
+
+	sub := database.WebhookSubscription{ID: uuid.New(), URL: srv.URL, Secret: "secret"}
+	_, err := sendWebhook(context.Background(), sub, eventVideoUploaded, uuid.New(), []byte("{}"))
+	if !errors.Is(err, errWebhookAddress) {
+		t.Errorf("sendWebhook to %s = %v, want %v", srv.URL, err, errWebhookAddress)
+	}
+}
+
+func TestWebhookClientDoesNotFollowRedirects(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "https://hooks.example.com/", nil)
+	if err := webhookClient.CheckRedirect(req, []*http.Request{req}); !errors.Is(err, http.ErrUseLastResponse) {
+		t.Errorf("CheckRedirect = %v, want %v", err, http.ErrUseLastResponse)
+	}
+}
+
+func TestSendWebhookSignsPayload(t *testing.T) {
+	const secret = "webhook-secret"
+	body := []byte(`{"type":"video.uploaded"}`)
+	deliveryID := uuid.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		timestamp := r.Header.Get("X-Tubely-Timestamp")
+		if ts, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+			t.Errorf("X-Tubely-Timestamp = %q, want the current Unix time", timestamp)
+		}
+		if want := "sha256=" + signWebhookPayload(secret, timestamp, got); r.Header.Get("X-Tubely-Signature") != want {
+			t.Errorf("X-Tubely-Signature = %q, want %q", r.Header.Get("X-Tubely-Signature"), want)
+		}
+		if r.Header.Get("X-Tubely-Event") != eventVideoUploaded || r.Header.Get("X-Tubely-Delivery") != deliveryID.String() {
+			t.Errorf("event headers = %q, %q", r.Header.Get("X-Tubely-Event"), r.Header.Get("X-Tubely-Delivery"))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	// The test server is on loopback, which the real client refuses.
+	client := webhookClient
+	webhookClient = srv.Client()
+	defer func() { webhookClient = client }()
+
+	sub := database.WebhookSubscription{ID: uuid.New(), URL: srv.URL, Secret: secret}
+	status, err := sendWebhook(context.Background(), sub, eventVideoUploaded, deliveryID, body)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("sendWebhook = %d, %v", status, err)
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// Receivers compute the same HMAC-SHA256 of "<timestamp>.<body>".
+	got := signWebhookPayload("secret", "1700000000", []byte(`{}`))
+	const want = "b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+}
+
+func TestPublishEventQueuesDeliveries(t *testing.T) {
+	cfg, store, _ := newTestConfig(t)
+	userID := uuid.New()
+	subs := []database.WebhookSubscription{{ID: uuid.New()}, {ID: uuid.New()}}
+	store.GetWebhookSubscriptionsForEventFunc = func(ctx context.Context, id uuid.UUID, eventType string) ([]database.WebhookSubscription, error) {
+		if id != userID || eventType != eventVideoUploaded {
+			return nil, nil
+		}
+		return subs, nil
+	}
+	var jobs []database.CreateJobParams
+	store.CreateJobFunc = func(ctx context.Context, params database.CreateJobParams) (database.Job, error) {
+		jobs = append(jobs, params)
+		return database.Job{ID: uuid.New()}, nil
+	}
+
+	cfg.publishEvent(context.Background(), userID, eventVideoUploaded, map[string]string{"id": "video"})
+
+	if len(jobs) != len(subs) {
+		t.Fatalf("queued %d deliveries, want %d", len(jobs), len(subs))
+	}
+	for i, job := range jobs {
+		payload := job.Payload.(webhookDeliveryPayload)
+		if job.Type != jobTypeDeliverWebhook || job.MaxAttempts != maxWebhookAttempts || payload.SubscriptionID != subs[i].ID {
+			t.Errorf("job %d = %+v", i, job)
+		}
+		var event webhookEvent
+		if err := json.Unmarshal(payload.Body, &event); err != nil || event.Type != eventVideoUploaded {
+			t.Errorf("job %d body = %s, %v", i, payload.Body, err)
+		}
+	}
+}
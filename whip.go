@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+const (
+	// whipMaxBodyBytes caps SDP offers and trickled ICE candidates.
+	whipMaxBodyBytes = 64 << 10
+	whipTimeout      = 10 * time.Second
+)
+
+// whipClient talks to the WebRTC gateway.
+var whipClient = &http.Client{Timeout: whipTimeout}
+
+// whipGatewayEndpoint is where the gateway takes offers for a stream key.
+// The gateway republishes the session to the RTMP ingest as live/<key>, so
+// it goes live like any other stream.
+func (cfg *apiConfig) whipGatewayEndpoint(key string) string {
+	return strings.TrimSuffix(cfg.live.whipGatewayURL, "/") + "/" + liveApp + "/" + url.PathEscape(key) + "/whip"
+}
+
+// handlerWHIPPublish starts a WHIP session for a browser going live. The
+// stream key is sent as the bearer token, as WHIP clients do, and the SDP
+// offer is passed on to the gateway. The session URL the client is given
+// wraps the gateway's.
+func (cfg *apiConfig) handlerWHIPPublish(w http.ResponseWriter, r *http.Request) {
+	if cfg.live.whipGatewayURL == "" {
+		respondWithError(w, http.StatusNotImplemented, "WHIP ingest isn't enabled on this server", nil)
+		return
+	}
+	key, ok := cfg.whipStreamKey(w, r)
+	if !ok {
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/sdp" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Offer must be application/sdp", err)
+		return
+	}
+	offer, err := io.ReadAll(http.MaxBytesReader(w, r.Body, whipMaxBodyBytes))
+	if err != nil {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Offer is too large", err)
+		return
+	}
+
+	endpoint := cfg.whipGatewayEndpoint(key)
+	resp, err := cfg.forwardWHIP(r, http.MethodPost, endpoint, offer)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't reach WebRTC gateway", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		relayWHIPResponse(w, resp)
+		return
+	}
+
+	location, err := url.Parse(endpoint)
+	if err == nil {
+		location, err = location.Parse(resp.Header.Get("Location"))
+	}
+	if err != nil || !cfg.isWHIPSession(location, key) {
+		respondWithError(w, http.StatusBadGateway, "WebRTC gateway returned an invalid session", err)
+		return
+	}
+	session := base64.RawURLEncoding.EncodeToString([]byte(location.RequestURI()))
+	resp.Header.Set("Location", fmt.Sprintf("%s%s/whip/%s", cfg.baseURL, apiVersionPrefix, session))
+	relayWHIPResponse(w, resp)
+}
+
+// handlerWHIPSession passes trickled ICE candidates (PATCH) and the end of a
+// session (DELETE) on to the gateway.
+func (cfg *apiConfig) handlerWHIPSession(w http.ResponseWriter, r *http.Request) {
+	if cfg.live.whipGatewayURL == "" {
+		respondWithError(w, http.StatusNotImplemented, "WHIP ingest isn't enabled on this server", nil)
+		return
+	}
+	key, ok := cfg.whipStreamKey(w, r)
+	if !ok {
+		return
+	}
+	session, err := base64.RawURLEncoding.DecodeString(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find session", err)
+		return
+	}
+	gateway, err := url.Parse(cfg.live.whipGatewayURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't parse WebRTC gateway URL", err)
+		return
+	}
+	location, err := gateway.Parse(string(session))
+	if err != nil || !cfg.isWHIPSession(location, key) {
+		// Sessions belong to the key they were started with.
+		respondWithError(w, http.StatusNotFound, "Couldn't find session", err)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, whipMaxBodyBytes))
+	if err != nil {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Request is too large", err)
+		return
+	}
+
+	resp, err := cfg.forwardWHIP(r, r.Method, location.String(), body)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't reach WebRTC gateway", err)
+		return
+	}
+	defer resp.Body.Close()
+	relayWHIPResponse(w, resp)
+}
+
+// whipStreamKey reads the stream key a WHIP request is authorized with and
+// checks its user may stream.
+func (cfg *apiConfig) whipStreamKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find stream key", err)
+		return "", false
+	}
+	_, err = cfg.streamKeyUser(r.Context(), key)
+	switch {
+	case errors.Is(err, errStreamKeyInvalid):
+		respondWithError(w, http.StatusUnauthorized, "Invalid stream key", err)
+		return "", false
+	case errors.Is(err, errStreamingNotAllowed):
+		respondWithError(w, http.StatusForbidden, "Account can't stream", err)
+		return "", false
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check stream key", err)
+		return "", false
+	}
+	return key, true
+}
+
+// isWHIPSession reports whether u is a session on the gateway for the
+// stream key.
+func (cfg *apiConfig) isWHIPSession(u *url.URL, key string) bool {
+	endpoint, err := url.Parse(cfg.whipGatewayEndpoint(key))
+	if err != nil {
+		return false
+	}
+	streamPath := strings.TrimSuffix(endpoint.Path, "/whip") + "/"
+	return u.Scheme == endpoint.Scheme && u.Host == endpoint.Host && strings.HasPrefix(u.Path, streamPath)
+}
+
+func (cfg *apiConfig) forwardWHIP(r *http.Request, method, target string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.Context(), method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"Content-Type", "If-Match"} {
+		if v := r.Header.Get(name); v != "" {
+			req.Header.Set(name, v)
+		}
+	}
+	return whipClient.Do(req)
+}
+
+// relayWHIPResponse copies the gateway's response, with the headers WHIP
+// clients use: the answer's type, the session's ETag and Location, and
+// Link headers naming ICE servers.
+func relayWHIPResponse(w http.ResponseWriter, resp *http.Response) {
+	for _, name := range []string{"Content-Type", "ETag", "Location", "Link"} {
+		for _, v := range resp.Header.Values(name) {
+			w.Header().Add(name, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, io.LimitReader(resp.Body, whipMaxBodyBytes))
+}